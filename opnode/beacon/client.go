@@ -0,0 +1,207 @@
+package beacon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	genesisMethod      = "eth/v1/beacon/genesis"
+	specMethod         = "eth/v1/config/spec"
+	sidecarsMethodBase = "eth/v1/beacon/blob_sidecars/"
+	blindedBlockBase   = "eth/v1/beacon/blinded_blocks/"
+)
+
+// Client fetches blob sidecars, and the execution blocks of the canonical beacon chain,
+// from a beacon node with the standard beacon node HTTP API.
+type Client struct {
+	addr string
+	http *http.Client
+
+	// genesis time and slot duration, fetched once on first use
+	mu             sync.Mutex
+	genesisTime    uint64
+	secondsPerSlot uint64
+}
+
+var _ derive.BlobSidecarsFetcher = (*Client)(nil)
+
+// NewClient creates a client of the beacon node API at the given address.
+func NewClient(addr string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{addr: strings.TrimSuffix(addr, "/"), http: httpClient}
+}
+
+type apiGenesisResponse struct {
+	Data struct {
+		GenesisTime string `json:"genesis_time"`
+	} `json:"data"`
+}
+
+type apiSpecResponse struct {
+	Data struct {
+		SecondsPerSlot string `json:"SECONDS_PER_SLOT"`
+	} `json:"data"`
+}
+
+type apiBlobSidecar struct {
+	Index         string               `json:"index"`
+	Blob          derive.Blob          `json:"blob"`
+	KZGCommitment derive.KZGCommitment `json:"kzg_commitment"`
+	KZGProof      derive.KZGProof      `json:"kzg_proof"`
+}
+
+type apiBlobSidecarsResponse struct {
+	Data []*apiBlobSidecar `json:"data"`
+}
+
+type apiBlindedBlockResponse struct {
+	Data struct {
+		Message struct {
+			Body struct {
+				ExecutionPayloadHeader struct {
+					BlockHash common.Hash `json:"block_hash"`
+				} `json:"execution_payload_header"`
+			} `json:"body"`
+		} `json:"message"`
+	} `json:"data"`
+}
+
+func (c *Client) get(ctx context.Context, method string, query url.Values, dest interface{}) error {
+	u := c.addr + "/" + method
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("request %s: %w", method, ethereum.NotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("request %s failed with status %d: %s", method, resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("failed to decode response of %s: %w", method, err)
+	}
+	return nil
+}
+
+// slotParams returns the genesis time and the slot duration of the beacon chain.
+func (c *Client) slotParams(ctx context.Context) (genesisTime uint64, secondsPerSlot uint64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.secondsPerSlot != 0 {
+		return c.genesisTime, c.secondsPerSlot, nil
+	}
+	var genesis apiGenesisResponse
+	if err := c.get(ctx, genesisMethod, nil, &genesis); err != nil {
+		return 0, 0, err
+	}
+	var spec apiSpecResponse
+	if err := c.get(ctx, specMethod, nil, &spec); err != nil {
+		return 0, 0, err
+	}
+	genesisTime, err = strconv.ParseUint(genesis.Data.GenesisTime, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid genesis time: %w", err)
+	}
+	secondsPerSlot, err = strconv.ParseUint(spec.Data.SecondsPerSlot, 10, 64)
+	if err != nil || secondsPerSlot == 0 {
+		return 0, 0, fmt.Errorf("invalid seconds per slot %q", spec.Data.SecondsPerSlot)
+	}
+	c.genesisTime, c.secondsPerSlot = genesisTime, secondsPerSlot
+	return genesisTime, secondsPerSlot, nil
+}
+
+// BlobSidecars fetches the blob sidecars with the given indices of the beacon block of the L1 block with the given timestamp,
+// in the order of the indices.
+func (c *Client) BlobSidecars(ctx context.Context, l1Time uint64, indices []uint64) ([]*derive.BlobSidecar, error) {
+	genesisTime, secondsPerSlot, err := c.slotParams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch beacon chain parameters: %w", err)
+	}
+	if l1Time < genesisTime {
+		return nil, fmt.Errorf("L1 time %d is before the beacon chain genesis at %d", l1Time, genesisTime)
+	}
+	slot := (l1Time - genesisTime) / secondsPerSlot
+
+	query := url.Values{}
+	for _, i := range indices {
+		query.Add("indices", strconv.FormatUint(i, 10))
+	}
+	var resp apiBlobSidecarsResponse
+	if err := c.get(ctx, sidecarsMethodBase+strconv.FormatUint(slot, 10), query, &resp); err != nil {
+		return nil, err
+	}
+	byIndex := make(map[uint64]*apiBlobSidecar, len(resp.Data))
+	for _, sc := range resp.Data {
+		index, err := strconv.ParseUint(sc.Index, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob sidecar index %q: %w", sc.Index, err)
+		}
+		byIndex[index] = sc
+	}
+	out := make([]*derive.BlobSidecar, len(indices))
+	for i, index := range indices {
+		sc, ok := byIndex[index]
+		if !ok {
+			return nil, fmt.Errorf("missing blob sidecar %d of slot %d", index, slot)
+		}
+		out[i] = &derive.BlobSidecar{Index: index, Blob: &sc.Blob, KZGCommitment: sc.KZGCommitment, KZGProof: sc.KZGProof}
+	}
+	return out, nil
+}
+
+// executionBlockHash returns the hash of the execution block of the beacon block with the given id,
+// a slot number or a named block like "head". It returns ethereum.NotFound if there is no such beacon block.
+func (c *Client) executionBlockHash(ctx context.Context, blockID string) (common.Hash, error) {
+	var resp apiBlindedBlockResponse
+	if err := c.get(ctx, blindedBlockBase+blockID, nil, &resp); err != nil {
+		return common.Hash{}, err
+	}
+	hash := resp.Data.Message.Body.ExecutionPayloadHeader.BlockHash
+	if hash == (common.Hash{}) {
+		return common.Hash{}, fmt.Errorf("beacon block %s has no execution payload", blockID)
+	}
+	return hash, nil
+}
+
+// HeadHash returns the hash of the L1 block of the head of the beacon chain.
+func (c *Client) HeadHash(ctx context.Context) (common.Hash, error) {
+	return c.executionBlockHash(ctx, "head")
+}
+
+// CanonicalHashAt returns the hash of the canonical L1 block with the given timestamp,
+// or ethereum.NotFound if the slot of the timestamp has no block.
+func (c *Client) CanonicalHashAt(ctx context.Context, l1Time uint64) (common.Hash, error) {
+	genesisTime, secondsPerSlot, err := c.slotParams(ctx)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to fetch beacon chain parameters: %w", err)
+	}
+	if l1Time < genesisTime || (l1Time-genesisTime)%secondsPerSlot != 0 {
+		return common.Hash{}, fmt.Errorf("L1 time %d is not the time of a slot of the beacon chain: %w", l1Time, ethereum.NotFound)
+	}
+	return c.executionBlockHash(ctx, strconv.FormatUint((l1Time-genesisTime)/secondsPerSlot, 10))
+}
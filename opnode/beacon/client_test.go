@@ -0,0 +1,99 @@
+package beacon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobSidecars(t *testing.T) {
+	var blob derive.Blob
+	require.NoError(t, blob.FromData([]byte("batch data")))
+	commitment := derive.KZGCommitment{1, 2, 3}
+
+	var sidecarsQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case "/eth/v1/beacon/genesis":
+			resp = map[string]interface{}{"data": map[string]string{"genesis_time": "1000"}}
+		case "/eth/v1/config/spec":
+			resp = map[string]interface{}{"data": map[string]string{"SECONDS_PER_SLOT": "12"}}
+		case "/eth/v1/beacon/blob_sidecars/5":
+			sidecarsQuery = r.URL.RawQuery
+			resp = map[string]interface{}{"data": []map[string]string{
+				{"index": "3", "blob": hexutil.Encode(blob[:]), "kzg_commitment": hexutil.Encode(commitment[:]), "kzg_proof": hexutil.Encode(make([]byte, 48))},
+			}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer srv.Close()
+
+	cl := NewClient(srv.URL+"/", nil)
+	sidecars, err := cl.BlobSidecars(context.Background(), 1000+5*12, []uint64{3})
+	require.NoError(t, err)
+	require.Equal(t, "indices=3", sidecarsQuery)
+	require.Len(t, sidecars, 1)
+	require.Equal(t, uint64(3), sidecars[0].Index)
+	require.Equal(t, commitment, sidecars[0].KZGCommitment)
+	data, err := sidecars[0].Blob.ToData()
+	require.NoError(t, err)
+	require.Equal(t, []byte("batch data"), data)
+
+	_, err = cl.BlobSidecars(context.Background(), 1000+5*12, []uint64{3, 4})
+	require.Error(t, err, "missing sidecar")
+	_, err = cl.BlobSidecars(context.Background(), 1000+6*12, []uint64{0})
+	require.Error(t, err, "unknown slot")
+}
+
+func TestCanonicalHashes(t *testing.T) {
+	blockResponse := func(hash common.Hash) interface{} {
+		return map[string]interface{}{"data": map[string]interface{}{"message": map[string]interface{}{"body": map[string]interface{}{
+			"execution_payload_header": map[string]string{"block_hash": hash.Hex()},
+		}}}}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case "/eth/v1/beacon/genesis":
+			resp = map[string]interface{}{"data": map[string]string{"genesis_time": "1000"}}
+		case "/eth/v1/config/spec":
+			resp = map[string]interface{}{"data": map[string]string{"SECONDS_PER_SLOT": "12"}}
+		case "/eth/v1/beacon/blinded_blocks/head":
+			resp = blockResponse(common.Hash{0xaa})
+		case "/eth/v1/beacon/blinded_blocks/5":
+			resp = blockResponse(common.Hash{5})
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer srv.Close()
+
+	cl := NewClient(srv.URL, nil)
+	ctx := context.Background()
+	head, err := cl.HeadHash(ctx)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{0xaa}, head)
+
+	hash, err := cl.CanonicalHashAt(ctx, 1000+5*12)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{5}, hash)
+
+	_, err = cl.CanonicalHashAt(ctx, 1000+6*12)
+	require.ErrorIs(t, err, ethereum.NotFound, "missed slot")
+	_, err = cl.CanonicalHashAt(ctx, 1000+5*12+1)
+	require.ErrorIs(t, err, ethereum.NotFound, "not the time of a slot")
+}
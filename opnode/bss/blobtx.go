@@ -0,0 +1,169 @@
+package bss
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// BlobTxType is the EIP-2718 type of EIP-4844 blob transactions.
+	BlobTxType = 0x03
+	// MaxBlobsPerTx is the maximum number of blobs of a blob transaction, the blob limit of an L1 block.
+	MaxBlobsPerTx = 6
+	// blobGasPerBlob is the blob gas used by each blob of a transaction.
+	blobGasPerBlob = 1 << 17
+)
+
+// Tx is a transaction sent by the TxManager: a *types.Transaction, or a *BlobTx.
+type Tx interface {
+	Hash() common.Hash
+	Nonce() uint64
+	To() *common.Address
+	Gas() uint64
+	GasTipCap() *big.Int
+	GasFeeCap() *big.Int
+	Data() []byte
+}
+
+// blobSidecar is the blobs of a blob transaction, with their commitments and proofs.
+// Replacements of a blob transaction carry the same blobs, and share the sidecar.
+type blobSidecar struct {
+	blobs       []derive.Blob
+	commitments []derive.KZGCommitment
+	proofs      []derive.KZGProof
+	hashes      []common.Hash
+	// dataSize is the size of the batch data encoded in the blobs
+	dataSize int
+}
+
+// newBlobSidecar encodes each of the data items into a blob, and commits to the blobs.
+func newBlobSidecar(data [][]byte) (*blobSidecar, error) {
+	if len(data) == 0 || len(data) > MaxBlobsPerTx {
+		return nil, fmt.Errorf("blob transaction must carry 1 to %d blobs, not %d", MaxBlobsPerTx, len(data))
+	}
+	kzg, err := derive.LoadKZG()
+	if err != nil {
+		return nil, err
+	}
+	sc := &blobSidecar{blobs: make([]derive.Blob, len(data))}
+	for i, d := range data {
+		if err := sc.blobs[i].FromData(d); err != nil {
+			return nil, err
+		}
+		commitment, proof, err := kzg.Commit(&sc.blobs[i])
+		if err != nil {
+			return nil, err
+		}
+		sc.commitments = append(sc.commitments, commitment)
+		sc.proofs = append(sc.proofs, proof)
+		sc.hashes = append(sc.hashes, commitment.VersionedHash())
+		sc.dataSize += len(d)
+	}
+	return sc, nil
+}
+
+// BlobTx is an EIP-4844 blob transaction, without calldata, that carries the batch data in its blobs.
+// The bindings of the L1 client do not support blob transactions, so they are encoded here,
+// and sent in their network encoding with eth_sendRawTransaction.
+type BlobTx struct {
+	chainID    *big.Int
+	nonce      uint64
+	to         common.Address
+	gas        uint64
+	tipCap     *big.Int
+	feeCap     *big.Int
+	blobFeeCap *big.Int
+	sidecar    *blobSidecar
+
+	// the signature, hash and network encoding are set by withSignature
+	v, r, s *big.Int
+	hash    common.Hash
+	raw     []byte
+}
+
+func (tx *BlobTx) Hash() common.Hash       { return tx.hash }
+func (tx *BlobTx) Nonce() uint64           { return tx.nonce }
+func (tx *BlobTx) To() *common.Address     { return &tx.to }
+func (tx *BlobTx) Gas() uint64             { return tx.gas }
+func (tx *BlobTx) GasTipCap() *big.Int     { return tx.tipCap }
+func (tx *BlobTx) GasFeeCap() *big.Int     { return tx.feeCap }
+func (tx *BlobTx) BlobGasFeeCap() *big.Int { return tx.blobFeeCap }
+
+// Data returns nil: the data of a blob transaction is in its blobs.
+func (tx *BlobTx) Data() []byte { return nil }
+
+// BlobHashes returns the versioned hashes of the commitments to the blobs.
+func (tx *BlobTx) BlobHashes() []common.Hash { return tx.sidecar.hashes }
+
+// BlobGas returns the blob gas used by the blobs of the transaction.
+func (tx *BlobTx) BlobGas() uint64 { return uint64(len(tx.sidecar.blobs)) * blobGasPerBlob }
+
+// DataSize returns the size of the batch data encoded in the blobs.
+func (tx *BlobTx) DataSize() int { return tx.sidecar.dataSize }
+
+// MarshalBinary returns the network encoding of the signed transaction, with its blobs, commitments and proofs.
+func (tx *BlobTx) MarshalBinary() ([]byte, error) {
+	if tx.raw == nil {
+		return nil, errors.New("blob transaction is not signed")
+	}
+	return tx.raw, nil
+}
+
+func (tx *BlobTx) fields() []interface{} {
+	return []interface{}{
+		tx.chainID,
+		tx.nonce,
+		tx.tipCap,
+		tx.feeCap,
+		tx.gas,
+		tx.to,
+		new(big.Int),    // value
+		[]byte{},        // data
+		[]interface{}{}, // access list
+		tx.blobFeeCap,
+		tx.sidecar.hashes,
+	}
+}
+
+// sigHash returns the hash that the sender signs: the hash of the type and the fields of the transaction.
+func (tx *BlobTx) sigHash() (common.Hash, error) {
+	enc, err := rlp.EncodeToBytes(tx.fields())
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to encode blob transaction: %w", err)
+	}
+	return crypto.Keccak256Hash([]byte{BlobTxType}, enc), nil
+}
+
+// withSignature returns a copy of the transaction with the [R || S || V] signature of its sigHash.
+// The copy has the hash and the network encoding of the signed transaction.
+func (tx *BlobTx) withSignature(sig []byte) (*BlobTx, error) {
+	if len(sig) != crypto.SignatureLength || sig[64] > 1 {
+		return nil, errors.New("invalid blob transaction signature")
+	}
+	cpy := *tx
+	cpy.r = new(big.Int).SetBytes(sig[:32])
+	cpy.s = new(big.Int).SetBytes(sig[32:64])
+	cpy.v = big.NewInt(int64(sig[64]))
+	payload, err := rlp.EncodeToBytes(append(cpy.fields(), cpy.v, cpy.r, cpy.s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode blob transaction: %w", err)
+	}
+	cpy.hash = crypto.Keccak256Hash([]byte{BlobTxType}, payload)
+	wrapper, err := rlp.EncodeToBytes([]interface{}{
+		rlp.RawValue(payload),
+		tx.sidecar.blobs,
+		tx.sidecar.commitments,
+		tx.sidecar.proofs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode blob transaction: %w", err)
+	}
+	cpy.raw = append([]byte{BlobTxType}, wrapper...)
+	return &cpy, nil
+}
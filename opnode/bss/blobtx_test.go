@@ -0,0 +1,149 @@
+package bss
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeBlobTx decodes the network encoding of a blob transaction, as the L1 node would.
+func decodeBlobTx(raw []byte) (*BlobTx, error) {
+	if len(raw) == 0 || raw[0] != BlobTxType {
+		return nil, errors.New("not a blob transaction")
+	}
+	var wrapper struct {
+		Payload     rlp.RawValue
+		Blobs       []derive.Blob
+		Commitments []derive.KZGCommitment
+		Proofs      []derive.KZGProof
+	}
+	if err := rlp.DecodeBytes(raw[1:], &wrapper); err != nil {
+		return nil, err
+	}
+	var payload struct {
+		ChainID    *big.Int
+		Nonce      uint64
+		GasTipCap  *big.Int
+		GasFeeCap  *big.Int
+		Gas        uint64
+		To         common.Address
+		Value      *big.Int
+		Data       []byte
+		AccessList rlp.RawValue
+		BlobFeeCap *big.Int
+		BlobHashes []common.Hash
+		V, R, S    *big.Int
+	}
+	if err := rlp.DecodeBytes(wrapper.Payload, &payload); err != nil {
+		return nil, err
+	}
+	return &BlobTx{
+		chainID:    payload.ChainID,
+		nonce:      payload.Nonce,
+		to:         payload.To,
+		gas:        payload.Gas,
+		tipCap:     payload.GasTipCap,
+		feeCap:     payload.GasFeeCap,
+		blobFeeCap: payload.BlobFeeCap,
+		sidecar: &blobSidecar{
+			blobs:       wrapper.Blobs,
+			commitments: wrapper.Commitments,
+			proofs:      wrapper.Proofs,
+			hashes:      payload.BlobHashes,
+		},
+		v:    payload.V,
+		r:    payload.R,
+		s:    payload.S,
+		hash: crypto.Keccak256Hash([]byte{BlobTxType}, wrapper.Payload),
+		raw:  raw,
+	}, nil
+}
+
+func TestBlobTxEncoding(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := NewLocalSigner(key)
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{10}, blobBaseFee: 3, nonce: 4}
+	m := NewTxManager(TxManagerConfig{}, l1, big.NewInt(900), signer, testlog.Logger(t, log.LvlError))
+
+	data := [][]byte{[]byte("frame a"), []byte("frame b")}
+	p, err := m.SendBlobs(context.Background(), common.Address{0xff}, data)
+	require.NoError(t, err)
+	require.Len(t, l1.sent, 1)
+	sent, ok := l1.sent[0].(*BlobTx)
+	require.True(t, ok, "sent as a raw blob transaction")
+	require.Equal(t, p.Tx().Hash(), sent.Hash(), "the hash is the hash of the network payload")
+	require.Equal(t, uint64(4), sent.Nonce())
+	require.Equal(t, common.Address{0xff}, *sent.To())
+	require.Equal(t, uint64(21000), sent.Gas())
+	require.Equal(t, big.NewInt(6), sent.BlobGasFeeCap(), "blob basefee times the basefee multiplier")
+	require.Equal(t, 2*blobGasPerBlob, int(sent.BlobGas()))
+
+	// the signature recovers to the sender
+	hash, err := sent.sigHash()
+	require.NoError(t, err)
+	sig := make([]byte, 65)
+	sent.r.FillBytes(sig[:32])
+	sent.s.FillBytes(sig[32:64])
+	sig[64] = byte(sent.v.Uint64())
+	pub, err := crypto.SigToPub(hash[:], sig)
+	require.NoError(t, err)
+	require.Equal(t, signer.Address(), crypto.PubkeyToAddress(*pub))
+
+	// the blobs hold the data, and verify against the versioned hashes
+	kzg, err := derive.LoadKZG()
+	require.NoError(t, err)
+	for i := range data {
+		out, err := sent.sidecar.blobs[i].ToData()
+		require.NoError(t, err)
+		require.Equal(t, data[i], out)
+		require.Equal(t, sent.sidecar.commitments[i].VersionedHash(), sent.BlobHashes()[i])
+		require.NoError(t, kzg.VerifyBlobProof(&sent.sidecar.blobs[i], sent.sidecar.commitments[i], sent.sidecar.proofs[i]))
+	}
+}
+
+func TestBlobTxReplacement(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(100), baseFees: []int64{450}, blobBaseFee: 10}
+	l1.setMinTip(150) // a single replacement, which doubles the fees, is enough
+	m := newTestTxManager(t, TxManagerConfig{
+		ResubmissionTimeout:  5 * time.Millisecond,
+		ReceiptQueryInterval: time.Millisecond,
+	}, l1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.SendBlobs(ctx, common.Address{1}, [][]byte{{1}})
+	require.NoError(t, err)
+	receipt, err := tx.Wait(ctx)
+	require.NoError(t, err)
+	require.Len(t, l1.sent, 2)
+	require.Equal(t, l1.sent[1].Hash(), receipt.TxHash)
+	prev, next := l1.sent[0].(*BlobTx), l1.sent[1].(*BlobTx)
+	require.Equal(t, prev.BlobHashes(), next.BlobHashes(), "replacements carry the same blobs")
+	require.Equal(t, big.NewInt(201), next.GasTipCap(), "fees are doubled for blob transactions")
+	require.Equal(t, big.NewInt(2001), next.GasFeeCap())
+	require.Equal(t, big.NewInt(41), next.BlobGasFeeCap())
+
+	fee, err := tx.fee(ctx, receipt)
+	require.NoError(t, err)
+	// the gas times the basefee plus the tip, and the blob gas times the blob gas price
+	require.Equal(t, big.NewInt(21000*(450+201)+blobGasPerBlob*10), fee)
+}
+
+func TestSendBlobsRequiresHashSigner(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1}}
+	m := NewTxManager(TxManagerConfig{}, l1, big.NewInt(900), &RemoteSigner{}, testlog.Logger(t, log.LvlError))
+	_, err := m.SendBlobs(context.Background(), common.Address{1}, [][]byte{{1}})
+	require.Error(t, err)
+	require.Empty(t, l1.sent)
+}
@@ -0,0 +1,113 @@
+package bss
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+)
+
+const (
+	defaultFeeHistoryBlocks  = 10
+	defaultBaseFeeMultiplier = 2
+	defaultTipMultiplier     = 1
+)
+
+// FeeEstimatorConfig configures the fees of new transactions. Zero values are replaced with defaults.
+type FeeEstimatorConfig struct {
+	// HistoryBlocks is the number of recent L1 blocks to take the highest basefee of. 10 by default.
+	HistoryBlocks uint64
+	// BaseFeeMultiplier is the multiplier of the highest recent basefee in the fee cap,
+	// to stay includable while the basefee rises. 2 by default.
+	BaseFeeMultiplier float64
+	// TipMultiplier is the multiplier of the tip suggested by the L1 node. 1 by default.
+	TipMultiplier float64
+	// MaxTip is the ceiling of the tip, in wei. There is no ceiling if nil.
+	MaxTip *big.Int
+}
+
+func (c *FeeEstimatorConfig) withDefaults() FeeEstimatorConfig {
+	out := *c
+	if out.HistoryBlocks == 0 {
+		out.HistoryBlocks = defaultFeeHistoryBlocks
+	}
+	if out.BaseFeeMultiplier == 0 {
+		out.BaseFeeMultiplier = defaultBaseFeeMultiplier
+	}
+	if out.TipMultiplier == 0 {
+		out.TipMultiplier = defaultTipMultiplier
+	}
+	return out
+}
+
+// estimateFees returns the tip and fee cap of a new transaction.
+// The fee cap is the highest basefee of the recent L1 blocks times the basefee multiplier, plus the tip.
+// Only the basefee of the including block and the tip are paid, so a high fee cap does not lead to overpayment.
+// The fee cap is limited to the MaxGasPrice of the TxManager, if any.
+func (m *TxManager) estimateFees(ctx context.Context) (tip, feeCap *big.Int, err error) {
+	cfg := &m.cfg.FeeEstimator
+	suggested, err := m.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch the gas tip cap: %w", err)
+	}
+	tip = mulFloat(suggested, cfg.TipMultiplier)
+	if cfg.MaxTip != nil && tip.Cmp(cfg.MaxTip) > 0 {
+		tip = new(big.Int).Set(cfg.MaxTip)
+	}
+	baseFee, err := m.recentBaseFee(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	feeCap = new(big.Int).Add(mulFloat(baseFee, cfg.BaseFeeMultiplier), tip)
+	if max := m.cfg.MaxGasPrice; max != nil && feeCap.Cmp(max) > 0 {
+		feeCap = new(big.Int).Set(max)
+		if tip.Cmp(feeCap) > 0 {
+			tip = new(big.Int).Set(feeCap)
+		}
+	}
+	return tip, feeCap, nil
+}
+
+// estimateBlobFeeCap returns the blob fee cap of a new blob transaction:
+// the blob basefee of the next L1 block times the basefee multiplier, at least 1 wei.
+func (m *TxManager) estimateBlobFeeCap(ctx context.Context) (*big.Int, error) {
+	blobBaseFee, err := m.client.BlobBaseFee(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the blob basefee: %w", err)
+	}
+	feeCap := mulFloat(blobBaseFee, m.cfg.FeeEstimator.BaseFeeMultiplier)
+	if feeCap.Sign() == 0 {
+		feeCap.SetInt64(1)
+	}
+	return feeCap, nil
+}
+
+// recentBaseFee returns the highest basefee of the last HistoryBlocks L1 blocks.
+func (m *TxManager) recentBaseFee(ctx context.Context) (*big.Int, error) {
+	head, err := m.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the L1 head: %w", err)
+	}
+	out := new(big.Int)
+	header := head
+	for i := uint64(0); ; i++ {
+		if header.BaseFee == nil {
+			return nil, fmt.Errorf("L1 block %d has no basefee", header.Number)
+		}
+		if header.BaseFee.Cmp(out) > 0 {
+			out.Set(header.BaseFee)
+		}
+		if i+1 >= m.cfg.FeeEstimator.HistoryBlocks || header.Number.Sign() == 0 {
+			return out, nil
+		}
+		header, err = m.client.HeaderByNumber(ctx, new(big.Int).Sub(header.Number, big.NewInt(1)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch L1 block %d: %w", head.Number.Uint64()-i-1, err)
+		}
+	}
+}
+
+// mulFloat returns v times f, rounded down.
+func mulFloat(v *big.Int, f float64) *big.Int {
+	out, _ := new(big.Float).Mul(new(big.Float).SetInt(v), big.NewFloat(f)).Int(nil)
+	return out
+}
@@ -0,0 +1,44 @@
+package bss
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateFees(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(10), baseFees: []int64{900, 100, 300, 200, 100}}
+	ctx := context.Background()
+
+	m := newTestTxManager(t, TxManagerConfig{FeeEstimator: FeeEstimatorConfig{HistoryBlocks: 3}}, l1)
+	tip, feeCap, err := m.estimateFees(ctx)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(10), tip)
+	require.Equal(t, big.NewInt(2*300+10), feeCap, "highest basefee of the history")
+
+	m = newTestTxManager(t, TxManagerConfig{FeeEstimator: FeeEstimatorConfig{HistoryBlocks: 100}}, l1)
+	_, feeCap, err = m.estimateFees(ctx)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(2*900+10), feeCap, "history is limited to the genesis block")
+
+	m = newTestTxManager(t, TxManagerConfig{FeeEstimator: FeeEstimatorConfig{
+		HistoryBlocks:     1,
+		BaseFeeMultiplier: 1.5,
+		TipMultiplier:     2.5,
+	}}, l1)
+	tip, feeCap, err = m.estimateFees(ctx)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(25), tip)
+	require.Equal(t, big.NewInt(150+25), feeCap)
+
+	m = newTestTxManager(t, TxManagerConfig{
+		MaxGasPrice:  big.NewInt(500),
+		FeeEstimator: FeeEstimatorConfig{MaxTip: big.NewInt(5)},
+	}, l1)
+	tip, feeCap, err = m.estimateFees(ctx)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(5), tip, "limited to the max tip")
+	require.Equal(t, big.NewInt(500), feeCap, "limited to the max gas price")
+}
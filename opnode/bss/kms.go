@@ -0,0 +1,121 @@
+package bss
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	secp256k1N     = crypto.S256().Params().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+)
+
+// KMSClient is the signing API of a key management service or HSM that holds a secp256k1 key,
+// e.g. AWS KMS (GetPublicKey, and Sign of a digest with ECDSA_SHA_256) or GCP Cloud KMS
+// (GetPublicKey with the PEM decoded, and AsymmetricSign of a digest).
+// The key never leaves the service, only digests are signed. AWSKMSClient implements it for AWS KMS,
+// which is the only supported service: there is no GCP Cloud KMS client.
+type KMSClient interface {
+	// PublicKey returns the DER-encoded SubjectPublicKeyInfo of the key.
+	PublicKey(ctx context.Context) ([]byte, error)
+	// SignDigest signs the 32-byte digest, and returns the DER-encoded ECDSA signature.
+	SignDigest(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// KMSSigner signs transactions with a key held by a key management service.
+type KMSSigner struct {
+	client KMSClient
+	pubKey []byte // uncompressed public key
+	from   common.Address
+}
+
+// NewKMSSigner fetches the public key of the KMS key, to derive the account and recover signatures.
+func NewKMSSigner(ctx context.Context, client KMSClient) (*KMSSigner, error) {
+	der, err := client.PublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the public key of the KMS key: %w", err)
+	}
+	pub, err := parseKMSPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	return &KMSSigner{client: client, pubKey: crypto.FromECDSAPub(pub), from: crypto.PubkeyToAddress(*pub)}, nil
+}
+
+func (s *KMSSigner) Address() common.Address {
+	return s.from
+}
+
+func (s *KMSSigner) SignTx(ctx context.Context, chainID *big.Int, tx *types.Transaction) (*types.Transaction, error) {
+	signer := types.LatestSignerForChainID(chainID)
+	sig, err := s.SignHash(ctx, signer.Hash(tx))
+	if err != nil {
+		return nil, err
+	}
+	return tx.WithSignature(signer, sig)
+}
+
+func (s *KMSSigner) SignHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	der, err := s.client.SignDigest(ctx, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with the KMS key: %w", err)
+	}
+	return kmsSignature(der, hash[:], s.pubKey)
+}
+
+// parseKMSPublicKey parses a DER-encoded SubjectPublicKeyInfo of a secp256k1 key.
+// The x509 package does not support the secp256k1 curve, so the structure is decoded directly.
+func parseKMSPublicKey(der []byte) (*ecdsa.PublicKey, error) {
+	var info struct {
+		Algorithm struct {
+			Algorithm  asn1.ObjectIdentifier
+			Parameters asn1.ObjectIdentifier
+		}
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode the public key of the KMS key: %w", err)
+	}
+	pub, err := crypto.UnmarshalPubkey(info.PublicKey.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("KMS key is not a secp256k1 key: %w", err)
+	}
+	return pub, nil
+}
+
+// kmsSignature converts a DER-encoded ECDSA signature to the [R || S || V] format of Ethereum.
+// KMS signatures have no recovery id, and may have a high S value, which Ethereum rejects (EIP-2).
+// S is normalized to the lower half of the curve order, and the recovery id is found by recovering the public key.
+func kmsSignature(der []byte, digest []byte, pubKey []byte) ([]byte, error) {
+	var rs struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &rs); err != nil {
+		return nil, fmt.Errorf("failed to decode the KMS signature: %w", err)
+	}
+	if rs.R.Sign() <= 0 || rs.S.Sign() <= 0 || rs.R.Cmp(secp256k1N) >= 0 || rs.S.Cmp(secp256k1N) >= 0 {
+		return nil, errors.New("KMS signature is out of range")
+	}
+	if rs.S.Cmp(secp256k1HalfN) > 0 {
+		rs.S = new(big.Int).Sub(secp256k1N, rs.S)
+	}
+	sig := make([]byte, 65)
+	rs.R.FillBytes(sig[:32])
+	rs.S.FillBytes(sig[32:64])
+	for v := byte(0); v < 2; v++ {
+		sig[64] = v
+		if recovered, err := crypto.Ecrecover(digest, sig); err == nil && bytes.Equal(recovered, pubKey) {
+			return sig, nil
+		}
+	}
+	return nil, errors.New("KMS signature does not recover to the public key of the KMS key")
+}
@@ -0,0 +1,81 @@
+package bss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// AWSKMSConfig configures the AWS KMS key that signs the batch submission transactions.
+// The credentials are loaded with the default credential chain of the AWS SDK: the environment variables,
+// the shared config and credentials files (incl. SSO profiles), web identity tokens, and the role of the ECS task or EC2 instance.
+type AWSKMSConfig struct {
+	// KeyID is the ID, ARN or alias of the ECC_SECG_P256K1 key. There is no KMS signer if empty.
+	KeyID string
+	// Region is the AWS region of the key.
+	Region string
+	// Endpoint overrides the KMS endpoint of the region, e.g. for a VPC endpoint. Optional.
+	Endpoint string
+}
+
+func (c *AWSKMSConfig) Check() error {
+	if c.KeyID == "" {
+		return nil
+	}
+	if c.Region == "" {
+		return errors.New("the AWS region of the KMS key is required")
+	}
+	return nil
+}
+
+// AWSKMSClient is a KMSClient of an AWS KMS key.
+type AWSKMSClient struct {
+	keyID  string
+	client *kms.Client
+}
+
+// NewAWSKMSClient creates a client of the configured key, with the credentials of the default AWS credential chain.
+func NewAWSKMSClient(ctx context.Context, cfg AWSKMSConfig) (*AWSKMSClient, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the AWS config: %w", err)
+	}
+	client := kms.NewFromConfig(awsCfg, func(o *kms.Options) {
+		if cfg.Endpoint != "" {
+			o.EndpointResolver = kms.EndpointResolverFromURL(cfg.Endpoint)
+		}
+	})
+	return &AWSKMSClient{keyID: cfg.KeyID, client: client}, nil
+}
+
+func (c *AWSKMSClient) PublicKey(ctx context.Context) ([]byte, error) {
+	res, err := c.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(c.keyID)})
+	if err != nil {
+		return nil, fmt.Errorf("AWS KMS GetPublicKey failed: %w", err)
+	}
+	if res.KeySpec != types.KeySpecEccSecgP256k1 {
+		return nil, fmt.Errorf("AWS KMS key has key spec %q, not ECC_SECG_P256K1", res.KeySpec)
+	}
+	return res.PublicKey, nil
+}
+
+func (c *AWSKMSClient) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	res, err := c.client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(c.keyID),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("AWS KMS Sign failed: %w", err)
+	}
+	return res.Signature, nil
+}
@@ -0,0 +1,77 @@
+package bss
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSKMSClient(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	kms := &fakeKMS{key: key, highS: true}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type": "IncompleteSignatureException", "message": "missing signature"}`))
+			return
+		}
+		var req struct {
+			KeyID   string `json:"KeyId"`
+			Message []byte `json:"Message"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.KeyID != "alias/batcher" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type": "NotFoundException", "message": "unknown key"}`))
+			return
+		}
+		var res interface{}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			pub, err := kms.PublicKey(r.Context())
+			require.NoError(t, err)
+			res = map[string]interface{}{"PublicKey": pub, "KeySpec": "ECC_SECG_P256K1"}
+		case "TrentService.Sign":
+			sig, err := kms.SignDigest(r.Context(), req.Message)
+			require.NoError(t, err)
+			res = map[string]interface{}{"Signature": sig}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(res))
+	}))
+	defer srv.Close()
+
+	// the credentials are taken from the environment, without the shared config files of the host
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	ctx := context.Background()
+	client, err := NewAWSKMSClient(ctx, AWSKMSConfig{KeyID: "alias/batcher", Region: "us-east-1", Endpoint: srv.URL})
+	require.NoError(t, err)
+	signer, err := NewKMSSigner(ctx, client)
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), signer.Address())
+
+	chainID := big.NewInt(900)
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Gas: 21000, GasFeeCap: big.NewInt(10), To: &common.Address{2}})
+	signed, err := signer.SignTx(ctx, chainID, tx)
+	require.NoError(t, err)
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	require.NoError(t, err)
+	require.Equal(t, signer.Address(), from)
+
+	client.keyID = "alias/other"
+	_, err = signer.SignTx(ctx, chainID, tx)
+	require.ErrorContains(t, err, "NotFoundException")
+}
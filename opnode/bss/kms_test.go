@@ -0,0 +1,84 @@
+package bss
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKMS signs like a KMS: DER-encoded signatures without recovery id, optionally with a high S value.
+type fakeKMS struct {
+	key   *ecdsa.PrivateKey
+	highS bool
+}
+
+func (k *fakeKMS) PublicKey(ctx context.Context) ([]byte, error) {
+	var info struct {
+		Algorithm struct {
+			Algorithm  asn1.ObjectIdentifier
+			Parameters asn1.ObjectIdentifier
+		}
+		PublicKey asn1.BitString
+	}
+	info.Algorithm.Algorithm = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1} // id-ecPublicKey
+	info.Algorithm.Parameters = asn1.ObjectIdentifier{1, 3, 132, 0, 10}      // secp256k1
+	pub := crypto.FromECDSAPub(&k.key.PublicKey)
+	info.PublicKey = asn1.BitString{Bytes: pub, BitLength: 8 * len(pub)}
+	return asn1.Marshal(info)
+}
+
+func (k *fakeKMS) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	sig, err := crypto.Sign(digest, k.key)
+	if err != nil {
+		return nil, err
+	}
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64])
+	if k.highS {
+		s.Sub(secp256k1N, s)
+	}
+	return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+}
+
+func TestKMSSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	kms := &fakeKMS{key: key}
+	ctx := context.Background()
+	signer, err := NewKMSSigner(ctx, kms)
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), signer.Address())
+
+	chainID := big.NewInt(900)
+	for i := 0; i < 20; i++ {
+		kms.highS = i%2 == 1
+		tx := types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     uint64(i),
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(10),
+			Gas:       21000,
+			To:        &common.Address{2},
+			Data:      []byte{byte(i)},
+		})
+		signed, err := signer.SignTx(ctx, chainID, tx)
+		require.NoError(t, err)
+		from, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+		require.NoError(t, err, "high S values are normalized")
+		require.Equal(t, signer.Address(), from, "recovery id is found")
+	}
+
+	other, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	digest := crypto.Keccak256([]byte{1})
+	der, err := (&fakeKMS{key: other}).SignDigest(ctx, digest)
+	require.NoError(t, err)
+	_, err = kmsSignature(der, digest, crypto.FromECDSAPub(&key.PublicKey))
+	require.Error(t, err, "signature of another key")
+}
@@ -0,0 +1,205 @@
+package bss
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// BatchQueue persists the batch submissions that are not confirmed on L1 yet, to resubmit them after a restart.
+// A nil BatchQueue does not persist anything.
+type BatchQueue struct {
+	path string
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*queuedSubmission
+}
+
+type queuedSubmission struct {
+	// Batches are the encoded batches of the submission
+	Batches []hexutil.Bytes `json:"batches"`
+	// Txs are the hashes of the transactions that the submission was sent with, if it was sent
+	Txs []common.Hash `json:"txs,omitempty"`
+}
+
+type batchQueueFile struct {
+	NextID  uint64                       `json:"nextID"`
+	Pending map[uint64]*queuedSubmission `json:"pending"`
+}
+
+// QueuedSubmission is a submission that was not confirmed before the last restart.
+type QueuedSubmission struct {
+	ID      uint64
+	Batches []*derive.BatchData
+	// Txs are the hashes of the transactions that the submission was sent with, empty if it was not sent
+	Txs []common.Hash
+}
+
+// OpenBatchQueue opens the batch queue at the given path, with the submissions that were pending when it was last written.
+// A queue file that cannot be decoded is moved aside, and the queue starts empty.
+func OpenBatchQueue(path string, log log.Logger) (*BatchQueue, error) {
+	q := &BatchQueue{path: path, pending: make(map[uint64]*queuedSubmission)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read batch queue %q: %w", path, err)
+	}
+	var f batchQueueFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		corrupt := path + ".corrupt"
+		log.Error("Discarding corrupt batch queue, its submissions are not resubmitted", "path", path, "moved_to", corrupt, "err", err)
+		if err := os.Rename(path, corrupt); err != nil {
+			return nil, fmt.Errorf("failed to move corrupt batch queue %q aside: %w", path, err)
+		}
+		return q, nil
+	}
+	q.nextID = f.NextID
+	for id, sub := range f.Pending {
+		if sub != nil {
+			q.pending[id] = sub
+		}
+	}
+	return q, nil
+}
+
+// Add persists a submission of the given batches, and returns its ID.
+func (q *BatchQueue) Add(batches []*derive.BatchData) (uint64, error) {
+	if q == nil {
+		return 0, nil
+	}
+	var encoded []hexutil.Bytes
+	for _, batch := range batches {
+		data, err := batch.MarshalBinary()
+		if err != nil {
+			return 0, err
+		}
+		encoded = append(encoded, data)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	id := q.nextID
+	q.nextID++
+	q.pending[id] = &queuedSubmission{Batches: encoded}
+	return id, q.write()
+}
+
+// SetTxs persists the hashes of the transactions that the submission was sent with, so that the submission is not
+// sent again after a restart if the transactions are included.
+func (q *BatchQueue) SetTxs(id uint64, txs []common.Hash) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sub, ok := q.pending[id]
+	if !ok {
+		return nil
+	}
+	sub.Txs = txs
+	return q.write()
+}
+
+// Remove removes the submission once it is confirmed.
+func (q *BatchQueue) Remove(id uint64) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[id]; !ok {
+		return nil
+	}
+	delete(q.pending, id)
+	return q.write()
+}
+
+// Len returns the number of pending submissions.
+func (q *BatchQueue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Pending returns the pending submissions, in the order they were added.
+func (q *BatchQueue) Pending() ([]QueuedSubmission, error) {
+	if q == nil {
+		return nil, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var ids []uint64
+	for id := range q.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var out []QueuedSubmission
+	for _, id := range ids {
+		sub := QueuedSubmission{ID: id, Txs: q.pending[id].Txs}
+		for _, data := range q.pending[id].Batches {
+			var batch derive.BatchData
+			if err := batch.UnmarshalBinary(data); err != nil {
+				return nil, fmt.Errorf("failed to decode batch of queued submission %d: %w", id, err)
+			}
+			sub.Batches = append(sub.Batches, &batch)
+		}
+		out = append(out, sub)
+	}
+	return out, nil
+}
+
+// write replaces the queue file, so a crash leaves either the previous or the new queue.
+// The new queue is synced to disk before it replaces the previous one.
+func (q *BatchQueue) write() error {
+	data, err := json.Marshal(batchQueueFile{NextID: q.nextID, Pending: q.pending})
+	if err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := writeSynced(tmp, data); err != nil {
+		return fmt.Errorf("failed to write batch queue: %w", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("failed to write batch queue: %w", err)
+	}
+	// sync the directory, so the rename survives a crash
+	dir, err := os.Open(filepath.Dir(q.path))
+	if err != nil {
+		return fmt.Errorf("failed to sync batch queue: %w", err)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync batch queue: %w", err)
+	}
+	return nil
+}
+
+// writeSynced writes the file, and syncs it to disk.
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,138 @@
+package bss
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+var errSendFailed = errors.New("send failed")
+
+func TestBatchQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := OpenBatchQueue(path, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	a := []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{{1}}}}}
+	b := []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 4, Transactions: []hexutil.Bytes{}}}}
+	idA, err := q.Add(a)
+	require.NoError(t, err)
+	idB, err := q.Add(b)
+	require.NoError(t, err)
+	require.NoError(t, q.Remove(idA))
+
+	q, err = OpenBatchQueue(path, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.NoError(t, q.SetTxs(idB, []common.Hash{{1}}))
+	pending, err := q.Pending()
+	require.NoError(t, err)
+	require.Equal(t, []QueuedSubmission{{ID: idB, Batches: b, Txs: []common.Hash{{1}}}}, pending)
+	idC, err := q.Add(a)
+	require.NoError(t, err)
+	require.Greater(t, idC, idB, "IDs are not reused after a restart")
+
+	var nilQueue *BatchQueue
+	_, err = nilQueue.Add(a)
+	require.NoError(t, err)
+	pending, err = nilQueue.Pending()
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestBatchQueueCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"nextID": 3, "pend`), 0o600))
+	q, err := OpenBatchQueue(path, testlog.Logger(t, log.LvlCrit))
+	require.NoError(t, err)
+	require.Zero(t, q.Len())
+	require.FileExists(t, path+".corrupt", "the corrupt queue is kept aside")
+	_, err = q.Add([]*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{}}}})
+	require.NoError(t, err)
+	q, err = OpenBatchQueue(path, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Equal(t, 1, q.Len())
+}
+
+func TestSubmitterQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := OpenBatchQueue(path, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1}}
+	b := &BatchSubmitter{
+		TxMgr:             newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1),
+		ConfirmationDepth: 10,
+		Queue:             q,
+	}
+	cfg := &rollup.Config{}
+	batches := []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{}}}}
+
+	// A submission that fails stays queued
+	l1.failing = errSendFailed
+	_, err = b.Submit(cfg, batches)
+	require.ErrorIs(t, err, errSendFailed)
+	l1.failing = nil
+	_, err = b.Submit(cfg, batches)
+	require.NoError(t, err)
+
+	// After a restart, the queued submissions are resubmitted
+	q, err = OpenBatchQueue(path, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	pending, err := q.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Empty(t, pending[0].Txs, "the failed submission was not sent")
+	require.Equal(t, []common.Hash{l1.sent[0].Hash()}, pending[1].Txs)
+	b.Queue = q
+	b.included = nil
+
+	// A dry run does not send the queued submissions
+	b.DryRun = true
+	require.NoError(t, b.ResubmitQueued(cfg))
+	require.Len(t, l1.sent, 1)
+	require.Equal(t, 2, q.Len())
+	b.DryRun = false
+
+	require.NoError(t, b.ResubmitQueued(cfg))
+	require.Len(t, l1.sent, 3)
+
+	// Confirmed submissions are removed from the queue
+	b.L1HeadChanged(eth.L1BlockRef{Number: 10}, false)
+	require.Zero(t, q.Len())
+}
+
+func TestSubmitterQueueConfirmed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := OpenBatchQueue(path, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1}}
+	b := &BatchSubmitter{
+		TxMgr:             newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1),
+		ConfirmationDepth: 10,
+		Queue:             q,
+	}
+	cfg := &rollup.Config{}
+	_, err = b.Submit(cfg, []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{}}}})
+	require.NoError(t, err)
+
+	// the transaction is confirmed while the submitter is down
+	l1.receiptNumber = big.NewInt(0)
+	l1.baseFees = make([]int64, 11)
+	q, err = OpenBatchQueue(path, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	b.Queue = q
+	b.included = nil
+	require.NoError(t, b.ResubmitQueued(cfg))
+	require.Len(t, l1.sent, 1, "confirmed submissions are not sent again")
+	require.Zero(t, q.Len())
+}
@@ -0,0 +1,186 @@
+package bss
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrSignerRefused is returned when the remote signer refuses to sign a transaction.
+var ErrSignerRefused = errors.New("remote signer refused to sign")
+
+// Signer signs the batch submission transactions.
+type Signer interface {
+	// Address returns the account that the transactions are signed for.
+	Address() common.Address
+	// SignTx returns the given unsigned transaction, signed for the given chain.
+	SignTx(ctx context.Context, chainID *big.Int, tx *types.Transaction) (*types.Transaction, error)
+}
+
+// HashSigner is a Signer that can sign arbitrary hashes, which is needed to sign the blob transactions
+// that the L1 bindings do not support. The remote signer APIs only sign known transaction types.
+type HashSigner interface {
+	Signer
+	// SignHash returns the [R || S || V] signature of the hash, with V the recovery id 0 or 1.
+	SignHash(ctx context.Context, hash common.Hash) ([]byte, error)
+}
+
+// LocalSigner signs transactions with a private key in memory.
+type LocalSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func NewLocalSigner(key *ecdsa.PrivateKey) *LocalSigner {
+	return &LocalSigner{key: key}
+}
+
+func (s *LocalSigner) Address() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+func (s *LocalSigner) SignTx(ctx context.Context, chainID *big.Int, tx *types.Transaction) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+func (s *LocalSigner) SignHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	return crypto.Sign(hash[:], s.key)
+}
+
+const (
+	// RemoteSignerEth is the namespace of the signer API of web3signer: eth_signTransaction and eth_accounts.
+	RemoteSignerEth = "eth"
+	// RemoteSignerClef is the namespace of the signer API of clef: account_signTransaction and account_list.
+	RemoteSignerClef = "account"
+)
+
+// RemoteSignerConfig configures the remote signer of the batch submission transactions.
+type RemoteSignerConfig struct {
+	// Addr is the address of the JSON-RPC endpoint of the signer. There is no remote signer if empty.
+	Addr string
+	// Account is the account to sign the transactions for.
+	Account common.Address
+	// Namespace is the namespace of the signer API, RemoteSignerEth (the default) or RemoteSignerClef.
+	Namespace string
+}
+
+// RemoteSigner signs transactions with an external signer over JSON-RPC, so the key is not held by the node.
+type RemoteSigner struct {
+	client    *rpc.Client
+	account   common.Address
+	namespace string
+}
+
+// NewRemoteSigner connects to the remote signer, and checks that it signs for the configured account.
+func NewRemoteSigner(ctx context.Context, cfg RemoteSignerConfig) (*RemoteSigner, error) {
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = RemoteSignerEth
+	}
+	if namespace != RemoteSignerEth && namespace != RemoteSignerClef {
+		return nil, fmt.Errorf("unknown remote signer namespace %q", namespace)
+	}
+	client, err := rpc.DialContext(ctx, cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial remote signer %s: %w", cfg.Addr, err)
+	}
+	s := &RemoteSigner{client: client, account: cfg.Account, namespace: namespace}
+	if err := s.CheckHealth(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *RemoteSigner) Address() common.Address {
+	return s.account
+}
+
+// CheckHealth checks that the signer is reachable, and that it manages the account.
+func (s *RemoteSigner) CheckHealth(ctx context.Context) error {
+	method := "eth_accounts"
+	if s.namespace == RemoteSignerClef {
+		method = "account_list"
+	}
+	var accounts []common.Address
+	if err := s.client.CallContext(ctx, &accounts, method); err != nil {
+		return fmt.Errorf("remote signer is unhealthy: %w", err)
+	}
+	for _, a := range accounts {
+		if a == s.account {
+			return nil
+		}
+	}
+	return fmt.Errorf("remote signer does not manage account %s", s.account)
+}
+
+type signTxArgs struct {
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to"`
+	Gas                  hexutil.Uint64  `json:"gas"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big    `json:"value"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	Data                 hexutil.Bytes   `json:"data"`
+	ChainID              *hexutil.Big    `json:"chainId"`
+}
+
+// SignTx signs the transaction with the remote signer. The signed transaction is checked to be the
+// given transaction, signed by the account. A refusal of the signer is returned as ErrSignerRefused.
+func (s *RemoteSigner) SignTx(ctx context.Context, chainID *big.Int, tx *types.Transaction) (*types.Transaction, error) {
+	args := signTxArgs{
+		From:                 s.account,
+		To:                   tx.To(),
+		Gas:                  hexutil.Uint64(tx.Gas()),
+		MaxFeePerGas:         (*hexutil.Big)(tx.GasFeeCap()),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tx.GasTipCap()),
+		Value:                (*hexutil.Big)(tx.Value()),
+		Nonce:                hexutil.Uint64(tx.Nonce()),
+		Data:                 tx.Data(),
+		ChainID:              (*hexutil.Big)(chainID),
+	}
+	var result json.RawMessage
+	if err := s.client.CallContext(ctx, &result, s.namespace+"_signTransaction", args); err != nil {
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) {
+			return nil, fmt.Errorf("%w: %v", ErrSignerRefused, err)
+		}
+		return nil, fmt.Errorf("failed to reach remote signer: %w", err)
+	}
+	// web3signer returns the raw signed transaction, clef returns an object with the raw signed transaction.
+	var raw hexutil.Bytes
+	if err := json.Unmarshal(result, &raw); err != nil {
+		var res struct {
+			Raw hexutil.Bytes `json:"raw"`
+		}
+		if err := json.Unmarshal(result, &res); err != nil {
+			return nil, fmt.Errorf("failed to decode signed transaction of remote signer: %w", err)
+		}
+		raw = res.Raw
+	}
+	var signed types.Transaction
+	if err := signed.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("failed to decode signed transaction of remote signer: %w", err)
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	if signer.Hash(&signed) != signer.Hash(tx) {
+		return nil, fmt.Errorf("remote signer signed a different transaction %s", signed.Hash())
+	}
+	if from, err := types.Sender(signer, &signed); err != nil || from != s.account {
+		return nil, fmt.Errorf("remote signer signed transaction %s for a different account", signed.Hash())
+	}
+	return &signed, nil
+}
+
+func (s *RemoteSigner) Close() {
+	s.client.Close()
+}
@@ -0,0 +1,99 @@
+package bss
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSignerAPI is the eth namespace of a web3signer-style remote signer.
+type fakeSignerAPI struct {
+	key    *ecdsa.PrivateKey
+	refuse bool
+	// tamper changes the transaction before signing it
+	tamper bool
+}
+
+func (api *fakeSignerAPI) Accounts() []common.Address {
+	return []common.Address{crypto.PubkeyToAddress(api.key.PublicKey)}
+}
+
+func (api *fakeSignerAPI) SignTransaction(args signTxArgs) (hexutil.Bytes, error) {
+	if api.refuse {
+		return nil, errors.New("request denied")
+	}
+	nonce := uint64(args.Nonce)
+	if api.tamper {
+		nonce++
+	}
+	tx, err := types.SignNewTx(api.key, types.LatestSignerForChainID(args.ChainID.ToInt()), &types.DynamicFeeTx{
+		ChainID:   args.ChainID.ToInt(),
+		Nonce:     nonce,
+		GasTipCap: args.MaxPriorityFeePerGas.ToInt(),
+		GasFeeCap: args.MaxFeePerGas.ToInt(),
+		Gas:       uint64(args.Gas),
+		To:        args.To,
+		Value:     args.Value.ToInt(),
+		Data:      args.Data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx.MarshalBinary()
+}
+
+func TestRemoteSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	api := &fakeSignerAPI{key: key}
+	srv := rpc.NewServer()
+	require.NoError(t, srv.RegisterName("eth", api))
+	httpSrv := httptest.NewServer(srv)
+	defer httpSrv.Close()
+	ctx := context.Background()
+
+	_, err = NewRemoteSigner(ctx, RemoteSignerConfig{Addr: httpSrv.URL, Account: common.Address{1}})
+	require.Error(t, err, "the signer does not manage the account")
+
+	account := crypto.PubkeyToAddress(key.PublicKey)
+	signer, err := NewRemoteSigner(ctx, RemoteSignerConfig{Addr: httpSrv.URL, Account: account})
+	require.NoError(t, err)
+	defer signer.Close()
+
+	chainID := big.NewInt(900)
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     3,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(10),
+		Gas:       21000,
+		To:        &common.Address{2},
+		Value:     new(big.Int),
+		Data:      []byte{1, 2, 3},
+	})
+	signed, err := signer.SignTx(ctx, chainID, tx)
+	require.NoError(t, err)
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	require.NoError(t, err)
+	require.Equal(t, account, from)
+	require.Equal(t, tx.Nonce(), signed.Nonce())
+	require.Equal(t, tx.Data(), signed.Data())
+
+	api.tamper = true
+	_, err = signer.SignTx(ctx, chainID, tx)
+	require.Error(t, err, "a different transaction is signed")
+
+	api.tamper, api.refuse = false, true
+	_, err = signer.SignTx(ctx, chainID, tx)
+	require.ErrorIs(t, err, ErrSignerRefused)
+}
@@ -3,98 +3,619 @@ package bss
 import (
 	"bytes"
 	"context"
-	"crypto/ecdsa"
-	"errors"
+	"crypto/rand"
+	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
-	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/tracing"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer traces the batch submissions, see the tracing package.
+var tracer = otel.Tracer("github.com/ethereum-optimism/optimistic-specs/opnode/bss")
+
+// DefaultMaxTxDataSize is the default maximum size of the data of a batch submission transaction.
+// It stays below the 128 KB transaction size limit of the L1 transaction pool.
+const DefaultMaxTxDataSize = 120_000
+
+// DefaultConfirmationDepth is the default number of L1 blocks after which an included batch submission
+// transaction is considered safe from reorgs, and is not tracked anymore.
+const DefaultConfirmationDepth = 64
+
 type BatchSubmitter struct {
-	Client    *ethclient.Client
+	// TxMgr sends the batch submission transactions, and replaces them if they get stuck.
+	TxMgr     *TxManager
 	ToAddress common.Address
-	ChainID   *big.Int
-	PrivKey   *ecdsa.PrivateKey
+	// MaxTxDataSize is the maximum size of the data of a transaction, DefaultMaxTxDataSize if 0.
+	// Batches are split over multiple transactions to stay within the limit,
+	// a batch that does not fit in a single transaction by itself is split into the frames of a channel.
+	MaxTxDataSize int
+	// MaxTxGas is the maximum gas of a transaction, which further limits the size of the data. No limit if 0.
+	MaxTxGas uint64
+	// UseBlobs submits the batches in the blobs of blob transactions instead of in calldata,
+	// each blob holding the data of at most derive.MaxBlobDataSize bytes. MaxTxDataSize and MaxTxGas do not apply.
+	// It requires a TxMgr with a HashSigner.
+	UseBlobs bool
+	// BundleType is the type of batch bundle to encode the batches with, see derive.BundleTypeForCompression.
+	BundleType byte
+	// BatchType is the type of batches to encode the bundle with: a batch per block, or span batches.
+	BatchType byte
+	// ConfirmationDepth is the number of L1 blocks that an included transaction is tracked for,
+	// to rebroadcast it if it is reorged out. DefaultConfirmationDepth if 0.
+	// An included transaction is confirmed earlier if its L1 block is finalized.
+	ConfirmationDepth uint64
+	// Queue persists the submissions until they are confirmed, to resubmit them after a restart. Optional.
+	Queue *BatchQueue
+	// DryRun encodes the batches and logs the transactions that would be sent, without sending them.
+	DryRun bool
+	// Events receives a batch_confirmed event for each confirmed transaction. Optional.
+	Events *events.Bus
+
+	mu sync.Mutex
+	// nextSubmission is the ID of the next submission without a Queue, which otherwise assigns the IDs
+	nextSubmission uint64
+	// inflight are the sent transactions that are not included yet
+	inflight []*PendingTx
+	// included are the included transactions that are not confirmed yet
+	included []*includedTx
+	// lost are the submissions with a transaction that was reorged out and could not be included again,
+	// which stay queued until a restart
+	lost map[uint64]bool
+	// l1Head and l1Finalized are the numbers of the last signaled L1 head and finalized L1 block
+	l1Head      uint64
+	l1Finalized uint64
 }
 
-// Submit creates & submits batches to L1. Blocks until the transaction is included.
-// Return the tx hash as well as a possible error.
-func (b *BatchSubmitter) Submit(config *rollup.Config, batches []*derive.BatchData) (common.Hash, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+// includedTx is a batch submission transaction that was included in L1, and may still be reorged out.
+type includedTx struct {
+	tx *PendingTx
+	// block is the L1 block that included the transaction
+	block eth.BlockID
+	// rechecking is true while the inclusion is checked after a reorg, or the transaction is rebroadcast
+	rechecking bool
+	// submission is the ID of the submission, see BatchSubmitter.addSubmission
+	submission uint64
+}
+
+// BatchConfirmedEvent is the data of the event of a confirmed batch submission transaction.
+type BatchConfirmedEvent struct {
+	Tx      common.Hash `json:"tx"`
+	L1Block eth.BlockID `json:"l1Block"`
+	// Submission is the ID of the submission that the transaction is part of
+	Submission uint64 `json:"submission"`
+}
 
-	var buf bytes.Buffer
-	if err := derive.EncodeBatches(config, batches, &buf); err != nil {
+// Submit creates & submits batches to L1. Blocks until the transactions are included, replacing transactions
+// that get stuck, or until the inclusion timeout of the transaction manager.
+// Return the hash of the last tx as well as a possible error.
+func (b *BatchSubmitter) Submit(config *rollup.Config, batches []*derive.BatchData) (common.Hash, error) {
+	if b.DryRun {
+		return common.Hash{}, b.dryRun(config, batches)
+	}
+	id, err := b.addSubmission(batches)
+	if err != nil {
 		return common.Hash{}, err
 	}
+	return b.submit(config, id, batches)
+}
+
+// addSubmission returns the ID of a new submission of the batches: its ID in the Queue,
+// or a unique in-memory ID without a Queue, so that the submissions are told apart when they are confirmed.
+func (b *BatchSubmitter) addSubmission(batches []*derive.BatchData) (uint64, error) {
+	if b.Queue != nil {
+		return b.Queue.Add(batches)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextSubmission
+	b.nextSubmission++
+	return id, nil
+}
 
-	tip, err := b.Client.SuggestGasTipCap(ctx)
+// ResubmitQueued resubmits the submissions that were not confirmed before the last restart, in their original order.
+// The submissions whose transactions are all confirmed are removed from the queue instead.
+// Some of the batches may have been included already, the derivation ignores the duplicates.
+// In a dry run, the queued submissions are only logged, and stay queued.
+func (b *BatchSubmitter) ResubmitQueued(config *rollup.Config) error {
+	submissions, err := b.Queue.Pending()
 	if err != nil {
-		return common.Hash{}, err
+		return err
 	}
-	fee, err := b.Client.SuggestGasPrice(ctx)
+	for _, sub := range submissions {
+		if len(sub.Txs) > 0 && b.queuedConfirmed(sub.Txs) {
+			b.TxMgr.log.Info("Queued batches were confirmed before the restart", "submission", sub.ID, "txs", len(sub.Txs))
+			if err := b.Queue.Remove(sub.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		b.TxMgr.log.Info("Resubmitting queued batches", "submission", sub.ID, "count", len(sub.Batches))
+		if b.DryRun {
+			if err := b.dryRun(config, sub.Batches); err != nil {
+				return fmt.Errorf("failed to dry run queued submission %d: %w", sub.ID, err)
+			}
+			continue
+		}
+		if _, err := b.submit(config, sub.ID, sub.Batches); err != nil {
+			return fmt.Errorf("failed to resubmit queued submission %d: %w", sub.ID, err)
+		}
+	}
+	return nil
+}
+
+// queuedConfirmed returns true if all the transactions of a queued submission are included, at the confirmation depth.
+// Transactions that cannot be checked are not confirmed, and their submission is sent again.
+func (b *BatchSubmitter) queuedConfirmed(txs []common.Hash) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), b.TxMgr.cfg.NetworkTimeout)
+	defer cancel()
+	head, err := b.TxMgr.client.HeaderByNumber(ctx, nil)
 	if err != nil {
-		return common.Hash{}, err
+		b.TxMgr.log.Warn("Failed to fetch the L1 head to check the queued submissions", "err", err)
+		return false
+	}
+	depth := b.ConfirmationDepth
+	if depth == 0 {
+		depth = DefaultConfirmationDepth
 	}
+	for _, hash := range txs {
+		receipt, err := b.TxMgr.client.TransactionReceipt(ctx, hash)
+		if err != nil || receipt == nil || head.Number.Uint64() < receipt.BlockNumber.Uint64()+depth {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *BatchSubmitter) submit(config *rollup.Config, id uint64, batches []*derive.BatchData) (_ common.Hash, err error) {
+	ctx, span := tracer.Start(context.Background(), "batch_submission", trace.WithAttributes(
+		attribute.Int64("submission", int64(id)),
+		attribute.Int("batches", len(batches)),
+	))
+	defer func() { tracing.End(span, err) }()
 
-	// Note: If the BSS acts up, look into the pending nonce.
-	addr := crypto.PubkeyToAddress(b.PrivKey.PublicKey)
-	nonce, err := b.Client.PendingNonceAt(ctx, addr)
+	txData, err := b.encodeTxData(config, batches)
 	if err != nil {
 		return common.Hash{}, err
 	}
+	span.SetAttributes(attribute.Int("txs", len(txData)))
+
+	ctx, cancel := context.WithTimeout(ctx, b.TxMgr.InclusionTimeout())
+	defer cancel()
+
+	// The transactions are all sent before waiting for any of them, so they can be included in the same L1 block.
+	var txs []*PendingTx
+	defer func() { b.removeInflight(txs) }()
+	for _, data := range b.groupTxData(txData) {
+		var tx *PendingTx
+		if b.UseBlobs {
+			tx, err = b.TxMgr.SendBlobs(ctx, b.ToAddress, data)
+		} else {
+			tx, err = b.TxMgr.Send(ctx, b.ToAddress, data[0])
+		}
+		if err != nil {
+			submitterFailures("send").Inc(1)
+			return common.Hash{}, err
+		}
+		txs = append(txs, tx)
+		b.addInflight(tx)
+	}
+	b.setQueuedTxs(id, txs)
 
-	rawTx := &types.DynamicFeeTx{
-		ChainID:   b.ChainID,
-		Nonce:     nonce,
-		To:        &b.ToAddress,
-		GasTipCap: tip,
-		GasFeeCap: fee,
-		Data:      buf.Bytes(),
+	var included []*includedTx
+	for _, tx := range txs {
+		receipt, err := tx.Wait(ctx)
+		if err != nil {
+			submitterFailures("inclusion").Inc(1)
+			return common.Hash{}, err
+		}
+		metrics.GetOrRegisterTimer("bss/confirmation_latency", nil).UpdateSince(tx.firstSent)
+		if fee, err := tx.fee(ctx, receipt); err != nil {
+			b.TxMgr.log.Warn("Failed to compute the fee of a batch submission transaction", "tx", receipt.TxHash, "err", err)
+		} else {
+			metrics.GetOrRegisterCounter("bss/fees_spent_gwei", nil).Inc(fee.Div(fee, big.NewInt(params.GWei)).Int64())
+		}
+		included = append(included, &includedTx{tx: tx, block: receiptBlock(receipt), submission: id})
 	}
+	// the included transactions may be replacements of the sent ones
+	b.setQueuedTxs(id, txs)
+	metrics.GetOrRegisterCounter("bss/submitted_batches", nil).Inc(int64(len(batches)))
+	b.mu.Lock()
+	b.included = append(b.included, included...)
+	b.mu.Unlock()
+	return included[len(included)-1].tx.Tx().Hash(), nil
+}
 
-	// No contract execution so we just pay intrinsic gas.
-	// If we add contract execution, making it gas usage deterministic is very helpful.
-	gas, err := core.IntrinsicGas(rawTx.Data, nil, false, true, true)
-	if err != nil {
-		return common.Hash{}, err
+// setQueuedTxs persists the hashes of the latest transactions of the submission in the queue.
+// The submission is sent again after a restart if they cannot be persisted.
+func (b *BatchSubmitter) setQueuedTxs(id uint64, txs []*PendingTx) {
+	hashes := make([]common.Hash, 0, len(txs))
+	for _, tx := range txs {
+		hashes = append(hashes, tx.Tx().Hash())
 	}
-	rawTx.Gas = gas
+	if err := b.Queue.SetTxs(id, hashes); err != nil {
+		b.TxMgr.log.Warn("Failed to persist the transactions of a queued submission", "submission", id, "err", err)
+	}
+}
 
-	tx, err := types.SignNewTx(b.PrivKey, types.LatestSignerForChainID(b.ChainID), rawTx)
+// dryRun logs the transactions that the batches would be submitted with: their size, gas and fees.
+func (b *BatchSubmitter) dryRun(config *rollup.Config, batches []*derive.BatchData) error {
+	txData, err := b.encodeTxData(config, batches)
 	if err != nil {
-		return common.Hash{}, err
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.TxMgr.cfg.NetworkTimeout)
+	defer cancel()
+	groups := b.groupTxData(txData)
+	var size int
+	for i, data := range groups {
+		var est TxEstimate
+		if b.UseBlobs {
+			est, err = b.TxMgr.EstimateBlobs(ctx, len(data))
+		} else {
+			est, err = b.TxMgr.Estimate(ctx, data[0])
+		}
+		if err != nil {
+			return err
+		}
+		var txSize int
+		for _, d := range data {
+			txSize += len(d)
+		}
+		size += txSize
+		b.TxMgr.log.Info("Dry run: would submit batch transaction", "index", i, "count", len(groups), "blobs", b.UseBlobs,
+			"size", txSize, "gas", est.Gas, "tip", est.Tip, "fee_cap", est.FeeCap, "blob_fee_cap", est.BlobFeeCap, "max_fee", est.MaxFee)
 	}
+	b.TxMgr.log.Info("Dry run: would submit batches", "batches", len(batches), "txs", len(groups), "size", size,
+		"bundle_type", b.BundleType, "batch_type", b.BatchType)
+	return nil
+}
+
+// groupTxData groups the data items into the transactions that submit them:
+// a transaction per item, or up to MaxBlobsPerTx items in the blobs of each transaction.
+func (b *BatchSubmitter) groupTxData(txData [][]byte) [][][]byte {
+	perTx := 1
+	if b.UseBlobs {
+		perTx = MaxBlobsPerTx
+	}
+	var out [][][]byte
+	for len(txData) > perTx {
+		out = append(out, txData[:perTx])
+		txData = txData[perTx:]
+	}
+	return append(out, txData)
+}
 
-	err = b.Client.SendTransaction(ctx, tx)
+// encodeTxData encodes the batches into the data of the transactions to submit them with.
+func (b *BatchSubmitter) encodeTxData(config *rollup.Config, batches []*derive.BatchData) ([][]byte, error) {
+	maxSize := b.maxTxDataSize()
+	bundles, err := b.encodeBundles(config, batches, maxSize)
 	if err != nil {
-		return common.Hash{}, err
+		return nil, err
 	}
+	var txData [][]byte
+	for _, bundle := range bundles {
+		if len(bundle) <= maxSize {
+			txData = append(txData, bundle)
+			continue
+		}
+		var chID derive.ChannelID
+		if _, err := rand.Read(chID[:]); err != nil {
+			return nil, err
+		}
+		frames, err := derive.ChannelFrames(config, chID, bundle, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		txData = append(txData, frames...)
+	}
+	return txData, nil
+}
 
-	timeout := time.After(30 * time.Second)
+func submitterFailures(kind string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("bss/failures/"+kind, nil)
+}
 
-	for {
-		receipt, err := b.Client.TransactionReceipt(context.Background(), tx.Hash())
-		if receipt != nil {
-			return tx.Hash(), nil
-		} else if err != nil && !errors.Is(err, ethereum.NotFound) {
-			return common.Hash{}, err
+// SubmitterStatus is the state of the batch submission, to see why the safe head does not advance.
+type SubmitterStatus struct {
+	// InFlight are the transactions that are sent and not included yet
+	InFlight []InFlightTx `json:"inFlight"`
+	// PendingBytes is the size of the data of the in-flight transactions, in calldata or blobs
+	PendingBytes int `json:"pendingBytes"`
+	// Unconfirmed is the number of included transactions that do not have enough confirmations yet
+	Unconfirmed int `json:"unconfirmed"`
+	// QueueDepth is the number of persisted submissions that are not confirmed yet
+	QueueDepth int `json:"queueDepth"`
+}
+
+// InFlightTx is a batch submission transaction that is not included yet.
+type InFlightTx struct {
+	Hash      common.Hash    `json:"hash"`
+	Nonce     hexutil.Uint64 `json:"nonce"`
+	GasTipCap *hexutil.Big   `json:"gasTipCap"`
+	GasFeeCap *hexutil.Big   `json:"gasFeeCap"`
+	DataSize  int            `json:"dataSize"`
+	// Blobs is the number of blobs of a blob transaction
+	Blobs int `json:"blobs,omitempty"`
+	// Replacements is the number of times that the transaction was replaced with higher fees
+	Replacements int `json:"replacements"`
+	// Age is the time since the first transaction was sent
+	Age string `json:"age"`
+}
+
+// Status returns the in-flight transactions and the depth of the submission queue.
+func (b *BatchSubmitter) Status() SubmitterStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := SubmitterStatus{
+		InFlight:    []InFlightTx{},
+		Unconfirmed: len(b.included),
+		QueueDepth:  b.Queue.Len(),
+	}
+	for _, p := range b.inflight {
+		sent := p.Sent()
+		tx := sent[len(sent)-1]
+		inflight := InFlightTx{
+			Hash:         tx.Hash(),
+			Nonce:        hexutil.Uint64(tx.Nonce()),
+			GasTipCap:    (*hexutil.Big)(tx.GasTipCap()),
+			GasFeeCap:    (*hexutil.Big)(tx.GasFeeCap()),
+			DataSize:     txDataSize(tx),
+			Replacements: len(sent) - 1,
+			Age:          time.Since(p.firstSent).Round(time.Second).String(),
+		}
+		if blobTx, ok := tx.(*BlobTx); ok {
+			inflight.Blobs = len(blobTx.BlobHashes())
+		}
+		status.InFlight = append(status.InFlight, inflight)
+		status.PendingBytes += inflight.DataSize
+	}
+	return status
+}
+
+func (b *BatchSubmitter) addInflight(tx *PendingTx) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inflight = append(b.inflight, tx)
+	b.updatePendingBytes()
+}
+
+func (b *BatchSubmitter) removeInflight(txs []*PendingTx) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var kept []*PendingTx
+	for _, p := range b.inflight {
+		remove := false
+		for _, tx := range txs {
+			remove = remove || tx == p
+		}
+		if !remove {
+			kept = append(kept, p)
+		}
+	}
+	b.inflight = kept
+	b.updatePendingBytes()
+}
+
+func (b *BatchSubmitter) updatePendingBytes() {
+	var size int
+	for _, p := range b.inflight {
+		size += txDataSize(p.Tx())
+	}
+	metrics.GetOrRegisterGauge("bss/pending_bytes", nil).Update(int64(size))
+}
+
+// txDataSize returns the size of the batch data of the transaction, in its calldata or its blobs.
+func txDataSize(tx Tx) int {
+	if blobTx, ok := tx.(*BlobTx); ok {
+		return blobTx.DataSize()
+	}
+	return len(tx.Data())
+}
+
+// maxTxDataSize returns the maximum size of the data of a transaction, within both the size limit and the gas limit.
+// The gas limit is converted to a size assuming that all bytes are non-zero, the most expensive calldata.
+// With blobs, it is the size of the data of a blob.
+func (b *BatchSubmitter) maxTxDataSize() int {
+	if b.UseBlobs {
+		return derive.MaxBlobDataSize
+	}
+	maxSize := b.MaxTxDataSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxTxDataSize
+	}
+	if b.MaxTxGas != 0 {
+		var gasSize uint64
+		if b.MaxTxGas > params.TxGas {
+			gasSize = (b.MaxTxGas - params.TxGas) / params.TxDataNonZeroGasEIP2028
+		}
+		if gasSize < uint64(maxSize) {
+			maxSize = int(gasSize)
+		}
+	}
+	return maxSize
+}
+
+// encodeBundles encodes the batches into bundles that each fit in a single transaction of at most maxSize bytes,
+// measured after compression. Consecutive batches are packed together in order.
+// A batch that does not fit in a transaction by itself is encoded in a bundle of its own, to be split into frames.
+func (b *BatchSubmitter) encodeBundles(config *rollup.Config, batches []*derive.BatchData, maxSize int) ([][]byte, error) {
+	encode := func(batches []*derive.BatchData) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := derive.EncodeBatchBundle(config, b.BundleType, b.BatchType, batches, &buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	all, err := encode(batches)
+	if err != nil || len(all) <= maxSize || len(batches) <= 1 {
+		return [][]byte{all}, err
+	}
+	var out [][]byte
+	start := 0
+	var last []byte // the encoding of batches[start:i]
+	for i := range batches {
+		enc, err := encode(batches[start : i+1])
+		if err != nil {
+			return nil, err
+		}
+		if len(enc) > maxSize && i > start {
+			out = append(out, last)
+			start = i
+			if enc, err = encode(batches[i : i+1]); err != nil {
+				return nil, err
+			}
+		}
+		last = enc
+	}
+	return append(out, last), nil
+}
+
+// L1HeadChanged stops tracking the transactions that are confirmed by the new L1 head,
+// and removes the submissions of which all transactions are confirmed from the queue.
+// If the L1 chain reorged, the inclusion of the tracked transactions is checked again in the background,
+// and the transactions that were reorged out are rebroadcast, so their batches are not lost.
+func (b *BatchSubmitter) L1HeadChanged(head eth.L1BlockRef, reorged bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.l1Head = head.Number
+	b.confirm()
+	if reorged {
+		go b.recheckIncluded()
+	}
+}
+
+// L1Finalized stops tracking the transactions that are included up to the finalized L1 block,
+// and removes the submissions of which all transactions are confirmed from the queue.
+func (b *BatchSubmitter) L1Finalized(finalized eth.L1BlockRef) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if finalized.Number > b.l1Finalized {
+		b.l1Finalized = finalized.Number
+		b.confirm()
+	}
+}
+
+// confirm stops tracking the transactions that are deep enough in the L1 chain or finalized,
+// and removes the submissions of which all transactions are confirmed from the queue. The caller must hold the lock.
+func (b *BatchSubmitter) confirm() {
+	depth := b.ConfirmationDepth
+	if depth == 0 {
+		depth = DefaultConfirmationDepth
+	}
+	var kept, confirmed []*includedTx
+	for _, inc := range b.included {
+		if inc.rechecking || (b.l1Head < inc.block.Number+depth && inc.block.Number > b.l1Finalized) {
+			kept = append(kept, inc)
+		} else {
+			confirmed = append(confirmed, inc)
+		}
+	}
+	b.included = kept
+	for _, inc := range confirmed {
+		if b.lost[inc.submission] {
+			continue
+		}
+		b.Events.Emit(events.BatchConfirmed, BatchConfirmedEvent{Tx: inc.tx.Tx().Hash(), L1Block: inc.block, Submission: inc.submission})
+		if b.hasIncluded(inc.submission) {
+			continue
+		}
+		if err := b.Queue.Remove(inc.submission); err != nil {
+			b.TxMgr.log.Error("Failed to remove confirmed submission from the batch queue", "submission", inc.submission, "err", err)
+		}
+	}
+}
+
+// recheckIncluded checks if the tracked transactions are still included, and rebroadcasts the ones that are not.
+func (b *BatchSubmitter) recheckIncluded() {
+	b.mu.Lock()
+	var check []*includedTx
+	for _, inc := range b.included {
+		if !inc.rechecking {
+			inc.rechecking = true
+			check = append(check, inc)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, inc := range check {
+		block, ok := b.recheck(inc)
+		b.mu.Lock()
+		inc.rechecking = false
+		if ok {
+			inc.block = block
+		} else {
+			b.removeIncluded(inc)
+			if b.lost == nil {
+				b.lost = make(map[uint64]bool)
+			}
+			b.lost[inc.submission] = true
 		}
-		<-time.After(150 * time.Millisecond)
+		b.mu.Unlock()
+	}
+}
 
-		select {
-		case <-timeout:
-			return common.Hash{}, errors.New("timeout")
-		default:
+// recheck returns the L1 block that includes the transaction after a reorg.
+// If the transaction was reorged out, it is rebroadcast and waited for until the inclusion timeout.
+// It returns false if the transaction could not be included again.
+func (b *BatchSubmitter) recheck(inc *includedTx) (eth.BlockID, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.TxMgr.InclusionTimeout())
+	defer cancel()
+	log := b.TxMgr.log
+	receipt, err := inc.tx.receipt(ctx)
+	if err != nil {
+		log.Warn("Failed to check inclusion of batch submission transaction after L1 reorg", "tx", inc.tx.Tx().Hash(), "err", err)
+		return inc.block, true
+	}
+	if receipt != nil {
+		if block := receiptBlock(receipt); block != inc.block {
+			log.Info("Batch submission transaction was included in a different L1 block after reorg", "tx", receipt.TxHash, "old", inc.block, "new", block)
+			return block, true
 		}
+		return inc.block, true
+	}
+	log.Warn("Batch submission transaction was reorged out, rebroadcasting", "tx", inc.tx.Tx().Hash(), "block", inc.block)
+	inc.tx.rebroadcast(ctx)
+	receipt, err = inc.tx.Wait(ctx)
+	if err != nil {
+		submitterFailures("rebroadcast").Inc(1)
+		log.Error("Reorged out batch submission transaction was not included again", "tx", inc.tx.Tx().Hash(),
+			"submission", inc.submission, "queued", b.Queue != nil, "err", err)
+		return eth.BlockID{}, false
 	}
+	return receiptBlock(receipt), true
+}
+
+func (b *BatchSubmitter) hasIncluded(submission uint64) bool {
+	for _, inc := range b.included {
+		if inc.submission == submission {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *BatchSubmitter) removeIncluded(inc *includedTx) {
+	for i, other := range b.included {
+		if other == inc {
+			b.included = append(b.included[:i], b.included[i+1:]...)
+			return
+		}
+	}
+}
 
+func receiptBlock(receipt *types.Receipt) eth.BlockID {
+	return eth.BlockID{Hash: receipt.BlockHash, Number: receipt.BlockNumber.Uint64()}
 }
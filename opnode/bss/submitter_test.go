@@ -0,0 +1,291 @@
+package bss
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebroadcastReorgedOut(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1, 1, 1}, blockHash: common.Hash{1}}
+	b := &BatchSubmitter{
+		TxMgr:             newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1),
+		ConfirmationDepth: 10,
+	}
+	batches := []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2}}}
+	_, err := b.Submit(&rollup.Config{}, batches)
+	require.NoError(t, err)
+	require.Len(t, b.included, 1)
+	require.Equal(t, eth.BlockID{Hash: common.Hash{1}, Number: 2}, b.included[0].block)
+	tx := l1.sent[0]
+
+	// A transaction that is still included is not sent again
+	b.recheckIncluded()
+	require.Len(t, l1.sent, 1)
+
+	// A transaction that was reorged out is sent again, and is tracked in its new block
+	l1.reorgOut(tx.Hash(), common.Hash{2})
+	b.recheckIncluded()
+	require.Len(t, l1.sent, 2)
+	require.Equal(t, tx.Hash(), l1.sent[1].Hash(), "the same transaction is rebroadcast")
+	require.Len(t, b.included, 1)
+	require.Equal(t, eth.BlockID{Hash: common.Hash{2}, Number: 2}, b.included[0].block)
+
+	// A transaction is not tracked anymore once it is confirmed
+	b.L1HeadChanged(eth.L1BlockRef{Number: 11}, false)
+	require.Len(t, b.included, 1)
+	b.L1HeadChanged(eth.L1BlockRef{Number: 12}, false)
+	require.Empty(t, b.included)
+}
+
+func TestSubmissionIDs(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1, 1, 1}, blockHash: common.Hash{1}}
+	b := &BatchSubmitter{TxMgr: newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1)}
+	for i := uint64(0); i < 3; i++ {
+		_, err := b.Submit(&rollup.Config{}, []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2 + i}}})
+		require.NoError(t, err)
+	}
+	// Without a queue, the submissions still have unique, increasing IDs
+	require.Len(t, b.included, 3)
+	for i, inc := range b.included {
+		require.Equal(t, uint64(i), inc.submission)
+	}
+}
+
+func TestLostSubmission(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1, 1, 1}, blockHash: common.Hash{1}}
+	var buf bytes.Buffer
+	bus := events.NewBus(testlog.Logger(t, log.LvlError), events.NewStreamSink(&buf))
+	b := &BatchSubmitter{
+		TxMgr:             newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond, InclusionTimeout: 50 * time.Millisecond}, l1),
+		ConfirmationDepth: 10,
+		Events:            bus,
+	}
+	_, err := b.Submit(&rollup.Config{}, []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2}}})
+	require.NoError(t, err)
+
+	// The transaction is reorged out, and cannot be sent again
+	l1.reorgOut(l1.sent[0].Hash(), common.Hash{2})
+	l1.failing = errors.New("cannot send")
+	b.recheckIncluded()
+	require.Empty(t, b.included)
+	l1.failing = nil
+
+	// Without a queue, the lost submission does not hold up the confirmation of the later submissions
+	_, err = b.Submit(&rollup.Config{}, []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 4}}})
+	require.NoError(t, err)
+	b.L1HeadChanged(eth.L1BlockRef{Number: 12}, false)
+	require.Empty(t, b.included)
+	require.NoError(t, bus.Close())
+	var ev struct {
+		Type events.Type         `json:"type"`
+		Data BatchConfirmedEvent `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &ev))
+	require.Equal(t, events.BatchConfirmed, ev.Type)
+	require.Equal(t, uint64(1), ev.Data.Submission)
+	require.Equal(t, l1.sent[len(l1.sent)-1].Hash(), ev.Data.Tx)
+}
+
+func TestBatchConfirmedEvents(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1, 1, 1}, blockHash: common.Hash{1}}
+	var buf bytes.Buffer
+	bus := events.NewBus(testlog.Logger(t, log.LvlError), events.NewStreamSink(&buf))
+	b := &BatchSubmitter{
+		TxMgr:             newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1),
+		ConfirmationDepth: 10,
+		Events:            bus,
+	}
+	for i := uint64(0); i < 3; i++ {
+		_, err := b.Submit(&rollup.Config{}, []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2 + i}}})
+		require.NoError(t, err)
+	}
+	b.L1HeadChanged(eth.L1BlockRef{Number: 12}, false)
+	require.NoError(t, bus.Close())
+
+	// Without a queue, every confirmed transaction is emitted, with the ID of its submission
+	scanner := bufio.NewScanner(&buf)
+	var confirmed []BatchConfirmedEvent
+	for scanner.Scan() {
+		var ev struct {
+			Type events.Type         `json:"type"`
+			Data BatchConfirmedEvent `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		require.Equal(t, events.BatchConfirmed, ev.Type)
+		confirmed = append(confirmed, ev.Data)
+	}
+	require.Len(t, confirmed, 3)
+	for i, ev := range confirmed {
+		require.Equal(t, l1.sent[i].Hash(), ev.Tx)
+		require.Equal(t, eth.BlockID{Hash: common.Hash{1}, Number: 2}, ev.L1Block)
+		require.Equal(t, uint64(i), ev.Submission)
+	}
+}
+
+func TestConfirmFinalized(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1, 1, 1}, blockHash: common.Hash{1}}
+	b := &BatchSubmitter{
+		TxMgr:             newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1),
+		ConfirmationDepth: 10,
+	}
+	_, err := b.Submit(&rollup.Config{}, []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2}}})
+	require.NoError(t, err)
+	require.Len(t, b.included, 1)
+
+	// A transaction is confirmed once its L1 block is finalized, before it is deep enough
+	b.L1HeadChanged(eth.L1BlockRef{Number: 5}, false)
+	b.L1Finalized(eth.L1BlockRef{Number: 1})
+	require.Len(t, b.included, 1)
+	b.L1Finalized(eth.L1BlockRef{Number: 2})
+	require.Empty(t, b.included)
+}
+
+func TestSubmitSplitsBatches(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1}}
+	b := &BatchSubmitter{
+		TxMgr:         newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1),
+		MaxTxDataSize: 400,
+		BundleType:    derive.BatchBundleV2Type,
+	}
+	var batches []*derive.BatchData
+	for i := 0; i < 10; i++ {
+		// random data, so compression does not make the batches fit
+		tx := make([]byte, 100)
+		_, err := rand.Read(tx)
+		require.NoError(t, err)
+		batches = append(batches, &derive.BatchData{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: uint64(i), Transactions: []hexutil.Bytes{tx}}})
+	}
+	large := make([]byte, 1000)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+	batches = append(batches, &derive.BatchData{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 10, Transactions: []hexutil.Bytes{large}}})
+
+	_, err = b.Submit(&rollup.Config{}, batches)
+	require.NoError(t, err)
+	var data [][]byte
+	for _, tx := range l1.sent {
+		require.LessOrEqual(t, len(tx.Data()), 400)
+		data = append(data, tx.Data())
+	}
+	require.Greater(t, len(data), 4, "batches are split over transactions")
+	// the batches that fit are bundled, without channel frames
+	out, err := derive.DecodeBatches(&rollup.Config{}, bytes.NewReader(data[0]))
+	require.NoError(t, err)
+	require.Greater(t, len(out), 1)
+	out, err = derive.BatchesFromData(&rollup.Config{}, [][][]byte{data}, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Equal(t, batches, out)
+}
+
+func TestSubmitBlobs(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{1}, blobBaseFee: 1}
+	b := &BatchSubmitter{
+		TxMgr:    newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1),
+		UseBlobs: true,
+	}
+	batches := []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{{1, 2, 3}}}}}
+	_, err := b.Submit(&rollup.Config{}, batches)
+	require.NoError(t, err)
+	require.Len(t, l1.sent, 1)
+	tx, ok := l1.sent[0].(*BlobTx)
+	require.True(t, ok, "submitted in a blob transaction")
+	require.Empty(t, tx.Data())
+	require.Len(t, tx.BlobHashes(), 1)
+	data, err := tx.sidecar.blobs[0].ToData()
+	require.NoError(t, err)
+	out, err := derive.BatchesFromData(&rollup.Config{}, [][][]byte{{data}}, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Equal(t, batches, out)
+
+	require.Equal(t, [][][]byte{{{1}, {2}}}, (&BatchSubmitter{UseBlobs: true}).groupTxData([][]byte{{1}, {2}}))
+	require.Equal(t, [][][]byte{{{1}}, {{2}}}, (&BatchSubmitter{}).groupTxData([][]byte{{1}, {2}}))
+}
+
+func TestMaxTxDataSize(t *testing.T) {
+	require.Equal(t, DefaultMaxTxDataSize, (&BatchSubmitter{}).maxTxDataSize())
+	require.Equal(t, 1000, (&BatchSubmitter{MaxTxDataSize: 1000, MaxTxGas: 1_000_000}).maxTxDataSize())
+	size := (&BatchSubmitter{MaxTxGas: 100_000}).maxTxDataSize()
+	require.Equal(t, 4937, size)
+	gas, err := core.IntrinsicGas(bytes.Repeat([]byte{0xff}, size), nil, false, true, true)
+	require.NoError(t, err)
+	require.LessOrEqual(t, gas, uint64(100_000))
+}
+
+func TestSubmitterStatusAndMetrics(t *testing.T) {
+	metrics.Enabled = true
+	for _, name := range []string{"bss/submitted_batches", "bss/fees_spent_gwei", "bss/pending_bytes"} {
+		metrics.DefaultRegistry.Unregister(name)
+	}
+	l1 := &fakeL1{tip: big.NewInt(params.GWei), baseFees: []int64{2 * params.GWei}}
+	l1.setMinTip(2 * params.GWei) // stuck until the minimum tip is lowered
+	b := &BatchSubmitter{
+		TxMgr: newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond, ResubmissionTimeout: time.Hour}, l1),
+	}
+	batches := []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{}}}}
+	done := make(chan error)
+	go func() {
+		_, err := b.Submit(&rollup.Config{}, batches)
+		done <- err
+	}()
+
+	require.Eventually(t, func() bool { return len(b.Status().InFlight) == 1 }, time.Second, time.Millisecond)
+	status := b.Status()
+	require.Equal(t, uint64(0), uint64(status.InFlight[0].Nonce))
+	require.Equal(t, status.InFlight[0].DataSize, status.PendingBytes)
+	require.Equal(t, int64(status.PendingBytes), metrics.GetOrRegisterGauge("bss/pending_bytes", nil).Value())
+
+	l1.setMinTip(0)
+	require.NoError(t, <-done)
+	status = b.Status()
+	require.Empty(t, status.InFlight)
+	require.Equal(t, 1, status.Unconfirmed)
+	require.Zero(t, metrics.GetOrRegisterGauge("bss/pending_bytes", nil).Value())
+	require.Equal(t, int64(1), metrics.GetOrRegisterCounter("bss/submitted_batches", nil).Count())
+	// intrinsic gas times the basefee plus the tip
+	gas := l1.sent[0].Gas()
+	require.Equal(t, int64(gas*3), metrics.GetOrRegisterCounter("bss/fees_spent_gwei", nil).Count())
+}
+
+func TestDryRun(t *testing.T) {
+	q, err := OpenBatchQueue(filepath.Join(t.TempDir(), "queue.json"), testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	l1 := &fakeL1{tip: big.NewInt(5), baseFees: []int64{10}}
+	b := &BatchSubmitter{
+		TxMgr:  newTestTxManager(t, TxManagerConfig{}, l1),
+		Queue:  q,
+		DryRun: true,
+	}
+	batches := []*derive.BatchData{{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{{1, 2, 3}}}}}
+	_, err = b.Submit(&rollup.Config{}, batches)
+	require.NoError(t, err)
+	require.Empty(t, l1.sent, "nothing is sent")
+	require.Zero(t, q.Len(), "nothing is queued")
+
+	est, err := b.TxMgr.Estimate(context.Background(), []byte{0, 1})
+	require.NoError(t, err)
+	require.Equal(t, uint64(21000+4+16), est.Gas)
+	require.Equal(t, big.NewInt(5), est.Tip)
+	require.Equal(t, big.NewInt(2*10+5), est.FeeCap)
+	require.Equal(t, new(big.Int).Mul(big.NewInt(25), big.NewInt(int64(est.Gas))), est.MaxFee)
+}
@@ -0,0 +1,602 @@
+package bss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	defaultResubmissionTimeout  = 30 * time.Second
+	defaultInclusionTimeout     = 10 * time.Minute
+	defaultReceiptQueryInterval = 500 * time.Millisecond
+	defaultNetworkTimeout       = 10 * time.Second
+	// minFeeBumpPercent is the minimum fee increase of a replacement transaction accepted by the L1 transaction pool.
+	minFeeBumpPercent = 10
+	// blobFeeBumpPercent is the minimum fee increase of a replacement blob transaction, including its blob fee cap.
+	// The L1 blob pool requires the fees of blob transactions to double.
+	blobFeeBumpPercent = 100
+)
+
+// TxManagerConfig configures the TxManager. Zero values are replaced with defaults.
+type TxManagerConfig struct {
+	// ResubmissionTimeout is the time to wait for a transaction to be included,
+	// before it is replaced with a transaction with higher fees. 30 seconds by default.
+	ResubmissionTimeout time.Duration
+	// InclusionTimeout is the time to wait for a transaction to be included, including the replacements,
+	// before giving up on the transaction. 10 minutes by default.
+	InclusionTimeout time.Duration
+	// ReceiptQueryInterval is the interval to poll the receipts of the sent transactions at. 500ms by default.
+	ReceiptQueryInterval time.Duration
+	// NetworkTimeout is the timeout of each L1 RPC request. 10 seconds by default.
+	NetworkTimeout time.Duration
+	// FeeBumpPercent is the percentage by which the fees of a replacement transaction are increased,
+	// at least the 10% required by the L1 transaction pool.
+	FeeBumpPercent uint64
+	// MaxGasPrice is the ceiling of the fee cap of transactions and their replacements, in wei. There is no ceiling if nil.
+	// A transaction that is not included at the ceiling is not replaced anymore.
+	MaxGasPrice *big.Int
+	// FeeEstimator configures the fees of new transactions, and the minimum fees of replacements.
+	FeeEstimator FeeEstimatorConfig
+}
+
+func (c *TxManagerConfig) withDefaults() TxManagerConfig {
+	out := *c
+	if out.ResubmissionTimeout == 0 {
+		out.ResubmissionTimeout = defaultResubmissionTimeout
+	}
+	if out.InclusionTimeout == 0 {
+		out.InclusionTimeout = defaultInclusionTimeout
+	}
+	if out.ReceiptQueryInterval == 0 {
+		out.ReceiptQueryInterval = defaultReceiptQueryInterval
+	}
+	if out.NetworkTimeout == 0 {
+		out.NetworkTimeout = defaultNetworkTimeout
+	}
+	if out.FeeBumpPercent < minFeeBumpPercent {
+		out.FeeBumpPercent = minFeeBumpPercent
+	}
+	out.FeeEstimator = out.FeeEstimator.withDefaults()
+	return out
+}
+
+// TxManagerClient is the L1 RPC interface that the TxManager uses, implemented by the L1Client.
+type TxManagerClient interface {
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	// BlobBaseFee returns the blob basefee of the next L1 block.
+	BlobBaseFee(ctx context.Context) (*big.Int, error)
+	// SendRawTransaction sends a transaction in its network encoding, for the blob transactions.
+	SendRawTransaction(ctx context.Context, raw []byte) error
+	// BlobGasPrice returns the blob gas price paid by the included blob transaction.
+	BlobGasPrice(ctx context.Context, txHash common.Hash) (*big.Int, error)
+}
+
+// RPC is the JSON-RPC client of the L1 node, e.g. the failover client of the rollup node.
+type RPC interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// L1Client is the TxManagerClient of an L1 node, over any JSON-RPC client rather than only a *rpc.Client,
+// so the batch submitter fails over between the L1 endpoints like the rest of the node.
+type L1Client struct {
+	rpc RPC
+}
+
+func NewL1Client(rpc RPC) *L1Client {
+	return &L1Client{rpc: rpc}
+}
+
+func (c *L1Client) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	var tip hexutil.Big
+	if err := c.rpc.CallContext(ctx, &tip, "eth_maxPriorityFeePerGas"); err != nil {
+		return nil, err
+	}
+	return (*big.Int)(&tip), nil
+}
+
+// HeaderByNumber returns the header of the given block number, or of the latest block if nil.
+func (c *L1Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	arg := "latest"
+	if number != nil {
+		arg = hexutil.EncodeBig(number)
+	}
+	var header *types.Header
+	if err := c.rpc.CallContext(ctx, &header, "eth_getBlockByNumber", arg, false); err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, ethereum.NotFound
+	}
+	return header, nil
+}
+
+func (c *L1Client) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var nonce hexutil.Uint64
+	if err := c.rpc.CallContext(ctx, &nonce, "eth_getTransactionCount", account, "pending"); err != nil {
+		return 0, err
+	}
+	return uint64(nonce), nil
+}
+
+func (c *L1Client) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return c.SendRawTransaction(ctx, raw)
+}
+
+func (c *L1Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var receipt *types.Receipt
+	if err := c.rpc.CallContext(ctx, &receipt, "eth_getTransactionReceipt", txHash); err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+func (c *L1Client) BlobBaseFee(ctx context.Context) (*big.Int, error) {
+	var fee hexutil.Big
+	if err := c.rpc.CallContext(ctx, &fee, "eth_blobBaseFee"); err != nil {
+		return nil, err
+	}
+	return (*big.Int)(&fee), nil
+}
+
+func (c *L1Client) SendRawTransaction(ctx context.Context, raw []byte) error {
+	return c.rpc.CallContext(ctx, nil, "eth_sendRawTransaction", hexutil.Bytes(raw))
+}
+
+func (c *L1Client) BlobGasPrice(ctx context.Context, txHash common.Hash) (*big.Int, error) {
+	var receipt *struct {
+		BlobGasPrice *hexutil.Big `json:"blobGasPrice"`
+	}
+	if err := c.rpc.CallContext(ctx, &receipt, "eth_getTransactionReceipt", txHash); err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		return nil, ethereum.NotFound
+	}
+	if receipt.BlobGasPrice == nil {
+		return nil, fmt.Errorf("receipt of transaction %s has no blob gas price", txHash)
+	}
+	return (*big.Int)(receipt.BlobGasPrice), nil
+}
+
+// TxManager sends transactions of a single account to L1. It assigns the nonces of the transactions,
+// and replaces transactions that are stuck in the transaction pool with transactions with higher fees.
+// It is safe for concurrent use.
+type TxManager struct {
+	cfg     TxManagerConfig
+	client  TxManagerClient
+	chainID *big.Int
+	signer  Signer
+	from    common.Address
+	log     log.Logger
+
+	mu sync.Mutex
+	// nonce is the nonce of the next transaction, or nil if it is fetched from L1 for the next transaction
+	nonce *uint64
+}
+
+func NewTxManager(cfg TxManagerConfig, client TxManagerClient, chainID *big.Int, signer Signer, log log.Logger) *TxManager {
+	return &TxManager{
+		cfg:     cfg.withDefaults(),
+		client:  client,
+		chainID: chainID,
+		signer:  signer,
+		from:    signer.Address(),
+		log:     log,
+	}
+}
+
+// resetNonce makes the next transaction fetch the pending nonce from L1 again.
+func (m *TxManager) resetNonce() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nonce = nil
+}
+
+// InclusionTimeout returns the time to wait for a transaction to be included, before giving up on it.
+func (m *TxManager) InclusionTimeout() time.Duration {
+	return m.cfg.InclusionTimeout
+}
+
+// PendingTx is a transaction that was sent by the TxManager, and that may be replaced until it is included.
+type PendingTx struct {
+	m  *TxManager
+	mu sync.Mutex
+	// txs are the sent transactions with the same nonce, the last one has the highest fees
+	txs []Tx
+	// firstSent is the time that the first transaction was sent at
+	firstSent time.Time
+	// sentAt is the time that the last transaction was sent or rebroadcast at
+	sentAt time.Time
+	// atCeiling is true when the fees cannot be bumped anymore
+	atCeiling bool
+}
+
+// TxEstimate is the gas and fees that a transaction would be sent with.
+type TxEstimate struct {
+	Gas    uint64
+	Tip    *big.Int
+	FeeCap *big.Int
+	// BlobFeeCap is the blob fee cap of a blob transaction, nil for other transactions
+	BlobFeeCap *big.Int
+	// MaxFee is the most that the transaction could cost: the gas times the fee cap,
+	// plus the blob gas times the blob fee cap
+	MaxFee *big.Int
+}
+
+// Estimate returns the gas and fees that a transaction with the given data would be sent with, without sending it.
+func (m *TxManager) Estimate(ctx context.Context, data []byte) (TxEstimate, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.NetworkTimeout)
+	defer cancel()
+	tip, feeCap, err := m.estimateFees(ctx)
+	if err != nil {
+		return TxEstimate{}, err
+	}
+	gas, err := core.IntrinsicGas(data, nil, false, true, true)
+	if err != nil {
+		return TxEstimate{}, err
+	}
+	maxFee := new(big.Int).Mul(feeCap, new(big.Int).SetUint64(gas))
+	return TxEstimate{Gas: gas, Tip: tip, FeeCap: feeCap, MaxFee: maxFee}, nil
+}
+
+// EstimateBlobs returns the gas and fees that a blob transaction with the given number of blobs would be sent with,
+// without sending it.
+func (m *TxManager) EstimateBlobs(ctx context.Context, blobs int) (TxEstimate, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.NetworkTimeout)
+	defer cancel()
+	tip, feeCap, err := m.estimateFees(ctx)
+	if err != nil {
+		return TxEstimate{}, err
+	}
+	blobFeeCap, err := m.estimateBlobFeeCap(ctx)
+	if err != nil {
+		return TxEstimate{}, err
+	}
+	maxFee := new(big.Int).Mul(feeCap, new(big.Int).SetUint64(params.TxGas))
+	maxFee.Add(maxFee, new(big.Int).Mul(blobFeeCap, big.NewInt(int64(blobs)*blobGasPerBlob)))
+	return TxEstimate{Gas: params.TxGas, Tip: tip, FeeCap: feeCap, BlobFeeCap: blobFeeCap, MaxFee: maxFee}, nil
+}
+
+// Send signs and sends a transaction with the given data to the given address, with the next nonce of the account.
+// Transactions are sent in order of their nonces. Use Wait on the returned pending transaction to wait for its inclusion.
+func (m *TxManager) Send(ctx context.Context, to common.Address, data []byte) (*PendingTx, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.NetworkTimeout)
+	defer cancel()
+	tip, feeCap, err := m.estimateFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// No contract execution so we just pay intrinsic gas.
+	// If we add contract execution, making it gas usage deterministic is very helpful.
+	gas, err := core.IntrinsicGas(data, nil, false, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.sendNext(ctx, func(nonce uint64) (Tx, error) {
+		return m.sign(ctx, &types.DynamicFeeTx{
+			ChainID:   m.chainID,
+			Nonce:     nonce,
+			To:        &to,
+			GasTipCap: tip,
+			GasFeeCap: feeCap,
+			Gas:       gas,
+			Data:      data,
+		})
+	})
+}
+
+// SendBlobs signs and sends a blob transaction to the given address, with each of the data items encoded in a blob,
+// at most MaxBlobsPerTx. It requires a HashSigner. The nonces are shared with Send.
+func (m *TxManager) SendBlobs(ctx context.Context, to common.Address, data [][]byte) (*PendingTx, error) {
+	if _, ok := m.signer.(HashSigner); !ok {
+		return nil, errors.New("signer cannot sign blob transactions")
+	}
+	sidecar, err := newBlobSidecar(data)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.NetworkTimeout)
+	defer cancel()
+	tip, feeCap, err := m.estimateFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blobFeeCap, err := m.estimateBlobFeeCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.sendNext(ctx, func(nonce uint64) (Tx, error) {
+		return m.signBlobTx(ctx, &BlobTx{
+			chainID:    m.chainID,
+			nonce:      nonce,
+			to:         to,
+			gas:        params.TxGas,
+			tipCap:     tip,
+			feeCap:     feeCap,
+			blobFeeCap: blobFeeCap,
+			sidecar:    sidecar,
+		})
+	})
+}
+
+// sendNext signs the transaction with the next nonce, and sends it.
+func (m *TxManager) sendNext(ctx context.Context, sign func(nonce uint64) (Tx, error)) (*PendingTx, error) {
+	// The nonce is reserved and the transaction is sent under the lock, so transactions are sent in nonce order.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.nonce == nil {
+		nonce, err := m.client.PendingNonceAt(ctx, m.from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the pending nonce of %s: %w", m.from, err)
+		}
+		m.nonce = &nonce
+	}
+	tx, err := sign(*m.nonce)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sendTx(ctx, tx); err != nil {
+		// The nonce may be out of sync with L1, e.g. after transactions were sent by another process.
+		m.nonce = nil
+		return nil, fmt.Errorf("failed to send transaction with nonce %d: %w", tx.Nonce(), err)
+	}
+	*m.nonce++
+	m.log.Debug("Sent transaction", "tx", tx.Hash(), "nonce", tx.Nonce(), "tip", tx.GasTipCap(), "fee_cap", tx.GasFeeCap())
+	now := time.Now()
+	return &PendingTx{m: m, txs: []Tx{tx}, firstSent: now, sentAt: now}, nil
+}
+
+func (m *TxManager) sendTx(ctx context.Context, tx Tx) error {
+	switch tx := tx.(type) {
+	case *BlobTx:
+		return m.client.SendRawTransaction(ctx, tx.raw)
+	case *types.Transaction:
+		return m.client.SendTransaction(ctx, tx)
+	default:
+		return fmt.Errorf("unknown transaction type %T", tx)
+	}
+}
+
+func (m *TxManager) sign(ctx context.Context, tx *types.DynamicFeeTx) (*types.Transaction, error) {
+	signed, err := m.signer.SignTx(ctx, m.chainID, types.NewTx(tx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction with nonce %d: %w", tx.Nonce, err)
+	}
+	return signed, nil
+}
+
+func (m *TxManager) signBlobTx(ctx context.Context, tx *BlobTx) (*BlobTx, error) {
+	hash, err := tx.sigHash()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := m.signer.(HashSigner).SignHash(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign blob transaction with nonce %d: %w", tx.nonce, err)
+	}
+	return tx.withSignature(sig)
+}
+
+// Tx returns the latest transaction that was sent, with the highest fees.
+func (p *PendingTx) Tx() Tx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.txs[len(p.txs)-1]
+}
+
+// Sent returns all transactions that were sent, the original transaction and its replacements.
+func (p *PendingTx) Sent() []Tx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Tx(nil), p.txs...)
+}
+
+// Wait waits until the transaction, or one of its replacements, is included, and returns its receipt.
+// The transaction is replaced with a transaction with higher fees when it is not included within the resubmission timeout.
+func (p *PendingTx) Wait(ctx context.Context) (*types.Receipt, error) {
+	ticker := time.NewTicker(p.m.cfg.ReceiptQueryInterval)
+	defer ticker.Stop()
+	for {
+		receipt, err := p.receipt(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if receipt != nil {
+			return receipt, nil
+		}
+		if !p.atCeiling && time.Since(p.sentAt) >= p.m.cfg.ResubmissionTimeout {
+			p.replace(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			// The transaction is abandoned, it may be dropped from the transaction pool and leave a nonce gap.
+			p.m.resetNonce()
+			return nil, fmt.Errorf("transaction with nonce %d was not included: %w", p.Tx().Nonce(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// receipt returns the receipt of whichever of the sent transactions is included, or nil if none is included yet.
+func (p *PendingTx) receipt(ctx context.Context) (*types.Receipt, error) {
+	txs := p.Sent()
+	for i := len(txs) - 1; i >= 0; i-- {
+		rctx, cancel := context.WithTimeout(ctx, p.m.cfg.NetworkTimeout)
+		receipt, err := p.m.client.TransactionReceipt(rctx, txs[i].Hash())
+		cancel()
+		if receipt != nil {
+			return receipt, nil
+		} else if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return nil, fmt.Errorf("failed to fetch receipt of transaction %s: %w", txs[i].Hash(), err)
+		}
+	}
+	return nil, nil
+}
+
+// replace sends a replacement of the latest transaction with bumped fees, unless the fees are at the ceiling.
+// Errors are logged, the previous transactions may still be included.
+func (p *PendingTx) replace(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.m.cfg.NetworkTimeout)
+	defer cancel()
+	prev := p.Tx()
+	p.sentAt = time.Now()
+	tip, feeCap, err := p.m.estimateFees(ctx)
+	if err != nil {
+		p.m.log.Warn("Failed to estimate the fees to replace a stuck transaction", "tx", prev.Hash(), "err", err)
+		return
+	}
+	percent := p.m.cfg.FeeBumpPercent
+	prevBlob, isBlob := prev.(*BlobTx)
+	if isBlob && percent < blobFeeBumpPercent {
+		percent = blobFeeBumpPercent
+	}
+	tip, feeCap, ok := bumpFees(prev.GasTipCap(), prev.GasFeeCap(), tip, feeCap, percent, p.m.cfg.MaxGasPrice)
+	if !ok {
+		p.atCeiling = true
+		p.m.log.Warn("Transaction is stuck, but its fees are at the max gas price", "tx", prev.Hash(), "nonce", prev.Nonce(),
+			"fee_cap", prev.GasFeeCap(), "max_gas_price", p.m.cfg.MaxGasPrice)
+		return
+	}
+	var tx Tx
+	if isBlob {
+		// The blob fee cap is not limited by the max gas price, which applies to the execution gas.
+		var blobFeeCap *big.Int
+		if blobFeeCap, err = p.m.estimateBlobFeeCap(ctx); err == nil {
+			blobFeeCap, _, _ = bumpFees(prevBlob.blobFeeCap, prevBlob.blobFeeCap, blobFeeCap, blobFeeCap, percent, nil)
+			cpy := *prevBlob
+			cpy.tipCap, cpy.feeCap, cpy.blobFeeCap = tip, feeCap, blobFeeCap
+			tx, err = p.m.signBlobTx(ctx, &cpy)
+		}
+	} else {
+		tx, err = p.m.sign(ctx, &types.DynamicFeeTx{
+			ChainID:   p.m.chainID,
+			Nonce:     prev.Nonce(),
+			To:        prev.To(),
+			GasTipCap: tip,
+			GasFeeCap: feeCap,
+			Gas:       prev.Gas(),
+			Data:      prev.Data(),
+		})
+	}
+	if err != nil {
+		p.m.log.Error("Failed to sign replacement transaction", "tx", prev.Hash(), "err", err)
+		return
+	}
+	if err := p.m.sendTx(ctx, tx); err != nil {
+		// If the nonce is too low, one of the previous transactions was just included.
+		p.m.log.Warn("Failed to send replacement transaction", "tx", prev.Hash(), "replacement", tx.Hash(), "err", err)
+		return
+	}
+	p.mu.Lock()
+	p.txs = append(p.txs, tx)
+	p.mu.Unlock()
+	p.m.log.Info("Replaced stuck transaction", "tx", prev.Hash(), "replacement", tx.Hash(), "nonce", tx.Nonce(),
+		"tip", tip, "fee_cap", feeCap)
+}
+
+// fee returns the fee paid for the included transaction of the receipt: the gas used times the effective gas price,
+// which is the basefee of the including block plus the tip, up to the fee cap.
+// The fee of a blob transaction includes the blob gas times the blob gas price.
+func (p *PendingTx) fee(ctx context.Context, receipt *types.Receipt) (*big.Int, error) {
+	var tx Tx
+	for _, sent := range p.Sent() {
+		if sent.Hash() == receipt.TxHash {
+			tx = sent
+		}
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("receipt of unknown transaction %s", receipt.TxHash)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.m.cfg.NetworkTimeout)
+	defer cancel()
+	header, err := p.m.client.HeaderByNumber(ctx, receipt.BlockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch L1 block %d: %w", receipt.BlockNumber, err)
+	}
+	if header.BaseFee == nil {
+		return nil, fmt.Errorf("L1 block %d has no basefee", header.Number)
+	}
+	price := new(big.Int).Add(header.BaseFee, tx.GasTipCap())
+	if price.Cmp(tx.GasFeeCap()) > 0 {
+		price = tx.GasFeeCap()
+	}
+	fee := new(big.Int).Mul(price, new(big.Int).SetUint64(receipt.GasUsed))
+	if blobTx, ok := tx.(*BlobTx); ok {
+		blobPrice, err := p.m.client.BlobGasPrice(ctx, receipt.TxHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the blob gas price of transaction %s: %w", receipt.TxHash, err)
+		}
+		fee.Add(fee, blobPrice.Mul(blobPrice, new(big.Int).SetUint64(blobTx.BlobGas())))
+	}
+	return fee, nil
+}
+
+// rebroadcast sends the latest transaction again, after the L1 block that included it was reorged out.
+// The resubmission timeout restarts, so the transaction is replaced if it is not included again in time.
+func (p *PendingTx) rebroadcast(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.m.cfg.NetworkTimeout)
+	defer cancel()
+	p.sentAt = time.Now()
+	tx := p.Tx()
+	if err := p.m.sendTx(ctx, tx); err != nil {
+		// The L1 node may have put the transaction back in its transaction pool already.
+		p.m.log.Debug("Failed to rebroadcast transaction", "tx", tx.Hash(), "nonce", tx.Nonce(), "err", err)
+		return
+	}
+	p.m.log.Info("Rebroadcast transaction", "tx", tx.Hash(), "nonce", tx.Nonce())
+}
+
+// bumpFees returns the fees of a replacement transaction: the suggested fees, but at least the previous fees
+// increased by the given percentage, with the fee cap limited to the max gas price, if not nil.
+// It returns false if the fee cap cannot be bumped without exceeding the max gas price.
+func bumpFees(prevTip, prevFeeCap, tip, feeCap *big.Int, percent uint64, maxGasPrice *big.Int) (*big.Int, *big.Int, bool) {
+	bump := func(v *big.Int) *big.Int {
+		out := new(big.Int).Mul(v, new(big.Int).SetUint64(100+percent))
+		out.Div(out, big.NewInt(100))
+		return out.Add(out, common.Big1) // round up
+	}
+	newTip, newFeeCap := bump(prevTip), bump(prevFeeCap)
+	if tip.Cmp(newTip) > 0 {
+		newTip = new(big.Int).Set(tip)
+	}
+	if feeCap.Cmp(newFeeCap) > 0 {
+		newFeeCap = new(big.Int).Set(feeCap)
+	}
+	if maxGasPrice != nil && newFeeCap.Cmp(maxGasPrice) > 0 {
+		newFeeCap = new(big.Int).Set(maxGasPrice)
+		if newFeeCap.Cmp(bump(prevFeeCap)) < 0 {
+			return nil, nil, false
+		}
+	}
+	if newTip.Cmp(newFeeCap) > 0 {
+		newTip = new(big.Int).Set(newFeeCap)
+		if newTip.Cmp(bump(prevTip)) < 0 {
+			return nil, nil, false
+		}
+	}
+	return newTip, newFeeCap, true
+}
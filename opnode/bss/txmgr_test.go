@@ -0,0 +1,299 @@
+package bss
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeL1 is a TxManagerClient that includes the transactions that pay at least the minimum tip.
+type fakeL1 struct {
+	mu  sync.Mutex
+	tip *big.Int
+	// baseFees are the basefees of the L1 blocks, the last one is the head
+	baseFees []int64
+	nonce    uint64
+	minTip   *big.Int
+	// blobBaseFee is the blob basefee of the next block, and the blob gas price of the included blob transactions
+	blobBaseFee int64
+	sent        []Tx
+	failing     error
+	// reorgedOut are the sent transactions that are not included anymore, until they are sent again
+	reorgedOut map[common.Hash]bool
+	// blockHash is the hash of the L1 block that includes the transactions
+	blockHash common.Hash
+	// receiptNumber is the number of the L1 block that includes the transactions, the head if nil
+	receiptNumber *big.Int
+}
+
+func (f *fakeL1) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tip, nil
+}
+
+func (f *fakeL1) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := uint64(len(f.baseFees) - 1)
+	if number != nil {
+		n = number.Uint64()
+	}
+	return &types.Header{Number: new(big.Int).SetUint64(n), BaseFee: big.NewInt(f.baseFees[n])}, nil
+}
+
+func (f *fakeL1) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.nonce, nil
+}
+
+func (f *fakeL1) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return f.send(tx)
+}
+
+func (f *fakeL1) SendRawTransaction(ctx context.Context, raw []byte) error {
+	tx, err := decodeBlobTx(raw)
+	if err != nil {
+		return err
+	}
+	return f.send(tx)
+}
+
+func (f *fakeL1) BlobBaseFee(ctx context.Context) (*big.Int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return big.NewInt(f.blobBaseFee), nil
+}
+
+func (f *fakeL1) BlobGasPrice(ctx context.Context, txHash common.Hash) (*big.Int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return big.NewInt(f.blobBaseFee), nil
+}
+
+func (f *fakeL1) send(tx Tx) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failing != nil {
+		return f.failing
+	}
+	f.sent = append(f.sent, tx)
+	delete(f.reorgedOut, tx.Hash())
+	if tx.Nonce() >= f.nonce {
+		f.nonce = tx.Nonce() + 1
+	}
+	return nil
+}
+
+func (f *fakeL1) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, tx := range f.sent {
+		if tx.Hash() == txHash && !f.reorgedOut[txHash] && (f.minTip == nil || tx.GasTipCap().Cmp(f.minTip) >= 0) {
+			number := f.receiptNumber
+			if number == nil {
+				number = big.NewInt(int64(len(f.baseFees) - 1))
+			}
+			return &types.Receipt{
+				TxHash:      txHash,
+				Status:      types.ReceiptStatusSuccessful,
+				BlockHash:   f.blockHash,
+				BlockNumber: number,
+				GasUsed:     tx.Gas(),
+			}, nil
+		}
+	}
+	return nil, ethereum.NotFound
+}
+
+func (f *fakeL1) setMinTip(v int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.minTip = big.NewInt(v)
+}
+
+// reorgOut drops the transaction from L1, and includes the transactions that are sent again in a new block.
+func (f *fakeL1) reorgOut(txHash common.Hash, newBlock common.Hash) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reorgedOut == nil {
+		f.reorgedOut = make(map[common.Hash]bool)
+	}
+	f.reorgedOut[txHash] = true
+	f.blockHash = newBlock
+}
+
+func newTestTxManager(t *testing.T, cfg TxManagerConfig, l1 *fakeL1) *TxManager {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	return NewTxManager(cfg, l1, big.NewInt(900), NewLocalSigner(key), testlog.Logger(t, log.LvlError))
+}
+
+func TestTxManagerNonces(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(1), baseFees: []int64{4}, nonce: 5}
+	m := newTestTxManager(t, TxManagerConfig{ReceiptQueryInterval: time.Millisecond}, l1)
+	ctx := context.Background()
+
+	a, err := m.Send(ctx, common.Address{1}, []byte{1})
+	require.NoError(t, err)
+	b, err := m.Send(ctx, common.Address{1}, []byte{2})
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), a.Tx().Nonce())
+	require.Equal(t, uint64(6), b.Tx().Nonce(), "nonces are tracked locally")
+
+	l1.failing = errors.New("nonce too low")
+	_, err = m.Send(ctx, common.Address{1}, []byte{3})
+	require.Error(t, err)
+	l1.failing = nil
+	l1.nonce = 9 // transactions sent by another process
+	c, err := m.Send(ctx, common.Address{1}, []byte{4})
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), c.Tx().Nonce(), "nonce is fetched again after a failure")
+
+	receipt, err := c.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, c.Tx().Hash(), receipt.TxHash)
+
+	// a transaction that times out may be dropped from the transaction pool, and leave a nonce gap
+	l1.minTip = big.NewInt(1000)
+	d, err := m.Send(ctx, common.Address{1}, []byte{5})
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), d.Tx().Nonce())
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = d.Wait(waitCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	l1.mu.Lock()
+	l1.nonce = 10
+	l1.minTip = nil
+	l1.mu.Unlock()
+	e, err := m.Send(ctx, common.Address{1}, []byte{6})
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), e.Tx().Nonce(), "nonce is fetched again after an abandoned transaction")
+}
+
+func TestTxManagerReplacement(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(100), baseFees: []int64{450}}
+	l1.setMinTip(130) // the initial tip is not enough, two replacements are
+	m := newTestTxManager(t, TxManagerConfig{
+		ResubmissionTimeout:  5 * time.Millisecond,
+		ReceiptQueryInterval: time.Millisecond,
+		FeeBumpPercent:       15,
+	}, l1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.Send(ctx, common.Address{1}, []byte{1})
+	require.NoError(t, err)
+	receipt, err := tx.Wait(ctx)
+	require.NoError(t, err)
+	require.Len(t, l1.sent, 3)
+	require.Equal(t, l1.sent[2].Hash(), receipt.TxHash)
+	for _, sent := range l1.sent {
+		require.Equal(t, uint64(0), sent.Nonce(), "replacements have the same nonce")
+		require.Equal(t, []byte{1}, sent.Data())
+	}
+	require.Equal(t, big.NewInt(116), l1.sent[1].GasTipCap())
+	require.Equal(t, big.NewInt(1151), l1.sent[1].GasFeeCap())
+	require.Equal(t, big.NewInt(134), l1.sent[2].GasTipCap())
+}
+
+func TestTxManagerMaxGasPrice(t *testing.T) {
+	l1 := &fakeL1{tip: big.NewInt(100), baseFees: []int64{450}}
+	l1.setMinTip(1000) // never included
+	m := newTestTxManager(t, TxManagerConfig{
+		ResubmissionTimeout:  time.Millisecond,
+		ReceiptQueryInterval: time.Millisecond,
+		MaxGasPrice:          big.NewInt(1300),
+	}, l1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	tx, err := m.Send(ctx, common.Address{1}, []byte{1})
+	require.NoError(t, err)
+	_, err = tx.Wait(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, l1.sent, 3, "replaced while the bumped fees are below the max gas price")
+	require.Equal(t, big.NewInt(1212), l1.sent[2].GasFeeCap())
+}
+
+func TestBumpFees(t *testing.T) {
+	tip, feeCap, ok := bumpFees(big.NewInt(100), big.NewInt(1000), big.NewInt(50), big.NewInt(500), 10, nil)
+	require.True(t, ok)
+	require.Equal(t, big.NewInt(111), tip)
+	require.Equal(t, big.NewInt(1101), feeCap)
+
+	tip, feeCap, ok = bumpFees(big.NewInt(100), big.NewInt(1000), big.NewInt(200), big.NewInt(3000), 10, nil)
+	require.True(t, ok)
+	require.Equal(t, big.NewInt(200), tip, "suggested fees if higher")
+	require.Equal(t, big.NewInt(3000), feeCap)
+
+	_, feeCap, ok = bumpFees(big.NewInt(100), big.NewInt(1000), big.NewInt(200), big.NewInt(3000), 10, big.NewInt(2000))
+	require.True(t, ok)
+	require.Equal(t, big.NewInt(2000), feeCap, "limited to the max gas price")
+
+	_, _, ok = bumpFees(big.NewInt(100), big.NewInt(1000), big.NewInt(200), big.NewInt(3000), 10, big.NewInt(1050))
+	require.False(t, ok, "max gas price is below the minimum bump")
+}
+
+// cannedRPC answers each method with a canned JSON result, and records the calls.
+type cannedRPC struct {
+	results map[string]string
+	calls   []string
+}
+
+func (c *cannedRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	enc, _ := json.Marshal(args)
+	c.calls = append(c.calls, method+string(enc))
+	res, ok := c.results[method]
+	if !ok {
+		return errors.New("unexpected method " + method)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal([]byte(res), result)
+}
+
+func TestL1Client(t *testing.T) {
+	rpc := &cannedRPC{results: map[string]string{
+		"eth_maxPriorityFeePerGas":  `"0x2a"`,
+		"eth_getTransactionCount":   `"0x7"`,
+		"eth_getBlockByNumber":      `null`,
+		"eth_getTransactionReceipt": `null`,
+		"eth_sendRawTransaction":    `"0x01"`,
+	}}
+	c := NewL1Client(rpc)
+	ctx := context.Background()
+
+	tip, err := c.SuggestGasTipCap(ctx)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(42), tip)
+	nonce, err := c.PendingNonceAt(ctx, common.Address{1})
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), nonce)
+	_, err = c.HeaderByNumber(ctx, big.NewInt(5))
+	require.ErrorIs(t, err, ethereum.NotFound)
+	_, err = c.TransactionReceipt(ctx, common.Hash{1})
+	require.ErrorIs(t, err, ethereum.NotFound)
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(1), Nonce: 7})
+	require.NoError(t, c.SendTransaction(ctx, tx))
+	raw, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, `eth_sendRawTransaction["`+hexutil.Encode(raw)+`"]`, rpc.calls[len(rpc.calls)-1])
+	require.Equal(t, `eth_getBlockByNumber["0x5",false]`, rpc.calls[2])
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/urfave/cli"
+)
+
+var DecodeBatchesCommand = cli.Command{
+	Name:      "decode-batches",
+	Usage:     "Decode the batches of a batch submission transaction, or of raw batch data, and print them as JSON",
+	ArgsUsage: "<L1 tx hash | 0x-prefixed batch data>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "l1",
+			Usage: "Address of L1 User JSON-RPC endpoint to fetch the transaction from",
+			Value: "http://127.0.0.1:8545",
+		},
+		cli.StringFlag{
+			Name:  "rollup.config",
+			Usage: "Rollup chain parameters, required to decode span batches",
+		},
+		cli.BoolFlag{
+			Name:  "data",
+			Usage: "Interpret the argument as raw batch data instead of a transaction hash",
+		},
+	},
+	Action: DecodeBatches,
+}
+
+type decodedBatchTx struct {
+	TxHash *common.Hash    `json:"tx_hash,omitempty"`
+	From   *common.Address `json:"from,omitempty"`
+	To     *common.Address `json:"to,omitempty"`
+	*derive.DecodedBatchData
+}
+
+// DecodeBatches prints the decoded batches of the batch data of a L1 transaction, or of the given batch data.
+func DecodeBatches(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("expected a single L1 transaction hash or batch data argument")
+	}
+	arg := ctx.Args().First()
+
+	config := &rollup.Config{}
+	if path := ctx.String("rollup.config"); path != "" {
+		var err error
+		if config, err = opnode.LoadRollupConfig(path); err != nil {
+			return err
+		}
+	}
+
+	var out decodedBatchTx
+	var data []byte
+	if ctx.Bool("data") {
+		var err error
+		if data, err = hexutil.Decode(arg); err != nil {
+			return fmt.Errorf("invalid batch data: %w", err)
+		}
+	} else {
+		var txHash common.Hash
+		if err := txHash.UnmarshalText([]byte(arg)); err != nil {
+			return fmt.Errorf("invalid transaction hash: %w", err)
+		}
+		tx, err := fetchTransaction(ctx.String("l1"), txHash)
+		if err != nil {
+			return err
+		}
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			return fmt.Errorf("failed to recover the sender of the transaction: %w", err)
+		}
+		out.TxHash, out.From, out.To = &txHash, &from, tx.To()
+		data = tx.Data()
+	}
+
+	decoded, err := derive.DecodeBatchData(config, data)
+	if err != nil {
+		return err
+	}
+	out.DecodedBatchData = decoded
+	enc := json.NewEncoder(ctx.App.Writer)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func fetchTransaction(l1Addr string, txHash common.Hash) (*types.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cl, err := ethclient.DialContext(ctx, l1Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial L1 address (%s): %w", l1Addr, err)
+	}
+	defer cl.Close()
+	tx, _, err := cl.TransactionByHash(ctx, txHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction %s: %w", txHash, err)
+	}
+	return tx, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/genesis"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/urfave/cli"
+)
+
+var GenesisCommand = cli.Command{
+	Name:  "genesis",
+	Usage: "Compute the genesis of a new rollup chain from L1, and write its rollup config and L2 genesis",
+	Description: "The rollup config template holds the parameters and the system contract addresses of the new chain, " +
+		"the genesis and the L1 chain ID are filled in from the L1 start block. " +
+		"The L2 genesis template is a geth genesis, which starts at the time of the L1 start block.",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "l1",
+			Usage: "Address of L1 User JSON-RPC endpoint to fetch the L1 start block and the system contracts from",
+			Value: "http://127.0.0.1:8545",
+		},
+		cli.Uint64Flag{
+			Name:  "l1.start-block",
+			Usage: "Number of the L1 block that the rollup starts after, the latest L1 block if not set",
+		},
+		cli.StringFlag{
+			Name:  "rollup.template",
+			Usage: "Rollup config without the genesis and the L1 chain ID",
+		},
+		cli.StringFlag{
+			Name:  "l2.template",
+			Usage: "L2 genesis to start the L2 chain from",
+		},
+		cli.StringFlag{
+			Name:  "outfile.rollup",
+			Usage: "File to write the rollup config to",
+			Value: "rollup.json",
+		},
+		cli.StringFlag{
+			Name:  "outfile.l2",
+			Usage: "File to write the L2 genesis to",
+			Value: "genesis-l2.json",
+		},
+	},
+	Action: Genesis,
+}
+
+// Genesis computes the genesis of a new rollup chain, and writes the rollup config and the L2 genesis.
+func Genesis(ctx *cli.Context) error {
+	for _, name := range []string{"rollup.template", "l2.template"} {
+		if ctx.String(name) == "" {
+			return fmt.Errorf("--%s is required", name)
+		}
+	}
+	var template rollup.Config
+	if err := readStrictJSON(ctx.String("rollup.template"), &template); err != nil {
+		return fmt.Errorf("rollup config template: %w", err)
+	}
+	var l2Template core.Genesis
+	if err := readStrictJSON(ctx.String("l2.template"), &l2Template); err != nil {
+		return fmt.Errorf("L2 genesis template: %w", err)
+	}
+	var l1Start *big.Int
+	if ctx.IsSet("l1.start-block") {
+		l1Start = new(big.Int).SetUint64(ctx.Uint64("l1.start-block"))
+	} else {
+		log.Warn("Starting the rollup after the latest L1 block, which may be reorged out, set an L1 start block to avoid this")
+	}
+
+	rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	l1, err := ethclient.DialContext(rctx, ctx.String("l1"))
+	if err != nil {
+		return fmt.Errorf("failed to dial L1 address (%s): %w", ctx.String("l1"), err)
+	}
+	defer l1.Close()
+	cfg, l2Genesis, err := genesis.Build(rctx, l1, l1Start, &template, &l2Template)
+	if err != nil {
+		return err
+	}
+
+	if err := writeJSON(ctx.String("outfile.rollup"), cfg); err != nil {
+		return err
+	}
+	if err := writeJSON(ctx.String("outfile.l2"), l2Genesis); err != nil {
+		return err
+	}
+	log.Info("Wrote the rollup genesis", "l1", cfg.Genesis.L1, "l2", cfg.Genesis.L2, "l2_time", cfg.Genesis.L2Time,
+		"rollup_config", ctx.String("outfile.rollup"), "l2_genesis", ctx.String("outfile.l2"))
+	return nil
+}
+
+// readStrictJSON decodes the JSON file into out, rejecting unknown fields.
+func readStrictJSON(path string, out interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
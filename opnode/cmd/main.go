@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,6 +11,7 @@ import (
 	"github.com/ethereum-optimism/optimistic-specs/opnode/flags"
 
 	"github.com/ethereum-optimism/optimistic-specs/opnode/node"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/urfave/cli"
 )
@@ -22,19 +24,7 @@ var (
 )
 
 // VersionWithMeta holds the textual version string including the metadata.
-var VersionWithMeta = func() string {
-	v := Version
-	if GitCommit != "" {
-		v += "-" + GitCommit[:8]
-	}
-	if GitDate != "" {
-		v += "-" + GitDate
-	}
-	if VersionMeta != "" {
-		v += "-" + VersionMeta
-	}
-	return v
-}()
+var VersionWithMeta = node.VersionInfo{Version: Version, GitCommit: GitCommit, GitDate: GitDate, Meta: VersionMeta}.String()
 
 func main() {
 	// Set up logger with a default INFO level in case we fail to parse flags,
@@ -46,6 +36,18 @@ func main() {
 		),
 	)
 
+	// Commands run without the flags of the rollup node, which the node app requires, so they run in their own app.
+	if len(os.Args) > 1 && (os.Args[1] == DecodeBatchesCommand.Name || os.Args[1] == GenesisCommand.Name) {
+		tools := cli.NewApp()
+		tools.Name = "opnode"
+		tools.Version = VersionWithMeta
+		tools.Commands = []cli.Command{DecodeBatchesCommand, GenesisCommand}
+		if err := tools.Run(os.Args); err != nil {
+			log.Crit("Command failed", "message", err)
+		}
+		return
+	}
+
 	app := cli.NewApp()
 	app.Flags = flags.Flags
 	app.Version = VersionWithMeta
@@ -54,6 +56,7 @@ func main() {
 	app.Description = "The deposit only rollup node drives the L2 execution engine based on L1 deposits."
 
 	app.Action = RollupNodeMain
+	app.Commands = []cli.Command{DecodeBatchesCommand, GenesisCommand} // listed in the help, dispatched above
 	err := app.Run(os.Args)
 	if err != nil {
 		log.Crit("Application failed", "message", err)
@@ -73,7 +76,18 @@ func RollupNodeMain(ctx *cli.Context) error {
 		return err
 	}
 
-	n, err := node.New(context.Background(), cfg, logCfg.NewLogger(), VersionWithMeta)
+	snapshotLog, err := opnode.NewSnapshotLogger(ctx)
+	if err != nil {
+		log.Error("Unable to create snapshot root logger", "error", err)
+		return err
+	}
+
+	if ctx.GlobalIsSet(flags.VerifyFromFlag.Name) {
+		return VerifyChain(ctx, cfg, logCfg.NewLogger())
+	}
+
+	version := node.VersionInfo{Version: Version, GitCommit: GitCommit, GitDate: GitDate, Meta: VersionMeta, Features: cfg.Features()}
+	n, err := node.New(context.Background(), cfg, logCfg.NewLogger(), snapshotLog, version)
 	if err != nil {
 		log.Error("Unable to create the rollup node", "error", err)
 		return err
@@ -100,3 +114,20 @@ func RollupNodeMain(ctx *cli.Context) error {
 	return nil
 
 }
+
+// VerifyChain re-derives the L2 chain from L1, and reports the first block of the engine that does not match.
+func VerifyChain(ctx *cli.Context, cfg *node.Config, logger log.Logger) error {
+	fromL1 := ctx.GlobalUint64(flags.VerifyFromFlag.Name)
+	verified, err := node.Verify(context.Background(), cfg, logger, fromL1)
+	var divergence *driver.DivergenceError
+	if errors.As(err, &divergence) {
+		logger.Error("L2 chain diverges from L1", "parent", divergence.Parent, "block", divergence.Block,
+			"epoch", divergence.Epoch, "reason", divergence.Reason)
+		return err
+	} else if err != nil {
+		logger.Error("Unable to verify the L2 chain", "verified", verified, "error", err)
+		return err
+	}
+	logger.Info("L2 chain matches L1", "from_l1", fromL1, "verified", verified)
+	return nil
+}
@@ -0,0 +1,55 @@
+package contracts
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/contracts/deposit"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/contracts/l1block"
+	"github.com/stretchr/testify/require"
+)
+
+type artifact struct {
+	Bytecode         string `json:"bytecode"`
+	DeployedBytecode string `json:"deployedBytecode"`
+}
+
+func readArtifact(t *testing.T, path string) (artifact, bool) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return artifact{}, false
+	}
+	require.NoError(t, err)
+	var a artifact
+	require.NoError(t, json.Unmarshal(data, &a))
+	return a, true
+}
+
+// TestBindingsMatchArtifacts checks that the bindings are the compiler output of the current contracts,
+// i.e. that they were regenerated with `make` after the contracts changed.
+// It requires `yarn build` to have run in the contracts directory, and is skipped otherwise.
+func TestBindingsMatchArtifacts(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		abi      string
+		deployed string
+	}{
+		{"L1/DepositFeed.sol/DepositFeed.json", "abis/DepositFeed.json", deposit.DepositDeployedBin},
+		{"L2/L1Block.sol/L1Block.json", "abis/L1Block.json", l1block.L1blockDeployedBin},
+	} {
+		t.Run(filepath.Base(c.name), func(t *testing.T) {
+			built, ok := readArtifact(t, filepath.Join("../../packages/contracts/artifacts/contracts", c.name))
+			if !ok {
+				t.Skip("contracts are not built")
+			}
+			committed, ok := readArtifact(t, c.abi)
+			require.True(t, ok)
+			require.Equal(t, built.Bytecode, committed.Bytecode, "bytecode of %s", c.abi)
+			require.Equal(t, built.DeployedBytecode, committed.DeployedBytecode, "deployed bytecode of %s", c.abi)
+			require.Equal(t, built.DeployedBytecode, c.deployed, "deployed bytecode of the binding")
+		})
+	}
+}
@@ -2,4 +2,4 @@
 // This file is a generated binding and any manual changes will be lost.
 package l1block
 
-var L1blockDeployedBin = "0x608060405234801561001057600080fd5b50600436106100625760003560e01c806309bd5a60146100675780635cf24969146100855780638381f58a146100a3578063b80777ea146100c1578063c03ba43e146100df578063e591b282146100fb575b600080fd5b61006f610119565b60405161007c91906101fd565b60405180910390f35b61008d61011f565b60405161009a9190610231565b60405180910390f35b6100ab610125565b6040516100b89190610231565b60405180910390f35b6100c961012b565b6040516100d69190610231565b60405180910390f35b6100f960048036038101906100f491906102a9565b610131565b005b6101036101cc565b6040516101109190610351565b60405180910390f35b60035481565b60025481565b60005481565b60015481565b73deaddeaddeaddeaddeaddeaddeaddeaddead000173ffffffffffffffffffffffffffffffffffffffff163373ffffffffffffffffffffffffffffffffffffffff16146101aa576040517fce8c104800000000000000000000000000000000000000000000000000000000815260040160405180910390fd5b8360008190555082600181905550816002819055508060038190555050505050565b73deaddeaddeaddeaddeaddeaddeaddeaddead000181565b6000819050919050565b6101f7816101e4565b82525050565b600060208201905061021260008301846101ee565b92915050565b6000819050919050565b61022b81610218565b82525050565b60006020820190506102466000830184610222565b92915050565b600080fd5b61025a81610218565b811461026557600080fd5b50565b60008135905061027781610251565b92915050565b610286816101e4565b811461029157600080fd5b50565b6000813590506102a38161027d565b92915050565b600080600080608085870312156102c3576102c261024c565b5b60006102d187828801610268565b94505060206102e287828801610268565b93505060406102f387828801610268565b925050606061030487828801610294565b91505092959194509250565b600073ffffffffffffffffffffffffffffffffffffffff82169050919050565b600061033b82610310565b9050919050565b61034b81610330565b82525050565b60006020820190506103666000830184610342565b9291505056fea2646970667358221220cdaea4f1ee477c3fe7f1b3caa2283ad58d53d6a652006ec9e6f6bf22354b258264736f6c634300080a0033"
+var L1blockDeployedBin = "0x341561000a57600080fd5b6004361061007c5760003560e01c8063e591b2821461008157806321079f9e146101145780638381f58a1461009f578063b80777ea146100b55780635cf24969146100ce57806309bd5a60146100da57806364ca23ef146100e65780638b239f73146100fc5780639e8c496614610108575b600080fd5b73deaddeaddeaddeaddeaddeaddeaddeaddead000160005260206000f35b60005467ffffffffffffffff1660005260206000f35b60005460401c67ffffffffffffffff1660005260206000f35b60015460005260206000f35b60025460005260206000f35b60035467ffffffffffffffff1660005260206000f35b60045460005260206000f35b60055460005260206000f35b3373deaddeaddeaddeaddeaddeaddeaddeaddead0001146101405763ce8c104860e01b60005260046000fd5b6004360360e01161007c576004358067ffffffffffffffff1681141561007c576024358067ffffffffffffffff1681141561007c5760401b176000556044356001556064356002556084358067ffffffffffffffff1681141561007c5760035560a43560045560c4356005555000"
@@ -30,8 +30,8 @@ var (
 
 // L1blockMetaData contains all meta data concerning the L1block contract.
 var L1blockMetaData = &bind.MetaData{
-	ABI: "[{\"inputs\":[],\"name\":\"OnlyDepositor\",\"type\":\"error\"},{\"inputs\":[],\"name\":\"DEPOSITOR_ACCOUNT\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"basefee\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"hash\",\"outputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"number\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"uint256\",\"name\":\"_number\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"_timestamp\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"_basefee\",\"type\":\"uint256\"},{\"internalType\":\"bytes32\",\"name\":\"_hash\",\"type\":\"bytes32\"}],\"name\":\"setL1BlockValues\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"timestamp\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"}]",
-	Bin: "0x608060405234801561001057600080fd5b506103a2806100206000396000f3fe608060405234801561001057600080fd5b50600436106100625760003560e01c806309bd5a60146100675780635cf24969146100855780638381f58a146100a3578063b80777ea146100c1578063c03ba43e146100df578063e591b282146100fb575b600080fd5b61006f610119565b60405161007c91906101fd565b60405180910390f35b61008d61011f565b60405161009a9190610231565b60405180910390f35b6100ab610125565b6040516100b89190610231565b60405180910390f35b6100c961012b565b6040516100d69190610231565b60405180910390f35b6100f960048036038101906100f491906102a9565b610131565b005b6101036101cc565b6040516101109190610351565b60405180910390f35b60035481565b60025481565b60005481565b60015481565b73deaddeaddeaddeaddeaddeaddeaddeaddead000173ffffffffffffffffffffffffffffffffffffffff163373ffffffffffffffffffffffffffffffffffffffff16146101aa576040517fce8c104800000000000000000000000000000000000000000000000000000000815260040160405180910390fd5b8360008190555082600181905550816002819055508060038190555050505050565b73deaddeaddeaddeaddeaddeaddeaddeaddead000181565b6000819050919050565b6101f7816101e4565b82525050565b600060208201905061021260008301846101ee565b92915050565b6000819050919050565b61022b81610218565b82525050565b60006020820190506102466000830184610222565b92915050565b600080fd5b61025a81610218565b811461026557600080fd5b50565b60008135905061027781610251565b92915050565b610286816101e4565b811461029157600080fd5b50565b6000813590506102a38161027d565b92915050565b600080600080608085870312156102c3576102c261024c565b5b60006102d187828801610268565b94505060206102e287828801610268565b93505060406102f387828801610268565b925050606061030487828801610294565b91505092959194509250565b600073ffffffffffffffffffffffffffffffffffffffff82169050919050565b600061033b82610310565b9050919050565b61034b81610330565b82525050565b60006020820190506103666000830184610342565b9291505056fea2646970667358221220cdaea4f1ee477c3fe7f1b3caa2283ad58d53d6a652006ec9e6f6bf22354b258264736f6c634300080a0033",
+	ABI: "[{\"inputs\":[],\"name\":\"OnlyDepositor\",\"type\":\"error\"},{\"inputs\":[],\"name\":\"DEPOSITOR_ACCOUNT\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"basefee\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"hash\",\"outputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"l1FeeOverhead\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"l1FeeScalar\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"number\",\"outputs\":[{\"internalType\":\"uint64\",\"name\":\"\",\"type\":\"uint64\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"sequenceNumber\",\"outputs\":[{\"internalType\":\"uint64\",\"name\":\"\",\"type\":\"uint64\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"uint64\",\"name\":\"_number\",\"type\":\"uint64\"},{\"internalType\":\"uint64\",\"name\":\"_timestamp\",\"type\":\"uint64\"},{\"internalType\":\"uint256\",\"name\":\"_basefee\",\"type\":\"uint256\"},{\"internalType\":\"bytes32\",\"name\":\"_hash\",\"type\":\"bytes32\"},{\"internalType\":\"uint64\",\"name\":\"_sequenceNumber\",\"type\":\"uint64\"},{\"internalType\":\"uint256\",\"name\":\"_l1FeeOverhead\",\"type\":\"uint256\"},{\"internalType\":\"uint256\",\"name\":\"_l1FeeScalar\",\"type\":\"uint256\"}],\"name\":\"setL1BlockValues\",\"outputs\":[],\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"timestamp\",\"outputs\":[{\"internalType\":\"uint64\",\"name\":\"\",\"type\":\"uint64\"}],\"stateMutability\":\"view\",\"type\":\"function\"}]",
+	Bin: "0x341561000a57600080fd5b6101af806100196000396000f3fe341561000a57600080fd5b6004361061007c5760003560e01c8063e591b2821461008157806321079f9e146101145780638381f58a1461009f578063b80777ea146100b55780635cf24969146100ce57806309bd5a60146100da57806364ca23ef146100e65780638b239f73146100fc5780639e8c496614610108575b600080fd5b73deaddeaddeaddeaddeaddeaddeaddeaddead000160005260206000f35b60005467ffffffffffffffff1660005260206000f35b60005460401c67ffffffffffffffff1660005260206000f35b60015460005260206000f35b60025460005260206000f35b60035467ffffffffffffffff1660005260206000f35b60045460005260206000f35b60055460005260206000f35b3373deaddeaddeaddeaddeaddeaddeaddeaddead0001146101405763ce8c104860e01b60005260046000fd5b6004360360e01161007c576004358067ffffffffffffffff1681141561007c576024358067ffffffffffffffff1681141561007c5760401b176000556044356001556064356002556084358067ffffffffffffffff1681141561007c5760035560a43560045560c4356005555000",
 }
 
 // L1blockABI is the input ABI used to generate the binding from.
@@ -294,12 +294,43 @@ func (_L1block *L1blockCallerSession) Hash() ([32]byte, error) {
 	return _L1block.Contract.Hash(&_L1block.CallOpts)
 }
 
-// Number is a free data retrieval call binding the contract method 0x8381f58a.
+// L1FeeOverhead is a free data retrieval call binding the contract method 0x8b239f73.
 //
-// Solidity: function number() view returns(uint256)
-func (_L1block *L1blockCaller) Number(opts *bind.CallOpts) (*big.Int, error) {
+// Solidity: function l1FeeOverhead() view returns(uint256)
+func (_L1block *L1blockCaller) L1FeeOverhead(opts *bind.CallOpts) (*big.Int, error) {
 	var out []interface{}
-	err := _L1block.contract.Call(opts, &out, "number")
+	err := _L1block.contract.Call(opts, &out, "l1FeeOverhead")
+
+	if err != nil {
+		return *new(*big.Int), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+	return out0, err
+
+}
+
+// L1FeeOverhead is a free data retrieval call binding the contract method 0x8b239f73.
+//
+// Solidity: function l1FeeOverhead() view returns(uint256)
+func (_L1block *L1blockSession) L1FeeOverhead() (*big.Int, error) {
+	return _L1block.Contract.L1FeeOverhead(&_L1block.CallOpts)
+}
+
+// L1FeeOverhead is a free data retrieval call binding the contract method 0x8b239f73.
+//
+// Solidity: function l1FeeOverhead() view returns(uint256)
+func (_L1block *L1blockCallerSession) L1FeeOverhead() (*big.Int, error) {
+	return _L1block.Contract.L1FeeOverhead(&_L1block.CallOpts)
+}
+
+// L1FeeScalar is a free data retrieval call binding the contract method 0x9e8c4966.
+//
+// Solidity: function l1FeeScalar() view returns(uint256)
+func (_L1block *L1blockCaller) L1FeeScalar(opts *bind.CallOpts) (*big.Int, error) {
+	var out []interface{}
+	err := _L1block.contract.Call(opts, &out, "l1FeeScalar")
 
 	if err != nil {
 		return *new(*big.Int), err
@@ -311,32 +342,94 @@ func (_L1block *L1blockCaller) Number(opts *bind.CallOpts) (*big.Int, error) {
 
 }
 
+// L1FeeScalar is a free data retrieval call binding the contract method 0x9e8c4966.
+//
+// Solidity: function l1FeeScalar() view returns(uint256)
+func (_L1block *L1blockSession) L1FeeScalar() (*big.Int, error) {
+	return _L1block.Contract.L1FeeScalar(&_L1block.CallOpts)
+}
+
+// L1FeeScalar is a free data retrieval call binding the contract method 0x9e8c4966.
+//
+// Solidity: function l1FeeScalar() view returns(uint256)
+func (_L1block *L1blockCallerSession) L1FeeScalar() (*big.Int, error) {
+	return _L1block.Contract.L1FeeScalar(&_L1block.CallOpts)
+}
+
 // Number is a free data retrieval call binding the contract method 0x8381f58a.
 //
-// Solidity: function number() view returns(uint256)
-func (_L1block *L1blockSession) Number() (*big.Int, error) {
+// Solidity: function number() view returns(uint64)
+func (_L1block *L1blockCaller) Number(opts *bind.CallOpts) (uint64, error) {
+	var out []interface{}
+	err := _L1block.contract.Call(opts, &out, "number")
+
+	if err != nil {
+		return *new(uint64), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(uint64)).(*uint64)
+
+	return out0, err
+
+}
+
+// Number is a free data retrieval call binding the contract method 0x8381f58a.
+//
+// Solidity: function number() view returns(uint64)
+func (_L1block *L1blockSession) Number() (uint64, error) {
 	return _L1block.Contract.Number(&_L1block.CallOpts)
 }
 
 // Number is a free data retrieval call binding the contract method 0x8381f58a.
 //
-// Solidity: function number() view returns(uint256)
-func (_L1block *L1blockCallerSession) Number() (*big.Int, error) {
+// Solidity: function number() view returns(uint64)
+func (_L1block *L1blockCallerSession) Number() (uint64, error) {
 	return _L1block.Contract.Number(&_L1block.CallOpts)
 }
 
+// SequenceNumber is a free data retrieval call binding the contract method 0x64ca23ef.
+//
+// Solidity: function sequenceNumber() view returns(uint64)
+func (_L1block *L1blockCaller) SequenceNumber(opts *bind.CallOpts) (uint64, error) {
+	var out []interface{}
+	err := _L1block.contract.Call(opts, &out, "sequenceNumber")
+
+	if err != nil {
+		return *new(uint64), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(uint64)).(*uint64)
+
+	return out0, err
+
+}
+
+// SequenceNumber is a free data retrieval call binding the contract method 0x64ca23ef.
+//
+// Solidity: function sequenceNumber() view returns(uint64)
+func (_L1block *L1blockSession) SequenceNumber() (uint64, error) {
+	return _L1block.Contract.SequenceNumber(&_L1block.CallOpts)
+}
+
+// SequenceNumber is a free data retrieval call binding the contract method 0x64ca23ef.
+//
+// Solidity: function sequenceNumber() view returns(uint64)
+func (_L1block *L1blockCallerSession) SequenceNumber() (uint64, error) {
+	return _L1block.Contract.SequenceNumber(&_L1block.CallOpts)
+}
+
 // Timestamp is a free data retrieval call binding the contract method 0xb80777ea.
 //
-// Solidity: function timestamp() view returns(uint256)
-func (_L1block *L1blockCaller) Timestamp(opts *bind.CallOpts) (*big.Int, error) {
+// Solidity: function timestamp() view returns(uint64)
+func (_L1block *L1blockCaller) Timestamp(opts *bind.CallOpts) (uint64, error) {
 	var out []interface{}
 	err := _L1block.contract.Call(opts, &out, "timestamp")
 
 	if err != nil {
-		return *new(*big.Int), err
+		return *new(uint64), err
 	}
 
-	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+	out0 := *abi.ConvertType(out[0], new(uint64)).(*uint64)
 
 	return out0, err
 
@@ -344,35 +437,35 @@ func (_L1block *L1blockCaller) Timestamp(opts *bind.CallOpts) (*big.Int, error)
 
 // Timestamp is a free data retrieval call binding the contract method 0xb80777ea.
 //
-// Solidity: function timestamp() view returns(uint256)
-func (_L1block *L1blockSession) Timestamp() (*big.Int, error) {
+// Solidity: function timestamp() view returns(uint64)
+func (_L1block *L1blockSession) Timestamp() (uint64, error) {
 	return _L1block.Contract.Timestamp(&_L1block.CallOpts)
 }
 
 // Timestamp is a free data retrieval call binding the contract method 0xb80777ea.
 //
-// Solidity: function timestamp() view returns(uint256)
-func (_L1block *L1blockCallerSession) Timestamp() (*big.Int, error) {
+// Solidity: function timestamp() view returns(uint64)
+func (_L1block *L1blockCallerSession) Timestamp() (uint64, error) {
 	return _L1block.Contract.Timestamp(&_L1block.CallOpts)
 }
 
-// SetL1BlockValues is a paid mutator transaction binding the contract method 0xc03ba43e.
+// SetL1BlockValues is a paid mutator transaction binding the contract method 0x21079f9e.
 //
-// Solidity: function setL1BlockValues(uint256 _number, uint256 _timestamp, uint256 _basefee, bytes32 _hash) returns()
-func (_L1block *L1blockTransactor) SetL1BlockValues(opts *bind.TransactOpts, _number *big.Int, _timestamp *big.Int, _basefee *big.Int, _hash [32]byte) (*types.Transaction, error) {
-	return _L1block.contract.Transact(opts, "setL1BlockValues", _number, _timestamp, _basefee, _hash)
+// Solidity: function setL1BlockValues(uint64 _number, uint64 _timestamp, uint256 _basefee, bytes32 _hash, uint64 _sequenceNumber, uint256 _l1FeeOverhead, uint256 _l1FeeScalar) returns()
+func (_L1block *L1blockTransactor) SetL1BlockValues(opts *bind.TransactOpts, _number uint64, _timestamp uint64, _basefee *big.Int, _hash [32]byte, _sequenceNumber uint64, _l1FeeOverhead *big.Int, _l1FeeScalar *big.Int) (*types.Transaction, error) {
+	return _L1block.contract.Transact(opts, "setL1BlockValues", _number, _timestamp, _basefee, _hash, _sequenceNumber, _l1FeeOverhead, _l1FeeScalar)
 }
 
-// SetL1BlockValues is a paid mutator transaction binding the contract method 0xc03ba43e.
+// SetL1BlockValues is a paid mutator transaction binding the contract method 0x21079f9e.
 //
-// Solidity: function setL1BlockValues(uint256 _number, uint256 _timestamp, uint256 _basefee, bytes32 _hash) returns()
-func (_L1block *L1blockSession) SetL1BlockValues(_number *big.Int, _timestamp *big.Int, _basefee *big.Int, _hash [32]byte) (*types.Transaction, error) {
-	return _L1block.Contract.SetL1BlockValues(&_L1block.TransactOpts, _number, _timestamp, _basefee, _hash)
+// Solidity: function setL1BlockValues(uint64 _number, uint64 _timestamp, uint256 _basefee, bytes32 _hash, uint64 _sequenceNumber, uint256 _l1FeeOverhead, uint256 _l1FeeScalar) returns()
+func (_L1block *L1blockSession) SetL1BlockValues(_number uint64, _timestamp uint64, _basefee *big.Int, _hash [32]byte, _sequenceNumber uint64, _l1FeeOverhead *big.Int, _l1FeeScalar *big.Int) (*types.Transaction, error) {
+	return _L1block.Contract.SetL1BlockValues(&_L1block.TransactOpts, _number, _timestamp, _basefee, _hash, _sequenceNumber, _l1FeeOverhead, _l1FeeScalar)
 }
 
-// SetL1BlockValues is a paid mutator transaction binding the contract method 0xc03ba43e.
+// SetL1BlockValues is a paid mutator transaction binding the contract method 0x21079f9e.
 //
-// Solidity: function setL1BlockValues(uint256 _number, uint256 _timestamp, uint256 _basefee, bytes32 _hash) returns()
-func (_L1block *L1blockTransactorSession) SetL1BlockValues(_number *big.Int, _timestamp *big.Int, _basefee *big.Int, _hash [32]byte) (*types.Transaction, error) {
-	return _L1block.Contract.SetL1BlockValues(&_L1block.TransactOpts, _number, _timestamp, _basefee, _hash)
+// Solidity: function setL1BlockValues(uint64 _number, uint64 _timestamp, uint256 _basefee, bytes32 _hash, uint64 _sequenceNumber, uint256 _l1FeeOverhead, uint256 _l1FeeScalar) returns()
+func (_L1block *L1blockTransactorSession) SetL1BlockValues(_number uint64, _timestamp uint64, _basefee *big.Int, _hash [32]byte, _sequenceNumber uint64, _l1FeeOverhead *big.Int, _l1FeeScalar *big.Int) (*types.Transaction, error) {
+	return _L1block.Contract.SetL1BlockValues(&_L1block.TransactOpts, _number, _timestamp, _basefee, _hash, _sequenceNumber, _l1FeeOverhead, _l1FeeScalar)
 }
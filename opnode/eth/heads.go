@@ -2,10 +2,14 @@ package eth
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/backoff"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
 )
 
 // HeadSignalFn is used as callback function to accept head-signals
@@ -43,3 +47,126 @@ func WatchHeadChanges(ctx context.Context, src NewHeadSource, fn HeadSignalFn) (
 		}
 	}), nil
 }
+
+// HeadSource is a source of L1 heads that can be subscribed to, and polled.
+type HeadSource interface {
+	NewHeadSource
+	L1HeadBlockRef(ctx context.Context) (L1BlockRef, error)
+	L1BlockRefByNumber(ctx context.Context, num uint64) (L1BlockRef, error)
+}
+
+const (
+	// DefaultHeadPollInterval is the interval to poll the L1 head at while the new-head subscription is down
+	DefaultHeadPollInterval = 4 * time.Second
+	// maxHeadPollGap is the maximum number of blocks that are filled in between polled heads
+	maxHeadPollGap = 32
+)
+
+// WatchHeads feeds fn with the L1 heads of src. Heads come from a new-head subscription while it is up,
+// and are polled at the poll interval (DefaultHeadPollInterval if 0) while it is down, e.g. on an HTTP endpoint.
+// The subscription is retried with exponential backoff. A head is only signaled once,
+// and the blocks that were skipped between polled heads are signaled before the head, if they are few.
+func WatchHeads(ctx context.Context, src HeadSource, pollInterval time.Duration, log log.Logger, fn HeadSignalFn) ethereum.Subscription {
+	if pollInterval == 0 {
+		pollInterval = DefaultHeadPollInterval
+	}
+	w := &headWatcher{src: src, log: log, fn: fn}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		bOff := backoff.Exponential()
+		for attempt := 0; ; attempt++ {
+			sub, err := WatchHeadChanges(ctx, src, w.signal)
+			if err == nil {
+				attempt = 0
+				log.Info("Subscribed to L1 heads")
+				select {
+				case err = <-sub.Err():
+					log.Warn("L1 head subscription failed, polling L1 heads", "err", err)
+				case <-ctx.Done():
+					sub.Unsubscribe()
+					return ctx.Err()
+				case <-quit:
+					sub.Unsubscribe()
+					return nil
+				}
+			} else if attempt == 0 {
+				log.Warn("Failed to subscribe to L1 heads, polling L1 heads", "err", err)
+			}
+
+			retry := time.NewTimer(bOff.Duration(attempt))
+			ticker := time.NewTicker(pollInterval)
+			w.poll(ctx)
+		polling:
+			for {
+				select {
+				case <-ticker.C:
+					w.poll(ctx)
+				case <-retry.C:
+					break polling
+				case <-ctx.Done():
+					ticker.Stop()
+					retry.Stop()
+					return ctx.Err()
+				case <-quit:
+					ticker.Stop()
+					retry.Stop()
+					return nil
+				}
+			}
+			ticker.Stop()
+		}
+	})
+}
+
+type headWatcher struct {
+	src HeadSource
+	log log.Logger
+	fn  HeadSignalFn
+
+	mu   sync.Mutex
+	last L1BlockRef
+}
+
+// signal calls fn with the head, unless it was the last signaled head.
+func (w *headWatcher) signal(head L1BlockRef) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if head.Hash == w.last.Hash {
+		return
+	}
+	w.last = head
+	w.fn(head)
+}
+
+func (w *headWatcher) poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	head, err := w.src.L1HeadBlockRef(ctx)
+	if err != nil {
+		w.log.Warn("Failed to poll L1 head", "err", err)
+		return
+	}
+	w.mu.Lock()
+	last := w.last
+	w.mu.Unlock()
+	// Fill in the blocks that were skipped since the last head, so the heads are linear extensions.
+	// If they do not connect, L1 reorged, and only the new head is signaled.
+	if last != (L1BlockRef{}) && head.Number > last.Number+1 && head.Number-last.Number <= maxHeadPollGap {
+		var skipped []L1BlockRef
+		parent := last
+		for n := last.Number + 1; n < head.Number; n++ {
+			ref, err := w.src.L1BlockRefByNumber(ctx, n)
+			if err != nil || ref.ParentHash != parent.Hash {
+				skipped = nil
+				break
+			}
+			skipped = append(skipped, ref)
+			parent = ref
+		}
+		if len(skipped) > 0 && head.ParentHash == parent.Hash {
+			for _, ref := range skipped {
+				w.signal(ref)
+			}
+		}
+	}
+	w.signal(head)
+}
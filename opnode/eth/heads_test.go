@@ -0,0 +1,91 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// pollOnlySource does not support subscriptions, like an HTTP endpoint, and serves the blocks of its chain
+type pollOnlySource struct {
+	mu    sync.Mutex
+	chain []L1BlockRef
+	head  uint64
+}
+
+func (s *pollOnlySource) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return nil, errors.New("notifications not supported")
+}
+
+func (s *pollOnlySource) L1HeadBlockRef(ctx context.Context) (L1BlockRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chain[s.head], nil
+}
+
+func (s *pollOnlySource) L1BlockRefByNumber(ctx context.Context, num uint64) (L1BlockRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if num > s.head {
+		return L1BlockRef{}, ethereum.NotFound
+	}
+	return s.chain[num], nil
+}
+
+func (s *pollOnlySource) setHead(n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.head = n
+}
+
+func testChain(n int) []L1BlockRef {
+	chain := make([]L1BlockRef, n)
+	for i := range chain {
+		chain[i] = L1BlockRef{Hash: common.Hash{byte(i + 1)}, Number: uint64(i)}
+		if i > 0 {
+			chain[i].ParentHash = chain[i-1].Hash
+		}
+	}
+	return chain
+}
+
+func TestWatchHeadsPolling(t *testing.T) {
+	src := &pollOnlySource{chain: testChain(10)}
+	heads := make(chan L1BlockRef, 20)
+	sub := WatchHeads(context.Background(), src, 5*time.Millisecond, testlog.Logger(t, log.LvlError), func(sig L1BlockRef) {
+		heads <- sig
+	})
+	defer sub.Unsubscribe()
+
+	next := func() L1BlockRef {
+		select {
+		case head := <-heads:
+			return head
+		case <-time.After(time.Second):
+			t.Fatal("no head signaled")
+			return L1BlockRef{}
+		}
+	}
+	require.Equal(t, src.chain[0], next())
+
+	// the same head is not signaled again, and the skipped blocks are signaled before the new head
+	time.Sleep(20 * time.Millisecond)
+	src.setHead(3)
+	require.Equal(t, src.chain[1], next())
+	require.Equal(t, src.chain[2], next())
+	require.Equal(t, src.chain[3], next())
+	select {
+	case head := <-heads:
+		t.Fatalf("unexpected head %s", head)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -27,6 +27,8 @@ type L2BlockRef struct {
 	ParentHash common.Hash `json:"parentHash"`
 	Time       uint64      `json:"timestamp"`
 	L1Origin   BlockID     `json:"l1origin"`
+	// SequenceNumber is the index of the L2 block within its epoch, the first block of an epoch has number 0.
+	SequenceNumber uint64 `json:"sequenceNumber"`
 }
 
 func (id L2BlockRef) String() string {
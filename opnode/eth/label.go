@@ -0,0 +1,22 @@
+package eth
+
+// BlockLabel is a named block of a chain, as supported by the JSON-RPC of execution nodes after the merge.
+type BlockLabel string
+
+const (
+	// Unsafe is the head of the chain, which may be reorged
+	Unsafe BlockLabel = "latest"
+	// Safe is the head of the chain that is justified by the beacon chain, and unlikely to be reorged
+	Safe BlockLabel = "safe"
+	// Finalized is the head of the chain that is finalized by the beacon chain, and will never be reorged
+	Finalized BlockLabel = "finalized"
+)
+
+func (label BlockLabel) String() string {
+	switch label {
+	case Unsafe:
+		return "unsafe"
+	default:
+		return string(label)
+	}
+}
@@ -0,0 +1,162 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// HeadChangeKind classifies how the L1 chain changed with a new head.
+type HeadChangeKind uint8
+
+const (
+	// HeadUnchanged is a repeated signal of the current head
+	HeadUnchanged HeadChangeKind = iota
+	// HeadExtended is a head that descends from the previous head, by one or more blocks
+	HeadExtended
+	// HeadReplaced is a head at the same height as the previous head, with the same parent
+	HeadReplaced
+	// HeadReorged is a head that replaces previously canonical blocks, other than only the previous head
+	HeadReorged
+)
+
+func (k HeadChangeKind) String() string {
+	switch k {
+	case HeadUnchanged:
+		return "unchanged"
+	case HeadExtended:
+		return "extended"
+	case HeadReplaced:
+		return "replaced"
+	case HeadReorged:
+		return "reorged"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(k))
+	}
+}
+
+// HeadChange describes the change of the L1 chain to a new head.
+type HeadChange struct {
+	Head L1BlockRef
+	Kind HeadChangeKind
+	// Depth is the number of previously canonical blocks that are no longer canonical,
+	// or the number of them that is known if the ancestor is not tracked.
+	Depth uint64
+	// Ancestor is the last block of the previous chain that is still canonical. It is the zero block if
+	// the common ancestor is not tracked: the change is a reorg deeper than the tracked blocks, or the first head.
+	Ancestor L1BlockRef
+	// New are the blocks that became canonical after the ancestor, oldest first, ending with the head.
+	// They start after the last tracked block if the ancestor is unknown.
+	New []L1BlockRef
+}
+
+// BlockRefByHashSource fetches L1 blocks by hash, to connect a new head to the tracked blocks.
+type BlockRefByHashSource interface {
+	L1BlockRefByHash(ctx context.Context, hash common.Hash) (L1BlockRef, error)
+}
+
+// HeadTracker keeps the most recent canonical L1 blocks, as seen from the heads that it tracks,
+// to classify each new head as an extension, a replacement or a reorg without walking the L1 chain again.
+// It is not safe for concurrent use.
+type HeadTracker struct {
+	src  BlockRefByHashSource
+	size int
+	// chain is the recent canonical chain, by consecutive numbers, ending with the head
+	chain []L1BlockRef
+}
+
+// NewHeadTracker creates a tracker of the given number of recent canonical blocks.
+func NewHeadTracker(src BlockRefByHashSource, size int) *HeadTracker {
+	if size < 1 {
+		size = 1
+	}
+	return &HeadTracker{src: src, size: size}
+}
+
+// Reset forgets the tracked blocks, and starts tracking from the given head.
+func (t *HeadTracker) Reset(head L1BlockRef) {
+	t.chain = append(t.chain[:0], head)
+}
+
+// Head returns the last tracked head, or the zero block if no head was tracked.
+func (t *HeadTracker) Head() L1BlockRef {
+	if len(t.chain) == 0 {
+		return L1BlockRef{}
+	}
+	return t.chain[len(t.chain)-1]
+}
+
+// Canonical returns the tracked canonical block at the given number, if it is tracked.
+func (t *HeadTracker) Canonical(num uint64) (L1BlockRef, bool) {
+	if len(t.chain) == 0 || num < t.chain[0].Number || num > t.Head().Number {
+		return L1BlockRef{}, false
+	}
+	return t.chain[num-t.chain[0].Number], true
+}
+
+// Track updates the tracked chain with the new head, and returns how the chain changed.
+// The blocks between the head and the tracked chain are fetched by hash,
+// until the head connects to the tracked chain, or the fetched blocks are as many as the tracked blocks.
+// The tracked chain is unchanged if fetching a block fails.
+func (t *HeadTracker) Track(ctx context.Context, head L1BlockRef) (HeadChange, error) {
+	prev := t.Head()
+	if len(t.chain) == 0 {
+		t.Reset(head)
+		return HeadChange{Head: head, Kind: HeadReorged, New: []L1BlockRef{head}}, nil
+	}
+	if head.Hash == prev.Hash {
+		return HeadChange{Head: head, Kind: HeadUnchanged, Ancestor: prev}, nil
+	}
+	index := make(map[common.Hash]int, len(t.chain))
+	for i, ref := range t.chain {
+		index[ref.Hash] = i
+	}
+
+	// walk back from the new head until it connects to the tracked chain
+	newBlocks := []L1BlockRef{head}
+	ancestor := -1
+	for {
+		oldest := newBlocks[len(newBlocks)-1]
+		if i, ok := index[oldest.ParentHash]; ok {
+			ancestor = i
+			break
+		}
+		if oldest.Number <= t.chain[0].Number || len(newBlocks) >= t.size {
+			break // deeper than the tracked chain
+		}
+		parent, err := t.src.L1BlockRefByHash(ctx, oldest.ParentHash)
+		if err != nil {
+			return HeadChange{}, fmt.Errorf("failed to fetch parent %s of L1 block %s: %w", oldest.ParentHash, oldest, err)
+		}
+		newBlocks = append(newBlocks, parent)
+	}
+	for i, j := 0, len(newBlocks)-1; i < j; i, j = i+1, j-1 {
+		newBlocks[i], newBlocks[j] = newBlocks[j], newBlocks[i]
+	}
+
+	change := HeadChange{Head: head, New: newBlocks}
+	if ancestor < 0 {
+		change.Kind = HeadReorged
+		if newBlocks[0].Number <= prev.Number {
+			change.Depth = prev.Number - newBlocks[0].Number + 1
+		}
+		t.chain = append(t.chain[:0], newBlocks...)
+	} else {
+		change.Ancestor = t.chain[ancestor]
+		change.Depth = prev.Number - change.Ancestor.Number
+		switch {
+		case change.Depth == 0:
+			change.Kind = HeadExtended
+		case change.Depth == 1 && head.Number == prev.Number:
+			change.Kind = HeadReplaced
+		default:
+			change.Kind = HeadReorged
+		}
+		t.chain = append(t.chain[:ancestor+1], newBlocks...)
+	}
+	if len(t.chain) > t.size {
+		t.chain = append(t.chain[:0], t.chain[len(t.chain)-t.size:]...)
+	}
+	return change, nil
+}
@@ -0,0 +1,92 @@
+package eth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+type blocksByHash map[common.Hash]L1BlockRef
+
+func (b blocksByHash) L1BlockRefByHash(ctx context.Context, hash common.Hash) (L1BlockRef, error) {
+	if ref, ok := b[hash]; ok {
+		return ref, nil
+	}
+	return L1BlockRef{}, ethereum.NotFound
+}
+
+// fork returns n blocks on top of the parent, with hashes distinguished by the fork byte
+func fork(parent L1BlockRef, n int, forkByte byte, blocks blocksByHash) []L1BlockRef {
+	out := make([]L1BlockRef, n)
+	for i := range out {
+		out[i] = L1BlockRef{Hash: common.Hash{forkByte, byte(parent.Number + 1)}, Number: parent.Number + 1, ParentHash: parent.Hash}
+		blocks[out[i].Hash] = out[i]
+		parent = out[i]
+	}
+	return out
+}
+
+func TestHeadTracker(t *testing.T) {
+	ctx := context.Background()
+	blocks := make(blocksByHash)
+	genesis := L1BlockRef{Hash: common.Hash{0xaa}}
+	a := fork(genesis, 10, 0xa, blocks)
+	tr := NewHeadTracker(blocks, 8)
+	tr.Reset(a[0])
+
+	change, err := tr.Track(ctx, a[1])
+	require.NoError(t, err)
+	require.Equal(t, HeadExtended, change.Kind)
+	require.Equal(t, a[0], change.Ancestor)
+
+	change, err = tr.Track(ctx, a[1])
+	require.NoError(t, err)
+	require.Equal(t, HeadUnchanged, change.Kind)
+
+	// the skipped blocks of a long extension are fetched
+	change, err = tr.Track(ctx, a[4])
+	require.NoError(t, err)
+	require.Equal(t, HeadExtended, change.Kind)
+	require.Equal(t, a[2:5], change.New)
+
+	// same height, same parent
+	b := fork(a[3], 1, 0xb, blocks)
+	change, err = tr.Track(ctx, b[0])
+	require.NoError(t, err)
+	require.Equal(t, HeadReplaced, change.Kind)
+	require.Equal(t, uint64(1), change.Depth)
+	require.Equal(t, a[3], change.Ancestor)
+
+	// reorg of depth 3, to a longer chain
+	c := fork(a[1], 4, 0xc, blocks)
+	change, err = tr.Track(ctx, c[3])
+	require.NoError(t, err)
+	require.Equal(t, HeadReorged, change.Kind)
+	require.Equal(t, uint64(3), change.Depth)
+	require.Equal(t, a[1], change.Ancestor)
+	require.Equal(t, c, change.New)
+	ref, ok := tr.Canonical(a[2].Number)
+	require.True(t, ok)
+	require.Equal(t, c[0], ref, "the tracked chain follows the reorg")
+	ref, ok = tr.Canonical(a[1].Number)
+	require.True(t, ok)
+	require.Equal(t, a[1], ref)
+
+	// a reorg deeper than the tracked blocks has no known ancestor
+	d := fork(genesis, 12, 0xd, blocks)
+	change, err = tr.Track(ctx, d[11])
+	require.NoError(t, err)
+	require.Equal(t, HeadReorged, change.Kind)
+	require.Equal(t, L1BlockRef{}, change.Ancestor)
+	require.Len(t, change.New, 8)
+	require.Equal(t, d[11], tr.Head())
+
+	// the tracked chain is unchanged if the head cannot be connected
+	unknown := L1BlockRef{Hash: common.Hash{0xee}, Number: 14, ParentHash: common.Hash{0xef}}
+	_, err = tr.Track(ctx, unknown)
+	require.ErrorIs(t, err, ethereum.NotFound)
+	require.Equal(t, d[11], tr.Head())
+}
@@ -0,0 +1,121 @@
+// Package events emits the significant events of the rollup node as structured records, e.g. reorgs, derivation stalls,
+// sequencer starts and stops, batch confirmations and engine failures, for alerting systems to consume. The records are
+// separate from the log output: their types and data are stable, and they are written to sinks of their own.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Type identifies the kind of an event.
+type Type string
+
+const (
+	// Reorg is a reorg of one of the L2 heads, the data is a driver.ReorgEvent
+	Reorg Type = "reorg"
+	// DerivationStalled is emitted when the safe head stops making progress while it is behind the L1 head,
+	// and DerivationResumed when it makes progress again
+	DerivationStalled Type = "derivation_stalled"
+	DerivationResumed Type = "derivation_resumed"
+	// SequencerStarted and SequencerStopped are emitted when the sequencer is started or stopped
+	SequencerStarted Type = "sequencer_started"
+	SequencerStopped Type = "sequencer_stopped"
+	// BatchConfirmed is emitted when a batch submission transaction is confirmed on L1
+	BatchConfirmed Type = "batch_confirmed"
+	// EngineUnhealthy and EngineRecovered are emitted when an L2 engine fails, and when it recovers
+	EngineUnhealthy Type = "engine_unhealthy"
+	EngineRecovered Type = "engine_recovered"
+)
+
+// Event is the structured record of an event.
+type Event struct {
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	// Data describes the event, its type depends on the type of the event
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Sink writes the events somewhere, e.g. to a file or to a webhook.
+type Sink interface {
+	Write(ev *Event) error
+	Close() error
+}
+
+// queueSize is the number of events that are buffered for the sinks, more events are dropped
+const queueSize = 256
+
+// Bus emits the events to the sinks, in the background, so that a slow sink does not hold up the node.
+// The events are dropped if the sinks cannot keep up, or after the bus is closed. A nil *Bus emits nothing.
+type Bus struct {
+	log   log.Logger
+	sinks []Sink
+	queue chan *Event
+	done  chan struct{}
+
+	// mu guards closed, the queue is closed while holding it exclusively
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewBus(log log.Logger, sinks ...Sink) *Bus {
+	b := &Bus{log: log, sinks: sinks, queue: make(chan *Event, queueSize), done: make(chan struct{})}
+	go b.loop()
+	return b
+}
+
+// Emit emits the event of the type with the data, without blocking.
+func (b *Bus) Emit(typ Type, data interface{}) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	select {
+	case b.queue <- &Event{Type: typ, Time: time.Now(), Data: data}:
+	default:
+		metrics.GetOrRegisterCounter("events/dropped", nil).Inc(1)
+		b.log.Warn("Dropped event, the event sinks cannot keep up", "type", typ)
+	}
+}
+
+func (b *Bus) loop() {
+	defer close(b.done)
+	for ev := range b.queue {
+		for _, sink := range b.sinks {
+			if err := sink.Write(ev); err != nil {
+				metrics.GetOrRegisterCounter("events/failed", nil).Inc(1)
+				b.log.Warn("Failed to write event", "type", ev.Type, "err", err)
+			}
+		}
+	}
+}
+
+// Close writes the queued events, and closes the sinks.
+func (b *Bus) Close() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+	<-b.done
+	var result error
+	for _, sink := range b.sinks {
+		if err := sink.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testData struct {
+	Number uint64 `json:"number"`
+}
+
+func TestConfigCheck(t *testing.T) {
+	require.NoError(t, (&Config{}).Check())
+	require.NoError(t, (&Config{Sinks: []string{"stdout", "stderr", "file:events.jsonl", "https://alerts.example.com/hook"}}).Check())
+	require.Error(t, (&Config{Sinks: []string{"file:"}}).Check())
+	require.Error(t, (&Config{Sinks: []string{"syslog"}}).Check())
+}
+
+func TestBusStream(t *testing.T) {
+	var buf bytes.Buffer
+	bus := NewBus(testlog.Logger(t, log.LvlError), NewStreamSink(&buf))
+	bus.Emit(Reorg, testData{Number: 1})
+	bus.Emit(SequencerStopped, testData{Number: 2})
+	require.NoError(t, bus.Close())
+	// emitting after the bus is closed drops the event
+	bus.Emit(SequencerStarted, nil)
+
+	scanner := bufio.NewScanner(&buf)
+	var evs []Event
+	for scanner.Scan() {
+		var ev Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		evs = append(evs, ev)
+	}
+	require.Len(t, evs, 2)
+	assert.Equal(t, Reorg, evs[0].Type)
+	assert.Equal(t, map[string]interface{}{"number": float64(1)}, evs[0].Data)
+	assert.False(t, evs[0].Time.IsZero())
+	assert.Equal(t, SequencerStopped, evs[1].Type)
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+	bus.Emit(Reorg, nil)
+	require.NoError(t, bus.Close())
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	cfg := &Config{Sinks: []string{"file:" + path}}
+	// the file is appended to across restarts
+	for i := uint64(0); i < 2; i++ {
+		sinks, err := cfg.NewSinks()
+		require.NoError(t, err)
+		bus := NewBus(testlog.Logger(t, log.LvlError), sinks...)
+		bus.Emit(BatchConfirmed, testData{Number: i})
+		require.NoError(t, bus.Close())
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	require.Len(t, lines, 2)
+	for i, line := range lines {
+		var ev struct {
+			Type Type     `json:"type"`
+			Data testData `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(line, &ev))
+		assert.Equal(t, BatchConfirmed, ev.Type)
+		assert.Equal(t, uint64(i), ev.Data.Number)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan Type, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var ev Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		received <- ev.Type
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL)
+	require.NoError(t, sink.Write(&Event{Type: EngineUnhealthy}))
+	assert.Equal(t, EngineUnhealthy, <-received)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	require.Error(t, NewWebhookSink(failing.URL).Write(&Event{Type: EngineRecovered}))
+}
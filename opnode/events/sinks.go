@@ -0,0 +1,161 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhookTimeout is the time that a webhook has to accept an event
+const webhookTimeout = 10 * time.Second
+
+// streamSink writes the events as JSON lines.
+type streamSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // nil if the stream is not closed with the sink
+}
+
+// NewStreamSink writes the events to the writer as JSON lines. The writer is not closed with the sink.
+func NewStreamSink(w io.Writer) Sink {
+	return &streamSink{w: w}
+}
+
+// NewFileSink appends the events to the file as JSON lines, the file is created if it does not exist.
+func NewFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event file: %w", err)
+	}
+	return &streamSink{w: f, closer: f}, nil
+}
+
+func (s *streamSink) Write(ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+func (s *streamSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// webhookSink posts each event as JSON to a URL.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string) Sink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (s *webhookSink) Write(ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
+
+// Config configures the sinks that the events are written to.
+type Config struct {
+	// Sinks are the specs of the sinks: "stdout" or "stderr" for a stream, "file:<path>" to append to a file,
+	// or a http(s) URL for a webhook. No events are emitted if there are no sinks.
+	Sinks []string
+}
+
+func (c *Config) Enabled() bool {
+	return len(c.Sinks) > 0
+}
+
+func (c *Config) Check() error {
+	for _, spec := range c.Sinks {
+		if err := checkSink(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSink(spec string) error {
+	switch {
+	case spec == "stdout" || spec == "stderr":
+		return nil
+	case strings.HasPrefix(spec, "file:"):
+		if strings.TrimPrefix(spec, "file:") == "" {
+			return errors.New("missing path of the event file")
+		}
+		return nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return nil
+	default:
+		return fmt.Errorf("unknown event sink %q, expected 'stdout', 'stderr', 'file:<path>' or a http(s) URL", spec)
+	}
+}
+
+// NewSinks creates the configured sinks. The sinks that are already created are closed if one fails.
+func (c *Config) NewSinks() ([]Sink, error) {
+	var sinks []Sink
+	for _, spec := range c.Sinks {
+		sink, err := newSink(spec)
+		if err != nil {
+			for _, s := range sinks {
+				_ = s.Close()
+			}
+			return nil, fmt.Errorf("event sink %q: %w", spec, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func newSink(spec string) (Sink, error) {
+	if err := checkSink(spec); err != nil {
+		return nil, err
+	}
+	switch {
+	case spec == "stdout":
+		return NewStreamSink(os.Stdout), nil
+	case spec == "stderr":
+		return NewStreamSink(os.Stderr), nil
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileSink(strings.TrimPrefix(spec, "file:"))
+	default:
+		return NewWebhookSink(spec), nil
+	}
+}
@@ -1,6 +1,21 @@
 package flags
 
-import "github.com/urfave/cli"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/heartbeat"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l1"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/networks"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/node"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/p2p"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/sync"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/tracing"
+	"github.com/urfave/cli"
+)
 
 // Flags
 
@@ -25,12 +40,6 @@ var (
 		Required: true,
 		EnvVar:   prefixEnvVar("L2_ENGINE_RPC"),
 	}
-	RollupConfig = cli.StringFlag{
-		Name:     "rollup.config",
-		Usage:    "Rollup chain parameters",
-		Required: true,
-		EnvVar:   prefixEnvVar("ROLLUP_CONFIG"),
-	}
 	L2EthNodeAddr = cli.StringFlag{
 		Name:     "l2.eth",
 		Usage:    "Address of L2 User JSON-RPC endpoint to use (eth namespace required)",
@@ -51,11 +60,121 @@ var (
 	}
 
 	/* Optional Flags */
+	// Either the network or the rollup config is required
+	Network = cli.StringFlag{
+		Name:   "network",
+		Usage:  fmt.Sprintf("Known network to run the rollup chain of, one of: %s", strings.Join(networks.Names(), ", ")),
+		EnvVar: prefixEnvVar("NETWORK"),
+	}
+	RollupConfig = cli.StringFlag{
+		Name:   "rollup.config",
+		Usage:  "Rollup chain parameters, to run a rollup chain that is not a known network",
+		EnvVar: prefixEnvVar("ROLLUP_CONFIG"),
+	}
+	// The channel limits are derivation rules: all nodes of the network must use the same limits
+	MaxChannelSize = cli.Uint64Flag{
+		Name:   "rollup.max-channel-size",
+		Usage:  "Overrides the max size in bytes of the data of a channel of the rollup config. All nodes of the network must use the same limit",
+		EnvVar: prefixEnvVar("ROLLUP_MAX_CHANNEL_SIZE"),
+	}
+	MaxOpenChannels = cli.Uint64Flag{
+		Name:   "rollup.max-open-channels",
+		Usage:  "Overrides the max number of incomplete channels of the rollup config. All nodes of the network must use the same limit",
+		EnvVar: prefixEnvVar("ROLLUP_MAX_OPEN_CHANNELS"),
+	}
+	MaxChannelBankSize = cli.Uint64Flag{
+		Name:   "rollup.max-channel-bank-size",
+		Usage:  "Overrides the max size in bytes of the frame data of the incomplete channels of the rollup config. All nodes of the network must use the same limit",
+		EnvVar: prefixEnvVar("ROLLUP_MAX_CHANNEL_BANK_SIZE"),
+	}
 	L1TrustRPC = cli.BoolFlag{
 		Name:   "l1.trustrpc",
 		Usage:  "Trust the L1 RPC, sync faster at risk of malicious/buggy RPC providing bad or inconsistent L1 data",
 		EnvVar: prefixEnvVar("L1_TRUST_RPC"),
 	}
+	L1FallbackAddrs = cli.StringSliceFlag{
+		Name:   "l1.fallback",
+		Usage:  "Addresses of L1 User JSON-RPC endpoints to fail over to when the L1 endpoint fails, in order of preference",
+		EnvVar: prefixEnvVar("L1_FALLBACK_RPC"),
+	}
+	L2SecondaryEngineAddr = cli.StringFlag{
+		Name:   "l2.secondary",
+		Usage:  "Address of a secondary L2 Engine JSON-RPC endpoint, that mirrors the first L2 engine and takes over when it is unhealthy",
+		EnvVar: prefixEnvVar("L2_SECONDARY_ENGINE_RPC"),
+	}
+	L1RequestTimeout = cli.DurationFlag{
+		Name:   "l1.request-timeout",
+		Usage:  "Timeout of a request to an L1 endpoint before failing over to the next endpoint. Only applies with fallback endpoints",
+		Value:  10 * time.Second,
+		EnvVar: prefixEnvVar("L1_REQUEST_TIMEOUT"),
+	}
+	L1HealthCheckInterval = cli.DurationFlag{
+		Name:   "l1.health-check-interval",
+		Usage:  "Interval to check the health of the L1 endpoints at. Only applies with fallback endpoints",
+		Value:  l1.DefaultHealthCheckInterval,
+		EnvVar: prefixEnvVar("L1_HEALTH_CHECK_INTERVAL"),
+	}
+	L1CrossCheck = cli.BoolFlag{
+		Name:   "l1.cross-check",
+		Usage:  "Compare the block hashes of the L1 endpoints, and stop using an endpoint that disagrees with the majority",
+		EnvVar: prefixEnvVar("L1_CROSS_CHECK"),
+	}
+	L1CrossCheckDepth = cli.Uint64Flag{
+		Name:   "l1.cross-check-depth",
+		Usage:  "Number of blocks below the lowest head of the L1 endpoints to compare the block hashes at",
+		Value:  5,
+		EnvVar: prefixEnvVar("L1_CROSS_CHECK_DEPTH"),
+	}
+	L1RateLimit = cli.Float64Flag{
+		Name:   "l1.rate-limit",
+		Usage:  "Maximum number of requests per second to the L1 RPC, with every request of a batch counting. Unlimited if 0, but the node still backs off when the RPC rate-limits it",
+		EnvVar: prefixEnvVar("L1_RATE_LIMIT"),
+	}
+	L1RateLimitBurst = cli.IntFlag{
+		Name:   "l1.rate-limit-burst",
+		Usage:  "Maximum number of requests to the L1 RPC at once, within the rate limit",
+		Value:  10,
+		EnvVar: prefixEnvVar("L1_RATE_LIMIT_BURST"),
+	}
+	L1MethodRateLimits = cli.StringSliceFlag{
+		Name:   "l1.method-rate-limit",
+		Usage:  "Maximum number of requests per second of an L1 RPC method, as method=rate, e.g. eth_getTransactionReceipt=50",
+		EnvVar: prefixEnvVar("L1_METHOD_RATE_LIMIT"),
+	}
+	L1PollInterval = cli.DurationFlag{
+		Name:   "l1.poll-interval",
+		Usage:  "Interval to poll the L1 head at, while the L1 head subscription is down or not supported (HTTP endpoint)",
+		Value:  eth.DefaultHeadPollInterval,
+		EnvVar: prefixEnvVar("L1_POLL_INTERVAL"),
+	}
+	L1BeaconHeaders = cli.BoolFlag{
+		Name:   "l1.beacon-headers",
+		Usage:  "Follow the L1 head of the beacon node, and verify that the L1 blocks of the L1 RPC are canonical against the beacon chain. Requires l1.beacon, and an untrusted L1 RPC",
+		EnvVar: prefixEnvVar("L1_BEACON_HEADERS"),
+	}
+
+	L2EngineJWTSecret = cli.StringFlag{
+		Name:   "l2.jwt-secret",
+		Usage:  "Path to the file with the hex-encoded 32 byte secret, shared with the L2 engines, to authenticate with the engine API",
+		EnvVar: prefixEnvVar("L2_ENGINE_JWT_SECRET"),
+	}
+	L2EngineJWTRefreshInterval = cli.DurationFlag{
+		Name:   "l2.jwt-refresh-interval",
+		Usage:  "Age after which a new token is issued to authenticate with the L2 engines",
+		Value:  l2.DefaultJWTRefreshInterval,
+		EnvVar: prefixEnvVar("L2_ENGINE_JWT_REFRESH_INTERVAL"),
+	}
+	L2EngineJWTClockSkew = cli.DurationFlag{
+		Name:   "l2.jwt-clock-skew",
+		Usage:  "Time to add to the issued-at time of the tokens, to compensate the clock difference with the L2 engines (negative if the engine clock is behind)",
+		EnvVar: prefixEnvVar("L2_ENGINE_JWT_CLOCK_SKEW"),
+	}
+
+	DataDirFlag = cli.StringFlag{
+		Name:   "datadir",
+		Usage:  "Directory to persist the rollup node data in, such as the index of L2 blocks by L1 origin and the derivation log. Nothing is persisted if not set",
+		EnvVar: prefixEnvVar("DATADIR"),
+	}
 
 	SequencingEnabledFlag = cli.BoolFlag{
 		Name:   "sequencing.enabled",
@@ -63,6 +182,214 @@ var (
 		EnvVar: prefixEnvVar("SEQUENCING_ENABLED"),
 	}
 
+	SequencerStoppedFlag = cli.BoolFlag{
+		Name:   "sequencer.stopped",
+		Usage:  "Initialize the sequencer in a stopped state, it does not produce blocks until it is activated with admin_startSequencer",
+		EnvVar: prefixEnvVar("SEQUENCER_STOPPED"),
+	}
+
+	BatchSubmitIntervalFlag = cli.DurationFlag{
+		Name:   "sequencer.batch-submit-interval",
+		Usage:  "Maximum time to queue sequenced batches before submitting them together to L1. Zero submits every batch right away",
+		EnvVar: prefixEnvVar("SEQUENCER_BATCH_SUBMIT_INTERVAL"),
+	}
+
+	MaxBatchSubmissionSizeFlag = cli.Uint64Flag{
+		Name:   "sequencer.max-batch-submission-size",
+		Usage:  "Size in bytes of the queued batches at which they are submitted without waiting for the submit interval. Zero means no limit",
+		Value:  100_000,
+		EnvVar: prefixEnvVar("SEQUENCER_MAX_BATCH_SUBMISSION_SIZE"),
+	}
+
+	SequencerMaxUnsafeLagBlocksFlag = cli.Uint64Flag{
+		Name:   "sequencer.max-unsafe-lag-blocks",
+		Usage:  "Maximum number of blocks that the unsafe head may be ahead of the safe head, before block production is paused. Zero means no limit",
+		EnvVar: prefixEnvVar("SEQUENCER_MAX_UNSAFE_LAG_BLOCKS"),
+	}
+
+	SequencerMaxUnsafeLagTimeFlag = cli.DurationFlag{
+		Name:   "sequencer.max-unsafe-lag-time",
+		Usage:  "Maximum time that the unsafe head may be ahead of the safe head, before block production is paused. Zero means no limit",
+		EnvVar: prefixEnvVar("SEQUENCER_MAX_UNSAFE_LAG_TIME"),
+	}
+
+	SequencerPayloadBuildTimeFlag = cli.DurationFlag{
+		Name:   "sequencer.payload-build-time",
+		Usage:  "Time that the engine gets to build a new block with transactions of its tx pool, before the payload is fetched. Zero fetches the payload right away",
+		EnvVar: prefixEnvVar("SEQUENCER_PAYLOAD_BUILD_TIME"),
+	}
+
+	BatchCompressionFlag = cli.StringFlag{
+		Name:   "sequencer.batch-compression",
+		Usage:  "Compression of the batches submitted to L1. Supported compressions: 'none', 'zlib'",
+		Value:  "zlib",
+		EnvVar: prefixEnvVar("SEQUENCER_BATCH_COMPRESSION"),
+	}
+
+	SpanBatchesFlag = cli.BoolFlag{
+		Name:   "sequencer.span-batches",
+		Usage:  "Submit span batches that each cover a span of L2 blocks, instead of a batch per L2 block",
+		EnvVar: prefixEnvVar("SEQUENCER_SPAN_BATCHES"),
+	}
+
+	CheckpointL2Flag = cli.StringFlag{
+		Name:   "checkpoint.l2",
+		Usage:  "Trusted L2 block to start syncing from, formatted as <hash>:<number>. Requires --checkpoint.l1origin",
+		EnvVar: prefixEnvVar("CHECKPOINT_L2"),
+	}
+
+	CheckpointL1OriginFlag = cli.StringFlag{
+		Name:   "checkpoint.l1origin",
+		Usage:  "L1 origin of the trusted L2 checkpoint block, formatted as <hash>:<number>",
+		EnvVar: prefixEnvVar("CHECKPOINT_L1_ORIGIN"),
+	}
+
+	SnapSyncThresholdFlag = cli.Uint64Flag{
+		Name:   "checkpoint.snap-sync-threshold",
+		Usage:  "Number of blocks the engine must be behind the checkpoint to let the engine sync to it by itself. Zero disables engine sync",
+		EnvVar: prefixEnvVar("CHECKPOINT_SNAP_SYNC_THRESHOLD"),
+	}
+
+	MaxReorgDepthFlag = cli.Uint64Flag{
+		Name:   "sync.max-reorg-depth",
+		Usage:  "Maximum number of L2 blocks to walk back to recover from a reorg, or to find the L2 heads at startup",
+		Value:  sync.MaxReorgDepth,
+		EnvVar: prefixEnvVar("SYNC_MAX_REORG_DEPTH"),
+	}
+
+	ReorgHistorySizeFlag = cli.IntFlag{
+		Name:   "sync.reorg-history-size",
+		Usage:  "Number of the last reorgs of the L2 heads that are kept, and served over optimism_reorgHistory",
+		Value:  64,
+		EnvVar: prefixEnvVar("SYNC_REORG_HISTORY_SIZE"),
+	}
+
+	MaxQueuedPayloadsFlag = cli.IntFlag{
+		Name:   "sync.max-queued-payloads",
+		Usage:  "Maximum number of unsafe payloads, received ahead of the unsafe head, that are held until their parents are inserted",
+		Value:  256,
+		EnvVar: prefixEnvVar("SYNC_MAX_QUEUED_PAYLOADS"),
+	}
+
+	L1HeadTimeoutFlag = cli.DurationFlag{
+		Name:   "driver.l1-head-timeout",
+		Usage:  "Deadline of the handling of a new L1 head by the driver, including the recovery from a reorg",
+		Value:  10 * time.Second,
+		EnvVar: prefixEnvVar("DRIVER_L1_HEAD_TIMEOUT"),
+	}
+
+	NewBlockTimeoutFlag = cli.DurationFlag{
+		Name:   "driver.new-block-timeout",
+		Usage:  "Deadline of the sequencing of a new L2 block by the driver",
+		Value:  10 * time.Second,
+		EnvVar: prefixEnvVar("DRIVER_NEW_BLOCK_TIMEOUT"),
+	}
+
+	L1RangeTimeoutFlag = cli.DurationFlag{
+		Name:   "driver.l1-range-timeout",
+		Usage:  "Deadline of the fetching of the L1 blocks of the next sequencing window by the driver",
+		Value:  10 * time.Second,
+		EnvVar: prefixEnvVar("DRIVER_L1_RANGE_TIMEOUT"),
+	}
+
+	StepTimeoutFlag = cli.DurationFlag{
+		Name:   "driver.step-timeout",
+		Usage:  "Deadline of the derivation of a L2 epoch by the driver",
+		Value:  10 * time.Second,
+		EnvVar: prefixEnvVar("DRIVER_STEP_TIMEOUT"),
+	}
+
+	L1BeaconAddr = cli.StringFlag{
+		Name:   "l1.beacon",
+		Usage:  "Address of the L1 beacon node HTTP API, to read the batch data submitted as blobs",
+		EnvVar: prefixEnvVar("L1_BEACON"),
+	}
+
+	BatchDataDirFlag = cli.StringFlag{
+		Name:   "derive.batch-data-dir",
+		Usage:  "Directory to read the batch data from, instead of the L1 calldata. For testing only",
+		EnvVar: prefixEnvVar("DERIVE_BATCH_DATA_DIR"),
+	}
+
+	P2PEnabledFlag = cli.BoolFlag{
+		Name:   "p2p.enabled",
+		Usage:  "Enable the p2p stack, to gossip the unsafe blocks of the sequencer",
+		EnvVar: prefixEnvVar("P2P_ENABLED"),
+	}
+	P2PListenAddrsFlag = cli.StringSliceFlag{
+		Name:   "p2p.listen",
+		Usage:  "Multiaddrs that the p2p host listens on",
+		Value:  &cli.StringSlice{"/ip4/0.0.0.0/tcp/9222"},
+		EnvVar: prefixEnvVar("P2P_LISTEN"),
+	}
+	P2PBootnodesFlag = cli.StringSliceFlag{
+		Name:   "p2p.bootnodes",
+		Usage:  "Multiaddrs, including the peer ID, of the peers to connect to on start-up",
+		EnvVar: prefixEnvVar("P2P_BOOTNODES"),
+	}
+	P2PStaticPeersFlag = cli.StringSliceFlag{
+		Name:   "p2p.static",
+		Usage:  "Multiaddrs, including the peer ID, of the peers to stay connected to. Static peers are redialed when disconnected, and are not banned by their score",
+		EnvVar: prefixEnvVar("P2P_STATIC"),
+	}
+	P2PPeerAllowlistFlag = cli.StringSliceFlag{
+		Name:   "p2p.allowlist",
+		Usage:  "Peer IDs of the private mesh: only the connections with these peers and the static peers are accepted. All peers are accepted if not set",
+		EnvVar: prefixEnvVar("P2P_ALLOWLIST"),
+	}
+	P2PPrivateNetworkKeyFlag = cli.StringFlag{
+		Name:   "p2p.private-network-key",
+		Usage:  "Path to the hex encoded 32 byte pre-shared key of a private network: only the nodes with the key can connect",
+		EnvVar: prefixEnvVar("P2P_PRIVATE_NETWORK_KEY"),
+	}
+	P2PPrivKeyFlag = cli.StringFlag{
+		Name:   "p2p.priv-key",
+		Usage:  "Path to the hex encoded secp256k1 private key of the p2p identity. A new identity is generated on every start if not set",
+		EnvVar: prefixEnvVar("P2P_PRIV_KEY"),
+	}
+	P2PNoDiscoveryFlag = cli.BoolFlag{
+		Name:   "p2p.no-discovery",
+		Usage:  "Disable the discv5 discovery of the peers of the rollup, only the bootnodes are connected",
+		EnvVar: prefixEnvVar("P2P_NO_DISCOVERY"),
+	}
+	P2PDiscoveryPortFlag = cli.IntFlag{
+		Name:   "p2p.discovery.port",
+		Usage:  "UDP port of the discv5 discovery",
+		Value:  9222,
+		EnvVar: prefixEnvVar("P2P_DISCOVERY_PORT"),
+	}
+	P2PDiscoveryBootnodesFlag = cli.StringSliceFlag{
+		Name:   "p2p.discovery.bootnodes",
+		Usage:  "ENRs of the discv5 bootnodes of the rollup",
+		EnvVar: prefixEnvVar("P2P_DISCOVERY_BOOTNODES"),
+	}
+	P2PAdvertiseIPFlag = cli.StringFlag{
+		Name:   "p2p.advertise.ip",
+		Usage:  "IP of the node in its ENR. It is learned from the peers if not set",
+		EnvVar: prefixEnvVar("P2P_ADVERTISE_IP"),
+	}
+	P2PMaxPeersFlag = cli.IntFlag{
+		Name:   "p2p.max-peers",
+		Usage:  "Number of peers at which the discovery stops connecting to new peers",
+		Value:  p2p.DefaultMaxPeers,
+		EnvVar: prefixEnvVar("P2P_MAX_PEERS"),
+	}
+	P2PMaxBandwidthFlag = cli.Uint64Flag{
+		Name:   "p2p.bandwidth.max",
+		Usage:  "Bytes per second of the payloads fetched from and served to all the peers. The gossip is not limited. Zero means no limit",
+		EnvVar: prefixEnvVar("P2P_BANDWIDTH_MAX"),
+	}
+	P2PMaxPeerBandwidthFlag = cli.Uint64Flag{
+		Name:   "p2p.bandwidth.peer-max",
+		Usage:  "Bytes per second of the payloads fetched from and served to each peer. The gossip is not limited. Zero means no limit",
+		EnvVar: prefixEnvVar("P2P_BANDWIDTH_PEER_MAX"),
+	}
+	P2PSequencerKeyFlag = cli.StringFlag{
+		Name:   "p2p.sequencer.key",
+		Usage:  "Path to the hex encoded private key that signs the gossiped blocks of the sequencer, of the p2p sequencer address of the rollup",
+		EnvVar: prefixEnvVar("P2P_SEQUENCER_KEY"),
+	}
+
 	// TODO: move batch submitter to stand-alone process
 	BatchSubmitterKeyFlag = cli.StringFlag{
 		Name:   "batchsubmitter.key",
@@ -70,12 +397,214 @@ var (
 		EnvVar: prefixEnvVar("BATCHSUBMITTER_KEY"),
 	}
 
+	BatchSubmitterSignerAddrFlag = cli.StringFlag{
+		Name:   "batchsubmitter.signer-addr",
+		Usage:  "Address of the JSON-RPC endpoint of a remote signer of the batch submission transactions, used instead of the key",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_SIGNER_ADDR"),
+	}
+
+	BatchSubmitterSignerAccountFlag = cli.StringFlag{
+		Name:   "batchsubmitter.signer-account",
+		Usage:  "Account of the remote signer to sign the batch submission transactions with",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_SIGNER_ACCOUNT"),
+	}
+
+	BatchSubmitterSignerNamespaceFlag = cli.StringFlag{
+		Name:   "batchsubmitter.signer-namespace",
+		Usage:  "Namespace of the signer API of the remote signer: 'eth' (web3signer) or 'account' (clef)",
+		Value:  "eth",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_SIGNER_NAMESPACE"),
+	}
+
+	BatchSubmitterKMSKeyIDFlag = cli.StringFlag{
+		Name:   "batchsubmitter.kms.key-id",
+		Usage:  "ID, ARN or alias of the AWS KMS key (ECC_SECG_P256K1) that signs the batch submission transactions, used instead of the key. The AWS credentials are loaded with the default credential chain of the AWS SDK",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_KMS_KEY_ID"),
+	}
+
+	BatchSubmitterKMSRegionFlag = cli.StringFlag{
+		Name:   "batchsubmitter.kms.region",
+		Usage:  "AWS region of the KMS key of the batch submitter",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_KMS_REGION"),
+	}
+
+	BatchSubmitterKMSEndpointFlag = cli.StringFlag{
+		Name:   "batchsubmitter.kms.endpoint",
+		Usage:  "Endpoint of AWS KMS, instead of the endpoint of the region, e.g. a VPC endpoint",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_KMS_ENDPOINT"),
+	}
+
+	BatchSubmitterDryRunFlag = cli.BoolFlag{
+		Name:   "batchsubmitter.dry-run",
+		Usage:  "Encode the batches and log the transactions that would be submitted, with their size, gas and fees, without sending them",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_DRY_RUN"),
+	}
+
+	BatchSubmitterBlobsFlag = cli.BoolFlag{
+		Name:   "batchsubmitter.blobs",
+		Usage:  "Submit the batches in the blobs of blob transactions instead of in calldata. Not supported with a remote signer, supported with a KMS key",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_BLOBS"),
+	}
+
+	BatchSubmitterMaxTxDataSizeFlag = cli.IntFlag{
+		Name:   "batchsubmitter.max-tx-data-size",
+		Usage:  "Maximum size in bytes of the data of a batch submission transaction, batches are split over transactions to stay within it",
+		Value:  120_000,
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_MAX_TX_DATA_SIZE"),
+	}
+
+	BatchSubmitterMaxTxGasFlag = cli.Uint64Flag{
+		Name:   "batchsubmitter.max-tx-gas",
+		Usage:  "Maximum gas of a batch submission transaction, which further limits the data size. Zero means no limit",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_MAX_TX_GAS"),
+	}
+
+	BatchSubmitterResubmissionTimeoutFlag = cli.DurationFlag{
+		Name:   "batchsubmitter.resubmission-timeout",
+		Usage:  "Time to wait for a batch submission transaction to be included, before replacing it with a transaction with higher fees",
+		Value:  30 * time.Second,
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_RESUBMISSION_TIMEOUT"),
+	}
+
+	BatchSubmitterMaxGasPriceFlag = cli.Uint64Flag{
+		Name:   "batchsubmitter.max-gas-price",
+		Usage:  "Maximum fee cap in gwei of batch submission transactions and their replacements. Zero means no limit",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_MAX_GAS_PRICE"),
+	}
+
+	BatchSubmitterFeeHistoryBlocksFlag = cli.Uint64Flag{
+		Name:   "batchsubmitter.fee-history-blocks",
+		Usage:  "Number of recent L1 blocks to take the highest basefee of, to set the fee cap of batch submission transactions",
+		Value:  10,
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_FEE_HISTORY_BLOCKS"),
+	}
+
+	BatchSubmitterBaseFeeMultiplierFlag = cli.Float64Flag{
+		Name:   "batchsubmitter.basefee-multiplier",
+		Usage:  "Multiplier of the highest recent L1 basefee in the fee cap of batch submission transactions",
+		Value:  2,
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_BASEFEE_MULTIPLIER"),
+	}
+
+	BatchSubmitterTipMultiplierFlag = cli.Float64Flag{
+		Name:   "batchsubmitter.tip-multiplier",
+		Usage:  "Multiplier of the tip suggested by the L1 node for batch submission transactions",
+		Value:  1,
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_TIP_MULTIPLIER"),
+	}
+
+	BatchSubmitterMaxTipFlag = cli.Uint64Flag{
+		Name:   "batchsubmitter.max-tip",
+		Usage:  "Maximum tip in gwei of batch submission transactions. Zero means no limit",
+		EnvVar: prefixEnvVar("BATCHSUBMITTER_MAX_TIP"),
+	}
+
 	WithdrawalContractAddr = cli.StringFlag{
 		Name:   "rpc.withdrawalcontractaddress",
 		Usage:  "Address of the Withdrawal contract. By default, this is set to the withdrawal contract predeploy",
 		EnvVar: prefixEnvVar("WITHDRAWAL_CONTRACT_ADDR"),
 	}
 
+	RPCReadyMaxStaleness = cli.DurationFlag{
+		Name:   "rpc.ready-max-staleness",
+		Usage:  "Time that the L1 head and the derivation may stall before /readyz reports the node as not ready",
+		Value:  node.DefaultReadyMaxStaleness,
+		EnvVar: prefixEnvVar("RPC_READY_MAX_STALENESS"),
+	}
+	RPCEnableAdmin = cli.BoolFlag{
+		Name:   "rpc.enable-admin",
+		Usage:  "Enable the admin API (experimental)",
+		EnvVar: prefixEnvVar("RPC_ENABLE_ADMIN"),
+	}
+
+	VerifyFromFlag = cli.Uint64Flag{
+		Name:   "verify-from",
+		Usage:  "Instead of running the node, re-derive the L2 chain from the given L1 block number, and compare it against the canonical chain of the engine",
+		EnvVar: prefixEnvVar("VERIFY_FROM"),
+	}
+
+	SnapshotLog = cli.StringFlag{
+		Name:   "snapshotlog.file",
+		Usage:  "Path to the snapshot log file, to write a JSON line of the driver state on every state change",
+		EnvVar: prefixEnvVar("SNAPSHOT_LOG"),
+	}
+
+	MetricsEnabledFlag = cli.BoolFlag{
+		Name:   "metrics.enabled",
+		Usage:  "Collect the metrics of the node, and serve them in the Prometheus format on /metrics",
+		EnvVar: prefixEnvVar("METRICS_ENABLED"),
+	}
+	MetricsAddrFlag = cli.StringFlag{
+		Name:   "metrics.addr",
+		Usage:  "Metrics listening address",
+		Value:  node.DefaultMetricsListenAddr,
+		EnvVar: prefixEnvVar("METRICS_ADDR"),
+	}
+	MetricsPortFlag = cli.IntFlag{
+		Name:   "metrics.port",
+		Usage:  "Metrics listening port",
+		Value:  node.DefaultMetricsListenPort,
+		EnvVar: prefixEnvVar("METRICS_PORT"),
+	}
+
+	PprofEnabledFlag = cli.BoolFlag{
+		Name:   "pprof.enabled",
+		Usage:  "Serve the runtime profiles of the node, e.g. of the CPU, the heap and the goroutines, on /debug/pprof/",
+		EnvVar: prefixEnvVar("PPROF_ENABLED"),
+	}
+	PprofAddrFlag = cli.StringFlag{
+		Name:   "pprof.addr",
+		Usage:  "pprof listening address",
+		Value:  node.DefaultPprofListenAddr,
+		EnvVar: prefixEnvVar("PPROF_ADDR"),
+	}
+	PprofPortFlag = cli.IntFlag{
+		Name:   "pprof.port",
+		Usage:  "pprof listening port",
+		Value:  node.DefaultPprofListenPort,
+		EnvVar: prefixEnvVar("PPROF_PORT"),
+	}
+
+	TracingEndpointFlag = cli.StringFlag{
+		Name:   "tracing.endpoint",
+		Usage:  "host:port of the OTLP/HTTP collector to export the trace spans of the derivation, the sequencing and the batch submission to. Tracing is disabled if empty",
+		EnvVar: prefixEnvVar("TRACING_ENDPOINT"),
+	}
+	TracingInsecureFlag = cli.BoolFlag{
+		Name:   "tracing.insecure",
+		Usage:  "Export the trace spans over HTTP instead of HTTPS",
+		EnvVar: prefixEnvVar("TRACING_INSECURE"),
+	}
+	TracingSampleRatioFlag = cli.Float64Flag{
+		Name:   "tracing.sample-ratio",
+		Usage:  "Fraction of the traces that are sampled, between 0 and 1",
+		Value:  tracing.DefaultSampleRatio,
+		EnvVar: prefixEnvVar("TRACING_SAMPLE_RATIO"),
+	}
+
+	HeartbeatURLFlag = cli.StringFlag{
+		Name:   "heartbeat.url",
+		Usage:  "Opt in to report the version, the chain, the sync status and the number of peers of the node to the URL periodically",
+		EnvVar: prefixEnvVar("HEARTBEAT_URL"),
+	}
+	HeartbeatIntervalFlag = cli.DurationFlag{
+		Name:   "heartbeat.interval",
+		Usage:  "Time between the heartbeats",
+		Value:  heartbeat.DefaultInterval,
+		EnvVar: prefixEnvVar("HEARTBEAT_INTERVAL"),
+	}
+	HeartbeatMonikerFlag = cli.StringFlag{
+		Name:   "heartbeat.moniker",
+		Usage:  "Name of the node in the heartbeats",
+		EnvVar: prefixEnvVar("HEARTBEAT_MONIKER"),
+	}
+
+	EventSinksFlag = cli.StringSliceFlag{
+		Name:   "events.sinks",
+		Usage:  "Sinks to write the structured records of the reorgs, derivation stalls, sequencer starts and stops, batch confirmations and engine failures to: 'stdout', 'stderr', 'file:<path>' or a http(s) webhook URL",
+		EnvVar: prefixEnvVar("EVENT_SINKS"),
+	}
+
 	LogLevelFlag = cli.StringFlag{
 		Name:   "log.level",
 		Usage:  "The lowest log level that will be output",
@@ -98,17 +627,104 @@ var (
 var requiredFlags = []cli.Flag{
 	L1NodeAddr,
 	L2EngineAddrs,
-	RollupConfig,
 	L2EthNodeAddr,
 	RPCListenAddr,
 	RPCListenPort,
 }
 
 var optionalFlags = []cli.Flag{
+	Network,
+	RollupConfig,
+	MaxChannelSize,
+	MaxOpenChannels,
+	MaxChannelBankSize,
 	L1TrustRPC,
+	L1FallbackAddrs,
+	L2SecondaryEngineAddr,
+	L1RequestTimeout,
+	L1HealthCheckInterval,
+	L1CrossCheck,
+	L1CrossCheckDepth,
+	L1RateLimit,
+	L1RateLimitBurst,
+	L1MethodRateLimits,
+	L1PollInterval,
+	L1BeaconAddr,
+	L1BeaconHeaders,
+	L2EngineJWTSecret,
+	L2EngineJWTRefreshInterval,
+	L2EngineJWTClockSkew,
+	DataDirFlag,
 	SequencingEnabledFlag,
+	SequencerStoppedFlag,
+	BatchSubmitIntervalFlag,
+	MaxBatchSubmissionSizeFlag,
+	SequencerMaxUnsafeLagBlocksFlag,
+	SequencerMaxUnsafeLagTimeFlag,
+	SequencerPayloadBuildTimeFlag,
+	BatchCompressionFlag,
+	SpanBatchesFlag,
+	CheckpointL2Flag,
+	CheckpointL1OriginFlag,
+	SnapSyncThresholdFlag,
+	MaxReorgDepthFlag,
+	ReorgHistorySizeFlag,
+	MaxQueuedPayloadsFlag,
+	L1HeadTimeoutFlag,
+	NewBlockTimeoutFlag,
+	L1RangeTimeoutFlag,
+	StepTimeoutFlag,
+	BatchDataDirFlag,
+	P2PEnabledFlag,
+	P2PListenAddrsFlag,
+	P2PBootnodesFlag,
+	P2PStaticPeersFlag,
+	P2PPeerAllowlistFlag,
+	P2PPrivateNetworkKeyFlag,
+	P2PPrivKeyFlag,
+	P2PSequencerKeyFlag,
+	P2PNoDiscoveryFlag,
+	P2PDiscoveryPortFlag,
+	P2PDiscoveryBootnodesFlag,
+	P2PAdvertiseIPFlag,
+	P2PMaxPeersFlag,
+	P2PMaxBandwidthFlag,
+	P2PMaxPeerBandwidthFlag,
 	BatchSubmitterKeyFlag,
+	BatchSubmitterSignerAddrFlag,
+	BatchSubmitterSignerAccountFlag,
+	BatchSubmitterSignerNamespaceFlag,
+	BatchSubmitterKMSKeyIDFlag,
+	BatchSubmitterKMSRegionFlag,
+	BatchSubmitterKMSEndpointFlag,
+	BatchSubmitterDryRunFlag,
+	BatchSubmitterBlobsFlag,
+	BatchSubmitterMaxTxDataSizeFlag,
+	BatchSubmitterMaxTxGasFlag,
+	BatchSubmitterResubmissionTimeoutFlag,
+	BatchSubmitterMaxGasPriceFlag,
+	BatchSubmitterFeeHistoryBlocksFlag,
+	BatchSubmitterBaseFeeMultiplierFlag,
+	BatchSubmitterTipMultiplierFlag,
+	BatchSubmitterMaxTipFlag,
 	WithdrawalContractAddr,
+	RPCEnableAdmin,
+	RPCReadyMaxStaleness,
+	VerifyFromFlag,
+	SnapshotLog,
+	MetricsEnabledFlag,
+	MetricsAddrFlag,
+	MetricsPortFlag,
+	PprofEnabledFlag,
+	PprofAddrFlag,
+	PprofPortFlag,
+	TracingEndpointFlag,
+	TracingInsecureFlag,
+	TracingSampleRatioFlag,
+	HeartbeatURLFlag,
+	HeartbeatIntervalFlag,
+	HeartbeatMonikerFlag,
+	EventSinksFlag,
 	LogLevelFlag,
 	LogFormatFlag,
 	LogColorFlag,
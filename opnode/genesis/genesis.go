@@ -0,0 +1,109 @@
+// Package genesis computes the genesis of a new rollup chain: the rollup config anchored at an L1 start block,
+// and the L2 execution genesis that starts at the time of the L1 start block.
+package genesis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/contracts/l1block"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// L1Client is the part of the L1 RPC that the genesis is computed from.
+type L1Client interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// Build computes the genesis of a rollup chain that starts after the L1 block with the given number, or after
+// the latest L1 block if nil.
+//
+// The template is the rollup config of the new chain without the genesis and the L1 chain ID, which are taken from L1:
+// the system contracts it refers to must be deployed at the L1 start block.
+// The L2 genesis is a copy of l2Template with the time of the L1 start block, the L2 chain ID and gas limit
+// of the template, and the L1 info predeploy if it is missing.
+func Build(ctx context.Context, l1 L1Client, l1Start *big.Int, template *rollup.Config, l2Template *core.Genesis) (*rollup.Config, *core.Genesis, error) {
+	l1ChainID, err := l1.ChainID(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch L1 chain ID: %w", err)
+	}
+	header, err := l1.HeaderByNumber(ctx, l1Start)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch L1 start block %v: %w", l1Start, err)
+	}
+	for name, addr := range map[string]common.Address{
+		"deposit contract":       template.DepositContractAddress,
+		"system config contract": template.SystemConfigAddress,
+	} {
+		if addr == (common.Address{}) {
+			continue
+		}
+		code, err := l1.CodeAt(ctx, addr, header.Number)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch code of %s %s: %w", name, addr, err)
+		}
+		if len(code) == 0 {
+			return nil, nil, fmt.Errorf("%s %s is not deployed at L1 start block %d", name, addr, header.Number)
+		}
+	}
+
+	cfg := *template
+	l2Genesis, err := buildL2Genesis(&cfg, l2Template, header.Time)
+	if err != nil {
+		return nil, nil, err
+	}
+	l2Block := l2Genesis.ToBlock(nil)
+
+	cfg.L1ChainID = l1ChainID
+	cfg.Genesis = rollup.Genesis{
+		L1:     eth.BlockID{Hash: header.Hash(), Number: header.Number.Uint64()},
+		L2:     eth.BlockID{Hash: l2Block.Hash(), Number: l2Block.NumberU64()},
+		L2Time: l2Block.Time(),
+	}
+	if err := cfg.Check(); err != nil {
+		return nil, nil, fmt.Errorf("invalid rollup config: %w", err)
+	}
+	return &cfg, l2Genesis, nil
+}
+
+// buildL2Genesis copies the L2 genesis template for the rollup config, and sets the L2 chain ID of the config
+// to the one of the template if the config has none.
+func buildL2Genesis(cfg *rollup.Config, l2Template *core.Genesis, l2Time uint64) (*core.Genesis, error) {
+	if l2Template.Config == nil {
+		return nil, errors.New("L2 genesis has no chain config")
+	}
+	l2Genesis := *l2Template
+	chainCfg := *l2Template.Config
+	l2Genesis.Config = &chainCfg
+	// the L2 chain must not start before its L1 anchor
+	l2Genesis.Timestamp = l2Time
+	if cfg.L2ChainID != nil {
+		chainCfg.ChainID = cfg.L2ChainID
+	} else if chainCfg.ChainID != nil {
+		cfg.L2ChainID = chainCfg.ChainID
+	}
+	if cfg.GenesisGasLimit != 0 {
+		l2Genesis.GasLimit = cfg.GenesisGasLimit
+	}
+	l2Genesis.Alloc = make(core.GenesisAlloc, len(l2Template.Alloc)+1)
+	for addr, account := range l2Template.Alloc {
+		l2Genesis.Alloc[addr] = account
+	}
+	if account := l2Genesis.Alloc[derive.L1InfoPredeployAddr]; len(account.Code) == 0 {
+		account.Code = common.FromHex(l1block.L1blockDeployedBin)
+		if account.Balance == nil {
+			account.Balance = common.Big0
+		}
+		l2Genesis.Alloc[derive.L1InfoPredeployAddr] = account
+	}
+	return &l2Genesis, nil
+}
@@ -0,0 +1,113 @@
+package genesis
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/contracts/l1block"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/require"
+)
+
+type mockL1 struct {
+	chainID *big.Int
+	head    *types.Header
+	code    map[common.Address][]byte
+}
+
+func (m *mockL1) ChainID(ctx context.Context) (*big.Int, error) {
+	return m.chainID, nil
+}
+
+func (m *mockL1) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number != nil && number.Cmp(m.head.Number) != 0 {
+		return nil, ethereum.NotFound
+	}
+	return m.head, nil
+}
+
+func (m *mockL1) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return m.code[account], nil
+}
+
+var depositContract = common.Address{0xde}
+
+func testTemplates() (*rollup.Config, *core.Genesis) {
+	template := &rollup.Config{
+		BlockTime:              2,
+		MaxSequencerDrift:      10,
+		SeqWindowSize:          64,
+		BatchInboxAddress:      common.Address{0xff},
+		BatchSenderAddress:     common.Address{0xba},
+		DepositContractAddress: depositContract,
+	}
+	l2Template := &core.Genesis{
+		Config:     &params.ChainConfig{ChainID: big.NewInt(901), LondonBlock: common.Big0},
+		GasLimit:   5000000,
+		Difficulty: common.Big1,
+		BaseFee:    big.NewInt(7),
+		Alloc:      core.GenesisAlloc{common.Address{1}: {Balance: common.Big1}},
+	}
+	return template, l2Template
+}
+
+func TestBuild(t *testing.T) {
+	l1 := &mockL1{
+		chainID: big.NewInt(900),
+		head:    &types.Header{Number: big.NewInt(100), Time: 1650000000, Difficulty: common.Big1},
+		code:    map[common.Address][]byte{depositContract: {0x60}},
+	}
+	template, l2Template := testTemplates()
+	cfg, l2Genesis, err := Build(context.Background(), l1, big.NewInt(100), template, l2Template)
+	require.NoError(t, err)
+
+	require.Equal(t, l1.head.Hash(), cfg.Genesis.L1.Hash)
+	require.Equal(t, uint64(100), cfg.Genesis.L1.Number)
+	require.Equal(t, l1.head.Time, cfg.Genesis.L2Time)
+	require.Equal(t, big.NewInt(900), cfg.L1ChainID)
+	require.Equal(t, big.NewInt(901), cfg.L2ChainID, "the L2 chain ID is taken from the L2 genesis")
+	require.Equal(t, l2Genesis.ToBlock(nil).Hash(), cfg.Genesis.L2.Hash)
+	require.NoError(t, cfg.Check())
+
+	require.Equal(t, l1.head.Time, l2Genesis.Timestamp)
+	require.Equal(t, common.FromHex(l1block.L1blockDeployedBin), l2Genesis.Alloc[derive.L1InfoPredeployAddr].Code)
+	require.Contains(t, l2Genesis.Alloc, common.Address{1})
+
+	require.Nil(t, template.L2ChainID, "the template is not modified")
+	require.Zero(t, l2Template.Timestamp, "the L2 template is not modified")
+	require.NotContains(t, l2Template.Alloc, derive.L1InfoPredeployAddr, "the L2 template is not modified")
+
+	// the L2 chain ID and gas limit of the rollup config take precedence
+	template.L2ChainID = big.NewInt(902)
+	template.GenesisGasLimit = 30000000
+	cfg2, l2Genesis2, err := Build(context.Background(), l1, nil, template, l2Template)
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(902), l2Genesis2.Config.ChainID)
+	require.Equal(t, uint64(30000000), l2Genesis2.GasLimit)
+	require.NotEqual(t, cfg.Genesis.L2.Hash, cfg2.Genesis.L2.Hash)
+}
+
+func TestBuildErrors(t *testing.T) {
+	l1 := &mockL1{
+		chainID: big.NewInt(900),
+		head:    &types.Header{Number: big.NewInt(100), Time: 1650000000, Difficulty: common.Big1},
+	}
+	template, l2Template := testTemplates()
+	_, _, err := Build(context.Background(), l1, nil, template, l2Template)
+	require.ErrorContains(t, err, "deposit contract", "the contracts must be deployed")
+
+	l1.code = map[common.Address][]byte{depositContract: {0x60}}
+	_, _, err = Build(context.Background(), l1, big.NewInt(99), template, l2Template)
+	require.ErrorContains(t, err, "failed to fetch L1 start block 99")
+
+	template.BatchInboxAddress = common.Address{}
+	_, _, err = Build(context.Background(), l1, nil, template, l2Template)
+	require.ErrorContains(t, err, "batch inbox address cannot be empty")
+}
@@ -0,0 +1,133 @@
+// Package heartbeat reports the health of the rollup node to an endpoint of the network operators, if the operator of
+// the node opts in: the version, the chain, the sync status and the number of peers of the node are posted periodically,
+// so that the health of the nodes of the network and the adoption of upgrades can be followed.
+package heartbeat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	DefaultInterval = 10 * time.Minute
+	// minInterval keeps the nodes from flooding the endpoint
+	minInterval = 10 * time.Second
+	// requestTimeout is the time that the endpoint has to accept a heartbeat
+	requestTimeout = 10 * time.Second
+	// maxMonikerLength is the maximum length of the name of the node in the heartbeats
+	maxMonikerLength = 64
+)
+
+type Config struct {
+	// URL is the endpoint that the heartbeats are posted to, the heartbeats are disabled if empty
+	URL string
+	// Interval is the time between the heartbeats, DefaultInterval if 0
+	Interval time.Duration
+	// Moniker is the name of the node in the heartbeats, chosen by the operator of the node. Optional.
+	Moniker string
+}
+
+func (cfg *Config) Enabled() bool {
+	return cfg.URL != ""
+}
+
+// Check verifies that the given configuration makes sense
+func (cfg *Config) Check() error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid heartbeat URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("heartbeat URL %q is not a http(s) URL", cfg.URL)
+	}
+	if cfg.Interval != 0 && cfg.Interval < minInterval {
+		return fmt.Errorf("heartbeat interval %s is shorter than the minimum of %s", cfg.Interval, minInterval)
+	}
+	if len(cfg.Moniker) > maxMonikerLength {
+		return fmt.Errorf("heartbeat moniker is longer than %d characters", maxMonikerLength)
+	}
+	return nil
+}
+
+// Payload is the health of the node that is reported in a heartbeat.
+type Payload struct {
+	Version string       `json:"version"`
+	Moniker string       `json:"moniker,omitempty"`
+	ChainID *hexutil.Big `json:"chainID"`
+
+	L1Head      eth.BlockID `json:"l1Head"`
+	UnsafeL2    eth.BlockID `json:"unsafeL2"`
+	SafeL2      eth.BlockID `json:"safeL2"`
+	FinalizedL2 eth.BlockID `json:"finalizedL2"`
+	// EngineSyncing is true while the engine is syncing by itself
+	EngineSyncing bool `json:"engineSyncing"`
+
+	// Peers is the number of connected p2p peers, nil if the p2p stack is disabled
+	Peers *int `json:"peers,omitempty"`
+}
+
+// Source returns the current health of the node. The version, the moniker and the chain ID are set by the caller.
+type Source func(ctx context.Context) (*Payload, error)
+
+// Beat posts the health of the node to the endpoint of the config at the interval of the config, until the context is done.
+// The heartbeats that fail are logged, and dropped.
+func Beat(ctx context.Context, log log.Logger, cfg *Config, src Source) {
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := beat(ctx, client, cfg, src); err != nil {
+			log.Warn("Failed to send heartbeat", "url", cfg.URL, "err", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func beat(ctx context.Context, client *http.Client, cfg *Config, src Source) error {
+	payload, err := src(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the health of the node: %w", err)
+	}
+	payload.Moniker = cfg.Moniker
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigCheck(t *testing.T) {
+	require.NoError(t, (&Config{}).Check())
+	require.NoError(t, (&Config{URL: "https://heartbeat.example.com/v1", Moniker: "verifier-1"}).Check())
+	require.Error(t, (&Config{URL: "ftp://heartbeat.example.com"}).Check())
+	require.Error(t, (&Config{URL: "https://heartbeat.example.com", Interval: time.Second}).Check())
+	require.Error(t, (&Config{URL: "https://heartbeat.example.com", Moniker: string(make([]byte, maxMonikerLength+1))}).Check())
+}
+
+func TestBeat(t *testing.T) {
+	received := make(chan Payload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var p Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		received <- p
+	}))
+	defer srv.Close()
+
+	peers := 3
+	safe := eth.BlockID{Hash: common.Hash{1}, Number: 10}
+	src := func(ctx context.Context) (*Payload, error) {
+		return &Payload{Version: "v0.1.0", ChainID: (*hexutil.Big)(big.NewInt(901)), SafeL2: safe, Peers: &peers}, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Beat(ctx, testlog.Logger(t, log.LvlError), &Config{URL: srv.URL, Interval: 10 * time.Millisecond, Moniker: "verifier-1"}, src)
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-received:
+			require.Equal(t, "v0.1.0", p.Version)
+			require.Equal(t, "verifier-1", p.Moniker)
+			require.Equal(t, uint64(901), p.ChainID.ToInt().Uint64())
+			require.Equal(t, safe, p.SafeL2)
+			require.Equal(t, 3, *p.Peers)
+		case <-time.After(5 * time.Second):
+			t.Fatal("heartbeat not received")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("heartbeats not stopped")
+	}
+}
+
+func TestBeatErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	cfg := &Config{URL: srv.URL}
+	ok := func(ctx context.Context) (*Payload, error) { return &Payload{}, nil }
+	require.ErrorContains(t, beat(context.Background(), http.DefaultClient, cfg, ok), "503")
+
+	failing := func(ctx context.Context) (*Payload, error) { return nil, errors.New("driver closed") }
+	require.ErrorContains(t, beat(context.Background(), http.DefaultClient, cfg, failing), "driver closed")
+}
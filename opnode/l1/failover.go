@@ -0,0 +1,311 @@
+package l1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// FailoverConfig configures the failover between L1 RPC endpoints.
+type FailoverConfig struct {
+	// RequestTimeout is the timeout of a request to a single endpoint, before failing over to the next endpoint.
+	// Requests are only limited by their context if 0.
+	RequestTimeout time.Duration
+	// HealthCheckInterval is the interval to check the health of the endpoints at, DefaultHealthCheckInterval if 0.
+	HealthCheckInterval time.Duration
+	// CrossCheck compares the block hashes of the endpoints on every health check,
+	// to detect an endpoint that serves a different chain than the others.
+	CrossCheck bool
+	// CrossCheckDepth is the number of blocks below the lowest head of the endpoints to compare the block hashes at,
+	// so endpoints that did not see the latest blocks yet do not disagree.
+	CrossCheckDepth uint64
+}
+
+const DefaultHealthCheckInterval = 10 * time.Second
+
+// FailoverEndpoint is an L1 RPC endpoint to fail over between.
+type FailoverEndpoint struct {
+	// Addr identifies the endpoint in the logs
+	Addr   string
+	Client RPCClient
+}
+
+type failoverEndpoint struct {
+	FailoverEndpoint
+	// healthy is false after a failed request or health check, until the next successful health check
+	healthy bool
+	// diverged is true while the endpoint disagrees with the majority of the endpoints on the cross check
+	diverged bool
+}
+
+func (e *failoverEndpoint) usable() bool {
+	return e.healthy && !e.diverged
+}
+
+type failoverClient struct {
+	log log.Logger
+	cfg FailoverConfig
+
+	mu        sync.Mutex
+	endpoints []*failoverEndpoint
+	active    int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// FailoverRPC serves requests from the first usable endpoint, in the given order of preference.
+// Requests fail over to the next endpoint when an endpoint cannot be reached or times out,
+// but not when it returns a JSON-RPC error, which is a valid response.
+// The endpoints are health-checked in the background, to return to the preferred endpoint once it recovers.
+func FailoverRPC(endpoints []FailoverEndpoint, cfg FailoverConfig, log log.Logger) RPCClient {
+	if cfg.HealthCheckInterval == 0 {
+		cfg.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	fc := &failoverClient{
+		log:  log,
+		cfg:  cfg,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	for _, e := range endpoints {
+		fc.endpoints = append(fc.endpoints, &failoverEndpoint{FailoverEndpoint: e, healthy: true})
+	}
+	go fc.loop()
+	return fc
+}
+
+// order returns the endpoints to try a request with: the active endpoint first,
+// then the other usable endpoints, and then the unusable endpoints as a last resort.
+func (fc *failoverClient) order() []int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	out := []int{fc.active}
+	var unusable []int
+	for i, e := range fc.endpoints {
+		if i == fc.active {
+			continue
+		}
+		if e.usable() {
+			out = append(out, i)
+		} else {
+			unusable = append(unusable, i)
+		}
+	}
+	return append(out, unusable...)
+}
+
+// isEndpointFailure returns true if the error is caused by the endpoint, and not by the request.
+func isEndpointFailure(err error) bool {
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr) && !errors.Is(err, ethereum.NotFound)
+}
+
+func (fc *failoverClient) do(ctx context.Context, fn func(ctx context.Context, c RPCClient) error) error {
+	var err error
+	for _, i := range fc.order() {
+		e := fc.endpoints[i]
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if fc.cfg.RequestTimeout != 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, fc.cfg.RequestTimeout)
+		}
+		err = fn(attemptCtx, e.Client)
+		cancel()
+		if err == nil || !isEndpointFailure(err) {
+			fc.activate(i)
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		fc.log.Warn("L1 endpoint failed, failing over", "addr", e.Addr, "err", err)
+		fc.mu.Lock()
+		e.healthy = false
+		fc.mu.Unlock()
+	}
+	return err
+}
+
+// activate makes the endpoint the active one, if it is not already.
+func (fc *failoverClient) activate(i int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.active == i {
+		return
+	}
+	fc.log.Info("Switched L1 endpoint", "from", fc.endpoints[fc.active].Addr, "to", fc.endpoints[i].Addr)
+	fc.active = i
+}
+
+func (fc *failoverClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	return fc.do(ctx, func(ctx context.Context, c RPCClient) error {
+		// clear the results of the batch elements of the previous endpoint
+		for i := range b {
+			b[i].Error = nil
+		}
+		return c.BatchCallContext(ctx, b)
+	})
+}
+
+func (fc *failoverClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return fc.do(ctx, func(ctx context.Context, c RPCClient) error {
+		return c.CallContext(ctx, result, method, args...)
+	})
+}
+
+// EthSubscribe subscribes with the active endpoint. The subscription stays with that endpoint,
+// and fails when the endpoint does, to resubscribe with the next endpoint.
+func (fc *failoverClient) EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	var sub *rpc.ClientSubscription
+	// the subscription outlives the request, so it is not subject to the request timeout
+	err := fc.do(ctx, func(_ context.Context, c RPCClient) (err error) {
+		sub, err = c.EthSubscribe(ctx, channel, args...)
+		return err
+	})
+	return sub, err
+}
+
+func (fc *failoverClient) Close() {
+	close(fc.stop)
+	<-fc.done
+	for _, e := range fc.endpoints {
+		e.Client.Close()
+	}
+}
+
+func (fc *failoverClient) loop() {
+	defer close(fc.done)
+	ticker := time.NewTicker(fc.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fc.checkHealth()
+		case <-fc.stop:
+			return
+		}
+	}
+}
+
+func (fc *failoverClient) requestTimeout() time.Duration {
+	if fc.cfg.RequestTimeout != 0 {
+		return fc.cfg.RequestTimeout
+	}
+	return fc.cfg.HealthCheckInterval
+}
+
+// checkHealth checks that each endpoint serves its head, cross-checks the endpoints if enabled,
+// and activates the most preferred usable endpoint.
+func (fc *failoverClient) checkHealth() {
+	heads := make([]*uint64, len(fc.endpoints))
+	for i, e := range fc.endpoints {
+		ctx, cancel := context.WithTimeout(context.Background(), fc.requestTimeout())
+		var head hexutil.Uint64
+		err := e.Client.CallContext(ctx, &head, "eth_blockNumber")
+		cancel()
+		fc.mu.Lock()
+		if err != nil {
+			if e.healthy {
+				fc.log.Warn("L1 endpoint is unhealthy", "addr", e.Addr, "err", err)
+			}
+			e.healthy = false
+		} else {
+			if !e.healthy {
+				fc.log.Info("L1 endpoint recovered", "addr", e.Addr, "head", uint64(head))
+			}
+			e.healthy = true
+			heads[i] = (*uint64)(&head)
+		}
+		fc.mu.Unlock()
+	}
+	if fc.cfg.CrossCheck {
+		fc.crossCheck(heads)
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for i, e := range fc.endpoints {
+		if e.usable() {
+			if i != fc.active {
+				fc.log.Info("Switched L1 endpoint", "from", fc.endpoints[fc.active].Addr, "to", e.Addr)
+				fc.active = i
+			}
+			return
+		}
+	}
+}
+
+// crossCheck compares the block hashes of the healthy endpoints below their lowest head.
+// The endpoints that disagree with the majority are not used until they agree again.
+// Without a majority, the disagreement is logged, but none of the endpoints can be blamed.
+func (fc *failoverClient) crossCheck(heads []*uint64) {
+	var height *uint64
+	for _, h := range heads {
+		if h != nil && (height == nil || *h < *height) {
+			height = h
+		}
+	}
+	if height == nil || *height < fc.cfg.CrossCheckDepth {
+		return
+	}
+	num := *height - fc.cfg.CrossCheckDepth
+
+	hashes := make(map[int]common.Hash)
+	counts := make(map[common.Hash]int)
+	for i, e := range fc.endpoints {
+		if heads[i] == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), fc.requestTimeout())
+		var block *struct {
+			Hash common.Hash `json:"hash"`
+		}
+		err := e.Client.CallContext(ctx, &block, "eth_getBlockByNumber", hexutil.EncodeUint64(num), false)
+		cancel()
+		if err != nil || block == nil {
+			continue
+		}
+		hashes[i] = block.Hash
+		counts[block.Hash]++
+	}
+	if len(counts) < 2 {
+		fc.mu.Lock()
+		for i := range hashes {
+			fc.endpoints[i].diverged = false
+		}
+		fc.mu.Unlock()
+		return
+	}
+
+	var majority common.Hash
+	for h, n := range counts {
+		if n*2 > len(hashes) {
+			majority = h
+		}
+	}
+	if majority == (common.Hash{}) {
+		fc.log.Error("L1 endpoints disagree on the block hash, without a majority", "number", num, "hashes", fmt.Sprint(counts))
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for i, h := range hashes {
+		e := fc.endpoints[i]
+		if h != majority {
+			if !e.diverged {
+				fc.log.Error("L1 endpoint disagrees with the other endpoints", "addr", e.Addr, "number", num, "hash", h, "expected", majority)
+			}
+			e.diverged = true
+		} else {
+			e.diverged = false
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package l1
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+type rpcError struct{}
+
+func (rpcError) Error() string  { return "execution reverted" }
+func (rpcError) ErrorCode() int { return 3 }
+
+// fakeEndpoint serves eth_blockNumber and eth_getBlockByNumber, or fails with err
+type fakeEndpoint struct {
+	mu    sync.Mutex
+	err   error
+	head  uint64
+	hash  common.Hash
+	calls int
+}
+
+func (f *fakeEndpoint) set(err error, hash common.Hash) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+	f.hash = hash
+}
+
+func (f *fakeEndpoint) numCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *fakeEndpoint) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return f.err
+}
+
+func (f *fakeEndpoint) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+	switch method {
+	case "eth_blockNumber":
+		*result.(*hexutil.Uint64) = hexutil.Uint64(f.head)
+	case "eth_getBlockByNumber":
+		block := result.(**struct {
+			Hash common.Hash `json:"hash"`
+		})
+		*block = &struct {
+			Hash common.Hash `json:"hash"`
+		}{Hash: f.hash}
+	}
+	return nil
+}
+
+func (f *fakeEndpoint) EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	return nil, f.err
+}
+
+func (f *fakeEndpoint) Close() {}
+
+func newTestFailover(t *testing.T, cfg FailoverConfig, n int) (*failoverClient, []*fakeEndpoint) {
+	var fakes []*fakeEndpoint
+	var endpoints []FailoverEndpoint
+	for i := 0; i < n; i++ {
+		f := &fakeEndpoint{head: 100}
+		fakes = append(fakes, f)
+		endpoints = append(endpoints, FailoverEndpoint{Addr: string(rune('a' + i)), Client: f})
+	}
+	// the health checks are run by the tests
+	cfg.HealthCheckInterval = time.Hour
+	fc := FailoverRPC(endpoints, cfg, testlog.Logger(t, log.LvlError)).(*failoverClient)
+	t.Cleanup(fc.Close)
+	return fc, fakes
+}
+
+func TestFailoverOnEndpointFailure(t *testing.T) {
+	fc, fakes := newTestFailover(t, FailoverConfig{}, 2)
+	ctx := context.Background()
+
+	fakes[0].set(errors.New("connection refused"), common.Hash{})
+	var head hexutil.Uint64
+	require.NoError(t, fc.CallContext(ctx, &head, "eth_blockNumber"))
+	require.Equal(t, 1, fc.active, "fails over to the second endpoint")
+
+	// the failed endpoint is not tried again before it is healthy again
+	require.NoError(t, fc.CallContext(ctx, &head, "eth_blockNumber"))
+	require.Equal(t, 1, fakes[0].numCalls())
+
+	// the preferred endpoint is used again once it recovers
+	fakes[0].set(nil, common.Hash{})
+	fc.checkHealth()
+	require.Equal(t, 0, fc.active)
+}
+
+func TestFailoverKeepsEndpointOnRPCError(t *testing.T) {
+	fc, fakes := newTestFailover(t, FailoverConfig{}, 2)
+
+	fakes[0].set(rpcError{}, common.Hash{})
+	err := fc.CallContext(context.Background(), nil, "eth_call")
+	require.ErrorIs(t, err, rpcError{})
+	require.Equal(t, 0, fc.active, "a JSON-RPC error is a response of a healthy endpoint")
+	require.Zero(t, fakes[1].numCalls())
+}
+
+func TestFailoverAllEndpointsFail(t *testing.T) {
+	fc, fakes := newTestFailover(t, FailoverConfig{}, 2)
+
+	errDown := errors.New("connection refused")
+	fakes[0].set(errDown, common.Hash{})
+	fakes[1].set(errDown, common.Hash{})
+	require.ErrorIs(t, fc.BatchCallContext(context.Background(), nil), errDown)
+}
+
+func TestFailoverCrossCheck(t *testing.T) {
+	fc, fakes := newTestFailover(t, FailoverConfig{CrossCheck: true, CrossCheckDepth: 5}, 3)
+
+	canonical := common.Hash{1}
+	fakes[0].set(nil, common.Hash{2})
+	fakes[1].set(nil, canonical)
+	fakes[2].set(nil, canonical)
+	fc.checkHealth()
+	require.True(t, fc.endpoints[0].diverged)
+	require.Equal(t, 1, fc.active, "the endpoint that disagrees with the majority is not used")
+
+	fakes[0].set(nil, canonical)
+	fc.checkHealth()
+	require.False(t, fc.endpoints[0].diverged)
+	require.Equal(t, 0, fc.active)
+}
+
+func TestFailoverCrossCheckWithoutMajority(t *testing.T) {
+	fc, fakes := newTestFailover(t, FailoverConfig{CrossCheck: true}, 2)
+
+	fakes[0].set(nil, common.Hash{1})
+	fakes[1].set(nil, common.Hash{2})
+	fc.checkHealth()
+	require.False(t, fc.endpoints[0].diverged)
+	require.False(t, fc.endpoints[1].diverged)
+	require.Equal(t, 0, fc.active)
+}
@@ -0,0 +1,227 @@
+package l1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitConfig configures the client-side rate limiting of the L1 RPC.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the rate of requests to the RPC, with every element of a batch counting as a request.
+	// Requests are only limited by the backoff on rate-limited responses if 0.
+	RequestsPerSecond float64
+	// Burst is the number of requests that can be made at once, 1 if 0.
+	Burst int
+	// MethodRequestsPerSecond limits the rate of requests of specific methods, on top of RequestsPerSecond.
+	MethodRequestsPerSecond map[string]float64
+	// MinBackoff is the time to back off for on the first rate-limited response, DefaultMinRateLimitBackoff if 0.
+	// The backoff doubles on every consecutive rate-limited response.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum time to back off for, DefaultMaxRateLimitBackoff if 0.
+	MaxBackoff time.Duration
+	// MaxRetries is the number of times a rate-limited request is retried, DefaultMaxRateLimitRetries if 0.
+	MaxRetries int
+}
+
+const (
+	DefaultMinRateLimitBackoff = 500 * time.Millisecond
+	DefaultMaxRateLimitBackoff = 30 * time.Second
+	DefaultMaxRateLimitRetries = 5
+
+	// minRateLimitDivisor bounds how far rate-limited responses lower the rate: to the configured rate divided by it
+	minRateLimitDivisor = 16
+
+	// errCodeLimitExceeded is the JSON-RPC error code of hosted providers for exceeding the request limits (EIP-1474)
+	errCodeLimitExceeded = -32005
+)
+
+type rateLimitClient struct {
+	c   RPCClient
+	log log.Logger
+	cfg RateLimitConfig
+
+	// limiter is nil if the requests are not limited. Its limit is halved once per backoff,
+	// and restored to the configured rate on the first successful response after the backoff.
+	limiter *rate.Limiter
+	methods map[string]*rate.Limiter
+
+	mu           sync.Mutex
+	backoff      time.Duration // backoff of the last rate-limited response, 0 after a successful response
+	backoffUntil time.Time
+}
+
+// RateLimitRPC limits the rate of requests (excluding subscriptions) of the client, per the configuration,
+// and backs off from the RPC when it responds that the client is rate-limited (HTTP 429, or JSON-RPC -32005).
+func RateLimitRPC(c RPCClient, cfg RateLimitConfig, log log.Logger) RPCClient {
+	if cfg.Burst == 0 {
+		cfg.Burst = 1
+	}
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = DefaultMinRateLimitBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = DefaultMaxRateLimitBackoff
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRateLimitRetries
+	}
+	rc := &rateLimitClient{c: c, log: log, cfg: cfg, methods: make(map[string]*rate.Limiter)}
+	if cfg.RequestsPerSecond > 0 {
+		rc.limiter = rate.NewLimiter(rate.Limit(cfg.RequestsPerSecond), cfg.Burst)
+	}
+	for method, rps := range cfg.MethodRequestsPerSecond {
+		rc.methods[method] = rate.NewLimiter(rate.Limit(rps), cfg.Burst)
+	}
+	return rc
+}
+
+// isRateLimited returns true if the error is a response of the RPC to exceeding its request limits.
+func isRateLimited(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		if rpcErr.ErrorCode() == errCodeLimitExceeded {
+			return true
+		}
+		msg := strings.ToLower(rpcErr.Error())
+		return strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many requests")
+	}
+	return false
+}
+
+// wait blocks until a request of the method can be made.
+func (rc *rateLimitClient) wait(ctx context.Context, method string) error {
+	rc.mu.Lock()
+	until := rc.backoffUntil
+	rc.mu.Unlock()
+	if d := time.Until(until); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if rc.limiter != nil {
+		if err := rc.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if l, ok := rc.methods[method]; ok {
+		if err := l.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rateLimited backs off from the RPC, for twice as long as the previous time if it was rate-limited before,
+// and halves the rate of requests, down to the minimum rate.
+// The responses to requests that were made before the backoff started do not back off again.
+func (rc *rateLimitClient) rateLimited(err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if time.Now().Before(rc.backoffUntil) {
+		return
+	}
+	if rc.backoff == 0 {
+		rc.backoff = rc.cfg.MinBackoff
+	} else if rc.backoff *= 2; rc.backoff > rc.cfg.MaxBackoff {
+		rc.backoff = rc.cfg.MaxBackoff
+	}
+	rc.backoffUntil = time.Now().Add(rc.backoff)
+	if rc.limiter != nil {
+		limit := rc.limiter.Limit() / 2
+		if min := rate.Limit(rc.cfg.RequestsPerSecond / minRateLimitDivisor); limit < min {
+			limit = min
+		}
+		rc.limiter.SetLimit(limit)
+	}
+	rc.log.Warn("L1 RPC is rate-limiting requests, backing off", "backoff", rc.backoff, "err", err)
+}
+
+// succeeded resets the backoff, and restores the configured rate of requests once the backoff is over.
+func (rc *rateLimitClient) succeeded() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if time.Now().Before(rc.backoffUntil) {
+		// a response to a request that was made before the backoff started
+		return
+	}
+	rc.backoff = 0
+	if rc.limiter != nil {
+		rc.limiter.SetLimit(rate.Limit(rc.cfg.RequestsPerSecond))
+	}
+}
+
+// do runs the request, and retries it after backing off if it is rate-limited.
+func (rc *rateLimitClient) do(ctx context.Context, fn func() error) error {
+	for i := 0; ; i++ {
+		err := fn()
+		if !isRateLimited(err) {
+			return err
+		}
+		rc.rateLimited(err)
+		if i == rc.cfg.MaxRetries {
+			return err
+		}
+		if err := rc.wait(ctx, ""); err != nil {
+			return err
+		}
+	}
+}
+
+func (rc *rateLimitClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for _, elem := range b {
+		if err := rc.wait(ctx, elem.Method); err != nil {
+			return err
+		}
+	}
+	err := rc.do(ctx, func() error {
+		return rc.c.BatchCallContext(ctx, b)
+	})
+	if err != nil {
+		return err
+	}
+	// the failed elements are retried by the caller, but later requests back off
+	for _, elem := range b {
+		if isRateLimited(elem.Error) {
+			rc.rateLimited(elem.Error)
+			return nil
+		}
+	}
+	rc.succeeded()
+	return nil
+}
+
+func (rc *rateLimitClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if err := rc.wait(ctx, method); err != nil {
+		return err
+	}
+	err := rc.do(ctx, func() error {
+		return rc.c.CallContext(ctx, result, method, args...)
+	})
+	if err == nil {
+		rc.succeeded()
+	}
+	return err
+}
+
+func (rc *rateLimitClient) EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	// subscriptions are not rate-limited
+	return rc.c.EthSubscribe(ctx, channel, args...)
+}
+
+func (rc *rateLimitClient) Close() {
+	rc.c.Close()
+}
@@ -0,0 +1,126 @@
+package l1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+type limitExceededError struct{}
+
+func (limitExceededError) Error() string  { return "limit exceeded" }
+func (limitExceededError) ErrorCode() int { return errCodeLimitExceeded }
+
+// funcRPC serves requests with the call function
+type funcRPC struct {
+	call func(method string) error
+}
+
+func (f *funcRPC) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	return f.call("batch")
+}
+
+func (f *funcRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return f.call(method)
+}
+
+func (f *funcRPC) EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	return nil, nil
+}
+
+func (f *funcRPC) Close() {}
+
+func TestIsRateLimited(t *testing.T) {
+	require.True(t, isRateLimited(rpc.HTTPError{StatusCode: http.StatusTooManyRequests}))
+	require.False(t, isRateLimited(rpc.HTTPError{StatusCode: http.StatusBadGateway}))
+	require.True(t, isRateLimited(limitExceededError{}))
+	require.False(t, isRateLimited(rpcError{}))
+	require.False(t, isRateLimited(errors.New("connection refused")))
+	require.False(t, isRateLimited(nil))
+}
+
+func TestRateLimitBackoff(t *testing.T) {
+	calls := 0
+	fake := &funcRPC{call: func(method string) error {
+		calls++
+		if calls <= 2 {
+			return rpc.HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"}
+		}
+		return nil
+	}}
+	cfg := RateLimitConfig{RequestsPerSecond: 1000, MinBackoff: 20 * time.Millisecond}
+	rc := RateLimitRPC(fake, cfg, testlog.Logger(t, log.LvlError)).(*rateLimitClient)
+
+	start := time.Now()
+	require.NoError(t, rc.CallContext(context.Background(), nil, "eth_chainId"))
+	require.Equal(t, 3, calls, "rate-limited requests are retried")
+	// backs off for 20ms, and then for 40ms
+	require.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+	require.Equal(t, 1000.0, float64(rc.limiter.Limit()), "the rate is restored after the backoff")
+	require.Zero(t, rc.backoff, "the backoff is reset after a successful response")
+}
+
+func TestRateLimitLowersRate(t *testing.T) {
+	fake := &funcRPC{call: func(method string) error { return nil }}
+	cfg := RateLimitConfig{RequestsPerSecond: 1000, MinBackoff: time.Hour, MaxBackoff: time.Hour}
+	rc := RateLimitRPC(fake, cfg, testlog.Logger(t, log.LvlError)).(*rateLimitClient)
+	err := limitExceededError{}
+
+	// the responses to requests made before the backoff do not lower the rate again
+	rc.rateLimited(err)
+	rc.rateLimited(err)
+	require.Equal(t, 500.0, float64(rc.limiter.Limit()))
+	rc.succeeded()
+	require.Equal(t, 500.0, float64(rc.limiter.Limit()), "the rate is lowered until the backoff is over")
+
+	for i := 0; i < 10; i++ {
+		rc.backoffUntil = time.Time{}
+		rc.rateLimited(err)
+	}
+	require.Equal(t, 1000.0/minRateLimitDivisor, float64(rc.limiter.Limit()), "the rate is not lowered below the minimum")
+
+	rc.backoffUntil = time.Time{}
+	rc.succeeded()
+	require.Equal(t, 1000.0, float64(rc.limiter.Limit()))
+}
+
+func TestRateLimitMaxRetries(t *testing.T) {
+	calls := 0
+	fake := &funcRPC{call: func(method string) error {
+		calls++
+		return limitExceededError{}
+	}}
+	cfg := RateLimitConfig{MinBackoff: time.Millisecond, MaxRetries: 2}
+	rc := RateLimitRPC(fake, cfg, testlog.Logger(t, log.LvlError))
+	require.ErrorIs(t, rc.CallContext(context.Background(), nil, "eth_chainId"), limitExceededError{})
+	require.Equal(t, 3, calls)
+}
+
+func TestRateLimitMethod(t *testing.T) {
+	fake := &funcRPC{call: func(method string) error { return nil }}
+	cfg := RateLimitConfig{MethodRequestsPerSecond: map[string]float64{"eth_getTransactionReceipt": 20}}
+	rc := RateLimitRPC(fake, cfg, testlog.Logger(t, log.LvlError))
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, rc.CallContext(ctx, nil, "eth_chainId"))
+	}
+	require.Less(t, time.Since(start), 50*time.Millisecond, "other methods are not limited")
+
+	// every element of a batch counts as a request
+	batch := make([]rpc.BatchElem, 3)
+	for i := range batch {
+		batch[i].Method = "eth_getTransactionReceipt"
+	}
+	start = time.Now()
+	require.NoError(t, rc.BatchCallContext(ctx, batch))
+	require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
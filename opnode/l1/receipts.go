@@ -39,12 +39,20 @@ func fetchReceipts(ctx context.Context, receiptHash common.Hash, txs types.Trans
 		}
 	}
 
-	// Sanity-check: external L1-RPC sources are notorious for not returning all receipts,
-	// or returning them out-of-order. Verify the receipts against the expected receipt-hash.
+	if err := verifyReceipts(receiptHash, receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// verifyReceipts checks the receipts against the receipt root of the block.
+// External L1-RPC sources are notorious for not returning all receipts,
+// or returning them out-of-order.
+func verifyReceipts(receiptHash common.Hash, receipts types.Receipts) error {
 	hasher := trie.NewStackTrie(nil)
-	computed := types.DeriveSha(types.Receipts(receipts), hasher)
+	computed := types.DeriveSha(receipts, hasher)
 	if receiptHash != computed {
-		return nil, fmt.Errorf("failed to fetch list of receipts: expected receipt root %s but computed %s from retrieved receipts", receiptHash, computed)
+		return fmt.Errorf("failed to fetch list of receipts: expected receipt root %s but computed %s from retrieved receipts", receiptHash, computed)
 	}
-	return receipts, nil
+	return nil
 }
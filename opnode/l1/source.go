@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 
@@ -27,6 +29,9 @@ type SourceConfig struct {
 	// limit concurrent requests, applies to the source as a whole
 	MaxConcurrentRequests int
 
+	// limit the rate of requests, and back off when the RPC rate-limits the requests
+	RateLimit RateLimitConfig
+
 	// cache sizes
 
 	// Number of blocks worth of receipts to cache
@@ -35,12 +40,28 @@ type SourceConfig struct {
 	TransactionsCacheSize int
 	// Number of block headers to cache
 	HeadersCacheSize int
+	// Number of block numbers to cache the canonical block hash of
+	CanonicalCacheSize int
 
 	// If the RPC is untrusted, then we should not use cached information from responses,
 	// and instead verify against the block-hash.
 	// Of real L1 blocks no deposits can be missed/faked, no batches can be missed/faked,
 	// only the wrong L1 blocks can be retrieved.
 	TrustRPC bool
+
+	// Canonical attests which L1 blocks are canonical, instead of the RPC, e.g. a beacon node or a light client.
+	// The RPC is then only used for the contents of the blocks, which are verified against the block hashes.
+	// The RPC is trusted for which blocks are canonical if nil.
+	Canonical CanonicalOracle
+}
+
+// CanonicalOracle attests which L1 blocks are canonical, independently of the execution RPC.
+type CanonicalOracle interface {
+	// HeadHash returns the hash of the canonical L1 head.
+	HeadHash(ctx context.Context) (common.Hash, error)
+	// CanonicalHashAt returns the hash of the canonical L1 block with the given timestamp,
+	// or ethereum.NotFound if there is none.
+	CanonicalHashAt(ctx context.Context, l1Time uint64) (common.Hash, error)
 }
 
 func (c *SourceConfig) Check() error {
@@ -53,6 +74,9 @@ func (c *SourceConfig) Check() error {
 	if c.HeadersCacheSize < 0 {
 		return fmt.Errorf("invalid headers cache size: %d", c.HeadersCacheSize)
 	}
+	if c.CanonicalCacheSize < 0 {
+		return fmt.Errorf("invalid canonical cache size: %d", c.CanonicalCacheSize)
+	}
 	if c.MaxConcurrentRequests < 1 {
 		return fmt.Errorf("expected at least 1 concurrent request, but max is %d", c.MaxConcurrentRequests)
 	}
@@ -65,6 +89,9 @@ func (c *SourceConfig) Check() error {
 	if c.MaxRequestsPerBatch < 1 {
 		return fmt.Errorf("expected at least 1 request per batch, but max is: %d", c.MaxRequestsPerBatch)
 	}
+	if c.Canonical != nil && c.TrustRPC {
+		return errors.New("the RPC must not be trusted for the block contents if an oracle attests the canonical blocks")
+	}
 	return nil
 }
 
@@ -79,6 +106,7 @@ func DefaultConfig(config *rollup.Config, trustRPC bool) *SourceConfig {
 		// Additional cache-size for handling reorgs, and thus more unique blocks, also helps.
 		TransactionsCacheSize: int(config.SeqWindowSize * 4),
 		HeadersCacheSize:      int(config.SeqWindowSize * 4),
+		CanonicalCacheSize:    int(config.SeqWindowSize * 4),
 
 		// TODO: tune batch params
 		MaxParallelBatching: 8,
@@ -103,12 +131,18 @@ type RPCClient interface {
 // Source to retrieve L1 data from with optimized batch requests, cached results,
 // and flag to not trust the RPC.
 type Source struct {
+	log    log.Logger
 	client RPCClient
 
 	batchCall batchCallContextFn
 
 	trustRPC bool
 
+	// blockReceipts is whether the RPC supports eth_getBlockReceipts,
+	// one of blockReceiptsUnknown, blockReceiptsSupported or blockReceiptsUnsupported.
+	// Accessed atomically.
+	blockReceipts int32
+
 	// cache receipts in bundles per block hash
 	// common.Hash -> types.Receipts
 	receiptsCache *lru.Cache
@@ -120,6 +154,16 @@ type Source struct {
 	// cache block headers of blocks by hash
 	// common.Hash -> *HeaderInfo
 	headersCache *lru.Cache
+
+	// cache the hashes of the canonical blocks by number, invalidated on reorgs.
+	// Only blocks retrieved by number or seen as head are known to be canonical.
+	// uint64 -> common.Hash
+	canonicalCache *lru.Cache
+	// canonicalLock makes the checks and updates of the canonical cache atomic
+	canonicalLock sync.Mutex
+
+	// canonical attests the canonical blocks instead of the RPC, if not nil
+	canonical CanonicalOracle
 }
 
 func NewSource(client RPCClient, log log.Logger, config *SourceConfig) (*Source, error) {
@@ -130,25 +174,36 @@ func NewSource(client RPCClient, log log.Logger, config *SourceConfig) (*Source,
 	receiptsCache, _ := lru.New(config.ReceiptsCacheSize)
 	transactionsCache, _ := lru.New(config.TransactionsCacheSize)
 	headersCache, _ := lru.New(config.HeadersCacheSize)
+	canonicalCache, _ := lru.New(config.CanonicalCacheSize)
 
-	client = LimitRPC(client, config.MaxConcurrentRequests)
+	client = LimitRPC(RateLimitRPC(client, config.RateLimit, log), config.MaxConcurrentRequests)
 
 	// Batch calls will be split up to handle max-batch size,
 	// and parallelized since the RPC server does not parallelize batch contents otherwise.
 	getBatch := parallelBatchCall(log, client.BatchCallContext,
 		config.MaxBatchRetry, config.MaxRequestsPerBatch, config.MaxParallelBatching)
 	return &Source{
+		log:               log,
 		client:            client,
 		batchCall:         getBatch,
 		trustRPC:          config.TrustRPC,
 		receiptsCache:     receiptsCache,
 		transactionsCache: transactionsCache,
 		headersCache:      headersCache,
+		canonicalCache:    canonicalCache,
+		canonical:         config.Canonical,
 	}, nil
 }
 
+// ErrNotCanonical is returned when the RPC returns a block that the canonical oracle does not attest.
+var ErrNotCanonical = errors.New("L1 block is not canonical")
+
 // SubscribeNewHead subscribes to notifications about the current blockchain head on the given channel.
+// The heads of the RPC are not subscribed to if an oracle attests the canonical blocks, the head has to be polled then.
 func (s *Source) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	if s.canonical != nil {
+		return nil, errors.New("the heads of the L1 RPC are not used, the canonical L1 blocks are attested by an oracle")
+	}
 	// Note that *types.Header does not cache the block hash unlike *HeaderInfo, it always recomputes.
 	// Inefficient if used poorly, but no trust issue.
 	return s.client.EthSubscribe(ctx, ch, "newHeads")
@@ -197,13 +252,78 @@ func (s *Source) InfoByHash(ctx context.Context, hash common.Hash) (derive.L1Inf
 }
 
 func (s *Source) InfoByNumber(ctx context.Context, number uint64) (derive.L1Info, error) {
-	// can't hit the cache when querying by number due to reorgs.
-	return s.headerCall(ctx, "eth_getBlockByNumber", hexutil.EncodeUint64(number))
+	// the canonical cache is invalidated on reorgs, so it can be used to query by number.
+	if hash, ok := s.canonicalCache.Get(number); ok {
+		if header, ok := s.headersCache.Get(hash); ok {
+			return header.(*HeaderInfo), nil
+		}
+	}
+	info, err := s.headerCall(ctx, "eth_getBlockByNumber", hexutil.EncodeUint64(number))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCanonical(ctx, info); err != nil {
+		return nil, err
+	}
+	s.addCanonical(info)
+	return info, nil
 }
 
 func (s *Source) InfoHead(ctx context.Context) (derive.L1Info, error) {
 	// can't hit the cache when querying the head due to reorgs / changes.
-	return s.headerCall(ctx, "eth_getBlockByNumber", "latest")
+	var info *HeaderInfo
+	if s.canonical != nil {
+		hash, err := s.canonical.HeadHash(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch canonical L1 head: %w", err)
+		}
+		info, err = s.headerCall(ctx, "eth_getBlockByHash", hash)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		info, err = s.headerCall(ctx, "eth_getBlockByNumber", "latest")
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.addCanonical(info)
+	return info, nil
+}
+
+// InfoByLabel fetches the block with the given label. Execution nodes before the merge only support eth.Unsafe.
+func (s *Source) InfoByLabel(ctx context.Context, label eth.BlockLabel) (derive.L1Info, error) {
+	if label == eth.Unsafe {
+		return s.InfoHead(ctx)
+	}
+	// can't hit the cache when querying a label, it moves with the chain
+	info, err := s.headerCall(ctx, "eth_getBlockByNumber", string(label))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCanonical(ctx, info); err != nil {
+		return nil, err
+	}
+	s.addCanonical(info)
+	return info, nil
+}
+
+// checkCanonical checks that the block, retrieved by number, is canonical according to the canonical oracle, if any.
+func (s *Source) checkCanonical(ctx context.Context, info *HeaderInfo) error {
+	if s.canonical == nil {
+		return nil
+	}
+	hash, err := s.canonical.CanonicalHashAt(ctx, info.time)
+	if errors.Is(err, ethereum.NotFound) {
+		return fmt.Errorf("%w: no canonical block at the time of block %s", ErrNotCanonical, info.ID())
+	} else if err != nil {
+		return fmt.Errorf("failed to check that L1 block %s is canonical: %w", info.ID(), err)
+	}
+	if hash != info.hash {
+		return fmt.Errorf("%w: block %s, canonical block is %s", ErrNotCanonical, info.ID(), hash)
+	}
+	return nil
 }
 
 func (s *Source) InfoAndTxsByHash(ctx context.Context, hash common.Hash) (derive.L1Info, types.Transactions, error) {
@@ -215,26 +335,74 @@ func (s *Source) InfoAndTxsByHash(ctx context.Context, hash common.Hash) (derive
 	return s.blockCall(ctx, "eth_getBlockByHash", hash)
 }
 
+// InfoAndL1TxsByHash fetches the block with its transactions, including blob transactions.
+// The transactions and their senders are verified, unless the RPC is trusted.
+func (s *Source) InfoAndL1TxsByHash(ctx context.Context, hash common.Hash) (derive.L1Info, []derive.L1Tx, error) {
+	var block *rpcL1TxsBlock
+	err := s.client.CallContext(ctx, &block, "eth_getBlockByHash", hash, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, ethereum.NotFound
+	}
+	info, txs, err := block.Info(s.trustRPC)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.headersCache.Add(info.hash, info)
+	return info, txs, nil
+}
+
 func (s *Source) InfoAndTxsByNumber(ctx context.Context, number uint64) (derive.L1Info, types.Transactions, error) {
-	// can't hit the cache when querying by number due to reorgs.
-	return s.blockCall(ctx, "eth_getBlockByNumber", hexutil.EncodeUint64(number))
+	if hash, ok := s.canonicalCache.Get(number); ok {
+		return s.InfoAndTxsByHash(ctx, hash.(common.Hash))
+	}
+	info, txs, err := s.blockCall(ctx, "eth_getBlockByNumber", hexutil.EncodeUint64(number))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkCanonical(ctx, info); err != nil {
+		return nil, nil, err
+	}
+	s.addCanonical(info)
+	return info, txs, nil
 }
 
 func (s *Source) InfoAndTxsHead(ctx context.Context) (derive.L1Info, types.Transactions, error) {
 	// can't hit the cache when querying the head due to reorgs / changes.
-	return s.blockCall(ctx, "eth_getBlockByNumber", "latest")
+	if s.canonical != nil {
+		head, err := s.InfoHead(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s.InfoAndTxsByHash(ctx, head.Hash())
+	}
+	info, txs, err := s.blockCall(ctx, "eth_getBlockByNumber", "latest")
+	if err != nil {
+		return nil, nil, err
+	}
+	s.addCanonical(info)
+	return info, txs, nil
 }
 
 func (s *Source) Fetch(ctx context.Context, blockHash common.Hash) (derive.L1Info, types.Transactions, types.Receipts, error) {
 	if blockHash == (common.Hash{}) {
 		return nil, nil, nil, ethereum.NotFound
 	}
+	if receipts, ok := s.receiptsCache.Get(blockHash); ok {
+		info, txs, err := s.InfoAndTxsByHash(ctx, blockHash)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return info, txs, receipts.(types.Receipts), nil
+	}
 	info, txs, err := s.blockCall(ctx, "eth_getBlockByHash", blockHash)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	receipts, err := fetchReceipts(ctx, info.receiptHash, txs, s.batchCall)
+	receipts, err := s.fetchReceipts(ctx, info, txs)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -242,6 +410,37 @@ func (s *Source) Fetch(ctx context.Context, blockHash common.Hash) (derive.L1Inf
 	return info, txs, receipts, nil
 }
 
+const (
+	blockReceiptsUnknown int32 = iota
+	blockReceiptsSupported
+	blockReceiptsUnsupported
+)
+
+// fetchReceipts fetches the receipts of the block in a single eth_getBlockReceipts request if the RPC supports it,
+// and with a batch of eth_getTransactionReceipt requests otherwise.
+// Support is detected on the first request: an RPC that returns an error response for the method is assumed not to support it.
+func (s *Source) fetchReceipts(ctx context.Context, info *HeaderInfo, txs types.Transactions) (types.Receipts, error) {
+	if len(txs) > 0 && atomic.LoadInt32(&s.blockReceipts) != blockReceiptsUnsupported {
+		var receipts types.Receipts
+		err := s.client.CallContext(ctx, &receipts, "eth_getBlockReceipts", info.hash)
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) {
+			if atomic.CompareAndSwapInt32(&s.blockReceipts, blockReceiptsUnknown, blockReceiptsUnsupported) {
+				s.log.Info("L1 RPC does not support eth_getBlockReceipts, fetching receipts per transaction", "err", err)
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to fetch receipts of block %s: %w", info.hash, err)
+		} else if receipts != nil {
+			atomic.StoreInt32(&s.blockReceipts, blockReceiptsSupported)
+			if err := verifyReceipts(info.receiptHash, receipts); err != nil {
+				return nil, err
+			}
+			return receipts, nil
+		}
+	}
+	return fetchReceipts(ctx, info.receiptHash, txs, s.batchCall)
+}
+
 // FetchAllTransactions fetches transaction lists of a window of blocks, and caches each block and the transactions
 func (s *Source) FetchAllTransactions(ctx context.Context, window []eth.BlockID) ([]types.Transactions, error) {
 	// list of transaction lists
@@ -297,15 +496,23 @@ func (s *Source) FetchAllTransactions(ctx context.Context, window []eth.BlockID)
 func (s *Source) L1HeadBlockRef(ctx context.Context) (eth.L1BlockRef, error) {
 	head, err := s.InfoHead(ctx)
 	if err != nil {
-		return eth.L1BlockRef{}, fmt.Errorf("failed to fetch head header: %v", err)
+		return eth.L1BlockRef{}, fmt.Errorf("failed to fetch head header: %w", err)
 	}
 	return head.BlockRef(), nil
 }
 
+func (s *Source) L1BlockRefByLabel(ctx context.Context, label eth.BlockLabel) (eth.L1BlockRef, error) {
+	info, err := s.InfoByLabel(ctx, label)
+	if err != nil {
+		return eth.L1BlockRef{}, fmt.Errorf("failed to fetch %s header: %w", label, err)
+	}
+	return info.BlockRef(), nil
+}
+
 func (s *Source) L1BlockRefByNumber(ctx context.Context, l1Num uint64) (eth.L1BlockRef, error) {
 	head, err := s.InfoByNumber(ctx, l1Num)
 	if err != nil {
-		return eth.L1BlockRef{}, fmt.Errorf("failed to fetch header by num %d: %v", l1Num, err)
+		return eth.L1BlockRef{}, fmt.Errorf("failed to fetch header by num %d: %w", l1Num, err)
 	}
 	return head.BlockRef(), nil
 }
@@ -335,6 +542,7 @@ func (s *Source) L1Range(ctx context.Context, begin eth.BlockID, max uint64) ([]
 	}
 
 	out := make([]eth.BlockID, 0, max)
+	infos := make([]*HeaderInfo, 0, max)
 
 	// try to cache everything we have before halting on the results with errors
 	for i := 0; i < len(headerRequests); i++ {
@@ -348,6 +556,7 @@ func (s *Source) L1Range(ctx context.Context, begin eth.BlockID, max uint64) ([]
 				return nil, fmt.Errorf("bad header data for block %s: %v", headerRequests[i].Args[0], err)
 			}
 			s.headersCache.Add(info.hash, info)
+			infos = append(infos, info)
 			out = append(out, info.ID())
 			prev := begin
 			if i > 0 {
@@ -362,9 +571,79 @@ func (s *Source) L1Range(ctx context.Context, begin eth.BlockID, max uint64) ([]
 			return nil, fmt.Errorf("failed to retrieve block: %s: %v", headerRequests[i].Args[0], headerRequests[i].Error)
 		}
 	}
+	// the blocks are a chain, so the range is canonical if the last block is
+	if len(infos) > 0 {
+		if err := s.checkCanonical(ctx, infos[len(infos)-1]); err != nil {
+			return nil, err
+		}
+	}
+	for _, info := range infos {
+		s.addCanonical(info)
+	}
 	return out, nil
 }
 
+// addCanonical caches the block as the canonical block at its number.
+// A block that conflicts with the cached canonical blocks means that L1 reorged,
+// and the canonical cache is cleared, since it is unknown how deep the reorg is.
+func (s *Source) addCanonical(info *HeaderInfo) {
+	s.canonicalLock.Lock()
+	defer s.canonicalLock.Unlock()
+	conflict := false
+	if hash, ok := s.canonicalCache.Peek(info.number); ok && hash.(common.Hash) != info.hash {
+		conflict = true
+	}
+	if info.number > 0 {
+		if hash, ok := s.canonicalCache.Peek(info.number - 1); ok && hash.(common.Hash) != info.parentHash {
+			conflict = true
+		}
+	}
+	if hash, ok := s.canonicalCache.Peek(info.number + 1); ok {
+		if child, ok := s.headersCache.Peek(hash); ok && child.(*HeaderInfo).parentHash != info.hash {
+			conflict = true
+		}
+	}
+	if conflict {
+		s.canonicalCache.Purge()
+	}
+	s.canonicalCache.Add(info.number, info.hash)
+}
+
+// L1HeadChanged updates the canonical cache with the new L1 head.
+// The blocks cached above the head are no longer canonical, if the chain got shorter in a reorg.
+// The ancestors of the head are followed through the cached headers, and their cached hashes are corrected,
+// down to the first ancestor that is cached as canonical already: the fork point of a reorg is above it.
+// If the ancestors cannot be followed that far, the fork point is unknown, and the cached blocks below are dropped.
+func (s *Source) L1HeadChanged(head eth.L1BlockRef) {
+	s.canonicalLock.Lock()
+	defer s.canonicalLock.Unlock()
+	s.removeCanonical(func(n uint64) bool { return n > head.Number })
+	s.canonicalCache.Add(head.Number, head.Hash)
+	num, hash := head.Number, head.ParentHash
+	for num > 0 {
+		num--
+		if cached, ok := s.canonicalCache.Peek(num); ok && cached.(common.Hash) == hash {
+			return
+		}
+		parent, ok := s.headersCache.Peek(hash)
+		if !ok {
+			s.removeCanonical(func(n uint64) bool { return n <= num })
+			return
+		}
+		s.canonicalCache.Add(num, hash)
+		hash = parent.(*HeaderInfo).parentHash
+	}
+}
+
+// removeCanonical removes the cached canonical blocks with a number that matches. The caller must hold the lock.
+func (s *Source) removeCanonical(match func(n uint64) bool) {
+	for _, k := range s.canonicalCache.Keys() {
+		if match(k.(uint64)) {
+			s.canonicalCache.Remove(k)
+		}
+	}
+}
+
 func (s *Source) Close() {
 	s.client.Close()
 }
@@ -9,11 +9,13 @@ import (
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -198,3 +200,262 @@ func TestSource_FetchAllTransactions(t *testing.T) {
 	assert.Equal(t, txLists, expectedTxLists)
 	m.Mock.AssertExpectations(t)
 }
+
+func TestSource_InfoByNumberCanonicalCache(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	m := new(mockRPC)
+	hdr := randHeader()
+	rhdr := &rpcHeader{
+		cache:  rpcHeaderCacheInfo{Hash: hdr.Hash()},
+		header: *hdr,
+	}
+	expectedInfo, _ := rhdr.Info(true)
+	n := hdr.Number.Uint64()
+	ctx := context.Background()
+	m.On("CallContext", ctx, new(*rpcHeader), "eth_getBlockByNumber", []interface{}{hexutil.EncodeUint64(n), false}).Run(func(args mock.Arguments) {
+		*args[1].(**rpcHeader) = rhdr
+	}).Return([]error{nil}).Once()
+	s, err := NewSource(m, log, DefaultConfig(&rollup.Config{SeqWindowSize: 10}, true))
+	assert.NoError(t, err)
+	info, err := s.InfoByNumber(ctx, n)
+	assert.NoError(t, err)
+	assert.Equal(t, info, expectedInfo)
+	// Again, without expecting any calls from the mock, the canonical cache will return the block
+	info, err = s.InfoByNumber(ctx, n)
+	assert.NoError(t, err)
+	assert.Equal(t, info, expectedInfo)
+	m.Mock.AssertExpectations(t)
+
+	// A different head at the same number is a reorg, the block is fetched again
+	s.L1HeadChanged(eth.L1BlockRef{Hash: randHash(), Number: n, ParentHash: hdr.ParentHash})
+	m.On("CallContext", ctx, new(*rpcHeader), "eth_getBlockByNumber", []interface{}{hexutil.EncodeUint64(n), false}).Run(func(args mock.Arguments) {
+		*args[1].(**rpcHeader) = rhdr
+	}).Return([]error{nil}).Once()
+	_, err = s.InfoByNumber(ctx, n)
+	assert.NoError(t, err)
+	m.Mock.AssertExpectations(t)
+}
+
+func TestSource_CanonicalCacheReorg(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	s, err := NewSource(new(mockRPC), log, DefaultConfig(&rollup.Config{SeqWindowSize: 10}, true))
+	assert.NoError(t, err)
+
+	a := eth.L1BlockRef{Hash: randHash(), Number: 10}
+	b := eth.L1BlockRef{Hash: randHash(), Number: 11, ParentHash: a.Hash}
+	c := eth.L1BlockRef{Hash: randHash(), Number: 12, ParentHash: b.Hash}
+	s.L1HeadChanged(a)
+	s.L1HeadChanged(b)
+	s.L1HeadChanged(c)
+	assert.Equal(t, 3, s.canonicalCache.Len(), "linear extension keeps the canonical blocks")
+
+	// a reorg to a shorter chain removes the blocks above the new head
+	b2 := eth.L1BlockRef{Hash: randHash(), Number: 11, ParentHash: a.Hash}
+	s.L1HeadChanged(b2)
+	_, ok := s.canonicalCache.Get(uint64(12))
+	assert.False(t, ok)
+	hash, ok := s.canonicalCache.Get(uint64(11))
+	assert.True(t, ok)
+	assert.Equal(t, b2.Hash, hash)
+
+	// a head with an unknown parent clears the cache, the reorg may be deeper
+	c2 := eth.L1BlockRef{Hash: randHash(), Number: 12, ParentHash: randHash()}
+	s.L1HeadChanged(c2)
+	_, ok = s.canonicalCache.Get(uint64(10))
+	assert.False(t, ok)
+}
+
+func TestSource_CanonicalCacheDeepReorg(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	s, err := NewSource(new(mockRPC), log, DefaultConfig(&rollup.Config{SeqWindowSize: 10}, true))
+	assert.NoError(t, err)
+
+	// blocks 10 to 14 are cached, with the headers of 10 to 12 only
+	var chain []*HeaderInfo
+	parent := randHash()
+	for n := uint64(10); n < 15; n++ {
+		info := &HeaderInfo{hash: randHash(), parentHash: parent, number: n}
+		chain = append(chain, info)
+		s.canonicalCache.Add(n, info.hash)
+		if n <= 12 {
+			s.headersCache.Add(info.hash, info)
+		}
+		parent = info.hash
+	}
+	// block 5 is cached too, below a gap
+	s.canonicalCache.Add(uint64(5), randHash())
+
+	// the chain reorgs from block 12, which is not a neighbour of the new head
+	reorged12 := &HeaderInfo{hash: randHash(), parentHash: chain[1].hash, number: 12}
+	reorged13 := &HeaderInfo{hash: randHash(), parentHash: reorged12.hash, number: 13}
+	s.headersCache.Add(reorged12.hash, reorged12)
+	s.headersCache.Add(reorged13.hash, reorged13)
+	s.L1HeadChanged(eth.L1BlockRef{Hash: randHash(), Number: 14, ParentHash: reorged13.hash})
+	for n, want := range map[uint64]common.Hash{11: chain[1].hash, 12: reorged12.hash, 13: reorged13.hash} {
+		hash, ok := s.canonicalCache.Get(n)
+		assert.True(t, ok)
+		assert.Equal(t, want, hash, "block %d", n)
+	}
+	_, ok := s.canonicalCache.Get(uint64(5))
+	assert.True(t, ok, "blocks below the fork point are kept")
+
+	// a reorg that cannot be followed back to a cached canonical block drops the blocks below
+	s.L1HeadChanged(eth.L1BlockRef{Hash: randHash(), Number: 15, ParentHash: randHash()})
+	for _, n := range []uint64{5, 10, 11, 12, 13} {
+		_, ok := s.canonicalCache.Get(n)
+		assert.False(t, ok, "block %d", n)
+	}
+}
+
+func randBlockWithReceipts(txCount uint64) (*rpcBlock, types.Receipts) {
+	txs := randTxs(0, txCount)
+	receipts := make(types.Receipts, txCount)
+	for i := range receipts {
+		receipts[i] = &types.Receipt{Type: types.DynamicFeeTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000 * uint64(i+1), Logs: []*types.Log{}}
+	}
+	hdr := randHeader()
+	hdr.ReceiptHash = types.DeriveSha(receipts, trie.NewStackTrie(nil))
+	return &rpcBlock{
+		header: rpcHeader{cache: rpcHeaderCacheInfo{Hash: hdr.Hash()}, header: *hdr},
+		extra:  rpcBlockCacheInfo{Transactions: txs},
+	}, receipts
+}
+
+func TestSource_FetchBlockReceipts(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	m := new(mockRPC)
+	ctx := context.Background()
+	block, receipts := randBlockWithReceipts(3)
+	h := block.header.header.Hash()
+	m.On("CallContext", ctx, new(*rpcBlock), "eth_getBlockByHash", []interface{}{h, true}).Run(func(args mock.Arguments) {
+		*args[1].(**rpcBlock) = block
+	}).Return([]error{nil})
+	m.On("CallContext", ctx, new(types.Receipts), "eth_getBlockReceipts", []interface{}{h}).Run(func(args mock.Arguments) {
+		*args[1].(*types.Receipts) = receipts
+	}).Return([]error{nil})
+
+	s, err := NewSource(m, log, DefaultConfig(&rollup.Config{SeqWindowSize: 10}, true))
+	assert.NoError(t, err)
+	s.batchCall = m.batchCall // no batch calls are expected
+	_, _, got, err := s.Fetch(ctx, h)
+	assert.NoError(t, err)
+	assert.Equal(t, receipts, got)
+	assert.Equal(t, blockReceiptsSupported, s.blockReceipts)
+	m.Mock.AssertExpectations(t)
+}
+
+func TestSource_FetchBlockReceiptsUnsupported(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	m := new(mockRPC)
+	ctx := context.Background()
+	s, err := NewSource(m, log, DefaultConfig(&rollup.Config{SeqWindowSize: 10}, true))
+	assert.NoError(t, err)
+	s.batchCall = m.batchCall
+
+	fetch := func(block *rpcBlock, receipts types.Receipts) {
+		h := block.header.header.Hash()
+		m.On("CallContext", ctx, new(*rpcBlock), "eth_getBlockByHash", []interface{}{h, true}).Run(func(args mock.Arguments) {
+			*args[1].(**rpcBlock) = block
+		}).Return([]error{nil})
+		m.On("batchCall", ctx, mock.Anything).Run(func(args mock.Arguments) {
+			for i, elem := range args[1].([]rpc.BatchElem) {
+				*elem.Result.(**types.Receipt) = receipts[i]
+			}
+		}).Return([]error{nil}).Once()
+		_, _, got, err := s.Fetch(ctx, h)
+		assert.NoError(t, err)
+		assert.Equal(t, receipts, got)
+	}
+
+	// the first fetch detects that the method is not supported, and falls back to a batch of receipt requests
+	block, receipts := randBlockWithReceipts(2)
+	m.On("CallContext", ctx, new(types.Receipts), "eth_getBlockReceipts", []interface{}{block.header.header.Hash()}).Return([]error{rpcError{}}).Once()
+	fetch(block, receipts)
+	assert.Equal(t, blockReceiptsUnsupported, s.blockReceipts)
+
+	// later fetches do not try the method again
+	fetch(randBlockWithReceipts(3))
+	m.Mock.AssertExpectations(t)
+	m.AssertNumberOfCalls(t, "CallContext", 3)
+}
+
+type fakeCanonicalOracle struct {
+	head   common.Hash
+	byTime map[uint64]common.Hash
+}
+
+func (f *fakeCanonicalOracle) HeadHash(ctx context.Context) (common.Hash, error) {
+	return f.head, nil
+}
+
+func (f *fakeCanonicalOracle) CanonicalHashAt(ctx context.Context, l1Time uint64) (common.Hash, error) {
+	hash, ok := f.byTime[l1Time]
+	if !ok {
+		return common.Hash{}, ethereum.NotFound
+	}
+	return hash, nil
+}
+
+func TestSource_CanonicalOracle(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	m := new(mockRPC)
+	hdr := randHeader()
+	rhdr := &rpcHeader{
+		cache:  rpcHeaderCacheInfo{Hash: hdr.Hash()},
+		header: *hdr,
+	}
+	n := hdr.Number.Uint64()
+	ctx := context.Background()
+	m.On("CallContext", ctx, new(*rpcHeader), "eth_getBlockByNumber", []interface{}{hexutil.EncodeUint64(n), false}).Run(func(args mock.Arguments) {
+		*args[1].(**rpcHeader) = rhdr
+	}).Return([]error{nil})
+	oracle := &fakeCanonicalOracle{byTime: map[uint64]common.Hash{hdr.Time: randHash()}}
+	cfg := DefaultConfig(&rollup.Config{SeqWindowSize: 10}, false)
+	cfg.Canonical = oracle
+	s, err := NewSource(m, log, cfg)
+	assert.NoError(t, err)
+
+	// the RPC serves a block that is not canonical according to the oracle
+	_, err = s.InfoByNumber(ctx, n)
+	assert.ErrorIs(t, err, ErrNotCanonical)
+
+	oracle.byTime[hdr.Time] = hdr.Hash()
+	info, err := s.InfoByNumber(ctx, n)
+	assert.NoError(t, err)
+	assert.Equal(t, hdr.Hash(), info.Hash())
+
+	// the head is the head of the oracle, fetched by hash
+	oracle.head = hdr.Hash()
+	m.On("CallContext", ctx, new(*rpcHeader), "eth_getBlockByHash", []interface{}{hdr.Hash(), false}).Run(func(args mock.Arguments) {
+		*args[1].(**rpcHeader) = rhdr
+	}).Return([]error{nil})
+	head, err := s.InfoHead(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, hdr.Hash(), head.Hash())
+
+	// the RPC can not be trusted if the canonical blocks are attested by an oracle
+	cfg = DefaultConfig(&rollup.Config{SeqWindowSize: 10}, true)
+	cfg.Canonical = oracle
+	_, err = NewSource(m, log, cfg)
+	assert.Error(t, err)
+}
+
+func TestSource_InfoByLabel(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	m := new(mockRPC)
+	hdr := randHeader()
+	rhdr := &rpcHeader{
+		cache:  rpcHeaderCacheInfo{Hash: hdr.Hash()},
+		header: *hdr,
+	}
+	ctx := context.Background()
+	m.On("CallContext", ctx, new(*rpcHeader), "eth_getBlockByNumber", []interface{}{"finalized", false}).Run(func(args mock.Arguments) {
+		*args[1].(**rpcHeader) = rhdr
+	}).Return([]error{nil})
+	s, err := NewSource(m, log, DefaultConfig(&rollup.Config{SeqWindowSize: 10}, true))
+	assert.NoError(t, err)
+	ref, err := s.L1BlockRefByLabel(ctx, eth.Finalized)
+	assert.NoError(t, err)
+	assert.Equal(t, hdr.Hash(), ref.Hash)
+	m.Mock.AssertExpectations(t)
+}
@@ -1,6 +1,7 @@
 package l1
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"math/big"
@@ -8,7 +9,10 @@ import (
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -33,6 +37,7 @@ type HeaderInfo struct {
 	baseFee     *big.Int
 	txHash      common.Hash
 	receiptHash common.Hash
+	bloom       types.Bloom
 }
 
 var _ derive.L1Info = (*HeaderInfo)(nil)
@@ -82,6 +87,10 @@ func (info *HeaderInfo) ReceiptHash() common.Hash {
 	return info.receiptHash
 }
 
+func (info *HeaderInfo) Bloom() types.Bloom {
+	return info.bloom
+}
+
 type rpcHeaderCacheInfo struct {
 	Hash common.Hash `json:"hash"`
 }
@@ -109,6 +118,7 @@ func (header *rpcHeader) Info(trustCache bool) (*HeaderInfo, error) {
 		baseFee:     header.header.BaseFee,
 		txHash:      header.header.TxHash,
 		receiptHash: header.header.ReceiptHash,
+		bloom:       header.header.Bloom,
 	}
 	if !trustCache {
 		if computed := header.header.Hash(); computed != info.hash {
@@ -150,3 +160,153 @@ func (block *rpcBlock) Info(trustCache bool) (*HeaderInfo, types.Transactions, e
 	}
 	return info, block.extra.Transactions, nil
 }
+
+// blobTxType is the EIP-4844 transaction type, which types.Transaction does not support.
+const blobTxType = 3
+
+// rpcL1Tx is a transaction of the block as returned by the RPC, decoded only as far as needed to retrieve batch data.
+// Unlike types.Transaction it supports blob transactions. The sender is taken from the RPC,
+// unless the transaction is verified, which recovers the sender from the signature.
+type rpcL1Tx struct {
+	Hash                common.Hash     `json:"hash"`
+	Type                hexutil.Uint64  `json:"type"`
+	From                common.Address  `json:"from"`
+	To                  *common.Address `json:"to"`
+	Input               hexutil.Bytes   `json:"input"`
+	BlobVersionedHashes []common.Hash   `json:"blobVersionedHashes"`
+
+	// remaining fields of blob transactions, to verify them
+	ChainID              *hexutil.Big     `json:"chainId"`
+	Nonce                hexutil.Uint64   `json:"nonce"`
+	Gas                  hexutil.Uint64   `json:"gas"`
+	MaxPriorityFeePerGas *hexutil.Big     `json:"maxPriorityFeePerGas"`
+	MaxFeePerGas         *hexutil.Big     `json:"maxFeePerGas"`
+	MaxFeePerBlobGas     *hexutil.Big     `json:"maxFeePerBlobGas"`
+	Value                *hexutil.Big     `json:"value"`
+	AccessList           types.AccessList `json:"accessList"`
+	V                    *hexutil.Big     `json:"v"`
+	R                    *hexutil.Big     `json:"r"`
+	S                    *hexutil.Big     `json:"s"`
+
+	// raw is the JSON of the transaction, to verify the other transaction types with types.Transaction
+	raw json.RawMessage
+}
+
+func (tx *rpcL1Tx) UnmarshalJSON(msg []byte) error {
+	type fields rpcL1Tx // without the UnmarshalJSON method
+	if err := json.Unmarshal(msg, (*fields)(tx)); err != nil {
+		return err
+	}
+	tx.raw = append(json.RawMessage(nil), msg...)
+	return nil
+}
+
+// verify returns the consensus encoding of the transaction, to verify it against the transactions root,
+// and the sender, recovered from the signature.
+func (tx *rpcL1Tx) verify() ([]byte, common.Address, error) {
+	if tx.Type != blobTxType {
+		var t types.Transaction
+		if err := json.Unmarshal(tx.raw, &t); err != nil {
+			return nil, common.Address{}, err
+		}
+		data, err := t.MarshalBinary()
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		from, err := types.Sender(types.LatestSignerForChainID(t.ChainId()), &t)
+		if err != nil {
+			return nil, common.Address{}, err
+		}
+		return data, from, nil
+	}
+
+	if tx.To == nil || tx.ChainID == nil || tx.MaxPriorityFeePerGas == nil || tx.MaxFeePerGas == nil ||
+		tx.MaxFeePerBlobGas == nil || tx.Value == nil || tx.V == nil || tx.R == nil || tx.S == nil {
+		return nil, common.Address{}, fmt.Errorf("blob transaction is missing fields")
+	}
+	fields := []interface{}{
+		tx.ChainID.ToInt(), uint64(tx.Nonce), tx.MaxPriorityFeePerGas.ToInt(), tx.MaxFeePerGas.ToInt(), uint64(tx.Gas),
+		*tx.To, tx.Value.ToInt(), []byte(tx.Input), tx.AccessList, tx.MaxFeePerBlobGas.ToInt(), tx.BlobVersionedHashes,
+	}
+	unsigned, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	signed, err := rlp.EncodeToBytes(append(fields, tx.V.ToInt(), tx.R.ToInt(), tx.S.ToInt()))
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+
+	v, r, s := tx.V.ToInt(), tx.R.ToInt(), tx.S.ToInt()
+	if !v.IsUint64() || v.Uint64() > 1 || !crypto.ValidateSignatureValues(byte(v.Uint64()), r, s, true) {
+		return nil, common.Address{}, types.ErrInvalidSig
+	}
+	sig := make([]byte, 65)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:64])
+	sig[64] = byte(v.Uint64())
+	pub, err := crypto.Ecrecover(crypto.Keccak256(append([]byte{blobTxType}, unsigned...)), sig)
+	if err != nil {
+		return nil, common.Address{}, err
+	}
+	var from common.Address
+	copy(from[:], crypto.Keccak256(pub[1:])[12:])
+	return append([]byte{blobTxType}, signed...), from, nil
+}
+
+// rawTxs is a list of encoded transactions, to compute the transactions root of
+type rawTxs [][]byte
+
+func (txs rawTxs) Len() int { return len(txs) }
+
+func (txs rawTxs) EncodeIndex(i int, w *bytes.Buffer) { w.Write(txs[i]) }
+
+type rpcL1TxsBlock struct {
+	header rpcHeader
+	extra  struct {
+		Transactions []rpcL1Tx `json:"transactions"`
+	}
+}
+
+func (block *rpcL1TxsBlock) UnmarshalJSON(msg []byte) error {
+	if err := json.Unmarshal(msg, &block.header); err != nil {
+		return err
+	}
+	return json.Unmarshal(msg, &block.extra)
+}
+
+// Info returns the header info and the transactions of the block.
+// If the RPC is not trusted, the block hash is verified against the header,
+// the transactions against the transactions root, and the senders against the signatures.
+func (block *rpcL1TxsBlock) Info(trustCache bool) (*HeaderInfo, []derive.L1Tx, error) {
+	info, err := block.header.Info(trustCache)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify block from RPC: %v", err)
+	}
+	if !trustCache {
+		encoded := make(rawTxs, len(block.extra.Transactions))
+		for i := range block.extra.Transactions {
+			tx := &block.extra.Transactions[i]
+			data, from, err := tx.verify()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to verify transaction %d: %w", i, err)
+			}
+			if from != tx.From {
+				return nil, nil, fmt.Errorf("failed to verify transaction %d: sender is %s but RPC said %s", i, from, tx.From)
+			}
+			if hash := crypto.Keccak256Hash(data); hash != tx.Hash {
+				return nil, nil, fmt.Errorf("failed to verify transaction %d: hash is %s but RPC said %s", i, hash, tx.Hash)
+			}
+			encoded[i] = data
+		}
+		hasher := trie.NewStackTrie(nil)
+		if computed := types.DeriveSha(encoded, hasher); computed != info.txHash {
+			return nil, nil, fmt.Errorf("failed to verify transactions list: expected transactions root %s but retrieved %s", info.txHash, computed)
+		}
+	}
+	txs := make([]derive.L1Tx, len(block.extra.Transactions))
+	for i, tx := range block.extra.Transactions {
+		txs[i] = derive.L1Tx{Hash: tx.Hash, From: tx.From, To: tx.To, Data: tx.Input, BlobHashes: tx.BlobVersionedHashes}
+	}
+	return info, txs, nil
+}
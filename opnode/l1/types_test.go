@@ -0,0 +1,128 @@
+package l1
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/require"
+)
+
+// testL1TxsBlock returns the JSON of a block with a dynamic fee transaction and a blob transaction,
+// and the sender of the transactions. The transactions can be modified before the JSON is encoded.
+func testL1TxsBlock(t *testing.T, modify func(txs []map[string]interface{})) ([]byte, common.Address) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(900)
+	to := common.Address{0x42}
+
+	dynTx, err := types.SignTx(types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     1,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(100),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(0),
+		Data:      []byte("calldata"),
+	}), types.LatestSignerForChainID(chainID), key)
+	require.NoError(t, err)
+	dynData, err := dynTx.MarshalBinary()
+	require.NoError(t, err)
+	var dynJSON map[string]interface{}
+	data, err := json.Marshal(dynTx)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &dynJSON))
+	dynJSON["from"] = from
+
+	blobHashes := []common.Hash{{0x01, 0xaa}}
+	fields := []interface{}{chainID, uint64(2), big.NewInt(1), big.NewInt(100), uint64(21000), to, big.NewInt(0), []byte{}, types.AccessList{}, big.NewInt(7), blobHashes}
+	unsigned, err := rlp.EncodeToBytes(fields)
+	require.NoError(t, err)
+	sig, err := crypto.Sign(crypto.Keccak256(append([]byte{blobTxType}, unsigned...)), key)
+	require.NoError(t, err)
+	v, r, s := new(big.Int).SetUint64(uint64(sig[64])), new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:64])
+	signed, err := rlp.EncodeToBytes(append(fields, v, r, s))
+	require.NoError(t, err)
+	blobJSON := map[string]interface{}{
+		"hash":                 crypto.Keccak256Hash(append([]byte{blobTxType}, signed...)),
+		"type":                 hexutil.Uint64(blobTxType),
+		"from":                 from,
+		"to":                   to,
+		"input":                hexutil.Bytes{},
+		"blobVersionedHashes":  blobHashes,
+		"chainId":              (*hexutil.Big)(chainID),
+		"nonce":                hexutil.Uint64(2),
+		"gas":                  hexutil.Uint64(21000),
+		"maxPriorityFeePerGas": (*hexutil.Big)(big.NewInt(1)),
+		"maxFeePerGas":         (*hexutil.Big)(big.NewInt(100)),
+		"maxFeePerBlobGas":     (*hexutil.Big)(big.NewInt(7)),
+		"value":                (*hexutil.Big)(big.NewInt(0)),
+		"accessList":           types.AccessList{},
+		"v":                    (*hexutil.Big)(v),
+		"r":                    (*hexutil.Big)(r),
+		"s":                    (*hexutil.Big)(s),
+	}
+
+	hdr := randHeader()
+	hdr.Difficulty = big.NewInt(0)
+	hdr.TxHash = types.DeriveSha(rawTxs{dynData, append([]byte{blobTxType}, signed...)}, trie.NewStackTrie(nil))
+	var block map[string]interface{}
+	data, err = json.Marshal(hdr)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &block))
+	txs := []map[string]interface{}{dynJSON, blobJSON}
+	if modify != nil {
+		modify(txs)
+	}
+	block["transactions"] = txs
+	data, err = json.Marshal(block)
+	require.NoError(t, err)
+	return data, from
+}
+
+func TestRPCL1TxsBlockVerify(t *testing.T) {
+	data, from := testL1TxsBlock(t, nil)
+	var block rpcL1TxsBlock
+	require.NoError(t, json.Unmarshal(data, &block))
+	_, txs, err := block.Info(false)
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	require.Equal(t, from, txs[0].From)
+	require.Equal(t, []byte("calldata"), txs[0].Data)
+	require.Equal(t, from, txs[1].From)
+	require.Equal(t, []common.Hash{{0x01, 0xaa}}, txs[1].BlobHashes)
+	require.NotZero(t, txs[1].Hash, "the hash is verified against the encoding of the transaction")
+}
+
+func TestRPCL1TxsBlockVerifyFails(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(txs []map[string]interface{})
+	}{
+		{"modified calldata", func(txs []map[string]interface{}) { txs[0]["input"] = hexutil.Bytes("other") }},
+		{"modified blob hashes", func(txs []map[string]interface{}) { txs[1]["blobVersionedHashes"] = []common.Hash{{0x01, 0xbb}} }},
+		{"wrong sender", func(txs []map[string]interface{}) { txs[1]["from"] = common.Address{0x01} }},
+		{"wrong hash", func(txs []map[string]interface{}) { txs[0]["hash"] = common.Hash{0x01} }},
+		{"missing transaction", func(txs []map[string]interface{}) { txs[1] = txs[0] }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, _ := testL1TxsBlock(t, tc.modify)
+			var block rpcL1TxsBlock
+			require.NoError(t, json.Unmarshal(data, &block))
+			_, _, err := block.Info(false)
+			require.Error(t, err)
+			// the transactions are not verified if the RPC is trusted
+			_, _, err = block.Info(true)
+			require.NoError(t, err)
+		})
+	}
+}
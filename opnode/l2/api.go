@@ -158,6 +158,8 @@ type PayloadAttributes struct {
 	Transactions []Data `json:"transactions,omitempty"`
 	// NoTxPool to disable adding any transactions from the transaction-pool.
 	NoTxPool bool `json:"noTxPool,omitempty"`
+	// GasLimit overrides the gas limit of the new payload, if set. Engines without gas limit support ignore it.
+	GasLimit *Uint64Quantity `json:"gasLimit,omitempty"`
 }
 
 type ExecutePayloadStatus string
@@ -0,0 +1,144 @@
+package l2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultJWTRefreshInterval is the default age after which the token of the engine API authentication is renewed.
+// Engines reject tokens that were issued more than a few seconds ago, so tokens are short-lived.
+const DefaultJWTRefreshInterval = 2 * time.Second
+
+// JWTConfig configures the authentication with the engine API, on the authenticated port of the execution client.
+type JWTConfig struct {
+	// Secret is the 32 byte secret that is shared with the engine. The connection is not authenticated if nil.
+	Secret []byte
+	// RefreshInterval is the age after which a new token is issued, DefaultJWTRefreshInterval if 0.
+	RefreshInterval time.Duration
+	// ClockSkew is added to the issued-at time of the tokens, to compensate a clock of the engine that is ahead (or behind, if negative).
+	ClockSkew time.Duration
+}
+
+// ReadJWTSecret reads the hex-encoded 32 byte secret, shared with the engine, from the file at the given path.
+func ReadJWTSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT secret: %w", err)
+	}
+	str := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(str, "0x") {
+		str = "0x" + str
+	}
+	secret, err := hexutil.Decode(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT secret: %w", err)
+	}
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("invalid JWT secret: expected 32 bytes, got %d", len(secret))
+	}
+	return secret, nil
+}
+
+// JWTAuth authenticates the requests to the engine API with tokens signed with the shared secret (HS256),
+// and renews the tokens before the engine considers them stale.
+type JWTAuth struct {
+	cfg JWTConfig
+	now func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	issued time.Time
+}
+
+// NewJWTAuth creates the authentication with the engine API.
+func NewJWTAuth(cfg JWTConfig) (*JWTAuth, error) {
+	if len(cfg.Secret) != 32 {
+		return nil, fmt.Errorf("invalid JWT secret: expected 32 bytes, got %d", len(cfg.Secret))
+	}
+	if cfg.RefreshInterval == 0 {
+		cfg.RefreshInterval = DefaultJWTRefreshInterval
+	}
+	return &JWTAuth{cfg: cfg, now: time.Now}, nil
+}
+
+// Token returns the current token, or a new one if the current token is too old.
+func (a *JWTAuth) Token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	if a.token != "" && now.Sub(a.issued) < a.cfg.RefreshInterval && !now.Before(a.issued) {
+		return a.token, nil
+	}
+	return a.renew(now)
+}
+
+// Renew issues a new token, e.g. after the engine rejected the current one.
+func (a *JWTAuth) Renew() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.renew(a.now())
+}
+
+func (a *JWTAuth) renew(now time.Time) (string, error) {
+	claims := jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(now.Add(a.cfg.ClockSkew))}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.cfg.Secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT token: %w", err)
+	}
+	a.token, a.issued = token, now
+	return token, nil
+}
+
+// RoundTripper authenticates the requests of the next round tripper (http.DefaultTransport if nil).
+// A request that is rejected by the engine is retried once with a new token, in case the token was stale.
+func (a *JWTAuth) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &jwtRoundTripper{auth: a, next: next}
+}
+
+type jwtRoundTripper struct {
+	auth *JWTAuth
+	next http.RoundTripper
+}
+
+func (rt *jwtRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := rt.auth.Token()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := rt.next.RoundTrip(authenticated(req, token))
+	if err != nil || (resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden) || req.GetBody == nil {
+		return resp, err
+	}
+	resp.Body.Close()
+	token, err = rt.auth.Renew()
+	if err != nil {
+		return nil, err
+	}
+	retry := authenticated(req, token)
+	if retry.Body, err = req.GetBody(); err != nil {
+		return nil, err
+	}
+	return rt.next.RoundTrip(retry)
+}
+
+// authenticated returns a copy of the request, with the token. Round trippers must not modify the request.
+func authenticated(req *http.Request, token string) *http.Request {
+	out := req.Clone(req.Context())
+	out.Header.Set("Authorization", "Bearer "+token)
+	return out
+}
+
+// ErrJWTOverWebsocket is returned when the engine API is authenticated over a websocket, which is not supported:
+// the tokens are only sent with the initial request, and the engine rejects them once they are stale anyway.
+var ErrJWTOverWebsocket = errors.New("JWT authentication of the engine API requires an HTTP endpoint")
@@ -0,0 +1,86 @@
+package l2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadJWTSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jwt.hex")
+	require.NoError(t, os.WriteFile(path, []byte("0x"+strings.Repeat("ab", 32)+"\n"), 0600))
+	secret, err := ReadJWTSecret(path)
+	require.NoError(t, err)
+	require.Len(t, secret, 32)
+	require.Equal(t, byte(0xab), secret[0])
+
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("ab", 16)), 0600))
+	_, err = ReadJWTSecret(path)
+	require.Error(t, err, "secret too short")
+}
+
+func TestJWTAuth(t *testing.T) {
+	secret := make([]byte, 32)
+	secret[0] = 1
+	now := time.Unix(1000, 0)
+	auth, err := NewJWTAuth(JWTConfig{Secret: secret, ClockSkew: time.Second})
+	require.NoError(t, err)
+	auth.now = func() time.Time { return now }
+
+	// the engine accepts tokens issued at its own time, which is ahead by the clock skew
+	var issued []time.Time
+	engineTime := now.Add(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var claims jwt.RegisteredClaims
+		_, err := jwt.ParseWithClaims(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &claims, func(token *jwt.Token) (interface{}, error) {
+			return secret, nil
+		}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithoutClaimsValidation())
+		require.NoError(t, err)
+		issued = append(issued, claims.IssuedAt.Time)
+		if !claims.IssuedAt.Time.Equal(engineTime) {
+			http.Error(w, "stale token", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cl := &http.Client{Transport: auth.RoundTripper(nil)}
+	post := func() int {
+		resp, err := cl.Post(srv.URL, "application/json", strings.NewReader("{}"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, post())
+	require.Len(t, issued, 1)
+
+	// the token is reused until it is too old
+	first, err := auth.Token()
+	require.NoError(t, err)
+	now = now.Add(DefaultJWTRefreshInterval / 2)
+	token, err := auth.Token()
+	require.NoError(t, err)
+	require.Equal(t, first, token)
+	now = now.Add(DefaultJWTRefreshInterval)
+	token, err = auth.Token()
+	require.NoError(t, err)
+	require.NotEqual(t, first, token)
+
+	// a rejected request is retried once with a new token
+	issued = nil
+	engineTime = now.Add(time.Second + DefaultJWTRefreshInterval/2)
+	_, err = auth.Token()
+	require.NoError(t, err)
+	now = now.Add(DefaultJWTRefreshInterval / 2)
+	require.Equal(t, http.StatusOK, post())
+	require.Len(t, issued, 2)
+}
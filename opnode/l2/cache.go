@@ -0,0 +1,99 @@
+package l2
+
+import (
+	"sync"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// blockRefCacheSize is the number of L2 block references to cache.
+// Enough to cover the L2 blocks of a few sequencing windows, which are walked back during reorgs.
+const blockRefCacheSize = 2000
+
+// blockRefCache caches recent L2 block references by hash, and the canonical chain by number.
+// Block references by hash never change, but the canonical chain changes with the forkchoice:
+// canonical blocks are only kept as long as the forkchoice extends the previous head.
+type blockRefCache struct {
+	byHash    *lru.Cache // common.Hash -> eth.L2BlockRef
+	canonical *lru.Cache // uint64 -> common.Hash
+
+	mu   sync.Mutex
+	head common.Hash
+	// gen is incremented on every purge of the canonical chain,
+	// the canonical blocks that were fetched before a purge are not added after it
+	gen uint64
+}
+
+func newBlockRefCache(size int) *blockRefCache {
+	byHash, _ := lru.New(size)
+	canonical, _ := lru.New(size)
+	return &blockRefCache{byHash: byHash, canonical: canonical}
+}
+
+func (c *blockRefCache) add(ref eth.L2BlockRef) {
+	c.byHash.Add(ref.Hash, ref)
+}
+
+// generation returns the generation of the canonical chain, to pass to addCanonical with the blocks fetched after.
+func (c *blockRefCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// addCanonical adds a block reference that was canonical in the given generation of the canonical chain.
+// It is only added as canonical if the canonical chain was not purged since.
+func (c *blockRefCache) addCanonical(ref eth.L2BlockRef, gen uint64) {
+	c.byHash.Add(ref.Hash, ref)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen == c.gen {
+		c.canonical.Add(ref.Number, ref.Hash)
+	}
+}
+
+func (c *blockRefCache) byHashGet(hash common.Hash) (eth.L2BlockRef, bool) {
+	v, ok := c.byHash.Get(hash)
+	if !ok {
+		return eth.L2BlockRef{}, false
+	}
+	return v.(eth.L2BlockRef), true
+}
+
+func (c *blockRefCache) byNumberGet(num uint64) (eth.L2BlockRef, bool) {
+	h, ok := c.canonical.Get(num)
+	if !ok {
+		return eth.L2BlockRef{}, false
+	}
+	return c.byHashGet(h.(common.Hash))
+}
+
+// updateHead updates the canonical chain for a new head: if the new head does not extend the previous head,
+// the canonical blocks are purged.
+func (c *blockRefCache) updateHead(head common.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if head == c.head {
+		return
+	}
+	ref, ok := c.byHashGet(head)
+	if !ok || ref.ParentHash != c.head {
+		c.canonical.Purge()
+		c.gen++
+	}
+	if ok {
+		c.canonical.Add(ref.Number, ref.Hash)
+	}
+	c.head = head
+}
+
+// reset purges the canonical chain, e.g. when the engine is syncing to an unknown head.
+func (c *blockRefCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.canonical.Purge()
+	c.gen++
+	c.head = common.Hash{}
+}
@@ -0,0 +1,63 @@
+package l2
+
+import (
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockRefCache(t *testing.T) {
+	ref := func(id byte, parent byte, num uint64) eth.L2BlockRef {
+		return eth.L2BlockRef{Hash: common.Hash{id}, ParentHash: common.Hash{parent}, Number: num}
+	}
+	A, B, C := ref('A', 0, 0), ref('B', 'A', 1), ref('C', 'B', 2)
+	X := ref('X', 'A', 1)
+
+	c := newBlockRefCache(10)
+	c.addCanonical(A, c.generation())
+	c.updateHead(A.Hash)
+	c.add(B)
+	_, ok := c.byNumberGet(1)
+	require.False(t, ok, "block by hash is not known to be canonical")
+	got, ok := c.byHashGet(B.Hash)
+	require.True(t, ok)
+	require.Equal(t, B, got)
+
+	// Extending the head keeps the canonical chain
+	c.updateHead(B.Hash)
+	c.addCanonical(C, c.generation())
+	c.updateHead(C.Hash)
+	for _, r := range []eth.L2BlockRef{A, B, C} {
+		got, ok := c.byNumberGet(r.Number)
+		require.True(t, ok)
+		require.Equal(t, r, got)
+	}
+
+	// A reorg purges the canonical chain, but not the blocks by hash
+	c.add(X)
+	c.updateHead(X.Hash)
+	got, ok = c.byNumberGet(1)
+	require.True(t, ok)
+	require.Equal(t, X, got, "new head is canonical")
+	_, ok = c.byNumberGet(0)
+	require.False(t, ok)
+	_, ok = c.byNumberGet(2)
+	require.False(t, ok)
+	_, ok = c.byHashGet(C.Hash)
+	require.True(t, ok)
+
+	// A block fetched before a purge is not added as canonical after it
+	gen := c.generation()
+	c.updateHead(A.Hash)
+	c.addCanonical(B, gen)
+	_, ok = c.byNumberGet(1)
+	require.False(t, ok, "stale fill")
+
+	// Syncing purges the canonical chain
+	c.addCanonical(A, c.generation())
+	c.reset()
+	_, ok = c.byNumberGet(0)
+	require.False(t, ok)
+}
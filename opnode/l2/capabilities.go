@@ -0,0 +1,116 @@
+package l2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// MethodNotFound is the JSON-RPC error code of a method that the server does not support
+const MethodNotFound ErrorCode = -32601
+
+// ErrEngineUnsupported is returned when the engine does not support a version of an engine API method that the rollup node needs.
+var ErrEngineUnsupported = errors.New("execution engine does not support the required engine API methods, it may be too old")
+
+// EngineMethods are the engine API methods that are used with an engine, one version per function of the engine API.
+type EngineMethods struct {
+	ForkchoiceUpdated string
+	ExecutePayload    string
+	GetPayload        string
+}
+
+// engineMethodVersions are the versions of the engine API methods that the rollup node implements, newest first.
+// The newest version that the engine supports is used.
+var engineMethodVersions = struct {
+	ForkchoiceUpdated []string
+	ExecutePayload    []string
+	GetPayload        []string
+}{
+	ForkchoiceUpdated: []string{"engine_forkchoiceUpdatedV1"},
+	ExecutePayload:    []string{"engine_executePayloadV1"},
+	GetPayload:        []string{"engine_getPayloadV1"},
+}
+
+// DefaultEngineMethods are the engine API methods that are used if the supported methods of the engine are not negotiated.
+var DefaultEngineMethods = EngineMethods{
+	ForkchoiceUpdated: engineMethodVersions.ForkchoiceUpdated[0],
+	ExecutePayload:    engineMethodVersions.ExecutePayload[0],
+	GetPayload:        engineMethodVersions.GetPayload[0],
+}
+
+func allEngineMethodVersions() []string {
+	var out []string
+	out = append(out, engineMethodVersions.ForkchoiceUpdated...)
+	out = append(out, engineMethodVersions.ExecutePayload...)
+	out = append(out, engineMethodVersions.GetPayload...)
+	return out
+}
+
+func isMethodNotFound(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && ErrorCode(rpcErr.ErrorCode()) == MethodNotFound
+}
+
+// engineCapabilities returns the engine API methods that the engine supports, of the given methods.
+// Engines that do not support engine_exchangeCapabilities are probed for every method instead:
+// a method is supported if calling it with an invalid parameter fails with any error other than "method not found".
+func (s *Source) engineCapabilities(ctx context.Context, methods []string) (map[string]bool, error) {
+	supported := make(map[string]bool)
+	var capabilities []string
+	err := s.call(ctx, &capabilities, "engine_exchangeCapabilities", methods)
+	if err == nil {
+		for _, m := range capabilities {
+			supported[m] = true
+		}
+		return supported, nil
+	}
+	if !isMethodNotFound(err) {
+		return nil, fmt.Errorf("failed to exchange capabilities with the engine: %w", err)
+	}
+	s.log.Debug("Engine does not support exchanging capabilities, probing the engine API methods")
+	for _, m := range methods {
+		// the parameter is not a valid argument of any engine API method, so the engine does not act on the call
+		var res interface{}
+		err := s.call(ctx, &res, m, false)
+		var rpcErr rpc.Error
+		if err != nil && !errors.As(err, &rpcErr) {
+			return nil, fmt.Errorf("failed to probe engine API method %s: %w", m, err)
+		}
+		supported[m] = !isMethodNotFound(err)
+	}
+	return supported, nil
+}
+
+// NegotiateEngineAPI selects the newest versions of the engine API methods that both the engine and the rollup node support.
+// It returns ErrEngineUnsupported if the engine supports no version of a method, so an engine that is too old
+// is rejected at startup, rather than failing with RPC errors during derivation.
+func (s *Source) NegotiateEngineAPI(ctx context.Context) (EngineMethods, error) {
+	supported, err := s.engineCapabilities(ctx, allEngineMethodVersions())
+	if err != nil {
+		return EngineMethods{}, err
+	}
+	var missing []string
+	selectMethod := func(versions []string) string {
+		for _, m := range versions {
+			if supported[m] {
+				return m
+			}
+		}
+		missing = append(missing, strings.Join(versions, " or "))
+		return ""
+	}
+	methods := EngineMethods{
+		ForkchoiceUpdated: selectMethod(engineMethodVersions.ForkchoiceUpdated),
+		ExecutePayload:    selectMethod(engineMethodVersions.ExecutePayload),
+		GetPayload:        selectMethod(engineMethodVersions.GetPayload),
+	}
+	if len(missing) > 0 {
+		return EngineMethods{}, fmt.Errorf("%w: missing %s", ErrEngineUnsupported, strings.Join(missing, ", "))
+	}
+	s.methods = methods
+	s.log.Info("Negotiated engine API", "forkchoiceUpdated", methods.ForkchoiceUpdated, "executePayload", methods.ExecutePayload, "getPayload", methods.GetPayload)
+	return methods, nil
+}
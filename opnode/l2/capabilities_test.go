@@ -0,0 +1,65 @@
+package l2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+// oldEngineAPI is an engine API without engine_exchangeCapabilities and engine_getPayloadV1
+type oldEngineAPI struct{}
+
+func (oldEngineAPI) ForkchoiceUpdatedV1(fc *ForkchoiceState, attr *PayloadAttributes) (*ForkchoiceUpdatedResult, error) {
+	return &ForkchoiceUpdatedResult{Status: UpdateSuccess}, nil
+}
+
+func (oldEngineAPI) ExecutePayloadV1(payload *ExecutionPayload) (*ExecutePayloadResult, error) {
+	return &ExecutePayloadResult{Status: ExecutionValid}, nil
+}
+
+// probedEngineAPI is an engine API without engine_exchangeCapabilities
+type probedEngineAPI struct {
+	oldEngineAPI
+}
+
+func (probedEngineAPI) GetPayloadV1(id PayloadID) (*ExecutionPayload, error) {
+	return &ExecutionPayload{}, nil
+}
+
+// capabilitiesEngineAPI is an engine API that exchanges capabilities
+type capabilitiesEngineAPI struct {
+	probedEngineAPI
+}
+
+func (capabilitiesEngineAPI) ExchangeCapabilities(methods []string) []string {
+	return []string{"engine_forkchoiceUpdatedV1", "engine_executePayloadV1", "engine_getPayloadV1", "engine_futureMethodV9"}
+}
+
+func newEngineSource(t *testing.T, api interface{}) *Source {
+	srv := rpc.NewServer()
+	require.NoError(t, srv.RegisterName("engine", api))
+	t.Cleanup(srv.Stop)
+	src, err := NewSource(rpc.DialInProc(srv), nil, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	return src
+}
+
+func TestNegotiateEngineAPI(t *testing.T) {
+	ctx := context.Background()
+	for name, api := range map[string]interface{}{"exchange": capabilitiesEngineAPI{}, "probe": probedEngineAPI{}} {
+		t.Run(name, func(t *testing.T) {
+			methods, err := newEngineSource(t, api).NegotiateEngineAPI(ctx)
+			require.NoError(t, err)
+			require.Equal(t, DefaultEngineMethods, methods)
+		})
+	}
+	t.Run("too old", func(t *testing.T) {
+		_, err := newEngineSource(t, oldEngineAPI{}).NegotiateEngineAPI(ctx)
+		require.ErrorIs(t, err, ErrEngineUnsupported)
+		require.Contains(t, err.Error(), "engine_getPayloadV1")
+	})
+}
@@ -0,0 +1,132 @@
+package l2
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
+)
+
+// ErrPayloadInvalid is returned when a payload is invalid by consensus rules, e.g. when the engine rejects it as INVALID.
+var ErrPayloadInvalid = errors.New("invalid execution payload")
+
+// DecodeTransactions decodes the transactions of the payload. Unlike Transactions, it does not panic on an invalid transaction,
+// it is safe to use with payloads from untrusted sources.
+func (payload *ExecutionPayload) DecodeTransactions() (types.Transactions, error) {
+	txs := make(types.Transactions, len(payload.TransactionsField))
+	for i, data := range payload.TransactionsField {
+		var tx types.Transaction
+		if err := tx.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("%w: transaction %d: %v", ErrPayloadInvalid, i, err)
+		}
+		txs[i] = &tx
+	}
+	return txs, nil
+}
+
+// ComputeBlockHash computes the block hash of the payload, from the block header that the payload represents.
+func (payload *ExecutionPayload) ComputeBlockHash() (common.Hash, error) {
+	txs, err := payload.DecodeTransactions()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	header := types.Header{
+		ParentHash:  payload.ParentHashField,
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    payload.FeeRecipient,
+		Root:        common.Hash(payload.StateRoot),
+		TxHash:      types.DeriveSha(txs, trie.NewStackTrie(nil)),
+		ReceiptHash: common.Hash(payload.ReceiptsRoot),
+		Bloom:       types.Bloom(payload.LogsBloom),
+		Difficulty:  common.Big0,
+		Number:      new(big.Int).SetUint64(uint64(payload.BlockNumber)),
+		GasLimit:    uint64(payload.GasLimit),
+		GasUsed:     uint64(payload.GasUsed),
+		Time:        uint64(payload.Timestamp),
+		Extra:       payload.ExtraData,
+		MixDigest:   common.Hash(payload.Random),
+		BaseFee:     payload.BaseFeePerGas.ToBig(),
+	}
+	return header.Hash(), nil
+}
+
+// BlockAsPayload converts a block of the engine to its execution payload, e.g. to serve it to other nodes.
+func BlockAsPayload(block *types.Block) (*ExecutionPayload, error) {
+	if block.BaseFee() == nil {
+		return nil, fmt.Errorf("block %s has no base fee", block.Hash())
+	}
+	baseFee, overflow := uint256.FromBig(block.BaseFee())
+	if overflow {
+		return nil, fmt.Errorf("base fee of block %s overflows", block.Hash())
+	}
+	txs := make([]Data, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode transaction %d of block %s: %w", i, block.Hash(), err)
+		}
+		txs[i] = data
+	}
+	return &ExecutionPayload{
+		ParentHashField:   block.ParentHash(),
+		FeeRecipient:      block.Coinbase(),
+		StateRoot:         Bytes32(block.Root()),
+		ReceiptsRoot:      Bytes32(block.ReceiptHash()),
+		LogsBloom:         Bytes256(block.Bloom()),
+		Random:            Bytes32(block.MixDigest()),
+		BlockNumber:       Uint64Quantity(block.NumberU64()),
+		GasLimit:          Uint64Quantity(block.GasLimit()),
+		GasUsed:           Uint64Quantity(block.GasUsed()),
+		Timestamp:         Uint64Quantity(block.Time()),
+		ExtraData:         BytesMax32(block.Extra()),
+		BaseFeePerGas:     Uint256Quantity(*baseFee),
+		BlockHash:         block.Hash(),
+		TransactionsField: txs,
+	}, nil
+}
+
+// CheckBlockHash checks that the block hash of the payload matches its contents,
+// so that the payload is identified correctly before it is executed.
+func (payload *ExecutionPayload) CheckBlockHash() error {
+	actual, err := payload.ComputeBlockHash()
+	if err != nil {
+		return err
+	}
+	if actual != payload.BlockHash {
+		return fmt.Errorf("%w: payload %s has block hash %s, but its contents hash to %s", ErrPayloadInvalid, payload.ID(), payload.BlockHash, actual)
+	}
+	return nil
+}
+
+// PayloadSigningHash is the hash that the sequencer signs to vouch for a payload: the payload is identified by its
+// block hash, and the chain ID is included so that signatures cannot be replayed on another chain.
+// The chain ID must not be nil.
+func PayloadSigningHash(chainID *big.Int, payload *ExecutionPayload) common.Hash {
+	var id [32]byte
+	chainID.FillBytes(id[:])
+	return crypto.Keccak256Hash(id[:], payload.BlockHash[:])
+}
+
+// VerifyPayloadSignature checks that the 65 byte signature over the signing hash of the payload was made by the signer.
+func VerifyPayloadSignature(chainID *big.Int, payload *ExecutionPayload, signature []byte, signer common.Address) error {
+	if chainID == nil {
+		return errors.New("the L2 chain ID is required to verify payload signatures")
+	}
+	if len(signature) != crypto.SignatureLength {
+		return fmt.Errorf("%w: signature of payload %s has %d bytes, expected %d", ErrPayloadInvalid, payload.ID(), len(signature), crypto.SignatureLength)
+	}
+	hash := PayloadSigningHash(chainID, payload)
+	pub, err := crypto.SigToPub(hash[:], signature)
+	if err != nil {
+		return fmt.Errorf("%w: invalid signature of payload %s: %v", ErrPayloadInvalid, payload.ID(), err)
+	}
+	if addr := crypto.PubkeyToAddress(*pub); addr != signer {
+		return fmt.Errorf("%w: payload %s is signed by %s, expected the sequencer %s", ErrPayloadInvalid, payload.ID(), addr, signer)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package l2
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeBlockHash(t *testing.T) {
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(901), Nonce: 3, Gas: 21000, To: &common.Address{0xaa}, Value: big.NewInt(1)})
+	header := &types.Header{
+		ParentHash:  common.Hash{1},
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    common.Address{2},
+		Root:        common.Hash{3},
+		ReceiptHash: common.Hash{4},
+		Bloom:       types.Bloom{5},
+		Difficulty:  common.Big0,
+		Number:      big.NewInt(6),
+		GasLimit:    30_000_000,
+		GasUsed:     21000,
+		Time:        7,
+		Extra:       []byte("extra"),
+		MixDigest:   common.Hash{8},
+		BaseFee:     big.NewInt(9),
+	}
+	header.TxHash = types.DeriveSha(types.Transactions{tx}, trie.NewStackTrie(nil))
+	block := types.NewBlockWithHeader(header)
+	txData, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	payload := &ExecutionPayload{
+		ParentHashField:   header.ParentHash,
+		FeeRecipient:      header.Coinbase,
+		StateRoot:         Bytes32(header.Root),
+		ReceiptsRoot:      Bytes32(header.ReceiptHash),
+		LogsBloom:         Bytes256(header.Bloom),
+		Random:            Bytes32(header.MixDigest),
+		BlockNumber:       6,
+		GasLimit:          Uint64Quantity(header.GasLimit),
+		GasUsed:           Uint64Quantity(header.GasUsed),
+		Timestamp:         Uint64Quantity(header.Time),
+		ExtraData:         header.Extra,
+		BaseFeePerGas:     *uint256.NewInt(9),
+		BlockHash:         block.Hash(),
+		TransactionsField: []Data{txData},
+	}
+	require.NoError(t, payload.CheckBlockHash())
+
+	payload.GasUsed++
+	require.ErrorIs(t, payload.CheckBlockHash(), ErrPayloadInvalid)
+	payload.GasUsed--
+	payload.TransactionsField = []Data{{0x02, 0xff}}
+	require.ErrorIs(t, payload.CheckBlockHash(), ErrPayloadInvalid, "undecodable transaction")
+}
+
+func TestVerifyPayloadSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(901)
+	payload := &ExecutionPayload{BlockHash: common.Hash{1}}
+	hash := PayloadSigningHash(chainID, payload)
+	sig, err := crypto.Sign(hash[:], key)
+	require.NoError(t, err)
+
+	require.NoError(t, VerifyPayloadSignature(chainID, payload, sig, signer))
+	require.ErrorIs(t, VerifyPayloadSignature(big.NewInt(902), payload, sig, signer), ErrPayloadInvalid, "other chain")
+	require.ErrorIs(t, VerifyPayloadSignature(chainID, &ExecutionPayload{BlockHash: common.Hash{2}}, sig, signer), ErrPayloadInvalid, "other payload")
+	require.ErrorIs(t, VerifyPayloadSignature(chainID, payload, sig[:64], signer), ErrPayloadInvalid, "short signature")
+}
+
+func TestBlockAsPayload(t *testing.T) {
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(901), Nonce: 3, Gas: 21000, To: &common.Address{0xaa}, Value: big.NewInt(1)})
+	header := &types.Header{
+		ParentHash: common.Hash{1},
+		Coinbase:   common.Address{2},
+		Root:       common.Hash{3},
+		Difficulty: common.Big0,
+		Number:     big.NewInt(6),
+		GasLimit:   30_000_000,
+		GasUsed:    21000,
+		Time:       7,
+		Extra:      []byte("extra"),
+		MixDigest:  common.Hash{8},
+		BaseFee:    big.NewInt(9),
+	}
+	block := types.NewBlock(header, types.Transactions{tx}, nil, nil, trie.NewStackTrie(nil))
+	payload, err := BlockAsPayload(block)
+	require.NoError(t, err)
+	require.Equal(t, block.Hash(), payload.BlockHash)
+	require.Equal(t, block.ParentHash(), payload.ParentHash())
+	require.Equal(t, uint64(6), uint64(payload.BlockNumber))
+	require.Len(t, payload.Transactions(), 1)
+	require.NoError(t, payload.CheckBlockHash())
+
+	header.BaseFee = nil
+	_, err = BlockAsPayload(types.NewBlockWithHeader(header))
+	require.Error(t, err, "no base fee")
+}
@@ -0,0 +1,420 @@
+package l2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// EngineClient is the engine and eth namespace of an L2 execution engine, as served by Source.
+type EngineClient interface {
+	GetPayload(ctx context.Context, payloadId PayloadID) (*ExecutionPayload, error)
+	ForkchoiceUpdate(ctx context.Context, fc *ForkchoiceState, attributes *PayloadAttributes) (*ForkchoiceUpdatedResult, error)
+	ExecutePayload(ctx context.Context, payload *ExecutionPayload) error
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	L2BlockRefByNumber(ctx context.Context, l2Num *big.Int) (eth.L2BlockRef, error)
+	L2BlockRefByHash(ctx context.Context, l2Hash common.Hash) (eth.L2BlockRef, error)
+}
+
+const (
+	primaryEngine   = 0
+	secondaryEngine = 1
+
+	// mirrorQueueSize is the number of mirrored requests that an engine may be behind the active engine,
+	// after which the requests are dropped and the engine has to sync the blocks by itself
+	mirrorQueueSize = 64
+	// mirrorTimeout is the timeout of the mirrored requests that the caller does not wait for
+	mirrorTimeout = 10 * time.Second
+	// engineHealthCheckInterval is the interval of the health checks of the engines
+	engineHealthCheckInterval = 10 * time.Second
+)
+
+// RedundantEngine drives a primary and a secondary engine as one engine, so a single engine failure does not halt the node.
+// Forkchoice updates and payloads are mirrored to both engines, to keep the secondary ready to take over.
+// Blocks are built on, and read from, the active engine: the primary while it is healthy, the secondary otherwise.
+// Mirrored requests return the result of the active engine, without waiting for the other engine.
+// The requests of each engine are queued, so each engine gets them in order.
+//
+// An engine becomes unhealthy when it cannot be reached, or when it is syncing and cannot follow the forkchoice,
+// and becomes healthy again when it accepts a mirrored forkchoice update or payload.
+// The engines are also health-checked periodically: an unhealthy engine gets the last forkchoice update again,
+// so it recovers once it synced, and the other engines are checked to be reachable.
+// An engine that missed blocks while it was down has to sync them by itself before it is healthy again.
+type RedundantEngine struct {
+	log log.Logger
+	// Events receives the engine_unhealthy and engine_recovered events, it may be nil
+	Events  *events.Bus
+	engines [2]EngineClient
+	queues  [2]chan engineRequest
+
+	mu      sync.Mutex
+	healthy [2]bool
+	// builder is the engine that the last block building was started on, to get the payload from
+	builder int
+	// forkchoice is the last mirrored forkchoice state, to check the health of an unhealthy engine with
+	forkchoice *ForkchoiceState
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+var _ EngineClient = (*RedundantEngine)(nil)
+
+// engineRequest is a request that is queued for an engine. The result is sent to done, which is buffered.
+type engineRequest struct {
+	ctx  context.Context
+	fn   func(ctx context.Context, e EngineClient) error
+	done chan error
+}
+
+func NewRedundantEngine(primary EngineClient, secondary EngineClient, log log.Logger) *RedundantEngine {
+	r := &RedundantEngine{
+		log:     log,
+		engines: [2]EngineClient{primary, secondary},
+		queues:  [2]chan engineRequest{make(chan engineRequest, mirrorQueueSize), make(chan engineRequest, mirrorQueueSize)},
+		healthy: [2]bool{true, true},
+		closing: make(chan struct{}),
+	}
+	r.wg.Add(3)
+	go r.serve(primaryEngine)
+	go r.serve(secondaryEngine)
+	go r.healthCheckLoop()
+	return r
+}
+
+// Close stops the health checks, and the requests to the engines.
+func (r *RedundantEngine) Close() {
+	close(r.closing)
+	r.wg.Wait()
+}
+
+// serve runs the queued requests of the engine in order.
+func (r *RedundantEngine) serve(i int) {
+	defer r.wg.Done()
+	for {
+		select {
+		case req := <-r.queues[i]:
+			// the caller gave up on the request while it was queued
+			if err := req.ctx.Err(); err != nil {
+				req.done <- err
+				continue
+			}
+			err := req.fn(req.ctx, r.engines[i])
+			r.checkHealth(i, err)
+			req.done <- err
+		case <-r.closing:
+			return
+		}
+	}
+}
+
+var errEngineClosed = errors.New("redundant engine is closed")
+
+// send queues the request for the engine, and returns the channel of its result.
+// If the engine is too far behind, the request is dropped, and the engine is unhealthy until it synced by itself.
+func (r *RedundantEngine) send(ctx context.Context, i int, fn func(ctx context.Context, e EngineClient) error) <-chan error {
+	req := engineRequest{ctx: ctx, fn: fn, done: make(chan error, 1)}
+	select {
+	case <-r.closing:
+		req.done <- errEngineClosed
+		return req.done
+	default:
+	}
+	select {
+	case r.queues[i] <- req:
+	default:
+		err := fmt.Errorf("engine is %d requests behind, dropped request", mirrorQueueSize)
+		r.setHealthy(i, false, err)
+		req.done <- err
+	}
+	return req.done
+}
+
+// call queues the request for the engine, and waits for its result.
+func (r *RedundantEngine) call(ctx context.Context, i int, fn func(ctx context.Context, e EngineClient) error) error {
+	select {
+	case err := <-r.send(ctx, i, fn):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.closing:
+		return errEngineClosed
+	}
+}
+
+// sendDetached queues the request for the engine without waiting for it, with its own timeout,
+// since the context of the caller may end before the request is served.
+func (r *RedundantEngine) sendDetached(i int, fn func(ctx context.Context, e EngineClient) error) <-chan error {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	return r.send(ctx, i, func(_ context.Context, e EngineClient) error {
+		defer cancel()
+		return fn(ctx, e)
+	})
+}
+
+// healthCheckLoop checks the health of the engines periodically.
+func (r *RedundantEngine) healthCheckLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(engineHealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.healthCheck()
+		case <-r.closing:
+			return
+		}
+	}
+}
+
+// healthCheck sends the last forkchoice state to the unhealthy engines, and checks that the healthy engines are reachable.
+// The checks are queued like the other requests, so a forkchoice update is never sent after a later one.
+func (r *RedundantEngine) healthCheck() {
+	for i := range r.engines {
+		r.mu.Lock()
+		healthy := r.healthy[i]
+		r.mu.Unlock()
+		if healthy {
+			r.sendDetached(i, func(ctx context.Context, e EngineClient) error {
+				_, err := e.L2BlockRefByNumber(ctx, nil)
+				if errors.Is(err, ethereum.NotFound) {
+					return nil
+				}
+				return err
+			})
+			continue
+		}
+		r.sendDetached(i, func(ctx context.Context, e EngineClient) error {
+			// the forkchoice is read when the check is served, so it is the last one
+			r.mu.Lock()
+			fc := r.forkchoice
+			r.mu.Unlock()
+			if fc == nil {
+				_, err := e.L2BlockRefByNumber(ctx, nil)
+				return err
+			}
+			_, err := e.ForkchoiceUpdate(ctx, fc, nil)
+			return err
+		})
+	}
+}
+
+func engineName(i int) string {
+	if i == primaryEngine {
+		return "primary"
+	}
+	return "secondary"
+}
+
+// isEngineFailure returns true if the error is caused by the engine being unreachable, rather than by the request,
+// which is the case when the engine did not respond with a JSON-RPC error or an execution status.
+func isEngineFailure(err error) bool {
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr) && !errors.Is(err, ethereum.NotFound) && !errors.Is(err, ErrPayloadInvalid)
+}
+
+// active returns the engine to build blocks on and read from.
+func (r *RedundantEngine) active() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.healthy[primaryEngine] && r.healthy[secondaryEngine] {
+		return secondaryEngine
+	}
+	return primaryEngine
+}
+
+func (r *RedundantEngine) setHealthy(i int, healthy bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.healthy[i] == healthy {
+		return
+	}
+	r.healthy[i] = healthy
+	if healthy {
+		r.log.Info("Engine recovered", "engine", engineName(i))
+		r.Events.Emit(events.EngineRecovered, EngineHealthEvent{Engine: engineName(i)})
+	} else {
+		r.log.Warn("Engine is unhealthy", "engine", engineName(i), "err", err)
+		r.Events.Emit(events.EngineUnhealthy, EngineHealthEvent{Engine: engineName(i), Error: err.Error()})
+	}
+}
+
+// EngineHealthEvent is the data of the events of the health changes of an engine.
+type EngineHealthEvent struct {
+	Engine string `json:"engine"`
+	Error  string `json:"error,omitempty"`
+}
+
+// checkHealth updates the health of the engine after a request.
+// JSON-RPC errors and invalid payloads are valid responses, and do not change the health.
+// Requests of a closed engine, and requests that the caller cancelled, do not change the health either.
+func (r *RedundantEngine) checkHealth(i int, err error) {
+	if err == nil {
+		r.setHealthy(i, true, nil)
+	} else if errors.Is(err, errEngineClosed) || errors.Is(err, context.Canceled) {
+		return
+	} else if errors.Is(err, ErrEngineSyncing) || isEngineFailure(err) {
+		r.setHealthy(i, false, err)
+	}
+}
+
+// mirror queues the request for both engines, and returns the engine to take the result from:
+// the active engine, without waiting for the other engine, unless the active engine failed,
+// in which case the result of the other engine is waited for, and used if it succeeded.
+func (r *RedundantEngine) mirror(ctx context.Context, fn func(ctx context.Context, i int, e EngineClient) error) (int, error) {
+	active := r.active()
+	other := 1 - active
+	otherDone := r.sendDetached(other, func(ctx context.Context, e EngineClient) error {
+		err := fn(ctx, other, e)
+		if err != nil {
+			r.log.Debug("Mirrored request failed", "engine", engineName(other), "err", err)
+		}
+		return err
+	})
+	err := r.call(ctx, active, func(ctx context.Context, e EngineClient) error {
+		return fn(ctx, active, e)
+	})
+	if err == nil {
+		return active, nil
+	}
+	select {
+	case otherErr := <-otherDone:
+		if otherErr == nil {
+			r.log.Warn("Active engine failed, using the result of the other engine", "failed", engineName(active), "err", err)
+			return other, nil
+		}
+	case <-ctx.Done():
+	}
+	return active, err
+}
+
+// read runs the request on the active engine, and fails over to the other engine if the active engine cannot be reached.
+// Reads are not queued: they do not change the state of the engine.
+func (r *RedundantEngine) read(fn func(e EngineClient) error) error {
+	active := r.active()
+	err := fn(r.engines[active])
+	if err == nil || !isEngineFailure(err) {
+		return err
+	}
+	r.setHealthy(active, false, err)
+	other := 1 - active
+	r.log.Warn("Failing over read to the other engine", "failed", engineName(active), "err", err)
+	return fn(r.engines[other])
+}
+
+// ForkchoiceUpdate mirrors the forkchoice update to both engines. If attributes is not nil,
+// the block is only built by the active engine, or by the other engine if the active engine cannot be reached.
+func (r *RedundantEngine) ForkchoiceUpdate(ctx context.Context, fc *ForkchoiceState, attributes *PayloadAttributes) (*ForkchoiceUpdatedResult, error) {
+	if attributes != nil {
+		return r.buildBlock(ctx, fc, attributes)
+	}
+	r.mu.Lock()
+	r.forkchoice = fc
+	r.mu.Unlock()
+	var results [2]*ForkchoiceUpdatedResult
+	i, err := r.mirror(ctx, func(ctx context.Context, i int, e EngineClient) error {
+		res, err := e.ForkchoiceUpdate(ctx, fc, nil)
+		results[i] = res
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[i], nil
+}
+
+func (r *RedundantEngine) buildBlock(ctx context.Context, fc *ForkchoiceState, attributes *PayloadAttributes) (*ForkchoiceUpdatedResult, error) {
+	r.mu.Lock()
+	r.forkchoice = fc
+	r.mu.Unlock()
+	var results [2]*ForkchoiceUpdatedResult
+	build := func(i int) error {
+		return r.call(ctx, i, func(ctx context.Context, e EngineClient) (err error) {
+			results[i], err = e.ForkchoiceUpdate(ctx, fc, attributes)
+			return err
+		})
+	}
+	active := r.active()
+	err := build(active)
+	if err != nil && (errors.Is(err, ErrEngineSyncing) || isEngineFailure(err)) {
+		r.log.Warn("Failing over block building to the other engine", "failed", engineName(active), "err", err)
+		active = 1 - active
+		err = build(active)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.builder = active
+	r.mu.Unlock()
+	// keep the forkchoice of the other engine up to date, it builds the next block if the builder fails
+	r.sendDetached(1-active, func(ctx context.Context, e EngineClient) error {
+		_, err := e.ForkchoiceUpdate(ctx, fc, nil)
+		return err
+	})
+	return results[active], nil
+}
+
+// GetPayload gets the payload from the engine that is building it.
+func (r *RedundantEngine) GetPayload(ctx context.Context, payloadId PayloadID) (*ExecutionPayload, error) {
+	r.mu.Lock()
+	builder := r.builder
+	r.mu.Unlock()
+	payload, err := r.engines[builder].GetPayload(ctx, payloadId)
+	if err != nil && isEngineFailure(err) {
+		r.setHealthy(builder, false, err)
+	}
+	return payload, err
+}
+
+// ExecutePayload mirrors the payload to both engines.
+func (r *RedundantEngine) ExecutePayload(ctx context.Context, payload *ExecutionPayload) error {
+	_, err := r.mirror(ctx, func(ctx context.Context, i int, e EngineClient) error {
+		return e.ExecutePayload(ctx, payload)
+	})
+	return err
+}
+
+func (r *RedundantEngine) BlockByHash(ctx context.Context, hash common.Hash) (block *types.Block, err error) {
+	err = r.read(func(e EngineClient) error {
+		block, err = e.BlockByHash(ctx, hash)
+		return err
+	})
+	return
+}
+
+func (r *RedundantEngine) BlockByNumber(ctx context.Context, number *big.Int) (block *types.Block, err error) {
+	err = r.read(func(e EngineClient) error {
+		block, err = e.BlockByNumber(ctx, number)
+		return err
+	})
+	return
+}
+
+func (r *RedundantEngine) L2BlockRefByNumber(ctx context.Context, l2Num *big.Int) (ref eth.L2BlockRef, err error) {
+	err = r.read(func(e EngineClient) error {
+		ref, err = e.L2BlockRefByNumber(ctx, l2Num)
+		return err
+	})
+	return
+}
+
+func (r *RedundantEngine) L2BlockRefByHash(ctx context.Context, l2Hash common.Hash) (ref eth.L2BlockRef, err error) {
+	err = r.read(func(e EngineClient) error {
+		ref, err = e.L2BlockRefByHash(ctx, l2Hash)
+		return err
+	})
+	return
+}
@@ -0,0 +1,223 @@
+package l2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEngine records the requests it serves, and fails them with err if set.
+type fakeEngine struct {
+	EngineClient
+	name     string
+	err      error
+	heads    []common.Hash
+	payloads []common.Hash
+	built    int
+}
+
+func (e *fakeEngine) ForkchoiceUpdate(ctx context.Context, fc *ForkchoiceState, attributes *PayloadAttributes) (*ForkchoiceUpdatedResult, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	e.heads = append(e.heads, fc.HeadBlockHash)
+	res := &ForkchoiceUpdatedResult{Status: UpdateSuccess}
+	if attributes != nil {
+		e.built++
+		res.PayloadID = &PayloadID{byte(e.built)}
+	}
+	return res, nil
+}
+
+func (e *fakeEngine) GetPayload(ctx context.Context, payloadId PayloadID) (*ExecutionPayload, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &ExecutionPayload{ExtraData: []byte(e.name)}, nil
+}
+
+func (e *fakeEngine) ExecutePayload(ctx context.Context, payload *ExecutionPayload) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.payloads = append(e.payloads, payload.BlockHash)
+	return nil
+}
+
+func (e *fakeEngine) L2BlockRefByNumber(ctx context.Context, l2Num *big.Int) (eth.L2BlockRef, error) {
+	if e.err != nil {
+		return eth.L2BlockRef{}, e.err
+	}
+	return eth.L2BlockRef{Number: l2Num.Uint64(), Hash: common.BytesToHash([]byte(e.name))}, nil
+}
+
+func TestRedundantEngine(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := &fakeEngine{name: "primary"}, &fakeEngine{name: "secondary"}
+	r := NewRedundantEngine(primary, secondary, testlog.Logger(t, log.LvlError))
+	defer r.Close()
+
+	// forkchoice updates and payloads are mirrored, blocks are built and read on the primary
+	require.NoError(t, r.ExecutePayload(ctx, &ExecutionPayload{BlockHash: common.Hash{1}}))
+	_, err := r.ForkchoiceUpdate(ctx, &ForkchoiceState{HeadBlockHash: common.Hash{1}}, nil)
+	require.NoError(t, err)
+	flush(r)
+	require.Equal(t, []common.Hash{{1}}, primary.payloads)
+	require.Equal(t, []common.Hash{{1}}, secondary.payloads)
+	require.Equal(t, []common.Hash{{1}}, secondary.heads)
+	_, err = r.ForkchoiceUpdate(ctx, &ForkchoiceState{HeadBlockHash: common.Hash{1}}, &PayloadAttributes{})
+	require.NoError(t, err)
+	flush(r)
+	require.Equal(t, 1, primary.built)
+	require.Zero(t, secondary.built)
+	payload, err := r.GetPayload(ctx, PayloadID{})
+	require.NoError(t, err)
+	require.Equal(t, "primary", string(payload.ExtraData))
+
+	// an engine that returns a JSON-RPC error is still healthy
+	primary.err = rpcError{code: -32000}
+	_, err = r.ForkchoiceUpdate(ctx, &ForkchoiceState{HeadBlockHash: common.Hash{2}}, nil)
+	require.NoError(t, err, "secondary result is used")
+	flush(r)
+	ref, err := r.L2BlockRefByNumber(ctx, big.NewInt(1))
+	require.ErrorIs(t, err, primary.err, "not failed over")
+	require.Equal(t, eth.L2BlockRef{}, ref)
+
+	// the primary crashes: blocks are built and read on the secondary
+	primary.err = errors.New("connection refused")
+	require.NoError(t, r.ExecutePayload(ctx, &ExecutionPayload{BlockHash: common.Hash{2}}))
+	_, err = r.ForkchoiceUpdate(ctx, &ForkchoiceState{HeadBlockHash: common.Hash{2}}, &PayloadAttributes{})
+	require.NoError(t, err)
+	flush(r)
+	require.Equal(t, 1, secondary.built)
+	payload, err = r.GetPayload(ctx, PayloadID{})
+	require.NoError(t, err)
+	require.Equal(t, "secondary", string(payload.ExtraData))
+	ref, err = r.L2BlockRefByNumber(ctx, big.NewInt(2))
+	require.NoError(t, err)
+	require.Equal(t, common.BytesToHash([]byte("secondary")), ref.Hash)
+
+	// the primary still syncing after a restart does not become active
+	primary.err = ErrEngineSyncing
+	_, err = r.ForkchoiceUpdate(ctx, &ForkchoiceState{HeadBlockHash: common.Hash{2}}, nil)
+	require.NoError(t, err)
+	flush(r)
+	ref, err = r.L2BlockRefByNumber(ctx, big.NewInt(2))
+	require.NoError(t, err)
+	require.Equal(t, common.BytesToHash([]byte("secondary")), ref.Hash)
+
+	// the primary becomes active again once it follows the forkchoice
+	primary.err = nil
+	_, err = r.ForkchoiceUpdate(ctx, &ForkchoiceState{HeadBlockHash: common.Hash{2}}, nil)
+	require.NoError(t, err)
+	flush(r)
+	ref, err = r.L2BlockRefByNumber(ctx, big.NewInt(2))
+	require.NoError(t, err)
+	require.Equal(t, common.BytesToHash([]byte("primary")), ref.Hash)
+
+	// both engines down
+	primary.err, secondary.err = errors.New("down"), errors.New("down")
+	require.Error(t, r.ExecutePayload(ctx, &ExecutionPayload{BlockHash: common.Hash{3}}))
+	flush(r)
+
+	// an unhealthy engine recovers with the last forkchoice update of the health check
+	primary.err, secondary.err = nil, nil
+	r.healthCheck()
+	flush(r)
+	require.Equal(t, common.Hash{2}, primary.heads[len(primary.heads)-1])
+	ref, err = r.L2BlockRefByNumber(ctx, big.NewInt(3))
+	require.NoError(t, err)
+	require.Equal(t, common.BytesToHash([]byte("primary")), ref.Hash)
+}
+
+func TestRedundantEngineNoWait(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakeEngine{name: "primary"}
+	secondary := &blockingEngine{EngineClient: &fakeEngine{name: "secondary"}, unblock: make(chan struct{})}
+	r := NewRedundantEngine(primary, secondary, testlog.Logger(t, log.LvlError))
+	defer r.Close()
+
+	// the result of the primary is returned while the secondary is still busy
+	require.NoError(t, r.ExecutePayload(ctx, &ExecutionPayload{BlockHash: common.Hash{1}}))
+	_, err := r.ForkchoiceUpdate(ctx, &ForkchoiceState{HeadBlockHash: common.Hash{1}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []common.Hash{{1}}, primary.payloads)
+	close(secondary.unblock)
+	flush(r)
+	require.Equal(t, []common.Hash{{1}}, secondary.EngineClient.(*fakeEngine).heads)
+}
+
+func TestRedundantEngineCancelled(t *testing.T) {
+	primary := &blockingEngine{EngineClient: &fakeEngine{name: "primary"}, unblock: make(chan struct{})}
+	r := NewRedundantEngine(primary, &fakeEngine{name: "secondary"}, testlog.Logger(t, log.LvlError))
+	defer r.Close()
+	defer func() {
+		select {
+		case <-primary.unblock:
+		default:
+			close(primary.unblock)
+		}
+	}()
+	execute := func(hash common.Hash) func(ctx context.Context, e EngineClient) error {
+		return func(ctx context.Context, e EngineClient) error {
+			return e.ExecutePayload(ctx, &ExecutionPayload{BlockHash: hash})
+		}
+	}
+
+	// the first payload blocks the primary, the second one is cancelled while it is queued behind it
+	first := r.send(context.Background(), primaryEngine, execute(common.Hash{1}))
+	ctx, cancel := context.WithCancel(context.Background())
+	second := make(chan error, 1)
+	go func() { second <- r.call(ctx, primaryEngine, execute(common.Hash{2})) }()
+	require.Eventually(t, func() bool { return len(r.queues[primaryEngine]) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-second, context.Canceled)
+	close(primary.unblock)
+	require.NoError(t, <-first)
+	flush(r)
+
+	require.Equal(t, []common.Hash{{1}}, primary.EngineClient.(*fakeEngine).payloads, "cancelled request is not run")
+	require.True(t, r.healthy[primaryEngine], "cancelled request does not make the engine unhealthy")
+	r.checkHealth(primaryEngine, fmt.Errorf("request failed: %w", context.Canceled))
+	require.True(t, r.healthy[primaryEngine])
+}
+
+// blockingEngine blocks the mirrored requests until unblock is closed.
+type blockingEngine struct {
+	EngineClient
+	unblock chan struct{}
+}
+
+func (e *blockingEngine) ForkchoiceUpdate(ctx context.Context, fc *ForkchoiceState, attributes *PayloadAttributes) (*ForkchoiceUpdatedResult, error) {
+	<-e.unblock
+	return e.EngineClient.ForkchoiceUpdate(ctx, fc, attributes)
+}
+
+func (e *blockingEngine) ExecutePayload(ctx context.Context, payload *ExecutionPayload) error {
+	<-e.unblock
+	return e.EngineClient.ExecutePayload(ctx, payload)
+}
+
+// flush waits until the engines served all the queued requests. The flush does not change the health of the engines.
+func flush(r *RedundantEngine) {
+	for i := range r.engines {
+		<-r.send(context.Background(), i, func(ctx context.Context, e EngineClient) error {
+			return ethereum.NotFound
+		})
+	}
+}
+
+type rpcError struct{ code int }
+
+func (e rpcError) Error() string  { return "rpc error" }
+func (e rpcError) ErrorCode() int { return e.code }
@@ -2,6 +2,7 @@ package l2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rpcmetrics"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -16,32 +18,73 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// ErrEngineSyncing is returned when the engine accepted the forkchoice or payload, but is still syncing towards it.
+var ErrEngineSyncing = errors.New("engine is syncing")
+
 type Source struct {
 	rpc     *rpc.Client       // raw RPC client. Used for the consensus namespace
 	client  *ethclient.Client // go-ethereum's wrapper around the rpc client for the eth namespace
 	genesis *rollup.Genesis
 	log     log.Logger
+
+	// blockRefs caches the L2 block references, shared by the driver and the sync algorithms that use this source
+	blockRefs *blockRefCache
+
+	// methods are the versions of the engine API methods to use, see NegotiateEngineAPI
+	methods EngineMethods
+
+	// metrics records the RPC calls to the engine, nothing is recorded if nil. See WithMetrics.
+	metrics *rpcmetrics.Metrics
 }
 
 func NewSource(ll2Node *rpc.Client, genesis *rollup.Genesis, log log.Logger) (*Source, error) {
 	return &Source{
-		rpc:     ll2Node,
-		client:  ethclient.NewClient(ll2Node),
-		genesis: genesis,
-		log:     log,
+		rpc:       ll2Node,
+		client:    ethclient.NewClient(ll2Node),
+		genesis:   genesis,
+		log:       log,
+		blockRefs: newBlockRefCache(blockRefCacheSize),
+		methods:   DefaultEngineMethods,
 	}, nil
 }
 
+// WithMetrics records the RPC calls to the engine with the metrics.
+func (s *Source) WithMetrics(m *rpcmetrics.Metrics) *Source {
+	s.metrics = m
+	return s
+}
+
 func (s *Source) Close() {
 	s.rpc.Close()
 }
 
+// call calls the engine, and records the call.
+func (s *Source) call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return rpcmetrics.Call(ctx, s.rpc, s.metrics, result, method, args...)
+}
+
 func (s *Source) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
-	return s.client.BlockByHash(ctx, hash)
+	start := time.Now()
+	block, err := s.client.BlockByHash(ctx, hash)
+	s.recordBlock("eth_getBlockByHash", start, block, err)
+	return block, err
 }
 
 func (s *Source) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
-	return s.client.BlockByNumber(ctx, number)
+	start := time.Now()
+	block, err := s.client.BlockByNumber(ctx, number)
+	s.recordBlock("eth_getBlockByNumber", start, block, err)
+	return block, err
+}
+
+// recordBlock records a block request. The JSON response is decoded by the ethclient,
+// so the size of the block is recorded as the size of its RLP encoding instead.
+func (s *Source) recordBlock(method string, start time.Time, block *types.Block, err error) {
+	size := -1
+	if block != nil {
+		size = int(block.Size())
+	}
+	s.metrics.Record(method, start, size, err)
 }
 
 // ForkchoiceUpdate updates the forkchoice on the execution client. If attributes is not nil, the engine client will also begin building a block
@@ -53,7 +96,7 @@ func (s *Source) ForkchoiceUpdate(ctx context.Context, fc *ForkchoiceState, attr
 	fcCtx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	var result ForkchoiceUpdatedResult
-	err := s.rpc.CallContext(fcCtx, &result, "engine_forkchoiceUpdatedV1", fc, attributes)
+	err := s.call(fcCtx, &result, s.methods.ForkchoiceUpdated, fc, attributes)
 	if err == nil {
 		e.Debug("Shared forkchoice-updated signal")
 		if attributes != nil {
@@ -67,11 +110,15 @@ func (s *Source) ForkchoiceUpdate(ctx context.Context, fc *ForkchoiceState, attr
 		} else {
 			e.Error("Failed to share forkchoice-updated signal")
 		}
+		return nil, fmt.Errorf("failed to update forkchoice to %s: %w", fc.HeadBlockHash, err)
 	}
 	switch result.Status {
 	case UpdateSyncing:
-		return nil, fmt.Errorf("updated forkchoice, but node is syncing: %v", err)
+		// the canonical chain of the engine changes while it syncs
+		s.blockRefs.reset()
+		return nil, fmt.Errorf("updated forkchoice to %s: %w", fc.HeadBlockHash, ErrEngineSyncing)
 	case UpdateSuccess:
+		s.blockRefs.updateHead(fc.HeadBlockHash)
 		return &result, nil
 	default:
 		return nil, fmt.Errorf("unknown forkchoice status on %s: %q, ", fc.SafeBlockHash, string(result.Status))
@@ -86,20 +133,23 @@ func (s *Source) ExecutePayload(ctx context.Context, payload *ExecutionPayload)
 	execCtx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	var result ExecutePayloadResult
-	err := s.rpc.CallContext(execCtx, &result, "engine_executePayloadV1", payload)
+	err := s.call(execCtx, &result, s.methods.ExecutePayload, payload)
 	e.Debug("Received payload execution result", "status", result.Status, "latestValidHash", result.LatestValidHash, "message", result.ValidationError)
 	if err != nil {
 		e.Error("Payload execution failed", "err", err)
-		return fmt.Errorf("failed to execute payload: %v", err)
+		return fmt.Errorf("failed to execute payload: %w", err)
 	}
 
 	switch result.Status {
 	case ExecutionValid:
+		if ref, err := derive.BlockReferences(payload, s.genesis); err == nil {
+			s.blockRefs.add(ref)
+		}
 		return nil
 	case ExecutionSyncing:
-		return fmt.Errorf("failed to execute payload %s, node is syncing, latest valid hash is %s", payload.ID(), result.LatestValidHash)
+		return fmt.Errorf("failed to execute payload %s, latest valid hash is %s: %w", payload.ID(), result.LatestValidHash, ErrEngineSyncing)
 	case ExecutionInvalid:
-		return fmt.Errorf("execution payload %s was INVALID! Latest valid hash is %s, ignoring bad block: %q", payload.ID(), result.LatestValidHash, result.ValidationError)
+		return fmt.Errorf("%w: execution payload %s was INVALID! Latest valid hash is %s, ignoring bad block: %q", ErrPayloadInvalid, payload.ID(), result.LatestValidHash, result.ValidationError)
 	default:
 		return fmt.Errorf("unknown execution status on %s: %q, ", payload.ID(), string(result.Status))
 	}
@@ -110,7 +160,7 @@ func (s *Source) GetPayload(ctx context.Context, payloadId PayloadID) (*Executio
 	e := s.log.New("payload_id", payloadId)
 	e.Debug("getting payload")
 	var result ExecutionPayload
-	err := s.rpc.CallContext(ctx, &result, "engine_getPayloadV1", payloadId)
+	err := s.call(ctx, &result, s.methods.GetPayload, payloadId)
 	if err != nil {
 		e = log.New("payload_id", "err", err)
 		if rpcErr, ok := err.(rpc.Error); ok {
@@ -131,20 +181,39 @@ func (s *Source) GetPayload(ctx context.Context, payloadId PayloadID) (*Executio
 
 // L2BlockRefByNumber returns the canonical block and parent ids.
 func (s *Source) L2BlockRefByNumber(ctx context.Context, l2Num *big.Int) (eth.L2BlockRef, error) {
-	block, err := s.client.BlockByNumber(ctx, l2Num)
+	if l2Num != nil {
+		if ref, ok := s.blockRefs.byNumberGet(l2Num.Uint64()); ok {
+			return ref, nil
+		}
+	}
+	gen := s.blockRefs.generation()
+	block, err := s.BlockByNumber(ctx, l2Num)
 	if err != nil {
 		// w%: wrap the error, we still need to detect if a canonical block is not found, a.k.a. end of chain.
 		return eth.L2BlockRef{}, fmt.Errorf("failed to determine block-hash of height %v, could not get header: %w", l2Num, err)
 	}
-	return derive.BlockReferences(block, s.genesis)
+	ref, err := derive.BlockReferences(block, s.genesis)
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	s.blockRefs.addCanonical(ref, gen)
+	return ref, nil
 }
 
 // L2BlockRefByHash returns the block & parent ids based on the supplied hash. The returned BlockRef may not be in the canonical chain
 func (s *Source) L2BlockRefByHash(ctx context.Context, l2Hash common.Hash) (eth.L2BlockRef, error) {
-	block, err := s.client.BlockByHash(ctx, l2Hash)
+	if ref, ok := s.blockRefs.byHashGet(l2Hash); ok {
+		return ref, nil
+	}
+	block, err := s.BlockByHash(ctx, l2Hash)
 	if err != nil {
 		// w%: wrap the error, we still need to detect if a canonical block is not found, a.k.a. end of chain.
 		return eth.L2BlockRef{}, fmt.Errorf("failed to determine block-hash of height %v, could not get header: %w", l2Hash, err)
 	}
-	return derive.BlockReferences(block, s.genesis)
+	ref, err := derive.BlockReferences(block, s.genesis)
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	s.blockRefs.add(ref)
+	return ref, nil
 }
@@ -0,0 +1,51 @@
+// Package networks is the registry of the rollup configs of the known deployments, which are embedded in the node,
+// so that a node of a known deployment can be run by its name instead of with a config file.
+package networks
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+)
+
+// The rollup config of each network is in configs/<name>.json.
+// The devnet config is the config of the local devnet in ops/, and must be updated with it.
+//
+//go:embed configs/*.json
+var configs embed.FS
+
+// Names returns the names of the known networks, in alphabetical order.
+func Names() []string {
+	entries, err := configs.ReadDir("configs")
+	if err != nil {
+		panic(fmt.Errorf("failed to list embedded network configs: %w", err))
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config returns the rollup config of the known network with the given name.
+func Config(name string) (*rollup.Config, error) {
+	// the name is a file name, not a path into the embedded configs
+	if strings.ContainsAny(name, "/\\.") {
+		return nil, fmt.Errorf("invalid network name %q", name)
+	}
+	data, err := configs.ReadFile(path.Join("configs", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown network %q, known networks are: %s", name, strings.Join(Names(), ", "))
+	}
+	cfg, err := rollup.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("network %s: %w", name, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,40 @@
+package networks
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigs(t *testing.T) {
+	names := Names()
+	require.Contains(t, names, "devnet")
+	for _, name := range names {
+		cfg, err := Config(name)
+		require.NoError(t, err, name)
+		require.NoError(t, cfg.Check(), name)
+	}
+}
+
+func TestUnknownNetwork(t *testing.T) {
+	_, err := Config("mainnet")
+	require.ErrorContains(t, err, "unknown network \"mainnet\"")
+	_, err = Config("../configs/devnet")
+	require.Error(t, err)
+}
+
+func TestDevnetMatchesOps(t *testing.T) {
+	data, err := os.ReadFile("../../ops/rollup.json")
+	if os.IsNotExist(err) {
+		t.Skip("ops devnet is not available")
+	}
+	require.NoError(t, err)
+	ops, err := rollup.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	devnet, err := Config("devnet")
+	require.NoError(t, err)
+	require.Equal(t, ops, devnet, "the devnet config must be updated with the ops devnet")
+}
@@ -2,15 +2,26 @@ package node
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/bss"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/p2p"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 type l2EthClient interface {
@@ -19,24 +30,266 @@ type l2EthClient interface {
 	GetProof(ctx context.Context, address common.Address, blockTag string) (*AccountResult, error)
 }
 
+type driverClient interface {
+	StartSequencer(ctx context.Context, blockHash common.Hash) error
+	StopSequencer(ctx context.Context) (common.Hash, error)
+	SequencerActive(ctx context.Context) (bool, error)
+	ResetChain(ctx context.Context, blockHash common.Hash) error
+	PauseDerivation(ctx context.Context) error
+	ResumeDerivation(ctx context.Context) error
+	DeriveBlock(ctx context.Context, num uint64) (*driver.DerivedBlock, error)
+	OnUnsafeL2Payload(ctx context.Context, payload *driver.UnsafePayload) error
+}
+
+type syncClient interface {
+	SyncStatus(ctx context.Context) (*driver.SyncStatus, error)
+	// SubscribeHeadChanges must not block on the channel: events for a full channel are dropped.
+	SubscribeHeadChanges(ch chan<- driver.HeadEvent) event.Subscription
+	ReorgHistory() []driver.ReorgEvent
+	BatchInclusion(ctx context.Context, l2Hash common.Hash) ([]index.BatchInclusion, error)
+	L2BlocksByBatchTx(ctx context.Context, txHash common.Hash) ([]eth.BlockID, error)
+}
+
+// logController changes the log output at runtime, see LogHandler.
+type logController interface {
+	SetLevel(module string, lvl string) error
+	SetFormat(format string) error
+}
+
+// peerController lists, inspects and bans the peers of the p2p stack, see p2p.Node.
+type peerController interface {
+	Peers() []p2p.PeerInfo
+	Self() *p2p.SelfInfo
+	Stats() *p2p.Stats
+	BanPeer(id peer.ID, duration time.Duration) error
+	UnbanPeer(id peer.ID) error
+}
+
+var errP2PDisabled = errors.New("the p2p stack is disabled")
+
+type adminAPI struct {
+	dr    driverClient
+	logs  logController
+	peers peerController
+}
+
+func newAdminAPI(dr driverClient, logs logController, peers peerController) *adminAPI {
+	return &adminAPI{
+		dr:    dr,
+		logs:  logs,
+		peers: peers,
+	}
+}
+
+// StartSequencer activates block production, building on top of the given unsafe head block hash.
+func (n *adminAPI) StartSequencer(ctx context.Context, blockHash common.Hash) error {
+	return n.dr.StartSequencer(ctx, blockHash)
+}
+
+// StopSequencer halts block production, and returns the unsafe head block hash it stopped at,
+// so another sequencer can continue from there.
+func (n *adminAPI) StopSequencer(ctx context.Context) (common.Hash, error) {
+	return n.dr.StopSequencer(ctx)
+}
+
+// SequencerActive returns true if the node is currently producing blocks.
+func (n *adminAPI) SequencerActive(ctx context.Context) (bool, error) {
+	return n.dr.SequencerActive(ctx)
+}
+
+// ResetChain rewinds the L2 chain to the given block hash, to recover from a bad block: the block becomes the unsafe head,
+// and if it is not ahead of the safe head, the L2 chain is derived again from there.
+func (n *adminAPI) ResetChain(ctx context.Context, blockHash common.Hash) error {
+	return n.dr.ResetChain(ctx, blockHash)
+}
+
+// PauseDerivation stops the safe head from advancing during an emergency response, e.g. while a bad batch is investigated.
+// New L1 heads are still tracked, and unsafe blocks are still inserted.
+func (n *adminAPI) PauseDerivation(ctx context.Context) error {
+	return n.dr.PauseDerivation(ctx)
+}
+
+// ResumeDerivation continues the derivation paused by PauseDerivation.
+func (n *adminAPI) ResumeDerivation(ctx context.Context) error {
+	return n.dr.ResumeDerivation(ctx)
+}
+
+// SetLogLevel sets the log level of the module, e.g. "driver", "derive", "l1", "l2", "bss" or "rpc",
+// or the default log level if the module is omitted. An empty level resets the module to the default level.
+func (n *adminAPI) SetLogLevel(ctx context.Context, lvl string, module *string) error {
+	if n.logs == nil {
+		return errors.New("the log output cannot be changed at runtime")
+	}
+	var m string
+	if module != nil {
+		m = *module
+	}
+	return n.logs.SetLevel(m, lvl)
+}
+
+// SetLogFormat switches the log output to the format: "text", "terminal", "json" or "json-pretty".
+func (n *adminAPI) SetLogFormat(ctx context.Context, format string) error {
+	if n.logs == nil {
+		return errors.New("the log output cannot be changed at runtime")
+	}
+	return n.logs.SetFormat(format)
+}
+
+// Peers returns the connected peers, and the banned peers, with their scores.
+func (n *adminAPI) Peers(ctx context.Context) ([]p2p.PeerInfo, error) {
+	if n.peers == nil {
+		return nil, errP2PDisabled
+	}
+	return n.peers.Peers(), nil
+}
+
+// BanPeer disconnects the peer, and refuses its connections for the duration, e.g. "30m",
+// or for p2p.DefaultBanDuration if the duration is omitted.
+func (n *adminAPI) BanPeer(ctx context.Context, id peer.ID, duration *string) error {
+	if n.peers == nil {
+		return errP2PDisabled
+	}
+	d := p2p.DefaultBanDuration
+	if duration != nil {
+		var err error
+		d, err = time.ParseDuration(*duration)
+		if err != nil {
+			return fmt.Errorf("invalid ban duration: %w", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("ban duration must be positive, got %s", d)
+		}
+	}
+	return n.peers.BanPeer(id, d)
+}
+
+// UnbanPeer lifts the ban of the peer, whether it was banned by BanPeer or for its score.
+func (n *adminAPI) UnbanPeer(ctx context.Context, id peer.ID) error {
+	if n.peers == nil {
+		return errP2PDisabled
+	}
+	return n.peers.UnbanPeer(id)
+}
+
+// p2pAPI reports the state of the p2p stack, to debug the gossip of the unsafe blocks.
+type p2pAPI struct {
+	peers peerController
+}
+
+// Peers returns the connected peers, and the banned peers, with their scores and traffic.
+func (n *p2pAPI) Peers(ctx context.Context) ([]p2p.PeerInfo, error) {
+	return n.peers.Peers(), nil
+}
+
+// Self returns the peer ID, the addresses, the protocols and the gossip topics of the node.
+func (n *p2pAPI) Self(ctx context.Context) (*p2p.SelfInfo, error) {
+	return n.peers.Self(), nil
+}
+
+// Stats returns the numbers of peers, the peers of the gossip topics, and the counts and rates of the gossip messages.
+func (n *p2pAPI) Stats(ctx context.Context) (*p2p.Stats, error) {
+	return n.peers.Stats(), nil
+}
+
+type debugAPI struct {
+	dr driverClient
+}
+
+// DeriveBlock derives the L2 block with the given number again, from the L1 data of its epoch,
+// and returns the derived attributes next to the canonical block, with the fields that differ.
+func (n *debugAPI) DeriveBlock(ctx context.Context, number hexutil.Uint64) (*driver.DerivedBlock, error) {
+	return n.dr.DeriveBlock(ctx, uint64(number))
+}
+
+// PostUnsafePayload queues an unsafe L2 payload, e.g. from the sequencer, to be inserted into the engine once its parent
+// is the unsafe head. Payloads may be posted out of order. The signature of the sequencer over the payload is optional:
+// the admin RPC is trusted, and is not banned for invalid payloads.
+func (n *adminAPI) PostUnsafePayload(ctx context.Context, payload *l2.ExecutionPayload, signature *hexutil.Bytes) error {
+	up := &driver.UnsafePayload{Payload: payload, Source: "rpc", Trusted: true}
+	if signature != nil {
+		up.Signature = *signature
+	}
+	return n.dr.OnUnsafeL2Payload(ctx, up)
+}
+
+type submitterClient interface {
+	Status() bss.SubmitterStatus
+}
+
+type batcherAPI struct {
+	submitter submitterClient
+}
+
+// Status returns the in-flight batch submission transactions and the depth of the submission queue.
+func (b *batcherAPI) Status(ctx context.Context) (bss.SubmitterStatus, error) {
+	return b.submitter.Status(), nil
+}
+
 type nodeAPI struct {
+	config                 *rollup.Config
+	version                VersionInfo
 	client                 l2EthClient
+	syncer                 syncClient
 	withdrawalContractAddr common.Address
 	log                    log.Logger
 }
 
-func newNodeAPI(l2Client l2EthClient, withdrawalContractAddr common.Address, log log.Logger) *nodeAPI {
+func newNodeAPI(config *rollup.Config, version VersionInfo, l2Client l2EthClient, syncer syncClient, withdrawalContractAddr common.Address, log log.Logger) *nodeAPI {
 	return &nodeAPI{
+		config:                 config,
+		version:                version,
 		client:                 l2Client,
+		syncer:                 syncer,
 		withdrawalContractAddr: withdrawalContractAddr,
 		log:                    log,
 	}
 }
 
-func (n *nodeAPI) OutputAtBlock(ctx context.Context, number rpc.BlockNumber) ([]l2.Bytes32, error) {
-	// TODO: rpc.BlockNumber doesn't support the "safe" tag. Need a new type
+// OutputBlockNumber is the L2 block to compute the output of: a block number, "latest" or "pending",
+// or the "safe" and "finalized" L2 heads of the rollup node.
+type OutputBlockNumber struct {
+	Label  eth.BlockLabel
+	Number rpc.BlockNumber
+}
+
+func (b *OutputBlockNumber) UnmarshalJSON(data []byte) error {
+	var label string
+	if err := json.Unmarshal(data, &label); err == nil {
+		switch eth.BlockLabel(label) {
+		case eth.Safe, eth.Finalized:
+			*b = OutputBlockNumber{Label: eth.BlockLabel(label)}
+			return nil
+		}
+	}
+	return b.Number.UnmarshalJSON(data)
+}
+
+// blockTag returns the block tag to fetch the block with from the L2 node, resolving the safe and finalized labels with the rollup node heads.
+func (n *nodeAPI) blockTag(ctx context.Context, b OutputBlockNumber) (string, error) {
+	if b.Label == "" {
+		return toBlockNumArg(b.Number), nil
+	}
+	if n.syncer == nil {
+		return "", fmt.Errorf("the %s L2 head is not available", b.Label)
+	}
+	status, err := n.syncer.SyncStatus(ctx)
+	if err != nil {
+		return "", err
+	}
+	if b.Label == eth.Safe {
+		return hexutil.EncodeUint64(status.SafeL2.Number), nil
+	}
+	return hexutil.EncodeUint64(status.FinalizedL2.Number), nil
+}
 
-	head, err := n.client.GetBlockHeader(ctx, toBlockNumArg(number))
+// OutputAtBlock returns the version and the output root of the L2 block: the commitment to the block hash, the state root,
+// and the storage root of the withdrawal contract, which is fetched with a proof that is verified against the state root.
+func (n *nodeAPI) OutputAtBlock(ctx context.Context, number OutputBlockNumber) ([]l2.Bytes32, error) {
+	tag, err := n.blockTag(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	head, err := n.client.GetBlockHeader(ctx, tag)
 	if err != nil {
 		n.log.Error("failed to get block", "err", err)
 		return nil, err
@@ -45,7 +298,8 @@ func (n *nodeAPI) OutputAtBlock(ctx context.Context, number rpc.BlockNumber) ([]
 		return nil, ethereum.NotFound
 	}
 
-	proof, err := n.client.GetProof(ctx, n.withdrawalContractAddr, toBlockNumArg(number))
+	// the proof is fetched by the number of the header, as a label may refer to another block by now
+	proof, err := n.client.GetProof(ctx, n.withdrawalContractAddr, hexutil.EncodeUint64(head.Number.Uint64()))
 	if err != nil {
 		n.log.Error("failed to get contract proof", "err", err)
 		return nil, err
@@ -65,6 +319,99 @@ func (n *nodeAPI) OutputAtBlock(ctx context.Context, number rpc.BlockNumber) ([]
 	return []l2.Bytes32{l2OutputRootVersion, l2OutputRoot}, nil
 }
 
+// RollupConfig returns the rollup chain parameters that the node derives the L2 chain with.
+func (n *nodeAPI) RollupConfig(ctx context.Context) (*rollup.Config, error) {
+	return n.config, nil
+}
+
+// Version returns the version of the rollup node, and the optional features that are enabled.
+func (n *nodeAPI) Version(ctx context.Context) (VersionInfo, error) {
+	return n.version, nil
+}
+
+// SyncStatus returns the sync state of the rollup node and its engine: the L1 and L2 heads, the derivation progress,
+// and whether the engine is syncing by itself.
+func (n *nodeAPI) SyncStatus(ctx context.Context) (*driver.SyncStatus, error) {
+	if n.syncer == nil {
+		return nil, errors.New("sync status is not available")
+	}
+	return n.syncer.SyncStatus(ctx)
+}
+
+// ReorgHistory returns the last reorgs of the unsafe and safe L2 heads, oldest first: the old and new head,
+// the number of blocks that were reorged out, and the L1 head at the time.
+func (n *nodeAPI) ReorgHistory(ctx context.Context) ([]driver.ReorgEvent, error) {
+	if n.syncer == nil {
+		return nil, errors.New("reorg history is not available")
+	}
+	return n.syncer.ReorgHistory(), nil
+}
+
+// BatchInclusion returns where the batch data that the safe L2 block with the given hash was derived from is on L1:
+// the L1 block, the index of the item of batch data in it, and the L1 transaction if known.
+// Deposit-only blocks have no batch data.
+func (n *nodeAPI) BatchInclusion(ctx context.Context, l2Hash common.Hash) ([]index.BatchInclusion, error) {
+	if n.syncer == nil {
+		return nil, errors.New("batch inclusion is not available")
+	}
+	return n.syncer.BatchInclusion(ctx, l2Hash)
+}
+
+// L2BlocksByBatchTx returns the canonical L2 blocks that were derived from the batch data of the given L1 transaction.
+func (n *nodeAPI) L2BlocksByBatchTx(ctx context.Context, txHash common.Hash) ([]eth.BlockID, error) {
+	if n.syncer == nil {
+		return nil, errors.New("batch inclusion is not available")
+	}
+	return n.syncer.L2BlocksByBatchTx(ctx, txHash)
+}
+
+// headEventsBuffer is the number of head events that are buffered per subscription.
+// The driver drops the events of a subscription with a full buffer, e.g. of a slow websocket client.
+const headEventsBuffer = 64
+
+// Heads subscribes to the changes of the L2 heads, of the given kinds or of all heads if none are given.
+// Each event has the previous and new head, and the number of blocks that were reorged out.
+// Subscriptions are only available over websockets.
+func (n *nodeAPI) Heads(ctx context.Context, kinds *[]driver.HeadKind) (*rpc.Subscription, error) {
+	if n.syncer == nil {
+		return nil, errors.New("head events are not available")
+	}
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	wanted := map[driver.HeadKind]bool{driver.UnsafeHead: true, driver.SafeHead: true, driver.FinalizedHead: true}
+	if kinds != nil && len(*kinds) > 0 {
+		wanted = make(map[driver.HeadKind]bool)
+		for _, k := range *kinds {
+			wanted[k] = true
+		}
+	}
+	rpcSub := notifier.CreateSubscription()
+	events := make(chan driver.HeadEvent, headEventsBuffer)
+	sub := n.syncer.SubscribeHeadChanges(events)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-events:
+				if !wanted[ev.Kind] {
+					continue
+				}
+				if err := notifier.Notify(rpcSub.ID, ev); err != nil {
+					n.log.Warn("Failed to notify head event", "err", err)
+					return
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
 func toBlockNumArg(number rpc.BlockNumber) string {
 	if number == rpc.LatestBlockNumber {
 		return "latest"
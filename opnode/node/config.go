@@ -2,10 +2,22 @@ package node
 
 import (
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/bss"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/heartbeat"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l1"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/p2p"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/tracing"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type Config struct {
@@ -14,22 +26,81 @@ type Config struct {
 	L2EngineAddrs []string // Addresses of L2 Engine JSON-RPC endpoints to use (engine and eth namespace required)
 	L2NodeAddr    string   // Address of L2 User JSON-RPC endpoint to use (eth namespace required)
 
+	// L2SecondaryEngineAddr is the address of a secondary engine that mirrors the first L2 engine,
+	// to fail over to when the first engine is unhealthy. No secondary engine is used if empty.
+	L2SecondaryEngineAddr string
+
+	// L2EngineAuth authenticates the connections with the L2 engines, if the JWT secret is set
+	L2EngineAuth l2.JWTConfig
+
 	// L1TrustRPC: if we trust the L1 RPC we do not have to validate L1 response contents like headers
-	// against block hashes, or cached transaction sender addresses.
+	// against block hashes, transactions against the transactions root, or transaction sender addresses.
+	// Receipts are always verified against the receipts root.
 	// Thus we can sync faster at the risk of the source RPC being wrong.
 	L1TrustRPC bool
 
-	Rollup rollup.Config
+	// L1FallbackAddrs are the addresses of L1 User JSON-RPC endpoints to fail over to when L1NodeAddr fails, in order of preference
+	L1FallbackAddrs []string
+	// L1Failover configures the health checks and the cross-checking of the L1 endpoints, if there are fallback endpoints
+	L1Failover l1.FailoverConfig
+	// L1RateLimit limits the rate of requests to the L1 endpoints
+	L1RateLimit l1.RateLimitConfig
+	// L1PollInterval is the interval to poll the L1 head at while the L1 head subscription is down, eth.DefaultHeadPollInterval if 0
+	L1PollInterval time.Duration
+	// L1BeaconHeaders verifies that the L1 blocks of the L1 RPC are canonical against the beacon node at Driver.L1BeaconAddr,
+	// and follows the L1 head of the beacon node instead of the L1 RPC. Requires the L1 RPC not to be trusted.
+	L1BeaconHeaders bool
+
+	// DataDir is the directory to persist the node data in. The data is kept in memory if empty.
+	DataDir string
+
+	Driver driver.Config
 
-	// Sequencer flag, enables sequencing
-	Sequencer bool
+	Rollup rollup.Config
 
 	// SubmitterPrivKey, temporary config var while the batch-submitter is part of the rollup node
 	SubmitterPrivKey *ecdsa.PrivateKey
+	// SubmitterSigner is the remote signer of the batch submission transactions, used instead of SubmitterPrivKey if set
+	SubmitterSigner bss.RemoteSignerConfig
+	// SubmitterKMS is the AWS KMS key of the batch submission transactions, used instead of SubmitterPrivKey if set
+	SubmitterKMS bss.AWSKMSConfig
+	// SubmitterTxManager configures the nonces, fees and replacements of the batch submission transactions
+	SubmitterTxManager bss.TxManagerConfig
+	// SubmitterMaxTxDataSize is the maximum size of the data of a batch submission transaction, bss.DefaultMaxTxDataSize if 0
+	SubmitterMaxTxDataSize int
+	// SubmitterMaxTxGas is the maximum gas of a batch submission transaction, no limit if 0
+	SubmitterMaxTxGas uint64
+	// SubmitterDryRun logs the batch submission transactions instead of sending them
+	SubmitterDryRun bool
+	// SubmitterBlobs submits the batches in blob transactions instead of in calldata
+	SubmitterBlobs bool
+	// BatchCompression is the compression of the submitted batches: "none" (or empty) or "zlib"
+	BatchCompression string
+	// SpanBatches submits span batches that each cover multiple L2 blocks, instead of a batch per block
+	SpanBatches bool
+
+	// P2P configures the gossip of the unsafe blocks of the sequencer, the p2p stack is disabled if nil
+	P2P *p2p.Config
 
 	RPCListenAddr          string
 	RPCListenPort          int
+	RPCEnableAdmin         bool
 	WithdrawalContractAddr common.Address
+
+	// RPCReadyMaxStaleness is the time that the L1 head and the derivation may stall before the node reports not to be ready,
+	// DefaultReadyMaxStaleness if 0
+	RPCReadyMaxStaleness time.Duration
+
+	// Metrics configures the collection of the metrics of the node, and the server of the metrics
+	Metrics MetricsConfig
+	// Pprof configures the server of the runtime profiles of the node
+	Pprof PprofConfig
+	// Tracing configures the export of the trace spans of the derivation, the sequencing and the batch submission
+	Tracing tracing.Config
+	// Heartbeat configures the opt-in heartbeats that report the health of the node to the network operators
+	Heartbeat heartbeat.Config
+	// Events configures the sinks of the structured records of the significant events of the node, for alerting
+	Events events.Config
 }
 
 // Check verifies that the given configuration makes sense
@@ -37,6 +108,62 @@ func (cfg *Config) Check() error {
 	if err := cfg.Rollup.Check(); err != nil {
 		return fmt.Errorf("rollup config error: %v", err)
 	}
+	if _, err := derive.BundleTypeForCompression(cfg.BatchCompression); err != nil {
+		return err
+	}
+	if cfg.L1BeaconHeaders {
+		if cfg.Driver.L1BeaconAddr == "" {
+			return errors.New("the L1 beacon node address is required to verify the L1 blocks against the beacon chain")
+		}
+		if cfg.L1TrustRPC {
+			return errors.New("the L1 RPC must not be trusted to verify the L1 blocks against the beacon chain")
+		}
+	}
+	if cfg.SubmitterSigner.Addr != "" && cfg.SubmitterKMS.KeyID != "" {
+		return errors.New("the batch submitter cannot use both a remote signer and a KMS key")
+	}
+	if err := cfg.SubmitterKMS.Check(); err != nil {
+		return fmt.Errorf("batch submitter KMS config error: %w", err)
+	}
+	if cfg.SubmitterBlobs && cfg.SubmitterSigner.Addr != "" {
+		return errors.New("the remote signer cannot sign blob transactions, use the batch submitter key to submit blobs")
+	}
+	if err := cfg.Metrics.Check(); err != nil {
+		return fmt.Errorf("metrics config error: %w", err)
+	}
+	if err := cfg.Pprof.Check(); err != nil {
+		return fmt.Errorf("pprof config error: %w", err)
+	}
+	if err := cfg.Tracing.Check(); err != nil {
+		return fmt.Errorf("tracing config error: %w", err)
+	}
+	if err := cfg.Heartbeat.Check(); err != nil {
+		return fmt.Errorf("heartbeat config error: %w", err)
+	}
+	if err := cfg.Events.Check(); err != nil {
+		return fmt.Errorf("events config error: %w", err)
+	}
+	if cfg.P2P != nil {
+		if err := cfg.P2P.Check(); err != nil {
+			return fmt.Errorf("p2p config error: %w", err)
+		}
+		// the gossip topics and the payload signatures are specific to the L2 chain
+		if cfg.Rollup.L2ChainID == nil {
+			return errors.New("the L2 chain ID of the rollup is required by the p2p stack")
+		}
+		// the gossiped payloads are only accepted if signed by the sequencer
+		if cfg.Rollup.P2PSequencerAddress == (common.Address{}) {
+			return errors.New("the p2p sequencer address of the rollup is required to verify the gossiped payloads")
+		}
+		if cfg.Driver.SequencerEnabled {
+			if cfg.P2P.SequencerKey == nil {
+				return errors.New("the sequencer needs the p2p sequencer key to gossip its blocks")
+			}
+			if addr := crypto.PubkeyToAddress(cfg.P2P.SequencerKey.PublicKey); addr != cfg.Rollup.P2PSequencerAddress {
+				return fmt.Errorf("p2p sequencer key of %s does not match the p2p sequencer address %s of the rollup", addr, cfg.Rollup.P2PSequencerAddress)
+			}
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,34 @@
+package node
+
+import (
+	"context"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/heartbeat"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// heartbeatSource reports the sync status of the syncer and the number of peers in the heartbeats.
+// The number of peers is not reported if peers is nil.
+func heartbeatSource(rollupCfg *rollup.Config, version VersionInfo, syncer syncClient, peers peerController) heartbeat.Source {
+	return func(ctx context.Context) (*heartbeat.Payload, error) {
+		status, err := syncer.SyncStatus(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p := &heartbeat.Payload{
+			Version:       version.String(),
+			ChainID:       (*hexutil.Big)(rollupCfg.L2ChainID),
+			L1Head:        status.L1Head.ID(),
+			UnsafeL2:      status.UnsafeL2.ID(),
+			SafeL2:        status.SafeL2.ID(),
+			FinalizedL2:   status.FinalizedL2,
+			EngineSyncing: status.EngineSyncing,
+		}
+		if peers != nil {
+			n := len(peers.Peers())
+			p.Peers = &n
+		}
+		return p, nil
+	}
+}
@@ -0,0 +1,34 @@
+package node
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/p2p"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeatSource(t *testing.T) {
+	cfg := &rollup.Config{L2ChainID: big.NewInt(901)}
+	version := VersionInfo{Version: "0.1.0"}
+	dr := &mockDriverClient{head: common.Hash{0x42}}
+
+	p, err := heartbeatSource(cfg, version, dr, nil)(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, version.String(), p.Version)
+	assert.Equal(t, uint64(901), p.ChainID.ToInt().Uint64())
+	assert.Equal(t, common.Hash{0x42}, p.UnsafeL2.Hash)
+	assert.Equal(t, uint64(2), p.SafeL2.Number)
+	assert.True(t, p.EngineSyncing)
+	assert.Nil(t, p.Peers, "the peers are not reported without the p2p stack")
+
+	peers := &mockPeerController{peers: make([]p2p.PeerInfo, 4)}
+	p, err = heartbeatSource(cfg, version, dr, peers)(context.Background())
+	assert.NoError(t, err)
+	if assert.NotNil(t, p.Peers) {
+		assert.Equal(t, 4, *p.Peers)
+	}
+}
@@ -2,8 +2,10 @@ package node
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/log"
 	"golang.org/x/term"
@@ -39,15 +41,96 @@ func (cfg *LogConfig) Check() error {
 	return nil
 }
 
-// NewLogger creates a logger based on the supplied configuration
+// NewLogger creates a logger based on the supplied configuration.
+// The level and format of the logger can be changed at runtime, through its *LogHandler.
 func (cfg *LogConfig) NewLogger() log.Logger {
-	handler := log.StreamHandler(os.Stdout, format(cfg.Format, cfg.Color))
-	handler = log.SyncHandler(handler)
-	log.LvlFilterHandler(level(cfg.Level), handler)
 	logger := log.New()
-	logger.SetHandler(handler)
+	logger.SetHandler(NewLogHandler(os.Stdout, cfg))
 	return logger
+}
+
+// LogModuleKey is the context key of the module that a log record is from, to set the log level per module.
+const LogModuleKey = "module"
 
+// LogHandler writes log records of the configured level and format, both of which can be changed at runtime.
+// Records with a module context, see LogModuleKey, are filtered by the level of their module if it is set.
+type LogHandler struct {
+	out   io.Writer
+	color bool
+
+	mu      sync.RWMutex
+	handler log.Handler
+	level   log.Lvl
+	modules map[string]log.Lvl
+}
+
+func NewLogHandler(out io.Writer, cfg *LogConfig) *LogHandler {
+	return &LogHandler{
+		out:     out,
+		color:   cfg.Color,
+		handler: log.SyncHandler(log.StreamHandler(out, format(cfg.Format, cfg.Color))),
+		level:   level(cfg.Level),
+		modules: make(map[string]log.Lvl),
+	}
+}
+
+func (h *LogHandler) Log(r *log.Record) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	lvl := h.level
+	if module, ok := recordModule(r); ok {
+		if moduleLvl, ok := h.modules[module]; ok {
+			lvl = moduleLvl
+		}
+	}
+	if r.Lvl > lvl {
+		return nil
+	}
+	return h.handler.Log(r)
+}
+
+// recordModule returns the last module in the context of the record, as the context of a child logger is appended.
+func recordModule(r *log.Record) (string, bool) {
+	for i := len(r.Ctx) - 2; i >= 0; i -= 2 {
+		if key, ok := r.Ctx[i].(string); ok && key == LogModuleKey {
+			module, ok := r.Ctx[i+1].(string)
+			return module, ok
+		}
+	}
+	return "", false
+}
+
+// SetLevel sets the log level of the module, or the default level of all modules if module is empty.
+// Setting the level of a module to the empty level resets it to the default level.
+func (h *LogHandler) SetLevel(module string, lvl string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if module != "" && lvl == "" {
+		delete(h.modules, module)
+		return nil
+	}
+	l, err := log.LvlFromString(strings.ToLower(lvl))
+	if err != nil {
+		return fmt.Errorf("unrecognized log level: %w", err)
+	}
+	if module == "" {
+		h.level = l
+	} else {
+		h.modules[module] = l
+	}
+	return nil
+}
+
+// SetFormat switches the log output to the format: 'text', 'terminal', 'json' or 'json-pretty'.
+func (h *LogHandler) SetFormat(f string) error {
+	cfg := LogConfig{Level: "info", Format: f}
+	if err := cfg.Check(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handler = log.SyncHandler(log.StreamHandler(h.out, format(f, h.color)))
+	return nil
 }
 
 // format turns a string and color into a structured Format object
@@ -0,0 +1,56 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogHandler(t *testing.T) {
+	var out bytes.Buffer
+	h := NewLogHandler(&out, &LogConfig{Level: "info", Format: "text"})
+	logger := log.New()
+	logger.SetHandler(h)
+	driverLog := logger.New(LogModuleKey, "driver")
+	deriveLog := driverLog.New(LogModuleKey, "derive")
+
+	logger.Debug("hidden")
+	logger.Info("shown")
+	assert.NotContains(t, out.String(), "hidden")
+	assert.Contains(t, out.String(), "shown")
+
+	// the level of a module overrides the default level, the last module of the context counts
+	assert.NoError(t, h.SetLevel("derive", "debug"))
+	out.Reset()
+	driverLog.Debug("driver debug")
+	deriveLog.Debug("derive debug")
+	assert.NotContains(t, out.String(), "driver debug")
+	assert.Contains(t, out.String(), "derive debug")
+
+	assert.NoError(t, h.SetLevel("", "error"))
+	assert.NoError(t, h.SetLevel("derive", ""))
+	out.Reset()
+	deriveLog.Info("derive info")
+	assert.Empty(t, out.String(), "module level reset to the default")
+	assert.Error(t, h.SetLevel("", "loud"))
+
+	assert.NoError(t, h.SetFormat("json"))
+	out.Reset()
+	logger.Error("as json", "key", "value")
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(out.String())), &record))
+	assert.Equal(t, "value", record["key"])
+	assert.Error(t, h.SetFormat("xml"))
+}
+
+func TestLogConfigLevel(t *testing.T) {
+	cfg := &LogConfig{Level: "warn", Format: "text"}
+	logger := cfg.NewLogger()
+	h, ok := logger.GetHandler().(*LogHandler)
+	assert.True(t, ok)
+	assert.Equal(t, log.LvlWarn, h.level, "the configured level applies")
+}
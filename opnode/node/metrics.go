@@ -0,0 +1,90 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/metrics/prometheus"
+)
+
+const (
+	DefaultMetricsListenAddr = "0.0.0.0"
+	DefaultMetricsListenPort = 7300
+	// processMetricsInterval is the time between the updates of the CPU, memory and disk metrics of the process
+	processMetricsInterval = 3 * time.Second
+)
+
+// MetricsConfig configures the collection of the metrics of the node, and the HTTP server that serves them
+// in the Prometheus format. The metrics are recorded in the default registry of go-ethereum/metrics, under
+// "driver/", "derive/", "bss/", "p2p/" and "rpc/" for the driver, the derivation, the batch submitter,
+// the p2p stack and the outbound RPC calls.
+type MetricsConfig struct {
+	// Enabled collects the metrics and serves them. The metrics that are created before the collection is
+	// enabled are stubs, so it must be enabled before the node is created.
+	Enabled    bool
+	ListenAddr string
+	ListenPort int
+}
+
+// Check verifies that the given configuration makes sense
+func (cfg *MetricsConfig) Check() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.ListenPort < 0 || cfg.ListenPort > 65535 {
+		return fmt.Errorf("invalid metrics port %d", cfg.ListenPort)
+	}
+	return nil
+}
+
+// metricsServer serves the metrics of a registry on /metrics, in the Prometheus text format.
+type metricsServer struct {
+	endpoint   string
+	registry   metrics.Registry
+	httpServer *http.Server
+	listenAddr net.Addr
+	log        log.Logger
+}
+
+func newMetricsServer(addr string, port int, registry metrics.Registry, log log.Logger) *metricsServer {
+	return &metricsServer{
+		endpoint: fmt.Sprintf("%s:%d", addr, port),
+		registry: registry,
+		log:      log,
+	}
+}
+
+func (s *metricsServer) Start() error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheus.Handler(s.registry))
+
+	listener, err := net.Listen("tcp", s.endpoint)
+	if err != nil {
+		return err
+	}
+	s.listenAddr = listener.Addr()
+
+	s.httpServer = &http.Server{Handler: mux}
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("metrics server failed", "err", err)
+		}
+	}()
+	return nil
+}
+
+func (s *metricsServer) Stop() {
+	if s.httpServer != nil {
+		_ = s.httpServer.Shutdown(context.Background())
+	}
+}
+
+func (s *metricsServer) Addr() net.Addr {
+	return s.listenAddr
+}
@@ -0,0 +1,34 @@
+package node
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsServer(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.NewRegisteredCounterForced("driver/reorgs/shallow", registry).Inc(3)
+	server := newMetricsServer("127.0.0.1", 0, registry, log.New())
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", server.Addr()))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "driver_reorgs_shallow 3")
+}
+
+func TestMetricsConfigCheck(t *testing.T) {
+	assert.NoError(t, (&MetricsConfig{}).Check())
+	assert.NoError(t, (&MetricsConfig{Enabled: true, ListenAddr: DefaultMetricsListenAddr, ListenPort: DefaultMetricsListenPort}).Check())
+	assert.Error(t, (&MetricsConfig{Enabled: true, ListenPort: 70000}).Check())
+}
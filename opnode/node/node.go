@@ -2,30 +2,73 @@ package node
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"path/filepath"
 	"time"
 
 	"github.com/ethereum-optimism/optimistic-specs/opnode/backoff"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/beacon"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/bss"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/heartbeat"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/l1"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/p2p"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rpcmetrics"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/tracing"
 
 	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
+// tracerShutdownTimeout is the time to flush the trace spans on shutdown
+const tracerShutdownTimeout = 5 * time.Second
+
 type OpNode struct {
 	log       log.Logger
 	l1Source  *l1.Source       // Source to fetch data from (also implements the Downloader interface)
 	l2Engines []*driver.Driver // engines to keep synced
-	server    *rpcServer
-	done      chan struct{}
+	// redundant are the redundant engines of the drivers, if there is a secondary engine
+	redundant []*l2.RedundantEngine
+	indexes   []*index.DB   // L1 origin index of each engine
+	wals      []*driver.WAL // derivation log of each engine, if persisted
+	// submitters are the batch submitters of the engines, if sequencing
+	submitters []*bss.BatchSubmitter
+	rollupCfg  *rollup.Config
+	// l1PollInterval is the interval to poll the L1 head at while the L1 head subscription is down
+	l1PollInterval time.Duration
+	server         *rpcServer
+	// p2p gossips the unsafe blocks of the sequencer, nil if the p2p stack is disabled
+	p2p *p2p.Node
+	// metrics serves the metrics of the node, nil if the metrics are disabled
+	metrics *metricsServer
+	// pprof serves the runtime profiles of the node, nil if the profiles are not served
+	pprof *pprofServer
+	// tracer exports the trace spans of the node, nil if tracing is disabled
+	tracer *sdktrace.TracerProvider
+	// heartbeat configures the heartbeats of the node, which report heartbeatSrc if enabled
+	heartbeat    heartbeat.Config
+	heartbeatSrc heartbeat.Source
+	// events writes the significant events of the node to the configured sinks, nil if there are none
+	events *events.Bus
+	done   chan struct{}
 }
 
 func dialRPCClientWithBackoff(ctx context.Context, log log.Logger, addr string) (*rpc.Client, error) {
@@ -48,65 +91,304 @@ func dialRPCClientWithBackoff(ctx context.Context, log log.Logger, addr string)
 	return ret, nil
 }
 
-func New(ctx context.Context, cfg *Config, log log.Logger, appVersion string) (*OpNode, error) {
-	if err := cfg.Check(); err != nil {
+// dialEngine dials the L2 engine, with authentication if auth is not nil.
+func dialEngine(ctx context.Context, log log.Logger, addr string, auth *l2.JWTAuth) (*rpc.Client, error) {
+	if auth == nil {
+		return dialRPCClientWithBackoff(ctx, log, addr)
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid L2 engine address (%s): %w", addr, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: %s", l2.ErrJWTOverWebsocket, addr)
+	}
+	return rpc.DialHTTPWithClient(addr, &http.Client{Transport: auth.RoundTripper(nil)})
+}
+
+// dialL2Source dials the L2 engine, and negotiates the engine API methods to use with it.
+// An engine that is too old is rejected, an engine that is not reachable yet uses the default engine API methods.
+// The RPC calls to the engine are recorded in the metrics under metricsName.
+func dialL2Source(ctx context.Context, log log.Logger, addr string, auth *l2.JWTAuth, genesis *rollup.Genesis, clientLog log.Logger, metricsName string) (*l2.Source, error) {
+	l2Node, err := dialEngine(ctx, log, addr, auth)
+	if err != nil {
+		return nil, err
+	}
+	client, err := l2.NewSource(l2Node, genesis, clientLog)
+	if err != nil {
 		return nil, err
 	}
+	client = client.WithMetrics(rpcmetrics.New(metricsName))
+	if _, err := client.NegotiateEngineAPI(ctx); errors.Is(err, l2.ErrEngineUnsupported) {
+		return nil, fmt.Errorf("engine is not supported: %w", err)
+	} else if err != nil {
+		log.Warn("Failed to negotiate the engine API, using the default methods", "addr", addr, "err", err)
+	}
+	return client, nil
+}
 
+// engineAuth returns the authentication with the L2 engines, or nil if the connections are not authenticated.
+func (cfg *Config) engineAuth() (*l2.JWTAuth, error) {
+	if cfg.L2EngineAuth.Secret == nil {
+		return nil, nil
+	}
+	return l2.NewJWTAuth(cfg.L2EngineAuth)
+}
+
+// dialL1 dials the L1 endpoint, and the fallback endpoints if any, to fail over between.
+func dialL1(ctx context.Context, cfg *Config, log log.Logger) (l1.RPCClient, error) {
 	l1Node, err := dialRPCClientWithBackoff(ctx, log, cfg.L1NodeAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial L1 address (%s): %w", cfg.L1NodeAddr, err)
 	}
+	l1Client := rpcmetrics.Instrument(l1Node, rpcmetrics.New("rpc/l1"))
+	if len(cfg.L1FallbackAddrs) == 0 {
+		return l1Client, nil
+	}
+	endpoints := []l1.FailoverEndpoint{{Addr: cfg.L1NodeAddr, Client: l1Client}}
+	for i, addr := range cfg.L1FallbackAddrs {
+		client, err := dialRPCClientWithBackoff(ctx, log, addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial L1 fallback address (%s): %w", addr, err)
+		}
+		endpoints = append(endpoints, l1.FailoverEndpoint{Addr: addr, Client: rpcmetrics.Instrument(client, rpcmetrics.New(fmt.Sprintf("rpc/l1_fallback_%d", i)))})
+	}
+	return l1.FailoverRPC(endpoints, cfg.L1Failover, log.New(LogModuleKey, "l1", "service", "l1_failover")), nil
+}
+
+func (cfg *Config) l1SourceConfig() *l1.SourceConfig {
+	sourceCfg := l1.DefaultConfig(&cfg.Rollup, cfg.L1TrustRPC)
+	sourceCfg.RateLimit = cfg.L1RateLimit
+	if cfg.L1BeaconHeaders {
+		sourceCfg.Canonical = beacon.NewClient(cfg.Driver.L1BeaconAddr, nil)
+	}
+	return sourceCfg
+}
+
+func New(ctx context.Context, cfg *Config, log log.Logger, snapshotLog log.Logger, version VersionInfo) (*OpNode, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+
+	// The metrics are enabled before any are created, the metrics that are created while disabled stay stubs.
+	var metricsSrv *metricsServer
+	if cfg.Metrics.Enabled {
+		metrics.Enabled = true
+		go metrics.CollectProcessMetrics(processMetricsInterval)
+		metricsSrv = newMetricsServer(cfg.Metrics.ListenAddr, cfg.Metrics.ListenPort, metrics.DefaultRegistry, log.New(LogModuleKey, "metrics"))
+	}
+	// The spans are exported by the global tracer provider, which the packages of the node create their spans with.
+	var tracer *sdktrace.TracerProvider
+	if cfg.Tracing.Enabled() {
+		var err error
+		tracer, err = tracing.NewProvider(ctx, &cfg.Tracing, version.String())
+		if err != nil {
+			return nil, err
+		}
+		otel.SetTracerProvider(tracer)
+	}
+	var pprofSrv *pprofServer
+	if cfg.Pprof.Enabled {
+		pprofSrv = newPprofServer(cfg.Pprof.ListenAddr, cfg.Pprof.ListenPort, log.New(LogModuleKey, "pprof"))
+	}
+	var eventBus *events.Bus
+	if cfg.Events.Enabled() {
+		sinks, err := cfg.Events.NewSinks()
+		if err != nil {
+			return nil, err
+		}
+		eventBus = events.NewBus(log.New(LogModuleKey, "events"), sinks...)
+	}
+
+	l1Client, err := dialL1(ctx, cfg, log)
+	if err != nil {
+		return nil, err
+	}
 
 	// TODO: we may need to authenticate the connection with L1
-	// l1Node.SetHeader()
-	l1Source, err := l1.NewSource(l1Node, log, l1.DefaultConfig(&cfg.Rollup, cfg.L1TrustRPC))
+	// l1Client.SetHeader()
+	l1Source, err := l1.NewSource(l1Client, log.New(LogModuleKey, "l1"), cfg.l1SourceConfig())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create L1 source: %v", err)
 	}
+	var submitterSigner bss.Signer
+	if cfg.Driver.SequencerEnabled {
+		if cfg.SubmitterKMS.KeyID != "" {
+			kmsClient, err := bss.NewAWSKMSClient(ctx, cfg.SubmitterKMS)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create the KMS client of the batch submitter: %w", err)
+			}
+			submitterSigner, err = bss.NewKMSSigner(ctx, kmsClient)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load the KMS key of the batch submitter: %w", err)
+			}
+		} else if cfg.SubmitterSigner.Addr != "" {
+			submitterSigner, err = bss.NewRemoteSigner(ctx, cfg.SubmitterSigner)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to the batch submitter signer: %w", err)
+			}
+		} else {
+			submitterSigner = bss.NewLocalSigner(cfg.SubmitterPrivKey)
+		}
+	}
 	var l2Engines []*driver.Driver
+	var submitters []*bss.BatchSubmitter
+	var redundantEngines []*l2.RedundantEngine
+	var indexes []*index.DB
+	var wals []*driver.WAL
 	genesis := cfg.Rollup.Genesis
 
-	for i, addr := range cfg.L2EngineAddrs {
-		l2Node, err := dialRPCClientWithBackoff(ctx, log, addr)
+	engineAuth, err := cfg.engineAuth()
+	if err != nil {
+		return nil, err
+	}
+	var p2pNode *p2p.Node
+	var network driver.Network
+	if cfg.P2P != nil {
+		p2pNode, err = p2p.NewNode(ctx, cfg.P2P, &cfg.Rollup, log.New(LogModuleKey, "p2p"))
 		if err != nil {
 			return nil, err
 		}
-		// TODO: we may need to authenticate the connection with L2
-		// backend.SetHeader()
-		client, err := l2.NewSource(l2Node, &genesis, log.New("engine_client", i))
+		network = p2pNode
+	}
+	if cfg.DataDir == "" && cfg.Rollup.SystemConfigAddress != (common.Address{}) {
+		log.Warn("The system configs are not persisted without a data dir, they are derived from the L1 genesis again after a restart")
+	}
+	for i, addr := range cfg.L2EngineAddrs {
+		client, err := dialL2Source(ctx, log, addr, engineAuth, &genesis, log.New(LogModuleKey, "l2", "engine_client", i), fmt.Sprintf("rpc/engine_%d", i))
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("engine %d (%s): %w", i, addr, err)
+		}
+		var engineClient driver.L2Engine = client
+		// The secondary engine mirrors the first engine, which is the one that sequences if sequencing is enabled.
+		if i == 0 && cfg.L2SecondaryEngineAddr != "" {
+			secondary, err := dialL2Source(ctx, log, cfg.L2SecondaryEngineAddr, engineAuth, &genesis, log.New(LogModuleKey, "l2", "engine_client", "secondary"), "rpc/engine_secondary")
+			if err != nil {
+				return nil, fmt.Errorf("secondary engine (%s): %w", cfg.L2SecondaryEngineAddr, err)
+			}
+			redundant := l2.NewRedundantEngine(client, secondary, log.New(LogModuleKey, "l2", "engine", i))
+			redundant.Events = eventBus
+			engineClient = redundant
+			redundantEngines = append(redundantEngines, redundant)
 		}
 
 		var submitter *bss.BatchSubmitter
-		if cfg.Sequencer {
+		if cfg.Driver.SequencerEnabled {
+			bundleType, err := derive.BundleTypeForCompression(cfg.BatchCompression)
+			if err != nil {
+				return nil, err
+			}
+			batchType := byte(derive.BatchV1Type)
+			if cfg.SpanBatches {
+				batchType = derive.SpanBatchV1Type
+			}
+			submitterLog := log.New(LogModuleKey, "bss", "engine", i, "service", "batch_submitter")
 			submitter = &bss.BatchSubmitter{
-				Client:    ethclient.NewClient(l1Node),
-				ToAddress: cfg.Rollup.BatchInboxAddress,
-				ChainID:   cfg.Rollup.L1ChainID,
-				PrivKey:   cfg.SubmitterPrivKey,
+				TxMgr:         bss.NewTxManager(cfg.SubmitterTxManager, bss.NewL1Client(l1Client), cfg.Rollup.L1ChainID, submitterSigner, submitterLog),
+				ToAddress:     cfg.Rollup.BatchInboxAddress,
+				MaxTxDataSize: cfg.SubmitterMaxTxDataSize,
+				MaxTxGas:      cfg.SubmitterMaxTxGas,
+				DryRun:        cfg.SubmitterDryRun,
+				UseBlobs:      cfg.SubmitterBlobs,
+				BundleType:    bundleType,
+				BatchType:     batchType,
+				Events:        eventBus,
+			}
+			if cfg.DataDir != "" {
+				submitter.Queue, err = bss.OpenBatchQueue(filepath.Join(cfg.DataDir, fmt.Sprintf("batch-queue-%d.json", i)), submitterLog)
+				if err != nil {
+					return nil, err
+				}
 			}
+			submitters = append(submitters, submitter)
+		}
+		// Each engine derives its own safe chain, and has its own index
+		var indexPath string
+		if cfg.DataDir != "" {
+			indexPath = filepath.Join(cfg.DataDir, fmt.Sprintf("l1index-%d", i))
+		}
+		idx, err := index.Open(indexPath)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+		var wal *driver.WAL
+		if cfg.DataDir != "" {
+			wal, err = driver.OpenWAL(filepath.Join(cfg.DataDir, fmt.Sprintf("derivation-%d.wal", i)))
+			if err != nil {
+				return nil, err
+			}
+			wals = append(wals, wal)
+		}
+		engine, err := driver.NewDriver(&cfg.Driver, cfg.Rollup, engineClient, l1Source, log.New("engine", i, "Sequencer", cfg.Driver.SequencerEnabled), snapshotLog.New("engine", i), submitter, idx, wal, network, eventBus)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create driver of engine %d: %w", i, err)
 		}
-		engine := driver.NewDriver(cfg.Rollup, client, l1Source, log.New("engine", i, "Sequencer", cfg.Sequencer), submitter, cfg.Sequencer)
 		l2Engines = append(l2Engines, engine)
+		// The peers are served the canonical blocks of the first engine, like the admin API.
+		if i == 0 && p2pNode != nil {
+			p2pNode.ServePayloadsByRange(&payloadSource{engine: engineClient})
+		}
 	}
 
 	l2Node, err := dialRPCClientWithBackoff(ctx, log, cfg.L2NodeAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial l2 address (%s): %w", cfg.L2NodeAddr, err)
 	}
-	server, err := newRPCServer(ctx, cfg.RPCListenAddr, cfg.RPCListenPort, &l2EthClientImpl{l2Node}, cfg.WithdrawalContractAddr, log, appVersion)
+	// The admin API controls the first engine, which is the one that sequences if sequencing is enabled.
+	var dr driverClient
+	if cfg.RPCEnableAdmin && len(l2Engines) > 0 {
+		dr = l2Engines[0]
+	}
+	// The sync status is of the first engine, like the admin API.
+	var syncer syncClient
+	if len(l2Engines) > 0 {
+		syncer = l2Engines[0]
+	}
+	// The batcher API reports the batch submission of the first engine, like the admin API.
+	var submitter submitterClient
+	if len(submitters) > 0 {
+		submitter = submitters[0]
+	}
+	// The log output can only be changed at runtime if the logger was created by LogConfig.NewLogger.
+	var logs logController
+	if h, ok := log.GetHandler().(*LogHandler); ok {
+		logs = h
+	}
+	// The peers can only be managed if the p2p stack is enabled.
+	var peers peerController
+	if p2pNode != nil {
+		peers = p2pNode
+	}
+	server, err := newRPCServer(ctx, cfg.RPCListenAddr, cfg.RPCListenPort, &cfg.Rollup, &l2EthClientImpl{l2Node}, syncer, dr, logs, peers, submitter, cfg.WithdrawalContractAddr, cfg.RPCReadyMaxStaleness, log.New(LogModuleKey, "rpc"), version)
 	if err != nil {
 		return nil, err
 	}
 
+	var heartbeatSrc heartbeat.Source
+	if cfg.Heartbeat.Enabled() && syncer != nil {
+		heartbeatSrc = heartbeatSource(&cfg.Rollup, version, syncer, peers)
+	}
+
 	n := &OpNode{
-		log:       log,
-		l1Source:  l1Source,
-		l2Engines: l2Engines,
-		server:    server,
-		done:      make(chan struct{}),
+		log:            log,
+		l1Source:       l1Source,
+		l2Engines:      l2Engines,
+		indexes:        indexes,
+		wals:           wals,
+		submitters:     submitters,
+		redundant:      redundantEngines,
+		rollupCfg:      &cfg.Rollup,
+		l1PollInterval: cfg.L1PollInterval,
+		server:         server,
+		p2p:            p2pNode,
+		metrics:        metricsSrv,
+		pprof:          pprofSrv,
+		tracer:         tracer,
+		heartbeat:      cfg.Heartbeat,
+		heartbeatSrc:   heartbeatSrc,
+		events:         eventBus,
+		done:           make(chan struct{}),
 	}
 
 	return n, nil
@@ -149,14 +431,19 @@ func (c *OpNode) Start(ctx context.Context) error {
 		}
 	}
 
-	// Keep subscribed to the L1 heads, which keeps the L1 maintainer pointing to the best headers to sync
-	l1HeadsSub := event.ResubscribeErr(time.Second*10, func(ctx context.Context, err error) (event.Subscription, error) {
-		if err != nil {
-			c.log.Warn("resubscribing after failed L1 subscription", "err", err)
+	// The gossiped payloads are only received once the engines run
+	if c.p2p != nil {
+		if err := c.p2p.Subscribe(&gossipIn{engines: c.l2Engines}); err != nil {
+			return fmt.Errorf("unable to receive p2p gossip: %w", err)
 		}
-		return eth.WatchHeadChanges(context.Background(), c.l1Source, func(sig eth.L1BlockRef) {
-			l1HeadsFeed.Send(sig)
-		})
+	}
+
+	// Keep following the L1 heads, which keeps the L1 maintainer pointing to the best headers to sync.
+	// The heads are polled while the L1 head subscription is down.
+	l1HeadsSub := eth.WatchHeads(context.Background(), c.l1Source, c.l1PollInterval, c.log, func(sig eth.L1BlockRef) {
+		// invalidate the cached L1 blocks of a reorg before the engines see the new head
+		c.l1Source.L1HeadChanged(sig)
+		l1HeadsFeed.Send(sig)
 	})
 	handleUnsubscribe(l1HeadsSub, "l1 heads subscription failed")
 
@@ -164,11 +451,40 @@ func (c *OpNode) Start(ctx context.Context) error {
 	l1Heads := make(chan eth.L1BlockRef, 10)
 	l1HeadsFeed.Subscribe(l1Heads)
 
+	// Batches that were not confirmed before the last restart are submitted again
+	for _, submitter := range c.submitters {
+		go func(submitter *bss.BatchSubmitter) {
+			if err := submitter.ResubmitQueued(c.rollupCfg); err != nil {
+				c.log.Error("Failed to resubmit queued batches", "err", err)
+			}
+		}(submitter)
+	}
+
 	c.log.Info("Starting JSON-RPC server")
 	if err := c.server.Start(); err != nil {
 		return fmt.Errorf("unable to start RPC server: %w", err)
 	}
 
+	if c.metrics != nil {
+		c.log.Info("Starting metrics server")
+		if err := c.metrics.Start(); err != nil {
+			return fmt.Errorf("unable to start metrics server: %w", err)
+		}
+	}
+
+	if c.pprof != nil {
+		c.log.Info("Starting pprof server")
+		if err := c.pprof.Start(); err != nil {
+			return fmt.Errorf("unable to start pprof server: %w", err)
+		}
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	if c.heartbeatSrc != nil {
+		c.log.Info("Starting heartbeats", "url", c.heartbeat.URL)
+		go heartbeat.Beat(heartbeatCtx, c.log.New(LogModuleKey, "heartbeat"), &c.heartbeat, c.heartbeatSrc)
+	}
+
 	c.log.Info("Start-up complete!")
 
 	go func() {
@@ -179,16 +495,39 @@ func (c *OpNode) Start(ctx context.Context) error {
 			// TODO: maybe log other info on interval or other chain events (individual engines also log things)
 			case <-c.done:
 				c.log.Info("Closing OpNode")
+				stopHeartbeat()
 				// close all tasks
 				for _, f := range unsub {
 					f()
 				}
+				if c.p2p != nil {
+					if err := c.p2p.Close(); err != nil {
+						c.log.Error("Failed to close p2p node", "err", err)
+					}
+				}
 				// close L1 data source
 				c.l1Source.Close()
 				// close L2 engines
 				for _, eng := range c.l2Engines {
 					eng.Close()
 				}
+				for _, eng := range c.redundant {
+					eng.Close()
+				}
+				for _, idx := range c.indexes {
+					if err := idx.Close(); err != nil {
+						c.log.Error("Failed to close L1 origin index", "err", err)
+					}
+				}
+				for _, wal := range c.wals {
+					if err := wal.Close(); err != nil {
+						c.log.Error("Failed to close derivation log", "err", err)
+					}
+				}
+				// the engines are closed, flush the last events
+				if err := c.events.Close(); err != nil {
+					c.log.Error("Failed to close event sinks", "err", err)
+				}
 				return
 			}
 		}
@@ -201,4 +540,48 @@ func (c *OpNode) Stop() {
 		close(c.done)
 	}
 	c.server.Stop()
+	if c.metrics != nil {
+		c.metrics.Stop()
+	}
+	if c.pprof != nil {
+		c.pprof.Stop()
+	}
+	if c.tracer != nil {
+		// flush the spans that are not exported yet
+		ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+		defer cancel()
+		if err := c.tracer.Shutdown(ctx); err != nil {
+			c.log.Error("Failed to flush the trace spans", "err", err)
+		}
+	}
+}
+
+// payloadSource serves the canonical blocks of an engine as payloads to the peers.
+type payloadSource struct {
+	engine driver.Engine
+}
+
+func (p *payloadSource) PayloadByNumber(ctx context.Context, number uint64) (*l2.ExecutionPayload, error) {
+	block, err := p.engine.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, err
+	}
+	return l2.BlockAsPayload(block)
+}
+
+// gossipIn feeds the payloads gossiped by peers to the engines, as unsafe payloads of the peer that relayed them.
+type gossipIn struct {
+	engines []*driver.Driver
+}
+
+func (g *gossipIn) OnUnsafeL2Payload(ctx context.Context, from peer.ID, env *p2p.PayloadEnvelope) error {
+	var result error
+	for i, eng := range g.engines {
+		// the gossiped payloads are signed, the payloads synced from peers are linked to a signed payload instead
+		up := &driver.UnsafePayload{Payload: env.Payload, Signature: env.Signature, Source: "p2p:" + from.String(), Linked: env.Signature == nil}
+		if err := eng.OnUnsafeL2Payload(ctx, up); err != nil && result == nil {
+			result = fmt.Errorf("engine %d: %w", i, err)
+		}
+	}
+	return result
 }
@@ -0,0 +1,87 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// DefaultPprofListenAddr only serves the profiles locally, the profiles expose the internals of the process
+	DefaultPprofListenAddr = "127.0.0.1"
+	DefaultPprofListenPort = 6060
+)
+
+// PprofConfig configures the HTTP server of the runtime profiles of the node, e.g. of the CPU, the heap and
+// the goroutines, which are served under /debug/pprof/ in the format of the pprof tool.
+type PprofConfig struct {
+	Enabled    bool
+	ListenAddr string
+	ListenPort int
+}
+
+// Check verifies that the given configuration makes sense
+func (cfg *PprofConfig) Check() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.ListenPort < 0 || cfg.ListenPort > 65535 {
+		return fmt.Errorf("invalid pprof port %d", cfg.ListenPort)
+	}
+	return nil
+}
+
+// pprofServer serves the runtime profiles of the process, on a port of its own so that the profiles
+// are not exposed along with the RPC.
+type pprofServer struct {
+	endpoint   string
+	httpServer *http.Server
+	listenAddr net.Addr
+	log        log.Logger
+}
+
+func newPprofServer(addr string, port int, log log.Logger) *pprofServer {
+	return &pprofServer{
+		endpoint: fmt.Sprintf("%s:%d", addr, port),
+		log:      log,
+	}
+}
+
+func (s *pprofServer) Start() error {
+	// the handlers are registered on a mux of their own, the default mux of net/http/pprof is not served
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	listener, err := net.Listen("tcp", s.endpoint)
+	if err != nil {
+		return err
+	}
+	s.listenAddr = listener.Addr()
+
+	s.httpServer = &http.Server{Handler: mux}
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("pprof server failed", "err", err)
+		}
+	}()
+	return nil
+}
+
+func (s *pprofServer) Stop() {
+	if s.httpServer != nil {
+		_ = s.httpServer.Shutdown(context.Background())
+	}
+}
+
+func (s *pprofServer) Addr() net.Addr {
+	return s.listenAddr
+}
@@ -0,0 +1,97 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+)
+
+// DefaultReadyMaxStaleness is the default time that the L1 head and the derivation may stall before the node is not ready.
+const DefaultReadyMaxStaleness = 3 * time.Minute
+
+// readyCheckTimeout limits the time of the requests of a readiness check.
+const readyCheckTimeout = 5 * time.Second
+
+// readiness checks if the node is ready to serve: the L1 head is recent, the engine is reachable,
+// and the safe head advances towards the L1 head.
+type readiness struct {
+	syncer       syncClient
+	l2Client     l2EthClient
+	maxStaleness time.Duration
+	now          func() time.Time
+
+	mu sync.Mutex
+	// safeHead is the safe head at the last check, and progressed the last time it changed,
+	// or the last time that there was nothing left to derive.
+	safeHead   eth.L2BlockRef
+	progressed time.Time
+}
+
+func newReadiness(syncer syncClient, l2Client l2EthClient, maxStaleness time.Duration) *readiness {
+	if maxStaleness == 0 {
+		maxStaleness = DefaultReadyMaxStaleness
+	}
+	return &readiness{
+		syncer:       syncer,
+		l2Client:     l2Client,
+		maxStaleness: maxStaleness,
+		now:          time.Now,
+		progressed:   time.Now(),
+	}
+}
+
+// check returns the problems that make the node not ready, none if it is ready.
+func (r *readiness) check(ctx context.Context) []string {
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+	var problems []string
+	if _, err := r.l2Client.GetBlockHeader(ctx, "latest"); err != nil {
+		problems = append(problems, fmt.Sprintf("engine: not reachable: %v", err))
+	}
+	if r.syncer == nil {
+		return append(problems, "driver: not running")
+	}
+	status, err := r.syncer.SyncStatus(ctx)
+	if err != nil {
+		return append(problems, fmt.Sprintf("driver: not responding: %v", err))
+	}
+	now := r.now()
+	if l1Age := now.Sub(time.Unix(int64(status.L1Head.Time), 0)); status.L1Head == (eth.L1BlockRef{}) || l1Age > r.maxStaleness {
+		problems = append(problems, fmt.Sprintf("l1: head %s is stale", status.L1Head))
+	}
+	if status.EngineSyncing {
+		problems = append(problems, "engine: syncing")
+	}
+	if status.DerivationPaused {
+		problems = append(problems, "derivation: paused")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if status.SafeL2 != r.safeHead || status.Derivation.Synced() {
+		r.safeHead = status.SafeL2
+		r.progressed = now
+	} else if stalled := now.Sub(r.progressed); stalled > r.maxStaleness {
+		problems = append(problems, fmt.Sprintf("derivation: safe head %s did not advance for %s, %d L1 blocks behind",
+			status.SafeL2, stalled.Truncate(time.Second), status.Derivation.BlocksBehind))
+	}
+	return problems
+}
+
+// readyzHandler responds with 200 if the node is ready, and with 503 and the problems otherwise.
+func readyzHandler(r *readiness) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		problems := r.check(req.Context())
+		if len(problems) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(strings.Join(problems, "\n")))
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}
+}
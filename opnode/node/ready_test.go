@@ -0,0 +1,68 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/sync"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticSyncer struct {
+	syncClient
+	status driver.SyncStatus
+}
+
+func (s *staticSyncer) SyncStatus(ctx context.Context) (*driver.SyncStatus, error) {
+	status := s.status
+	return &status, nil
+}
+
+func TestReadiness(t *testing.T) {
+	now := time.Unix(10_000, 0)
+	syncer := &staticSyncer{status: driver.SyncStatus{
+		L1Head:     eth.L1BlockRef{Number: 100, Time: uint64(now.Unix()) - 12},
+		SafeL2:     eth.L2BlockRef{Number: 50},
+		Derivation: sync.Progress{BlocksBehind: 0},
+	}}
+	l2Client := &mockL2Client{}
+	r := newReadiness(syncer, l2Client, time.Minute)
+	r.now = func() time.Time { return now }
+	ready := func() bool {
+		rec := httptest.NewRecorder()
+		readyzHandler(r).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code == http.StatusOK
+	}
+	assert.True(t, ready())
+
+	// the derivation may be behind, as long as it advances
+	syncer.status.Derivation.BlocksBehind = 10
+	now = now.Add(50 * time.Second)
+	syncer.status.L1Head.Time = uint64(now.Unix())
+	assert.True(t, ready())
+	syncer.status.SafeL2.Number = 51
+	now = now.Add(50 * time.Second)
+	syncer.status.L1Head.Time = uint64(now.Unix())
+	assert.True(t, ready())
+	now = now.Add(61 * time.Second)
+	syncer.status.L1Head.Time = uint64(now.Unix())
+	assert.Len(t, r.check(context.Background()), 1, "derivation stalled")
+	syncer.status.Derivation.BlocksBehind = 0
+	assert.True(t, ready(), "nothing left to derive")
+
+	now = now.Add(2 * time.Minute)
+	assert.Len(t, r.check(context.Background()), 1, "stale L1 head")
+	syncer.status.L1Head.Time = uint64(now.Unix())
+	l2Client.err = errors.New("connection refused")
+	assert.Len(t, r.check(context.Background()), 1, "engine unreachable")
+	l2Client.err = nil
+	syncer.status.EngineSyncing = true
+	assert.False(t, ready())
+	assert.NotEmpty(t, newReadiness(nil, l2Client, 0).check(context.Background()), "no driver")
+}
@@ -7,7 +7,9 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum/go-ethereum"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -22,21 +24,40 @@ import (
 type rpcServer struct {
 	endpoint   string
 	api        *nodeAPI
+	admin      *adminAPI
+	debug      *debugAPI
+	batcher    *batcherAPI
+	p2p        *p2pAPI
 	httpServer *http.Server
 	appVersion string
+	ready      *readiness
 	listenAddr net.Addr
 	log        log.Logger
 }
 
-func newRPCServer(ctx context.Context, addr string, port int, l2Client l2EthClient, withdrawalContractAddress common.Address, log log.Logger, appVersion string) (*rpcServer, error) {
-	api := newNodeAPI(l2Client, withdrawalContractAddress, log.New("rpc", "node"))
+// newRPCServer creates the rollup node RPC server. The sync status and head subscriptions are only available if syncer is not nil. The admin and debug namespaces are only served if dr is not nil,
+// and controls the log output if logs is not nil,
+// the batcher namespace only if submitter is not nil, and the opp2p namespace only if peers is not nil. The node is not ready if the L1 head or the derivation stalls for longer than readyMaxStaleness.
+func newRPCServer(ctx context.Context, addr string, port int, rollupCfg *rollup.Config, l2Client l2EthClient, syncer syncClient, dr driverClient, logs logController, peers peerController, submitter submitterClient, withdrawalContractAddress common.Address, readyMaxStaleness time.Duration, log log.Logger, version VersionInfo) (*rpcServer, error) {
+	api := newNodeAPI(rollupCfg, version, l2Client, syncer, withdrawalContractAddress, log.New("rpc", "node"))
 	endpoint := fmt.Sprintf("%s:%d", addr, port)
 	r := &rpcServer{
 		endpoint:   endpoint,
 		api:        api,
-		appVersion: appVersion,
+		appVersion: version.String(),
+		ready:      newReadiness(syncer, l2Client, readyMaxStaleness),
 		log:        log,
 	}
+	if dr != nil {
+		r.admin = newAdminAPI(dr, logs, peers)
+		r.debug = &debugAPI{dr: dr}
+	}
+	if submitter != nil {
+		r.batcher = &batcherAPI{submitter: submitter}
+	}
+	if peers != nil {
+		r.p2p = &p2pAPI{peers: peers}
+	}
 	return r, nil
 }
 
@@ -47,6 +68,36 @@ func (s *rpcServer) Start() error {
 		Public:        true,
 		Authenticated: false,
 	}}
+	if s.admin != nil {
+		apis = append(apis, rpc.API{
+			Namespace:     "admin",
+			Service:       s.admin,
+			Authenticated: false,
+		})
+	}
+	if s.debug != nil {
+		apis = append(apis, rpc.API{
+			Namespace:     "debug",
+			Service:       s.debug,
+			Authenticated: false,
+		})
+	}
+	if s.batcher != nil {
+		apis = append(apis, rpc.API{
+			Namespace:     "batcher",
+			Service:       s.batcher,
+			Public:        true,
+			Authenticated: false,
+		})
+	}
+	if s.p2p != nil {
+		apis = append(apis, rpc.API{
+			Namespace:     "opp2p",
+			Service:       s.p2p,
+			Public:        true,
+			Authenticated: false,
+		})
+	}
 	srv := rpc.NewServer()
 	if err := node.RegisterApis(apis, nil, srv, true); err != nil {
 		return err
@@ -54,10 +105,19 @@ func (s *rpcServer) Start() error {
 
 	host := strings.Split(s.endpoint, ":")[0]
 	nodeHandler := node.NewHTTPHandlerStack(srv, nil, []string{host}, nil)
+	// websocket connections are served on the same port, for the subscriptions
+	wsHandler := srv.WebsocketHandler(nil)
 
 	mux := http.NewServeMux()
-	mux.Handle("/", nodeHandler)
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isWebsocket(r) {
+			wsHandler.ServeHTTP(w, r)
+			return
+		}
+		nodeHandler.ServeHTTP(w, r)
+	}))
 	mux.HandleFunc("/healthz", healthzHandler(s.appVersion))
+	mux.HandleFunc("/readyz", readyzHandler(s.ready))
 
 	listener, err := net.Listen("tcp", s.endpoint)
 	if err != nil {
@@ -82,6 +142,13 @@ func (r *rpcServer) Addr() net.Addr {
 	return r.listenAddr
 }
 
+// isWebsocket returns true if the request is a websocket upgrade request.
+func isWebsocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// healthzHandler responds with the version while the process is up, see readyzHandler for the readiness of the node.
 func healthzHandler(appVersion string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte(appVersion))
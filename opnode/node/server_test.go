@@ -3,13 +3,27 @@ package node
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
 	"testing"
+	"time"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/bss"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/p2p"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -69,7 +83,8 @@ func TestOutputAtBlock(t *testing.T) {
 	}
 
 	addr := common.HexToAddress("0x00000000219ab540356cBB839Cbe05303d7705Fa")
-	server, err := newRPCServer(context.Background(), "localhost", 0, l2Client, addr, log, "0.0")
+	dr := &mockDriverClient{}
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, l2Client, dr, nil, nil, nil, nil, addr, 0, log, VersionInfo{Version: "0.0"})
 	assert.NoError(t, err)
 	assert.NoError(t, server.Start())
 	defer server.Stop()
@@ -81,17 +96,439 @@ func TestOutputAtBlock(t *testing.T) {
 	err = client.CallContext(context.Background(), &out, "optimism_outputAtBlock", "latest")
 	assert.NoError(t, err)
 	assert.Len(t, out, 2)
+	// the proof is fetched at the number of the block header
+	assert.Equal(t, []string{"latest", "0xdcdc89"}, l2Client.tags)
+
+	// the safe label is resolved with the safe head of the rollup node
+	l2Client.tags = nil
+	err = client.CallContext(context.Background(), &out, "optimism_outputAtBlock", "safe")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0x2", "0xdcdc89"}, l2Client.tags)
+
+	err = client.CallContext(context.Background(), &out, "optimism_outputAtBlock", "unknown")
+	assert.Error(t, err)
+}
+
+func TestRollupConfig(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	cfg := &rollup.Config{
+		Genesis:           rollup.Genesis{L1: eth.BlockID{Hash: common.Hash{1}, Number: 10}, L2Time: 1000},
+		BlockTime:         2,
+		SeqWindowSize:     64,
+		L1ChainID:         big.NewInt(900),
+		L2ChainID:         big.NewInt(901),
+		BatchInboxAddress: common.Address{0xff},
+	}
+	server, err := newRPCServer(context.Background(), "localhost", 0, cfg, &mockL2Client{}, nil, nil, nil, nil, nil, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+
+	var out rollup.Config
+	assert.NoError(t, client.CallContext(context.Background(), &out, "optimism_rollupConfig"))
+	assert.Equal(t, cfg, &out)
+}
+
+func TestVersion(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	cfg := &Config{SpanBatches: true, L1FallbackAddrs: []string{"http://fallback"}}
+	cfg.Rollup.ChannelTimeout = 10
+	cfg.Driver.SequencerEnabled = true
+	version := VersionInfo{Version: "v1.2.3", GitCommit: "0123456789abcdef", GitDate: "1650000000", Features: cfg.Features()}
+	assert.Equal(t, []string{"channel-timeout", "sequencer", "span-batches", "l1-failover"}, version.Features)
+	assert.Equal(t, "v1.2.3-01234567-1650000000", version.String())
+
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, nil, nil, nil, nil, nil, common.Address{}, 0, log, version)
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+
+	var out VersionInfo
+	assert.NoError(t, client.CallContext(context.Background(), &out, "optimism_version"))
+	assert.Equal(t, version, out)
+}
+
+func TestAdminSequencerControl(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	dr := &mockDriverClient{head: common.Hash{0x42}}
+	logs := NewLogHandler(io.Discard, &LogConfig{Level: "info", Format: "text"})
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, nil, dr, logs, nil, nil, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+
+	var active bool
+	assert.NoError(t, client.CallContext(context.Background(), &active, "admin_sequencerActive"))
+	assert.False(t, active)
+
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_startSequencer", dr.head))
+	assert.NoError(t, client.CallContext(context.Background(), &active, "admin_sequencerActive"))
+	assert.True(t, active)
+
+	var stoppedAt common.Hash
+	assert.NoError(t, client.CallContext(context.Background(), &stoppedAt, "admin_stopSequencer"))
+	assert.Equal(t, dr.head, stoppedAt)
+	assert.False(t, dr.active)
+
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_resetChain", common.Hash{0x41}))
+	assert.Equal(t, common.Hash{0x41}, dr.head)
+
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_pauseDerivation"))
+	assert.True(t, dr.paused)
+	assert.Error(t, client.CallContext(context.Background(), nil, "admin_pauseDerivation"), "already paused")
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_resumeDerivation"))
+	assert.False(t, dr.paused)
+	assert.Error(t, client.CallContext(context.Background(), nil, "admin_resumeDerivation"), "not paused")
+
+	var derived driver.DerivedBlock
+	assert.NoError(t, client.CallContext(context.Background(), &derived, "debug_deriveBlock", hexutil.Uint64(7)))
+	assert.Equal(t, uint64(7), derived.Canonical.Number)
+	assert.Equal(t, l2.Uint64Quantity(42), derived.Attributes.Timestamp)
+	assert.Len(t, derived.Differences, 1)
+
+	payload := &l2.ExecutionPayload{ParentHashField: dr.head, BlockNumber: 5, BlockHash: common.Hash{0x43}}
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_postUnsafePayload", payload))
+	assert.Len(t, dr.payloads, 1)
+	assert.Equal(t, payload.ID(), dr.payloads[0].Payload.ID())
+	assert.Nil(t, dr.payloads[0].Signature)
+
+	signature := hexutil.Bytes{1, 2, 3}
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_postUnsafePayload", payload, signature))
+	assert.Len(t, dr.payloads, 2)
+	assert.Equal(t, []byte(signature), dr.payloads[1].Signature)
+
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_setLogLevel", "debug", "derive"))
+	assert.Equal(t, level("debug"), logs.modules["derive"])
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_setLogLevel", "warn"))
+	assert.Equal(t, level("warn"), logs.level)
+	assert.Error(t, client.CallContext(context.Background(), nil, "admin_setLogFormat", "xml"))
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_setLogFormat", "json"))
+}
+
+type mockPeerController struct {
+	peers  []p2p.PeerInfo
+	self   *p2p.SelfInfo
+	stats  *p2p.Stats
+	banned map[peer.ID]time.Duration
+}
+
+func (m *mockPeerController) Peers() []p2p.PeerInfo {
+	return m.peers
+}
+
+func (m *mockPeerController) Self() *p2p.SelfInfo {
+	return m.self
+}
+
+func (m *mockPeerController) Stats() *p2p.Stats {
+	return m.stats
+}
+
+func (m *mockPeerController) BanPeer(id peer.ID, duration time.Duration) error {
+	m.banned[id] = duration
+	return nil
+}
+
+func (m *mockPeerController) UnbanPeer(id peer.ID) error {
+	if _, ok := m.banned[id]; !ok {
+		return p2p.ErrPeerNotBanned
+	}
+	delete(m.banned, id)
+	return nil
+}
+
+func TestAdminPeers(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	id, err := peer.Decode("12D3KooWL3iKC7VFXob8u3fnEFXFPZS2rX4YHZ8RFFt4DdLemgUW")
+	assert.NoError(t, err)
+	peers := &mockPeerController{
+		peers:  []p2p.PeerInfo{{ID: id, Addrs: []string{"/ip4/127.0.0.1/tcp/9222"}, Connected: true, Score: 3}},
+		banned: make(map[peer.ID]time.Duration),
+	}
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, nil, &mockDriverClient{}, nil, peers, nil, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+
+	var out []p2p.PeerInfo
+	assert.NoError(t, client.CallContext(context.Background(), &out, "admin_peers"))
+	assert.Equal(t, peers.peers, out)
+
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_banPeer", id))
+	assert.Equal(t, p2p.DefaultBanDuration, peers.banned[id])
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_banPeer", id, "30m"))
+	assert.Equal(t, 30*time.Minute, peers.banned[id])
+	assert.Error(t, client.CallContext(context.Background(), nil, "admin_banPeer", id, "-1s"))
+	assert.Error(t, client.CallContext(context.Background(), nil, "admin_banPeer", "not a peer ID"))
+
+	assert.NoError(t, client.CallContext(context.Background(), nil, "admin_unbanPeer", id))
+	assert.Empty(t, peers.banned)
+	assert.Error(t, client.CallContext(context.Background(), nil, "admin_unbanPeer", id), "not banned")
+}
+
+func TestAdminPeersDisabled(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, nil, &mockDriverClient{}, nil, nil, nil, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+	var out []p2p.PeerInfo
+	assert.ErrorContains(t, client.CallContext(context.Background(), &out, "admin_peers"), errP2PDisabled.Error())
+}
+
+func TestP2PStatus(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	id, err := peer.Decode("12D3KooWL3iKC7VFXob8u3fnEFXFPZS2rX4YHZ8RFFt4DdLemgUW")
+	assert.NoError(t, err)
+	peers := &mockPeerController{
+		peers: []p2p.PeerInfo{{ID: id, Addrs: []string{"/ip4/127.0.0.1/tcp/9222"}, Connected: true, Score: 3}},
+		self:  &p2p.SelfInfo{ID: id, Addrs: []string{"/ip4/127.0.0.1/tcp/9222"}, Protocols: []string{"/meshsub/1.1.0"}, Topics: []string{"/optimism/901/01020304/blocks"}},
+		stats: &p2p.Stats{
+			Connected: 1,
+			Inbound:   1,
+			Topics:    []p2p.TopicStats{{Topic: "/optimism/901/01020304/blocks", Peers: 1}},
+			Messages:  map[string]p2p.MessageStats{"accepted": {Total: 10, Rate: 0.5}},
+			Bandwidth: p2p.BandwidthStats{TotalIn: 1000, RateIn: 10},
+		},
+	}
+	// the p2p status is served without the admin API
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, nil, nil, nil, peers, nil, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+
+	var outPeers []p2p.PeerInfo
+	assert.NoError(t, client.CallContext(context.Background(), &outPeers, "opp2p_peers"))
+	assert.Equal(t, peers.peers, outPeers)
+	var self p2p.SelfInfo
+	assert.NoError(t, client.CallContext(context.Background(), &self, "opp2p_self"))
+	assert.Equal(t, peers.self, &self)
+	var stats p2p.Stats
+	assert.NoError(t, client.CallContext(context.Background(), &stats, "opp2p_stats"))
+	assert.Equal(t, peers.stats, &stats)
+
+	// and not served without the p2p stack
+	server, err = newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, nil, nil, nil, nil, nil, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+	client, err = dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+	assert.Error(t, client.CallContext(context.Background(), &stats, "opp2p_stats"))
+}
+
+func TestSyncStatus(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	dr := &mockDriverClient{head: common.Hash{0x42}}
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, dr, nil, nil, nil, nil, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+
+	var status driver.SyncStatus
+	assert.NoError(t, client.CallContext(context.Background(), &status, "optimism_syncStatus"))
+	assert.Equal(t, eth.L2BlockRef{Hash: dr.head, Number: 3}, status.UnsafeL2)
+	assert.True(t, status.EngineSyncing)
+	assert.Nil(t, status.SnapSyncTarget)
+
+	var reorgs []driver.ReorgEvent
+	assert.NoError(t, client.CallContext(context.Background(), &reorgs, "optimism_reorgHistory"))
+	assert.Len(t, reorgs, 1)
+	assert.Equal(t, driver.UnsafeHead, reorgs[0].Kind)
+	assert.Equal(t, uint64(2), reorgs[0].Depth)
+
+	var inclusions []index.BatchInclusion
+	assert.NoError(t, client.CallContext(context.Background(), &inclusions, "optimism_batchInclusion", dr.head))
+	assert.Equal(t, []index.BatchInclusion{{L1: eth.BlockID{Number: 10}, Item: 1, Tx: common.Hash{0xaa}}}, inclusions)
+	assert.Error(t, client.CallContext(context.Background(), &inclusions, "optimism_batchInclusion", common.Hash{0x01}))
+	var blocks []eth.BlockID
+	assert.NoError(t, client.CallContext(context.Background(), &blocks, "optimism_l2BlocksByBatchTx", common.Hash{0xaa}))
+	assert.Equal(t, []eth.BlockID{{Hash: dr.head, Number: 3}}, blocks)
+}
+
+func TestHeadsSubscription(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	dr := &mockDriverClient{}
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, dr, nil, nil, nil, nil, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	// subscriptions are not available over http
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+	_, err = client.Subscribe(context.Background(), "optimism", make(chan driver.HeadEvent), "heads")
+	assert.Error(t, err)
+
+	wsClient, err := dialRPCClientWithBackoff(context.Background(), log, "ws://"+server.Addr().String())
+	assert.NoError(t, err)
+	defer wsClient.Close()
+	events := make(chan driver.HeadEvent, 10)
+	sub, err := wsClient.Subscribe(context.Background(), "optimism", events, "heads", []string{"safe"})
+	assert.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	unsafe := driver.HeadEvent{Kind: driver.UnsafeHead, New: eth.L2BlockRef{Number: 3}}
+	safe := driver.HeadEvent{Kind: driver.SafeHead, Old: eth.L2BlockRef{Number: 2}, New: eth.L2BlockRef{Number: 1}, ReorgDepth: 1}
+	// wait for the subscription of the server to the driver
+	for dr.heads.Send(unsafe) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	dr.heads.Send(safe)
+	select {
+	case ev := <-events:
+		assert.Equal(t, safe, ev, "only safe head events are sent")
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no head event")
+	}
+}
+
+type mockDriverClient struct {
+	head     common.Hash
+	active   bool
+	payloads []*driver.UnsafePayload
+	paused   bool
+	heads    event.Feed
+}
+
+func (c *mockDriverClient) StartSequencer(ctx context.Context, blockHash common.Hash) error {
+	if blockHash != c.head {
+		return errors.New("block hash does not match")
+	}
+	c.active = true
+	return nil
+}
+
+func (c *mockDriverClient) StopSequencer(ctx context.Context) (common.Hash, error) {
+	c.active = false
+	return c.head, nil
+}
+
+func (c *mockDriverClient) SequencerActive(ctx context.Context) (bool, error) {
+	return c.active, nil
+}
+
+func (c *mockDriverClient) ResetChain(ctx context.Context, blockHash common.Hash) error {
+	c.head = blockHash
+	return nil
+}
+
+func (c *mockDriverClient) PauseDerivation(ctx context.Context) error {
+	if c.paused {
+		return driver.ErrDerivationAlreadyPaused
+	}
+	c.paused = true
+	return nil
+}
+
+func (c *mockDriverClient) ResumeDerivation(ctx context.Context) error {
+	if !c.paused {
+		return driver.ErrDerivationNotPaused
+	}
+	c.paused = false
+	return nil
+}
+
+func (c *mockDriverClient) DeriveBlock(ctx context.Context, num uint64) (*driver.DerivedBlock, error) {
+	return &driver.DerivedBlock{
+		Canonical:   eth.L2BlockRef{Hash: c.head, Number: num},
+		Attributes:  &l2.PayloadAttributes{Timestamp: 42},
+		Differences: []string{"timestamp: derived 42, canonical 43"},
+	}, nil
+}
+
+func (c *mockDriverClient) SyncStatus(ctx context.Context) (*driver.SyncStatus, error) {
+	return &driver.SyncStatus{UnsafeL2: eth.L2BlockRef{Hash: c.head, Number: 3}, SafeL2: eth.L2BlockRef{Number: 2}, EngineSyncing: true}, nil
+}
+
+func (c *mockDriverClient) BatchInclusion(ctx context.Context, l2Hash common.Hash) ([]index.BatchInclusion, error) {
+	if l2Hash != c.head {
+		return nil, ethereum.NotFound
+	}
+	return []index.BatchInclusion{{L1: eth.BlockID{Number: 10}, Item: 1, Tx: common.Hash{0xaa}}}, nil
+}
+
+func (c *mockDriverClient) L2BlocksByBatchTx(ctx context.Context, txHash common.Hash) ([]eth.BlockID, error) {
+	return []eth.BlockID{{Hash: c.head, Number: 3}}, nil
+}
+
+func (c *mockDriverClient) ReorgHistory() []driver.ReorgEvent {
+	return []driver.ReorgEvent{{Kind: driver.UnsafeHead, Old: eth.L2BlockRef{Number: 5}, New: eth.L2BlockRef{Number: 3}, Depth: 2}}
+}
+
+func (c *mockDriverClient) SubscribeHeadChanges(ch chan<- driver.HeadEvent) event.Subscription {
+	return c.heads.Subscribe(ch)
+}
+
+func (c *mockDriverClient) OnUnsafeL2Payload(ctx context.Context, payload *driver.UnsafePayload) error {
+	c.payloads = append(c.payloads, payload)
+	return nil
 }
 
 type mockL2Client struct {
 	head   *types.Header
 	result *AccountResult
+	// tags are the block tags that were requested
+	tags []string
+	err  error
 }
 
 func (c *mockL2Client) GetBlockHeader(ctx context.Context, blockTag string) (*types.Header, error) {
-	return c.head, nil
+	c.tags = append(c.tags, blockTag)
+	return c.head, c.err
 }
 
 func (c *mockL2Client) GetProof(ctx context.Context, address common.Address, blockTag string) (*AccountResult, error) {
+	c.tags = append(c.tags, blockTag)
 	return c.result, nil
 }
+
+func TestBatcherStatus(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	submitter := mockSubmitterClient{status: bss.SubmitterStatus{
+		InFlight:     []bss.InFlightTx{{Hash: common.Hash{1}, Nonce: 3, DataSize: 100, Replacements: 1, Age: "1m0s"}},
+		PendingBytes: 100,
+		QueueDepth:   2,
+	}}
+	server, err := newRPCServer(context.Background(), "localhost", 0, &rollup.Config{}, &mockL2Client{}, nil, nil, nil, nil, submitter, common.Address{}, 0, log, VersionInfo{Version: "0.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start())
+	defer server.Stop()
+
+	client, err := dialRPCClientWithBackoff(context.Background(), log, "http://"+server.Addr().String())
+	assert.NoError(t, err)
+	var status bss.SubmitterStatus
+	assert.NoError(t, client.CallContext(context.Background(), &status, "batcher_status"))
+	assert.Equal(t, submitter.status, status)
+}
+
+type mockSubmitterClient struct {
+	status bss.SubmitterStatus
+}
+
+func (c mockSubmitterClient) Status() bss.SubmitterStatus {
+	return c.status
+}
@@ -0,0 +1,49 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l1"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Verify re-derives the L2 chain from the given L1 block number, and compares it against the canonical chain
+// of the first L2 engine. It returns the last verified L2 block, or a driver.DivergenceError if the chains differ.
+func Verify(ctx context.Context, cfg *Config, log log.Logger, fromL1 uint64) (eth.L2BlockRef, error) {
+	if err := cfg.Check(); err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	if len(cfg.L2EngineAddrs) == 0 {
+		return eth.L2BlockRef{}, fmt.Errorf("no L2 engine to verify")
+	}
+
+	l1Client, err := dialL1(ctx, cfg, log)
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	l1Source, err := l1.NewSource(l1Client, log, cfg.l1SourceConfig())
+	if err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("failed to create L1 source: %v", err)
+	}
+	defer l1Source.Close()
+
+	engineAuth, err := cfg.engineAuth()
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	l2Node, err := dialEngine(ctx, log, cfg.L2EngineAddrs[0], engineAuth)
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	l2Source, err := l2.NewSource(l2Node, &cfg.Rollup.Genesis, log)
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	defer l2Source.Close()
+
+	return driver.NewVerifier(cfg.Rollup, l2Source, l1Source, log).Verify(ctx, fromL1)
+}
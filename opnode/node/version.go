@@ -0,0 +1,60 @@
+package node
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// VersionInfo identifies the build of the rollup node, and the features that are enabled by its configuration.
+type VersionInfo struct {
+	// Version is the semantic version of the release
+	Version string `json:"version"`
+	// GitCommit and GitDate identify the source the node was built from, empty if unknown
+	GitCommit string `json:"gitCommit"`
+	GitDate   string `json:"gitDate"`
+	// Meta is the version metadata, e.g. "dev" for development builds
+	Meta string `json:"meta"`
+	// Features are the optional derivation rules and node features that are enabled, see Config.Features
+	Features []string `json:"features"`
+}
+
+// String returns the version including the build metadata.
+func (v VersionInfo) String() string {
+	s := v.Version
+	if len(v.GitCommit) >= 8 {
+		s += "-" + v.GitCommit[:8]
+	}
+	if v.GitDate != "" {
+		s += "-" + v.GitDate
+	}
+	if v.Meta != "" {
+		s += "-" + v.Meta
+	}
+	return s
+}
+
+// Features lists the optional derivation rules and node features that are enabled by the config,
+// to audit which rules each node of a network derives the L2 chain with, e.g. during upgrades.
+func (cfg *Config) Features() []string {
+	features := []string{}
+	add := func(name string, enabled bool) {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	// derivation rules
+	add("channel-timeout", cfg.Rollup.ChannelTimeout != 0)
+	add("channel-limits", cfg.Rollup.MaxChannelSize != 0 || cfg.Rollup.MaxOpenChannels != 0 || cfg.Rollup.MaxChannelBankSize != 0)
+	add("system-config", cfg.Rollup.SystemConfigAddress != (common.Address{}))
+	add("blob-data", cfg.Driver.L1BeaconAddr != "")
+	add("batch-data-files", cfg.Driver.BatchDataDir != "")
+	add("unsafe-payload-signatures", cfg.Rollup.P2PSequencerAddress != (common.Address{}))
+	// node features
+	add("sequencer", cfg.Driver.SequencerEnabled)
+	add("span-batches", cfg.Driver.SequencerEnabled && cfg.SpanBatches)
+	add("zlib-batches", cfg.Driver.SequencerEnabled && cfg.BatchCompression == "zlib")
+	add("beacon-headers", cfg.L1BeaconHeaders)
+	add("l1-failover", len(cfg.L1FallbackAddrs) > 0)
+	add("redundant-engine", cfg.L2SecondaryEngineAddr != "")
+	add("snap-sync", cfg.Driver.SnapSyncThreshold != 0)
+	return features
+}
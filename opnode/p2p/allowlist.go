@@ -0,0 +1,46 @@
+package p2p
+
+import (
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// allowlistGater refuses the connections of the peers that are not allowlisted, for a private mesh.
+// The connections of allowlisted peers are left to the wrapped gater.
+type allowlistGater struct {
+	connmgr.ConnectionGater
+	allowed map[peer.ID]struct{}
+}
+
+func newAllowlistGater(inner connmgr.ConnectionGater, allowed []peer.ID) *allowlistGater {
+	g := &allowlistGater{ConnectionGater: inner, allowed: make(map[peer.ID]struct{}, len(allowed))}
+	for _, id := range allowed {
+		g.allowed[id] = struct{}{}
+	}
+	return g
+}
+
+func (g *allowlistGater) allow(id peer.ID) bool {
+	_, ok := g.allowed[id]
+	if !ok {
+		metrics.GetOrRegisterCounter("p2p/peers/refused", nil).Inc(1)
+	}
+	return ok
+}
+
+func (g *allowlistGater) InterceptPeerDial(id peer.ID) bool {
+	return g.allow(id) && g.ConnectionGater.InterceptPeerDial(id)
+}
+
+func (g *allowlistGater) InterceptAddrDial(id peer.ID, addr ma.Multiaddr) bool {
+	return g.allow(id) && g.ConnectionGater.InterceptAddrDial(id, addr)
+}
+
+// InterceptSecured refuses the inbound connections of the peers that are not allowlisted, once their peer ID is
+// authenticated.
+func (g *allowlistGater) InterceptSecured(dir network.Direction, id peer.ID, addrs network.ConnMultiaddrs) bool {
+	return g.allow(id) && g.ConnectionGater.InterceptSecured(dir, id, addrs)
+}
@@ -0,0 +1,67 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfigNode(t *testing.T, cfg *Config) *Node {
+	rollupCfg, _ := testRollup(t, 901)
+	addrs, err := ParseMultiaddrs([]string{"/ip4/127.0.0.1/tcp/0"})
+	require.NoError(t, err)
+	cfg.ListenAddrs = addrs
+	n, err := NewNode(context.Background(), cfg, rollupCfg, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = n.Close() })
+	return n
+}
+
+func TestPeerAllowlist(t *testing.T) {
+	allowedKey, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	require.NoError(t, err)
+	allowedID, err := peer.IDFromPrivateKey(allowedKey)
+	require.NoError(t, err)
+	private := testConfigNode(t, &Config{PeerAllowlist: []peer.ID{allowedID}})
+	allowed := testConfigNode(t, &Config{PrivKey: allowedKey})
+	other := testConfigNode(t, &Config{})
+	addrInfo := func(n *Node) peer.AddrInfo { return peer.AddrInfo{ID: n.Host().ID(), Addrs: n.Host().Addrs()} }
+
+	require.NoError(t, allowed.Host().Connect(context.Background(), addrInfo(private)))
+	require.Error(t, private.Host().Connect(context.Background(), addrInfo(other)), "not allowlisted")
+	// the inbound connections of other peers are closed once they are authenticated
+	_ = other.Host().Connect(context.Background(), addrInfo(private))
+	require.Eventually(t, func() bool {
+		return private.Host().Network().Connectedness(other.Host().ID()) != network.Connected &&
+			other.Host().Network().Connectedness(private.Host().ID()) != network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, network.Connected, private.Host().Network().Connectedness(allowed.Host().ID()))
+}
+
+func TestPrivateNetwork(t *testing.T) {
+	key := make([]byte, PrivateNetworkKeySize)
+	key[0] = 1
+	a := testConfigNode(t, &Config{PrivateNetworkKey: key})
+	b := testConfigNode(t, &Config{PrivateNetworkKey: key})
+	otherKey := make([]byte, PrivateNetworkKeySize)
+	c := testConfigNode(t, &Config{PrivateNetworkKey: otherKey})
+	public := testConfigNode(t, &Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, a.Host().Connect(ctx, peer.AddrInfo{ID: b.Host().ID(), Addrs: b.Host().Addrs()}))
+	require.Error(t, a.Host().Connect(ctx, peer.AddrInfo{ID: c.Host().ID(), Addrs: c.Host().Addrs()}), "other network key")
+	require.Error(t, a.Host().Connect(ctx, peer.AddrInfo{ID: public.Host().ID(), Addrs: public.Host().Addrs()}), "public network")
+
+	addrs, err := ParseMultiaddrs([]string{"/ip4/127.0.0.1/tcp/0"})
+	require.NoError(t, err)
+	require.Error(t, (&Config{ListenAddrs: addrs, PrivateNetworkKey: []byte{1}}).Check(), "short key")
+}
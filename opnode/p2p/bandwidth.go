@@ -0,0 +1,177 @@
+package p2p
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	libp2pmetrics "github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// minBandwidthBurst is the smallest burst of the bandwidth limits, so that a low limit still lets small
+	// reads and writes through at once
+	minBandwidthBurst = 64 * 1024
+	// bandwidthMetricsInterval is the time between the updates of the bandwidth metrics
+	bandwidthMetricsInterval = 10 * time.Second
+	// bandwidthIdleTime is the time after which the bandwidth meters of idle peers are dropped
+	bandwidthIdleTime = time.Hour
+)
+
+// bandwidth accounts the traffic of the host, in total and by peer, and limits the traffic of the payloads-by-range
+// streams. The gossip is accounted but not limited: the limits keep the catch-up of the payloads from crowding out
+// the gossip of new payloads.
+type bandwidth struct {
+	counter *libp2pmetrics.BandwidthCounter
+	// global limits the traffic of all the streams, nil if unlimited
+	global *rate.Limiter
+	// peerLimit is the limit of the traffic of the streams of each peer, zero if unlimited
+	peerLimit uint64
+
+	mu    sync.Mutex
+	peers map[peer.ID]*rate.Limiter
+}
+
+func newBandwidth(globalLimit uint64, peerLimit uint64) *bandwidth {
+	b := &bandwidth{counter: libp2pmetrics.NewBandwidthCounter(), peerLimit: peerLimit, peers: make(map[peer.ID]*rate.Limiter)}
+	if globalLimit != 0 {
+		b.global = newBandwidthLimiter(globalLimit)
+	}
+	return b
+}
+
+// newBandwidthLimiter limits the traffic to the bytes per second, with bursts of a second of traffic.
+func newBandwidthLimiter(limit uint64) *rate.Limiter {
+	burst := limit
+	if burst < minBandwidthBurst {
+		burst = minBandwidthBurst
+	}
+	return rate.NewLimiter(rate.Limit(limit), int(burst))
+}
+
+func (b *bandwidth) peerLimiter(id peer.ID) *rate.Limiter {
+	if b.peerLimit == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lim, ok := b.peers[id]
+	if !ok {
+		lim = newBandwidthLimiter(b.peerLimit)
+		b.peers[id] = lim
+	}
+	return lim
+}
+
+// forget drops the limiters of the peers that are not kept, e.g. of the disconnected peers.
+func (b *bandwidth) forget(keep func(id peer.ID) bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id := range b.peers {
+		if !keep(id) {
+			delete(b.peers, id)
+		}
+	}
+}
+
+// wait blocks until n bytes of traffic with the peer are within the limits.
+func (b *bandwidth) wait(ctx context.Context, id peer.ID, n int) error {
+	for _, lim := range []*rate.Limiter{b.peerLimiter(id), b.global} {
+		if lim == nil {
+			continue
+		}
+		// waits above the burst are split up, they would fail at once otherwise
+		for left := n; left > 0; left -= lim.Burst() {
+			chunk := left
+			if chunk > lim.Burst() {
+				chunk = lim.Burst()
+			}
+			if err := lim.WaitN(ctx, chunk); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// limitedStream is a stream with a peer, whose reads and writes are held within the bandwidth limits.
+type limitedStream struct {
+	ctx    context.Context
+	stream io.ReadWriter
+	peer   peer.ID
+	bw     *bandwidth
+}
+
+func (b *bandwidth) limit(ctx context.Context, id peer.ID, stream io.ReadWriter) io.ReadWriter {
+	if b.global == nil && b.peerLimit == 0 {
+		return stream
+	}
+	return &limitedStream{ctx: ctx, stream: stream, peer: id, bw: b}
+}
+
+func (s *limitedStream) Read(p []byte) (int, error) {
+	n, err := s.stream.Read(p)
+	// the data is already received, the wait holds back the next read
+	if waitErr := s.bw.wait(s.ctx, s.peer, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+func (s *limitedStream) Write(p []byte) (int, error) {
+	if err := s.bw.wait(s.ctx, s.peer, len(p)); err != nil {
+		return 0, err
+	}
+	return s.stream.Write(p)
+}
+
+// BandwidthStats is the traffic of the host, or of a peer.
+type BandwidthStats struct {
+	// TotalIn and TotalOut are the bytes received and sent
+	TotalIn  int64 `json:"totalIn"`
+	TotalOut int64 `json:"totalOut"`
+	// RateIn and RateOut are the bytes per second received and sent, recently
+	RateIn  float64 `json:"rateIn"`
+	RateOut float64 `json:"rateOut"`
+}
+
+func bandwidthStats(s libp2pmetrics.Stats) BandwidthStats {
+	return BandwidthStats{TotalIn: s.TotalIn, TotalOut: s.TotalOut, RateIn: s.RateIn, RateOut: s.RateOut}
+}
+
+// Bandwidth returns the traffic of the host with all the peers.
+func (n *Node) Bandwidth() BandwidthStats {
+	return bandwidthStats(n.bandwidth.counter.GetBandwidthTotals())
+}
+
+// bandwidthMetricsLoop updates the bandwidth metrics periodically, drops the meters of idle peers
+// and the bandwidth, sync request and payload limiters and scores of disconnected peers, and decays the peer scores.
+func (n *Node) bandwidthMetricsLoop() {
+	ticker := time.NewTicker(bandwidthMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			stats := n.Bandwidth()
+			metrics.GetOrRegisterGauge("p2p/bandwidth/total_in", nil).Update(stats.TotalIn)
+			metrics.GetOrRegisterGauge("p2p/bandwidth/total_out", nil).Update(stats.TotalOut)
+			metrics.GetOrRegisterGauge("p2p/bandwidth/rate_in", nil).Update(int64(stats.RateIn))
+			metrics.GetOrRegisterGauge("p2p/bandwidth/rate_out", nil).Update(int64(stats.RateOut))
+			n.bandwidth.counter.TrimIdle(time.Now().Add(-bandwidthIdleTime))
+			connected := func(id peer.ID) bool {
+				return n.host.Network().Connectedness(id) == network.Connected
+			}
+			n.bandwidth.forget(connected)
+			n.rangeSync.forget(connected)
+			n.scores.decay()
+			n.scores.forget(connected)
+		case <-n.closing:
+			return
+		}
+	}
+}
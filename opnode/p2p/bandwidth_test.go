@@ -0,0 +1,49 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthLimits(t *testing.T) {
+	bw := newBandwidth(0, 0)
+	require.Nil(t, bw.peerLimiter("a"))
+	stream := new(bytes.Buffer)
+	require.Same(t, stream, bw.limit(context.Background(), "a", stream), "streams are not wrapped without limits")
+
+	bw = newBandwidth(4*minBandwidthBurst, minBandwidthBurst)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// a burst of each peer is let through at once, until the peer is over its limit
+	require.NoError(t, bw.wait(ctx, "a", minBandwidthBurst))
+	require.Error(t, bw.wait(ctx, "a", minBandwidthBurst/2))
+	require.NoError(t, bw.wait(ctx, "b", minBandwidthBurst))
+	// the global limit is shared by the peers
+	require.NoError(t, bw.wait(ctx, "c", minBandwidthBurst))
+	require.NoError(t, bw.wait(ctx, "d", minBandwidthBurst/2))
+	require.Error(t, bw.wait(ctx, "e", minBandwidthBurst), "over the global limit")
+
+	bw.forget(func(id peer.ID) bool { return id == "a" })
+	require.Len(t, bw.peers, 1)
+}
+
+func TestBandwidthAccounting(t *testing.T) {
+	cfg, _ := testRollup(t, 901)
+	server := testNode(t, cfg, nil)
+	client := testNode(t, cfg, nil)
+	connect(t, client, server)
+	chain := testPayloadChain(t, 20)
+	server.ServePayloadsByRange(chain)
+
+	_, err := client.RequestPayloadsByRange(context.Background(), server.Host().ID(), 5, 10, chain[10].BlockHash)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		peers := client.Peers()
+		return client.Bandwidth().TotalIn > 0 && len(peers) == 1 && peers[0].Bandwidth.TotalIn > 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,96 @@
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PrivateNetworkKeySize is the size of the pre-shared key of a private network
+const PrivateNetworkKeySize = 32
+
+// Config configures the p2p stack of the rollup node: the libp2p host, and the gossip of unsafe blocks.
+type Config struct {
+	// ListenAddrs are the multiaddrs that the host listens on, e.g. /ip4/0.0.0.0/tcp/9222
+	ListenAddrs []ma.Multiaddr
+	// Bootnodes are the peers that the host connects to on start-up
+	Bootnodes []peer.AddrInfo
+	// StaticPeers are the peers that the host stays connected to: they are redialed when disconnected,
+	// are not pruned when the host has too many peers, and are not banned by their score
+	StaticPeers []peer.AddrInfo
+	// PeerAllowlist turns the host into a private mesh: only the connections with the allowlisted peers and the
+	// static peers are accepted and dialed. All peers are accepted if empty.
+	PeerAllowlist []peer.ID
+	// PrivateNetworkKey is the pre-shared key of a private network: the connections are encrypted with the key,
+	// on top of the authenticated transport, so only the hosts with the key can connect. Not used if nil.
+	PrivateNetworkKey []byte
+	// PrivKey is the secp256k1 identity of the host. A new identity is generated on every start if nil.
+	PrivKey crypto.PrivKey
+	// Discovery configures the discovery of the peers of the rollup, peers are not discovered if nil
+	Discovery *DiscoveryConfig
+	// MaxPeers is the number of peers at which the discovery stops connecting to new peers, DefaultMaxPeers if 0.
+	// The connections beyond twice the max peers are pruned.
+	MaxPeers int
+	// MaxBandwidth and MaxPeerBandwidth limit the traffic of the payloads-by-range streams in bytes per second,
+	// of all the peers and of each peer, zero means no limit. The gossip is not limited.
+	MaxBandwidth     uint64
+	MaxPeerBandwidth uint64
+	// SequencerKey signs the payloads that the sequencer gossips, its address is the P2PSequencerAddress of the rollup.
+	// Only needed when sequencing.
+	SequencerKey *ecdsa.PrivateKey
+}
+
+// Check verifies that the p2p configuration makes sense.
+func (cfg *Config) Check() error {
+	if len(cfg.ListenAddrs) == 0 {
+		return errors.New("the p2p host needs at least one listen address")
+	}
+	if cfg.PrivateNetworkKey != nil && len(cfg.PrivateNetworkKey) != PrivateNetworkKeySize {
+		return fmt.Errorf("the private network key must be %d bytes, got %d", PrivateNetworkKeySize, len(cfg.PrivateNetworkKey))
+	}
+	return nil
+}
+
+// ParseMultiaddrs parses the given multiaddrs, e.g. the listen addresses of the host.
+func ParseMultiaddrs(addrs []string) ([]ma.Multiaddr, error) {
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		a, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiaddr %q: %w", addr, err)
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// ParsePeerIDs parses the given peer IDs, e.g. the peer allowlist.
+func ParsePeerIDs(ids []string) ([]peer.ID, error) {
+	out := make([]peer.ID, 0, len(ids))
+	for _, s := range ids {
+		id, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID %q: %w", s, err)
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// ParsePeers parses the multiaddrs of peers, which must include the peer ID, e.g. /ip4/1.2.3.4/tcp/9222/p2p/16Uiu2...
+// Multiple addresses of the same peer are merged.
+func ParsePeers(addrs []string) ([]peer.AddrInfo, error) {
+	parsed, err := ParseMultiaddrs(addrs)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := peer.AddrInfosFromP2pAddrs(parsed...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer address: %w", err)
+	}
+	return peers, nil
+}
@@ -0,0 +1,221 @@
+package p2p
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	gcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// ENRKey is the key of the ENR entry that identifies the rollup of a node, see OptimismENRData
+	ENRKey = "optimism"
+	// p2pVersion is the version of the p2p protocol that the node advertises in its ENR
+	p2pVersion = 0
+
+	// DefaultMaxPeers is the number of peers at which the discovery stops connecting to new peers
+	DefaultMaxPeers = 20
+	// discoveryFullInterval is the time that the discovery waits for before it looks for peers again,
+	// once the node has the maximum number of peers
+	discoveryFullInterval = 30 * time.Second
+)
+
+// DiscoveryConfig configures the discovery of the peers of the rollup with discv5.
+type DiscoveryConfig struct {
+	// ListenIP and Port are the UDP address that discv5 listens on
+	ListenIP net.IP
+	Port     int
+	// AdvertiseIP is the IP of the node in its ENR. It is learned from the peers if nil.
+	AdvertiseIP net.IP
+	// Bootnodes are the discv5 nodes that the discovery starts from
+	Bootnodes []*enode.Node
+	// DBPath is the path of the database of the discovered nodes, the nodes are kept in memory if empty
+	DBPath string
+}
+
+// OptimismENRData is the ENR entry of a rollup node: the L2 chain ID of the rollup, the version of
+// the p2p protocol, and the fork ID of the rollup (see ComputeForkID).
+// The discovery only connects to the nodes of the same rollup, with the same genesis and p2p upgrades.
+type OptimismENRData struct {
+	ChainID uint64
+	Version uint64
+	ForkID  ForkDigest
+}
+
+func (d *OptimismENRData) ENRKey() string {
+	return ENRKey
+}
+
+// discovery finds the peers of the rollup with discv5, and connects to them until the node has enough peers.
+type discovery struct {
+	db   *enode.DB
+	udp  *discover.UDPv5
+	done chan struct{}
+}
+
+// ParseBootnodes parses the ENRs, or enode URLs, of discv5 bootnodes.
+func ParseBootnodes(nodes []string) ([]*enode.Node, error) {
+	out := make([]*enode.Node, 0, len(nodes))
+	for _, n := range nodes {
+		node, err := enode.Parse(enode.ValidSchemes, n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootnode %q: %w", n, err)
+		}
+		out = append(out, node)
+	}
+	return out, nil
+}
+
+// discoveryKey returns the key of the host identity in the form of discv5, which only supports secp256k1 keys.
+func discoveryKey(key crypto.PrivKey) (*ecdsa.PrivateKey, error) {
+	if key.Type() != crypto.Secp256k1 {
+		return nil, fmt.Errorf("discovery requires a secp256k1 identity, got %s", key.Type())
+	}
+	raw, err := key.Raw()
+	if err != nil {
+		return nil, err
+	}
+	return gcrypto.ToECDSA(raw)
+}
+
+// enodeAddrInfo returns the libp2p peer of a discovered node: its peer ID and its TCP address.
+func enodeAddrInfo(node *enode.Node) (peer.AddrInfo, error) {
+	pub, err := crypto.UnmarshalSecp256k1PublicKey(gcrypto.CompressPubkey(node.Pubkey()))
+	if err != nil {
+		return peer.AddrInfo{}, err
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return peer.AddrInfo{}, err
+	}
+	if node.IP() == nil || node.TCP() == 0 {
+		return peer.AddrInfo{}, fmt.Errorf("node %s has no TCP address", node.ID())
+	}
+	proto := "ip4"
+	if node.IP().To4() == nil {
+		proto = "ip6"
+	}
+	addr, err := ma.NewMultiaddr(fmt.Sprintf("/%s/%s/tcp/%d", proto, node.IP(), node.TCP()))
+	if err != nil {
+		return peer.AddrInfo{}, err
+	}
+	return peer.AddrInfo{ID: id, Addrs: []ma.Multiaddr{addr}}, nil
+}
+
+// tcpPort returns the TCP port that the host listens on, 0 if none.
+func tcpPort(addrs []ma.Multiaddr) int {
+	for _, addr := range addrs {
+		if v, err := addr.ValueForProtocol(ma.P_TCP); err == nil {
+			port, err := strconv.Atoi(v)
+			if err == nil {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// startDiscovery starts discv5, with the rollup of the node in its ENR, and connects to the discovered peers.
+func (n *Node) startDiscovery(cfg *DiscoveryConfig, key crypto.PrivKey, rollupCfg *rollup.Config, maxPeers int) error {
+	priv, err := discoveryKey(key)
+	if err != nil {
+		return err
+	}
+	db, err := enode.OpenDB(cfg.DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to open the discovery database: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: cfg.ListenIP, Port: cfg.Port})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to listen for discovery: %w", err)
+	}
+	ln := enode.NewLocalNode(db, priv)
+	self := OptimismENRData{ChainID: rollupCfg.L2ChainID.Uint64(), Version: p2pVersion, ForkID: ComputeForkID(rollupCfg)}
+	ln.Set(&self)
+	ln.Set(enr.TCP(tcpPort(n.host.Network().ListenAddresses())))
+	ln.SetFallbackUDP(conn.LocalAddr().(*net.UDPAddr).Port)
+	if cfg.AdvertiseIP != nil {
+		ln.SetStaticIP(cfg.AdvertiseIP)
+	} else {
+		ln.SetFallbackIP(net.IPv4(127, 0, 0, 1))
+	}
+	udp, err := discover.ListenV5(conn, ln, discover.Config{
+		PrivateKey: priv,
+		Bootnodes:  cfg.Bootnodes,
+		Log:        n.log.New("service", "discv5"),
+	})
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return fmt.Errorf("failed to start discovery: %w", err)
+	}
+	n.discovery = &discovery{db: db, udp: udp, done: make(chan struct{})}
+	n.log.Info("Started discovery", "enr", udp.Self())
+	nodes := enode.Filter(udp.RandomNodes(), func(node *enode.Node) bool {
+		var data OptimismENRData
+		if err := node.Load(&data); err != nil {
+			return false
+		}
+		return data == self
+	})
+	go n.discoveryLoop(nodes, maxPeers)
+	return nil
+}
+
+// discoveryLoop connects to the discovered nodes of the rollup, until the iterator is closed.
+func (n *Node) discoveryLoop(nodes enode.Iterator, maxPeers int) {
+	defer close(n.discovery.done)
+	defer nodes.Close()
+	for nodes.Next() {
+		for len(n.host.Network().Peers()) >= maxPeers {
+			select {
+			case <-time.After(discoveryFullInterval):
+			case <-n.closing:
+				return
+			}
+		}
+		info, err := enodeAddrInfo(nodes.Node())
+		if err != nil {
+			n.log.Trace("Skipping discovered node", "node", nodes.Node().ID(), "err", err)
+			continue
+		}
+		if info.ID == n.host.ID() || n.host.Network().Connectedness(info.ID) == network.Connected || n.scores.banned(info.ID) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), bootnodeDialTimeout)
+		if err := n.host.Connect(ctx, info); err != nil {
+			n.log.Debug("Failed to connect to discovered peer", "peer", info.ID, "err", err)
+		} else {
+			n.log.Info("Connected to discovered peer", "peer", info.ID, "addrs", info.Addrs)
+		}
+		cancel()
+	}
+}
+
+// ENR returns the node record of the node, nil if the discovery is disabled.
+func (n *Node) ENR() *enode.Node {
+	if n.discovery == nil {
+		return nil
+	}
+	return n.discovery.udp.Self()
+}
+
+func (d *discovery) close() {
+	// closing discv5 ends the iteration of the discovered nodes
+	d.udp.Close()
+	<-d.done
+	d.db.Close()
+}
@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func discoveryNode(t *testing.T, cfg *rollup.Config, bootnodes ...*enode.Node) *Node {
+	addrs, err := ParseMultiaddrs([]string{"/ip4/127.0.0.1/tcp/0"})
+	require.NoError(t, err)
+	discovery := &DiscoveryConfig{ListenIP: net.IPv4(127, 0, 0, 1), AdvertiseIP: net.IPv4(127, 0, 0, 1), Bootnodes: bootnodes}
+	n, err := NewNode(context.Background(), &Config{ListenAddrs: addrs, Discovery: discovery}, cfg, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = n.Close() })
+	return n
+}
+
+func TestDiscovery(t *testing.T) {
+	cfg, _ := testRollup(t, 901)
+	otherCfg, _ := testRollup(t, 902)
+	bootnode := discoveryNode(t, cfg)
+	other := discoveryNode(t, otherCfg, bootnode.ENR())
+	n := discoveryNode(t, cfg, bootnode.ENR())
+
+	var data OptimismENRData
+	require.NoError(t, n.ENR().Load(&data))
+	require.Equal(t, OptimismENRData{ChainID: 901, Version: p2pVersion, ForkID: ComputeForkID(cfg)}, data)
+
+	info, err := enodeAddrInfo(n.ENR())
+	require.NoError(t, err)
+	require.Equal(t, n.Host().ID(), info.ID, "the ENR identifies the libp2p host")
+
+	require.Eventually(t, func() bool {
+		return n.Host().Network().Connectedness(bootnode.Host().ID()) == network.Connected
+	}, 10*time.Second, 50*time.Millisecond)
+	require.NotEqual(t, network.Connected, n.Host().Network().Connectedness(other.Host().ID()), "node of other chain is not connected")
+	require.NotEqual(t, network.Connected, other.Host().Network().Connectedness(bootnode.Host().ID()), "node of other chain is not connected")
+}
+
+func TestDiscoveryKey(t *testing.T) {
+	key, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	require.NoError(t, err)
+	priv, err := discoveryKey(key)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(key)
+	require.NoError(t, err)
+	info, err := enodeAddrInfo(enode.NewV4(&priv.PublicKey, net.IPv4(1, 2, 3, 4), 9222, 9222))
+	require.NoError(t, err)
+	require.Equal(t, id, info.ID)
+	require.Equal(t, "/ip4/1.2.3.4/tcp/9222", info.Addrs[0].String())
+
+	edKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	_, err = discoveryKey(edKey)
+	require.Error(t, err)
+
+	_, err = ParseBootnodes([]string{"enr:not-a-record"})
+	require.Error(t, err)
+}
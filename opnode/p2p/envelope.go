@@ -0,0 +1,67 @@
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang/snappy"
+)
+
+// PayloadEnvelope is a gossiped payload, with the signature of the sequencer.
+type PayloadEnvelope struct {
+	// Signature is the 65 byte signature of the sequencer over the signing hash of the payload, see l2.PayloadSigningHash
+	Signature []byte
+	Payload   *l2.ExecutionPayload
+}
+
+// SignPayload wraps the payload in an envelope signed by the sequencer key.
+func SignPayload(chainID *big.Int, payload *l2.ExecutionPayload, key *ecdsa.PrivateKey) (*PayloadEnvelope, error) {
+	if chainID == nil {
+		return nil, errors.New("the L2 chain ID is required to sign payloads")
+	}
+	hash := l2.PayloadSigningHash(chainID, payload)
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign payload %s: %w", payload.ID(), err)
+	}
+	return &PayloadEnvelope{Signature: sig, Payload: payload}, nil
+}
+
+// encodeEnvelope encodes the envelope as the signature followed by the JSON of the payload, compressed with snappy.
+func encodeEnvelope(env *PayloadEnvelope) ([]byte, error) {
+	if len(env.Signature) != crypto.SignatureLength {
+		return nil, fmt.Errorf("signature has %d bytes, expected %d", len(env.Signature), crypto.SignatureLength)
+	}
+	data, err := json.Marshal(env.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return snappy.Encode(nil, append(env.Signature[:crypto.SignatureLength:crypto.SignatureLength], data...)), nil
+}
+
+func decodeEnvelope(data []byte) (*PayloadEnvelope, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxGossipSize {
+		return nil, fmt.Errorf("payload of %d bytes is too large", n)
+	}
+	data, err = snappy.Decode(nil, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < crypto.SignatureLength {
+		return nil, fmt.Errorf("envelope of %d bytes is too short for the signature", len(data))
+	}
+	var payload l2.ExecutionPayload
+	if err := json.Unmarshal(data[crypto.SignatureLength:], &payload); err != nil {
+		return nil, err
+	}
+	return &PayloadEnvelope{Signature: data[:crypto.SignatureLength], Payload: &payload}, nil
+}
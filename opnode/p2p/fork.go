@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// upgradeTopicWindow is the time before and after a p2p upgrade during which the node is in the gossip of both sides
+// of the upgrade, so that the payloads around the upgrade reach the nodes whose clocks are off
+const upgradeTopicWindow = 5 * time.Minute
+
+// ForkDigest identifies the rollup and its p2p upgrade that a payload belongs to. The gossip of each fork digest is
+// separate: the nodes of other rollups, and the nodes before or after an upgrade, do not share a mesh.
+type ForkDigest [4]byte
+
+func (d ForkDigest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// upgradeIndex returns the number of p2p upgrades of the rollup that are active at the L2 timestamp.
+func upgradeIndex(cfg *rollup.Config, timestamp uint64) uint64 {
+	return uint64(sort.Search(len(cfg.P2PUpgradeTimes), func(i int) bool { return cfg.P2PUpgradeTimes[i] > timestamp }))
+}
+
+// ComputeForkDigest returns the fork digest of the payloads with the L2 timestamp: the first bytes of the hash of the
+// L2 chain ID, the L2 genesis block hash, and the number of p2p upgrades active at the timestamp.
+func ComputeForkDigest(cfg *rollup.Config, timestamp uint64) ForkDigest {
+	chainID := common.BigToHash(cfg.L2ChainID)
+	var upgrade [8]byte
+	binary.BigEndian.PutUint64(upgrade[:], upgradeIndex(cfg, timestamp))
+	var d ForkDigest
+	copy(d[:], crypto.Keccak256(chainID[:], cfg.Genesis.L2.Hash[:], upgrade[:]))
+	return d
+}
+
+// ComputeForkID returns the fork ID of the rollup that nodes advertise in their ENR: the first bytes of the hash of the
+// L2 chain ID, the L2 genesis block hash, and the times of all p2p upgrades. Unlike the fork digest, it does not change
+// at the upgrades, and only the nodes that agree on the upgrades have the same fork ID.
+func ComputeForkID(cfg *rollup.Config) ForkDigest {
+	chainID := common.BigToHash(cfg.L2ChainID)
+	data := append(chainID[:], cfg.Genesis.L2.Hash[:]...)
+	for _, t := range cfg.P2PUpgradeTimes {
+		var upgrade [8]byte
+		binary.BigEndian.PutUint64(upgrade[:], t)
+		data = append(data, upgrade[:]...)
+	}
+	var d ForkDigest
+	copy(d[:], crypto.Keccak256(data))
+	return d
+}
+
+// activeForkDigests returns the fork digests whose gossip the node is in at the time: the digest of the time,
+// and the digest on the other side of an upgrade within upgradeTopicWindow, the older digest first.
+func activeForkDigests(cfg *rollup.Config, now time.Time) []ForkDigest {
+	window := uint64(upgradeTopicWindow / time.Second)
+	t := uint64(now.Unix())
+	before := ComputeForkDigest(cfg, t-window)
+	after := ComputeForkDigest(cfg, t+window)
+	current := ComputeForkDigest(cfg, t)
+	out := []ForkDigest{before}
+	if current != before {
+		out = append(out, current)
+	}
+	if after != current {
+		out = append(out, after)
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package p2p
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeForkDigest(t *testing.T) {
+	cfg := &rollup.Config{L2ChainID: big.NewInt(901), P2PUpgradeTimes: []uint64{1000, 2000}}
+	cfg.Genesis.L2.Hash = common.Hash{1}
+	digest := ComputeForkDigest(cfg, 0)
+	require.Equal(t, digest, ComputeForkDigest(cfg, 999))
+	require.NotEqual(t, digest, ComputeForkDigest(cfg, 1000), "upgrade")
+	require.Equal(t, ComputeForkDigest(cfg, 1000), ComputeForkDigest(cfg, 1999))
+	require.NotEqual(t, ComputeForkDigest(cfg, 1000), ComputeForkDigest(cfg, 2000), "second upgrade")
+
+	other := *cfg
+	other.L2ChainID = big.NewInt(902)
+	require.NotEqual(t, digest, ComputeForkDigest(&other, 0), "other chain")
+	other = *cfg
+	other.Genesis.L2.Hash = common.Hash{2}
+	require.NotEqual(t, digest, ComputeForkDigest(&other, 0), "other genesis")
+}
+
+func TestComputeForkID(t *testing.T) {
+	cfg := &rollup.Config{L2ChainID: big.NewInt(901), P2PUpgradeTimes: []uint64{1000, 2000}}
+	id := ComputeForkID(cfg)
+
+	other := *cfg
+	other.L2ChainID = big.NewInt(902)
+	require.NotEqual(t, id, ComputeForkID(&other), "other chain")
+	other = *cfg
+	other.Genesis.L2.Hash = common.Hash{2}
+	require.NotEqual(t, id, ComputeForkID(&other), "other genesis")
+	other = *cfg
+	other.P2PUpgradeTimes = []uint64{1000, 3000}
+	require.NotEqual(t, id, ComputeForkID(&other), "other upgrade time")
+	other.P2PUpgradeTimes = []uint64{1000}
+	require.NotEqual(t, id, ComputeForkID(&other), "missing upgrade")
+}
+
+func TestActiveForkDigests(t *testing.T) {
+	upgrade := uint64(time.Now().Unix())
+	cfg := &rollup.Config{L2ChainID: big.NewInt(901), P2PUpgradeTimes: []uint64{upgrade}}
+	before, after := ComputeForkDigest(cfg, upgrade-1), ComputeForkDigest(cfg, upgrade)
+	at := func(t uint64) time.Time { return time.Unix(int64(t), 0) }
+
+	require.Equal(t, []ForkDigest{before}, activeForkDigests(cfg, at(upgrade).Add(-2*upgradeTopicWindow)))
+	require.Equal(t, []ForkDigest{before, after}, activeForkDigests(cfg, at(upgrade).Add(-upgradeTopicWindow/2)), "ahead of the upgrade")
+	require.Equal(t, []ForkDigest{before, after}, activeForkDigests(cfg, at(upgrade).Add(upgradeTopicWindow/2)), "after the upgrade")
+	require.Equal(t, []ForkDigest{after}, activeForkDigests(cfg, at(upgrade).Add(2*upgradeTopicWindow)))
+}
+
+func TestGossipUpgrade(t *testing.T) {
+	cfg, key := testRollup(t, 901)
+	// the nodes are in the gossip of both sides of the upgrade
+	cfg.P2PUpgradeTimes = []uint64{uint64(time.Now().Unix())}
+	sequencer := testNode(t, cfg, key)
+	verifier := testNode(t, cfg, nil)
+	require.Len(t, verifier.gossip.topics, 2)
+	connect(t, verifier, sequencer)
+
+	received := make(chan *PayloadEnvelope, 10)
+	require.NoError(t, verifier.Subscribe(gossipInFn(func(from peer.ID, env *PayloadEnvelope) {
+		received <- env
+	})))
+	require.Eventually(t, func() bool {
+		return len(sequencer.gossip.topicPeers()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the payloads of both sides are received, each on the topic of its fork digest
+	for _, number := range []uint64{4, 5} {
+		p := testGossipPayload(t, number)
+		if number == 4 {
+			p.Timestamp -= 30
+			hash, err := p.ComputeBlockHash()
+			require.NoError(t, err)
+			p.BlockHash = hash
+		}
+		require.NoError(t, sequencer.PublishL2Payload(context.Background(), p))
+		select {
+		case got := <-received:
+			require.Equal(t, p.BlockHash, got.Payload.BlockHash)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("payload %d not received", number)
+		}
+	}
+
+	// past the window, the topic of before the upgrade is left
+	verifier.gossip.now = func() time.Time { return time.Now().Add(2 * upgradeTopicWindow) }
+	require.NoError(t, verifier.gossip.updateTopics())
+	require.Len(t, verifier.gossip.topics, 1)
+	_, ok := verifier.gossip.topics[ComputeForkDigest(cfg, uint64(time.Now().Unix()))]
+	require.True(t, ok)
+}
@@ -0,0 +1,406 @@
+package p2p
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// maxGossipSize is the maximum size of a gossiped payload, compressed
+	maxGossipSize = 10 * (1 << 20)
+	// maxPayloadFutureTime is how far ahead of the local clock the timestamp of a gossiped payload may be
+	maxPayloadFutureTime = 5 * time.Second
+	// maxPayloadAge is how far behind the local clock the timestamp of a gossiped payload may be.
+	// Older payloads are not relayed: peers that fall behind catch up from L1 instead.
+	maxPayloadAge = 60 * time.Second
+	// onPayloadTimeout is the time that the receiver gets to take a gossiped payload
+	onPayloadTimeout = 10 * time.Second
+	// topicUpdateInterval is the time between the checks of the topics of the active fork digests
+	topicUpdateInterval = 10 * time.Second
+)
+
+var (
+	ErrGossipClosed   = errors.New("gossip closed")
+	ErrNoSequencerKey = errors.New("no sequencer key to sign the gossiped payloads")
+	ErrNoGossipTopic  = errors.New("not in the gossip topic of the payload")
+)
+
+// GossipIn receives the payloads gossiped by peers.
+type GossipIn interface {
+	// OnUnsafeL2Payload is called with each valid payload, from is the peer that relayed it.
+	OnUnsafeL2Payload(ctx context.Context, from peer.ID, env *PayloadEnvelope) error
+}
+
+// BlocksTopic is the gossip topic of the unsafe blocks of the rollup with the fork digest.
+func BlocksTopic(cfg *rollup.Config, digest ForkDigest) string {
+	return fmt.Sprintf("/optimism/%s/%s/blocks", cfg.L2ChainID, digest)
+}
+
+// gossipTopic is the gossip of the unsafe blocks of a fork digest.
+type gossipTopic struct {
+	topic *pubsub.Topic
+	// sub and cancel are nil until the node subscribes
+	sub    *pubsub.Subscription
+	cancel context.CancelFunc
+}
+
+// gossip publishes and receives the unsafe blocks of the rollup over gossipsub. The node is in the gossip of the
+// fork digest of the current time, and around the p2p upgrades of the rollup also in the gossip of the other side
+// of the upgrade, see activeForkDigests.
+type gossip struct {
+	log  log.Logger
+	self peer.ID
+	ps   *pubsub.PubSub
+	cfg  *rollup.Config
+	// scores of the peers by the payloads they relay
+	scores *peerScores
+	// sequencerKey signs the published payloads, nil if the node does not sequence
+	sequencerKey *ecdsa.PrivateKey
+	now          func() time.Time
+
+	// meters of the gossip messages by their outcome, see gossipOutcomes
+	meters map[string]metrics.Meter
+
+	mu     sync.Mutex
+	topics map[ForkDigest]*gossipTopic
+	// in receives the payloads, nil until the node subscribes
+	in     GossipIn
+	closed bool
+	// closing stops the updates of the topics
+	closing chan struct{}
+}
+
+func newGossip(ctx context.Context, h host.Host, cfg *rollup.Config, sequencerKey *ecdsa.PrivateKey, scores *peerScores, log log.Logger) (*gossip, error) {
+	ps, err := pubsub.NewGossipSub(ctx, h,
+		pubsub.WithMaxMessageSize(maxGossipSize),
+		// the same payload relayed by different peers is the same message
+		pubsub.WithMessageIdFn(messageID),
+		// the payloads of the sequencer are sent to all the peers of the topic, not only to the mesh,
+		// to not wait for the mesh to form and for the least latency
+		pubsub.WithFloodPublish(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start gossipsub: %w", err)
+	}
+	g := &gossip{
+		log:          log,
+		self:         h.ID(),
+		ps:           ps,
+		cfg:          cfg,
+		scores:       scores,
+		sequencerKey: sequencerKey,
+		now:          time.Now,
+		topics:       make(map[ForkDigest]*gossipTopic),
+		closing:      make(chan struct{}),
+		meters:       make(map[string]metrics.Meter),
+	}
+	for _, outcome := range gossipOutcomes {
+		// the meters are kept when metrics are disabled, for the gossip stats
+		g.meters[outcome] = metrics.NewMeterForced()
+	}
+	if err := g.updateTopics(); err != nil {
+		g.close()
+		return nil, err
+	}
+	// the topics only change around the p2p upgrades
+	if len(cfg.P2PUpgradeTimes) > 0 {
+		go g.topicsLoop()
+	}
+	return g, nil
+}
+
+// topicsLoop joins and leaves the topics of the fork digests as the time passes the p2p upgrades.
+func (g *gossip) topicsLoop() {
+	ticker := time.NewTicker(topicUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := g.updateTopics(); err != nil {
+				g.log.Error("Failed to update the gossip topics", "err", err)
+			}
+		case <-g.closing:
+			return
+		}
+	}
+}
+
+// updateTopics joins the topics of the active fork digests, and leaves the topics of the other digests.
+func (g *gossip) updateTopics() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return ErrGossipClosed
+	}
+	active := make(map[ForkDigest]struct{})
+	for _, digest := range activeForkDigests(g.cfg, g.now()) {
+		active[digest] = struct{}{}
+		if _, ok := g.topics[digest]; ok {
+			continue
+		}
+		if err := g.joinLocked(digest); err != nil {
+			return err
+		}
+	}
+	for digest := range g.topics {
+		if _, ok := active[digest]; !ok {
+			g.leaveLocked(digest)
+		}
+	}
+	return nil
+}
+
+func (g *gossip) joinLocked(digest ForkDigest) error {
+	name := BlocksTopic(g.cfg, digest)
+	if err := g.ps.RegisterTopicValidator(name, g.validate); err != nil {
+		return fmt.Errorf("failed to register the validator of topic %s: %w", name, err)
+	}
+	topic, err := g.ps.Join(name)
+	if err != nil {
+		_ = g.ps.UnregisterTopicValidator(name)
+		return fmt.Errorf("failed to join topic %s: %w", name, err)
+	}
+	gt := &gossipTopic{topic: topic}
+	g.topics[digest] = gt
+	g.log.Info("Joined gossip topic", "topic", name)
+	if g.in != nil {
+		return g.subscribeLocked(gt)
+	}
+	return nil
+}
+
+func (g *gossip) leaveLocked(digest ForkDigest) {
+	gt := g.topics[digest]
+	delete(g.topics, digest)
+	if gt.sub != nil {
+		gt.sub.Cancel()
+		gt.cancel()
+	}
+	name := gt.topic.String()
+	if err := gt.topic.Close(); err != nil {
+		g.log.Warn("Failed to leave gossip topic", "topic", name, "err", err)
+	}
+	_ = g.ps.UnregisterTopicValidator(name)
+	g.log.Info("Left gossip topic", "topic", name)
+}
+
+// topicStats returns the topics of the active fork digests, with their numbers of peers, ordered by topic.
+func (g *gossip) topicStats() []TopicStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]TopicStats, 0, len(g.topics))
+	for _, gt := range g.topics {
+		out = append(out, TopicStats{Topic: gt.topic.String(), Peers: len(gt.topic.ListPeers())})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Topic < out[j].Topic })
+	return out
+}
+
+// topicPeers returns the peers of the topics of all the active fork digests.
+func (g *gossip) topicPeers() []peer.ID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var out []peer.ID
+	for _, gt := range g.topics {
+		out = append(out, gt.topic.ListPeers()...)
+	}
+	return out
+}
+
+// gossipOutcomes are the outcomes of the gossip messages that are counted: the payloads published by the node,
+// the payloads of peers that are accepted, rejected as invalid, ignored or throttled, and the accepted payloads
+// that are received by the node.
+var gossipOutcomes = []string{"published", "accepted", "rejected", "ignored", "throttled", "received"}
+
+// count counts a gossip message with the outcome, in the metrics and in the gossip stats.
+func (g *gossip) count(outcome string) {
+	metrics.GetOrRegisterCounter("p2p/gossip/"+outcome, nil).Inc(1)
+	g.meters[outcome].Mark(1)
+}
+
+// messageID identifies a gossip message by its contents.
+func messageID(msg *pb.Message) string {
+	return string(crypto.Keccak256(msg.Data)[:20])
+}
+
+// validate checks a gossiped payload before it is relayed and received: it must be of the fork digest of its topic,
+// recent, signed by the sequencer, and its block hash must match its contents. The decoded envelope is kept with the message, for the receiver.
+// The peer that relayed the payload is scored by the result, and its payloads are throttled if it relays too many.
+func (g *gossip) validate(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+	// the payloads of this node are not scored
+	if from == g.self {
+		return g.check(from, msg)
+	}
+	if !g.scores.allow(from) {
+		g.log.Debug("Throttled gossip payloads of peer", "peer", from)
+		g.count("throttled")
+		g.penalize(from, throttledPayloadPenalty)
+		return pubsub.ValidationIgnore
+	}
+	res := g.check(from, msg)
+	switch res {
+	case pubsub.ValidationAccept:
+		g.scores.reward(from)
+	case pubsub.ValidationIgnore:
+		g.penalize(from, uselessPayloadPenalty)
+	default:
+		g.penalize(from, invalidPayloadPenalty)
+	}
+	return res
+}
+
+func (g *gossip) penalize(id peer.ID, penalty float64) {
+	if g.scores.penalize(id, penalty) {
+		g.log.Warn("Banned peer for its gossip payloads", "peer", id, "duration", DefaultBanDuration)
+	}
+}
+
+func (g *gossip) check(from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+	env, err := decodeEnvelope(msg.Data)
+	if err != nil {
+		g.log.Debug("Rejected undecodable gossip payload", "peer", from, "err", err)
+		g.count("rejected")
+		return pubsub.ValidationReject
+	}
+	payload := env.Payload
+	if BlocksTopic(g.cfg, ComputeForkDigest(g.cfg, uint64(payload.Timestamp))) != msg.GetTopic() {
+		g.log.Debug("Rejected gossip payload of another fork digest than its topic", "peer", from, "payload", payload.ID(), "topic", msg.GetTopic())
+		g.count("rejected")
+		return pubsub.ValidationReject
+	}
+	now := g.now()
+	timestamp := time.Unix(int64(payload.Timestamp), 0)
+	if timestamp.After(now.Add(maxPayloadFutureTime)) || timestamp.Before(now.Add(-maxPayloadAge)) {
+		g.log.Debug("Ignored gossip payload with a timestamp too far from the local clock", "peer", from, "payload", payload.ID(), "timestamp", timestamp)
+		g.count("ignored")
+		return pubsub.ValidationIgnore
+	}
+	// the signature is checked first, it only covers the block hash: the payloads of anyone but the sequencer are
+	// rejected without hashing their contents
+	if err := l2.VerifyPayloadSignature(g.cfg.L2ChainID, payload, env.Signature, g.cfg.P2PSequencerAddress); err != nil {
+		g.log.Debug("Rejected gossip payload that is not signed by the sequencer", "peer", from, "err", err)
+		g.count("rejected")
+		return pubsub.ValidationReject
+	}
+	if err := payload.CheckBlockHash(); err != nil {
+		g.log.Debug("Rejected invalid gossip payload", "peer", from, "err", err)
+		g.count("rejected")
+		return pubsub.ValidationReject
+	}
+	msg.ValidatorData = env
+	g.count("accepted")
+	return pubsub.ValidationAccept
+}
+
+func (g *gossip) publish(ctx context.Context, payload *l2.ExecutionPayload) error {
+	if g.sequencerKey == nil {
+		return ErrNoSequencerKey
+	}
+	env, err := SignPayload(g.cfg.L2ChainID, payload, g.sequencerKey)
+	if err != nil {
+		return err
+	}
+	data, err := encodeEnvelope(env)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload %s: %w", payload.ID(), err)
+	}
+	// the payload is published to the topic of its fork digest, which the node is in around its timestamp
+	digest := ComputeForkDigest(g.cfg, uint64(payload.Timestamp))
+	g.mu.Lock()
+	gt, ok := g.topics[digest]
+	g.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: payload %s of fork digest %s", ErrNoGossipTopic, payload.ID(), digest)
+	}
+	if err := gt.topic.Publish(ctx, data); err != nil {
+		return fmt.Errorf("failed to publish payload %s: %w", payload.ID(), err)
+	}
+	g.count("published")
+	return nil
+}
+
+func (g *gossip) subscribe(in GossipIn) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return ErrGossipClosed
+	}
+	if g.in != nil {
+		return errors.New("already subscribed to the gossip")
+	}
+	g.in = in
+	for _, gt := range g.topics {
+		if err := g.subscribeLocked(gt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gossip) subscribeLocked(gt *gossipTopic) error {
+	sub, err := gt.topic.Subscribe()
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to topic %s: %w", gt.topic.String(), err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	gt.sub = sub
+	gt.cancel = cancel
+	go g.receive(ctx, sub, g.in)
+	return nil
+}
+
+// receive passes the validated payloads of the subscription to the receiver, until the subscription is cancelled.
+func (g *gossip) receive(ctx context.Context, sub *pubsub.Subscription, in GossipIn) {
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			// the subscription is only closed when the topic is left
+			return
+		}
+		// the payloads published by this node are delivered to its own subscription too
+		if msg.ReceivedFrom == g.self {
+			continue
+		}
+		env, ok := msg.ValidatorData.(*PayloadEnvelope)
+		if !ok {
+			continue
+		}
+		g.count("received")
+		onCtx, cancel := context.WithTimeout(ctx, onPayloadTimeout)
+		if err := in.OnUnsafeL2Payload(onCtx, msg.ReceivedFrom, env); err != nil {
+			g.log.Warn("Failed to process gossip payload", "peer", msg.ReceivedFrom, "payload", env.Payload.ID(), "err", err)
+		}
+		cancel()
+	}
+}
+
+func (g *gossip) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	g.closed = true
+	close(g.closing)
+	for _, m := range g.meters {
+		m.Stop()
+	}
+	for digest := range g.topics {
+		g.leaveLocked(digest)
+	}
+}
@@ -0,0 +1,168 @@
+package p2p
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+type gossipInFn func(from peer.ID, env *PayloadEnvelope)
+
+func (fn gossipInFn) OnUnsafeL2Payload(ctx context.Context, from peer.ID, env *PayloadEnvelope) error {
+	fn(from, env)
+	return nil
+}
+
+// testRollup returns the config of a rollup with the given sequencer key.
+func testRollup(t *testing.T, chainID int64) (*rollup.Config, *ecdsa.PrivateKey) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	return &rollup.Config{L2ChainID: big.NewInt(chainID), P2PSequencerAddress: crypto.PubkeyToAddress(key.PublicKey)}, key
+}
+
+func testNode(t *testing.T, cfg *rollup.Config, sequencerKey *ecdsa.PrivateKey) *Node {
+	addrs, err := ParseMultiaddrs([]string{"/ip4/127.0.0.1/tcp/0"})
+	require.NoError(t, err)
+	n, err := NewNode(context.Background(), &Config{ListenAddrs: addrs, SequencerKey: sequencerKey}, cfg, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = n.Close() })
+	return n
+}
+
+// testMessage returns a gossip message on the topic of the current fork digest.
+func testMessage(cfg *rollup.Config, data []byte) *pubsub.Message {
+	topic := BlocksTopic(cfg, ComputeForkDigest(cfg, uint64(time.Now().Unix())))
+	return &pubsub.Message{Message: &pb.Message{Data: data, Topic: &topic}}
+}
+
+func connect(t *testing.T, a *Node, b *Node) {
+	require.NoError(t, a.Host().Connect(context.Background(), peer.AddrInfo{ID: b.Host().ID(), Addrs: b.Host().Addrs()}))
+}
+
+// testGossipPayload returns a payload with a valid block hash and a recent timestamp.
+func testGossipPayload(t *testing.T, number uint64) *l2.ExecutionPayload {
+	payload := &l2.ExecutionPayload{
+		ParentHashField: common.Hash{byte(number - 1)},
+		BlockNumber:     l2.Uint64Quantity(number),
+		GasLimit:        30_000_000,
+		Timestamp:       l2.Uint64Quantity(time.Now().Unix()),
+	}
+	hash, err := payload.ComputeBlockHash()
+	require.NoError(t, err)
+	payload.BlockHash = hash
+	return payload
+}
+
+func TestGossipPayloads(t *testing.T) {
+	cfg, key := testRollup(t, 901)
+	sequencer := testNode(t, cfg, key)
+	verifier := testNode(t, cfg, nil)
+	connect(t, verifier, sequencer)
+
+	received := make(chan *PayloadEnvelope, 10)
+	require.NoError(t, verifier.Subscribe(gossipInFn(func(from peer.ID, env *PayloadEnvelope) {
+		require.Equal(t, sequencer.Host().ID(), from)
+		received <- env
+	})))
+	require.NoError(t, sequencer.Subscribe(gossipInFn(func(from peer.ID, env *PayloadEnvelope) {
+		t.Error("own payload received")
+	})))
+	require.Eventually(t, func() bool {
+		return len(sequencer.gossip.topicPeers()) > 0 && len(verifier.gossip.topicPeers()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	payload := testGossipPayload(t, 5)
+	require.NoError(t, sequencer.PublishL2Payload(context.Background(), payload))
+	select {
+	case got := <-received:
+		require.Equal(t, payload.BlockHash, got.Payload.BlockHash)
+		require.NoError(t, l2.VerifyPayloadSignature(cfg.L2ChainID, got.Payload, got.Signature, cfg.P2PSequencerAddress))
+	case <-time.After(5 * time.Second):
+		t.Fatal("payload not received")
+	}
+
+	invalid := testGossipPayload(t, 6)
+	invalid.GasUsed++
+	require.Error(t, sequencer.PublishL2Payload(context.Background(), invalid), "block hash does not match")
+
+	stale := testGossipPayload(t, 7)
+	stale.Timestamp -= l2.Uint64Quantity(2 * maxPayloadAge / time.Second)
+	hash, err := stale.ComputeBlockHash()
+	require.NoError(t, err)
+	stale.BlockHash = hash
+	require.Error(t, sequencer.PublishL2Payload(context.Background(), stale), "too old")
+
+	require.ErrorIs(t, verifier.PublishL2Payload(context.Background(), testGossipPayload(t, 8)), ErrNoSequencerKey)
+}
+
+func TestGossipOtherChain(t *testing.T) {
+	cfgA, keyA := testRollup(t, 901)
+	cfgB, _ := testRollup(t, 902)
+	a := testNode(t, cfgA, keyA)
+	b := testNode(t, cfgB, nil)
+	connect(t, a, b)
+	require.NoError(t, b.Subscribe(gossipInFn(func(from peer.ID, env *PayloadEnvelope) {
+		t.Error("payload of other chain received")
+	})))
+	require.NoError(t, a.PublishL2Payload(context.Background(), testGossipPayload(t, 5)))
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, a.gossip.topicPeers())
+}
+
+func TestValidateSignature(t *testing.T) {
+	cfg, key := testRollup(t, 901)
+	n := testNode(t, cfg, nil)
+	validate := func(env *PayloadEnvelope) pubsub.ValidationResult {
+		data, err := encodeEnvelope(env)
+		require.NoError(t, err)
+		return n.gossip.validate(context.Background(), "peer", testMessage(cfg, data))
+	}
+	payload := testGossipPayload(t, 5)
+
+	env, err := SignPayload(cfg.L2ChainID, payload, key)
+	require.NoError(t, err)
+	require.Equal(t, pubsub.ValidationAccept, validate(env))
+
+	other, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	env, err = SignPayload(cfg.L2ChainID, payload, other)
+	require.NoError(t, err)
+	require.Equal(t, pubsub.ValidationReject, validate(env), "not signed by the sequencer")
+
+	env, err = SignPayload(big.NewInt(902), payload, key)
+	require.NoError(t, err)
+	require.Equal(t, pubsub.ValidationReject, validate(env), "signed for another chain")
+
+	require.Equal(t, pubsub.ValidationReject, validate(&PayloadEnvelope{Signature: make([]byte, 65), Payload: payload}), "unsigned")
+}
+
+func TestEncodeEnvelope(t *testing.T) {
+	_, key := testRollup(t, 901)
+	env, err := SignPayload(big.NewInt(901), testGossipPayload(t, 5), key)
+	require.NoError(t, err)
+	data, err := encodeEnvelope(env)
+	require.NoError(t, err)
+	got, err := decodeEnvelope(data)
+	require.NoError(t, err)
+	require.Equal(t, env.Signature, got.Signature)
+	require.Equal(t, env.Payload.BlockHash, got.Payload.BlockHash)
+	require.NoError(t, got.Payload.CheckBlockHash())
+
+	_, err = decodeEnvelope([]byte("not snappy"))
+	require.Error(t, err)
+	_, err = encodeEnvelope(&PayloadEnvelope{Payload: env.Payload})
+	require.Error(t, err, "unsigned")
+}
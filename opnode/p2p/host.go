@@ -0,0 +1,174 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	basicconnmgr "github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+)
+
+// bootnodeDialTimeout is the time that the connection to a bootnode may take
+const bootnodeDialTimeout = 10 * time.Second
+
+// Node is the p2p stack of the rollup node: a libp2p host that gossips the unsafe blocks of the sequencer.
+type Node struct {
+	log    log.Logger
+	host   host.Host
+	gossip *gossip
+	scores *peerScores
+	// rangeSync serves and requests payloads by range
+	rangeSync *payloadSync
+	// bandwidth accounts the traffic of the host, and limits the traffic of the payloads-by-range streams
+	bandwidth *bandwidth
+	// discovery finds the peers of the rollup, nil if disabled
+	discovery *discovery
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewNode starts the libp2p host and joins the gossip of the unsafe blocks of the rollup.
+// The payloads of peers are not received until Subscribe is called, the node can publish payloads right away.
+func NewNode(ctx context.Context, cfg *Config, rollupCfg *rollup.Config, log log.Logger) (*Node, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+	if rollupCfg.L2ChainID == nil {
+		return nil, errors.New("the L2 chain ID of the rollup is required")
+	}
+	key := cfg.PrivKey
+	if key == nil {
+		var err error
+		key, _, err = crypto.GenerateSecp256k1Key(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate p2p identity: %w", err)
+		}
+	}
+	maxPeers := cfg.MaxPeers
+	if maxPeers == 0 {
+		maxPeers = DefaultMaxPeers
+	}
+	// the connections beyond twice the max peers are pruned back to the max peers, the static peers are kept
+	connMgr, err := basicconnmgr.NewConnManager(maxPeers, 2*maxPeers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the p2p connection manager: %w", err)
+	}
+	scores := newPeerScores()
+	bw := newBandwidth(cfg.MaxBandwidth, cfg.MaxPeerBandwidth)
+	var gater connmgr.ConnectionGater = scores
+	if len(cfg.PeerAllowlist) > 0 {
+		allowed := append([]peer.ID{}, cfg.PeerAllowlist...)
+		for _, p := range cfg.StaticPeers {
+			allowed = append(allowed, p.ID)
+		}
+		gater = newAllowlistGater(scores, allowed)
+		log.Info("Only connecting with the allowlisted peers", "peers", len(allowed))
+	}
+	opts := []libp2p.Option{
+		libp2p.Identity(key),
+		libp2p.ListenAddrs(cfg.ListenAddrs...),
+		libp2p.ConnectionGater(gater),
+		libp2p.ConnectionManager(connMgr),
+		libp2p.BandwidthReporter(bw.counter),
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.Security(noise.ID, noise.New),
+		libp2p.DefaultMuxers,
+	}
+	if cfg.PrivateNetworkKey != nil {
+		opts = append(opts, libp2p.PrivateNetwork(pnet.PSK(cfg.PrivateNetworkKey)))
+	}
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the p2p host: %w", err)
+	}
+	g, err := newGossip(ctx, h, rollupCfg, cfg.SequencerKey, scores, log)
+	if err != nil {
+		_ = h.Close()
+		return nil, err
+	}
+	n := &Node{log: log, host: h, gossip: g, scores: scores, rangeSync: newPayloadSync(h, rollupCfg, scores, bw, log), bandwidth: bw, closing: make(chan struct{})}
+	scores.onBan = n.disconnect
+	log.Info("Started p2p host", "peer_id", h.ID(), "addrs", h.Addrs())
+	go n.bandwidthMetricsLoop()
+	for _, bootnode := range cfg.Bootnodes {
+		go n.connect(ctx, bootnode)
+	}
+	if len(cfg.StaticPeers) > 0 {
+		n.protectStaticPeers(cfg.StaticPeers)
+		go n.staticPeersLoop(cfg.StaticPeers)
+	}
+	if cfg.Discovery != nil {
+		if err := n.startDiscovery(cfg.Discovery, key, rollupCfg, maxPeers); err != nil {
+			_ = n.Close()
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// connect connects to the peer, the failure to connect is only logged.
+func (n *Node) connect(ctx context.Context, p peer.AddrInfo) {
+	ctx, cancel := context.WithTimeout(ctx, bootnodeDialTimeout)
+	defer cancel()
+	if err := n.host.Connect(ctx, p); err != nil {
+		n.log.Warn("Failed to connect to bootnode", "peer", p.ID, "err", err)
+		return
+	}
+	n.log.Info("Connected to bootnode", "peer", p.ID)
+}
+
+// disconnect closes the connections with the peer.
+func (n *Node) disconnect(id peer.ID) {
+	if err := n.host.Network().ClosePeer(id); err != nil {
+		n.log.Warn("Failed to disconnect peer", "peer", id, "err", err)
+	}
+}
+
+// Host returns the libp2p host of the node.
+func (n *Node) Host() host.Host {
+	return n.host
+}
+
+// Subscribe starts receiving the payloads gossiped by peers, which are passed to the given receiver once validated.
+// The payloads fetched by RequestL2Range are passed to the receiver too.
+func (n *Node) Subscribe(in GossipIn) error {
+	if err := n.gossip.subscribe(in); err != nil {
+		return err
+	}
+	n.rangeSync.setReceiver(in)
+	return nil
+}
+
+// PublishL2Payload gossips a new payload of the sequencer to the peers.
+func (n *Node) PublishL2Payload(ctx context.Context, payload *l2.ExecutionPayload) error {
+	return n.gossip.publish(ctx, payload)
+}
+
+// Close leaves the gossip and stops the host.
+func (n *Node) Close() error {
+	var err error
+	n.closeOnce.Do(func() {
+		close(n.closing)
+		if n.discovery != nil {
+			n.discovery.close()
+		}
+		n.gossip.close()
+		err = n.host.Close()
+	})
+	return err
+}
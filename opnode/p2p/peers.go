@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PeerInfo describes a connected or banned peer.
+type PeerInfo struct {
+	ID        peer.ID  `json:"id"`
+	Addrs     []string `json:"addrs"`
+	Connected bool     `json:"connected"`
+	// Static is true for the static peers, which are kept connected and are not banned by their score
+	Static bool `json:"static"`
+	// Score is the score of the peer by the gossip payloads it relays, see BanPeer
+	Score float64 `json:"score"`
+	// Bandwidth is the traffic with the peer
+	Bandwidth BandwidthStats `json:"bandwidth"`
+	// BannedUntil is the time that the ban of the peer expires at, nil if the peer is not banned
+	BannedUntil *time.Time `json:"bannedUntil,omitempty"`
+}
+
+// Peers returns the peers that are connected, and the peers that are banned.
+func (n *Node) Peers() []PeerInfo {
+	ids := n.host.Network().Peers()
+	for _, id := range n.scores.bannedPeers() {
+		if n.host.Network().Connectedness(id) != network.Connected {
+			ids = append(ids, id)
+		}
+	}
+	out := make([]PeerInfo, 0, len(ids))
+	for _, id := range ids {
+		info := PeerInfo{
+			ID:        id,
+			Connected: n.host.Network().Connectedness(id) == network.Connected,
+			Static:    n.IsStatic(id),
+			Score:     n.scores.score(id),
+			Bandwidth: bandwidthStats(n.bandwidth.counter.GetBandwidthForPeer(id)),
+		}
+		for _, addr := range n.host.Peerstore().Addrs(id) {
+			info.Addrs = append(info.Addrs, addr.String())
+		}
+		if until, ok := n.scores.banExpiry(id); ok {
+			info.BannedUntil = &until
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+// BanPeer disconnects the peer, and refuses its connections for the duration.
+func (n *Node) BanPeer(id peer.ID, duration time.Duration) error {
+	if id == n.host.ID() {
+		return ErrCannotBanSelf
+	}
+	n.scores.ban(id, duration)
+	n.log.Info("Banned peer", "peer", id, "duration", duration)
+	return nil
+}
+
+// UnbanPeer lifts the ban of the peer, its connections are accepted again.
+func (n *Node) UnbanPeer(id peer.ID) error {
+	if !n.scores.unban(id) {
+		return fmt.Errorf("%w: %s", ErrPeerNotBanned, id)
+	}
+	n.log.Info("Unbanned peer", "peer", id)
+	return nil
+}
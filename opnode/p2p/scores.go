@@ -0,0 +1,269 @@
+package p2p
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// invalidPayloadPenalty is the score that a peer loses for relaying an invalid payload
+	invalidPayloadPenalty = 10
+	// throttledPayloadPenalty is the score that a peer loses for relaying a payload above its rate limit
+	throttledPayloadPenalty = 2
+	// uselessPayloadPenalty is the score that a peer loses for relaying a payload that is not of use, e.g. too old
+	uselessPayloadPenalty = 1
+	// validPayloadReward is the score that a peer gains for relaying a valid payload, up to maxPeerScore
+	validPayloadReward = 1
+	maxPeerScore       = 10
+	// banThreshold is the score under which a peer is banned
+	banThreshold = -30
+	// peerScoreHalfLife is the time that the scores take to decay halfway to zero, so that old payloads count less
+	peerScoreHalfLife = 10 * time.Minute
+	// minPeerScore is the magnitude under which a decayed score is dropped
+	minPeerScore = 0.1
+
+	// DefaultBanDuration is the time that a peer is banned for, when its score drops under the threshold
+	DefaultBanDuration = time.Hour
+
+	// peerPayloadRate is the rate of gossip payloads that a peer may relay, with bursts of peerPayloadBurst
+	peerPayloadRate  = 5
+	peerPayloadBurst = 20
+)
+
+var (
+	ErrCannotBanSelf = errors.New("cannot ban the node itself")
+	ErrPeerNotBanned = errors.New("peer is not banned")
+)
+
+// peerScores scores the peers by the gossip payloads they relay, limits the rate of their payloads,
+// and bans the peers whose score drops under the threshold: the connections of banned peers are refused.
+type peerScores struct {
+	mu          sync.Mutex
+	scores      map[peer.ID]float64
+	limiters    map[peer.ID]*rate.Limiter
+	bannedUntil map[peer.ID]time.Time
+	// protected peers, e.g. the static peers, are not banned by their score
+	protected map[peer.ID]struct{}
+	// decayedAt is the time of the last decay of the scores
+	decayedAt time.Time
+	now       func() time.Time
+	// onBan is called with the peers that are banned, outside of the lock
+	onBan func(id peer.ID)
+}
+
+func newPeerScores() *peerScores {
+	return &peerScores{
+		scores:      make(map[peer.ID]float64),
+		limiters:    make(map[peer.ID]*rate.Limiter),
+		bannedUntil: make(map[peer.ID]time.Time),
+		protected:   make(map[peer.ID]struct{}),
+		now:         time.Now,
+	}
+}
+
+// allow returns true if the peer did not exceed its rate of payloads.
+func (ps *peerScores) allow(id peer.ID) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	lim, ok := ps.limiters[id]
+	if !ok {
+		lim = rate.NewLimiter(peerPayloadRate, peerPayloadBurst)
+		ps.limiters[id] = lim
+	}
+	return lim.AllowN(ps.now(), 1)
+}
+
+// reward raises the score of the peer, for a valid payload.
+func (ps *peerScores) reward(id peer.ID) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if score := ps.scores[id] + validPayloadReward; score < maxPeerScore {
+		ps.scores[id] = score
+	} else {
+		ps.scores[id] = maxPeerScore
+	}
+}
+
+// penalize lowers the score of the peer, and bans the peer if its score drops under the threshold.
+// It returns true if the peer is banned as a result.
+func (ps *peerScores) penalize(id peer.ID, penalty float64) bool {
+	ps.mu.Lock()
+	ps.scores[id] -= penalty
+	if ps.scores[id] >= banThreshold {
+		ps.mu.Unlock()
+		return false
+	}
+	if _, ok := ps.protected[id]; ok {
+		// the score of a protected peer stays at the threshold, it is only banned manually
+		ps.scores[id] = banThreshold
+		ps.mu.Unlock()
+		return false
+	}
+	ps.banLocked(id, DefaultBanDuration)
+	ps.mu.Unlock()
+	if ps.onBan != nil {
+		ps.onBan(id)
+	}
+	return true
+}
+
+// protect exempts the peer from the bans by score. The peer can still be banned manually.
+func (ps *peerScores) protect(id peer.ID) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.protected[id] = struct{}{}
+}
+
+// isProtected returns true if the peer is exempt from the bans by score.
+func (ps *peerScores) isProtected(id peer.ID) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	_, ok := ps.protected[id]
+	return ok
+}
+
+// ban refuses the connections of the peer for the duration, and resets its score.
+func (ps *peerScores) ban(id peer.ID, duration time.Duration) {
+	ps.mu.Lock()
+	ps.banLocked(id, duration)
+	ps.mu.Unlock()
+	if ps.onBan != nil {
+		ps.onBan(id)
+	}
+}
+
+func (ps *peerScores) banLocked(id peer.ID, duration time.Duration) {
+	ps.bannedUntil[id] = ps.now().Add(duration)
+	// the peer starts over when the ban expires
+	delete(ps.scores, id)
+	delete(ps.limiters, id)
+	metrics.GetOrRegisterCounter("p2p/peers/banned", nil).Inc(1)
+}
+
+// unban lifts the ban of the peer, the peer starts over. It returns false if the peer was not banned.
+func (ps *peerScores) unban(id peer.ID) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	_, ok := ps.bannedUntil[id]
+	delete(ps.bannedUntil, id)
+	delete(ps.scores, id)
+	delete(ps.limiters, id)
+	return ok
+}
+
+// decay moves the scores toward zero, by half every peerScoreHalfLife, and drops the scores that are close to zero.
+func (ps *peerScores) decay() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	now := ps.now()
+	if ps.decayedAt.IsZero() {
+		ps.decayedAt = now
+		return
+	}
+	factor := math.Pow(0.5, float64(now.Sub(ps.decayedAt))/float64(peerScoreHalfLife))
+	ps.decayedAt = now
+	for id, score := range ps.scores {
+		score *= factor
+		if math.Abs(score) < minPeerScore {
+			delete(ps.scores, id)
+		} else {
+			ps.scores[id] = score
+		}
+	}
+}
+
+// forget drops the limiters of the peers that are not kept, e.g. of the disconnected peers, and their positive scores.
+// Negative scores are kept until they decay, so a peer cannot reset its score by reconnecting.
+// The expired bans are dropped too.
+func (ps *peerScores) forget(keep func(id peer.ID) bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for id := range ps.limiters {
+		if !keep(id) {
+			delete(ps.limiters, id)
+		}
+	}
+	for id, score := range ps.scores {
+		if score >= 0 && !keep(id) {
+			delete(ps.scores, id)
+		}
+	}
+	now := ps.now()
+	for id, until := range ps.bannedUntil {
+		if !now.Before(until) {
+			delete(ps.bannedUntil, id)
+		}
+	}
+}
+
+// banned returns true if the connections of the peer are refused.
+func (ps *peerScores) banned(id peer.ID) bool {
+	_, ok := ps.banExpiry(id)
+	return ok
+}
+
+// banExpiry returns the time that the ban of the peer expires at, and false if the peer is not banned.
+func (ps *peerScores) banExpiry(id peer.ID) (time.Time, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	until, ok := ps.bannedUntil[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	if !ps.now().Before(until) {
+		delete(ps.bannedUntil, id)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// bannedPeers returns the peers that are currently banned.
+func (ps *peerScores) bannedPeers() []peer.ID {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	now := ps.now()
+	var out []peer.ID
+	for id, until := range ps.bannedUntil {
+		if now.Before(until) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// score returns the current score of the peer, 0 for unknown peers.
+func (ps *peerScores) score(id peer.ID) float64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.scores[id]
+}
+
+// InterceptPeerDial implements connmgr.ConnectionGater, to refuse the connections of banned peers.
+func (ps *peerScores) InterceptPeerDial(id peer.ID) bool {
+	return !ps.banned(id)
+}
+
+func (ps *peerScores) InterceptAddrDial(id peer.ID, _ ma.Multiaddr) bool {
+	return !ps.banned(id)
+}
+
+func (ps *peerScores) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (ps *peerScores) InterceptSecured(_ network.Direction, id peer.ID, _ network.ConnMultiaddrs) bool {
+	return !ps.banned(id)
+}
+
+func (ps *peerScores) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,149 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerScores(t *testing.T) {
+	ps := newPeerScores()
+	now := time.Unix(1000, 0)
+	ps.now = func() time.Time { return now }
+	var bans []peer.ID
+	ps.onBan = func(id peer.ID) { bans = append(bans, id) }
+
+	for i := 0; i < 20; i++ {
+		ps.reward("a")
+	}
+	require.Equal(t, float64(maxPeerScore), ps.score("a"), "capped")
+
+	// a peer with the maximum score is banned after the invalid payloads that take it under the threshold
+	for i := 0; i < 4; i++ {
+		require.False(t, ps.penalize("a", invalidPayloadPenalty))
+	}
+	require.True(t, ps.penalize("a", invalidPayloadPenalty))
+	require.True(t, ps.banned("a"))
+	require.Equal(t, []peer.ID{"a"}, bans)
+	require.Equal(t, []peer.ID{"a"}, ps.bannedPeers())
+	require.Zero(t, ps.score("a"), "score is reset by the ban")
+	require.False(t, ps.InterceptPeerDial("a"))
+	require.True(t, ps.InterceptPeerDial("b"))
+
+	now = now.Add(DefaultBanDuration)
+	require.False(t, ps.banned("a"), "ban expired")
+	require.Empty(t, ps.bannedPeers())
+
+	ps.ban("b", time.Minute)
+	require.True(t, ps.banned("b"))
+	require.True(t, ps.unban("b"))
+	require.False(t, ps.banned("b"))
+	require.False(t, ps.unban("b"))
+}
+
+func TestPeerScoresDecay(t *testing.T) {
+	ps := newPeerScores()
+	now := time.Unix(1000, 0)
+	ps.now = func() time.Time { return now }
+	ps.decay()
+	for i := 0; i < 4; i++ {
+		ps.reward("a")
+	}
+	ps.penalize("b", 2*invalidPayloadPenalty)
+	ps.penalize("c", uselessPayloadPenalty)
+	now = now.Add(peerScoreHalfLife)
+	ps.decay()
+	require.InDelta(t, 2, ps.score("a"), 1e-9)
+	require.InDelta(t, -invalidPayloadPenalty, ps.score("b"), 1e-9)
+	now = now.Add(4 * peerScoreHalfLife)
+	ps.decay()
+	require.NotContains(t, ps.scores, peer.ID("c"), "scores close to zero are dropped")
+
+	// positive scores and limiters of disconnected peers are dropped, negative scores are kept until they decay
+	ps.allow("a")
+	ps.allow("b")
+	ps.forget(func(id peer.ID) bool { return false })
+	require.Empty(t, ps.limiters)
+	require.NotContains(t, ps.scores, peer.ID("a"))
+	require.Less(t, ps.score("b"), 0.0)
+
+	// unbanned peers start over
+	ps.penalize("d", invalidPayloadPenalty)
+	ps.allow("d")
+	ps.ban("d", time.Minute)
+	ps.penalize("d", invalidPayloadPenalty)
+	require.True(t, ps.unban("d"))
+	require.Zero(t, ps.score("d"))
+	require.NotContains(t, ps.limiters, peer.ID("d"))
+}
+
+func TestPeerScoresRateLimit(t *testing.T) {
+	ps := newPeerScores()
+	now := time.Unix(1000, 0)
+	ps.now = func() time.Time { return now }
+	for i := 0; i < peerPayloadBurst; i++ {
+		require.True(t, ps.allow("a"))
+	}
+	require.False(t, ps.allow("a"))
+	require.True(t, ps.allow("b"), "limits are per peer")
+	now = now.Add(time.Second)
+	require.True(t, ps.allow("a"))
+}
+
+func TestValidateScoresPeers(t *testing.T) {
+	cfg, key := testRollup(t, 901)
+	n := testNode(t, cfg, nil)
+	validate := func(from peer.ID, data []byte) pubsub.ValidationResult {
+		return n.gossip.validate(context.Background(), from, testMessage(cfg, data))
+	}
+
+	env, err := SignPayload(cfg.L2ChainID, testGossipPayload(t, 5), key)
+	require.NoError(t, err)
+	valid, err := encodeEnvelope(env)
+	require.NoError(t, err)
+	require.Equal(t, pubsub.ValidationAccept, validate("a", valid))
+	require.Equal(t, float64(validPayloadReward), n.scores.score("a"))
+
+	require.Equal(t, pubsub.ValidationReject, validate("a", []byte("garbage")))
+	require.Equal(t, float64(validPayloadReward-invalidPayloadPenalty), n.scores.score("a"))
+	for i := 0; i < 3; i++ {
+		validate("a", []byte("garbage"))
+	}
+	require.True(t, n.scores.banned("a"))
+}
+
+func TestBanPeer(t *testing.T) {
+	cfg, _ := testRollup(t, 901)
+	a := testNode(t, cfg, nil)
+	b := testNode(t, cfg, nil)
+	connect(t, a, b)
+
+	require.ErrorIs(t, a.BanPeer(a.Host().ID(), time.Minute), ErrCannotBanSelf)
+	require.NoError(t, a.BanPeer(b.Host().ID(), time.Minute))
+	require.Eventually(t, func() bool {
+		return a.Host().Network().Connectedness(b.Host().ID()) != network.Connected &&
+			b.Host().Network().Connectedness(a.Host().ID()) != network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+	peers := a.Peers()
+	require.Len(t, peers, 1)
+	require.Equal(t, b.Host().ID(), peers[0].ID)
+	require.False(t, peers[0].Connected)
+	require.NotNil(t, peers[0].BannedUntil)
+
+	require.Error(t, a.Host().Connect(context.Background(), peer.AddrInfo{ID: b.Host().ID(), Addrs: b.Host().Addrs()}), "banned peer is not dialed")
+	// the handshake of the inbound connection completes before it is refused
+	_ = b.Host().Connect(context.Background(), peer.AddrInfo{ID: a.Host().ID(), Addrs: a.Host().Addrs()})
+	require.Eventually(t, func() bool {
+		return b.Host().Network().Connectedness(a.Host().ID()) != network.Connected
+	}, 5*time.Second, 10*time.Millisecond, "inbound connection refused")
+
+	require.NoError(t, a.UnbanPeer(b.Host().ID()))
+	require.ErrorIs(t, a.UnbanPeer(b.Host().ID()), ErrPeerNotBanned)
+	connect(t, b, a)
+	require.Nil(t, a.Peers()[0].BannedUntil)
+}
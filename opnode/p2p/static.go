@@ -0,0 +1,75 @@
+package p2p
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// staticPeerTag is the tag of the static peers in the connection manager, which protects them from pruning
+	staticPeerTag = "static"
+	// staticPeerRedialInterval is the time between the checks that the static peers are connected
+	staticPeerRedialInterval = 30 * time.Second
+	// staticPeerMinRedialInterval is the minimum time between the redials of the static peers, when they disconnect
+	staticPeerMinRedialInterval = time.Second
+)
+
+// protectStaticPeers exempts the static peers from the pruning of the connection manager and from the bans by score.
+func (n *Node) protectStaticPeers(peers []peer.AddrInfo) {
+	for _, p := range peers {
+		n.host.ConnManager().Protect(p.ID, staticPeerTag)
+		n.scores.protect(p.ID)
+	}
+}
+
+// staticPeersLoop keeps the node connected to the static peers, it redials the static peers when they disconnect,
+// and checks that they are connected periodically. Static peers that are banned manually are not dialed until
+// the ban is lifted.
+func (n *Node) staticPeersLoop(peers []peer.AddrInfo) {
+	ticker := time.NewTicker(staticPeerRedialInterval)
+	defer ticker.Stop()
+	disconnected := make(chan struct{}, 1)
+	notifee := &network.NotifyBundle{DisconnectedF: func(_ network.Network, conn network.Conn) {
+		if n.IsStatic(conn.RemotePeer()) {
+			select {
+			case disconnected <- struct{}{}:
+			default:
+			}
+		}
+	}}
+	n.host.Network().Notify(notifee)
+	defer n.host.Network().StopNotify(notifee)
+	for {
+		for _, p := range peers {
+			if n.host.Network().Connectedness(p.ID) == network.Connected || n.scores.banned(p.ID) {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), bootnodeDialTimeout)
+			if err := n.host.Connect(ctx, p); err != nil {
+				n.log.Warn("Failed to connect to static peer", "peer", p.ID, "err", err)
+			} else {
+				n.log.Info("Connected to static peer", "peer", p.ID)
+			}
+			cancel()
+		}
+		select {
+		case <-ticker.C:
+		case <-disconnected:
+			select {
+			case <-time.After(staticPeerMinRedialInterval):
+			case <-n.closing:
+				return
+			}
+		case <-n.closing:
+			return
+		}
+	}
+}
+
+// IsStatic returns true if the peer is one of the static peers of the node.
+func (n *Node) IsStatic(id peer.ID) bool {
+	return n.host.ConnManager().IsProtected(id, staticPeerTag)
+}
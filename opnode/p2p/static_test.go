@@ -0,0 +1,52 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticPeers(t *testing.T) {
+	cfg, _ := testRollup(t, 901)
+	replica := testNode(t, cfg, nil)
+	addrs, err := ParseMultiaddrs([]string{"/ip4/127.0.0.1/tcp/0"})
+	require.NoError(t, err)
+	static := peer.AddrInfo{ID: replica.Host().ID(), Addrs: replica.Host().Addrs()}
+	sequencer, err := NewNode(context.Background(), &Config{ListenAddrs: addrs, StaticPeers: []peer.AddrInfo{static}}, cfg, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sequencer.Close() })
+
+	connected := func() bool {
+		return sequencer.Host().Network().Connectedness(replica.Host().ID()) == network.Connected
+	}
+	require.Eventually(t, connected, 5*time.Second, 10*time.Millisecond, "static peer is dialed")
+	require.True(t, sequencer.IsStatic(replica.Host().ID()))
+	require.False(t, replica.IsStatic(sequencer.Host().ID()))
+	peers := sequencer.Peers()
+	require.Len(t, peers, 1)
+	require.True(t, peers[0].Static)
+
+	// static peers are redialed when they disconnect
+	require.NoError(t, replica.Host().Network().ClosePeer(sequencer.Host().ID()))
+	require.Eventually(t, connected, 5*time.Second, 10*time.Millisecond, "static peer is redialed")
+
+	// static peers are not banned by their score
+	for i := 0; i < 10; i++ {
+		require.False(t, sequencer.scores.penalize(replica.Host().ID(), invalidPayloadPenalty))
+	}
+	require.False(t, sequencer.scores.banned(replica.Host().ID()))
+	require.Equal(t, float64(banThreshold), sequencer.scores.score(replica.Host().ID()))
+	require.True(t, connected())
+
+	// but they can be banned manually, and are not redialed while banned
+	require.NoError(t, sequencer.BanPeer(replica.Host().ID(), time.Hour))
+	require.Eventually(t, func() bool { return !connected() }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(2 * staticPeerMinRedialInterval)
+	require.False(t, connected())
+}
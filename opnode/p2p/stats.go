@@ -0,0 +1,99 @@
+package p2p
+
+import (
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SelfInfo describes the node in the p2p network.
+type SelfInfo struct {
+	ID    peer.ID  `json:"id"`
+	Addrs []string `json:"addrs"`
+	// ENR is the node record of the node, empty if the discovery is disabled
+	ENR string `json:"enr,omitempty"`
+	// Protocols are the protocols that the node serves
+	Protocols []string `json:"protocols"`
+	// Topics are the gossip topics that the node is in
+	Topics []string `json:"topics"`
+}
+
+// MessageStats counts the gossip messages of an outcome.
+type MessageStats struct {
+	Total int64 `json:"total"`
+	// Rate is the number of messages per second, over the last minute
+	Rate float64 `json:"rate"`
+}
+
+// TopicStats describes a gossip topic that the node is in.
+type TopicStats struct {
+	Topic string `json:"topic"`
+	// Peers is the number of peers that are subscribed to the topic
+	Peers int `json:"peers"`
+}
+
+// Stats describes the connections and the gossip of the node.
+type Stats struct {
+	// Connected, Inbound and Outbound are the numbers of connected peers, by the direction of their first connection
+	Connected int `json:"connected"`
+	Inbound   int `json:"inbound"`
+	Outbound  int `json:"outbound"`
+	// Static is the number of connected static peers
+	Static int `json:"static"`
+	// Banned is the number of banned peers
+	Banned int          `json:"banned"`
+	Topics []TopicStats `json:"topics"`
+	// Messages counts the gossip messages by their outcome: published, accepted, rejected, ignored, throttled and received
+	Messages  map[string]MessageStats `json:"messages"`
+	Bandwidth BandwidthStats          `json:"bandwidth"`
+}
+
+// Self returns the description of the node in the p2p network.
+func (n *Node) Self() *SelfInfo {
+	info := &SelfInfo{ID: n.host.ID(), Topics: []string{}}
+	for _, addr := range n.host.Addrs() {
+		info.Addrs = append(info.Addrs, addr.String())
+	}
+	if enr := n.ENR(); enr != nil {
+		info.ENR = enr.String()
+	}
+	for _, p := range n.host.Mux().Protocols() {
+		info.Protocols = append(info.Protocols, string(p))
+	}
+	sort.Strings(info.Protocols)
+	for _, t := range n.gossip.topicStats() {
+		info.Topics = append(info.Topics, t.Topic)
+	}
+	return info
+}
+
+// Stats returns the statistics of the connections and the gossip of the node.
+func (n *Node) Stats() *Stats {
+	stats := &Stats{
+		Banned:    len(n.scores.bannedPeers()),
+		Topics:    n.gossip.topicStats(),
+		Messages:  make(map[string]MessageStats),
+		Bandwidth: n.Bandwidth(),
+	}
+	for _, id := range n.host.Network().Peers() {
+		stats.Connected++
+		if n.IsStatic(id) {
+			stats.Static++
+		}
+		conns := n.host.Network().ConnsToPeer(id)
+		if len(conns) == 0 {
+			continue
+		}
+		switch conns[0].Stat().Direction {
+		case network.DirInbound:
+			stats.Inbound++
+		case network.DirOutbound:
+			stats.Outbound++
+		}
+	}
+	for outcome, m := range n.gossip.meters {
+		stats.Messages[outcome] = MessageStats{Total: m.Count(), Rate: m.Rate1()}
+	}
+	return stats
+}
@@ -0,0 +1,46 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	cfg, key := testRollup(t, 901)
+	sequencer := testNode(t, cfg, key)
+	verifier := testNode(t, cfg, nil)
+	verifier.ServePayloadsByRange(payloadChain{})
+	connect(t, verifier, sequencer)
+	received := make(chan *PayloadEnvelope, 10)
+	require.NoError(t, verifier.Subscribe(gossipInFn(func(from peer.ID, env *PayloadEnvelope) {
+		received <- env
+	})))
+	require.Eventually(t, func() bool {
+		return len(sequencer.gossip.topicPeers()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, sequencer.PublishL2Payload(context.Background(), testGossipPayload(t, 5)))
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("payload not received")
+	}
+
+	self := verifier.Self()
+	require.Equal(t, verifier.Host().ID(), self.ID)
+	require.NotEmpty(t, self.Addrs)
+	require.Contains(t, self.Protocols, string(PayloadsByRangeProtocol(cfg)))
+	require.Equal(t, []string{BlocksTopic(cfg, ComputeForkDigest(cfg, uint64(time.Now().Unix())))}, self.Topics)
+
+	stats := verifier.Stats()
+	require.Equal(t, 1, stats.Connected)
+	require.Equal(t, 1, stats.Outbound)
+	require.Equal(t, []TopicStats{{Topic: self.Topics[0], Peers: 0}}, stats.Topics, "the sequencer is not subscribed")
+	require.Equal(t, int64(1), stats.Messages["accepted"].Total)
+	require.Equal(t, int64(1), stats.Messages["received"].Total)
+	require.Equal(t, int64(1), sequencer.Stats().Messages["published"].Total)
+	require.Equal(t, 1, sequencer.Stats().Inbound)
+}
@@ -0,0 +1,459 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/golang/snappy"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// MaxPayloadsPerRequest is the maximum number of payloads that a payloads-by-range request may ask for
+	MaxPayloadsPerRequest = 64
+	// maxSyncResponseSize is the maximum size of all the payloads of a response, compressed.
+	// The server stops at the payload that exceeds it, the client continues with another request.
+	maxSyncResponseSize = 10 * (1 << 20)
+	// MaxSyncRange is the maximum number of payloads that a single RequestL2Range fetches.
+	// Nodes further behind catch up from L1 instead.
+	MaxSyncRange = 512
+
+	// syncRequestTimeout is the time that a peer gets to respond to a payloads-by-range request
+	syncRequestTimeout = 20 * time.Second
+	// syncServeTimeout is the time that the node gets to read a request and serve its payloads
+	syncServeTimeout = 20 * time.Second
+
+	// peerSyncRequestRate is the rate of payloads-by-range requests that a peer may send, with bursts of peerSyncRequestBurst:
+	// enough for a peer to fetch a full MaxSyncRange at once
+	peerSyncRequestRate  = 1
+	peerSyncRequestBurst = MaxSyncRange / MaxPayloadsPerRequest
+)
+
+// The result codes of a payloads-by-range response, the first byte of the response
+const (
+	syncResultOK byte = iota
+	syncResultInvalidRequest
+	syncResultRateLimited
+	syncResultServerError
+)
+
+var (
+	ErrSyncInProgress     = errors.New("a payloads sync is already in progress")
+	ErrSyncRangeTooLarge  = errors.New("payloads sync range is too large")
+	ErrNoSyncPeers        = errors.New("no peer could serve the payloads")
+	ErrInvalidSyncRequest = errors.New("invalid payloads-by-range request")
+	ErrSyncRateLimited    = errors.New("payloads-by-range request was rate limited")
+	ErrSyncServerError    = errors.New("peer failed to serve the payloads")
+	ErrNotSubscribed      = errors.New("no receiver for the synced payloads, see Subscribe")
+
+	// errSyncOtherChain is the response of a peer whose canonical chain is not the one of the anchor
+	errSyncOtherChain = errors.New("payloads are of another chain than the anchor")
+)
+
+// PayloadsByRangeProtocol is the protocol of the payloads-by-range requests of the rollup.
+//
+// The request is the first and the last block number of the range, inclusive, as big-endian uint64s.
+// At most MaxPayloadsPerRequest payloads may be requested. The response is a result code byte, followed by the
+// canonical payloads of the server from the last block number down to the first, each as the uvarint length
+// of the payload followed by the JSON of the payload, compressed with snappy. The server may return fewer
+// payloads than requested, e.g. if it does not have them or the response grows too large.
+func PayloadsByRangeProtocol(cfg *rollup.Config) protocol.ID {
+	return protocol.ID(fmt.Sprintf("/optimism/%s/payloads_by_range/1", cfg.L2ChainID))
+}
+
+// L2PayloadSource provides the canonical payloads that the node serves to its peers.
+type L2PayloadSource interface {
+	// PayloadByNumber returns the canonical payload with the block number, or ethereum.NotFound.
+	PayloadByNumber(ctx context.Context, number uint64) (*l2.ExecutionPayload, error)
+}
+
+// payloadSync serves the canonical payloads of the node to its peers, and fetches the payloads that the node misses
+// from its peers, by the payloads-by-range protocol.
+type payloadSync struct {
+	log      log.Logger
+	host     host.Host
+	protocol protocol.ID
+	scores   *peerScores
+	bw       *bandwidth
+	now      func() time.Time
+
+	mu sync.Mutex
+	// limiters limit the rate of the requests of each peer
+	limiters map[peer.ID]*rate.Limiter
+	// in receives the synced payloads, nil until the node subscribes
+	in GossipIn
+	// syncing is true while a RequestL2Range is in progress
+	syncing bool
+}
+
+func newPayloadSync(h host.Host, cfg *rollup.Config, scores *peerScores, bw *bandwidth, log log.Logger) *payloadSync {
+	return &payloadSync{
+		log:      log,
+		host:     h,
+		protocol: PayloadsByRangeProtocol(cfg),
+		scores:   scores,
+		bw:       bw,
+		now:      time.Now,
+		limiters: make(map[peer.ID]*rate.Limiter),
+	}
+}
+
+// allow returns true if the peer did not exceed its rate of requests.
+func (s *payloadSync) allow(id peer.ID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lim, ok := s.limiters[id]
+	if !ok {
+		lim = rate.NewLimiter(peerSyncRequestRate, peerSyncRequestBurst)
+		s.limiters[id] = lim
+	}
+	return lim.AllowN(s.now(), 1)
+}
+
+// forget drops the rate limiters of the peers that are not kept, e.g. of the disconnected peers.
+func (s *payloadSync) forget(keep func(id peer.ID) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.limiters {
+		if !keep(id) {
+			delete(s.limiters, id)
+		}
+	}
+}
+
+func (s *payloadSync) setReceiver(in GossipIn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.in = in
+}
+
+// ServePayloadsByRange serves the canonical payloads of the source to the peers that request them.
+func (n *Node) ServePayloadsByRange(src L2PayloadSource) {
+	n.rangeSync.host.SetStreamHandler(n.rangeSync.protocol, func(stream network.Stream) {
+		n.rangeSync.serve(src, stream)
+	})
+}
+
+func (s *payloadSync) serve(src L2PayloadSource, stream network.Stream) {
+	defer stream.Close()
+	from := stream.Conn().RemotePeer()
+	_ = stream.SetDeadline(s.now().Add(syncServeTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), syncServeTimeout)
+	defer cancel()
+
+	var req [16]byte
+	if _, err := io.ReadFull(stream, req[:]); err != nil {
+		s.log.Debug("Failed to read payloads-by-range request", "peer", from, "err", err)
+		return
+	}
+	start, end := binary.BigEndian.Uint64(req[:8]), binary.BigEndian.Uint64(req[8:])
+	if !s.allow(from) {
+		s.log.Debug("Throttled payloads-by-range requests of peer", "peer", from)
+		metrics.GetOrRegisterCounter("p2p/sync/throttled", nil).Inc(1)
+		if s.scores.penalize(from, throttledPayloadPenalty) {
+			s.log.Warn("Banned peer for its payloads-by-range requests", "peer", from, "duration", DefaultBanDuration)
+		}
+		_, _ = stream.Write([]byte{syncResultRateLimited})
+		return
+	}
+	if start > end || end-start >= MaxPayloadsPerRequest {
+		s.log.Debug("Rejected invalid payloads-by-range request", "peer", from, "start", start, "end", end)
+		_, _ = stream.Write([]byte{syncResultInvalidRequest})
+		return
+	}
+	// the first payload is fetched before the result code is sent, so that a failure can still be reported
+	first, err := src.PayloadByNumber(ctx, end)
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		s.log.Warn("Failed to fetch payload to serve", "peer", from, "number", end, "err", err)
+		_, _ = stream.Write([]byte{syncResultServerError})
+		return
+	}
+	w := bufio.NewWriter(s.bw.limit(ctx, from, stream))
+	_ = w.WriteByte(syncResultOK)
+	size, served := 0, 0
+	for number, payload := end, first; payload != nil; {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			s.log.Error("Failed to encode payload to serve", "payload", payload.ID(), "err", err)
+			break
+		}
+		data = snappy.Encode(nil, data)
+		if size += len(data); size > maxSyncResponseSize {
+			break
+		}
+		var prefix [binary.MaxVarintLen64]byte
+		if _, err := w.Write(prefix[:binary.PutUvarint(prefix[:], uint64(len(data)))]); err != nil {
+			break
+		}
+		if _, err := w.Write(data); err != nil {
+			break
+		}
+		served++
+		if number == start {
+			break
+		}
+		number--
+		payload, err = src.PayloadByNumber(ctx, number)
+		if err != nil {
+			s.log.Debug("Stopped serving payloads", "peer", from, "number", number, "err", err)
+			break
+		}
+	}
+	if err := w.Flush(); err != nil {
+		s.log.Debug("Failed to send payloads", "peer", from, "err", err)
+		return
+	}
+	metrics.GetOrRegisterCounter("p2p/sync/served", nil).Inc(int64(served))
+	s.log.Debug("Served payloads", "peer", from, "start", start, "end", end, "served", served)
+}
+
+// RequestPayloadsByRange requests the canonical payloads of the peer from block number start up to end, inclusive,
+// and returns them from end down to start. The payload at end must have the anchor hash, and each payload must be
+// the parent of the one before it. There may be fewer payloads than requested, down to none.
+// The peer is penalized if it responds with invalid payloads, or with payloads of another chain than the anchor.
+// Responses without payloads are not penalized: the peer may not have the payloads yet.
+func (n *Node) RequestPayloadsByRange(ctx context.Context, id peer.ID, start uint64, end uint64, anchor common.Hash) ([]*l2.ExecutionPayload, error) {
+	return n.rangeSync.request(ctx, id, start, end, anchor)
+}
+
+func (s *payloadSync) request(ctx context.Context, id peer.ID, start uint64, end uint64, anchor common.Hash) ([]*l2.ExecutionPayload, error) {
+	if start > end || end-start >= MaxPayloadsPerRequest {
+		return nil, fmt.Errorf("%w: %d to %d", ErrInvalidSyncRequest, start, end)
+	}
+	ctx, cancel := context.WithTimeout(ctx, syncRequestTimeout)
+	defer cancel()
+	stream, err := s.host.NewStream(ctx, id, s.protocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payloads-by-range stream to peer %s: %w", id, err)
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+	var req [16]byte
+	binary.BigEndian.PutUint64(req[:8], start)
+	binary.BigEndian.PutUint64(req[8:], end)
+	if _, err := stream.Write(req[:]); err != nil {
+		return nil, fmt.Errorf("failed to send payloads-by-range request to peer %s: %w", id, err)
+	}
+	_ = stream.CloseWrite()
+	metrics.GetOrRegisterCounter("p2p/sync/requested", nil).Inc(1)
+
+	payloads, err := s.readResponse(bufio.NewReader(s.bw.limit(ctx, id, stream)), end, anchor)
+	if errors.Is(err, ErrSyncRateLimited) || errors.Is(err, ErrSyncServerError) {
+		return nil, fmt.Errorf("peer %s: %w", id, err)
+	} else if errors.Is(err, errSyncOtherChain) {
+		// another canonical chain is not invalid, only of no use
+		if s.scores.penalize(id, uselessPayloadPenalty) {
+			s.log.Warn("Banned peer for its payloads-by-range response", "peer", id, "duration", DefaultBanDuration)
+		}
+		return nil, nil
+	} else if err != nil {
+		metrics.GetOrRegisterCounter("p2p/sync/rejected", nil).Inc(1)
+		if s.scores.penalize(id, invalidPayloadPenalty) {
+			s.log.Warn("Banned peer for its payloads-by-range response", "peer", id, "duration", DefaultBanDuration)
+		}
+		return nil, fmt.Errorf("invalid payloads-by-range response of peer %s: %w", id, err)
+	}
+	if len(payloads) > 0 {
+		s.scores.reward(id)
+	}
+	metrics.GetOrRegisterCounter("p2p/sync/received", nil).Inc(int64(len(payloads)))
+	return payloads, nil
+}
+
+// readResponse reads and checks the payloads of a response, which must link from the anchor at block number end.
+func (s *payloadSync) readResponse(r *bufio.Reader, end uint64, anchor common.Hash) ([]*l2.ExecutionPayload, error) {
+	result, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result: %w", err)
+	}
+	switch result {
+	case syncResultOK:
+	case syncResultRateLimited:
+		return nil, ErrSyncRateLimited
+	case syncResultServerError:
+		return nil, ErrSyncServerError
+	case syncResultInvalidRequest:
+		return nil, ErrInvalidSyncRequest
+	default:
+		return nil, fmt.Errorf("unknown result %d", result)
+	}
+	var payloads []*l2.ExecutionPayload
+	size := 0
+	expected := eth.BlockID{Hash: anchor, Number: end}
+	for {
+		length, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return payloads, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read payload length: %w", err)
+		}
+		if size += int(length); length > maxSyncResponseSize || size > maxSyncResponseSize {
+			return nil, fmt.Errorf("response exceeds %d bytes", maxSyncResponseSize)
+		}
+		if len(payloads) >= MaxPayloadsPerRequest {
+			return nil, fmt.Errorf("response has more than %d payloads", MaxPayloadsPerRequest)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("failed to read payload: %w", err)
+		}
+		if n, err := snappy.DecodedLen(data); err != nil {
+			return nil, err
+		} else if n > maxGossipSize {
+			return nil, fmt.Errorf("payload of %d bytes is too large", n)
+		}
+		if data, err = snappy.Decode(nil, data); err != nil {
+			return nil, err
+		}
+		var payload l2.ExecutionPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, err
+		}
+		if payload.ID() != expected {
+			if len(payloads) == 0 && uint64(payload.BlockNumber) == end {
+				return nil, errSyncOtherChain
+			}
+			return nil, fmt.Errorf("payload %s does not match the expected block %s", payload.ID(), expected)
+		}
+		if err := payload.CheckBlockHash(); err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, &payload)
+		if expected.Number == 0 {
+			return payloads, nil
+		}
+		expected = eth.BlockID{Hash: payload.ParentHash(), Number: expected.Number - 1}
+	}
+}
+
+// RequestL2Range fetches the payloads after start up to end, inclusive, from the peers in the background, and passes
+// them to the receiver of the gossip, oldest first. The payloads are authenticated by their links to the end block,
+// they do not have signatures. Only one range is fetched at a time, ErrSyncInProgress is returned while a range is
+// being fetched. At most MaxSyncRange payloads are fetched.
+func (n *Node) RequestL2Range(ctx context.Context, start eth.L2BlockRef, end eth.BlockID) error {
+	return n.rangeSync.requestRange(start, end, n.closing)
+}
+
+func (s *payloadSync) requestRange(start eth.L2BlockRef, end eth.BlockID, closing <-chan struct{}) error {
+	if end.Number <= start.Number {
+		return fmt.Errorf("%w: %s does not follow %s", ErrInvalidSyncRequest, end, start)
+	}
+	if end.Number-start.Number > MaxSyncRange {
+		return fmt.Errorf("%w: %d payloads from %s to %s", ErrSyncRangeTooLarge, end.Number-start.Number, start, end)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.in == nil {
+		return ErrNotSubscribed
+	}
+	if s.syncing {
+		return ErrSyncInProgress
+	}
+	s.syncing = true
+	in := s.in
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if err := s.syncRange(ctx, start, end, in); err != nil {
+			s.log.Warn("Failed to sync payloads from peers", "start", start, "end", end, "err", err)
+		}
+		s.mu.Lock()
+		s.syncing = false
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+// syncedPayload is a payload fetched from a peer
+type syncedPayload struct {
+	payload *l2.ExecutionPayload
+	from    peer.ID
+}
+
+// syncRange fetches the payloads from end back to start in chunks, each from the best scored peer that serves it,
+// and passes them to the receiver once they link up to start.
+func (s *payloadSync) syncRange(ctx context.Context, start eth.L2BlockRef, end eth.BlockID, in GossipIn) error {
+	var synced []syncedPayload
+	anchor := end
+	for anchor.Number > start.Number {
+		first := start.Number + 1
+		if anchor.Number-first >= MaxPayloadsPerRequest {
+			first = anchor.Number - MaxPayloadsPerRequest + 1
+		}
+		payloads, from, err := s.requestFromPeers(ctx, first, anchor.Number, anchor.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to fetch payloads %d to %s: %w", first, anchor, err)
+		}
+		for _, p := range payloads {
+			synced = append(synced, syncedPayload{payload: p, from: from})
+		}
+		last := payloads[len(payloads)-1]
+		anchor = eth.BlockID{Hash: last.ParentHash(), Number: uint64(last.BlockNumber) - 1}
+	}
+	if anchor != start.ID() {
+		return fmt.Errorf("synced payloads link to %s, not to the start %s", anchor, start)
+	}
+	s.log.Info("Synced payloads from peers", "start", start, "end", end, "payloads", len(synced))
+	for i := len(synced) - 1; i >= 0; i-- {
+		p := synced[i]
+		if err := in.OnUnsafeL2Payload(ctx, p.from, &PayloadEnvelope{Payload: p.payload}); err != nil {
+			return fmt.Errorf("failed to process synced payload %s: %w", p.payload.ID(), err)
+		}
+	}
+	return nil
+}
+
+// requestFromPeers requests the payloads from the connected peers, best scored first, until a peer serves some.
+func (s *payloadSync) requestFromPeers(ctx context.Context, start uint64, end uint64, anchor common.Hash) ([]*l2.ExecutionPayload, peer.ID, error) {
+	peers := s.host.Network().Peers()
+	scores := make(map[peer.ID]float64, len(peers))
+	for _, id := range peers {
+		scores[id] = s.scores.score(id)
+	}
+	sort.SliceStable(peers, func(i, j int) bool { return scores[peers[i]] > scores[peers[j]] })
+	for _, id := range peers {
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if s.scores.banned(id) {
+			continue
+		}
+		payloads, err := s.request(ctx, id, start, end, anchor)
+		if err != nil {
+			s.log.Debug("Failed to fetch payloads from peer", "peer", id, "start", start, "end", end, "err", err)
+			continue
+		}
+		if len(payloads) > 0 {
+			return payloads, id, nil
+		}
+	}
+	return nil, "", ErrNoSyncPeers
+}
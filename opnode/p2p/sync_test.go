@@ -0,0 +1,151 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadChain is a source of a chain of linked payloads
+type payloadChain []*l2.ExecutionPayload
+
+func (c payloadChain) PayloadByNumber(ctx context.Context, number uint64) (*l2.ExecutionPayload, error) {
+	if number >= uint64(len(c)) {
+		return nil, ethereum.NotFound
+	}
+	return c[number], nil
+}
+
+func testPayloadChain(t *testing.T, length int) payloadChain {
+	var chain payloadChain
+	parent := common.Hash{}
+	for i := 0; i < length; i++ {
+		payload := &l2.ExecutionPayload{
+			ParentHashField: parent,
+			BlockNumber:     l2.Uint64Quantity(i),
+			GasLimit:        30_000_000,
+			Timestamp:       l2.Uint64Quantity(1000 + 2*i),
+		}
+		hash, err := payload.ComputeBlockHash()
+		require.NoError(t, err)
+		payload.BlockHash = hash
+		chain = append(chain, payload)
+		parent = hash
+	}
+	return chain
+}
+
+func TestPayloadsByRange(t *testing.T) {
+	cfg, _ := testRollup(t, 901)
+	server := testNode(t, cfg, nil)
+	client := testNode(t, cfg, nil)
+	connect(t, client, server)
+	chain := testPayloadChain(t, 20)
+	server.ServePayloadsByRange(chain)
+	ctx := context.Background()
+
+	payloads, err := client.RequestPayloadsByRange(ctx, server.Host().ID(), 5, 10, chain[10].BlockHash)
+	require.NoError(t, err)
+	require.Len(t, payloads, 6)
+	for i, p := range payloads {
+		require.Equal(t, chain[10-i].BlockHash, p.BlockHash)
+	}
+
+	// the range past the chain of the server is served up to its head, the server is not penalized for it
+	score := client.scores.score(server.Host().ID())
+	payloads, err = client.RequestPayloadsByRange(ctx, server.Host().ID(), 15, 25, common.Hash{1})
+	require.NoError(t, err)
+	require.Empty(t, payloads)
+	require.Equal(t, score, client.scores.score(server.Host().ID()))
+
+	// another chain than the one of the anchor is of no use, but not invalid
+	payloads, err = client.RequestPayloadsByRange(ctx, server.Host().ID(), 5, 10, common.Hash{1})
+	require.NoError(t, err)
+	require.Empty(t, payloads)
+	require.Less(t, client.scores.score(server.Host().ID()), score)
+
+	_, err = client.RequestPayloadsByRange(ctx, server.Host().ID(), 10, 5, chain[10].BlockHash)
+	require.ErrorIs(t, err, ErrInvalidSyncRequest)
+	_, err = client.RequestPayloadsByRange(ctx, server.Host().ID(), 0, MaxPayloadsPerRequest, chain[10].BlockHash)
+	require.ErrorIs(t, err, ErrInvalidSyncRequest)
+}
+
+func TestPayloadsByRangeInvalid(t *testing.T) {
+	cfg, _ := testRollup(t, 901)
+	server := testNode(t, cfg, nil)
+	client := testNode(t, cfg, nil)
+	connect(t, client, server)
+	chain := testPayloadChain(t, 20)
+	// a payload that does not match its block hash breaks the chain
+	tampered := *chain[8]
+	tampered.GasUsed = 1
+	bad := append(payloadChain{}, chain...)
+	bad[8] = &tampered
+	server.ServePayloadsByRange(bad)
+
+	_, err := client.RequestPayloadsByRange(context.Background(), server.Host().ID(), 5, 10, chain[10].BlockHash)
+	require.Error(t, err)
+	require.Less(t, client.scores.score(server.Host().ID()), float64(0))
+}
+
+func TestPayloadsByRangeRateLimit(t *testing.T) {
+	cfg, _ := testRollup(t, 901)
+	server := testNode(t, cfg, nil)
+	client := testNode(t, cfg, nil)
+	connect(t, client, server)
+	chain := testPayloadChain(t, 20)
+	server.ServePayloadsByRange(chain)
+
+	for i := 0; i < peerSyncRequestBurst; i++ {
+		_, err := client.RequestPayloadsByRange(context.Background(), server.Host().ID(), 5, 10, chain[10].BlockHash)
+		require.NoError(t, err)
+	}
+	_, err := client.RequestPayloadsByRange(context.Background(), server.Host().ID(), 5, 10, chain[10].BlockHash)
+	require.ErrorIs(t, err, ErrSyncRateLimited)
+	require.Less(t, server.scores.score(client.Host().ID()), float64(0))
+
+	server.rangeSync.forget(func(id peer.ID) bool { return false })
+	require.Empty(t, server.rangeSync.limiters, "the limiters of disconnected peers are dropped")
+}
+
+func TestRequestL2Range(t *testing.T) {
+	cfg, _ := testRollup(t, 901)
+	server := testNode(t, cfg, nil)
+	client := testNode(t, cfg, nil)
+	connect(t, client, server)
+	chain := testPayloadChain(t, 200)
+	server.ServePayloadsByRange(chain)
+
+	start := eth.L2BlockRef{Hash: chain[2].BlockHash, Number: 2}
+	end := chain[150].ID()
+	require.ErrorIs(t, client.RequestL2Range(context.Background(), start, end), ErrNotSubscribed)
+
+	received := make(chan *PayloadEnvelope, 200)
+	require.NoError(t, client.Subscribe(gossipInFn(func(from peer.ID, env *PayloadEnvelope) {
+		require.Equal(t, server.Host().ID(), from)
+		received <- env
+	})))
+	tooFar := eth.BlockID{Hash: chain[2].BlockHash, Number: 2 + MaxSyncRange + 1}
+	require.ErrorIs(t, client.RequestL2Range(context.Background(), start, tooFar), ErrSyncRangeTooLarge)
+
+	require.NoError(t, client.RequestL2Range(context.Background(), start, end))
+	for i := 3; i <= 150; i++ {
+		select {
+		case env := <-received:
+			require.Equal(t, chain[i].BlockHash, env.Payload.BlockHash, "payloads are passed oldest first")
+			require.Nil(t, env.Signature)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("payload %d not received", i)
+		}
+	}
+	require.Eventually(t, func() bool {
+		return client.RequestL2Range(context.Background(), start, end) == nil
+	}, 5*time.Second, 10*time.Millisecond, "a new range can be requested once the sync is done")
+}
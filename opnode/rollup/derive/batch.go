@@ -2,6 +2,7 @@ package derive
 
 import (
 	"bytes"
+	"compress/zlib"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -18,18 +20,25 @@ import (
 // BatchV1Type := 0
 // batchV1 := BatchV1Type ++ RLP([epoch, timestamp, transaction_list]
 //
+// SpanBatchV1Type := 1
+// spanBatchV1 := SpanBatchV1Type ++ RLP([epoch, timestamp, block_count, epoch_bits, non_empty_bits, tx_counts, transaction_list])
+//
+// A span batch covers a contiguous span of L2 blocks, see SpanBatch.
 // An empty input is not a valid batch.
 //
 // Batch-bundle format
 // first byte is type followed by bytestring
 //
-// payload := RLP([batch_0, batch_1, ..., batch_N])
+// payload := RLP([batch_0, batch_1, ..., batch_N])  # batches of any batch type
 // bundleV1 := BatchBundleV1Type ++ payload
-// bundleV2 := BatchBundleV2Type ++ compress(payload)  # TODO: compressed bundle of batches
+// bundleV2 := BatchBundleV2Type ++ zlib_compress(payload)
 //
 // An empty input is not a valid bundle.
 //
 // Note: the type system is based on L1 typed transactions.
+//
+// Batches and bundles of an unknown type are skipped by the decoder, instead of failing the bundle or derivation:
+// new types can be introduced by an upgrade, and are ignored by verifiers that do not support them yet.
 
 // encodeBufferPool holds temporary encoder buffers for batch encoding
 var encodeBufferPool = sync.Pool{
@@ -38,6 +47,7 @@ var encodeBufferPool = sync.Pool{
 
 const (
 	BatchV1Type = iota
+	SpanBatchV1Type
 )
 
 const (
@@ -45,6 +55,26 @@ const (
 	BatchBundleV2Type
 )
 
+// ErrUnknownVersion is returned when decoding a batch or bundle of an unrecognized type.
+var ErrUnknownVersion = errors.New("unknown version")
+
+// MaxBundlePayloadSize is the maximum size of the decompressed payload of a compressed bundle,
+// to not let a small compressed bundle expand into an unbounded amount of memory.
+const MaxBundlePayloadSize = 10_000_000
+
+// BundleTypeForCompression returns the type of batch bundle that compresses with the given algorithm:
+// "none" (or empty) for no compression, or "zlib".
+func BundleTypeForCompression(compression string) (byte, error) {
+	switch compression {
+	case "", "none":
+		return BatchBundleV1Type, nil
+	case "zlib":
+		return BatchBundleV2Type, nil
+	default:
+		return 0, fmt.Errorf("unknown batch compression %q, expected 'none' or 'zlib'", compression)
+	}
+}
+
 type BatchV1 struct {
 	Epoch     rollup.Epoch // aka l1 num
 	Timestamp uint64
@@ -57,41 +87,71 @@ type BatchData struct {
 	// batches may contain additional data with new upgrades
 }
 
+// DecodeBatches decodes all batches of a batch bundle, of at most MaxBundlePayloadSize bytes of payload, see BatchReader.
 func DecodeBatches(config *rollup.Config, r io.Reader) ([]*BatchData, error) {
-	var typeData [1]byte
-	if _, err := io.ReadFull(r, typeData[:]); err != nil {
-		return nil, fmt.Errorf("failed to read batch bundle type byte: %v", err)
+	br, err := NewBatchReader(config, r, MaxBundlePayloadSize)
+	if err != nil {
+		return nil, err
 	}
-	switch typeData[0] {
-	case BatchBundleV1Type:
-		var out []*BatchData
-		if err := rlp.Decode(r, &out); err != nil {
-			return nil, fmt.Errorf("failed to decode v1 batches list: %v", err)
+	defer br.Close()
+	var out []*BatchData
+	for {
+		batch, err := br.Next()
+		if err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, err
 		}
-		return out, nil
-	case BatchBundleV2Type:
-		// TODO: implement compression of a bundle of batches
-		return nil, errors.New("bundle v2 not supported yet")
+		out = append(out, batch)
+	}
+}
+
+// encodePayload encodes the batches as a bundle payload, with batches of the given batch type.
+func encodePayload(config *rollup.Config, batchType byte, batches []*BatchData, w io.Writer) error {
+	switch batchType {
+	case BatchV1Type:
+		return rlp.Encode(w, batches)
+	case SpanBatchV1Type:
+		var items [][]byte
+		for _, span := range NewSpanBatches(config.BlockTime, batches) {
+			enc, err := rlp.EncodeToBytes(span)
+			if err != nil {
+				return err
+			}
+			items = append(items, append([]byte{SpanBatchV1Type}, enc...))
+		}
+		return rlp.Encode(w, items)
 	default:
-		return nil, fmt.Errorf("unrecognized batch bundle type: %d", typeData[0])
+		return fmt.Errorf("unrecognized batch type: %d", batchType)
 	}
 }
 
+// EncodeBatches encodes the batches as a v1 bundle of v1 batches, without compression.
 func EncodeBatches(config *rollup.Config, batches []*BatchData, w io.Writer) error {
-	// default to encode as v1 (no compression). Config may change this in the future.
-	bundleType := byte(BatchBundleV1Type)
+	return EncodeBatchBundle(config, BatchBundleV1Type, BatchV1Type, batches, w)
+}
 
+// EncodeBatchBundle encodes the batches as a bundle of the given type, with batches of the given batch type:
+// either a batch per L2 block, or span batches that each cover a span of L2 blocks.
+func EncodeBatchBundle(config *rollup.Config, bundleType byte, batchType byte, batches []*BatchData, w io.Writer) error {
 	if _, err := w.Write([]byte{bundleType}); err != nil {
 		return fmt.Errorf("failed to encode batch type")
 	}
 	switch bundleType {
 	case BatchBundleV1Type:
-		if err := rlp.Encode(w, batches); err != nil {
+		if err := encodePayload(config, batchType, batches, w); err != nil {
 			return fmt.Errorf("failed to encode RLP-list payload of v1 bundle: %v", err)
 		}
 		return nil
 	case BatchBundleV2Type:
-		return errors.New("bundle v2 not supported yet")
+		zw := zlib.NewWriter(w)
+		if err := encodePayload(config, batchType, batches, zw); err != nil {
+			return fmt.Errorf("failed to encode RLP-list payload of v2 bundle: %v", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to compress payload of v2 bundle: %v", err)
+		}
+		return nil
 	default:
 		return fmt.Errorf("unrecognized batch bundle type: %d", bundleType)
 	}
@@ -148,6 +208,11 @@ func (b *BatchData) decodeTyped(data []byte) error {
 	case BatchV1Type:
 		return rlp.DecodeBytes(data[1:], &b.BatchV1)
 	default:
-		return fmt.Errorf("unrecognized batch type: %d", data[0])
+		return fmt.Errorf("%w: unrecognized batch type: %d", ErrUnknownVersion, data[0])
 	}
 }
+
+// unknownVersions counts the skipped batches and bundles of an unknown type.
+func unknownVersions(kind string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("derive/unknown_version/"+kind, nil)
+}
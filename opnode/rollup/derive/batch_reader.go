@@ -0,0 +1,123 @@
+package derive
+
+import (
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// BatchReader decodes the batches of a batch bundle incrementally from a reader:
+// the payload is read (and decompressed) one batch item at a time, up to a size limit,
+// so the bundle does not have to be in memory as a whole, and a malformed batch is rejected
+// without reading the remainder of the bundle. An item that is larger than the rest of the limit
+// is rejected from its size prefix, before it is read.
+// Span batches are expanded into the batches of their blocks, batches of an unknown type are skipped.
+type BatchReader struct {
+	config *rollup.Config
+	kind   string
+	s      *rlp.Stream
+	// closer closes the decompressor of the payload, if any
+	closer io.Closer
+
+	started bool
+	done    bool
+	// index is the index of the next batch item of the payload
+	index int
+	// pending are the remaining batches of the last span batch
+	pending []*BatchData
+}
+
+// NewBatchReader reads the type of the bundle, and returns a reader of the batches of the bundle,
+// of which at most limit bytes of (decompressed) payload are read.
+// The error wraps ErrUnknownVersion if the bundle type is not recognized.
+func NewBatchReader(config *rollup.Config, r io.Reader, limit uint64) (*BatchReader, error) {
+	var typeData [1]byte
+	if _, err := io.ReadFull(r, typeData[:]); err != nil {
+		return nil, fmt.Errorf("failed to read batch bundle type byte: %v", err)
+	}
+	switch typeData[0] {
+	case BatchBundleV1Type:
+		return &BatchReader{config: config, kind: "v1", s: rlp.NewStream(r, limit)}, nil
+	case BatchBundleV2Type:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zlib header of v2 bundle: %v", err)
+		}
+		// The payload is decompressed while it is decoded, up to the limit
+		return &BatchReader{config: config, kind: "v2", s: rlp.NewStream(zr, limit), closer: zr}, nil
+	default:
+		return nil, fmt.Errorf("%w: unrecognized batch bundle type: %d", ErrUnknownVersion, typeData[0])
+	}
+}
+
+// Next returns the next batch of the bundle, or io.EOF after the last batch.
+func (br *BatchReader) Next() (*BatchData, error) {
+	for len(br.pending) == 0 {
+		if br.done {
+			return nil, io.EOF
+		}
+		if err := br.readItem(); err != nil {
+			br.done = true
+			return nil, fmt.Errorf("failed to decode %s batches list: %w", br.kind, err)
+		}
+	}
+	batch := br.pending[0]
+	br.pending = br.pending[1:]
+	return batch, nil
+}
+
+// readItem decodes the next batch item of the payload into the pending batches.
+func (br *BatchReader) readItem() error {
+	if !br.started {
+		if _, err := br.s.List(); err != nil {
+			return err
+		}
+		br.started = true
+	}
+	// the size prefix of the item is checked against the rest of the limit before the item is read
+	if _, _, err := br.s.Kind(); errors.Is(err, rlp.EOL) {
+		br.done = true
+		return br.s.ListEnd()
+	} else if err != nil {
+		return fmt.Errorf("failed to read batch %d: %w", br.index, err)
+	}
+	item, err := br.s.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to read batch %d: %w", br.index, err)
+	}
+	i := br.index
+	br.index++
+	if len(item) > 0 && item[0] == SpanBatchV1Type {
+		var span SpanBatch
+		if err := rlp.DecodeBytes(item[1:], &span); err != nil {
+			return fmt.Errorf("failed to decode span batch %d: %v", i, err)
+		}
+		batches, err := span.Batches(br.config.BlockTime)
+		if err != nil {
+			return fmt.Errorf("invalid span batch %d: %v", i, err)
+		}
+		br.pending = batches
+		return nil
+	}
+	var batch BatchData
+	if err := batch.UnmarshalBinary(item); errors.Is(err, ErrUnknownVersion) {
+		unknownVersions("batch").Inc(1)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to decode batch %d: %v", i, err)
+	}
+	br.pending = []*BatchData{&batch}
+	return nil
+}
+
+// Close releases the decompressor of the bundle, if any.
+func (br *BatchReader) Close() error {
+	if br.closer != nil {
+		return br.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package derive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+// failingReader returns the data, and then fails instead of returning io.EOF.
+type failingReader struct {
+	r *bytes.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.r.Len() == 0 {
+		return 0, errors.New("read past the data")
+	}
+	return f.r.Read(p)
+}
+
+func TestBatchReader(t *testing.T) {
+	config := &rollup.Config{BlockTime: 2}
+	batches := []*BatchData{
+		{BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{bytes.Repeat([]byte{1}, 1000)}}},
+		{BatchV1{Epoch: 1, Timestamp: 4, Transactions: []hexutil.Bytes{bytes.Repeat([]byte{2}, 1000)}}},
+	}
+	for _, bundleType := range []byte{BatchBundleV1Type, BatchBundleV2Type} {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBatchBundle(config, bundleType, SpanBatchV1Type, batches, &buf))
+		br, err := NewBatchReader(config, bytes.NewReader(buf.Bytes()), MaxBundlePayloadSize)
+		require.NoError(t, err)
+		for _, expected := range batches {
+			batch, err := br.Next()
+			require.NoError(t, err)
+			require.Equal(t, expected, batch)
+		}
+		_, err = br.Next()
+		require.Equal(t, io.EOF, err)
+		require.NoError(t, br.Close())
+	}
+
+	t.Run("partial data", func(t *testing.T) {
+		// The batches before a malformed batch are read, without reading the rest of the payload
+		first, err := batches[0].MarshalBinary()
+		require.NoError(t, err)
+		var payload bytes.Buffer
+		require.NoError(t, rlp.Encode(&payload, [][]byte{first, {BatchV1Type, 0xff}, first}))
+		data := append([]byte{BatchBundleV1Type}, payload.Bytes()...)
+		br, err := NewBatchReader(config, &failingReader{r: bytes.NewReader(data)}, MaxBundlePayloadSize)
+		require.NoError(t, err)
+		batch, err := br.Next()
+		require.NoError(t, err)
+		require.Equal(t, batches[0], batch)
+		_, err = br.Next()
+		require.Error(t, err)
+		_, err = br.Next()
+		require.Equal(t, io.EOF, err, "no batches after an error")
+
+		// A truncated payload is decoded up to the truncation
+		payload.Reset()
+		require.NoError(t, rlp.Encode(&payload, [][]byte{first, first}))
+		data = append([]byte{BatchBundleV1Type}, payload.Bytes()...)
+		br, err = NewBatchReader(config, &failingReader{r: bytes.NewReader(data[:len(data)-10])}, MaxBundlePayloadSize)
+		require.NoError(t, err)
+		_, err = br.Next()
+		require.NoError(t, err)
+		_, err = br.Next()
+		require.Error(t, err)
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		first, err := batches[0].MarshalBinary()
+		require.NoError(t, err)
+		var payload bytes.Buffer
+		require.NoError(t, rlp.Encode(&payload, [][]byte{first, first}))
+		data := append([]byte{BatchBundleV1Type}, payload.Bytes()...)
+		br, err := NewBatchReader(config, &failingReader{r: bytes.NewReader(data)}, uint64(len(data)-100))
+		require.NoError(t, err)
+		_, err = br.Next()
+		require.ErrorIs(t, err, rlp.ErrValueTooLarge, "a payload over the limit is rejected before it is read")
+
+		// an item that exceeds the limit is rejected before it is read
+		header := []byte{BatchBundleV1Type, 0xc0 + 55 + 2, 0xff, 0x00, 0xb9, 0xff, 0xfa}
+		br, err = NewBatchReader(config, &failingReader{r: bytes.NewReader(header)}, 0x10000)
+		require.NoError(t, err)
+		_, err = br.Next()
+		require.ErrorIs(t, err, rlp.ErrElemTooLarge)
+	})
+
+	t.Run("unknown bundle type", func(t *testing.T) {
+		_, err := NewBatchReader(config, bytes.NewReader([]byte{0x7f}), MaxBundlePayloadSize)
+		require.ErrorIs(t, err, ErrUnknownVersion)
+	})
+}
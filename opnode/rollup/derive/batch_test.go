@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +46,56 @@ func TestBatchRoundTrip(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, batches, out)
 }
+
+func TestCompressedBatchBundle(t *testing.T) {
+	batches := []*BatchData{
+		{BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{bytes.Repeat([]byte{1}, 1000)}}},
+		{BatchV1{Epoch: 1, Timestamp: 4, Transactions: []hexutil.Bytes{bytes.Repeat([]byte{2}, 1000)}}},
+	}
+	var plain, compressed bytes.Buffer
+	assert.NoError(t, EncodeBatchBundle(&rollup.Config{}, BatchBundleV1Type, BatchV1Type, batches, &plain))
+	assert.NoError(t, EncodeBatchBundle(&rollup.Config{}, BatchBundleV2Type, BatchV1Type, batches, &compressed))
+	assert.Less(t, compressed.Len(), plain.Len()/10)
+	assert.Equal(t, byte(BatchBundleV2Type), compressed.Bytes()[0])
+	out, err := DecodeBatches(&rollup.Config{}, &compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, batches, out)
+
+	// A payload that decompresses beyond the max payload size is rejected
+	large := []*BatchData{{BatchV1{Transactions: []hexutil.Bytes{make([]byte, MaxBundlePayloadSize)}}}}
+	var bomb bytes.Buffer
+	assert.NoError(t, EncodeBatchBundle(&rollup.Config{}, BatchBundleV2Type, BatchV1Type, large, &bomb))
+	assert.Less(t, bomb.Len(), 100_000)
+	_, err = DecodeBatches(&rollup.Config{}, &bomb)
+	assert.Error(t, err)
+}
+
+func TestUnknownVersions(t *testing.T) {
+	config := &rollup.Config{}
+	batch := &BatchData{BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{{1}}}}
+	enc, err := batch.MarshalBinary()
+	assert.NoError(t, err)
+
+	// A batch of an unknown type is skipped, the other batches of the bundle are decoded
+	var buf bytes.Buffer
+	buf.WriteByte(BatchBundleV1Type)
+	assert.NoError(t, rlp.Encode(&buf, [][]byte{{0x7f, 0xc0}, enc}))
+	out, err := DecodeBatches(config, bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, []*BatchData{batch}, out)
+
+	// A bundle of an unknown type is skipped, the other bundles are decoded
+	_, err = DecodeBatches(config, bytes.NewReader([]byte{0x7f, 0xc0}))
+	assert.ErrorIs(t, err, ErrUnknownVersion)
+	out, err = BatchesFromData(config, [][][]byte{{{0x7f, 0xc0}, buf.Bytes()}}, testlog.Logger(t, log.LvlError))
+	assert.NoError(t, err)
+	assert.Equal(t, []*BatchData{batch}, out)
+
+	// A malformed batch of a known type still fails the bundle
+	buf.Reset()
+	buf.WriteByte(BatchBundleV1Type)
+	assert.NoError(t, rlp.Encode(&buf, [][]byte{{BatchV1Type, 0xff}, enc}))
+	_, err = DecodeBatches(config, bytes.NewReader(buf.Bytes()))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnknownVersion)
+}
@@ -0,0 +1,92 @@
+package derive
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	BlobSize        = 4096 * 32
+	BlobEncodingV0  = 0
+	blobFieldBytes  = 31 // usable bytes per field element, the first byte is zero
+	blobHeaderBytes = 4  // encoding version (1 byte) and data length (3 bytes)
+	MaxBlobDataSize = 4096*blobFieldBytes - blobHeaderBytes
+
+	// VersionedHashVersionKZG is the version byte of a blob versioned hash of a KZG commitment.
+	VersionedHashVersionKZG = 0x01
+)
+
+// Blob is an EIP-4844 blob: 4096 field elements of 32 bytes each.
+//
+// Batch data is encoded in a blob as follows: the first byte of each field element is zero,
+// so that every field element is valid. The remaining 31 bytes of each field element, concatenated,
+// are the encoding version (1 byte), the length of the data (3 bytes, big-endian), the data, and zero padding.
+type Blob [BlobSize]byte
+
+// KZGCommitment is the KZG commitment to a blob.
+type KZGCommitment [48]byte
+
+// KZGProof is the KZG proof of a blob against its commitment.
+type KZGProof [48]byte
+
+func (b *Blob) UnmarshalText(text []byte) error {
+	return hexutil.UnmarshalFixedText("Blob", text, b[:])
+}
+
+func (c *KZGCommitment) UnmarshalText(text []byte) error {
+	return hexutil.UnmarshalFixedText("KZGCommitment", text, c[:])
+}
+
+func (p *KZGProof) UnmarshalText(text []byte) error {
+	return hexutil.UnmarshalFixedText("KZGProof", text, p[:])
+}
+
+// VersionedHash returns the versioned hash of the commitment, as included in blob transactions.
+func (c KZGCommitment) VersionedHash() common.Hash {
+	h := sha256.Sum256(c[:])
+	h[0] = VersionedHashVersionKZG
+	return h
+}
+
+// FromData encodes the data into the blob.
+func (b *Blob) FromData(data []byte) error {
+	if len(data) > MaxBlobDataSize {
+		return fmt.Errorf("data of %d bytes does not fit in a blob of at most %d bytes", len(data), MaxBlobDataSize)
+	}
+	*b = Blob{}
+	content := make([]byte, 0, 4096*blobFieldBytes)
+	content = append(content, BlobEncodingV0, byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	content = append(content, data...)
+	for i := 0; len(content) > 0; i++ {
+		n := copy(b[i*32+1:(i+1)*32], content)
+		content = content[n:]
+	}
+	return nil
+}
+
+// ToData decodes the data of the blob.
+func (b *Blob) ToData() ([]byte, error) {
+	content := make([]byte, 0, 4096*blobFieldBytes)
+	for i := 0; i < 4096; i++ {
+		if b[i*32] != 0 {
+			return nil, fmt.Errorf("invalid field element %d", i)
+		}
+		content = append(content, b[i*32+1:(i+1)*32]...)
+	}
+	if content[0] != BlobEncodingV0 {
+		return nil, fmt.Errorf("unrecognized blob encoding version %d", content[0])
+	}
+	length := int(content[1])<<16 | int(content[2])<<8 | int(content[3])
+	if length > MaxBlobDataSize {
+		return nil, fmt.Errorf("data length %d exceeds the blob", length)
+	}
+	data := content[blobHeaderBytes : blobHeaderBytes+length]
+	if !isZero(content[blobHeaderBytes+length:]) {
+		return nil, errors.New("blob has non-zero padding")
+	}
+	return data, nil
+}
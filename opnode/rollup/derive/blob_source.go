@@ -0,0 +1,174 @@
+package derive
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// L1Tx is the data of a L1 transaction that is needed to retrieve the batch data of it: the calldata,
+// and the versioned hashes of the blobs of a blob transaction.
+type L1Tx struct {
+	Hash       common.Hash
+	From       common.Address
+	To         *common.Address
+	Data       []byte
+	BlobHashes []common.Hash
+}
+
+// L1TxsFetcher fetches the transactions of a L1 block, including blob transactions.
+type L1TxsFetcher interface {
+	InfoAndL1TxsByHash(ctx context.Context, hash common.Hash) (L1Info, []L1Tx, error)
+}
+
+// BlobSidecar is a blob with its KZG commitment and proof, as served by a beacon node.
+type BlobSidecar struct {
+	Index         uint64
+	Blob          *Blob
+	KZGCommitment KZGCommitment
+	KZGProof      KZGProof
+}
+
+// BlobSidecarsFetcher fetches the blob sidecars of the L1 block with the given timestamp,
+// by the index of the blobs in the block.
+type BlobSidecarsFetcher interface {
+	BlobSidecars(ctx context.Context, l1Time uint64, indices []uint64) ([]*BlobSidecar, error)
+}
+
+// BlobVerifier verifies a blob against its KZG commitment.
+type BlobVerifier interface {
+	VerifyBlobProof(blob *Blob, commitment KZGCommitment, proof KZGProof) error
+}
+
+// BlobDataSource is the DataSource of batch data submitted as blobs of L1 blob transactions to the batch inbox,
+// and as calldata of the other L1 transactions to the batch inbox.
+// Each blob is an item of batch data.
+//
+// The commitment of each blob sidecar is checked against the versioned hash in the blob transaction,
+// and the blob itself is checked against the commitment by the Verifier, so the beacon node is not trusted.
+type BlobDataSource struct {
+	Config   *rollup.Config
+	L1       L1TxsFetcher
+	Beacon   BlobSidecarsFetcher
+	Verifier BlobVerifier // required, e.g. the KZG of LoadKZG
+	Log      log.Logger
+}
+
+var _ BatchTxSource = (*BlobDataSource)(nil)
+
+func (bs *BlobDataSource) BatchData(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, error) {
+	data, _, err := bs.BatchDataWithTxs(ctx, window, batcherAddr)
+	return data, err
+}
+
+// BatchDataWithTxs returns the batch data like BatchData, and the hash of the L1 transaction of each item:
+// the blobs of a blob transaction share the hash of the transaction.
+func (bs *BlobDataSource) BatchDataWithTxs(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, [][]common.Hash, error) {
+	out := make([][][]byte, len(window))
+	txs := make([][]common.Hash, len(window))
+	for i, id := range window {
+		data, hashes, err := bs.blockData(ctx, id, batcherAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		out[i], txs[i] = data, hashes
+	}
+	return out, txs, nil
+}
+
+// blockData returns the batch data of a single L1 block, and the hashes of the L1 transactions of the items.
+func (bs *BlobDataSource) blockData(ctx context.Context, id eth.BlockID, batcherAddr common.Address) ([][]byte, []common.Hash, error) {
+	info, txs, err := bs.L1.InfoAndL1TxsByHash(ctx, id.Hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch transactions of L1 block %s: %w", id, err)
+	}
+	// Each item is either calldata, or the placeholder of a blob, to keep the order of the data
+	type item struct {
+		data []byte
+		blob bool
+		tx   common.Hash
+	}
+	var items []item
+	var indices []uint64
+	var hashes []common.Hash
+	blobIndex := uint64(0) // the index of a blob is its position among all blobs of the block
+	for _, tx := range txs {
+		if tx.To == nil || *tx.To != bs.Config.BatchInboxAddress {
+			blobIndex += uint64(len(tx.BlobHashes))
+			continue
+		}
+		if tx.From != batcherAddr {
+			droppedInboxTxs("unauthorized_sender").Inc(1)
+			bs.Log.Debug("Dropping batch inbox transaction of an unauthorized sender", "block", id, "sender", tx.From)
+			blobIndex += uint64(len(tx.BlobHashes))
+			continue
+		}
+		if len(tx.BlobHashes) == 0 {
+			items = append(items, item{data: tx.Data, tx: tx.Hash})
+			continue
+		}
+		for _, h := range tx.BlobHashes {
+			items = append(items, item{blob: true, tx: tx.Hash})
+			indices = append(indices, blobIndex)
+			hashes = append(hashes, h)
+			blobIndex++
+		}
+	}
+	if len(indices) == 0 {
+		out := make([][]byte, len(items))
+		hashes := make([]common.Hash, len(items))
+		for i, it := range items {
+			out[i], hashes[i] = it.data, it.tx
+		}
+		return out, hashes, nil
+	}
+
+	sidecars, err := bs.Beacon.BlobSidecars(ctx, info.Time(), indices)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch blob sidecars of L1 block %s: %w", id, err)
+	}
+	if len(sidecars) != len(indices) {
+		return nil, nil, fmt.Errorf("expected %d blob sidecars of L1 block %s, got %d", len(indices), id, len(sidecars))
+	}
+	blobData := make([][]byte, len(sidecars))
+	for i, sc := range sidecars {
+		if sc.Index != indices[i] {
+			return nil, nil, fmt.Errorf("expected blob sidecar %d of L1 block %s, got %d", indices[i], id, sc.Index)
+		}
+		if h := sc.KZGCommitment.VersionedHash(); h != hashes[i] {
+			return nil, nil, fmt.Errorf("commitment of blob %d of L1 block %s has versioned hash %s, expected %s", sc.Index, id, h, hashes[i])
+		}
+		if err := bs.Verifier.VerifyBlobProof(sc.Blob, sc.KZGCommitment, sc.KZGProof); err != nil {
+			return nil, nil, fmt.Errorf("invalid blob %d of L1 block %s: %w", sc.Index, id, err)
+		}
+		data, err := sc.Blob.ToData()
+		if err != nil {
+			// A malformed blob is still valid on L1: ignore it like malformed calldata
+			rejectedData("malformed_blob").Inc(1)
+			bs.Log.Debug("Dropping malformed blob", "block", id, "index", sc.Index, "err", err)
+			continue
+		}
+		blobData[i] = data
+	}
+
+	var out [][]byte
+	var txHashes []common.Hash
+	next := 0
+	for _, it := range items {
+		if !it.blob {
+			out = append(out, it.data)
+			txHashes = append(txHashes, it.tx)
+			continue
+		}
+		if blobData[next] != nil {
+			out = append(out, blobData[next])
+			txHashes = append(txHashes, it.tx)
+		}
+		next++
+	}
+	return out, txHashes, nil
+}
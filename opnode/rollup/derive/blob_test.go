@@ -0,0 +1,125 @@
+package derive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobEncoding(t *testing.T) {
+	for _, size := range []int{0, 1, 27, 28, 31, 1000, MaxBlobDataSize} {
+		data := bytes.Repeat([]byte{0xab}, size)
+		var b Blob
+		require.NoError(t, b.FromData(data))
+		for i := 0; i < 4096; i++ {
+			require.Zero(t, b[i*32], "first byte of field element %d", i)
+		}
+		out, err := b.ToData()
+		require.NoError(t, err)
+		require.Equal(t, data, out, "size %d", size)
+	}
+
+	var b Blob
+	require.Error(t, b.FromData(make([]byte, MaxBlobDataSize+1)))
+
+	require.NoError(t, b.FromData([]byte{1, 2, 3}))
+	invalid := b
+	invalid[32] = 1
+	_, err := invalid.ToData()
+	require.Error(t, err, "invalid field element")
+	invalid = b
+	invalid[100] = 1
+	_, err = invalid.ToData()
+	require.Error(t, err, "non-zero padding")
+	invalid = b
+	invalid[1] = 1
+	_, err = invalid.ToData()
+	require.Error(t, err, "unknown version")
+}
+
+type testL1Txs struct {
+	info *blobTestL1Info
+	txs  []L1Tx
+}
+
+type blobTestL1Info struct {
+	L1Info
+	time uint64
+}
+
+func (info *blobTestL1Info) Time() uint64 { return info.time }
+
+func (l testL1Txs) InfoAndL1TxsByHash(ctx context.Context, hash common.Hash) (L1Info, []L1Tx, error) {
+	return l.info, l.txs, nil
+}
+
+type testBeacon struct {
+	time     uint64
+	sidecars map[uint64]*BlobSidecar
+}
+
+func (tb *testBeacon) BlobSidecars(ctx context.Context, l1Time uint64, indices []uint64) ([]*BlobSidecar, error) {
+	if l1Time != tb.time {
+		return nil, errors.New("unknown slot")
+	}
+	var out []*BlobSidecar
+	for _, i := range indices {
+		out = append(out, tb.sidecars[i])
+	}
+	return out, nil
+}
+
+func TestBlobDataSource(t *testing.T) {
+	config := &rollup.Config{BatchInboxAddress: common.Address{0xff}}
+	batcher := common.Address{0xba}
+	other := common.Address{0x01}
+
+	kzg, err := LoadKZG()
+	require.NoError(t, err)
+	newSidecar := func(index uint64, data []byte) *BlobSidecar {
+		sc := &BlobSidecar{Index: index, Blob: new(Blob)}
+		require.NoError(t, sc.Blob.FromData(data))
+		sc.KZGCommitment, sc.KZGProof, err = kzg.Commit(sc.Blob)
+		require.NoError(t, err)
+		return sc
+	}
+	beacon := &testBeacon{time: 42, sidecars: map[uint64]*BlobSidecar{
+		0: newSidecar(0, []byte("not batch data")),
+		1: newSidecar(1, []byte("blob a")),
+		2: newSidecar(2, []byte("blob b")),
+	}}
+	hash := func(i uint64) common.Hash { return beacon.sidecars[i].KZGCommitment.VersionedHash() }
+	l1 := testL1Txs{info: &blobTestL1Info{time: 42}, txs: []L1Tx{
+		{Hash: common.Hash{1}, From: other, To: &config.BatchInboxAddress, BlobHashes: []common.Hash{hash(0)}},
+		{Hash: common.Hash{2}, From: batcher, To: &config.BatchInboxAddress, Data: []byte("calldata")},
+		{Hash: common.Hash{3}, From: batcher, To: &config.BatchInboxAddress, BlobHashes: []common.Hash{hash(1), hash(2)}},
+	}}
+	src := &BlobDataSource{Config: config, L1: l1, Beacon: beacon, Verifier: kzg, Log: testlog.Logger(t, log.LvlError)}
+	window := []eth.BlockID{{Number: 1}}
+	data, err := src.BatchData(context.Background(), window, batcher)
+	require.NoError(t, err)
+	require.Equal(t, [][][]byte{{[]byte("calldata"), []byte("blob a"), []byte("blob b")}}, data)
+	_, txs, err := src.BatchDataWithTxs(context.Background(), window, batcher)
+	require.NoError(t, err)
+	require.Equal(t, [][]common.Hash{{{2}, {3}, {3}}}, txs, "the blobs of a transaction have the hash of the transaction")
+
+	good := *beacon.sidecars[2].Blob
+	require.NoError(t, beacon.sidecars[2].Blob.FromData([]byte("blob c")))
+	_, err = src.BatchData(context.Background(), window, batcher)
+	require.Error(t, err, "blob does not match its commitment")
+	require.Contains(t, err.Error(), "invalid blob 2")
+	*beacon.sidecars[2].Blob = good
+
+	beacon.sidecars[1].KZGCommitment[0] = 0xff
+	_, err = src.BatchData(context.Background(), window, batcher)
+	require.Error(t, err, "commitment does not match the blob hash of the tx")
+	require.Contains(t, err.Error(), "versioned hash")
+}
@@ -0,0 +1,430 @@
+package derive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Channel format
+// A bundle of batches that does not fit in a single L1 transaction is split into frames of a channel.
+// The frames are submitted in one or more L1 transactions, possibly across multiple L1 blocks.
+//
+// frame := channel_id ++ frame_number ++ frame_data_length ++ frame_data ++ is_last
+//
+// channel_id        := bytes16, random identifier of the channel
+// frame_number      := uint16, index of the frame within the channel, starting at 0
+// frame_data_length := uint32, length of frame_data
+// frame_data        := bytes
+// is_last           := uint8, 1 if this is the last frame of the channel, 0 otherwise
+//
+// The data of a channel is the concatenation of the data of its frames, and is an encoded batch bundle.
+//
+// L1 transaction data with frames:
+// ChannelFramesType ++ frame ++ frame ++ ...
+//
+// All integers are big-endian.
+
+// ChannelFramesType is the type byte of L1 transaction data that carries channel frames,
+// instead of a batch bundle.
+const ChannelFramesType = BatchBundleV2Type + 1
+
+const (
+	// frameOverhead is the size of a frame, excluding the frame data.
+	frameOverhead = 16 + 2 + 4 + 1
+	// DefaultMaxChannelSize is the maximum size of the data of a channel, if the rollup config does not set it.
+	// Larger channels are dropped.
+	DefaultMaxChannelSize = 10_000_000
+	// maxFrames is the maximum number of frames of a channel.
+	maxFrames = 1 << 16
+	// DefaultMaxOpenChannels is the maximum number of incomplete channels in a channel bank,
+	// if the rollup config does not set it.
+	DefaultMaxOpenChannels = 64
+	// DefaultMaxChannelBankSize is the maximum size of the frame data of the incomplete channels in a channel bank,
+	// if the rollup config does not set it.
+	DefaultMaxChannelBankSize = 100_000_000
+)
+
+// ChannelTimeoutOf returns the channel timeout of the rollup config. If the config does not set it, channels time out
+// after the sequencing window: a channel that starts in the first L1 block of a window may complete in its last block.
+// Configs without a sequencing window, which do not pass rollup.Config.Check, get the max sequencing window.
+func ChannelTimeoutOf(config *rollup.Config) uint64 {
+	if config.ChannelTimeout != 0 {
+		return config.ChannelTimeout
+	}
+	if config.SeqWindowSize != 0 {
+		return config.SeqWindowSize
+	}
+	return rollup.MaxSeqWindowSize
+}
+
+// ChannelLimits are the limits of the channels of a channel bank.
+type ChannelLimits struct {
+	MaxChannelSize  uint64
+	MaxOpenChannels uint64
+	MaxBankSize     uint64
+}
+
+// ChannelLimitsOf returns the channel limits of the rollup config, with the default of each limit that it does not set.
+func ChannelLimitsOf(config *rollup.Config) ChannelLimits {
+	limits := ChannelLimits{
+		MaxChannelSize:  config.MaxChannelSize,
+		MaxOpenChannels: config.MaxOpenChannels,
+		MaxBankSize:     config.MaxChannelBankSize,
+	}
+	if limits.MaxChannelSize == 0 {
+		limits.MaxChannelSize = DefaultMaxChannelSize
+	}
+	if limits.MaxOpenChannels == 0 {
+		limits.MaxOpenChannels = DefaultMaxOpenChannels
+	}
+	if limits.MaxBankSize == 0 {
+		limits.MaxBankSize = DefaultMaxChannelBankSize
+	}
+	return limits
+}
+
+type ChannelID [16]byte
+
+func (id ChannelID) String() string {
+	return hexutil.Encode(id[:])
+}
+
+func (id ChannelID) MarshalText() ([]byte, error) {
+	return []byte(hexutil.Encode(id[:])), nil
+}
+
+func (id *ChannelID) UnmarshalText(text []byte) error {
+	return hexutil.UnmarshalFixedText("ChannelID", text, id[:])
+}
+
+type Frame struct {
+	ID          ChannelID
+	FrameNumber uint16
+	Data        []byte
+	IsLast      bool
+}
+
+// MarshalBinary returns the encoding of the frame.
+func (f *Frame) MarshalBinary() ([]byte, error) {
+	if uint64(len(f.Data)) > uint64(^uint32(0)) {
+		return nil, fmt.Errorf("frame data too large: %d", len(f.Data))
+	}
+	out := make([]byte, frameOverhead+len(f.Data))
+	copy(out, f.ID[:])
+	binary.BigEndian.PutUint16(out[16:], f.FrameNumber)
+	binary.BigEndian.PutUint32(out[18:], uint32(len(f.Data)))
+	copy(out[22:], f.Data)
+	if f.IsLast {
+		out[len(out)-1] = 1
+	}
+	return out, nil
+}
+
+// unmarshalFrame decodes a single frame from the reader.
+func unmarshalFrame(r *bytes.Reader) (*Frame, error) {
+	var f Frame
+	if _, err := io.ReadFull(r, f.ID[:]); err != nil {
+		return nil, fmt.Errorf("failed to read channel id: %w", err)
+	}
+	var header [6]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read frame header: %w", err)
+	}
+	f.FrameNumber = binary.BigEndian.Uint16(header[:2])
+	length := binary.BigEndian.Uint32(header[2:])
+	if uint64(length) > uint64(r.Len()) {
+		return nil, fmt.Errorf("frame data length %d exceeds remaining data %d", length, r.Len())
+	}
+	f.Data = make([]byte, length)
+	if _, err := io.ReadFull(r, f.Data); err != nil {
+		return nil, fmt.Errorf("failed to read frame data: %w", err)
+	}
+	isLast, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read is_last flag: %w", err)
+	}
+	switch isLast {
+	case 0:
+	case 1:
+		f.IsLast = true
+	default:
+		return nil, fmt.Errorf("invalid is_last flag: %d", isLast)
+	}
+	return &f, nil
+}
+
+// ParseFrames decodes the frames of L1 transaction data of the ChannelFramesType.
+// Frames are all or nothing: if any frame is malformed, none of the frames are returned.
+func ParseFrames(data []byte) ([]*Frame, error) {
+	if len(data) == 0 || data[0] != ChannelFramesType {
+		return nil, errors.New("data is not of the channel frames type")
+	}
+	r := bytes.NewReader(data[1:])
+	var frames []*Frame
+	for r.Len() > 0 {
+		f, err := unmarshalFrame(r)
+		if err != nil {
+			return nil, fmt.Errorf("malformed frame %d: %w", len(frames), err)
+		}
+		frames = append(frames, f)
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("no frames")
+	}
+	return frames, nil
+}
+
+// ChannelFrames splits the channel data into frames, and returns the L1 transaction data of each frame.
+// Each transaction data is at most maxTxDataSize bytes. The channel data must be within the max channel size of the config.
+func ChannelFrames(config *rollup.Config, id ChannelID, data []byte, maxTxDataSize int) ([][]byte, error) {
+	maxFrameData := maxTxDataSize - 1 - frameOverhead
+	if maxFrameData <= 0 {
+		return nil, fmt.Errorf("max transaction data size %d is too small for a frame", maxTxDataSize)
+	}
+	if maxSize := ChannelLimitsOf(config).MaxChannelSize; uint64(len(data)) > maxSize {
+		return nil, fmt.Errorf("channel data of %d bytes exceeds max channel size %d", len(data), maxSize)
+	}
+	var out [][]byte
+	for i := 0; ; i++ {
+		if i >= maxFrames {
+			return nil, fmt.Errorf("channel data of %d bytes needs more than %d frames", len(data), maxFrames)
+		}
+		n := len(data)
+		if n > maxFrameData {
+			n = maxFrameData
+		}
+		f := Frame{ID: id, FrameNumber: uint16(i), Data: data[:n], IsLast: n == len(data)}
+		enc, err := f.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, append([]byte{ChannelFramesType}, enc...))
+		data = data[n:]
+		if f.IsLast {
+			return out, nil
+		}
+	}
+}
+
+type channel struct {
+	id ChannelID
+	// openedAt is the L1 block of the first frame of the channel
+	openedAt uint64
+	frames   map[uint16][]byte
+	size     uint64
+	// highest is the highest frame number that was received
+	highest uint16
+	// lastFrame is the number of the last frame, if it was received
+	lastFrame *uint16
+	// positions are the positions of the data items with the frames of the channel, in the order they were received
+	positions []DataPosition
+}
+
+// complete returns true if all frames up to and including the last frame were received.
+func (c *channel) complete() bool {
+	return c.lastFrame != nil && len(c.frames) == int(*c.lastFrame)+1
+}
+
+func (c *channel) data() []byte {
+	out := make([]byte, 0, c.size)
+	for i := 0; i <= int(*c.lastFrame); i++ {
+		out = append(out, c.frames[uint16(i)]...)
+	}
+	return out
+}
+
+// reader reads the data of the channel from its frames, without copying the frames into a single buffer.
+func (c *channel) reader() io.Reader {
+	readers := make([]io.Reader, 0, int(*c.lastFrame)+1)
+	for i := 0; i <= int(*c.lastFrame); i++ {
+		readers = append(readers, bytes.NewReader(c.frames[uint16(i)]))
+	}
+	return io.MultiReader(readers...)
+}
+
+// ChannelBank reassembles channels from frames, which may arrive out of order and across multiple L1 blocks.
+// The data of a channel is available once all of its frames arrived, in the order in which channels complete.
+//
+// Channels that do not complete in time are dropped: a channel times out after the given number of L1 blocks
+// since its first frame, and the oldest channels are evicted when there are more than the max open channels,
+// or more than the max bank size of frame data in the bank, see ChannelLimits. Eviction only depends on the order of the frames,
+// so every verifier drops the same channels.
+type ChannelBank struct {
+	timeout uint64
+	limits  ChannelLimits
+	l1Block uint64
+	item    int
+	// open channels, and the order in which they were opened
+	channels map[ChannelID]*channel
+	order    []ChannelID
+	size     uint64
+	// closed channels were completed or dropped, by the L1 block they were closed at: any more frames of them
+	// are ignored. They are kept for the channel timeout, in the order they were closed in closedOrder.
+	closed      map[ChannelID]uint64
+	closedOrder []closedChannel
+	ready       []*channel
+	// quiet disables the metrics of dropped and undecodable channels, while frames that were already counted are ingested again
+	quiet bool
+}
+
+// NewChannelBank creates a channel bank, with the channel timeout and the channel limits of the rollup config.
+func NewChannelBank(config *rollup.Config) *ChannelBank {
+	return &ChannelBank{
+		timeout:  ChannelTimeoutOf(config),
+		limits:   ChannelLimitsOf(config),
+		channels: make(map[ChannelID]*channel),
+		closed:   make(map[ChannelID]uint64),
+	}
+}
+
+type closedChannel struct {
+	id ChannelID
+	at uint64
+}
+
+// NextL1Block sets the L1 block of the frames that are ingested next, and drops the channels that timed out.
+// The closed channels are forgotten after the channel timeout: a frame of a channel that was opened before then
+// is dropped with a new channel that times out, like the frames of any other incomplete channel.
+func (cb *ChannelBank) NextL1Block(number uint64) {
+	cb.l1Block = number
+	for len(cb.order) > 0 {
+		ch := cb.channels[cb.order[0]]
+		if ch.openedAt+cb.timeout >= number {
+			break
+		}
+		cb.dropInvalid(ch.id, "timeout")
+	}
+	for len(cb.closedOrder) > 0 && cb.closedOrder[0].at+cb.timeout < number {
+		c := cb.closedOrder[0]
+		if at, ok := cb.closed[c.id]; ok && at == c.at {
+			delete(cb.closed, c.id)
+		}
+		cb.closedOrder = cb.closedOrder[1:]
+	}
+}
+
+// NextItem sets the index of the item of batch data, in the current L1 block, of the frames that are ingested next.
+// It is only used to track the positions of the frames of a channel.
+func (cb *ChannelBank) NextItem(item int) {
+	cb.item = item
+}
+
+// IngestFrame adds a frame to its channel. Duplicate frames are ignored, the first frame is kept.
+// It returns an error if the frame is invalid for its channel, the channel is dropped in that case.
+func (cb *ChannelBank) IngestFrame(f *Frame) error {
+	if _, ok := cb.closed[f.ID]; ok {
+		return nil
+	}
+	ch, ok := cb.channels[f.ID]
+	if !ok {
+		ch = &channel{id: f.ID, openedAt: cb.l1Block, frames: make(map[uint16][]byte)}
+		cb.channels[f.ID] = ch
+		cb.order = append(cb.order, f.ID)
+	}
+	if _, ok := ch.frames[f.FrameNumber]; ok {
+		return nil
+	}
+	if f.IsLast {
+		if ch.lastFrame != nil {
+			cb.dropInvalid(f.ID, "invalid")
+			return fmt.Errorf("channel %s has multiple last frames: %d and %d", f.ID, *ch.lastFrame, f.FrameNumber)
+		}
+		if len(ch.frames) > 0 && ch.highest > f.FrameNumber {
+			cb.dropInvalid(f.ID, "invalid")
+			return fmt.Errorf("frame %d of channel %s is after the last frame %d", ch.highest, f.ID, f.FrameNumber)
+		}
+		n := f.FrameNumber
+		ch.lastFrame = &n
+	} else if ch.lastFrame != nil && f.FrameNumber > *ch.lastFrame {
+		cb.dropInvalid(f.ID, "invalid")
+		return fmt.Errorf("frame %d of channel %s is after the last frame %d", f.FrameNumber, f.ID, *ch.lastFrame)
+	}
+	if ch.size+uint64(len(f.Data)) > cb.limits.MaxChannelSize {
+		cb.dropInvalid(f.ID, "oversize")
+		return fmt.Errorf("channel %s exceeds max channel size %d", f.ID, cb.limits.MaxChannelSize)
+	}
+	ch.size += uint64(len(f.Data))
+	cb.size += uint64(len(f.Data))
+	ch.frames[f.FrameNumber] = f.Data
+	if pos := (DataPosition{Block: int(cb.l1Block), Item: cb.item}); len(ch.positions) == 0 || ch.positions[len(ch.positions)-1] != pos {
+		ch.positions = append(ch.positions, pos)
+	}
+	if f.FrameNumber > ch.highest {
+		ch.highest = f.FrameNumber
+	}
+	if ch.complete() {
+		cb.ready = append(cb.ready, ch)
+		cb.drop(f.ID)
+		return nil
+	}
+	// Evict the oldest channels if the bank is full. This may evict the channel of the frame itself.
+	for uint64(len(cb.order)) > cb.limits.MaxOpenChannels || cb.size > cb.limits.MaxBankSize {
+		cb.dropInvalid(cb.order[0], "evicted")
+	}
+	return nil
+}
+
+// dropInvalid drops a channel before it completes, and counts it by the reason it is dropped for.
+func (cb *ChannelBank) dropInvalid(id ChannelID, reason string) {
+	if !cb.quiet {
+		droppedChannels(reason).Inc(1)
+	}
+	cb.drop(id)
+}
+
+func (cb *ChannelBank) drop(id ChannelID) {
+	if ch, ok := cb.channels[id]; ok {
+		cb.size -= ch.size
+		delete(cb.channels, id)
+		for i, openID := range cb.order {
+			if openID == id {
+				cb.order = append(cb.order[:i], cb.order[i+1:]...)
+				break
+			}
+		}
+	}
+	cb.closed[id] = cb.l1Block
+	cb.closedOrder = append(cb.closedOrder, closedChannel{id: id, at: cb.l1Block})
+}
+
+// droppedChannels counts the channels that are dropped before they complete, by the reason they are dropped for:
+// timeout, evicted, invalid (inconsistent frames) or oversize.
+func droppedChannels(reason string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("derive/channels/dropped/"+reason, nil)
+}
+
+// Read returns the data of the next completed channel, or false if there is none.
+func (cb *ChannelBank) Read() ([]byte, bool) {
+	if len(cb.ready) == 0 {
+		return nil, false
+	}
+	ch := cb.ready[0]
+	cb.ready = cb.ready[1:]
+	return ch.data(), true
+}
+
+// ReadChannel returns a reader of the data of the next completed channel, or false if there is none.
+// Unlike Read, the frames of the channel are not copied into a single buffer.
+func (cb *ChannelBank) ReadChannel() (io.Reader, bool) {
+	ch, ok := cb.nextChannel()
+	if !ok {
+		return nil, false
+	}
+	return ch.reader(), true
+}
+
+func (cb *ChannelBank) nextChannel() (*channel, bool) {
+	if len(cb.ready) == 0 {
+		return nil, false
+	}
+	ch := cb.ready[0]
+	cb.ready = cb.ready[1:]
+	return ch, true
+}
@@ -0,0 +1,426 @@
+package derive
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	frames := []*Frame{
+		{ID: ChannelID{1}, FrameNumber: 0, Data: []byte{}},
+		{ID: ChannelID{2}, FrameNumber: 7, Data: []byte{0xaa, 0xbb}, IsLast: true},
+	}
+	data := []byte{ChannelFramesType}
+	for _, f := range frames {
+		enc, err := f.MarshalBinary()
+		require.NoError(t, err)
+		data = append(data, enc...)
+	}
+	dec, err := ParseFrames(data)
+	require.NoError(t, err)
+	require.Equal(t, frames, dec)
+
+	_, err = ParseFrames(data[:len(data)-1])
+	require.Error(t, err, "truncated frame")
+	_, err = ParseFrames([]byte{ChannelFramesType})
+	require.Error(t, err, "no frames")
+	_, err = ParseFrames([]byte{BatchBundleV1Type, 0})
+	require.Error(t, err, "not frames")
+}
+
+func TestChannelBank(t *testing.T) {
+	id := ChannelID{0xc0}
+	data := bytes.Repeat([]byte("channel data "), 10)
+	txs, err := ChannelFrames(&rollup.Config{}, id, data, 1+frameOverhead+50)
+	require.NoError(t, err)
+	require.Len(t, txs, 3)
+
+	var frames []*Frame
+	for _, tx := range txs {
+		require.LessOrEqual(t, len(tx), 1+frameOverhead+50)
+		f, err := ParseFrames(tx)
+		require.NoError(t, err)
+		require.Len(t, f, 1)
+		frames = append(frames, f[0])
+	}
+
+	t.Run("out of order", func(t *testing.T) {
+		bank := NewChannelBank(&rollup.Config{})
+		require.NoError(t, bank.IngestFrame(frames[2]))
+		require.NoError(t, bank.IngestFrame(frames[0]))
+		_, ok := bank.Read()
+		require.False(t, ok, "incomplete channel")
+		require.NoError(t, bank.IngestFrame(frames[0]), "duplicate frame is ignored")
+		require.NoError(t, bank.IngestFrame(frames[1]))
+		out, ok := bank.Read()
+		require.True(t, ok)
+		require.Equal(t, data, out)
+		require.NoError(t, bank.IngestFrame(frames[1]), "frame of a completed channel is ignored")
+		_, ok = bank.Read()
+		require.False(t, ok)
+	})
+	t.Run("frame after last", func(t *testing.T) {
+		bank := NewChannelBank(&rollup.Config{})
+		require.NoError(t, bank.IngestFrame(frames[2]))
+		require.Error(t, bank.IngestFrame(&Frame{ID: id, FrameNumber: 3}))
+		require.NoError(t, bank.IngestFrame(frames[0]), "dropped channel is ignored")
+		require.NoError(t, bank.IngestFrame(frames[1]))
+		_, ok := bank.Read()
+		require.False(t, ok)
+	})
+	t.Run("multiple last frames", func(t *testing.T) {
+		bank := NewChannelBank(&rollup.Config{})
+		require.NoError(t, bank.IngestFrame(frames[2]))
+		require.Error(t, bank.IngestFrame(&Frame{ID: id, FrameNumber: 1, IsLast: true}))
+	})
+}
+
+func TestBatchesFromChannelFrames(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	config := &rollup.Config{
+		L1ChainID:          big.NewInt(900),
+		BatchInboxAddress:  [20]byte{0xff},
+		BatchSenderAddress: crypto.PubkeyToAddress(key.PublicKey),
+	}
+	batches := []*BatchData{
+		{BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{bytes.Repeat([]byte{1}, 100)}}},
+		{BatchV1{Epoch: 1, Timestamp: 4, Transactions: []hexutil.Bytes{bytes.Repeat([]byte{2}, 100)}}},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, EncodeBatches(config, batches, &buf))
+	frames, err := ChannelFrames(&rollup.Config{}, ChannelID{1}, buf.Bytes(), 100)
+	require.NoError(t, err)
+	require.Greater(t, len(frames), 2)
+
+	signer := config.L1Signer()
+	nonce := uint64(0)
+	newTx := func(data []byte) *types.Transaction {
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{ChainID: config.L1ChainID, Nonce: nonce, To: &config.BatchInboxAddress, Data: data})
+		require.NoError(t, err)
+		nonce++
+		return tx
+	}
+	// The frames span two L1 blocks, with the last frame in the first block
+	var first, second types.Transactions
+	first = append(first, newTx(frames[len(frames)-1]))
+	for _, f := range frames[:len(frames)-1] {
+		second = append(second, newTx(f))
+	}
+
+	out, err := BatchesFromEVMTransactions(config, config.BatchSenderAddress, []types.Transactions{first, second}, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Equal(t, batches, out)
+
+	out, err = BatchesFromEVMTransactions(config, config.BatchSenderAddress, []types.Transactions{second}, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Empty(t, out, "incomplete channel")
+
+	config.ChannelTimeout = 1
+	out, err = BatchesFromEVMTransactions(config, config.BatchSenderAddress, []types.Transactions{first, second}, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Equal(t, batches, out, "channel completes within the timeout")
+	out, err = BatchesFromEVMTransactions(config, config.BatchSenderAddress, []types.Transactions{first, {}, second}, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Empty(t, out, "channel timed out")
+}
+
+func TestChannelBankReadChannel(t *testing.T) {
+	bank := NewChannelBank(&rollup.Config{})
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{1}, FrameNumber: 1, Data: []byte("world"), IsLast: true}))
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{1}, FrameNumber: 0, Data: []byte("hello ")}))
+	r, ok := bank.ReadChannel()
+	require.True(t, ok)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), data)
+	_, ok = bank.ReadChannel()
+	require.False(t, ok)
+}
+
+func TestChannelBankTimeout(t *testing.T) {
+	bank := NewChannelBank(&rollup.Config{ChannelTimeout: 2})
+	bank.NextL1Block(10)
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{1}, FrameNumber: 0, Data: []byte("a")}))
+	bank.NextL1Block(11)
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{2}, FrameNumber: 0, Data: []byte("b")}))
+	bank.NextL1Block(12)
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{1}, FrameNumber: 1, Data: []byte("a"), IsLast: true}))
+	data, ok := bank.Read()
+	require.True(t, ok, "channel completes at the timeout")
+	require.Equal(t, []byte("aa"), data)
+
+	bank.NextL1Block(14)
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{2}, FrameNumber: 1, Data: []byte("b"), IsLast: true}))
+	_, ok = bank.Read()
+	require.False(t, ok, "channel timed out")
+}
+
+func TestChannelBankClosedTimeout(t *testing.T) {
+	bank := NewChannelBank(&rollup.Config{ChannelTimeout: 2})
+	bank.NextL1Block(10)
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{1}, FrameNumber: 0, Data: []byte("a"), IsLast: true}))
+	_, ok := bank.Read()
+	require.True(t, ok)
+	bank.NextL1Block(12)
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{1}, FrameNumber: 0, Data: []byte("a"), IsLast: true}))
+	_, ok = bank.Read()
+	require.False(t, ok, "frames of a closed channel are ignored within the timeout")
+
+	bank.NextL1Block(13)
+	require.Empty(t, bank.closed, "closed channel is forgotten after the timeout")
+
+	// Many channels over many L1 blocks: only the channels closed within the timeout are kept
+	for n := uint64(100); n < 1100; n++ {
+		bank.NextL1Block(n)
+		for i := 0; i < 10; i++ {
+			id := ChannelID{byte(n), byte(n >> 8), byte(i)}
+			require.NoError(t, bank.IngestFrame(&Frame{ID: id, FrameNumber: 0, IsLast: i%2 == 0}))
+		}
+		require.LessOrEqual(t, len(bank.closed), 10*3)
+		require.LessOrEqual(t, len(bank.closedOrder), 10*3)
+	}
+}
+
+func TestChannelBankDefaultTimeout(t *testing.T) {
+	require.Equal(t, uint64(4), ChannelTimeoutOf(&rollup.Config{SeqWindowSize: 4}))
+	require.Equal(t, uint64(2), ChannelTimeoutOf(&rollup.Config{SeqWindowSize: 4, ChannelTimeout: 2}))
+
+	// Without a channel timeout in the config, the closed channels are still forgotten
+	bank := NewChannelBank(&rollup.Config{SeqWindowSize: 4})
+	for n := uint64(0); n < 1000; n++ {
+		bank.NextL1Block(n)
+		require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{byte(n), byte(n >> 8)}, FrameNumber: 0, IsLast: true}))
+		require.LessOrEqual(t, len(bank.closed), 5)
+	}
+}
+
+func TestChannelBankEviction(t *testing.T) {
+	bank := NewChannelBank(&rollup.Config{})
+	for i := 0; i <= DefaultMaxOpenChannels; i++ {
+		require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{byte(i)}, FrameNumber: 0, Data: []byte{byte(i)}}))
+	}
+	// The first channel was evicted, the others are still open
+	for i := 0; i <= DefaultMaxOpenChannels; i++ {
+		require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{byte(i)}, FrameNumber: 1, IsLast: true}))
+		data, ok := bank.Read()
+		require.Equal(t, i > 0, ok, "channel %d", i)
+		if ok {
+			require.Equal(t, []byte{byte(i)}, data)
+		}
+	}
+
+	// The oldest channels are evicted when the bank exceeds its max size
+	bank = NewChannelBank(&rollup.Config{})
+	large := make([]byte, DefaultMaxChannelSize)
+	n := DefaultMaxChannelBankSize / DefaultMaxChannelSize
+	for i := 0; i < n; i++ {
+		require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{byte(i)}, FrameNumber: 0, Data: large}))
+	}
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{byte(n)}, FrameNumber: 0, Data: []byte{1}}))
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{0}, FrameNumber: 1, IsLast: true}))
+	_, ok := bank.Read()
+	require.False(t, ok, "oldest channel was evicted")
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{1}, FrameNumber: 1, IsLast: true}))
+	_, ok = bank.Read()
+	require.True(t, ok)
+
+	// The limits of the rollup config replace the defaults
+	bank = NewChannelBank(&rollup.Config{MaxChannelSize: 10, MaxOpenChannels: 2})
+	require.Error(t, bank.IngestFrame(&Frame{ID: ChannelID{0}, FrameNumber: 0, Data: make([]byte, 11)}), "oversize channel")
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{byte(i)}, FrameNumber: 0, Data: []byte{byte(i)}}))
+	}
+	require.NoError(t, bank.IngestFrame(&Frame{ID: ChannelID{1}, FrameNumber: 1, IsLast: true}))
+	_, ok = bank.Read()
+	require.False(t, ok, "evicted by the third open channel")
+}
+
+func TestBatchOrdering(t *testing.T) {
+	config := &rollup.Config{BlockTime: 2}
+	batch := func(timestamp uint64, tx byte) *BatchData {
+		return &BatchData{BatchV1{Epoch: 1, Timestamp: timestamp, Transactions: []hexutil.Bytes{{tx}}}}
+	}
+	bundle := func(batches ...*BatchData) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeBatches(config, batches, &buf))
+		return buf.Bytes()
+	}
+	// frames returns the L1 transaction data of the given frames of a channel with the given bundle,
+	// with the data of each frame being a part of the bundle of the given size.
+	frames := func(id ChannelID, data []byte, size int, numbers ...int) []byte {
+		out := []byte{ChannelFramesType}
+		last := (len(data) - 1) / size
+		for _, n := range numbers {
+			end := (n + 1) * size
+			if end > len(data) {
+				end = len(data)
+			}
+			f := Frame{ID: id, FrameNumber: uint16(n), Data: data[n*size : end], IsLast: n == last}
+			enc, err := f.MarshalBinary()
+			require.NoError(t, err)
+			out = append(out, enc...)
+		}
+		return out
+	}
+	a, b, c := batch(2, 0xa), batch(4, 0xb), batch(6, 0xc)
+	a2, b2 := batch(2, 0xa2), batch(4, 0xb2)
+	chA := bundle(a, b)
+	chB := bundle(a2, b2, c)
+	size := len(chA)/3 + 1  // 3 frames
+	sizeB := len(chB)/4 + 1 // 4 frames
+
+	testCases := []struct {
+		name     string
+		blocks   [][][]byte
+		expected []*BatchData
+	}{
+		{
+			name:     "bundles by transaction index",
+			blocks:   [][][]byte{{bundle(a2), bundle(a, b)}},
+			expected: []*BatchData{a2, a, b},
+		},
+		{
+			name:     "bundles by block",
+			blocks:   [][][]byte{{bundle(b2)}, {bundle(a)}},
+			expected: []*BatchData{b2, a},
+		},
+		{
+			name:     "frames across transactions",
+			blocks:   [][][]byte{{frames(ChannelID{1}, chA, size, 2), frames(ChannelID{1}, chA, size, 0, 1)}},
+			expected: []*BatchData{a, b},
+		},
+		{
+			name: "channel by completing frame",
+			blocks: [][][]byte{{
+				frames(ChannelID{1}, chA, size, 0),
+				frames(ChannelID{2}, chB, sizeB, 0, 1, 2, 3),
+				frames(ChannelID{1}, chA, size, 1, 2),
+			}},
+			expected: []*BatchData{a2, b2, c, a, b},
+		},
+		{
+			name: "interleaved channels in a transaction",
+			blocks: [][][]byte{{
+				append(frames(ChannelID{2}, chB, sizeB, 3, 2, 1), frames(ChannelID{1}, chA, size, 0, 1, 2)[1:]...),
+				frames(ChannelID{2}, chB, sizeB, 0),
+			}},
+			expected: []*BatchData{a, b, a2, b2, c},
+		},
+		{
+			name: "channel before bundle",
+			blocks: [][][]byte{
+				{frames(ChannelID{1}, chA, size, 0, 1)},
+				{bundle(a2, c), frames(ChannelID{1}, chA, size, 2)},
+			},
+			expected: []*BatchData{a2, c, a, b},
+		},
+		{
+			name: "duplicate frame keeps the first frame",
+			blocks: [][][]byte{{
+				frames(ChannelID{1}, chA, size, 0),
+				frames(ChannelID{1}, bytes.Repeat([]byte{0xff}, len(chA)), size, 1),
+				frames(ChannelID{1}, chA, size, 1, 2),
+			}},
+			expected: nil, // the channel data is invalid, the second frame is garbage
+		},
+		{
+			name: "duplicate frame after completion is ignored",
+			blocks: [][][]byte{{
+				frames(ChannelID{1}, chA, size, 0, 1, 2),
+				frames(ChannelID{1}, bytes.Repeat([]byte{0xff}, len(chA)), size, 1),
+			}},
+			expected: []*BatchData{a, b},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			out, err := BatchesFromData(config, testCase.blocks, testlog.Logger(t, log.LvlError))
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, out)
+			// derivation is repeatable, independent of any state of a previous derivation
+			again, err := BatchesFromData(config, testCase.blocks, testlog.Logger(t, log.LvlError))
+			require.NoError(t, err)
+			require.Equal(t, out, again)
+		})
+	}
+
+	// The positions of the data of each batch are tracked: the bundle, or the frames of the channel
+	out, positions, err := BatchesWithPositions(config, [][][]byte{
+		{frames(ChannelID{1}, chA, size, 0), bundle(a2)},
+		{frames(ChannelID{1}, chA, size, 1, 2)},
+	}, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Equal(t, []*BatchData{a2, a, b}, out)
+	require.Equal(t, []DataPosition{{Block: 0, Item: 1}}, positions[out[0]])
+	require.Equal(t, []DataPosition{{Block: 0, Item: 0}, {Block: 1, Item: 0}}, positions[out[1]])
+	require.Equal(t, positions[out[1]], positions[out[2]])
+
+	// Of conflicting batches for the same L2 block, the first in the order of the batch data persists
+	out, err = BatchesFromData(config, [][][]byte{{bundle(a2), frames(ChannelID{1}, chA, size, 0, 1, 2)}, {bundle(b2)}}, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	filtered := FilterBatches(config, 1, 2, 10, out, nil, testlog.Logger(t, log.LvlError))
+	require.Equal(t, []*BatchData{a2, b}, filtered)
+}
+
+func TestRejectedDataMetrics(t *testing.T) {
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = false }()
+	names := []string{
+		"derive/rejected/malformed_frames",
+		"derive/rejected/invalid_frame",
+		"derive/rejected/undecodable_bundle",
+		"derive/rejected/undecodable_channel",
+		"derive/channels/dropped/invalid",
+		"derive/channels/dropped/oversize",
+	}
+	for _, name := range names {
+		metrics.DefaultRegistry.Unregister(name)
+	}
+
+	frame := func(frames ...Frame) []byte {
+		out := []byte{ChannelFramesType}
+		for _, f := range frames {
+			enc, err := f.MarshalBinary()
+			require.NoError(t, err)
+			out = append(out, enc...)
+		}
+		return out
+	}
+	blocks := [][][]byte{{
+		{ChannelFramesType, 0x01},       // malformed frames
+		{BatchBundleV1Type, 0xff, 0xff}, // undecodable bundle
+		frame(Frame{ID: ChannelID{1}, Data: []byte{BatchBundleV1Type, 0xff, 0xff}, IsLast: true}), // undecodable channel
+		frame(
+			Frame{ID: ChannelID{2}, FrameNumber: 1, IsLast: true},
+			Frame{ID: ChannelID{2}, FrameNumber: 2}, // invalid frame, after the last frame
+		),
+		frame(Frame{ID: ChannelID{3}, Data: make([]byte, DefaultMaxChannelSize+1)}), // invalid frame, oversize channel
+	}}
+	out, err := BatchesFromData(&rollup.Config{}, blocks, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Empty(t, out)
+
+	counts := map[string]int64{
+		"derive/rejected/malformed_frames":    1,
+		"derive/rejected/invalid_frame":       2,
+		"derive/rejected/undecodable_bundle":  1,
+		"derive/rejected/undecodable_channel": 1,
+		"derive/channels/dropped/invalid":     1,
+		"derive/channels/dropped/oversize":    1,
+	}
+	for name, count := range counts {
+		require.Equal(t, count, metrics.GetOrRegisterCounter(name, nil).Count(), name)
+	}
+}
@@ -0,0 +1,151 @@
+package derive
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// DataSource provides the batch data of a window of L1 blocks: for each L1 block of the window,
+// the items of data submitted by the batcher, in the order of submission.
+// Each item is a batch bundle, or a set of channel frames, as decoded by BatchesFromData.
+type DataSource interface {
+	BatchData(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, error)
+}
+
+// BatchTxSource is a DataSource that also identifies the L1 transaction of each item of batch data.
+type BatchTxSource interface {
+	DataSource
+	// BatchDataWithTxs returns the batch data like BatchData, and the hash of the L1 transaction of each item.
+	BatchDataWithTxs(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, [][]common.Hash, error)
+}
+
+// TransactionsFetcher fetches the transactions of a window of L1 blocks.
+type TransactionsFetcher interface {
+	FetchAllTransactions(ctx context.Context, window []eth.BlockID) ([]types.Transactions, error)
+}
+
+// CalldataSource is the DataSource of batch data submitted as calldata of L1 transactions to the batch inbox.
+type CalldataSource struct {
+	Config  *rollup.Config
+	Fetcher TransactionsFetcher
+	Log     log.Logger
+}
+
+var _ BatchTxSource = (*CalldataSource)(nil)
+
+func (cs *CalldataSource) BatchData(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, error) {
+	data, _, err := cs.BatchDataWithTxs(ctx, window, batcherAddr)
+	return data, err
+}
+
+func (cs *CalldataSource) BatchDataWithTxs(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, [][]common.Hash, error) {
+	txLists, err := cs.Fetcher.FetchAllTransactions(ctx, window)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch transactions of %s: %w", window, err)
+	}
+	data, txs := dataFromEVMTransactions(cs.Config, batcherAddr, txLists, cs.Log)
+	return data, txs, nil
+}
+
+// DataFromEVMTransactions returns the data of the batch submitter transactions in each of the given L1 transaction lists,
+// the transactions to the batch inbox that are sent by the given batcher address.
+func DataFromEVMTransactions(config *rollup.Config, batcherAddr common.Address, txLists []types.Transactions, log log.Logger) [][][]byte {
+	out, _ := dataFromEVMTransactions(config, batcherAddr, txLists, log)
+	return out
+}
+
+// dataFromEVMTransactions returns the data of the batch submitter transactions like DataFromEVMTransactions,
+// and the hashes of the transactions.
+func dataFromEVMTransactions(config *rollup.Config, batcherAddr common.Address, txLists []types.Transactions, log log.Logger) ([][][]byte, [][]common.Hash) {
+	out := make([][][]byte, len(txLists))
+	hashes := make([][]common.Hash, len(txLists))
+	l1Signer := config.L1Signer()
+	for i, txs := range txLists {
+		for _, tx := range txs {
+			if to := tx.To(); to != nil && *to == config.BatchInboxAddress {
+				seqDataSubmitter, err := l1Signer.Sender(tx) // optimization: only derive sender if To is correct
+				if err != nil {
+					droppedInboxTxs("invalid_signature").Inc(1)
+					log.Debug("Dropping batch inbox transaction with an invalid signature", "tx", tx.Hash(), "err", err)
+					continue // bad signature, ignore
+				}
+				// some random L1 user might have sent a transaction to our batch inbox, ignore them
+				if seqDataSubmitter != batcherAddr {
+					droppedInboxTxs("unauthorized_sender").Inc(1)
+					log.Debug("Dropping batch inbox transaction of an unauthorized sender", "tx", tx.Hash(), "sender", seqDataSubmitter)
+					continue // not an authorized batch submitter, ignore
+				}
+				out[i] = append(out[i], tx.Data())
+				hashes[i] = append(hashes[i], tx.Hash())
+			}
+		}
+	}
+	return out, hashes
+}
+
+// droppedInboxTxs counts the transactions to the batch inbox that are dropped, by the reason they are dropped for.
+func droppedInboxTxs(reason string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("derive/inbox/dropped/"+reason, nil)
+}
+
+// FileDataSource is a DataSource that reads the batch data from files in a directory, for testing.
+// The batch data of a L1 block is read from the file named after the L1 block number,
+// with an item of hex-encoded batch data per line. L1 blocks without a file have no batch data.
+// The batcher address is ignored: all batch data in the files is considered to be submitted by the batcher.
+type FileDataSource struct {
+	// Config limits the size of the channel data of a line
+	Config *rollup.Config
+	Dir    string
+}
+
+var _ DataSource = (*FileDataSource)(nil)
+
+func (fs *FileDataSource) BatchData(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, error) {
+	out := make([][][]byte, len(window))
+	for i, id := range window {
+		data, err := fs.readBlockData(id.Number)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch data of L1 block %s: %w", id, err)
+		}
+		out[i] = data
+	}
+	return out, nil
+}
+
+func (fs *FileDataSource) readBlockData(number uint64) ([][]byte, error) {
+	f, err := os.Open(filepath.Join(fs.Dir, strconv.FormatUint(number, 10)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 2*int(ChannelLimitsOf(fs.Config).MaxChannelSize)+3)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		data, err := hexutil.Decode(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch data item %d: %w", len(out), err)
+		}
+		out = append(out, data)
+	}
+	return out, scanner.Err()
+}
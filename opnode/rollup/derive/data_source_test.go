@@ -0,0 +1,102 @@
+package derive
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+type txListsFetcher map[common.Hash]types.Transactions
+
+func (f txListsFetcher) FetchAllTransactions(ctx context.Context, window []eth.BlockID) ([]types.Transactions, error) {
+	out := make([]types.Transactions, len(window))
+	for i, id := range window {
+		out[i] = f[id.Hash]
+	}
+	return out, nil
+}
+
+func TestCalldataSource(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	other, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	config := &rollup.Config{
+		L1ChainID:         big.NewInt(900),
+		BatchInboxAddress: common.Address{0xff},
+	}
+	signer := config.L1Signer()
+	batcher := crypto.PubkeyToAddress(key.PublicKey)
+	sign := func(k *ecdsa.PrivateKey, to common.Address, data []byte) *types.Transaction {
+		tx, err := types.SignNewTx(k, signer, &types.DynamicFeeTx{ChainID: config.L1ChainID, To: &to, Data: data})
+		require.NoError(t, err)
+		return tx
+	}
+	fetcher := txListsFetcher{
+		{1}: {sign(key, config.BatchInboxAddress, []byte{1}), sign(other, config.BatchInboxAddress, []byte{2})},
+		{2}: {sign(key, common.Address{0xaa}, []byte{3}), sign(key, config.BatchInboxAddress, []byte{4})},
+	}
+	src := &CalldataSource{Config: config, Fetcher: fetcher, Log: testlog.Logger(t, log.LvlError)}
+	data, err := src.BatchData(context.Background(), []eth.BlockID{{Hash: common.Hash{1}, Number: 1}, {Hash: common.Hash{2}, Number: 2}}, batcher)
+	require.NoError(t, err)
+	require.Equal(t, [][][]byte{{{1}}, {{4}}}, data, "only data sent to the inbox by the batcher")
+
+	_, txs, err := src.BatchDataWithTxs(context.Background(), []eth.BlockID{{Hash: common.Hash{1}, Number: 1}, {Hash: common.Hash{2}, Number: 2}}, batcher)
+	require.NoError(t, err)
+	require.Equal(t, [][]common.Hash{{fetcher[common.Hash{1}][0].Hash()}, {fetcher[common.Hash{2}][1].Hash()}}, txs)
+}
+
+func TestFileDataSource(t *testing.T) {
+	config := &rollup.Config{}
+	batches := []*BatchData{
+		{BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{{1}}}},
+		{BatchV1{Epoch: 1, Timestamp: 4, Transactions: []hexutil.Bytes{{2}}}},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, EncodeBatches(config, batches[:1], &buf))
+	bundle := hexutil.Encode(buf.Bytes())
+	buf.Reset()
+	require.NoError(t, EncodeBatches(config, batches[1:], &buf))
+	frames, err := ChannelFrames(&rollup.Config{}, ChannelID{1}, buf.Bytes(), 1+frameOverhead+4)
+	require.NoError(t, err)
+	require.Greater(t, len(frames), 1)
+
+	dir := t.TempDir()
+	content := bundle + "\n\n" + hexutil.Encode(frames[0]) + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "10"), []byte(content), 0644))
+	content = ""
+	for _, f := range frames[1:] {
+		content += hexutil.Encode(f) + "\n"
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "12"), []byte(content), 0644))
+
+	src := &FileDataSource{Config: &rollup.Config{}, Dir: dir}
+	window := []eth.BlockID{{Number: 10}, {Number: 11}, {Number: 12}}
+	data, err := src.BatchData(context.Background(), window, common.Address{})
+	require.NoError(t, err)
+	require.Len(t, data, 3)
+	require.Len(t, data[0], 2)
+	require.Empty(t, data[1])
+	require.Len(t, data[2], len(frames)-1)
+	out, err := BatchesFromData(config, data, testlog.Logger(t, log.LvlError))
+	require.NoError(t, err)
+	require.Equal(t, batches, out)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "11"), []byte("not hex\n"), 0644))
+	_, err = src.BatchData(context.Background(), window, common.Address{})
+	require.Error(t, err)
+}
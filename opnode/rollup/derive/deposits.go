@@ -0,0 +1,158 @@
+package derive
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+var (
+	DepositEventABI     = "TransactionDeposited(address,address,uint256,uint256,uint256,bool,bytes)"
+	DepositEventABIHash = crypto.Keccak256Hash([]byte(DepositEventABI))
+	DepositContractAddr = common.HexToAddress("0xdeaddeaddeaddeaddeaddeaddeaddeaddead0001")
+)
+
+// DepositContract returns the L1 deposit contract of the rollup: the configured deposit contract,
+// or DepositContractAddr if none is configured.
+func DepositContract(config *rollup.Config) common.Address {
+	if config.DepositContractAddress != (common.Address{}) {
+		return config.DepositContractAddress
+	}
+	return DepositContractAddr
+}
+
+// UnmarshalLogEvent decodes an EVM log entry emitted by the deposit contract into typed deposit data.
+//
+// parse log data for:
+//
+//	event TransactionDeposited(
+//		address indexed from,
+//		address indexed to,
+//		uint256 mint,
+//		uint256 value,
+//		uint256 gasLimit,
+//		bool isCreation,
+//		data data
+//	);
+//
+// Deposits additionally get:
+//   - blockNum matching the L1 block height
+//   - txIndex: matching the deposit index, not L1 transaction index, since there can be multiple deposits per L1 tx
+func UnmarshalLogEvent(blockNum uint64, txIndex uint64, ev *types.Log) (*types.DepositTx, error) {
+	if len(ev.Topics) != 3 {
+		return nil, fmt.Errorf("expected 3 event topics (event identity, indexed from, indexed to)")
+	}
+	if ev.Topics[0] != DepositEventABIHash {
+		return nil, fmt.Errorf("invalid deposit event selector: %s, expected %s", ev.Topics[0], DepositEventABIHash)
+	}
+	if len(ev.Data) < 6*32 {
+		return nil, fmt.Errorf("deposit event data too small (%d bytes): %x", len(ev.Data), ev.Data)
+	}
+
+	var dep types.DepositTx
+
+	dep.BlockHeight = blockNum
+	dep.TransactionIndex = txIndex
+
+	// indexed 0
+	dep.From = common.BytesToAddress(ev.Topics[1][12:])
+	// indexed 1
+	to := common.BytesToAddress(ev.Topics[2][12:])
+
+	// unindexed data
+	offset := uint64(0)
+	dep.Value = new(big.Int).SetBytes(ev.Data[offset : offset+32])
+	offset += 32
+
+	dep.Mint = new(big.Int).SetBytes(ev.Data[offset : offset+32])
+	// 0 mint is represented as nil to skip minting code
+	if dep.Mint.Cmp(new(big.Int)) == 0 {
+		dep.Mint = nil
+	}
+	offset += 32
+
+	gas := new(big.Int).SetBytes(ev.Data[offset : offset+32])
+	if !gas.IsUint64() {
+		return nil, fmt.Errorf("bad gas value: %x", ev.Data[offset:offset+32])
+	}
+	offset += 32
+	dep.Gas = gas.Uint64()
+	// isCreation: If the boolean byte is 1 then dep.To will stay nil,
+	// and it will create a contract using L2 account nonce to determine the created address.
+	if ev.Data[offset+31] == 0 {
+		dep.To = &to
+	}
+	offset += 32
+	var dataOffset uint256.Int
+	dataOffset.SetBytes(ev.Data[offset : offset+32])
+	offset += 32
+	if dataOffset.Eq(uint256.NewInt(128)) {
+		return nil, fmt.Errorf("incorrect data offset: %v", dataOffset[0])
+	}
+
+	var dataLen uint256.Int
+	dataLen.SetBytes(ev.Data[offset : offset+32])
+	offset += 32
+
+	if !dataLen.IsUint64() {
+		return nil, fmt.Errorf("data too large: %s", dataLen.String())
+	}
+	// The data may be padded to a multiple of 32 bytes
+	maxExpectedLen := uint64(len(ev.Data)) - offset
+	dataLenU64 := dataLen.Uint64()
+	if dataLenU64 > maxExpectedLen {
+		return nil, fmt.Errorf("data length too long: %d, expected max %d", dataLenU64, maxExpectedLen)
+	}
+
+	// remaining bytes fill the data
+	dep.Data = ev.Data[offset : offset+dataLenU64]
+
+	return &dep, nil
+}
+
+// UserDeposits transforms the L2 block-height and L1 receipts into the transaction inputs for a full L2 block,
+// from the logs of the given deposit contract.
+func UserDeposits(depositContract common.Address, l2BlockHeight uint64, receipts []*types.Receipt) ([]*types.DepositTx, error) {
+	var out []*types.DepositTx
+
+	for _, rec := range receipts {
+		if rec.Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		for _, log := range rec.Logs {
+			if log.Address == depositContract {
+				// offset transaction index by 1, the first is the l1-info tx
+				dep, err := UnmarshalLogEvent(l2BlockHeight, uint64(len(out))+1, log)
+				if err != nil {
+					return nil, fmt.Errorf("malformatted L1 deposit log: %v", err)
+				}
+				out = append(out, dep)
+			}
+		}
+	}
+	return out, nil
+}
+
+// DeriveDeposits returns the encoded deposit transactions of the deposit events in the receipts of an L1 origin block.
+// The deposits are included at the start of the first L2 block of the epoch, right after the L1 info transaction.
+func DeriveDeposits(config *rollup.Config, l2BlockHeight uint64, receipts []*types.Receipt) ([]hexutil.Bytes, error) {
+	userDeposits, err := UserDeposits(DepositContract(config), l2BlockHeight, receipts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive user deposits: %v", err)
+	}
+	encodedTxs := make([]hexutil.Bytes, 0, len(userDeposits))
+	for i, tx := range userDeposits {
+		opaqueTx, err := types.NewTx(tx).MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode user tx %d", i)
+		}
+		encodedTxs = append(encodedTxs, opaqueTx)
+	}
+	return encodedTxs, nil
+}
@@ -0,0 +1,32 @@
+package derive
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeriveDepositsConfiguredContract(t *testing.T) {
+	rng := rand.New(rand.NewSource(1234))
+	contract := common.Address{0xde, 0x90}
+	config := &rollup.Config{DepositContractAddress: contract}
+	assert.Equal(t, contract, DepositContract(config))
+	assert.Equal(t, DepositContractAddr, DepositContract(&rollup.Config{}), "default deposit contract")
+
+	dep := GenerateDeposit(100, 1, rng)
+	configuredLog := GenerateDepositLog(dep)
+	configuredLog.Address = contract
+	defaultLog := GenerateDepositLog(GenerateDeposit(100, 2, rng))
+	receipts := []*types.Receipt{{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{defaultLog, configuredLog}}}
+
+	out, err := DeriveDeposits(config, 100, receipts)
+	assert.NoError(t, err)
+	expected, err := types.NewTx(dep).MarshalBinary()
+	assert.NoError(t, err)
+	assert.Len(t, out, 1, "only logs of the configured contract are deposits")
+	assert.Equal(t, expected, []byte(out[0]))
+}
@@ -0,0 +1,65 @@
+package derive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+)
+
+// FrameInfo describes a channel frame, without its data.
+type FrameInfo struct {
+	ChannelID   ChannelID `json:"channel_id"`
+	FrameNumber uint16    `json:"frame_number"`
+	DataLength  int       `json:"data_length"`
+	IsLast      bool      `json:"is_last"`
+}
+
+// DecodedBatchData is the content of an item of batch data: the batches of a batch bundle,
+// or the channel frames, and the batches of the channels that are completed by the frames alone.
+type DecodedBatchData struct {
+	Type    byte         `json:"type"`
+	Frames  []FrameInfo  `json:"frames,omitempty"`
+	Batches []*BatchData `json:"batches"`
+}
+
+// DecodeBatchData decodes an item of batch data, such as the calldata of a batch submission transaction,
+// for inspection. The frames of channels that are not completed by the item itself are listed, but not decoded.
+func DecodeBatchData(config *rollup.Config, data []byte) (*DecodedBatchData, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty batch data")
+	}
+	out := &DecodedBatchData{Type: data[0], Batches: []*BatchData{}}
+	if data[0] != ChannelFramesType {
+		batches, err := DecodeBatches(config, bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode batch bundle: %w", err)
+		}
+		out.Batches = batches
+		return out, nil
+	}
+	frames, err := ParseFrames(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse channel frames: %w", err)
+	}
+	bank := NewChannelBank(config)
+	for _, f := range frames {
+		out.Frames = append(out.Frames, FrameInfo{ChannelID: f.ID, FrameNumber: f.FrameNumber, DataLength: len(f.Data), IsLast: f.IsLast})
+		if err := bank.IngestFrame(f); err != nil {
+			return nil, fmt.Errorf("invalid frame %d of channel %s: %w", f.FrameNumber, f.ID, err)
+		}
+	}
+	for {
+		channel, ok := bank.ReadChannel()
+		if !ok {
+			break
+		}
+		batches, err := DecodeBatches(config, channel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode channel: %w", err)
+		}
+		out.Batches = append(out.Batches, batches...)
+	}
+	return out, nil
+}
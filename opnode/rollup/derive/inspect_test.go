@@ -0,0 +1,51 @@
+package derive
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeBatchData(t *testing.T) {
+	config := &rollup.Config{BlockTime: 2}
+	batches := []*BatchData{
+		{BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{{1}}}},
+		{BatchV1{Epoch: 1, Timestamp: 4, Transactions: []hexutil.Bytes{{2}}}},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, EncodeBatches(config, batches, &buf))
+
+	out, err := DecodeBatchData(config, buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, byte(BatchBundleV1Type), out.Type)
+	require.Empty(t, out.Frames)
+	require.Equal(t, batches, out.Batches)
+
+	// a channel in a single transaction is decoded, the frames of other channels are only listed
+	single, err := ChannelFrames(config, ChannelID{1}, buf.Bytes(), DefaultMaxChannelSize)
+	require.NoError(t, err)
+	require.Len(t, single, 1)
+	partial, err := ChannelFrames(config, ChannelID{2}, buf.Bytes(), 1+frameOverhead+4)
+	require.NoError(t, err)
+	data := append(single[0], partial[0][1:]...)
+	out, err = DecodeBatchData(config, data)
+	require.NoError(t, err)
+	require.Equal(t, byte(ChannelFramesType), out.Type)
+	require.Len(t, out.Frames, 2)
+	require.Equal(t, FrameInfo{ChannelID: ChannelID{1}, FrameNumber: 0, DataLength: buf.Len(), IsLast: true}, out.Frames[0])
+	require.Equal(t, ChannelID{2}, out.Frames[1].ChannelID)
+	require.Equal(t, batches, out.Batches)
+
+	enc, err := json.Marshal(out)
+	require.NoError(t, err)
+	require.Contains(t, string(enc), `"channel_id":"0x01000000000000000000000000000000"`)
+
+	_, err = DecodeBatchData(config, nil)
+	require.Error(t, err)
+	_, err = DecodeBatchData(config, []byte{BatchBundleV1Type, 0xff})
+	require.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package derive
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"math/big"
@@ -12,22 +13,78 @@ import (
 )
 
 // L1InfoDepositTxData is the inverse of L1InfoDeposit, to see where the L2 chain is derived from
-func L1InfoDepositTxData(data []byte) (nr uint64, time uint64, baseFee *big.Int, blockHash common.Hash, err error) {
-	if len(data) != 4+8+8+32+32 {
+func L1InfoDepositTxData(data []byte) (nr uint64, time uint64, baseFee *big.Int, blockHash common.Hash, seqNumber uint64, err error) {
+	if len(data) != L1InfoLen {
 		err = fmt.Errorf("data is unexpected length: %d", len(data))
 		return
 	}
 	offset := 4
-	nr = binary.BigEndian.Uint64(data[offset : offset+8])
-	offset += 8
-	time = binary.BigEndian.Uint64(data[offset : offset+8])
-	offset += 8
+	nr = binary.BigEndian.Uint64(data[offset+24 : offset+32])
+	offset += 32
+	time = binary.BigEndian.Uint64(data[offset+24 : offset+32])
+	offset += 32
 	baseFee = new(big.Int).SetBytes(data[offset : offset+32])
 	offset += 32
 	blockHash.SetBytes(data[offset : offset+32])
+	offset += 32
+	seqNumber = binary.BigEndian.Uint64(data[offset+24 : offset+32])
+	return
+}
+
+// L1InfoDepositFeeParams returns the L1 fee overhead and scalar of the L1 info deposit tx data.
+func L1InfoDepositFeeParams(data []byte) (overhead common.Hash, scalar common.Hash, err error) {
+	if len(data) != L1InfoLen {
+		err = fmt.Errorf("data is unexpected length: %d", len(data))
+		return
+	}
+	offset := L1InfoLen - 64
+	overhead.SetBytes(data[offset : offset+32])
+	scalar.SetBytes(data[offset+32 : offset+64])
 	return
 }
 
+// CheckL1InfoDeposit checks that the transaction is the L1 info deposit of the L2 block with the given height and
+// sequence number, with the L1 context (number, hash, timestamp and basefee) of the given L1 origin,
+// and the L1 fee parameters of the given system config.
+func CheckL1InfoDeposit(tx *types.Transaction, l2BlockHeight uint64, seqNumber uint64, l1Origin L1Info, sysCfg rollup.SystemConfig) error {
+	if tx.Type() != types.DepositTxType {
+		return fmt.Errorf("first transaction is not a deposit, but of type %d", tx.Type())
+	}
+	nr, time, baseFee, blockHash, seq, err := L1InfoDepositTxData(tx.Data())
+	if err != nil {
+		return fmt.Errorf("failed to parse L1 info deposit tx: %w", err)
+	}
+	if nr != l1Origin.NumberU64() || blockHash != l1Origin.Hash() {
+		return fmt.Errorf("L1 info of block %s:%d does not match L1 origin %s", blockHash, nr, l1Origin.ID())
+	}
+	if time != l1Origin.Time() || baseFee.Cmp(l1Origin.BaseFee()) != 0 {
+		return fmt.Errorf("L1 info time %d and basefee %s do not match L1 origin time %d and basefee %s", time, baseFee, l1Origin.Time(), l1Origin.BaseFee())
+	}
+	if seq != seqNumber {
+		return fmt.Errorf("L1 info sequence number %d does not match expected %d", seq, seqNumber)
+	}
+	overhead, scalar, err := L1InfoDepositFeeParams(tx.Data())
+	if err != nil {
+		return fmt.Errorf("failed to parse L1 info deposit tx: %w", err)
+	}
+	if overhead != sysCfg.Overhead || scalar != sysCfg.Scalar {
+		return fmt.Errorf("L1 info fee overhead %s and scalar %s do not match system config overhead %s and scalar %s", overhead, scalar, sysCfg.Overhead, sysCfg.Scalar)
+	}
+	// The remaining fields are fixed: the encoding must match exactly
+	expected, err := L1InfoDepositBytes(l2BlockHeight, seqNumber, l1Origin, sysCfg)
+	if err != nil {
+		return err
+	}
+	got, err := tx.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode L1 info deposit tx: %w", err)
+	}
+	if !bytes.Equal(got, expected) {
+		return fmt.Errorf("L1 info deposit tx %s does not match the expected L1 info deposit", tx.Hash())
+	}
+	return nil
+}
+
 type Block interface {
 	Hash() common.Hash
 	NumberU64() uint64
@@ -50,6 +107,7 @@ func BlockReferences(l2Block Block, genesis *rollup.Genesis) (eth.L2BlockRef, er
 			return eth.L2BlockRef{}, fmt.Errorf("unexpected L2 genesis block: %s:%d, expected %s", id.Hash, id.Number, genesis.L2)
 		}
 		id.L1Origin = genesis.L1
+		id.SequenceNumber = 0
 		return id, nil
 	}
 
@@ -57,10 +115,41 @@ func BlockReferences(l2Block Block, genesis *rollup.Genesis) (eth.L2BlockRef, er
 	if len(txs) == 0 || txs[0].Type() != types.DepositTxType {
 		return eth.L2BlockRef{}, fmt.Errorf("l2 block is missing L1 info deposit tx, block hash: %s", l2Block.Hash())
 	}
-	l1Number, _, _, l1Hash, err := L1InfoDepositTxData(txs[0].Data())
+	l1Number, _, _, l1Hash, seqNumber, err := L1InfoDepositTxData(txs[0].Data())
 	if err != nil {
 		return eth.L2BlockRef{}, fmt.Errorf("failed to parse L1 info deposit tx from L2 block: %v", err)
 	}
 	id.L1Origin = eth.BlockID{Hash: l1Hash, Number: l1Number}
+	id.SequenceNumber = seqNumber
 	return id, nil
 }
+
+// CheckNextBlock checks that the next L2 block consistently extends the parent L2 block: it is the next block number
+// on top of the parent, its timestamp is exactly one block time after the parent, and its L1 origin is either
+// the L1 origin of the parent with the next sequence number, or the next L1 block with sequence number 0.
+// Whether the next L1 block is a child of the L1 origin of the parent is left to the caller to check.
+func CheckNextBlock(config *rollup.Config, parent eth.L2BlockRef, next eth.L2BlockRef) error {
+	if next.Number != parent.Number+1 || next.ParentHash != parent.Hash {
+		return fmt.Errorf("block %s with parent %s does not extend parent block %s", next, next.ParentHash, parent)
+	}
+	if next.Time != parent.Time+config.BlockTime {
+		return fmt.Errorf("block %s has timestamp %d, expected %d: one block time of %d after parent %s",
+			next, next.Time, parent.Time+config.BlockTime, config.BlockTime, parent)
+	}
+	switch next.L1Origin.Number {
+	case parent.L1Origin.Number:
+		if next.L1Origin.Hash != parent.L1Origin.Hash {
+			return fmt.Errorf("block %s has L1 origin %s, conflicting with L1 origin %s of parent %s", next, next.L1Origin, parent.L1Origin, parent)
+		}
+		if next.SequenceNumber != parent.SequenceNumber+1 {
+			return fmt.Errorf("block %s has sequence number %d in the epoch of its parent %s, expected %d", next, next.SequenceNumber, parent, parent.SequenceNumber+1)
+		}
+	case parent.L1Origin.Number + 1:
+		if next.SequenceNumber != 0 {
+			return fmt.Errorf("block %s starts epoch %s with sequence number %d, expected 0", next, next.L1Origin, next.SequenceNumber)
+		}
+	default:
+		return fmt.Errorf("block %s has L1 origin %s, but the L1 origin may advance by at most one block from %s of parent %s", next, next.L1Origin, parent.L1Origin, parent)
+	}
+	return nil
+}
@@ -7,7 +7,9 @@ import (
 
 	"github.com/ethereum/go-ethereum/core/types"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/contracts/l1block"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/assert"
@@ -123,26 +125,121 @@ func TestParseL1InfoDepositTxData(t *testing.T) {
 	for i, testCase := range cases {
 		t.Run(testCase.name, func(t *testing.T) {
 			info := testCase.mkInfo(rand.New(rand.NewSource(int64(1234 + i))))
-			depTx := L1InfoDeposit(123, info)
-			nr, time, baseFee, h, err := L1InfoDepositTxData(depTx.Data)
+			seqNr := rand.New(rand.NewSource(int64(i))).Uint64()
+			sysCfg := rollup.SystemConfig{Overhead: common.Hash{31: 188}, Scalar: common.Hash{29: 0x0a, 30: 0x42, 31: 0x40}}
+			depTx := L1InfoDeposit(123, seqNr, info, sysCfg)
+			nr, time, baseFee, h, seq, err := L1InfoDepositTxData(depTx.Data)
 			assert.NoError(t, err, "expected valid deposit info")
 			assert.Equal(t, nr, info.num)
 			assert.Equal(t, time, info.time)
 			assert.True(t, baseFee.Sign() >= 0)
 			assert.Equal(t, baseFee.Bytes(), info.baseFee.Bytes())
 			assert.Equal(t, h, info.hash)
+			assert.Equal(t, seq, seqNr)
+			overhead, scalar, err := L1InfoDepositFeeParams(depTx.Data)
+			assert.NoError(t, err)
+			assert.Equal(t, sysCfg.Overhead, overhead)
+			assert.Equal(t, sysCfg.Scalar, scalar)
 		})
 	}
 	t.Run("no data", func(t *testing.T) {
-		_, _, _, _, err := L1InfoDepositTxData(nil)
+		_, _, _, _, _, err := L1InfoDepositTxData(nil)
 		assert.Error(t, err)
 	})
 	t.Run("not enough data", func(t *testing.T) {
-		_, _, _, _, err := L1InfoDepositTxData([]byte{1, 2, 3, 4})
+		_, _, _, _, _, err := L1InfoDepositTxData([]byte{1, 2, 3, 4})
 		assert.Error(t, err)
 	})
 	t.Run("too much data", func(t *testing.T) {
-		_, _, _, _, err := L1InfoDepositTxData(make([]byte, 4+8+8+32+32+1))
+		_, _, _, _, _, err := L1InfoDepositTxData(make([]byte, L1InfoLen+1))
 		assert.Error(t, err)
 	})
 }
+
+// TestL1InfoDepositABI checks that the L1 info deposit is an ABI encoded call of setL1BlockValues of the L1Block predeploy.
+func TestL1InfoDepositABI(t *testing.T) {
+	rng := rand.New(rand.NewSource(1234))
+	info := randomL1Info(rng)
+	sysCfg := rollup.SystemConfig{Overhead: common.Hash{31: 188}, Scalar: common.Hash{29: 0x0a, 30: 0x42, 31: 0x40}}
+	l1BlockABI, err := l1block.L1blockMetaData.GetAbi()
+	assert.NoError(t, err)
+	expected, err := l1BlockABI.Pack("setL1BlockValues", info.num, info.time, info.baseFee, info.hash,
+		uint64(3), new(big.Int).SetBytes(sysCfg.Overhead[:]), new(big.Int).SetBytes(sysCfg.Scalar[:]))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, L1InfoDeposit(100, 3, info, sysCfg).Data)
+}
+
+func TestCheckL1InfoDeposit(t *testing.T) {
+	rng := rand.New(rand.NewSource(1234))
+	info := randomL1Info(rng)
+	sysCfg := rollup.SystemConfig{Overhead: common.Hash{31: 188}, Scalar: common.Hash{31: 1}}
+	tx := types.NewTx(L1InfoDeposit(100, 3, info, sysCfg))
+	assert.NoError(t, CheckL1InfoDeposit(tx, 100, 3, info, sysCfg))
+
+	assert.Error(t, CheckL1InfoDeposit(tx, 100, 4, info, sysCfg), "wrong sequence number")
+	assert.Error(t, CheckL1InfoDeposit(tx, 101, 3, info, sysCfg), "wrong L2 block height")
+	other := *info
+	other.hash[0] ^= 1
+	assert.Error(t, CheckL1InfoDeposit(tx, 100, 3, &other, sysCfg), "wrong L1 hash")
+	other = *info
+	other.time++
+	assert.Error(t, CheckL1InfoDeposit(tx, 100, 3, &other, sysCfg), "wrong L1 time")
+	other = *info
+	other.baseFee = new(big.Int).Add(info.baseFee, big.NewInt(1))
+	assert.Error(t, CheckL1InfoDeposit(tx, 100, 3, &other, sysCfg), "wrong L1 basefee")
+
+	otherCfg := sysCfg
+	otherCfg.Scalar[31]++
+	assert.Error(t, CheckL1InfoDeposit(tx, 100, 3, info, otherCfg), "wrong L1 fee scalar")
+	otherCfg = sysCfg
+	otherCfg.Overhead[31]++
+	assert.Error(t, CheckL1InfoDeposit(tx, 100, 3, info, otherCfg), "wrong L1 fee overhead")
+
+	notDeposit := types.NewTx(&types.DynamicFeeTx{Data: tx.Data()})
+	assert.Error(t, CheckL1InfoDeposit(notDeposit, 100, 3, info, sysCfg), "not a deposit")
+}
+
+func TestCheckNextBlock(t *testing.T) {
+	config := &rollup.Config{BlockTime: 2}
+	originA := eth.BlockID{Hash: common.Hash{0xa}, Number: 10}
+	originB := eth.BlockID{Hash: common.Hash{0xb}, Number: 11}
+	parent := eth.L2BlockRef{Hash: common.Hash{1}, Number: 100, Time: 1000, L1Origin: originA, SequenceNumber: 3}
+	next := func(fn func(ref *eth.L2BlockRef)) eth.L2BlockRef {
+		ref := eth.L2BlockRef{Hash: common.Hash{2}, Number: 101, ParentHash: parent.Hash, Time: 1002, L1Origin: originA, SequenceNumber: 4}
+		fn(&ref)
+		return ref
+	}
+	testCases := []struct {
+		name  string
+		next  eth.L2BlockRef
+		valid bool
+	}{
+		{"same epoch", next(func(ref *eth.L2BlockRef) {}), true},
+		{"next epoch", next(func(ref *eth.L2BlockRef) { ref.L1Origin = originB; ref.SequenceNumber = 0 }), true},
+		{"wrong number", next(func(ref *eth.L2BlockRef) { ref.Number = 102 }), false},
+		{"wrong parent", next(func(ref *eth.L2BlockRef) { ref.ParentHash = common.Hash{3} }), false},
+		{"timestamp gap", next(func(ref *eth.L2BlockRef) { ref.Time = 1004 }), false},
+		{"same timestamp", next(func(ref *eth.L2BlockRef) { ref.Time = 1000 }), false},
+		{"conflicting origin", next(func(ref *eth.L2BlockRef) { ref.L1Origin.Hash = common.Hash{0xc} }), false},
+		{"skipped sequence number", next(func(ref *eth.L2BlockRef) { ref.SequenceNumber = 5 }), false},
+		{"next epoch without sequence reset", next(func(ref *eth.L2BlockRef) { ref.L1Origin = originB }), false},
+		{"origin advanced by two", next(func(ref *eth.L2BlockRef) {
+			ref.L1Origin = eth.BlockID{Hash: common.Hash{0xd}, Number: 12}
+			ref.SequenceNumber = 0
+		}), false},
+		{"origin moved back", next(func(ref *eth.L2BlockRef) {
+			ref.L1Origin = eth.BlockID{Hash: common.Hash{0x9}, Number: 9}
+			ref.SequenceNumber = 0
+		}), false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := CheckNextBlock(config, parent, testCase.next)
+			if testCase.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package derive
+
+import (
+	"fmt"
+	"sync"
+
+	gokzg4844 "github.com/crate-crypto/go-kzg-4844"
+)
+
+// KZG computes and verifies the KZG commitments and proofs of blobs, with the trusted setup of the KZG ceremony of L1.
+type KZG struct {
+	ctx *gokzg4844.Context
+}
+
+var _ BlobVerifier = (*KZG)(nil)
+
+var (
+	kzgOnce sync.Once
+	kzg     *KZG
+	kzgErr  error
+)
+
+// LoadKZG returns the KZG of the trusted setup of L1. The setup is loaded once, which takes a moment.
+func LoadKZG() (*KZG, error) {
+	kzgOnce.Do(func() {
+		ctx, err := gokzg4844.NewContext4096Secure()
+		if err != nil {
+			kzgErr = fmt.Errorf("failed to load the KZG trusted setup: %w", err)
+			return
+		}
+		kzg = &KZG{ctx: ctx}
+	})
+	return kzg, kzgErr
+}
+
+// VerifyBlobProof verifies the blob against its commitment with the proof.
+func (k *KZG) VerifyBlobProof(blob *Blob, commitment KZGCommitment, proof KZGProof) error {
+	return k.ctx.VerifyBlobKZGProof(gokzg4844.Blob(*blob), gokzg4844.KZGCommitment(commitment), gokzg4844.KZGProof(proof))
+}
+
+// Commit computes the commitment to the blob, and the proof of the blob against it.
+func (k *KZG) Commit(blob *Blob) (KZGCommitment, KZGProof, error) {
+	commitment, err := k.ctx.BlobToKZGCommitment(gokzg4844.Blob(*blob), 0)
+	if err != nil {
+		return KZGCommitment{}, KZGProof{}, fmt.Errorf("failed to commit to blob: %w", err)
+	}
+	proof, err := k.ctx.ComputeBlobKZGProof(gokzg4844.Blob(*blob), commitment, 0)
+	if err != nil {
+		return KZGCommitment{}, KZGProof{}, fmt.Errorf("failed to compute blob proof: %w", err)
+	}
+	return KZGCommitment(commitment), KZGProof(proof), nil
+}
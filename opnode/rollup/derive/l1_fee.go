@@ -0,0 +1,38 @@
+package derive
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// L1FeeScalarDecimals is the number of decimals of the L1 fee scalar: a scalar of 1_000_000 is a factor of 1.
+const L1FeeScalarDecimals = 6
+
+var l1FeeScalarDivisor = new(big.Int).Exp(big.NewInt(10), big.NewInt(L1FeeScalarDecimals), nil)
+
+// RollupDataGas is the L1 calldata gas of the encoded L2 transaction, as if it was submitted to L1 by itself.
+func RollupDataGas(txData []byte) uint64 {
+	var zeroes, ones uint64
+	for _, b := range txData {
+		if b == 0 {
+			zeroes++
+		} else {
+			ones++
+		}
+	}
+	return zeroes*params.TxDataZeroGas + ones*params.TxDataNonZeroGasEIP2028
+}
+
+// L1Cost is the L1 data fee of the encoded L2 transaction, with the L1 basefee and the L1 fee parameters
+// of the L1 info deposit of its L2 block:
+//
+//	(rollupDataGas + overhead) * l1BaseFee * scalar / 10**L1FeeScalarDecimals
+func L1Cost(txData []byte, l1BaseFee *big.Int, overhead common.Hash, scalar common.Hash) *big.Int {
+	gas := new(big.Int).SetUint64(RollupDataGas(txData))
+	gas.Add(gas, overhead.Big())
+	fee := gas.Mul(gas, l1BaseFee)
+	fee.Mul(fee, scalar.Big())
+	return fee.Div(fee, l1FeeScalarDivisor)
+}
@@ -0,0 +1,20 @@
+package derive
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestL1Cost(t *testing.T) {
+	data := []byte{0, 0, 1, 2, 0}
+	require.Equal(t, uint64(3*4+2*16), RollupDataGas(data))
+
+	overhead := common.BigToHash(big.NewInt(2100))
+	scalar := common.BigToHash(big.NewInt(1_500_000)) // 1.5x
+	// (44 + 2100) * 10 gwei * 1.5
+	require.Equal(t, big.NewInt((44+2100)*10_000_000_000*3/2), L1Cost(data, big.NewInt(10_000_000_000), overhead, scalar))
+	require.Zero(t, L1Cost(data, big.NewInt(10), overhead, common.Hash{}).Sign(), "zero scalar")
+}
@@ -3,6 +3,7 @@ package derive
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -13,105 +14,20 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/holiman/uint256"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 )
 
 var (
-	DepositEventABI     = "TransactionDeposited(address,address,uint256,uint256,uint256,bool,bytes)"
-	DepositEventABIHash = crypto.Keccak256Hash([]byte(DepositEventABI))
-	DepositContractAddr = common.HexToAddress("0xdeaddeaddeaddeaddeaddeaddeaddeaddead0001")
-	L1InfoFuncSignature = "setL1BlockValues(uint256 _number, uint256 _timestamp, uint256 _basefee, bytes32 _hash)"
+	L1InfoFuncSignature = "setL1BlockValues(uint64,uint64,uint256,bytes32,uint64,uint256,uint256)"
 	L1InfoFuncBytes4    = crypto.Keccak256([]byte(L1InfoFuncSignature))[:4]
 	L1InfoPredeployAddr = common.HexToAddress("0x4242424242424242424242424242424242424242")
 )
 
-// UnmarshalLogEvent decodes an EVM log entry emitted by the deposit contract into typed deposit data.
-//
-// parse log data for:
-//     event TransactionDeposited(
-//    	 address indexed from,
-//    	 address indexed to,
-//       uint256 mint,
-//    	 uint256 value,
-//    	 uint256 gasLimit,
-//    	 bool isCreation,
-//    	 data data
-//     );
-//
-// Deposits additionally get:
-//  - blockNum matching the L1 block height
-//  - txIndex: matching the deposit index, not L1 transaction index, since there can be multiple deposits per L1 tx
-func UnmarshalLogEvent(blockNum uint64, txIndex uint64, ev *types.Log) (*types.DepositTx, error) {
-	if len(ev.Topics) != 3 {
-		return nil, fmt.Errorf("expected 3 event topics (event identity, indexed from, indexed to)")
-	}
-	if ev.Topics[0] != DepositEventABIHash {
-		return nil, fmt.Errorf("invalid deposit event selector: %s, expected %s", ev.Topics[0], DepositEventABIHash)
-	}
-	if len(ev.Data) < 6*32 {
-		return nil, fmt.Errorf("deposit event data too small (%d bytes): %x", len(ev.Data), ev.Data)
-	}
-
-	var dep types.DepositTx
-
-	dep.BlockHeight = blockNum
-	dep.TransactionIndex = txIndex
-
-	// indexed 0
-	dep.From = common.BytesToAddress(ev.Topics[1][12:])
-	// indexed 1
-	to := common.BytesToAddress(ev.Topics[2][12:])
-
-	// unindexed data
-	offset := uint64(0)
-	dep.Value = new(big.Int).SetBytes(ev.Data[offset : offset+32])
-	offset += 32
-
-	dep.Mint = new(big.Int).SetBytes(ev.Data[offset : offset+32])
-	// 0 mint is represented as nil to skip minting code
-	if dep.Mint.Cmp(new(big.Int)) == 0 {
-		dep.Mint = nil
-	}
-	offset += 32
-
-	gas := new(big.Int).SetBytes(ev.Data[offset : offset+32])
-	if !gas.IsUint64() {
-		return nil, fmt.Errorf("bad gas value: %x", ev.Data[offset:offset+32])
-	}
-	offset += 32
-	dep.Gas = gas.Uint64()
-	// isCreation: If the boolean byte is 1 then dep.To will stay nil,
-	// and it will create a contract using L2 account nonce to determine the created address.
-	if ev.Data[offset+31] == 0 {
-		dep.To = &to
-	}
-	offset += 32
-	var dataOffset uint256.Int
-	dataOffset.SetBytes(ev.Data[offset : offset+32])
-	offset += 32
-	if dataOffset.Eq(uint256.NewInt(128)) {
-		return nil, fmt.Errorf("incorrect data offset: %v", dataOffset[0])
-	}
-
-	var dataLen uint256.Int
-	dataLen.SetBytes(ev.Data[offset : offset+32])
-	offset += 32
-
-	if !dataLen.IsUint64() {
-		return nil, fmt.Errorf("data too large: %s", dataLen.String())
-	}
-	// The data may be padded to a multiple of 32 bytes
-	maxExpectedLen := uint64(len(ev.Data)) - offset
-	dataLenU64 := dataLen.Uint64()
-	if dataLenU64 > maxExpectedLen {
-		return nil, fmt.Errorf("data length too long: %d, expected max %d", dataLenU64, maxExpectedLen)
-	}
-
-	// remaining bytes fill the data
-	dep.Data = ev.Data[offset : offset+dataLenU64]
-
-	return &dep, nil
-}
+// L1InfoLen is the length of the L1 info deposit tx data: the selector, and the ABI encoded arguments
+// number, time, basefee, hash, the sequence number of the L2 block within the epoch,
+// and the L1 fee overhead and scalar of the system config.
+const L1InfoLen = 4 + 32*7
 
 type L1Info interface {
 	Hash() common.Hash
@@ -127,19 +43,28 @@ type L1Info interface {
 	ReceiptHash() common.Hash
 }
 
-// L1InfoDeposit creats a L1 Info deposit transaction based on the L1 block
-func L1InfoDeposit(l2BlockHeight uint64, block L1Info) *types.DepositTx {
-	data := make([]byte, 4+8+8+32+32)
+// L1InfoDeposit creats a L1 Info deposit transaction based on the L1 block,
+// and the L2 block-height and sequence number (index of the L2 block within the epoch).
+// The L1 fee parameters are those of the system config of the epoch, so that the L1 data fee
+// that the execution engine charges is the same on every node.
+func L1InfoDeposit(l2BlockHeight uint64, seqNumber uint64, block L1Info, sysCfg rollup.SystemConfig) *types.DepositTx {
+	data := make([]byte, L1InfoLen)
 	offset := 0
 	copy(data[offset:4], L1InfoFuncBytes4)
 	offset += 4
-	binary.BigEndian.PutUint64(data[offset:offset+8], block.NumberU64())
-	offset += 8
-	binary.BigEndian.PutUint64(data[offset:offset+8], block.Time())
-	offset += 8
+	binary.BigEndian.PutUint64(data[offset+24:offset+32], block.NumberU64())
+	offset += 32
+	binary.BigEndian.PutUint64(data[offset+24:offset+32], block.Time())
+	offset += 32
 	block.BaseFee().FillBytes(data[offset : offset+32])
 	offset += 32
 	copy(data[offset:offset+32], block.Hash().Bytes())
+	offset += 32
+	binary.BigEndian.PutUint64(data[offset+24:offset+32], seqNumber)
+	offset += 32
+	copy(data[offset:offset+32], sysCfg.Overhead[:])
+	offset += 32
+	copy(data[offset:offset+32], sysCfg.Scalar[:])
 
 	return &types.DepositTx{
 		BlockHeight:      l2BlockHeight,
@@ -153,105 +78,283 @@ func L1InfoDeposit(l2BlockHeight uint64, block L1Info) *types.DepositTx {
 	}
 }
 
-// UserDeposits transforms the L2 block-height and L1 receipts into the transaction inputs for a full L2 block
-func UserDeposits(l2BlockHeight uint64, receipts []*types.Receipt) ([]*types.DepositTx, error) {
-	var out []*types.DepositTx
+// BatchesFromEVMTransactions decodes the batches of the batch submitter transactions in the given L1 transactions,
+// the transactions to the batch inbox that are sent by the given batcher address.
+func BatchesFromEVMTransactions(config *rollup.Config, batcherAddr common.Address, txLists []types.Transactions, log log.Logger) ([]*BatchData, error) {
+	return BatchesFromData(config, DataFromEVMTransactions(config, batcherAddr, txLists, log), log)
+}
+
+// BatchesFromData decodes the batches of the given batch data, as provided by a DataSource for a window of L1 blocks.
+// Batches are decoded from batch bundles, and from channels of which all frames are included in the data:
+// channels are reassembled from frames across the L1 blocks of the window, and are decoded in the order they complete.
+// Channels that do not complete within the channel timeout, counted in L1 blocks from their first frame, are dropped.
+//
+// The order of the batches is part of the consensus rules, since FilterBatches keeps the first valid batch
+// of each L2 block: data items are processed by L1 block, then in the order of the items within the L1 block
+// (the transaction index for calldata), and the frames of an item in the order they are encoded.
+// The batches of a bundle are output when the bundle is processed, the batches of a channel when its
+// completing frame is processed, i.e. the frame that makes the channel complete, regardless of frame numbers.
+// Of duplicate frames the first frame is kept.
+//
+// Malformed data is skipped, and counted by rejectedData.
+func BatchesFromData(config *rollup.Config, blocks [][][]byte, log log.Logger) ([]*BatchData, error) {
+	out, _, err := BatchesWithPositions(config, blocks, log)
+	return out, err
+}
+
+// DataPosition is the position of an item of batch data in a window of L1 blocks:
+// the index of the L1 block in the window, and the index of the item in the batch data of the L1 block.
+type DataPosition struct {
+	Block int
+	Item  int
+}
+
+// BatchesWithPositions decodes the batches of the given batch data like BatchesFromData, and also returns
+// the positions of the data that each batch was read from: the item of its batch bundle, or the items
+// with the frames of its channel.
+func BatchesWithPositions(config *rollup.Config, blocks [][][]byte, log log.Logger) ([]*BatchData, map[*BatchData][]DataPosition, error) {
+	var out []*BatchData
+	positions := make(map[*BatchData][]DataPosition)
+	bank := NewChannelBank(config)
+	for i, items := range blocks {
+		batches, _ := ingestL1Block(config, bank, uint64(i), items, positions, log)
+		out = append(out, batches...)
+	}
+	return out, positions, nil
+}
+
+// parsedItem is an item of batch data of an L1 block, as parsed by ingestL1Block: the frames of the item,
+// or the batches of its batch bundle. Both are nil for items that were rejected.
+type parsedItem struct {
+	frames  []*Frame
+	batches []*BatchData
+}
 
-	for _, rec := range receipts {
-		if rec.Status != types.ReceiptStatusSuccessful {
+// ingestL1Block decodes the batches of the batch data of the L1 block with the given number: the batch bundles,
+// and the channels that the frames of the block complete in the bank. The positions of the batches are recorded
+// with the given number as block. It also returns the parsed items, to decode them again with replayL1Block.
+func ingestL1Block(config *rollup.Config, bank *ChannelBank, number uint64, items [][]byte, positions map[*BatchData][]DataPosition, log log.Logger) (out []*BatchData, parsed []parsedItem) {
+	bank.NextL1Block(number)
+	parsed = make([]parsedItem, len(items))
+	for j, data := range items {
+		if len(data) > 0 && data[0] == ChannelFramesType {
+			frames, err := ParseFrames(data)
+			if err != nil {
+				rejectedData("malformed_frames").Inc(1)
+				log.Debug("Dropping malformed channel frames", "block", number, "item", j, "err", err)
+				continue
+			}
+			parsed[j].frames = frames
+			bank.NextItem(j)
+			for _, f := range frames {
+				if err := bank.IngestFrame(f); err != nil {
+					rejectedData("invalid_frame").Inc(1)
+					log.Debug("Dropping invalid frame", "block", number, "item", j, "channel", f.ID, "frame", f.FrameNumber, "err", err)
+				}
+			}
+			out = append(out, readChannels(config, bank, positions, log)...)
 			continue
 		}
-		for _, log := range rec.Logs {
-			if log.Address == DepositContractAddr {
-				// offset transaction index by 1, the first is the l1-info tx
-				dep, err := UnmarshalLogEvent(l2BlockHeight, uint64(len(out))+1, log)
-				if err != nil {
-					return nil, fmt.Errorf("malformatted L1 deposit log: %v", err)
-				}
-				out = append(out, dep)
+		batches, err := DecodeBatches(config, bytes.NewReader(data))
+		if errors.Is(err, ErrUnknownVersion) {
+			unknownVersions("bundle").Inc(1)
+			log.Debug("Skipping batch bundle of unknown version", "block", number, "item", j, "err", err)
+			continue
+		} else if err != nil {
+			rejectedData("undecodable_bundle").Inc(1)
+			log.Debug("Dropping undecodable batch bundle", "block", number, "item", j, "err", err)
+			continue
+		}
+		parsed[j].batches = batches
+		for _, b := range batches {
+			positions[b] = []DataPosition{{Block: int(number), Item: j}}
+		}
+		out = append(out, batches...)
+	}
+	return out, parsed
+}
+
+// replayL1Block decodes the batches of the parsed items of an L1 block again, in the bank of another window
+// than the one the block was ingested in first. The rejected data and the dropped channels are not counted again.
+func replayL1Block(config *rollup.Config, bank *ChannelBank, number uint64, parsed []parsedItem, positions map[*BatchData][]DataPosition, log log.Logger) (out []*BatchData) {
+	quiet := bank.quiet
+	bank.quiet = true
+	defer func() { bank.quiet = quiet }()
+	bank.NextL1Block(number)
+	for j, item := range parsed {
+		if item.frames != nil {
+			bank.NextItem(j)
+			for _, f := range item.frames {
+				_ = bank.IngestFrame(f)
 			}
+			out = append(out, readChannels(config, bank, positions, log)...)
+			continue
+		}
+		for _, b := range item.batches {
+			positions[b] = []DataPosition{{Block: int(number), Item: j}}
 		}
+		out = append(out, item.batches...)
 	}
-	return out, nil
+	return out
 }
 
-func BatchesFromEVMTransactions(config *rollup.Config, txLists []types.Transactions) ([]*BatchData, error) {
-	var out []*BatchData
-	l1Signer := config.L1Signer()
-	for _, txs := range txLists {
-		for _, tx := range txs {
-			if to := tx.To(); to != nil && *to == config.BatchInboxAddress {
-				seqDataSubmitter, err := l1Signer.Sender(tx) // optimization: only derive sender if To is correct
-				if err != nil {
-					// TODO: log error
-					continue // bad signature, ignore
-				}
-				// some random L1 user might have sent a transaction to our batch inbox, ignore them
-				if seqDataSubmitter != config.BatchSenderAddress {
-					// TODO: log/record metric
-					continue // not an authorized batch submitter, ignore
-				}
-				batches, err := DecodeBatches(config, bytes.NewReader(tx.Data()))
-				if err != nil {
-					// TODO: log/record metric
-					continue
-				}
-				out = append(out, batches...)
+// readChannels decodes the batches of the completed channels of the bank, and records the positions of their frames.
+// Channels that cannot be decoded are not counted if the bank is quiet.
+func readChannels(config *rollup.Config, bank *ChannelBank, positions map[*BatchData][]DataPosition, log log.Logger) (out []*BatchData) {
+	for {
+		ch, ok := bank.nextChannel()
+		if !ok {
+			return out
+		}
+		batches, err := DecodeBatches(config, ch.reader())
+		if errors.Is(err, ErrUnknownVersion) {
+			if !bank.quiet {
+				unknownVersions("bundle").Inc(1)
+			}
+			log.Debug("Skipping channel with a batch bundle of unknown version", "err", err)
+			continue
+		} else if err != nil {
+			if !bank.quiet {
+				rejectedData("undecodable_channel").Inc(1)
 			}
+			log.Debug("Dropping channel with an undecodable batch bundle", "err", err)
+			continue
+		}
+		for _, b := range batches {
+			positions[b] = ch.positions
 		}
+		out = append(out, batches...)
 	}
-	return out, nil
 }
 
-func FilterBatches(config *rollup.Config, epoch rollup.Epoch, minL2Time uint64, maxL2Time uint64, batches []*BatchData) (out []*BatchData) {
+// rejectedData counts the items of batch data that are rejected during derivation, by the kind of data:
+// malformed_frames, invalid_frame, undecodable_bundle, undecodable_channel and malformed_blob.
+// Transactions to the batch inbox that are rejected are counted by droppedInboxTxs, incomplete channels by
+// droppedChannels, and rejected batches by the derive/batches/<validity>/<reason> counters of FilterBatches.
+func rejectedData(kind string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("derive/rejected/"+kind, nil)
+}
+
+// BatchValidity is the outcome of checking a batch against the epoch that is being derived.
+type BatchValidity uint8
+
+const (
+	// BatchDrop is an invalid batch, it is ignored.
+	BatchDrop BatchValidity = iota
+	// BatchAccept is a valid batch of the epoch.
+	BatchAccept
+	// BatchFuture is a batch of a later epoch, it is checked again when that epoch is derived.
+	BatchFuture
+)
+
+func (v BatchValidity) String() string {
+	switch v {
+	case BatchDrop:
+		return "drop"
+	case BatchAccept:
+		return "accept"
+	case BatchFuture:
+		return "future"
+	default:
+		return fmt.Sprintf("BatchValidity(%d)", uint8(v))
+	}
+}
+
+// BatchReason is the machine-readable reason of the validity of a batch, used in logs and metrics.
+type BatchReason string
+
+const (
+	BatchValid              BatchReason = "valid"
+	BatchPastEpoch          BatchReason = "past_epoch"
+	BatchFutureEpoch        BatchReason = "future_epoch"
+	BatchMisalignedTime     BatchReason = "misaligned_timestamp"
+	BatchOlderThanSafeHead  BatchReason = "older_than_safe_head"
+	BatchBeyondDrift        BatchReason = "beyond_sequencer_drift"
+	BatchEmptyTransaction   BatchReason = "empty_transaction"
+	BatchDepositTransaction BatchReason = "deposit_transaction"
+	BatchDuplicate          BatchReason = "duplicate"
+)
+
+// FilterBatches returns the valid batches of the epoch, the first batch of each L2 block timestamp.
+// The validity of every batch is logged, and counted in the derive/batches/<validity>/<reason> metrics
+// if count returns true for the batch, or if count is nil. The sequencing windows of the epochs overlap,
+// so count selects the batches that were not counted with a previous epoch.
+func FilterBatches(config *rollup.Config, epoch rollup.Epoch, minL2Time uint64, maxL2Time uint64, batches []*BatchData, count func(batch *BatchData) bool, log log.Logger) (out []*BatchData) {
 	uniqueTime := make(map[uint64]struct{})
 	for _, batch := range batches {
-		if !ValidBatch(batch, config, epoch, minL2Time, maxL2Time) {
-			continue
-		}
+		validity, reason := CheckBatch(batch, config, epoch, minL2Time, maxL2Time)
 		// Check if we have already seen a batch for this L2 block
-		if _, ok := uniqueTime[batch.Timestamp]; ok {
+		if _, ok := uniqueTime[batch.Timestamp]; ok && validity == BatchAccept {
 			// block already exists, batch is duplicate (first batch persists, others are ignored)
-			continue
+			validity, reason = BatchDrop, BatchDuplicate
+		}
+		if count == nil || count(batch) {
+			metrics.GetOrRegisterCounter(fmt.Sprintf("derive/batches/%s/%s", validity, reason), nil).Inc(1)
+		}
+		switch validity {
+		case BatchAccept:
+			uniqueTime[batch.Timestamp] = struct{}{}
+			out = append(out, batch)
+		case BatchFuture:
+			log.Debug("Batch is for a later epoch", "epoch", epoch, "batch_epoch", batch.Epoch, "timestamp", batch.Timestamp, "reason", reason)
+		default:
+			// the sequencing windows overlap, so the batches of past epochs are seen again with every later epoch
+			if reason == BatchPastEpoch {
+				log.Debug("Dropping batch of a past epoch", "epoch", epoch, "batch_epoch", batch.Epoch, "timestamp", batch.Timestamp)
+				break
+			}
+			log.Warn("Dropping invalid batch", "epoch", epoch, "batch_epoch", batch.Epoch, "timestamp", batch.Timestamp,
+				"txs", len(batch.Transactions), "reason", reason)
 		}
-		uniqueTime[batch.Timestamp] = struct{}{}
-		out = append(out, batch)
 	}
 	return
 }
 
+// ValidBatch returns true if the batch is a valid batch of the epoch, see CheckBatch.
 func ValidBatch(batch *BatchData, config *rollup.Config, epoch rollup.Epoch, minL2Time uint64, maxL2Time uint64) bool {
-	if batch.Epoch != epoch {
-		// Batch was tagged for past or future epoch,
-		// i.e. it was included too late or depends on the given L1 block to be processed first.
-		return false
+	validity, _ := CheckBatch(batch, config, epoch, minL2Time, maxL2Time)
+	return validity == BatchAccept
+}
+
+// CheckBatch classifies the batch for the epoch, with L2 blocks from minL2Time (the block after the safe head)
+// up to but excluding maxL2Time, and returns the reason of the classification.
+func CheckBatch(batch *BatchData, config *rollup.Config, epoch rollup.Epoch, minL2Time uint64, maxL2Time uint64) (BatchValidity, BatchReason) {
+	if batch.Epoch < epoch {
+		// Batch was tagged for a past epoch, i.e. it was included too late.
+		return BatchDrop, BatchPastEpoch
+	}
+	if batch.Epoch > epoch {
+		// Batch depends on a later L1 block to be processed first.
+		return BatchFuture, BatchFutureEpoch
 	}
 	if (batch.Timestamp-config.Genesis.L2Time)%config.BlockTime != 0 {
-		return false // bad timestamp, not a multiple of the block time
+		return BatchDrop, BatchMisalignedTime // bad timestamp, not a multiple of the block time
 	}
 	if batch.Timestamp < minL2Time {
-		return false // old batch
+		return BatchDrop, BatchOlderThanSafeHead // old batch
 	}
 	// limit timestamp upper bound to avoid huge amount of empty blocks
 	if batch.Timestamp >= maxL2Time {
-		return false // too far in future
+		return BatchDrop, BatchBeyondDrift // too far in future
 	}
 	for _, txBytes := range batch.Transactions {
 		if len(txBytes) == 0 {
-			return false // transaction data must not be empty
+			return BatchDrop, BatchEmptyTransaction // transaction data must not be empty
 		}
 		if txBytes[0] == types.DepositTxType {
-			return false // sequencers may not embed any deposits into batch data
+			return BatchDrop, BatchDepositTransaction // sequencers may not embed any deposits into batch data
 		}
 	}
-	return true
+	return BatchAccept, BatchValid
 }
 
 type L2Info interface {
 	Time() uint64
 }
 
-// FillMissingBatches turns a collection of batches to the input batches for a series of blocks
+// FillMissingBatches turns a collection of batches to the input batches for a series of blocks.
+// Missing batches are replaced with empty batches: if there are no batches at all,
+// the epoch is filled with empty batches up to the next L1 block time (and at least 1).
 func FillMissingBatches(batches []*BatchData, epoch, blockTime, minL2Time, nextL1Time uint64) []*BatchData {
 	m := make(map[uint64]*BatchData)
 	// The number of L2 blocks per sequencing window is variable, we do not immediately fill to maxL2Time:
@@ -285,27 +388,11 @@ func FillMissingBatches(batches []*BatchData, epoch, blockTime, minL2Time, nextL
 	return out
 }
 
-func L1InfoDepositBytes(l2BlockHeight uint64, l1Info L1Info) (hexutil.Bytes, error) {
-	l1Tx := types.NewTx(L1InfoDeposit(l2BlockHeight, l1Info))
+func L1InfoDepositBytes(l2BlockHeight uint64, seqNumber uint64, l1Info L1Info, sysCfg rollup.SystemConfig) (hexutil.Bytes, error) {
+	l1Tx := types.NewTx(L1InfoDeposit(l2BlockHeight, seqNumber, l1Info, sysCfg))
 	opaqueL1Tx, err := l1Tx.MarshalBinary()
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode L1 info tx")
 	}
 	return opaqueL1Tx, nil
 }
-
-func DeriveDeposits(l2BlockHeight uint64, receipts []*types.Receipt) ([]hexutil.Bytes, error) {
-	userDeposits, err := UserDeposits(l2BlockHeight, receipts)
-	if err != nil {
-		return nil, fmt.Errorf("failed to derive user deposits: %v", err)
-	}
-	encodedTxs := make([]hexutil.Bytes, 0, len(userDeposits))
-	for i, tx := range userDeposits {
-		opaqueTx, err := types.NewTx(tx).MarshalBinary()
-		if err != nil {
-			return nil, fmt.Errorf("failed to encode user tx %d", i)
-		}
-		encodedTxs = append(encodedTxs, opaqueTx)
-	}
-	return encodedTxs, nil
-}
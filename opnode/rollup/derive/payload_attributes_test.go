@@ -7,8 +7,10 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
 
 	"github.com/stretchr/testify/assert"
 
@@ -189,7 +191,7 @@ func TestDeriveUserDeposits(t *testing.T) {
 					Logs:   logs,
 				})
 			}
-			got, err := UserDeposits(testCase.height, receipts)
+			got, err := UserDeposits(DepositContractAddr, testCase.height, receipts)
 			assert.NoError(t, err)
 			assert.Equal(t, len(got), len(expectedDeposits))
 			for d, depTx := range got {
@@ -207,6 +209,8 @@ type ValidBatchTestCase struct {
 	MaxL2Time uint64
 	Batch     BatchData
 	Valid     bool
+	Validity  BatchValidity
+	Reason    BatchReason
 }
 
 func TestValidBatch(t *testing.T) {
@@ -221,7 +225,9 @@ func TestValidBatch(t *testing.T) {
 				Timestamp:    43,
 				Transactions: []hexutil.Bytes{{0x01, 0x13, 0x37}, {0x02, 0x13, 0x37}},
 			}},
-			Valid: true,
+			Valid:    true,
+			Validity: BatchAccept,
+			Reason:   BatchValid,
 		},
 		{
 			Name:      "ignored epoch",
@@ -233,7 +239,23 @@ func TestValidBatch(t *testing.T) {
 				Timestamp:    43,
 				Transactions: nil,
 			}},
-			Valid: false,
+			Valid:    false,
+			Validity: BatchDrop,
+			Reason:   BatchPastEpoch,
+		},
+		{
+			Name:      "future epoch",
+			Epoch:     123,
+			MinL2Time: 43,
+			MaxL2Time: 52,
+			Batch: BatchData{BatchV1: BatchV1{
+				Epoch:        124,
+				Timestamp:    43,
+				Transactions: nil,
+			}},
+			Valid:    false,
+			Validity: BatchFuture,
+			Reason:   BatchFutureEpoch,
 		},
 		{
 			Name:      "too old",
@@ -245,7 +267,9 @@ func TestValidBatch(t *testing.T) {
 				Timestamp:    42,
 				Transactions: nil,
 			}},
-			Valid: false,
+			Valid:    false,
+			Validity: BatchDrop,
+			Reason:   BatchMisalignedTime, // timestamp is checked for alignment first
 		},
 		{
 			Name:      "too new",
@@ -257,7 +281,37 @@ func TestValidBatch(t *testing.T) {
 				Timestamp:    52,
 				Transactions: nil,
 			}},
-			Valid: false,
+			Valid:    false,
+			Validity: BatchDrop,
+			Reason:   BatchMisalignedTime, // timestamp is checked for alignment first
+		},
+		{
+			Name:      "too old, aligned",
+			Epoch:     123,
+			MinL2Time: 43,
+			MaxL2Time: 52,
+			Batch: BatchData{BatchV1: BatchV1{
+				Epoch:        123,
+				Timestamp:    41,
+				Transactions: nil,
+			}},
+			Valid:    false,
+			Validity: BatchDrop,
+			Reason:   BatchOlderThanSafeHead,
+		},
+		{
+			Name:      "too new, aligned",
+			Epoch:     123,
+			MinL2Time: 43,
+			MaxL2Time: 52,
+			Batch: BatchData{BatchV1: BatchV1{
+				Epoch:        123,
+				Timestamp:    53,
+				Transactions: nil,
+			}},
+			Valid:    false,
+			Validity: BatchDrop,
+			Reason:   BatchBeyondDrift,
 		},
 		{
 			Name:      "wrong time alignment",
@@ -269,7 +323,9 @@ func TestValidBatch(t *testing.T) {
 				Timestamp:    46,
 				Transactions: nil,
 			}},
-			Valid: false,
+			Valid:    false,
+			Validity: BatchDrop,
+			Reason:   BatchMisalignedTime,
 		},
 		{
 			Name:      "good time alignment",
@@ -281,7 +337,9 @@ func TestValidBatch(t *testing.T) {
 				Timestamp:    51, // 31 + 2*10
 				Transactions: nil,
 			}},
-			Valid: true,
+			Valid:    true,
+			Validity: BatchAccept,
+			Reason:   BatchValid,
 		},
 		{
 			Name:      "empty tx",
@@ -293,7 +351,9 @@ func TestValidBatch(t *testing.T) {
 				Timestamp:    43,
 				Transactions: []hexutil.Bytes{{}},
 			}},
-			Valid: false,
+			Valid:    false,
+			Validity: BatchDrop,
+			Reason:   BatchEmptyTransaction,
 		},
 		{
 			Name:      "sneaky deposit",
@@ -305,7 +365,9 @@ func TestValidBatch(t *testing.T) {
 				Timestamp:    43,
 				Transactions: []hexutil.Bytes{{0x01}, {types.DepositTxType, 0x13, 0x37}, {0xc0, 0x13, 0x37}},
 			}},
-			Valid: false,
+			Valid:    false,
+			Validity: BatchDrop,
+			Reason:   BatchDepositTransaction,
 		},
 	}
 	conf := rollup.Config{
@@ -321,6 +383,61 @@ func TestValidBatch(t *testing.T) {
 			if got != testCase.Valid {
 				t.Fatalf("case %v was expected to return %v, but got %v", testCase, testCase.Valid, got)
 			}
+			validity, reason := CheckBatch(&testCase.Batch, &conf, testCase.Epoch, testCase.MinL2Time, testCase.MaxL2Time)
+			assert.Equal(t, testCase.Validity, validity)
+			assert.Equal(t, testCase.Reason, reason)
 		})
 	}
 }
+
+func TestFilterBatches(t *testing.T) {
+	conf := rollup.Config{BlockTime: 2}
+	batch := func(epoch rollup.Epoch, timestamp uint64, txs ...hexutil.Bytes) *BatchData {
+		return &BatchData{BatchV1{Epoch: epoch, Timestamp: timestamp, Transactions: txs}}
+	}
+	a := batch(5, 100, []byte{1})
+	b := batch(5, 102)
+	batches := []*BatchData{
+		a,
+		batch(4, 100),            // past epoch
+		batch(6, 104),            // future epoch
+		batch(5, 100, []byte{2}), // duplicate
+		b,
+		batch(5, 98), // older than safe head
+	}
+	out := FilterBatches(&conf, 5, 100, 110, batches, nil, testlog.Logger(t, log.LvlError))
+	assert.Equal(t, []*BatchData{a, b}, out)
+}
+
+func TestFillMissingBatches(t *testing.T) {
+	batch := func(epoch uint64, timestamp uint64, txs ...hexutil.Bytes) *BatchData {
+		return &BatchData{BatchV1{Epoch: rollup.Epoch(epoch), Timestamp: timestamp, Transactions: txs}}
+	}
+	timestamps := func(batches []*BatchData) (out []uint64) {
+		for _, b := range batches {
+			out = append(out, b.Timestamp)
+		}
+		return
+	}
+
+	t.Run("no batches, next L1 block soon", func(t *testing.T) {
+		out := FillMissingBatches(nil, 5, 2, 100, 101)
+		assert.Equal(t, []*BatchData{batch(5, 100)}, out, "at least one deposit-only block per epoch")
+	})
+	t.Run("no batches, keep up with L1 time", func(t *testing.T) {
+		out := FillMissingBatches(nil, 5, 2, 100, 110)
+		assert.Equal(t, []uint64{100, 102, 104, 106, 108}, timestamps(out))
+		for _, b := range out {
+			assert.Empty(t, b.Transactions, "forced blocks must not have sequenced transactions")
+			assert.Equal(t, rollup.Epoch(5), b.Epoch)
+		}
+	})
+	t.Run("gaps between batches", func(t *testing.T) {
+		a := batch(5, 102, hexutil.Bytes{0x01})
+		b := batch(5, 106, hexutil.Bytes{0x02})
+		out := FillMissingBatches([]*BatchData{b, a}, 5, 2, 100, 101)
+		assert.Equal(t, []uint64{100, 102, 104, 106}, timestamps(out))
+		assert.Equal(t, a, out[1])
+		assert.Equal(t, b, out[3])
+	})
+}
@@ -0,0 +1,300 @@
+package derive
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Derivation pipeline
+// The L2 chain is derived from L1 in stages, each consuming the output of the previous stage:
+//
+// L1Traversal → L1Retrieval → ChannelBank → batch queue → attributes builder → engine queue
+//
+// - L1Traversal buffers the L1 blocks of the upcoming sequencing windows.
+// - L1Retrieval fetches the batch data of the L1 blocks from the DataSource, once per L1 block.
+// - ChannelBankStage reassembles the channels of the batch data, with a ChannelBank of each sequencing window,
+//   and parses the batch data of each L1 block once.
+// - The batch queue orders and filters the batches of the epoch, see FilterBatches and FillMissingBatches.
+// - The attributes builder creates the payload attributes of the batches, and the engine queue
+//   inserts them into the engine. Both are implemented by the rollup driver.
+//
+// Sequencing windows of consecutive epochs overlap, so stages keep the state of the L1 blocks they processed.
+// Stages that keep state implement ResettableStage: on a L1 reorg, the stages are reset back to the last
+// common L1 block of the old and new chain, and only the state of the L1 blocks after it is dropped.
+
+// ResettableStage is a stage of the derivation pipeline that keeps state of the L1 blocks it processed.
+type ResettableStage interface {
+	// Reset drops the state of the L1 blocks after the given L1 base block, which must be canonical.
+	Reset(l1Base eth.BlockID)
+}
+
+// L1Traversal buffers the next L1 blocks to derive L2 blocks from, with increasing block height.
+// The zero value is an empty buffer.
+type L1Traversal struct {
+	blocks []eth.BlockID
+}
+
+var _ ResettableStage = (*L1Traversal)(nil)
+
+// Blocks returns the buffered L1 blocks.
+func (lt *L1Traversal) Blocks() []eth.BlockID {
+	return lt.blocks
+}
+
+// Len returns the number of buffered L1 blocks.
+func (lt *L1Traversal) Len() int {
+	return len(lt.blocks)
+}
+
+// End returns the last buffered L1 block, or false if there are no buffered blocks.
+func (lt *L1Traversal) End() (eth.BlockID, bool) {
+	if len(lt.blocks) == 0 {
+		return eth.BlockID{}, false
+	}
+	return lt.blocks[len(lt.blocks)-1], true
+}
+
+// Extend adds the next L1 blocks to the buffer. The blocks must extend the last buffered block.
+func (lt *L1Traversal) Extend(ids ...eth.BlockID) {
+	lt.blocks = append(lt.blocks, ids...)
+}
+
+// Window returns the first size buffered L1 blocks, or false if fewer blocks are buffered.
+func (lt *L1Traversal) Window(size uint64) ([]eth.BlockID, bool) {
+	if uint64(len(lt.blocks)) < size {
+		return nil, false
+	}
+	return lt.blocks[:size], true
+}
+
+// Advance drops the first buffered L1 block, once the epoch of the block has been derived.
+func (lt *L1Traversal) Advance() {
+	if len(lt.blocks) > 0 {
+		lt.blocks = lt.blocks[1:]
+	}
+}
+
+// Reset keeps the buffered L1 blocks up to and including the given base block.
+// All blocks are dropped if the base block is not buffered.
+func (lt *L1Traversal) Reset(l1Base eth.BlockID) {
+	for i, id := range lt.blocks {
+		if id == l1Base {
+			lt.blocks = lt.blocks[:i+1]
+			return
+		}
+	}
+	lt.blocks = nil
+}
+
+type retrievalKey struct {
+	block       common.Hash
+	batcherAddr common.Address
+}
+
+type retrievedData struct {
+	number uint64
+	items  [][]byte
+	// txs are the hashes of the L1 transactions of the items, nil if the source does not identify them
+	txs []common.Hash
+}
+
+// L1Retrieval fetches the batch data of L1 blocks from a DataSource, and keeps it for the
+// sequencing windows that overlap the L1 blocks, so the data of each L1 block is fetched only once.
+type L1Retrieval struct {
+	src  DataSource
+	data map[retrievalKey]retrievedData
+}
+
+var _ BatchTxSource = (*L1Retrieval)(nil)
+var _ ResettableStage = (*L1Retrieval)(nil)
+
+func NewL1Retrieval(src DataSource) *L1Retrieval {
+	return &L1Retrieval{src: src, data: make(map[retrievalKey]retrievedData)}
+}
+
+// BatchData returns the batch data of the window, and fetches the batch data of the L1 blocks that were not fetched before.
+// The data of L1 blocks before the window is dropped: windows are expected to move forward, unless reset.
+func (lr *L1Retrieval) BatchData(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, error) {
+	data, _, err := lr.BatchDataWithTxs(ctx, window, batcherAddr)
+	return data, err
+}
+
+// BatchDataWithTxs returns the batch data of the window like BatchData, and the hashes of the L1 transactions of the items.
+// The hashes of an L1 block are nil if the source is not a BatchTxSource.
+func (lr *L1Retrieval) BatchDataWithTxs(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, [][]common.Hash, error) {
+	if len(window) == 0 {
+		return nil, nil, nil
+	}
+	for k, v := range lr.data {
+		if v.number < window[0].Number {
+			delete(lr.data, k)
+		}
+	}
+	var missing []eth.BlockID
+	for _, id := range window {
+		if _, ok := lr.data[retrievalKey{id.Hash, batcherAddr}]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		var fetched [][][]byte
+		var txs [][]common.Hash
+		var err error
+		if txSrc, ok := lr.src.(BatchTxSource); ok {
+			fetched, txs, err = txSrc.BatchDataWithTxs(ctx, missing, batcherAddr)
+		} else {
+			fetched, err = lr.src.BatchData(ctx, missing, batcherAddr)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(fetched) != len(missing) {
+			return nil, nil, fmt.Errorf("data source returned batch data of %d L1 blocks, expected %d", len(fetched), len(missing))
+		}
+		for i, id := range missing {
+			data := retrievedData{number: id.Number, items: fetched[i]}
+			if i < len(txs) {
+				data.txs = txs[i]
+			}
+			lr.data[retrievalKey{id.Hash, batcherAddr}] = data
+		}
+	}
+	out := make([][][]byte, len(window))
+	txs := make([][]common.Hash, len(window))
+	for i, id := range window {
+		data := lr.data[retrievalKey{id.Hash, batcherAddr}]
+		out[i], txs[i] = data.items, data.txs
+	}
+	return out, txs, nil
+}
+
+// Reset drops the batch data of the L1 blocks after the given base block.
+func (lr *L1Retrieval) Reset(l1Base eth.BlockID) {
+	for k, v := range lr.data {
+		if v.number > l1Base.Number {
+			delete(lr.data, k)
+		}
+	}
+}
+
+// L1DataPosition is the position of an item of batch data on L1.
+type L1DataPosition struct {
+	L1   eth.BlockID
+	Item int
+	// Tx is the hash of the L1 transaction of the item, zero if the data source does not identify it
+	Tx common.Hash
+}
+
+type bankedBlock struct {
+	id eth.BlockID
+	// txs are the hashes of the L1 transactions of the items, nil if the source does not identify them
+	txs []common.Hash
+	// items are the parsed items of the batch data, to decode them again in the windows that overlap the block
+	items []parsedItem
+}
+
+// ChannelBankStage decodes the batches of the sequencing windows. Like BatchesFromData, channels are reassembled
+// in a channel bank of the window: only the frames of the L1 blocks of the window are part of a channel, so the
+// batches of a window do not depend on the windows that were derived before it, or on when the node started.
+// The batch data of each L1 block is parsed once, and kept for the windows that overlap the block.
+type ChannelBankStage struct {
+	config *rollup.Config
+	log    log.Logger
+
+	// blocks are the kept L1 blocks, by increasing number
+	blocks []bankedBlock
+}
+
+var _ ResettableStage = (*ChannelBankStage)(nil)
+
+func NewChannelBankStage(config *rollup.Config, log log.Logger) *ChannelBankStage {
+	return &ChannelBankStage{config: config, log: log}
+}
+
+// Batches returns the batches of the window in the order they are decoded, and the L1 positions of the data
+// of each batch. The batch data and the transactions of the items are the ones of the window, see L1Retrieval.
+// Windows are expected to move forward, unless reset: the kept L1 blocks before the window are dropped.
+func (s *ChannelBankStage) Batches(window []eth.BlockID, data [][][]byte, txs [][]common.Hash) ([]*BatchData, map[*BatchData][]L1DataPosition) {
+	if len(window) == 0 {
+		return nil, nil
+	}
+	for len(s.blocks) > 0 && s.blocks[0].id.Number < window[0].Number {
+		s.blocks = s.blocks[1:]
+	}
+	bank := NewChannelBank(s.config)
+	var out []*BatchData
+	dataPositions := make(map[*BatchData][]DataPosition)
+	refs := make(map[uint64]bankedBlock, len(window))
+	for i, id := range window {
+		b, ok := s.kept(id)
+		if ok {
+			out = append(out, replayL1Block(s.config, bank, id.Number, b.items, dataPositions, s.log)...)
+		} else {
+			var blockTxs []common.Hash
+			if i < len(txs) {
+				blockTxs = txs[i]
+			}
+			var batches []*BatchData
+			batches, b = s.ingest(bank, id, data[i], blockTxs, dataPositions)
+			out = append(out, batches...)
+		}
+		refs[id.Number] = *b
+	}
+	positions := make(map[*BatchData][]L1DataPosition, len(dataPositions))
+	for batch, ps := range dataPositions {
+		l1Positions := make([]L1DataPosition, 0, len(ps))
+		for _, p := range ps {
+			b := refs[uint64(p.Block)]
+			pos := L1DataPosition{L1: b.id, Item: p.Item}
+			if p.Item < len(b.txs) {
+				pos.Tx = b.txs[p.Item]
+			}
+			l1Positions = append(l1Positions, pos)
+		}
+		positions[batch] = l1Positions
+	}
+	return out, positions
+}
+
+// kept returns the kept L1 block. A kept block with the same number but another hash is dropped, with the blocks after it.
+func (s *ChannelBankStage) kept(id eth.BlockID) (*bankedBlock, bool) {
+	for i := range s.blocks {
+		if s.blocks[i].id.Number != id.Number {
+			continue
+		}
+		if s.blocks[i].id == id {
+			return &s.blocks[i], true
+		}
+		s.log.Warn("Channel bank has another L1 block, dropping it", "kept", s.blocks[i].id, "block", id)
+		s.blocks = s.blocks[:i]
+		return nil, false
+	}
+	return nil, false
+}
+
+// ingest decodes the batches of a L1 block that is not kept yet, and keeps its parsed items.
+// Kept blocks that do not precede the block are dropped, the kept blocks are consecutive.
+func (s *ChannelBankStage) ingest(bank *ChannelBank, id eth.BlockID, items [][]byte, txs []common.Hash, positions map[*BatchData][]DataPosition) ([]*BatchData, *bankedBlock) {
+	if n := len(s.blocks); n > 0 && s.blocks[n-1].id.Number+1 != id.Number {
+		s.log.Warn("L1 block does not follow the kept L1 blocks, dropping them", "block", id, "last", s.blocks[n-1].id)
+		s.blocks = nil
+	}
+	batches, parsed := ingestL1Block(s.config, bank, id.Number, items, positions, s.log)
+	s.blocks = append(s.blocks, bankedBlock{id: id, txs: txs, items: parsed})
+	return batches, &s.blocks[len(s.blocks)-1]
+}
+
+// Reset drops the kept L1 blocks after the given base block.
+func (s *ChannelBankStage) Reset(l1Base eth.BlockID) {
+	for i, b := range s.blocks {
+		if b.id.Number > l1Base.Number {
+			s.blocks = s.blocks[:i]
+			return
+		}
+	}
+}
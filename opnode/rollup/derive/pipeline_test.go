@@ -0,0 +1,184 @@
+package derive
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func testBlockID(number uint64, fork byte) eth.BlockID {
+	return eth.BlockID{Hash: common.Hash{fork, byte(number)}, Number: number}
+}
+
+func TestL1Traversal(t *testing.T) {
+	var lt L1Traversal
+	_, ok := lt.End()
+	require.False(t, ok)
+	a, b, c, d := testBlockID(1, 'a'), testBlockID(2, 'a'), testBlockID(3, 'a'), testBlockID(4, 'a')
+	lt.Extend(a, b, c)
+	_, ok = lt.Window(4)
+	require.False(t, ok, "not enough blocks")
+	window, ok := lt.Window(2)
+	require.True(t, ok)
+	require.Equal(t, []eth.BlockID{a, b}, window)
+	lt.Extend(d)
+	lt.Advance()
+	end, ok := lt.End()
+	require.True(t, ok)
+	require.Equal(t, d, end)
+	require.Equal(t, []eth.BlockID{b, c, d}, lt.Blocks())
+
+	lt.Reset(c)
+	require.Equal(t, []eth.BlockID{b, c}, lt.Blocks(), "blocks after the base are dropped")
+	lt.Reset(testBlockID(3, 'b'))
+	require.Empty(t, lt.Blocks(), "all blocks are dropped if the base is unknown")
+}
+
+type countingDataSource struct {
+	fetched []eth.BlockID
+}
+
+func (cs *countingDataSource) BatchData(ctx context.Context, window []eth.BlockID, batcherAddr common.Address) ([][][]byte, error) {
+	cs.fetched = append(cs.fetched, window...)
+	out := make([][][]byte, len(window))
+	for i, id := range window {
+		out[i] = [][]byte{id.Hash[:], batcherAddr[:]}
+	}
+	return out, nil
+}
+
+func TestL1Retrieval(t *testing.T) {
+	src := &countingDataSource{}
+	lr := NewL1Retrieval(src)
+	ctx := context.Background()
+	batcher := common.Address{0xbb}
+	a, b, c, d := testBlockID(1, 'a'), testBlockID(2, 'a'), testBlockID(3, 'a'), testBlockID(4, 'a')
+
+	data, err := lr.BatchData(ctx, []eth.BlockID{a, b, c}, batcher)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{c.Hash[:], batcher[:]}, data[2])
+	data, err = lr.BatchData(ctx, []eth.BlockID{b, c, d}, batcher)
+	require.NoError(t, err)
+	require.Len(t, data, 3)
+	require.Equal(t, [][]byte{d.Hash[:], batcher[:]}, data[2])
+	require.Equal(t, []eth.BlockID{a, b, c, d}, src.fetched, "overlapping windows fetch each block once")
+
+	// A reorg replaces the blocks after b
+	src.fetched = nil
+	lr.Reset(b)
+	c2 := testBlockID(3, 'b')
+	data, err = lr.BatchData(ctx, []eth.BlockID{b, c2}, batcher)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{c2.Hash[:], batcher[:]}, data[1])
+	require.Equal(t, []eth.BlockID{c2}, src.fetched, "only the blocks after the reorg base are fetched again")
+
+	// The data depends on the batcher
+	src.fetched = nil
+	other := common.Address{0xcc}
+	data, err = lr.BatchData(ctx, []eth.BlockID{b}, other)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{b.Hash[:], other[:]}, data[0])
+	require.Equal(t, []eth.BlockID{b}, src.fetched)
+
+	// The source does not identify the transactions of the data
+	_, txs, err := lr.BatchDataWithTxs(ctx, []eth.BlockID{b}, other)
+	require.NoError(t, err)
+	require.Equal(t, [][]common.Hash{nil}, txs)
+}
+
+func TestChannelBankStage(t *testing.T) {
+	config := &rollup.Config{BlockTime: 2, ChannelTimeout: 10}
+	a := &BatchData{BatchV1{Epoch: 1, Timestamp: 2, Transactions: []hexutil.Bytes{{0xa}}}}
+	b := &BatchData{BatchV1{Epoch: 1, Timestamp: 4, Transactions: []hexutil.Bytes{{0xb}}}}
+	var buf bytes.Buffer
+	require.NoError(t, EncodeBatches(config, []*BatchData{a, b}, &buf))
+	ch := buf.Bytes()
+	size := len(ch)/2 + 1
+	frame := func(n int) []byte {
+		end := (n + 1) * size
+		if end > len(ch) {
+			end = len(ch)
+		}
+		f := Frame{ID: ChannelID{1}, FrameNumber: uint16(n), Data: ch[n*size : end], IsLast: end == len(ch)}
+		enc, err := f.MarshalBinary()
+		require.NoError(t, err)
+		return append([]byte{ChannelFramesType}, enc...)
+	}
+	b1, b2, b3, b3b := testBlockID(1, 'a'), testBlockID(2, 'a'), testBlockID(3, 'a'), testBlockID(3, 'b')
+	data := map[eth.BlockID][][]byte{b1: {frame(0)}, b2: nil, b3: {{0x00}, frame(1)}, b3b: nil}
+	batches := func(s *ChannelBankStage, window ...eth.BlockID) ([]*BatchData, map[*BatchData][]L1DataPosition) {
+		var blocks [][][]byte
+		var txs [][]common.Hash
+		for _, id := range window {
+			blocks = append(blocks, data[id])
+			txs = append(txs, []common.Hash{{byte(id.Number), 0}, {byte(id.Number), 1}})
+		}
+		return s.Batches(window, blocks, txs)
+	}
+
+	s := NewChannelBankStage(config, testlog.Logger(t, log.LvlError))
+	out, positions := batches(s, b1, b2, b3)
+	require.Equal(t, []*BatchData{a, b}, out, "the channel spans the L1 blocks of the window")
+	require.Equal(t, []L1DataPosition{{L1: b1, Item: 0, Tx: common.Hash{1, 0}}, {L1: b3, Item: 1, Tx: common.Hash{3, 1}}}, positions[out[0]])
+	out, _ = s.Batches([]eth.BlockID{b1, b2, b3}, make([][][]byte, 3), nil)
+	require.Equal(t, []*BatchData{a, b}, out, "the batch data of kept L1 blocks is parsed once")
+
+	// After a reorg of the L1 block that completes the channel, the kept L1 blocks before it are decoded again
+	s.Reset(b2)
+	out, _ = batches(s, b1, b2, b3b)
+	require.Empty(t, out)
+	s.Reset(b2)
+	out, _ = batches(s, b1, b2, b3)
+	require.Equal(t, []*BatchData{a, b}, out)
+
+	// The channel bank is scoped to the window: the frames before the window are not part of the channel
+	out, _ = batches(s, b2, b3)
+	require.Empty(t, out)
+}
+
+// TestChannelBankStageStart checks that the batches of a window do not depend on the windows that were derived before:
+// a stage that derived the previous windows and a stage that starts at the window decode the same batches.
+func TestChannelBankStageStart(t *testing.T) {
+	config := &rollup.Config{BlockTime: 2, SeqWindowSize: 4, ChannelTimeout: 10}
+	var buf bytes.Buffer
+	require.NoError(t, EncodeBatches(config, []*BatchData{{BatchV1{Epoch: 4, Timestamp: 2, Transactions: []hexutil.Bytes{{0xa}}}}}, &buf))
+	ch := buf.Bytes()
+	frame := func(n uint16, data []byte, last bool) []byte {
+		enc, err := (&Frame{ID: ChannelID{1}, FrameNumber: n, Data: data, IsLast: last}).MarshalBinary()
+		require.NoError(t, err)
+		return append([]byte{ChannelFramesType}, enc...)
+	}
+	// The first frame is in L1 block 4, the last frame in L1 block 6
+	data := map[uint64][][]byte{4: {frame(0, ch[:len(ch)/2], false)}, 6: {frame(1, ch[len(ch)/2:], true)}}
+	window := func(start uint64) ([]eth.BlockID, [][][]byte) {
+		var ids []eth.BlockID
+		var blocks [][][]byte
+		for n := start; n < start+config.SeqWindowSize; n++ {
+			ids = append(ids, testBlockID(n, 'a'))
+			blocks = append(blocks, data[n])
+		}
+		return ids, blocks
+	}
+
+	running := NewChannelBankStage(config, testlog.Logger(t, log.LvlError))
+	for start := uint64(1); start <= 8; start++ {
+		ids, blocks := window(start)
+		out, positions := running.Batches(ids, blocks, nil)
+		fresh := NewChannelBankStage(config, testlog.Logger(t, log.LvlError))
+		freshOut, freshPositions := fresh.Batches(ids, blocks, nil)
+		require.Equal(t, freshOut, out, "window %d", start)
+		require.Equal(t, len(freshPositions), len(positions), "window %d", start)
+		for i := range out {
+			require.Equal(t, freshPositions[freshOut[i]], positions[out[i]], "window %d", start)
+		}
+		require.Equal(t, start >= 3 && start <= 4, len(out) == 1, "window %d has the whole channel", start)
+	}
+}
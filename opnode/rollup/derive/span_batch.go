@@ -0,0 +1,123 @@
+package derive
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// MaxSpanBatchBlocks is the maximum number of L2 blocks of a span batch.
+const MaxSpanBatchBlocks = 10_000
+
+// SpanBatch is a batch of a contiguous span of L2 blocks: the blocks follow each other at the L2 block time,
+// and each block is in the same epoch as the block before it, or in the next epoch.
+// Instead of repeating the epoch and timestamp of every block, these are derived from the first block,
+// and the transactions of all blocks are listed together.
+type SpanBatch struct {
+	Epoch     rollup.Epoch // epoch of the first block
+	Timestamp uint64       // timestamp of the first block
+	// BlockCount is the number of L2 blocks of the span
+	BlockCount uint64
+	// EpochBits is a bitlist of the blocks, a bit is set if the block is in the epoch after the epoch of the block before it.
+	// The bit of the first block is unused.
+	EpochBits []byte
+	// NonEmptyBits is a bitlist of the blocks, a bit is set if the block has transactions.
+	NonEmptyBits []byte
+	// TxCounts is the number of transactions of each non-empty block
+	TxCounts []uint64
+	// Transactions is the transactions of all the blocks, in order
+	Transactions []hexutil.Bytes
+}
+
+func getBit(bits []byte, i uint64) bool {
+	return bits[i/8]&(1<<(i%8)) != 0
+}
+
+func setBit(bits []byte, i uint64) {
+	bits[i/8] |= 1 << (i % 8)
+}
+
+// NewSpanBatches groups the batches into span batches.
+// A new span starts at every batch that does not follow the previous batch at the given block time,
+// or that is more than one epoch ahead of it.
+func NewSpanBatches(blockTime uint64, batches []*BatchData) []*SpanBatch {
+	var out []*SpanBatch
+	for i := 0; i < len(batches); {
+		end := i + 1
+		for end < len(batches) && end-i < MaxSpanBatchBlocks {
+			prev, next := batches[end-1], batches[end]
+			if next.Timestamp != prev.Timestamp+blockTime || next.Epoch < prev.Epoch || next.Epoch > prev.Epoch+1 {
+				break
+			}
+			end++
+		}
+		out = append(out, newSpanBatch(batches[i:end]))
+		i = end
+	}
+	return out
+}
+
+func newSpanBatch(batches []*BatchData) *SpanBatch {
+	n := uint64(len(batches))
+	sb := &SpanBatch{
+		Epoch:        batches[0].Epoch,
+		Timestamp:    batches[0].Timestamp,
+		BlockCount:   n,
+		EpochBits:    make([]byte, (n+7)/8),
+		NonEmptyBits: make([]byte, (n+7)/8),
+	}
+	for i, b := range batches {
+		if i > 0 && b.Epoch != batches[i-1].Epoch {
+			setBit(sb.EpochBits, uint64(i))
+		}
+		if len(b.Transactions) > 0 {
+			setBit(sb.NonEmptyBits, uint64(i))
+			sb.TxCounts = append(sb.TxCounts, uint64(len(b.Transactions)))
+			sb.Transactions = append(sb.Transactions, b.Transactions...)
+		}
+	}
+	return sb
+}
+
+// Batches returns the batch of each block of the span, with blocks that follow each other at the given block time.
+func (sb *SpanBatch) Batches(blockTime uint64) ([]*BatchData, error) {
+	n := sb.BlockCount
+	if n == 0 {
+		return nil, errors.New("empty span")
+	}
+	if n > MaxSpanBatchBlocks {
+		return nil, fmt.Errorf("span of %d blocks exceeds max of %d blocks", n, MaxSpanBatchBlocks)
+	}
+	if uint64(len(sb.EpochBits)) != (n+7)/8 || uint64(len(sb.NonEmptyBits)) != (n+7)/8 {
+		return nil, fmt.Errorf("bitlists do not match span of %d blocks", n)
+	}
+	out := make([]*BatchData, 0, n)
+	epoch := sb.Epoch
+	txs := sb.Transactions
+	counts := sb.TxCounts
+	for i := uint64(0); i < n; i++ {
+		if i > 0 && getBit(sb.EpochBits, i) {
+			epoch++
+		}
+		batch := &BatchData{BatchV1{Epoch: epoch, Timestamp: sb.Timestamp + i*blockTime, Transactions: []hexutil.Bytes{}}}
+		if getBit(sb.NonEmptyBits, i) {
+			if len(counts) == 0 {
+				return nil, errors.New("missing transaction count of non-empty block")
+			}
+			count := counts[0]
+			counts = counts[1:]
+			if count == 0 || count > uint64(len(txs)) {
+				return nil, fmt.Errorf("invalid transaction count %d of block %d, %d transactions left", count, i, len(txs))
+			}
+			batch.Transactions = txs[:count]
+			txs = txs[count:]
+		}
+		out = append(out, batch)
+	}
+	if len(counts) != 0 || len(txs) != 0 {
+		return nil, fmt.Errorf("%d transaction counts and %d transactions left after the last block", len(counts), len(txs))
+	}
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package derive
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpanBatches(t *testing.T) {
+	config := &rollup.Config{BlockTime: 2}
+	batch := func(epoch rollup.Epoch, timestamp uint64, txs ...hexutil.Bytes) *BatchData {
+		if txs == nil {
+			txs = []hexutil.Bytes{}
+		}
+		return &BatchData{BatchV1{Epoch: epoch, Timestamp: timestamp, Transactions: txs}}
+	}
+	batches := []*BatchData{
+		batch(1, 10, []byte{1}, []byte{2}),
+		batch(1, 12),
+		batch(2, 14, []byte{3}),
+		batch(2, 16),
+		batch(3, 18),
+		batch(3, 20, []byte{4}),
+		// gap in time starts a new span
+		batch(5, 30, []byte{5}),
+		// skipped epoch starts a new span
+		batch(7, 32),
+	}
+	spans := NewSpanBatches(config.BlockTime, batches)
+	require.Len(t, spans, 3)
+	require.Equal(t, uint64(6), spans[0].BlockCount)
+	require.Equal(t, []byte{0b010100}, spans[0].EpochBits)
+	require.Equal(t, []byte{0b100101}, spans[0].NonEmptyBits)
+	require.Equal(t, []uint64{2, 1, 1}, spans[0].TxCounts)
+
+	var spanned, plain bytes.Buffer
+	require.NoError(t, EncodeBatchBundle(config, BatchBundleV1Type, SpanBatchV1Type, batches, &spanned))
+	require.NoError(t, EncodeBatchBundle(config, BatchBundleV1Type, BatchV1Type, batches, &plain))
+	require.Less(t, spanned.Len(), plain.Len())
+	out, err := DecodeBatches(config, &spanned)
+	require.NoError(t, err)
+	require.Equal(t, batches, out)
+
+	// A bundle can mix span batches and batches
+	v1, err := batches[0].MarshalBinary()
+	require.NoError(t, err)
+	span, err := rlp.EncodeToBytes(spans[1])
+	require.NoError(t, err)
+	payload, err := rlp.EncodeToBytes([][]byte{v1, append([]byte{SpanBatchV1Type}, span...)})
+	require.NoError(t, err)
+	out, err = DecodeBatches(config, bytes.NewReader(append([]byte{BatchBundleV1Type}, payload...)))
+	require.NoError(t, err)
+	require.Equal(t, []*BatchData{batches[0], batches[6]}, out)
+}
+
+func TestInvalidSpanBatch(t *testing.T) {
+	valid := SpanBatch{
+		Epoch:        1,
+		Timestamp:    10,
+		BlockCount:   2,
+		EpochBits:    []byte{0},
+		NonEmptyBits: []byte{0b10},
+		TxCounts:     []uint64{1},
+		Transactions: []hexutil.Bytes{{1}},
+	}
+	_, err := valid.Batches(2)
+	require.NoError(t, err)
+
+	for name, modify := range map[string]func(sb *SpanBatch){
+		"empty span":            func(sb *SpanBatch) { sb.BlockCount = 0 },
+		"too many blocks":       func(sb *SpanBatch) { sb.BlockCount = MaxSpanBatchBlocks + 1 },
+		"short bitlist":         func(sb *SpanBatch) { sb.BlockCount = 9 },
+		"missing tx count":      func(sb *SpanBatch) { sb.NonEmptyBits = []byte{0b11} },
+		"zero tx count":         func(sb *SpanBatch) { sb.TxCounts = []uint64{0} },
+		"tx count out of range": func(sb *SpanBatch) { sb.TxCounts = []uint64{2} },
+		"extra transactions":    func(sb *SpanBatch) { sb.Transactions = append(sb.Transactions, []byte{2}) },
+		"extra tx counts":       func(sb *SpanBatch) { sb.TxCounts = append(sb.TxCounts, 1) },
+	} {
+		sb := valid
+		modify(&sb)
+		_, err := sb.Batches(2)
+		require.Error(t, err, name)
+	}
+}
@@ -0,0 +1,129 @@
+package derive
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	ConfigUpdateEventABI     = "ConfigUpdate(uint256,uint8,bytes)"
+	ConfigUpdateEventABIHash = crypto.Keccak256Hash([]byte(ConfigUpdateEventABI))
+	ConfigUpdateEventVersion = common.Hash{}
+)
+
+// System config update types, the second indexed topic of a ConfigUpdate event.
+const (
+	// SystemConfigUpdateBatcher data: abi.encode(address batcher)
+	SystemConfigUpdateBatcher = iota
+	// SystemConfigUpdateGasConfig data: abi.encode(uint256 overhead, uint256 scalar)
+	SystemConfigUpdateGasConfig
+	// SystemConfigUpdateGasLimit data: abi.encode(uint64 gasLimit)
+	SystemConfigUpdateGasLimit
+)
+
+// UpdateSystemConfigWithL1Receipts applies the system config updates of the successful transactions
+// of an L1 block to the system config, in order.
+// Malformed updates are skipped, every other update still applies: the last error is returned.
+func UpdateSystemConfigWithL1Receipts(sysCfg *rollup.SystemConfig, receipts []*types.Receipt, config *rollup.Config) error {
+	var result error
+	for _, rec := range receipts {
+		if rec.Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		for _, log := range rec.Logs {
+			if log.Address != config.SystemConfigAddress || len(log.Topics) == 0 || log.Topics[0] != ConfigUpdateEventABIHash {
+				continue
+			}
+			if err := ProcessSystemConfigUpdateLogEvent(sysCfg, log); err != nil {
+				metrics.GetOrRegisterCounter("derive/system_config/malformed", nil).Inc(1)
+				result = fmt.Errorf("malformed system config update in tx %s: %w", log.TxHash, err)
+			}
+		}
+	}
+	return result
+}
+
+// ProcessSystemConfigUpdateLogEvent applies a ConfigUpdate event of the system config contract to the system config:
+//
+//	event ConfigUpdate(
+//	    uint256 indexed version,
+//	    uint8 indexed updateType,
+//	    bytes data
+//	);
+//
+// The system config is not changed if the event is malformed.
+func ProcessSystemConfigUpdateLogEvent(sysCfg *rollup.SystemConfig, ev *types.Log) error {
+	if len(ev.Topics) != 3 {
+		return fmt.Errorf("expected 3 event topics (event identity, indexed version, indexed updateType), got %d", len(ev.Topics))
+	}
+	if ev.Topics[0] != ConfigUpdateEventABIHash {
+		return fmt.Errorf("invalid system config update event selector: %s, expected %s", ev.Topics[0], ConfigUpdateEventABIHash)
+	}
+	if ev.Topics[1] != ConfigUpdateEventVersion {
+		return fmt.Errorf("unrecognized system config update event version: %s", ev.Topics[1])
+	}
+	updateType := new(big.Int).SetBytes(ev.Topics[2][:])
+	data, err := unpackBytes(ev.Data)
+	if err != nil {
+		return err
+	}
+	switch {
+	case updateType.Cmp(big.NewInt(SystemConfigUpdateBatcher)) == 0:
+		if len(data) != 32 {
+			return fmt.Errorf("expected 32 bytes of batcher update data, got %d", len(data))
+		}
+		if !isZero(data[:12]) {
+			return errors.New("batcher address is not left-padded with zeroes")
+		}
+		sysCfg.BatcherAddr = common.BytesToAddress(data[12:])
+	case updateType.Cmp(big.NewInt(SystemConfigUpdateGasConfig)) == 0:
+		if len(data) != 64 {
+			return fmt.Errorf("expected 64 bytes of gas config update data, got %d", len(data))
+		}
+		sysCfg.Overhead = common.BytesToHash(data[:32])
+		sysCfg.Scalar = common.BytesToHash(data[32:])
+	case updateType.Cmp(big.NewInt(SystemConfigUpdateGasLimit)) == 0:
+		if len(data) != 32 {
+			return fmt.Errorf("expected 32 bytes of gas limit update data, got %d", len(data))
+		}
+		if !isZero(data[:24]) {
+			return errors.New("gas limit does not fit in uint64")
+		}
+		sysCfg.GasLimit = new(big.Int).SetBytes(data[24:]).Uint64()
+	default:
+		return fmt.Errorf("unrecognized system config update type: %s", updateType)
+	}
+	return nil
+}
+
+// unpackBytes decodes the ABI encoding of a single dynamic bytes value: offset, length, and the padded bytes.
+func unpackBytes(data []byte) ([]byte, error) {
+	if len(data) < 64 {
+		return nil, fmt.Errorf("event data too small (%d bytes)", len(data))
+	}
+	offset := new(big.Int).SetBytes(data[:32])
+	if offset.Cmp(big.NewInt(32)) != 0 {
+		return nil, fmt.Errorf("incorrect data offset: %s", offset)
+	}
+	length := new(big.Int).SetBytes(data[32:64])
+	if !length.IsUint64() || length.Uint64() > uint64(len(data)-64) {
+		return nil, fmt.Errorf("data length %s exceeds event data of %d bytes", length, len(data))
+	}
+	return data[64 : 64+length.Uint64()], nil
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
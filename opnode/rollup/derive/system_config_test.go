@@ -0,0 +1,67 @@
+package derive
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// configUpdateLog creates a ConfigUpdate event log of the system config contract with the given update data.
+func configUpdateLog(addr common.Address, updateType uint64, data []byte) *types.Log {
+	enc := make([]byte, 64)
+	enc[31] = 32
+	new(big.Int).SetUint64(uint64(len(data))).FillBytes(enc[32:64])
+	enc = append(enc, data...)
+	if len(data)%32 != 0 {
+		enc = append(enc, make([]byte, 32-len(data)%32)...)
+	}
+	return &types.Log{
+		Address: addr,
+		Topics:  []common.Hash{ConfigUpdateEventABIHash, ConfigUpdateEventVersion, common.BigToHash(new(big.Int).SetUint64(updateType))},
+		Data:    enc,
+	}
+}
+
+func TestUpdateSystemConfigWithL1Receipts(t *testing.T) {
+	config := &rollup.Config{SystemConfigAddress: common.Address{0x5c}, BatchSenderAddress: common.Address{0xba}}
+	batcher := common.Address{0xbb}
+	gasConfig := append(common.Hash{0x0e}.Bytes(), common.Hash{0x5a}.Bytes()...)
+	gasLimit := common.BigToHash(big.NewInt(30_000_000)).Bytes()
+
+	sysCfg := config.GenesisSystemConfig()
+	receipts := []*types.Receipt{
+		{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{
+			configUpdateLog(config.SystemConfigAddress, SystemConfigUpdateBatcher, common.BytesToHash(batcher[:]).Bytes()),
+			configUpdateLog(common.Address{0xff}, SystemConfigUpdateGasLimit, common.BigToHash(big.NewInt(1)).Bytes()), // other contract
+		}},
+		{Status: types.ReceiptStatusFailed, Logs: []*types.Log{
+			configUpdateLog(config.SystemConfigAddress, SystemConfigUpdateGasLimit, common.BigToHash(big.NewInt(2)).Bytes()), // failed tx
+		}},
+		{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{
+			configUpdateLog(config.SystemConfigAddress, SystemConfigUpdateGasConfig, gasConfig),
+			configUpdateLog(config.SystemConfigAddress, SystemConfigUpdateGasLimit, gasLimit),
+		}},
+	}
+	require.NoError(t, UpdateSystemConfigWithL1Receipts(&sysCfg, receipts, config))
+	require.Equal(t, rollup.SystemConfig{
+		BatcherAddr: batcher,
+		Overhead:    common.Hash{0x0e},
+		Scalar:      common.Hash{0x5a},
+		GasLimit:    30_000_000,
+	}, sysCfg)
+
+	// Malformed updates are skipped, the other updates still apply
+	malformed := []*types.Receipt{{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{
+		configUpdateLog(config.SystemConfigAddress, SystemConfigUpdateBatcher, []byte{1, 2, 3}),
+		configUpdateLog(config.SystemConfigAddress, 99, gasLimit),
+		configUpdateLog(config.SystemConfigAddress, SystemConfigUpdateGasLimit, common.Hash{0xff}.Bytes()),
+		configUpdateLog(config.SystemConfigAddress, SystemConfigUpdateGasLimit, common.BigToHash(big.NewInt(1)).Bytes()),
+	}}}
+	require.Error(t, UpdateSystemConfigWithL1Receipts(&sysCfg, malformed, config))
+	require.Equal(t, batcher, sysCfg.BatcherAddr)
+	require.Equal(t, uint64(1), sysCfg.GasLimit)
+}
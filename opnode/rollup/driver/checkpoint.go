@@ -0,0 +1,63 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+)
+
+// Checkpoint is a trusted L2 block to start derivation from,
+// instead of walking back from the L2 head of the engine.
+type Checkpoint struct {
+	L2       eth.BlockID `json:"l2"`
+	L1Origin eth.BlockID `json:"l1Origin"`
+}
+
+// checkpointHeads determines the L2 heads to start from with a checkpoint.
+// If the engine is still behind the checkpoint, the checkpoint block is used as unsafe and safe head:
+// the engine must have the checkpoint block (e.g. through snap-sync), and it is made canonical.
+// If the engine is ahead, the checkpoint is verified to be part of its chain, and ok is false
+// to continue with the regular startup.
+func (s *state) checkpointHeads(ctx context.Context, cp *Checkpoint, l2Head eth.L2BlockRef) (ref eth.L2BlockRef, ok bool, err error) {
+	if l2Head.Number >= cp.L2.Number {
+		canonical, err := s.l2.L2BlockRefByNumber(ctx, new(big.Int).SetUint64(cp.L2.Number))
+		if err != nil {
+			return eth.L2BlockRef{}, false, fmt.Errorf("failed to fetch L2 block of checkpoint %s: %w", cp.L2, err)
+		}
+		if canonical.Hash != cp.L2.Hash {
+			return eth.L2BlockRef{}, false, fmt.Errorf("checkpoint %s conflicts with canonical L2 block %s", cp.L2, canonical.ID())
+		}
+		return eth.L2BlockRef{}, false, nil
+	}
+
+	ref, err = s.l2.L2BlockRefByHash(ctx, cp.L2.Hash)
+	if err != nil {
+		return eth.L2BlockRef{}, false, fmt.Errorf("failed to fetch L2 block of checkpoint %s, the engine must have it: %w", cp.L2, err)
+	}
+	if ref.Number != cp.L2.Number {
+		return eth.L2BlockRef{}, false, fmt.Errorf("checkpoint %s has number %d in the engine", cp.L2, ref.Number)
+	}
+	if ref.L1Origin != cp.L1Origin {
+		return eth.L2BlockRef{}, false, fmt.Errorf("checkpoint %s has L1 origin %s, expected %s", cp.L2, ref.L1Origin, cp.L1Origin)
+	}
+	l1Origin, err := s.l1.L1BlockRefByNumber(ctx, cp.L1Origin.Number)
+	if err != nil {
+		return eth.L2BlockRef{}, false, fmt.Errorf("failed to fetch L1 origin of checkpoint %s: %w", cp.L1Origin, err)
+	}
+	if l1Origin.Hash != cp.L1Origin.Hash {
+		return eth.L2BlockRef{}, false, fmt.Errorf("L1 origin of checkpoint %s is not canonical, found %s", cp.L1Origin, l1Origin.ID())
+	}
+
+	fc := l2.ForkchoiceState{
+		HeadBlockHash: ref.Hash,
+		SafeBlockHash: ref.Hash,
+	}
+	if _, err := s.l2.ForkchoiceUpdate(ctx, &fc, nil); err != nil {
+		return eth.L2BlockRef{}, false, fmt.Errorf("failed to make checkpoint %s canonical: %w", cp.L2, err)
+	}
+	s.log.Info("Starting from checkpoint", "checkpoint", ref, "l1Origin", l1Origin)
+	return ref, true, nil
+}
@@ -0,0 +1,98 @@
+package driver
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubL2Chain serves a canonical L2 chain, and records forkchoice updates.
+type stubL2Chain struct {
+	blocks []eth.L2BlockRef
+	extra  []eth.L2BlockRef // non-canonical blocks known by the engine
+	fc     *l2.ForkchoiceState
+}
+
+func (m *stubL2Chain) ForkchoiceUpdate(ctx context.Context, state *l2.ForkchoiceState, attr *l2.PayloadAttributes) (*l2.ForkchoiceUpdatedResult, error) {
+	m.fc = state
+	return &l2.ForkchoiceUpdatedResult{}, nil
+}
+
+func (m *stubL2Chain) L2BlockRefByNumber(ctx context.Context, l2Num *big.Int) (eth.L2BlockRef, error) {
+	if l2Num == nil {
+		return m.blocks[len(m.blocks)-1], nil
+	}
+	if l2Num.Uint64() >= uint64(len(m.blocks)) {
+		return eth.L2BlockRef{}, ethereum.NotFound
+	}
+	return m.blocks[l2Num.Uint64()], nil
+}
+
+func (m *stubL2Chain) L2BlockRefByHash(ctx context.Context, l2Hash common.Hash) (eth.L2BlockRef, error) {
+	for _, b := range append(m.blocks, m.extra...) {
+		if b.Hash == l2Hash {
+			return b, nil
+		}
+	}
+	return eth.L2BlockRef{}, ethereum.NotFound
+}
+
+func TestCheckpointHeads(t *testing.T) {
+	a, b := fakeL1Block('a', 0, 0), fakeL1Block('b', 'a', 1)
+	l1 := &stubL1Chain{blocks: []eth.L1BlockRef{a, b}, err: ethereum.NotFound}
+	A := fakeL2Block('A', 0, a.ID(), 0)
+	B := fakeL2Block('B', 'A', b.ID(), 1)
+	C := fakeL2Block('C', 'B', b.ID(), 2)
+
+	newState := func(l2 L2Chain) *state {
+		return NewState(&Config{}, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{}, l1, l2, nil, nil)
+	}
+
+	t.Run("engine behind checkpoint", func(t *testing.T) {
+		l2 := &stubL2Chain{blocks: []eth.L2BlockRef{A}, extra: []eth.L2BlockRef{B, C}}
+		ref, ok, err := newState(l2).checkpointHeads(context.Background(), &Checkpoint{L2: C.ID(), L1Origin: b.ID()}, A)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, C, ref)
+		assert.Equal(t, C.Hash, l2.fc.HeadBlockHash, "checkpoint is made canonical")
+		assert.Equal(t, C.Hash, l2.fc.SafeBlockHash)
+	})
+	t.Run("engine ahead of checkpoint", func(t *testing.T) {
+		l2 := &stubL2Chain{blocks: []eth.L2BlockRef{A, B, C}}
+		_, ok, err := newState(l2).checkpointHeads(context.Background(), &Checkpoint{L2: B.ID(), L1Origin: b.ID()}, C)
+		assert.NoError(t, err)
+		assert.False(t, ok, "regular startup")
+		assert.Nil(t, l2.fc)
+	})
+	t.Run("conflicting checkpoint", func(t *testing.T) {
+		l2 := &stubL2Chain{blocks: []eth.L2BlockRef{A, B, C}}
+		_, _, err := newState(l2).checkpointHeads(context.Background(), &Checkpoint{L2: fakeID('X', 1), L1Origin: b.ID()}, C)
+		assert.Error(t, err)
+	})
+	t.Run("wrong L1 origin", func(t *testing.T) {
+		l2 := &stubL2Chain{blocks: []eth.L2BlockRef{A}, extra: []eth.L2BlockRef{B}}
+		_, _, err := newState(l2).checkpointHeads(context.Background(), &Checkpoint{L2: B.ID(), L1Origin: a.ID()}, A)
+		assert.Error(t, err)
+	})
+	t.Run("non-canonical L1 origin", func(t *testing.T) {
+		x := fakeL1Block('x', 'a', 1)
+		X := fakeL2Block('X', 'A', x.ID(), 1)
+		l2 := &stubL2Chain{blocks: []eth.L2BlockRef{A}, extra: []eth.L2BlockRef{X}}
+		_, _, err := newState(l2).checkpointHeads(context.Background(), &Checkpoint{L2: X.ID(), L1Origin: x.ID()}, A)
+		assert.Error(t, err)
+	})
+	t.Run("checkpoint not available", func(t *testing.T) {
+		l2 := &stubL2Chain{blocks: []eth.L2BlockRef{A}}
+		_, _, err := newState(l2).checkpointHeads(context.Background(), &Checkpoint{L2: C.ID(), L1Origin: b.ID()}, A)
+		assert.ErrorIs(t, err, ethereum.NotFound)
+	})
+}
@@ -0,0 +1,101 @@
+package driver
+
+import "time"
+
+type Config struct {
+	// SequencerEnabled is true when the driver should sequence new blocks.
+	SequencerEnabled bool
+
+	// SequencerStopped is false when the driver should sequence new blocks.
+	// A sequencer that is enabled but stopped is a hot standby: it follows the chain,
+	// but only starts producing blocks once explicitly activated.
+	SequencerStopped bool
+
+	// BatchSubmitInterval is the maximum time that a sequenced batch is queued before it is submitted to L1,
+	// together with all other batches queued in the meantime. If zero, every batch is submitted right away.
+	BatchSubmitInterval time.Duration
+
+	// MaxBatchSubmissionSize is the size in bytes of the queued (encoded) batches at which they are submitted,
+	// without waiting for the BatchSubmitInterval. If zero, there is no size limit.
+	MaxBatchSubmissionSize uint64
+
+	// MaxUnsafeLagBlocks is the number of blocks that the unsafe head may be ahead of the safe head.
+	// Beyond it, the sequencer pauses block production until the batches land on L1 and the safe head catches up.
+	// Disabled if zero.
+	MaxUnsafeLagBlocks uint64
+
+	// MaxUnsafeLagTime is the time that the unsafe head may be ahead of the safe head, like MaxUnsafeLagBlocks.
+	// Disabled if zero.
+	MaxUnsafeLagTime time.Duration
+
+	// SequencerClockSkew delays the production of a L2 block past its timestamp, to tolerate clock skew with L1:
+	// L1 blocks with the same timestamp get time to propagate, and can be adopted as L1 origin.
+	// The default is used if zero.
+	SequencerClockSkew time.Duration
+
+	// PayloadBuildTime is the time that the engine gets to build a new block with transactions of its tx pool,
+	// between starting the block building and fetching the payload. The payload is fetched right away if zero.
+	PayloadBuildTime time.Duration
+
+	// MaxQueuedPayloads is the number of unsafe payloads, received ahead of the unsafe head, that are held
+	// until their parents are inserted. The default is used if zero.
+	MaxQueuedPayloads int
+
+	// OriginSelector determines the L1 origin of the sequenced blocks.
+	// NewL1OriginSelector is used if nil.
+	OriginSelector OriginSelector
+
+	// Checkpoint is an optional trusted L2 block to start derivation from,
+	// if the engine is not yet synced up to it.
+	Checkpoint *Checkpoint
+
+	// SnapSyncThreshold is the number of blocks that the engine must be behind the checkpoint to let the engine
+	// sync to the checkpoint by itself, instead of requiring the engine to have the checkpoint block.
+	// Derivation is paused until the engine has synced. Disabled if zero.
+	SnapSyncThreshold uint64
+
+	// SnapSyncPollInterval is the interval to check at if the engine finished syncing to the checkpoint.
+	// The default is used if zero.
+	SnapSyncPollInterval time.Duration
+
+	// MaxReorgDepth is the maximum number of L2 blocks to walk back when recovering from a L1 reorg,
+	// or when finding the L2 heads at startup. sync.MaxReorgDepth is used if zero.
+	MaxReorgDepth uint64
+
+	// ReorgHistorySize is the number of the last reorgs of the L2 heads that are kept, see Driver.ReorgHistory.
+	// The default is used if zero.
+	ReorgHistorySize int
+
+	// SyncProgressInterval is the interval to log the sync progress of the safe head at.
+	// The default is used if zero.
+	SyncProgressInterval time.Duration
+
+	// L1BeaconAddr is the address of the beacon node HTTP API to fetch the blobs of the batch data from.
+	// If empty, the batch data is read from the L1 calldata only.
+	L1BeaconAddr string
+
+	// BatchDataDir is an optional directory to read the batch data from, instead of the L1 calldata.
+	// See derive.FileDataSource for the file format. For testing only.
+	BatchDataDir string
+
+	// Deadlines of the operations run by the driver loop. Defaults are used if zero.
+	L1HeadTimeout   time.Duration // Handling of a new L1 head, incl. reorg recovery
+	NewBlockTimeout time.Duration // Sequencing a new L2 block
+	L1RangeTimeout  time.Duration // Fetching of the L1 blocks of the next sequencing window
+	StepTimeout     time.Duration // Derivation of a L2 epoch
+}
+
+const (
+	defaultTimeout              = 10 * time.Second
+	defaultSequencerClockSkew   = 500 * time.Millisecond
+	defaultSyncProgressInterval = 30 * time.Second
+	defaultSnapSyncPollInterval = 5 * time.Second
+)
+
+// durationOrDefault returns the given duration, or the default if it is not set.
+func durationOrDefault(d time.Duration, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,188 @@
+package driver
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+// The conformance tests check that an execution client conforms to the engine API as the driver uses it:
+// sequencing, safe block insertion and verification, and reorgs of the L2 chain, through the output of the driver.
+//
+// The tests run against the engine API endpoint in the OPNODE_CONFORMANCE_ENGINE environment variable,
+// authenticated with the JWT secret file in OPNODE_CONFORMANCE_JWT_SECRET if set, and are skipped otherwise:
+//
+//	OPNODE_CONFORMANCE_ENGINE=http://127.0.0.1:8551 OPNODE_CONFORMANCE_JWT_SECRET=jwt.hex go test ./rollup/driver/ -run Conformance
+//
+// The tests build and insert blocks on top of the current head of the engine, and reorg them,
+// so they must run against a dedicated development chain.
+
+// dialConformanceEngine connects to the engine under test, or skips the test if there is none.
+func dialConformanceEngine(t *testing.T) (*l2.Source, rollup.Genesis) {
+	addr := os.Getenv("OPNODE_CONFORMANCE_ENGINE")
+	if addr == "" {
+		t.Skip("no engine to test, set OPNODE_CONFORMANCE_ENGINE")
+	}
+	var client *rpc.Client
+	if path := os.Getenv("OPNODE_CONFORMANCE_JWT_SECRET"); path != "" {
+		secret, err := l2.ReadJWTSecret(path)
+		require.NoError(t, err)
+		auth, err := l2.NewJWTAuth(l2.JWTConfig{Secret: secret})
+		require.NoError(t, err)
+		client, err = rpc.DialHTTPWithClient(addr, &http.Client{Transport: auth.RoundTripper(nil)})
+		require.NoError(t, err)
+	} else {
+		var err error
+		client, err = rpc.DialContext(context.Background(), addr)
+		require.NoError(t, err)
+	}
+	genesis, err := ethclient.NewClient(client).BlockByNumber(context.Background(), big.NewInt(0))
+	require.NoError(t, err, "the engine must serve its genesis block")
+	rollupGenesis := rollup.Genesis{
+		L1:     eth.BlockID{Hash: common.Hash{0x11}, Number: 0},
+		L2:     eth.BlockID{Hash: genesis.Hash(), Number: 0},
+		L2Time: genesis.Time(),
+	}
+	src, err := l2.NewSource(client, &rollupGenesis, testlog.Logger(t, log.LvlInfo))
+	require.NoError(t, err)
+	t.Cleanup(src.Close)
+	return src, rollupGenesis
+}
+
+// conformanceOutput is the output of the driver on the engine under test, with a L1 chain of the given origins.
+func conformanceOutput(t *testing.T, src *l2.Source, genesis rollup.Genesis, origins []eth.L1BlockRef) *outputImpl {
+	cfg := rollup.Config{Genesis: genesis, BlockTime: 2}
+	dl := &receiptsDownloader{blocks: origins}
+	d := &outputImpl{Config: cfg, dl: dl, l2: src, log: testlog.Logger(t, log.LvlInfo)}
+	d.sysCfgs = newSystemConfigs(&d.Config, dl, d.log, nil)
+	return d
+}
+
+// epochAttributesOf returns the attributes of the first block of the epoch of the origin, without deposits,
+// as the derivation creates them for a safe block. The random value distinguishes blocks with the same parent.
+func epochAttributesOf(t *testing.T, parent eth.L2BlockRef, origin eth.L1BlockRef, random byte) *l2.PayloadAttributes {
+	depositTx, err := derive.L1InfoDepositBytes(parent.Number+1, 0, fakeL1Info{origin}, rollup.SystemConfig{})
+	require.NoError(t, err)
+	return &l2.PayloadAttributes{
+		Timestamp:    hexutil.Uint64(parent.Time + 2),
+		Random:       l2.Bytes32{random},
+		Transactions: []l2.Data{depositTx},
+		NoTxPool:     true,
+	}
+}
+
+// requireHead checks that the block is the canonical head of the engine.
+func requireHead(t *testing.T, ctx context.Context, src *l2.Source, head eth.BlockID) {
+	ref, err := src.L2BlockRefByNumber(ctx, new(big.Int).SetUint64(head.Number))
+	require.NoError(t, err)
+	require.Equal(t, head.Hash, ref.Hash, "the head is canonical")
+	ref, err = src.L2BlockRefByNumber(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, head, ref.ID(), "the block is the head")
+}
+
+func TestEngineConformance(t *testing.T) {
+	src, genesis := dialConformanceEngine(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := src.NegotiateEngineAPI(ctx)
+	require.NoError(t, err, "the engine supports the engine API methods of the rollup node")
+
+	head, err := src.L2BlockRefByNumber(ctx, nil)
+	require.NoError(t, err, "the head of the engine must be a block of the rollup")
+	origin := eth.L1BlockRef{Hash: common.Hash{0x12, byte(head.Number)}, Number: head.L1Origin.Number + 1, ParentHash: head.L1Origin.Hash, Time: head.Time}
+	d := conformanceOutput(t, src, genesis, []eth.L1BlockRef{origin})
+
+	t.Run("sequence", func(t *testing.T) {
+		// the first block of the epoch, and the next block of the same epoch
+		first, batch, err := d.createNewBlock(ctx, head, head.ID(), eth.BlockID{}, origin)
+		require.NoError(t, err)
+		require.Equal(t, origin.ID(), first.L1Origin)
+		require.Zero(t, first.SequenceNumber)
+		require.Equal(t, rollup.Epoch(origin.Number), batch.Epoch)
+		requireHead(t, ctx, src, first.ID())
+		second, _, err := d.createNewBlock(ctx, first, head.ID(), eth.BlockID{}, origin)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), second.SequenceNumber)
+		requireHead(t, ctx, src, second.ID())
+
+		block, err := src.BlockByHash(ctx, second.Hash)
+		require.NoError(t, err)
+		require.Equal(t, types.DepositTxType, int(block.Transactions()[0].Type()), "the engine supports deposit transactions")
+	})
+
+	t.Run("safe block", func(t *testing.T) {
+		// the derived block is inserted as the safe head, and verified as matching its attributes
+		attrs := epochAttributesOf(t, head, origin, 1)
+		fc := l2.ForkchoiceState{HeadBlockHash: head.Hash, SafeBlockHash: head.Hash}
+		payload, err := d.insertHeadBlock(ctx, fc, attrs, true, 0)
+		require.NoError(t, err)
+		require.Len(t, payload.TransactionsField, 1, "the payload includes the forced transactions only")
+		requireHead(t, ctx, src, payload.ID())
+		_, reorg, err := d.verifySafeBlock(ctx, fc, attrs, head.ID())
+		require.NoError(t, err)
+		require.False(t, reorg, "the block matches its attributes")
+
+		// a block that does not match its attributes is replaced
+		other := epochAttributesOf(t, head, origin, 2)
+		block, reorg, err := d.verifySafeBlock(ctx, fc, other, head.ID())
+		require.NoError(t, err)
+		require.True(t, reorg)
+		requireHead(t, ctx, src, eth.BlockID{Hash: block.Hash(), Number: block.NumberU64()})
+	})
+
+	t.Run("reorg", func(t *testing.T) {
+		fc := l2.ForkchoiceState{HeadBlockHash: head.Hash, SafeBlockHash: head.Hash}
+		a, err := d.buildPayload(ctx, fc, epochAttributesOf(t, head, origin, 3), 0)
+		require.NoError(t, err)
+		b, err := d.buildPayload(ctx, fc, epochAttributesOf(t, head, origin, 4), 0)
+		require.NoError(t, err)
+		require.NotEqual(t, a.BlockHash, b.BlockHash)
+		require.NoError(t, d.importPayload(ctx, fc, a, false))
+		requireHead(t, ctx, src, a.ID())
+		require.NoError(t, d.importPayload(ctx, fc, b, false))
+		requireHead(t, ctx, src, b.ID())
+
+		// the reorged chain can be extended
+		bRef, err := derive.BlockReferences(b, &genesis)
+		require.NoError(t, err)
+		child, _, err := d.createNewBlock(ctx, bRef, head.ID(), eth.BlockID{}, origin)
+		require.NoError(t, err)
+		requireHead(t, ctx, src, child.ID())
+
+		// and reorged back to a shorter chain
+		require.NoError(t, d.importPayload(ctx, fc, a, false))
+		requireHead(t, ctx, src, a.ID())
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		fc := l2.ForkchoiceState{HeadBlockHash: head.Hash, SafeBlockHash: head.Hash}
+		payload, err := d.buildPayload(ctx, fc, epochAttributesOf(t, head, origin, 5), 0)
+		require.NoError(t, err)
+		payload.StateRoot = l2.Bytes32{0xff}
+		require.Error(t, d.importPayload(ctx, fc, payload, false), "a payload that does not match its block hash is rejected")
+	})
+
+	t.Run("unknown head", func(t *testing.T) {
+		fc := l2.ForkchoiceState{HeadBlockHash: common.Hash{0xff}, SafeBlockHash: head.Hash}
+		_, err := d.buildPayload(ctx, fc, epochAttributesOf(t, head, origin, 6), 0)
+		require.Error(t, err, "no block is built on an unknown head")
+	})
+}
@@ -2,13 +2,17 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"math/big"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/beacon"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/l1"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
@@ -16,10 +20,17 @@ import (
 
 type Driver struct {
 	s *state
+	// verifier derives blocks on demand, outside of the loop
+	verifier *Verifier
 }
 
 type BatchSubmitter interface {
 	Submit(config *rollup.Config, batches []*derive.BatchData) (common.Hash, error)
+	// L1HeadChanged signals a new L1 head, to track the confirmations of the submitted batches.
+	// reorged is true if the previous L1 head is no longer canonical. It must not block.
+	L1HeadChanged(head eth.L1BlockRef, reorged bool)
+	// L1Finalized signals a new finalized L1 block: the submitted batches included up to it are confirmed. It must not block.
+	L1Finalized(finalized eth.L1BlockRef)
 }
 
 type Downloader interface {
@@ -40,6 +51,9 @@ type L1Chain interface {
 	L1BlockRefByNumber(context.Context, uint64) (eth.L1BlockRef, error)
 	L1BlockRefByHash(context.Context, common.Hash) (eth.L1BlockRef, error)
 	L1HeadBlockRef(context.Context) (eth.L1BlockRef, error)
+	// L1BlockRefByLabel returns the L1 block with the label, e.g. the finalized L1 block.
+	// It may return an error for the safe and finalized labels, if the L1 chain does not support them (before the merge).
+	L1BlockRefByLabel(context.Context, eth.BlockLabel) (eth.L1BlockRef, error)
 	L1Range(ctx context.Context, base eth.BlockID, max uint64) ([]eth.BlockID, error)
 }
 
@@ -49,6 +63,22 @@ type L2Chain interface {
 	L2BlockRefByHash(ctx context.Context, l2Hash common.Hash) (eth.L2BlockRef, error)
 }
 
+// L2Engine is the L2 execution engine that the driver derives and sequences blocks with,
+// e.g. a single engine or a pair of redundant engines.
+type L2Engine interface {
+	Engine
+	L2Chain
+}
+
+// Network gossips the unsafe blocks of the sequencer to the other nodes of the rollup.
+type Network interface {
+	// PublishL2Payload is called with each new block that the sequencer produces.
+	PublishL2Payload(ctx context.Context, payload *l2.ExecutionPayload) error
+	// RequestL2Range fetches the unsafe blocks after start up to end from the peers, in the background.
+	// The fetched payloads are passed to OnUnsafeL2Payload. It must not block.
+	RequestL2Range(ctx context.Context, start eth.L2BlockRef, end eth.BlockID) error
+}
+
 type outputInterface interface {
 	// insertEpoch creates and inserts one epoch on top of the safe head. It prefers blocks it creates to what is recorded in the unsafe chain.
 	// It returns the new L2 head and L2 Safe head and if there was a reorg. This function must return if there was a reorg otherwise the L2 chain must be traversed.
@@ -56,22 +86,56 @@ type outputInterface interface {
 
 	// createNewBlock builds a new block based on the L2 Head, L1 Origin, and the current mempool.
 	createNewBlock(ctx context.Context, l2Head eth.L2BlockRef, l2SafeHead eth.BlockID, l2Finalized eth.BlockID, l1Origin eth.L1BlockRef) (eth.L2BlockRef, *derive.BatchData, error)
+
+	// reset drops the derivation state of the L1 blocks after the given L1 base block, after a L1 reorg.
+	reset(l1Base eth.BlockID)
 }
 
-func NewDriver(cfg rollup.Config, l2 *l2.Source, l1 *l1.Source, log log.Logger, submitter BatchSubmitter, sequencer bool) *Driver {
-	if sequencer && submitter == nil {
-		log.Error("Bad configuration")
-		// TODO: return error
+func NewDriver(driverCfg *Config, cfg rollup.Config, l2 L2Engine, l1 *l1.Source, log log.Logger, snapshotLog log.Logger, submitter BatchSubmitter, idx *index.DB, wal *WAL, network Network, ev *events.Bus) (*Driver, error) {
+	if driverCfg.SequencerEnabled && submitter == nil {
+		return nil, errors.New("sequencer requires a batch submitter")
 	}
+	// the derivation and the driver loop log as separate modules, so their log levels can be set separately
+	deriveLog := log.New("module", "derive")
+	log = log.New("module", "driver")
 	output := &outputImpl{
-		Config: cfg,
-		dl:     l1,
-		l2:     l2,
-		log:    log,
+		Config:  cfg,
+		dl:      l1,
+		l2:      l2,
+		log:     deriveLog,
+		index:   idx,
+		network: network,
+
+		payloadBuildTime: driverCfg.PayloadBuildTime,
+	}
+	output.sysCfgs = newSystemConfigs(&output.Config, l1, deriveLog, idx)
+	if driverCfg.L1BeaconAddr != "" {
+		// the blobs served by the beacon node are verified against their commitments, so it does not have to be trusted
+		kzg, err := derive.LoadKZG()
+		if err != nil {
+			return nil, err
+		}
+		output.ds = &derive.BlobDataSource{Config: &output.Config, L1: l1, Beacon: beacon.NewClient(driverCfg.L1BeaconAddr, nil), Verifier: kzg, Log: deriveLog}
 	}
-	return &Driver{
-		s: NewState(log, cfg, l1, l2, output, submitter, sequencer),
+	if driverCfg.BatchDataDir != "" {
+		log.Warn("Reading batch data from files instead of L1", "dir", driverCfg.BatchDataDir)
+		output.ds = &derive.FileDataSource{Config: &output.Config, Dir: driverCfg.BatchDataDir}
 	}
+	s := NewState(driverCfg, log, snapshotLog, cfg, l1, l2, output, submitter)
+	s.index = idx
+	s.wal = wal
+	s.network = network
+	s.events = ev
+	// the latencies of the safe blocks are reported in the sync status
+	output.progress = s.progress
+	// The verifier has its own derivation state, it only shares the batch data source and the system configs
+	// (which are safe for concurrent use) with the loop.
+	verifier := &Verifier{
+		log:    deriveLog,
+		l1:     l1,
+		output: &outputImpl{Config: cfg, dl: l1, l2: l2, log: deriveLog, ds: output.ds, sysCfgs: output.sysCfgs},
+	}
+	return &Driver{s: s, verifier: verifier}, nil
 }
 
 func (d *Driver) Start(ctx context.Context, l1Heads <-chan eth.L1BlockRef) error {
@@ -80,3 +144,66 @@ func (d *Driver) Start(ctx context.Context, l1Heads <-chan eth.L1BlockRef) error
 func (d *Driver) Close() error {
 	return d.s.Close()
 }
+
+// StartSequencer activates block production on a stopped sequencer, building on top of the given unsafe head.
+func (d *Driver) StartSequencer(ctx context.Context, blockHash common.Hash) error {
+	return d.s.StartSequencer(ctx, blockHash)
+}
+
+// StopSequencer halts block production and returns the hash of the last unsafe head it produced.
+func (d *Driver) StopSequencer(ctx context.Context) (common.Hash, error) {
+	return d.s.StopSequencer(ctx)
+}
+
+// SequencerActive returns true if the driver is currently producing blocks as sequencer.
+func (d *Driver) SequencerActive(ctx context.Context) (bool, error) {
+	return d.s.SequencerActive(ctx)
+}
+
+// ResetChain rewinds the L2 chain to the given block, e.g. to recover from a bad block. The block becomes the unsafe head,
+// and if it is not ahead of the safe head, also the safe head: derivation restarts from it.
+func (d *Driver) ResetChain(ctx context.Context, blockHash common.Hash) error {
+	return d.s.ResetChain(ctx, blockHash)
+}
+
+// PauseDerivation stops the safe head from advancing, while L1 heads are still tracked, until ResumeDerivation is called.
+func (d *Driver) PauseDerivation(ctx context.Context) error {
+	return d.s.PauseDerivation(ctx)
+}
+
+// ResumeDerivation continues the derivation paused by PauseDerivation.
+func (d *Driver) ResumeDerivation(ctx context.Context) error {
+	return d.s.ResumeDerivation(ctx)
+}
+
+// DeriveBlock derives the L2 block with the given number again from L1, and compares it with the canonical block,
+// see Verifier.DeriveBlock.
+func (d *Driver) DeriveBlock(ctx context.Context, num uint64) (*DerivedBlock, error) {
+	return d.verifier.DeriveBlock(ctx, num)
+}
+
+// SyncStatus returns the combined sync state of the rollup node and its engine.
+func (d *Driver) SyncStatus(ctx context.Context) (*SyncStatus, error) {
+	return d.s.SyncStatus(ctx)
+}
+
+// UnsafePayload is an unsafe L2 payload from an external source, e.g. received from the sequencer.
+type UnsafePayload struct {
+	Payload *l2.ExecutionPayload
+	// Signature is the signature of the sequencer over the payload, see l2.PayloadSigningHash. Nil if not available.
+	Signature []byte
+	// Source identifies where the payload came from, to penalize the sources of invalid payloads
+	Source string
+	// Trusted is true for the payloads of a trusted source, e.g. the admin RPC: they do not need a signature,
+	// and their source is not penalized for invalid payloads.
+	Trusted bool
+	// Linked is true for the payloads that are authenticated by their hash links to a signed payload instead of
+	// a signature, e.g. the payloads synced from peers.
+	Linked bool
+}
+
+// OnUnsafeL2Payload queues an unsafe L2 payload to be inserted into the engine once its parent is the unsafe head.
+// Payloads may arrive out of order. Invalid payloads are rejected, and their source is banned if it keeps sending them.
+func (d *Driver) OnUnsafeL2Payload(ctx context.Context, payload *UnsafePayload) error {
+	return d.s.OnUnsafeL2Payload(ctx, payload)
+}
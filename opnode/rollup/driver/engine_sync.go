@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/sync"
+)
+
+// SyncStatus is the combined sync state of the rollup node and its engine.
+type SyncStatus struct {
+	L1Head      eth.L1BlockRef `json:"l1Head"`
+	L1Finalized eth.L1BlockRef `json:"l1Finalized"`
+	UnsafeL2    eth.L2BlockRef `json:"unsafeL2"`
+	SafeL2      eth.L2BlockRef `json:"safeL2"`
+	FinalizedL2 eth.BlockID    `json:"finalizedL2"`
+	// Derivation is the progress of the safe head towards the L1 head
+	Derivation sync.Progress `json:"derivation"`
+	// EngineSyncing is true while the engine is syncing by itself, and new blocks are not inserted until it caught up
+	EngineSyncing bool `json:"engineSyncing"`
+	// SnapSyncTarget is the checkpoint that the engine is syncing to, nil if the engine is not syncing to a checkpoint
+	SnapSyncTarget *eth.BlockID `json:"snapSyncTarget,omitempty"`
+	// DerivationPaused is true while the safe head is not advanced, see Driver.PauseDerivation
+	DerivationPaused bool `json:"derivationPaused"`
+	// QueuedPayloads is the number of unsafe payloads that are waiting to be inserted
+	QueuedPayloads int `json:"queuedPayloads"`
+}
+
+// SyncStatus returns the combined sync state of the rollup node and its engine.
+func (s *state) SyncStatus(ctx context.Context) (*SyncStatus, error) {
+	respCh := make(chan *SyncStatus, 1)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, ErrDriverClosed
+	case s.syncStatusReq <- respCh:
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case status := <-respCh:
+		return status, nil
+	}
+}
+
+// syncStatus returns the current sync state. Only called by the loop.
+func (s *state) syncStatus() *SyncStatus {
+	status := &SyncStatus{
+		L1Head:           s.l1Head,
+		L1Finalized:      s.l1Finalized,
+		UnsafeL2:         s.l2Head,
+		SafeL2:           s.l2SafeHead,
+		FinalizedL2:      s.l2Finalized,
+		Derivation:       s.progress.Progress(time.Now(), s.l1Head, s.l2SafeHead),
+		EngineSyncing:    s.engineSyncing,
+		DerivationPaused: s.derivationPaused,
+		QueuedPayloads:   s.payloadQueue.Len(),
+	}
+	if s.snapSyncTarget != nil {
+		target := s.snapSyncTarget.L2
+		status.SnapSyncTarget = &target
+	}
+	return status
+}
+
+// checkEngineSyncing marks the engine as syncing if the error is because the engine is syncing, and returns true if so.
+// New blocks are not inserted until the engine caught up, see checkEngineSynced.
+func (s *state) checkEngineSyncing(err error) bool {
+	if !errors.Is(err, l2.ErrEngineSyncing) {
+		return false
+	}
+	if !s.engineSyncing {
+		s.log.Warn("Engine is syncing, pausing block insertion until it caught up", "l2Head", s.l2Head, "err", err)
+		s.engineSyncing = true
+	}
+	return true
+}
+
+// checkEngineSynced checks if the syncing engine caught up, by updating its forkchoice to the current heads again.
+// It returns true if the engine accepted the forkchoice, and block insertion is resumed.
+func (s *state) checkEngineSynced(ctx context.Context) (bool, error) {
+	fc := l2.ForkchoiceState{
+		HeadBlockHash:      s.l2Head.Hash,
+		SafeBlockHash:      s.l2SafeHead.Hash,
+		FinalizedBlockHash: s.l2Finalized.Hash,
+	}
+	_, err := s.l2.ForkchoiceUpdate(ctx, &fc, nil)
+	if errors.Is(err, l2.ErrEngineSyncing) {
+		s.log.Debug("Engine is still syncing", "l2Head", s.l2Head)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	s.engineSyncing = false
+	s.log.Info("Engine caught up, resuming block insertion", "l2Head", s.l2Head)
+	return true, nil
+}
@@ -0,0 +1,63 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// catchingUpL2Chain is an engine that reports that it is syncing on forkchoice updates, until it caught up
+type catchingUpL2Chain struct {
+	L2Chain
+	syncing bool
+}
+
+func (c *catchingUpL2Chain) ForkchoiceUpdate(ctx context.Context, state *l2.ForkchoiceState, attr *l2.PayloadAttributes) (*l2.ForkchoiceUpdatedResult, error) {
+	if c.syncing {
+		return nil, l2.ErrEngineSyncing
+	}
+	return &l2.ForkchoiceUpdatedResult{Status: l2.UpdateSuccess}, nil
+}
+
+func TestEngineSyncing(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlError)
+	engine := &catchingUpL2Chain{syncing: true}
+	output := &insertingOutput{syncing: true}
+	s := NewState(&Config{}, logger, logger, rollup.Config{}, nil, engine, output, nil)
+	s.l2Head = eth.L2BlockRef{Hash: common.Hash{1}, Number: 1}
+
+	// the payload is kept until the engine caught up
+	s.payloadQueue.Push(testPayload(2, 2, 1))
+	s.insertQueuedPayloads(context.Background())
+	require.True(t, s.engineSyncing)
+	require.Equal(t, 1, s.payloadQueue.Len())
+	status := s.syncStatus()
+	require.True(t, status.EngineSyncing)
+	require.Equal(t, 1, status.QueuedPayloads)
+	require.Equal(t, s.l2Head, status.UnsafeL2)
+
+	synced, err := s.checkEngineSynced(context.Background())
+	require.NoError(t, err)
+	require.False(t, synced)
+	require.True(t, s.engineSyncing)
+
+	engine.syncing = false
+	output.syncing = false
+	synced, err = s.checkEngineSynced(context.Background())
+	require.NoError(t, err)
+	require.True(t, synced)
+	require.False(t, s.engineSyncing)
+	s.insertQueuedPayloads(context.Background())
+	require.Equal(t, common.Hash{2}, s.l2Head.Hash)
+	require.Zero(t, s.payloadQueue.Len())
+
+	require.False(t, s.checkEngineSyncing(nil))
+	require.False(t, s.engineSyncing)
+}
@@ -0,0 +1,147 @@
+package driver
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// HeadKind identifies which of the L2 heads tracked by the driver changed.
+type HeadKind uint8
+
+const (
+	UnsafeHead HeadKind = iota
+	SafeHead
+	FinalizedHead
+)
+
+func (k HeadKind) String() string {
+	switch k {
+	case UnsafeHead:
+		return "unsafe"
+	case SafeHead:
+		return "safe"
+	case FinalizedHead:
+		return "finalized"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(k))
+	}
+}
+
+func (k HeadKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *HeadKind) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "unsafe":
+		*k = UnsafeHead
+	case "safe":
+		*k = SafeHead
+	case "finalized":
+		*k = FinalizedHead
+	default:
+		return fmt.Errorf("unknown head kind %q, expected 'unsafe', 'safe' or 'finalized'", text)
+	}
+	return nil
+}
+
+// HeadEvent is emitted by the driver whenever one of the L2 heads changes.
+type HeadEvent struct {
+	Kind HeadKind       `json:"kind"`
+	Old  eth.L2BlockRef `json:"old"`
+	New  eth.L2BlockRef `json:"new"`
+	// ReorgDepth is the number of blocks of the old chain that are no longer canonical,
+	// or 0 if the new head simply extends the old head.
+	// When a reorg is detected during derivation, the exact fork point is not known,
+	// and the depth is measured from the previous safe head.
+	ReorgDepth uint64 `json:"reorgDepth"`
+}
+
+// SequencerEvent is the data of the events of the sequencer being started or stopped.
+type SequencerEvent struct {
+	L2Head eth.L2BlockRef `json:"l2Head"`
+}
+
+// SubscribeHeadChanges subscribes to changes of the unsafe, safe and finalized L2 heads.
+// The driver does not wait for subscribers: an event is dropped for a subscriber whose channel is full,
+// so the channel should be buffered. The next event of the same kind has the current head again.
+func (d *Driver) SubscribeHeadChanges(ch chan<- HeadEvent) event.Subscription {
+	return d.s.headsFeed.subscribe(ch)
+}
+
+// headFeed sends the head events to the subscribers without blocking the driver loop.
+type headFeed struct {
+	mu   sync.Mutex
+	subs map[*headSub]struct{}
+}
+
+type headSub struct {
+	ch chan<- HeadEvent
+}
+
+func (f *headFeed) subscribe(ch chan<- HeadEvent) event.Subscription {
+	s := &headSub{ch: ch}
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[*headSub]struct{})
+	}
+	f.subs[s] = struct{}{}
+	f.mu.Unlock()
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		f.mu.Lock()
+		delete(f.subs, s)
+		f.mu.Unlock()
+		return nil
+	})
+}
+
+// send delivers the event to each subscriber with room in its channel, and drops it for the others.
+func (f *headFeed) send(ev HeadEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			metrics.GetOrRegisterCounter("driver/head_events/dropped", nil).Inc(1)
+		}
+	}
+}
+
+// emitHeadChanges sends a HeadEvent for each head that changed compared to the given previous heads,
+// and records the reorgs in the reorg history. unsafeReorgDepth is the number of unsafe blocks that were reverted, if any.
+func (s *state) emitHeadChanges(prevUnsafe eth.L2BlockRef, prevSafe eth.L2BlockRef, prevFinalized eth.BlockID, unsafeReorgDepth uint64) {
+	if s.l2Head != prevUnsafe {
+		s.emitHeadChange(HeadEvent{Kind: UnsafeHead, Old: prevUnsafe, New: s.l2Head, ReorgDepth: unsafeReorgDepth})
+	}
+	if s.l2SafeHead != prevSafe {
+		var depth uint64
+		if s.l2SafeHead.Number < prevSafe.Number {
+			depth = prevSafe.Number - s.l2SafeHead.Number
+		}
+		s.emitHeadChange(HeadEvent{Kind: SafeHead, Old: prevSafe, New: s.l2SafeHead, ReorgDepth: depth})
+	}
+	if s.l2Finalized != prevFinalized {
+		s.headsFeed.send(HeadEvent{
+			Kind: FinalizedHead,
+			Old:  eth.L2BlockRef{Hash: prevFinalized.Hash, Number: prevFinalized.Number},
+			New:  eth.L2BlockRef{Hash: s.l2Finalized.Hash, Number: s.l2Finalized.Number},
+		})
+	}
+}
+
+func (s *state) emitHeadChange(ev HeadEvent) {
+	if ev.ReorgDepth > 0 {
+		reorg := ReorgEvent{Kind: ev.Kind, Old: ev.Old, New: ev.New, Depth: ev.ReorgDepth, L1Head: s.l1Head, Time: time.Now()}
+		s.reorgs.add(reorg)
+		s.events.Emit(events.Reorg, reorg)
+	}
+	s.headsFeed.send(ev)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"sync"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
@@ -77,23 +78,30 @@ func NewFakeChainSource(l1 []string, l2 []string, log log.Logger) *fakeChainSour
 		l1s: l1s,
 		l2s: l2s,
 		log: log,
+
+		l1finalized: -1,
 	}
 }
 
 // fakeChainSource implements the ChainSource interface with the ability to control
 // what the head block is of the L1 and L2 chains. In addition, it enables re-orgs
-// to easily be implemented
+// to easily be implemented. It is safe for concurrent use, so that the test can advance the chains
+// while the state loop reads them.
 type fakeChainSource struct {
-	l1reorg int                // Index of the L1 chain to be operating on
-	l2reorg int                // Index of the L2 chain to be operating on
-	l1head  int                // Head block of the L1 chain
-	l2head  int                // Head block of the L2 chain
-	l1s     [][]eth.L1BlockRef // l1s[reorg] is the L1 chain in that specific re-org configuration
-	l2s     [][]eth.L2BlockRef // l2s[reorg] is the L2 chain in that specific re-org configuration
-	log     log.Logger
+	mu          sync.Mutex
+	l1reorg     int                // Index of the L1 chain to be operating on
+	l2reorg     int                // Index of the L2 chain to be operating on
+	l1head      int                // Head block of the L1 chain
+	l2head      int                // Head block of the L2 chain
+	l1finalized int                // Finalized block of the L1 chain, there is none if negative
+	l1s         [][]eth.L1BlockRef // l1s[reorg] is the L1 chain in that specific re-org configuration
+	l2s         [][]eth.L2BlockRef // l2s[reorg] is the L2 chain in that specific re-org configuration
+	log         log.Logger
 }
 
 func (m *fakeChainSource) L1Range(ctx context.Context, base eth.BlockID, max uint64) ([]eth.BlockID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	var out []eth.BlockID
 	found := false
 	for i, b := range m.l1s[m.l1reorg] {
@@ -115,6 +123,12 @@ func (m *fakeChainSource) L1Range(ctx context.Context, base eth.BlockID, max uin
 }
 
 func (m *fakeChainSource) L1BlockRefByNumber(ctx context.Context, l1Num uint64) (eth.L1BlockRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.l1BlockRefByNumber(l1Num)
+}
+
+func (m *fakeChainSource) l1BlockRefByNumber(l1Num uint64) (eth.L1BlockRef, error) {
 	m.log.Trace("L1BlockRefByNumber", "l1Num", l1Num, "l1Head", m.l1head, "reorg", m.l1reorg)
 	if l1Num > uint64(m.l1head) {
 		return eth.L1BlockRef{}, ethereum.NotFound
@@ -123,16 +137,24 @@ func (m *fakeChainSource) L1BlockRefByNumber(ctx context.Context, l1Num uint64)
 }
 
 func (m *fakeChainSource) L1BlockRefByHash(ctx context.Context, l1Hash common.Hash) (eth.L1BlockRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.log.Trace("L1BlockRefByHash", "l1Hash", l1Hash, "l1Head", m.l1head, "reorg", m.l1reorg)
 	for i, bl := range m.l1s[m.l1reorg] {
 		if bl.Hash == l1Hash {
-			return m.L1BlockRefByNumber(ctx, uint64(i))
+			return m.l1BlockRefByNumber(uint64(i))
 		}
 	}
 	return eth.L1BlockRef{}, ethereum.NotFound
 }
 
 func (m *fakeChainSource) L1HeadBlockRef(ctx context.Context) (eth.L1BlockRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.l1HeadBlockRef()
+}
+
+func (m *fakeChainSource) l1HeadBlockRef() (eth.L1BlockRef, error) {
 	m.log.Trace("L1HeadBlockRef", "l1Head", m.l1head, "reorg", m.l1reorg)
 	l := len(m.l1s[m.l1reorg])
 	if l == 0 {
@@ -141,7 +163,30 @@ func (m *fakeChainSource) L1HeadBlockRef(ctx context.Context) (eth.L1BlockRef, e
 	return m.l1s[m.l1reorg][m.l1head], nil
 }
 
+func (m *fakeChainSource) L1BlockRefByLabel(ctx context.Context, label eth.BlockLabel) (eth.L1BlockRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.log.Trace("L1BlockRefByLabel", "label", label, "l1Head", m.l1head, "reorg", m.l1reorg)
+	switch label {
+	case eth.Unsafe:
+		return m.l1HeadBlockRef()
+	case eth.Finalized:
+		if m.l1finalized < 0 {
+			return eth.L1BlockRef{}, ethereum.NotFound
+		}
+		return m.l1BlockRefByNumber(uint64(m.l1finalized))
+	default:
+		return eth.L1BlockRef{}, ethereum.NotFound
+	}
+}
+
 func (m *fakeChainSource) L2BlockRefByNumber(ctx context.Context, l2Num *big.Int) (eth.L2BlockRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.l2BlockRefByNumber(l2Num)
+}
+
+func (m *fakeChainSource) l2BlockRefByNumber(l2Num *big.Int) (eth.L2BlockRef, error) {
 	m.log.Trace("L2BlockRefByNumber", "l2Num", l2Num, "l2Head", m.l2head, "reorg", m.l2reorg)
 	if len(m.l2s[m.l2reorg]) == 0 {
 		panic("bad test, no l2 chain")
@@ -157,16 +202,20 @@ func (m *fakeChainSource) L2BlockRefByNumber(ctx context.Context, l2Num *big.Int
 }
 
 func (m *fakeChainSource) L2BlockRefByHash(ctx context.Context, l2Hash common.Hash) (eth.L2BlockRef, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.log.Trace("L2BlockRefByHash", "l2Hash", l2Hash, "l2Head", m.l2head, "reorg", m.l2reorg)
 	for i, bl := range m.l2s[m.l2reorg] {
 		if bl.Hash == l2Hash {
-			return m.L2BlockRefByNumber(ctx, big.NewInt(int64(i)))
+			return m.l2BlockRefByNumber(big.NewInt(int64(i)))
 		}
 	}
 	return eth.L2BlockRef{}, ethereum.NotFound
 }
 
 func (m *fakeChainSource) ForkchoiceUpdate(ctx context.Context, state *l2.ForkchoiceState, attr *l2.PayloadAttributes) (*l2.ForkchoiceUpdatedResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.log.Trace("ForkchoiceUpdate", "newHead", state.HeadBlockHash, "l2Head", m.l2head, "reorg", m.l2reorg)
 	m.l2reorg++
 	if m.l2reorg >= len(m.l2s) {
@@ -185,6 +234,8 @@ var _ L1Chain = (*fakeChainSource)(nil)
 var _ L2Chain = (*fakeChainSource)(nil)
 
 func (m *fakeChainSource) reorgL1() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.log.Trace("Reorg L1", "new_reorg", m.l1reorg+1, "old_reorg", m.l1reorg)
 	m.l1reorg++
 	if m.l1reorg >= len(m.l1s) {
@@ -193,6 +244,8 @@ func (m *fakeChainSource) reorgL1() {
 }
 
 func (m *fakeChainSource) setL2Head(head int) eth.L2BlockRef {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.log.Trace("Set L2 head", "new_head", head, "old_head", m.l2head)
 	m.l2head = head
 	if m.l2head >= len(m.l2s[m.l2reorg]) {
@@ -202,6 +255,8 @@ func (m *fakeChainSource) setL2Head(head int) eth.L2BlockRef {
 }
 
 func (m *fakeChainSource) advanceL1() eth.L1BlockRef {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.log.Trace("Advance L1", "new_head", m.l1head+1, "old_head", m.l1head)
 	m.l1head++
 	if m.l1head >= len(m.l1s[m.l1reorg]) {
@@ -211,6 +266,8 @@ func (m *fakeChainSource) advanceL1() eth.L1BlockRef {
 }
 
 func (m *fakeChainSource) l1Head() eth.L1BlockRef {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.log.Trace("L1 Head", "head", m.l1head)
 	return m.l1s[m.l1reorg][m.l1head]
 }
@@ -0,0 +1,66 @@
+package driver
+
+import (
+	"context"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+)
+
+// maxFinalityData bounds the derived epochs that are kept to finalize the L2 chain.
+// The oldest epochs are dropped when catching up faster than L1 finalizes, the L2 chain is then finalized less granularly.
+const maxFinalityData = 512
+
+// finalityData is a safe L2 head, and the last L1 block that it was derived from.
+// The L2 block is finalized once the L1 block is finalized.
+type finalityData struct {
+	l2 eth.BlockID
+	l1 eth.BlockID
+}
+
+// recordFinalityData records the safe L2 head that was derived up to the given L1 block, to finalize it later.
+func (s *state) recordFinalityData(l1 eth.BlockID) {
+	s.finalityData = append(s.finalityData, finalityData{l2: s.l2SafeHead.ID(), l1: l1})
+	if len(s.finalityData) > maxFinalityData {
+		s.finalityData = append(s.finalityData[:0], s.finalityData[len(s.finalityData)-maxFinalityData:]...)
+	}
+}
+
+// dropFinalityData drops the recorded safe L2 heads after the current safe head, after a reorg.
+func (s *state) dropFinalityData() {
+	for i, fd := range s.finalityData {
+		if fd.l2.Number > s.l2SafeHead.Number {
+			s.finalityData = s.finalityData[:i]
+			return
+		}
+	}
+}
+
+// updateFinalized fetches the finalized L1 block, and finalizes the L2 blocks that were derived from finalized L1 blocks only.
+// The L2 chain is not finalized if the L1 chain does not support the finalized label (before the merge).
+func (s *state) updateFinalized(ctx context.Context) {
+	finalized, err := s.l1.L1BlockRefByLabel(ctx, eth.Finalized)
+	if err != nil {
+		s.log.Debug("Failed to fetch the finalized L1 block", "err", err)
+		return
+	}
+	if finalized.Number <= s.l1Finalized.Number {
+		return
+	}
+	s.l1Finalized = finalized
+	if s.sequencer {
+		s.bss.L1Finalized(finalized)
+	}
+
+	prevFinalized := s.l2Finalized
+	i := 0
+	for ; i < len(s.finalityData) && s.finalityData[i].l1.Number <= finalized.Number; i++ {
+		if fd := s.finalityData[i]; fd.l2.Number > s.l2Finalized.Number {
+			s.l2Finalized = fd.l2
+		}
+	}
+	s.finalityData = append(s.finalityData[:0], s.finalityData[i:]...)
+	if s.l2Finalized != prevFinalized {
+		s.log.Info("Finalized L2 blocks", "l2Finalized", s.l2Finalized, "l1Finalized", finalized)
+		s.emitHeadChanges(s.l2Head, s.l2SafeHead, prevFinalized, 0)
+	}
+}
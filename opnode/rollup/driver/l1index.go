@@ -0,0 +1,108 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/sync"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrNoIndex is returned by the lookups of the index when the driver runs without an index.
+var ErrNoIndex = errors.New("driver has no index")
+
+// indexedL2Chain serves the L2 chain, with lookups of the safe L2 blocks by L1 origin from the index.
+type indexedL2Chain struct {
+	L2Chain
+	*index.DB
+}
+
+var _ sync.L2ChainIndex = (*indexedL2Chain)(nil)
+
+// findL2Heads finds the unsafe and safe L2 heads by walking back from the given L2 block,
+// skipping over the reorged L2 blocks with the L1 origin index if there is one.
+func (s *state) findL2Heads(ctx context.Context, start eth.L2BlockRef) (unsafe eth.L2BlockRef, safe eth.L2BlockRef, err error) {
+	var l2 sync.L2Chain = s.l2
+	if s.index != nil {
+		l2 = &indexedL2Chain{L2Chain: s.l2, DB: s.index}
+	}
+	return sync.FindL2Heads(ctx, start, s.Config.SeqWindowSize, s.maxReorgDepth, s.l1, l2, &s.Config.Genesis)
+}
+
+// indexSafeHead records the safe head in the L1 origin index. It must be called whenever the safe head changes.
+// The index is only an optimization: failures are logged, not returned.
+func (s *state) indexSafeHead() {
+	if s.index == nil {
+		return
+	}
+	if err := s.index.Put(s.l2SafeHead); err != nil {
+		s.log.Warn("Failed to index safe head by L1 origin", "l2SafeHead", s.l2SafeHead, "err", err)
+	}
+}
+
+// batchInclusionRetention is the time that the batch inclusions of the safe L2 blocks are kept in the index for
+const batchInclusionRetention = 7 * 24 * time.Hour
+
+// indexBatchInclusion records the batch data on L1 that the safe L2 block was derived from,
+// and prunes the batch inclusions of the L2 blocks older than batchInclusionRetention.
+// The index is only a lookup for users, failures are logged, not returned.
+func (d *outputImpl) indexBatchInclusion(ref eth.L2BlockRef, inclusions []index.BatchInclusion) {
+	if d.index == nil {
+		return
+	}
+	if err := d.index.PutBatchInclusion(ref.ID(), inclusions); err != nil {
+		d.log.Warn("Failed to index batch inclusion", "l2", ref, "err", err)
+	}
+	if d.Config.BlockTime == 0 {
+		return
+	}
+	retained := uint64(batchInclusionRetention/time.Second) / d.Config.BlockTime
+	if ref.Number <= retained {
+		return
+	}
+	if _, err := d.index.PruneBatchInclusions(ref.Number - retained); err != nil {
+		d.log.Warn("Failed to prune batch inclusions", "l2", ref, "err", err)
+	}
+}
+
+// BatchInclusion returns the items of batch data on L1 that the safe L2 block with the given hash was derived from,
+// or ethereum.NotFound if the block was not derived by this node. Deposit-only blocks have no items.
+func (d *Driver) BatchInclusion(ctx context.Context, l2Hash common.Hash) ([]index.BatchInclusion, error) {
+	if d.s.index == nil {
+		return nil, ErrNoIndex
+	}
+	return d.s.index.BatchInclusion(l2Hash)
+}
+
+// L2BlocksByBatchTx returns the canonical L2 blocks that were derived from the batch data of the given L1 transaction,
+// by increasing number.
+func (d *Driver) L2BlocksByBatchTx(ctx context.Context, txHash common.Hash) ([]eth.BlockID, error) {
+	if d.s.index == nil {
+		return nil, ErrNoIndex
+	}
+	ids, err := d.s.index.L2BlocksByBatchTx(txHash)
+	if err != nil {
+		return nil, err
+	}
+	out := []eth.BlockID{}
+	for _, id := range ids {
+		// the blocks of the transaction may have been reorged out since
+		ref, err := d.s.l2.L2BlockRefByNumber(ctx, new(big.Int).SetUint64(id.Number))
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if ref.Hash == id.Hash {
+			out = append(out, id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out, nil
+}
@@ -0,0 +1,45 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestL2BlocksByBatchTx(t *testing.T) {
+	A := fakeL2Block('A', 0, fakeID('a', 0), 0)
+	B := fakeL2Block('B', 'A', fakeID('b', 1), 1)
+	C := fakeL2Block('C', 'B', fakeID('b', 1), 2)
+	X := fakeL2Block('X', 'B', fakeID('b', 1), 2)
+	logger := testlog.Logger(t, log.LvlError)
+	s := NewState(&Config{}, logger, logger, rollup.Config{}, nil, &stubL2Chain{blocks: []eth.L2BlockRef{A, B, C}}, outputHandlerFn(nil), nil)
+	d := &Driver{s: s}
+	ctx := context.Background()
+
+	_, err := d.BatchInclusion(ctx, B.Hash)
+	require.ErrorIs(t, err, ErrNoIndex)
+
+	s.index, err = index.Open("")
+	require.NoError(t, err)
+	defer s.index.Close()
+	tx := common.Hash{0xaa}
+	inclusion := []index.BatchInclusion{{L1: fakeID('b', 1), Tx: tx}}
+	// X was reorged out by C, which was derived from the same batch transaction
+	for _, ref := range []eth.L2BlockRef{C, X, B} {
+		require.NoError(t, s.index.PutBatchInclusion(ref.ID(), inclusion))
+	}
+
+	got, err := d.BatchInclusion(ctx, B.Hash)
+	require.NoError(t, err)
+	require.Equal(t, inclusion, got)
+	blocks, err := d.L2BlocksByBatchTx(ctx, tx)
+	require.NoError(t, err)
+	require.Equal(t, []eth.BlockID{B.ID(), C.ID()}, blocks, "canonical blocks by number")
+}
@@ -0,0 +1,91 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// OriginSelector determines the L1 origin of the next L2 block when sequencing, see Config.OriginSelector.
+type OriginSelector interface {
+	// FindL1Origin returns the L1 origin to build the next L2 block on top of l2Head with,
+	// given the latest known L1 head. It also returns the max timestamp (excl.) that
+	// a L2 block can be built at with the returned origin.
+	FindL1Origin(ctx context.Context, l1Head eth.L1BlockRef, l2Head eth.L2BlockRef) (eth.L1BlockRef, uint64, error)
+}
+
+// L1OriginSelector is the default OriginSelector: it eagerly advances to the next L1 block,
+// and repeats the current origin within the sequencer drift when the next L1 block is not available yet.
+type L1OriginSelector struct {
+	log log.Logger
+	cfg *rollup.Config
+	l1  L1Chain
+}
+
+func NewL1OriginSelector(log log.Logger, cfg *rollup.Config, l1 L1Chain) *L1OriginSelector {
+	return &L1OriginSelector{
+		log: log,
+		cfg: cfg,
+		l1:  l1,
+	}
+}
+
+// FindL1Origin determines what the next L1 Origin should be.
+// The L1 Origin is either the L2 Head's Origin, or the following L1 block
+// if the next L2 block's time is greater than or equal to the L2 Head's Origin.
+// Also return the max timestamp (excl.) that we can build a L2 block at using the returned origin.
+func (los *L1OriginSelector) FindL1Origin(ctx context.Context, l1Head eth.L1BlockRef, l2Head eth.L2BlockRef) (eth.L1BlockRef, uint64, error) {
+	// If we are at the head block, don't do a lookup.
+	// Don't do a timestamp check either as we are unable to get the next block even if we wanted to.
+	if l2Head.L1Origin.Hash == l1Head.Hash {
+		return l1Head, l1Head.Time + los.cfg.MaxSequencerDrift, nil
+	}
+
+	// Grab the block ref
+	currentOrigin, err := los.l1.L1BlockRefByHash(ctx, l2Head.L1Origin.Hash)
+	if err != nil {
+		return eth.L1BlockRef{}, 0, err
+	}
+
+	nextOrigin, err := los.l1.L1BlockRefByNumber(ctx, currentOrigin.Number+1)
+	if errors.Is(err, ethereum.NotFound) {
+		// No new L1 origin found yet, repeat the current one.
+		// The sequencer drift bounds how long the origin can be repeated.
+		los.log.Info("No new L1 origin, staying with current one", "l2Head", l2Head, "l1Origin", currentOrigin)
+		return currentOrigin, currentOrigin.Time + los.cfg.MaxSequencerDrift, nil
+	} else if err != nil {
+		return eth.L1BlockRef{}, 0, fmt.Errorf("failed to fetch next L1 origin after %s: %w", currentOrigin, err)
+	}
+
+	nextL2Time := l2Head.Time + los.cfg.BlockTime
+
+	// If we can, start building on the next L1 origin
+	if nextL2Time >= nextOrigin.Time { // TODO: this is where we can add confirmation distance, instead of eagerly building on the very latest L1 block
+		los.log.Info("Advancing L1 Origin", "l2Head", l2Head, "previous_l1Origin", l2Head.L1Origin, "l1Origin", nextOrigin)
+		return nextOrigin, nextOrigin.Time + los.cfg.MaxSequencerDrift, nil
+	}
+
+	// If there is no more slack left (including the sequencer drift), then we will have to start building on the next L1 origin
+	maxL2Time := currentOrigin.Time + los.cfg.MaxSequencerDrift
+	if nextL2Time >= maxL2Time { // the maxL2Time is an excl. bound on the current epoch.
+		// If we are not matching the L1 origin (due to a large gap between L1 blocks), then we stay with the current origin.
+		// This matches the `next_l1_timestamp - l2_block_time` part of the `new_head_l2_timestamp`, the batches will still be valid.
+		if nextL2Time < nextOrigin.Time {
+			los.log.Warn("Ran out of slack with current epoch, but the next L1 block is still ahead in time, thus we continue the epoch",
+				"l2Head", l2Head, "previous_l1Origin", l2Head.L1Origin, "l1Origin", nextOrigin)
+			return currentOrigin, nextOrigin.Time, nil
+		}
+		// The L1 chain continues, and eventually the sequencer will be forced onto the chain with deposits from L1
+		los.log.Warn("Forced to advance to new L1 Origin", "l2Head", l2Head, "previous_l1Origin", l2Head.L1Origin, "l1Origin", nextOrigin)
+		return nextOrigin, nextOrigin.Time + los.cfg.MaxSequencerDrift, nil
+	}
+
+	// If we have a next
+	los.log.Info("Next L1 Origin is the same as the previous", "l2Head", l2Head, "l1Origin", currentOrigin)
+	return currentOrigin, currentOrigin.Time + los.cfg.MaxSequencerDrift, nil
+}
@@ -0,0 +1,104 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubL1Chain serves a fixed set of L1 blocks, and returns err for any other block number.
+type stubL1Chain struct {
+	L1Chain
+	blocks []eth.L1BlockRef
+	err    error
+}
+
+func (m *stubL1Chain) L1BlockRefByNumber(ctx context.Context, num uint64) (eth.L1BlockRef, error) {
+	if num >= uint64(len(m.blocks)) {
+		return eth.L1BlockRef{}, m.err
+	}
+	return m.blocks[num], nil
+}
+
+func (m *stubL1Chain) L1BlockRefByHash(ctx context.Context, hash common.Hash) (eth.L1BlockRef, error) {
+	for _, b := range m.blocks {
+		if b.Hash == hash {
+			return b, nil
+		}
+	}
+	return eth.L1BlockRef{}, ethereum.NotFound
+}
+
+func TestL1OriginSelectorRepeat(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	a := fakeL1Block('a', 0, 0)
+	a.Time = 100
+	l2Head := fakeL2Block('A', 0, a.ID(), 0)
+	l2Head.Time = 102
+	cfg := rollup.Config{BlockTime: 2, MaxSequencerDrift: 10}
+
+	// The L1 head is unknown to the driver, and the next L1 block does not exist yet: repeat the current origin
+	src := &stubL1Chain{blocks: []eth.L1BlockRef{a}, err: ethereum.NotFound}
+	los := NewL1OriginSelector(log, &cfg, src)
+	l1Head := fakeL1Block('b', 'a', 1)
+	origin, maxL2Time, err := los.FindL1Origin(context.Background(), l1Head, l2Head)
+	assert.NoError(t, err)
+	assert.Equal(t, a, origin)
+	assert.Equal(t, a.Time+cfg.MaxSequencerDrift, maxL2Time)
+
+	// Other errors are not mistaken for a missing block
+	src.err = errors.New("connection refused")
+	_, _, err = los.FindL1Origin(context.Background(), l1Head, l2Head)
+	assert.ErrorIs(t, err, src.err)
+}
+
+func TestL1OriginSelectorAdvance(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	a, b := fakeL1Block('a', 0, 0), fakeL1Block('b', 'a', 1)
+	a.Time, b.Time = 100, 112
+	cfg := rollup.Config{BlockTime: 2, MaxSequencerDrift: 10}
+	los := NewL1OriginSelector(log, &cfg, &stubL1Chain{blocks: []eth.L1BlockRef{a, b}, err: ethereum.NotFound})
+	l1Head := fakeL1Block('c', 'b', 2)
+
+	l2Head := fakeL2Block('A', 0, a.ID(), 0)
+	l2Head.Time = 104
+	origin, _, err := los.FindL1Origin(context.Background(), l1Head, l2Head)
+	assert.NoError(t, err)
+	assert.Equal(t, a, origin, "next L1 block is ahead of the next L2 block")
+
+	l2Head.Time = 110
+	origin, maxL2Time, err := los.FindL1Origin(context.Background(), l1Head, l2Head)
+	assert.NoError(t, err)
+	assert.Equal(t, b, origin, "advance when the next L2 block reaches the next L1 block time")
+	assert.Equal(t, b.Time+cfg.MaxSequencerDrift, maxL2Time)
+}
+
+type originSelectorFn func(ctx context.Context, l1Head eth.L1BlockRef, l2Head eth.L2BlockRef) (eth.L1BlockRef, uint64, error)
+
+func (fn originSelectorFn) FindL1Origin(ctx context.Context, l1Head eth.L1BlockRef, l2Head eth.L2BlockRef) (eth.L1BlockRef, uint64, error) {
+	return fn(ctx, l1Head, l2Head)
+}
+
+func TestCustomOriginSelector(t *testing.T) {
+	policyErr := errors.New("no origin by policy")
+	cfg := &Config{
+		SequencerEnabled: true,
+		OriginSelector: originSelectorFn(func(ctx context.Context, l1Head eth.L1BlockRef, l2Head eth.L2BlockRef) (eth.L1BlockRef, uint64, error) {
+			return eth.L1BlockRef{}, 0, policyErr
+		}),
+	}
+	s := NewState(cfg, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{}, nil, nil, nil, nil)
+	_, err := s.createNewL2Block(context.Background())
+	assert.ErrorIs(t, err, policyErr)
+
+	s = NewState(&Config{SequencerEnabled: true}, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{}, nil, nil, nil, nil)
+	assert.IsType(t, &L1OriginSelector{}, s.originSelector, "default origin selector")
+}
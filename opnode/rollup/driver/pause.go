@@ -0,0 +1,40 @@
+package driver
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrDerivationAlreadyPaused = errors.New("derivation already paused")
+	ErrDerivationNotPaused     = errors.New("derivation not paused")
+)
+
+// PauseDerivation stops the safe head from advancing, e.g. during an emergency response.
+// New L1 heads are still tracked, and L1 reorgs still rewind the safe head, but no new L2 blocks are derived
+// until ResumeDerivation is called. Unsafe blocks are still inserted, and produced if the sequencer is active.
+func (s *state) PauseDerivation(ctx context.Context) error {
+	return s.derivationRequest(ctx, s.pauseDerivation)
+}
+
+// ResumeDerivation continues the derivation paused by PauseDerivation, and catches up with the tracked L1 head.
+func (s *state) ResumeDerivation(ctx context.Context) error {
+	return s.derivationRequest(ctx, s.resumeDerivation)
+}
+
+func (s *state) derivationRequest(ctx context.Context, reqCh chan chan error) error {
+	respCh := make(chan error, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		return ErrDriverClosed
+	case reqCh <- respCh:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-respCh:
+		return err
+	}
+}
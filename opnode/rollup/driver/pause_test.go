@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseDerivation(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	chainSource := NewFakeChainSource([]string{"abcd"}, []string{"ABCD"}, log)
+	l1headsCh := make(chan eth.L1BlockRef, 10)
+	outputHandler := func(ctx context.Context, l2Head eth.L2BlockRef, l2SafeHead eth.L2BlockRef, l2Finalized eth.BlockID, l1Input []eth.BlockID) (eth.L2BlockRef, eth.L2BlockRef, bool, error) {
+		next := chainSource.setL2Head(int(l2Head.Number) + 1)
+		return next, next, false, nil
+	}
+	config := rollup.Config{SeqWindowSize: 2, Genesis: fakeGenesis('a', 'A', 0), BlockTime: 2}
+	state := NewState(&Config{}, log, log, config, chainSource, chainSource, outputHandlerFn(outputHandler), nil)
+	defer func() {
+		require.NoError(t, state.Close(), "Error closing state")
+	}()
+	require.NoError(t, state.Start(context.Background(), l1headsCh))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.ErrorIs(t, state.ResumeDerivation(ctx), ErrDerivationNotPaused)
+	require.NoError(t, state.PauseDerivation(ctx))
+	require.ErrorIs(t, state.PauseDerivation(ctx), ErrDerivationAlreadyPaused)
+
+	// the L1 heads are still tracked, but the safe head does not advance
+	l1headsCh <- chainSource.advanceL1()
+	b := chainSource.advanceL1()
+	l1headsCh <- b
+	require.Eventually(t, func() bool {
+		status, err := state.SyncStatus(ctx)
+		return err == nil && status.L1Head == b
+	}, time.Second, 5*time.Millisecond)
+	status, err := state.SyncStatus(ctx)
+	require.NoError(t, err)
+	require.True(t, status.DerivationPaused)
+	require.Equal(t, "A:0", testIDOf(status.SafeL2))
+
+	// resuming catches up with the tracked L1 head
+	require.NoError(t, state.ResumeDerivation(ctx))
+	require.Eventually(t, func() bool {
+		status, err := state.SyncStatus(ctx)
+		return err == nil && testIDOf(status.SafeL2) == "B:1"
+	}, time.Second, 5*time.Millisecond)
+	status, err = state.SyncStatus(ctx)
+	require.NoError(t, err)
+	require.False(t, status.DerivationPaused)
+}
@@ -0,0 +1,173 @@
+package driver
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultMaxQueuedPayloads is the default number of unsafe payloads that are held until their parents are inserted
+const defaultMaxQueuedPayloads = 256
+
+// rangeRequestRetryInterval is the time after which the same missing range of payloads is requested from the network again
+const rangeRequestRetryInterval = 10 * time.Second
+
+// payloadHeap is a min-heap of payloads, ordered by block number
+type payloadHeap []*UnsafePayload
+
+func (h payloadHeap) Len() int           { return len(h) }
+func (h payloadHeap) Less(i, j int) bool { return h[i].Payload.BlockNumber < h[j].Payload.BlockNumber }
+func (h payloadHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *payloadHeap) Push(x interface{}) {
+	*h = append(*h, x.(*UnsafePayload))
+}
+
+func (h *payloadHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// payloadQueue holds unsafe payloads that arrived ahead of the unsafe head, lowest block number first,
+// until their parents are inserted. It is bounded: when full, the payload furthest ahead is dropped.
+// Payloads are not verified, there may be multiple payloads with the same block number.
+type payloadQueue struct {
+	payloads payloadHeap
+	known    map[common.Hash]struct{}
+	max      int
+}
+
+func newPayloadQueue(max int) *payloadQueue {
+	if max <= 0 {
+		max = defaultMaxQueuedPayloads
+	}
+	return &payloadQueue{known: make(map[common.Hash]struct{}), max: max}
+}
+
+func (q *payloadQueue) Len() int {
+	return len(q.payloads)
+}
+
+// Push adds the payload to the queue. It returns false if the payload was already queued,
+// or if the queue is full and the payload is further ahead than all queued payloads.
+func (q *payloadQueue) Push(p *UnsafePayload) bool {
+	if _, ok := q.known[p.Payload.BlockHash]; ok {
+		return false
+	}
+	if len(q.payloads) >= q.max {
+		last := q.furthest()
+		if q.payloads[last].Payload.BlockNumber <= p.Payload.BlockNumber {
+			return false
+		}
+		delete(q.known, q.payloads[last].Payload.BlockHash)
+		heap.Remove(&q.payloads, last)
+	}
+	heap.Push(&q.payloads, p)
+	q.known[p.Payload.BlockHash] = struct{}{}
+	return true
+}
+
+// Peek returns the queued payload with the lowest block number, or nil if the queue is empty.
+func (q *payloadQueue) Peek() *UnsafePayload {
+	if len(q.payloads) == 0 {
+		return nil
+	}
+	return q.payloads[0]
+}
+
+// Pop removes and returns the queued payload with the lowest block number, or nil if the queue is empty.
+func (q *payloadQueue) Pop() *UnsafePayload {
+	if len(q.payloads) == 0 {
+		return nil
+	}
+	p := heap.Pop(&q.payloads).(*UnsafePayload)
+	delete(q.known, p.Payload.BlockHash)
+	return p
+}
+
+// furthest returns the index of the payload with the highest block number
+func (q *payloadQueue) furthest() int {
+	last := 0
+	for i, p := range q.payloads {
+		if p.Payload.BlockNumber > q.payloads[last].Payload.BlockNumber {
+			last = i
+		}
+	}
+	return last
+}
+
+// insertQueuedPayloads inserts the queued unsafe payloads that extend the unsafe head, in order, and drops the
+// payloads that can no longer extend it. Payloads further ahead stay queued until their parents are inserted.
+// The sources of invalid payloads are penalized.
+func (s *state) insertQueuedPayloads(ctx context.Context) {
+	inserter, ok := s.output.(unsafePayloadInserter)
+	if !ok || s.sequencerActive || s.snapSyncTarget != nil || s.engineSyncing {
+		return
+	}
+	for up := s.payloadQueue.Peek(); up != nil; up = s.payloadQueue.Peek() {
+		p := up.Payload
+		if uint64(p.BlockNumber) > s.l2Head.Number+1 {
+			// there is a gap, wait for the parent, and ask the network for the missing payloads
+			s.requestMissingPayloads(ctx, p)
+			return
+		}
+		s.payloadQueue.Pop()
+		if uint64(p.BlockNumber) <= s.l2Head.Number {
+			s.log.Debug("Dropping queued unsafe payload behind the unsafe head", "payload", p.ID(), "l2Head", s.l2Head)
+			continue
+		}
+		if p.ParentHash() != s.l2Head.Hash {
+			s.log.Warn("Dropping queued unsafe payload that does not extend the unsafe head", "payload", p.ID(), "parent", p.ParentHash(), "l2Head", s.l2Head)
+			continue
+		}
+		insertCtx, cancel := context.WithTimeout(ctx, s.newBlockTimeout)
+		ref, err := inserter.insertUnsafePayload(insertCtx, s.l2Head, p, s.l2SafeHead.ID(), s.l2Finalized)
+		cancel()
+		var invalid *invalidUnsafeBlockError
+		if s.checkEngineSyncing(err) {
+			// retry once the engine caught up
+			s.payloadQueue.Push(up)
+			return
+		} else if errors.As(err, &invalid) {
+			s.log.Warn("Rejected invalid unsafe payload", "payload", p.ID(), "source", up.Source, "err", err)
+			s.penalizeSource(up)
+			continue
+		} else if err != nil {
+			s.log.Error("Failed to insert unsafe payload", "payload", p.ID(), "err", err)
+			continue
+		}
+		prevUnsafe := s.l2Head
+		s.l2Head = ref
+		s.emitHeadChanges(prevUnsafe, s.l2SafeHead, s.l2Finalized, 0)
+		s.log.Info("Inserted unsafe payload", "l2Head", s.l2Head, "source", up.Source, "queued", s.payloadQueue.Len())
+	}
+}
+
+// requestMissingPayloads requests the payloads between the unsafe head and the queued payload from the network.
+// The same range is not requested again until rangeRequestRetryInterval passed.
+func (s *state) requestMissingPayloads(ctx context.Context, p *l2.ExecutionPayload) {
+	if s.network == nil {
+		return
+	}
+	end := eth.BlockID{Hash: p.ParentHash(), Number: uint64(p.BlockNumber) - 1}
+	now := time.Now()
+	if end == s.lastRangeRequest && now.Sub(s.lastRangeRequestTime) < rangeRequestRetryInterval {
+		return
+	}
+	s.lastRangeRequest = end
+	s.lastRangeRequestTime = now
+	if err := s.network.RequestL2Range(ctx, s.l2Head, end); err != nil {
+		s.log.Debug("Could not request the missing unsafe payloads", "l2Head", s.l2Head, "end", end, "err", err)
+		return
+	}
+	s.log.Info("Requested the missing unsafe payloads from the network", "l2Head", s.l2Head, "end", end)
+}
@@ -0,0 +1,201 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func testPayload(number uint64, hash byte, parent byte) *UnsafePayload {
+	return &UnsafePayload{Payload: &l2.ExecutionPayload{
+		BlockNumber:     l2.Uint64Quantity(number),
+		BlockHash:       common.Hash{hash},
+		ParentHashField: common.Hash{parent},
+	}, Source: "test"}
+}
+
+func TestPayloadQueue(t *testing.T) {
+	q := newPayloadQueue(3)
+	require.Nil(t, q.Peek())
+	require.True(t, q.Push(testPayload(5, 5, 4)))
+	require.True(t, q.Push(testPayload(3, 3, 2)))
+	require.False(t, q.Push(testPayload(3, 3, 2)), "duplicate")
+	require.True(t, q.Push(testPayload(4, 4, 3)))
+	require.Equal(t, 3, q.Len())
+
+	// when full, the payload furthest ahead is dropped
+	require.False(t, q.Push(testPayload(6, 6, 5)))
+	require.True(t, q.Push(testPayload(2, 2, 1)))
+	require.Equal(t, 3, q.Len())
+
+	for _, n := range []uint64{2, 3, 4} {
+		require.Equal(t, n, uint64(q.Peek().Payload.BlockNumber))
+		require.Equal(t, n, uint64(q.Pop().Payload.BlockNumber))
+	}
+	require.Nil(t, q.Pop())
+	require.True(t, q.Push(testPayload(5, 5, 4)), "dropped payload can be queued again")
+}
+
+// insertingOutput inserts unsafe payloads, by recording them. Payloads with the invalid hash are rejected,
+// and no payloads are accepted while syncing.
+type insertingOutput struct {
+	outputInterface
+	inserted []eth.BlockID
+	invalid  common.Hash
+	syncing  bool
+}
+
+func (o *insertingOutput) insertUnsafePayload(ctx context.Context, parent eth.L2BlockRef, payload *l2.ExecutionPayload, l2SafeHead eth.BlockID, l2Finalized eth.BlockID) (eth.L2BlockRef, error) {
+	if o.syncing {
+		return eth.L2BlockRef{}, l2.ErrEngineSyncing
+	}
+	if payload.BlockHash == o.invalid {
+		return eth.L2BlockRef{}, &invalidUnsafeBlockError{errors.New("invalid payload")}
+	}
+	o.inserted = append(o.inserted, payload.ID())
+	return eth.L2BlockRef{Hash: payload.BlockHash, Number: uint64(payload.BlockNumber), ParentHash: payload.ParentHash()}, nil
+}
+
+func TestInsertQueuedPayloads(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlError)
+	output := &insertingOutput{}
+	s := NewState(&Config{}, logger, logger, rollup.Config{}, nil, nil, output, nil)
+	s.l2Head = eth.L2BlockRef{Hash: common.Hash{1}, Number: 1}
+
+	// payloads arrive out of order, with a gap
+	s.payloadQueue.Push(testPayload(3, 3, 2))
+	s.payloadQueue.Push(testPayload(4, 4, 3))
+	s.insertQueuedPayloads(context.Background())
+	require.Empty(t, output.inserted)
+	require.Equal(t, uint64(1), s.l2Head.Number)
+
+	// the missing parent arrives, along with a payload that does not extend the chain
+	s.payloadQueue.Push(testPayload(2, 0xaa, 0xbb))
+	s.payloadQueue.Push(testPayload(2, 2, 1))
+	s.insertQueuedPayloads(context.Background())
+	require.Len(t, output.inserted, 3)
+	require.Equal(t, common.Hash{4}, s.l2Head.Hash)
+	require.Zero(t, s.payloadQueue.Len())
+
+	// the source of an invalid payload is penalized
+	output.invalid = common.Hash{5}
+	s.payloadQueue.Push(testPayload(5, 5, 4))
+	s.insertQueuedPayloads(context.Background())
+	require.Len(t, output.inserted, 3)
+	require.Equal(t, 1, s.payloadSources.invalid["test"])
+
+	// stale payloads are dropped, and nothing is inserted while sequencing
+	s.payloadQueue.Push(testPayload(3, 0xcc, 2))
+	s.insertQueuedPayloads(context.Background())
+	require.Zero(t, s.payloadQueue.Len())
+	s.sequencerActive = true
+	s.payloadQueue.Push(testPayload(5, 5, 4))
+	s.insertQueuedPayloads(context.Background())
+	require.Len(t, output.inserted, 3)
+}
+
+// rangeNetwork records the ranges of payloads that are requested
+type rangeNetwork struct {
+	Network
+	requests []eth.BlockID
+}
+
+func (n *rangeNetwork) RequestL2Range(ctx context.Context, start eth.L2BlockRef, end eth.BlockID) error {
+	n.requests = append(n.requests, start.ID(), end)
+	return nil
+}
+
+func TestRequestMissingPayloads(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlError)
+	output := &insertingOutput{}
+	network := &rangeNetwork{}
+	s := NewState(&Config{}, logger, logger, rollup.Config{}, nil, nil, output, nil)
+	s.network = network
+	s.l2Head = eth.L2BlockRef{Hash: common.Hash{1}, Number: 1}
+
+	// the payloads between the unsafe head and the first queued payload are requested
+	s.payloadQueue.Push(testPayload(5, 5, 4))
+	s.insertQueuedPayloads(context.Background())
+	require.Equal(t, []eth.BlockID{{Hash: common.Hash{1}, Number: 1}, {Hash: common.Hash{4}, Number: 4}}, network.requests)
+
+	// the same range is not requested again right away
+	s.insertQueuedPayloads(context.Background())
+	require.Len(t, network.requests, 2)
+	s.lastRangeRequestTime = s.lastRangeRequestTime.Add(-rangeRequestRetryInterval)
+	s.insertQueuedPayloads(context.Background())
+	require.Len(t, network.requests, 4)
+
+	// no range is requested without a gap
+	network.requests = nil
+	s.payloadQueue.Pop()
+	s.payloadQueue.Push(testPayload(2, 2, 1))
+	s.insertQueuedPayloads(context.Background())
+	require.Empty(t, network.requests)
+	require.Equal(t, common.Hash{2}, s.l2Head.Hash)
+}
+
+func TestOnUnsafeL2Payload(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlError)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	cfg := rollup.Config{L2ChainID: big.NewInt(901), P2PSequencerAddress: crypto.PubkeyToAddress(key.PublicKey)}
+	s := NewState(&Config{}, logger, logger, cfg, nil, nil, nil, nil)
+	ctx := context.Background()
+
+	payload := &l2.ExecutionPayload{ParentHashField: common.Hash{1}, BlockNumber: 2, Timestamp: 4}
+	payload.BlockHash, err = payload.ComputeBlockHash()
+	require.NoError(t, err)
+	hash := l2.PayloadSigningHash(cfg.L2ChainID, payload)
+	sig, err := crypto.Sign(hash[:], key)
+	require.NoError(t, err)
+
+	require.NoError(t, s.OnUnsafeL2Payload(ctx, &UnsafePayload{Payload: payload, Signature: sig, Source: "peer"}))
+	require.Equal(t, payload, (<-s.unsafePayloads).Payload)
+	require.NoError(t, s.OnUnsafeL2Payload(ctx, &UnsafePayload{Payload: payload, Source: "rpc", Trusted: true}), "trusted payloads may be unsigned")
+	<-s.unsafePayloads
+	require.ErrorIs(t, s.OnUnsafeL2Payload(ctx, &UnsafePayload{Payload: payload, Source: "unsigned"}), l2.ErrPayloadInvalid, "unsigned payload")
+	require.NoError(t, s.OnUnsafeL2Payload(ctx, &UnsafePayload{Payload: payload, Source: "peer", Linked: true}), "linked payloads may be unsigned")
+	<-s.unsafePayloads
+
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	otherSig, err := crypto.Sign(hash[:], otherKey)
+	require.NoError(t, err)
+	tampered := *payload
+	tampered.Timestamp++
+	for i := 0; i < maxInvalidPayloads; i++ {
+		require.ErrorIs(t, s.OnUnsafeL2Payload(ctx, &UnsafePayload{Payload: payload, Signature: otherSig, Source: "peer"}), l2.ErrPayloadInvalid)
+	}
+	require.ErrorIs(t, s.OnUnsafeL2Payload(ctx, &UnsafePayload{Payload: payload, Signature: sig, Source: "peer"}), ErrPayloadSourceBanned)
+	for i := 0; i < maxInvalidPayloads; i++ {
+		require.ErrorIs(t, s.OnUnsafeL2Payload(ctx, &UnsafePayload{Payload: &tampered, Source: "rpc", Trusted: true}), l2.ErrPayloadInvalid, "wrong block hash")
+	}
+	require.Empty(t, s.unsafePayloads)
+	require.NoError(t, s.OnUnsafeL2Payload(ctx, &UnsafePayload{Payload: payload, Source: "rpc", Trusted: true}), "trusted sources are not banned")
+}
+
+func TestPayloadSources(t *testing.T) {
+	ps := newPayloadSources()
+	now := time.Unix(1000, 0)
+	ps.now = func() time.Time { return now }
+	for i := 0; i < maxInvalidPayloads-1; i++ {
+		require.False(t, ps.penalize("a"))
+	}
+	require.False(t, ps.banned("a"))
+	require.True(t, ps.penalize("a"))
+	require.True(t, ps.banned("a"))
+	require.False(t, ps.banned("b"))
+	now = now.Add(payloadSourceBanTime)
+	require.False(t, ps.banned("a"), "ban expired")
+}
@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxInvalidPayloads is the number of invalid payloads after which a source is banned
+	maxInvalidPayloads = 3
+	// payloadSourceBanTime is the time that the payloads of a banned source are rejected for
+	payloadSourceBanTime = 10 * time.Minute
+)
+
+// payloadSources tracks the invalid unsafe payloads of each external source, and bans the sources
+// that keep feeding invalid payloads: their payloads are rejected until the ban expires.
+type payloadSources struct {
+	mu          sync.Mutex
+	invalid     map[string]int
+	bannedUntil map[string]time.Time
+	now         func() time.Time
+}
+
+func newPayloadSources() *payloadSources {
+	return &payloadSources{
+		invalid:     make(map[string]int),
+		bannedUntil: make(map[string]time.Time),
+		now:         time.Now,
+	}
+}
+
+// penalize records an invalid payload of the source. It returns true if the source is banned as a result.
+func (ps *payloadSources) penalize(source string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.invalid[source]++
+	if ps.invalid[source] < maxInvalidPayloads {
+		return false
+	}
+	delete(ps.invalid, source)
+	ps.bannedUntil[source] = ps.now().Add(payloadSourceBanTime)
+	return true
+}
+
+// banned returns true if the payloads of the source are rejected.
+func (ps *payloadSources) banned(source string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	until, ok := ps.bannedUntil[source]
+	if !ok {
+		return false
+	}
+	if !ps.now().Before(until) {
+		delete(ps.bannedUntil, source)
+		return false
+	}
+	return true
+}
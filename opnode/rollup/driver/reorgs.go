@@ -0,0 +1,67 @@
+package driver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// defaultReorgHistorySize is the default number of reorgs that are kept in the reorg history
+const defaultReorgHistorySize = 64
+
+// ReorgEvent is a reorg of one of the L2 heads: Depth blocks of the chain of the old head are no longer canonical.
+type ReorgEvent struct {
+	Kind  HeadKind       `json:"kind"`
+	Old   eth.L2BlockRef `json:"old"`
+	New   eth.L2BlockRef `json:"new"`
+	Depth uint64         `json:"depth"`
+	// L1Head is the L1 head when the reorg happened, i.e. the L1 block that triggered a reorg after an L1 reorg
+	L1Head eth.L1BlockRef `json:"l1Head"`
+	Time   time.Time      `json:"time"`
+}
+
+// reorgHistory keeps the last reorgs in a ring buffer, and counts them in the metrics.
+type reorgHistory struct {
+	mu     sync.Mutex
+	events []ReorgEvent
+	// next is the index of the next event in events, once the buffer is full
+	next int
+	size int
+}
+
+func newReorgHistory(size int) *reorgHistory {
+	if size <= 0 {
+		size = defaultReorgHistorySize
+	}
+	return &reorgHistory{size: size}
+}
+
+func (h *reorgHistory) add(ev ReorgEvent) {
+	metrics.GetOrRegisterCounter("driver/reorgs/"+ev.Kind.String(), nil).Inc(1)
+	metrics.GetOrRegisterHistogram("driver/reorgs/"+ev.Kind.String()+"/depth", nil, metrics.NewExpDecaySample(1028, 0.015)).Update(int64(ev.Depth))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.events) < h.size {
+		h.events = append(h.events, ev)
+		return
+	}
+	h.events[h.next] = ev
+	h.next = (h.next + 1) % h.size
+}
+
+// list returns the reorgs in the history, oldest first.
+func (h *reorgHistory) list() []ReorgEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]ReorgEvent, 0, len(h.events))
+	out = append(out, h.events[h.next:]...)
+	return append(out, h.events[:h.next]...)
+}
+
+// ReorgHistory returns the last reorgs of the unsafe and safe L2 heads, oldest first.
+func (d *Driver) ReorgHistory() []ReorgEvent {
+	return d.s.reorgs.list()
+}
@@ -0,0 +1,81 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorgHistory(t *testing.T) {
+	h := newReorgHistory(3)
+	require.Empty(t, h.list())
+	for i := uint64(1); i <= 5; i++ {
+		h.add(ReorgEvent{Kind: UnsafeHead, New: eth.L2BlockRef{Number: i}, Depth: i})
+	}
+	depths := func() (out []uint64) {
+		for _, ev := range h.list() {
+			out = append(out, ev.Depth)
+		}
+		return out
+	}
+	require.Equal(t, []uint64{3, 4, 5}, depths(), "the oldest reorgs are dropped")
+	h.add(ReorgEvent{Kind: SafeHead, Depth: 6})
+	require.Equal(t, []uint64{4, 5, 6}, depths())
+}
+
+func TestEmitHeadChangesRecordsReorgs(t *testing.T) {
+	s := &state{reorgs: newReorgHistory(0), l1Head: fakeL1Block('c', 'b', 2)}
+	A, B := fakeL2Block('A', 0, fakeID('a', 0), 0), fakeL2Block('B', 'A', fakeID('b', 1), 1)
+	X := fakeL2Block('X', 'A', fakeID('b', 1), 1)
+
+	s.l2Head, s.l2SafeHead = B, A
+	s.emitHeadChanges(A, A, eth.BlockID{}, 0)
+	require.Empty(t, s.reorgs.list(), "extensions are not reorgs")
+
+	s.l2Head = X
+	s.emitHeadChanges(B, A, eth.BlockID{}, 1)
+	reorgs := s.reorgs.list()
+	require.Len(t, reorgs, 1)
+	require.Equal(t, UnsafeHead, reorgs[0].Kind)
+	require.Equal(t, B, reorgs[0].Old)
+	require.Equal(t, X, reorgs[0].New)
+	require.Equal(t, uint64(1), reorgs[0].Depth)
+	require.Equal(t, s.l1Head, reorgs[0].L1Head)
+}
+
+type recordingSink struct {
+	events []*events.Event
+}
+
+func (r *recordingSink) Write(ev *events.Event) error {
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func (r *recordingSink) Close() error {
+	return nil
+}
+
+func TestEmitHeadChangesEmitsReorgEvents(t *testing.T) {
+	sink := &recordingSink{}
+	bus := events.NewBus(testlog.Logger(t, log.LvlError), sink)
+	s := &state{reorgs: newReorgHistory(0), events: bus}
+	A, B := fakeL2Block('A', 0, fakeID('a', 0), 0), fakeL2Block('B', 'A', fakeID('b', 1), 1)
+	X := fakeL2Block('X', 'A', fakeID('b', 1), 1)
+
+	s.l2Head, s.l2SafeHead = B, A
+	s.emitHeadChanges(A, A, eth.BlockID{}, 0)
+	s.l2Head = X
+	s.emitHeadChanges(B, A, eth.BlockID{}, 1)
+	require.NoError(t, bus.Close())
+
+	require.Len(t, sink.events, 1, "only reorgs are emitted")
+	require.Equal(t, events.Reorg, sink.events[0].Type)
+	reorg := sink.events[0].Data.(ReorgEvent)
+	require.Equal(t, B, reorg.Old)
+	require.Equal(t, X, reorg.New)
+}
@@ -0,0 +1,81 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrResetBelowFinalized is returned when the L2 chain is reset to a block before the finalized L2 block.
+var ErrResetBelowFinalized = errors.New("cannot reset the L2 chain to before the finalized block")
+
+// ResetChain rewinds the L2 chain to the given block, e.g. to recover from a bad block.
+// The block becomes the unsafe head, and derivation restarts from it if it is not ahead of the safe head.
+func (s *state) ResetChain(ctx context.Context, blockHash common.Hash) error {
+	h := hashAndErrorChannel{
+		hash: blockHash,
+		err:  make(chan error, 1),
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		return ErrDriverClosed
+	case s.resetChain <- h:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-h.err:
+		return err
+	}
+}
+
+// rewindChain rewinds the L2 heads to the given block, and points the forkchoice of the engine to it.
+// If the block is not ahead of the safe head, it also becomes the safe head, and the derivation state
+// after it is dropped, so the L2 chain is derived again from the L1 origin of the block. Only called by the loop.
+func (s *state) rewindChain(ctx context.Context, blockHash common.Hash) error {
+	ref, err := s.l2.L2BlockRefByHash(ctx, blockHash)
+	if err != nil {
+		return fmt.Errorf("failed to fetch L2 block %s to reset to: %w", blockHash, err)
+	}
+	if ref.Number < s.l2Finalized.Number {
+		return fmt.Errorf("%w: block %s, finalized %s", ErrResetBelowFinalized, ref, s.l2Finalized)
+	}
+	safeHead := s.l2SafeHead
+	if ref.Number <= safeHead.Number {
+		safeHead = ref
+	}
+	fc := l2.ForkchoiceState{
+		HeadBlockHash:      ref.Hash,
+		SafeBlockHash:      safeHead.Hash,
+		FinalizedBlockHash: s.l2Finalized.Hash,
+	}
+	if _, err := s.l2.ForkchoiceUpdate(ctx, &fc, nil); err != nil {
+		return fmt.Errorf("failed to reset the forkchoice to %s: %w", ref, err)
+	}
+	prevUnsafe, prevSafe := s.l2Head, s.l2SafeHead
+	s.l2Head = ref
+	if safeHead != s.l2SafeHead {
+		s.l2SafeHead = safeHead
+		s.l1Traversal = derive.L1Traversal{}
+		s.output.reset(safeHead.L1Origin)
+		s.dropFinalityData()
+		s.indexSafeHead()
+		if err := s.wal.endEpoch(s.l2SafeHead, eth.BlockID{}, nil); err != nil {
+			s.log.Warn("Failed to log derivation progress", "err", err)
+		}
+	}
+	var depth uint64
+	if prevUnsafe.Number > ref.Number {
+		depth = prevUnsafe.Number - ref.Number
+	}
+	s.emitHeadChanges(prevUnsafe, prevSafe, s.l2Finalized, depth)
+	s.log.Warn("Reset the L2 chain", "l2Head", s.l2Head, "l2SafeHead", s.l2SafeHead, "prevL2Head", prevUnsafe, "prevL2SafeHead", prevSafe)
+	return nil
+}
@@ -0,0 +1,49 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewindChain(t *testing.T) {
+	a, b, c := fakeL1Block('a', 0, 0), fakeL1Block('b', 'a', 1), fakeL1Block('c', 'b', 2)
+	A := fakeL2Block('A', 0, a.ID(), 0)
+	B := fakeL2Block('B', 'A', b.ID(), 1)
+	C := fakeL2Block('C', 'B', c.ID(), 2)
+	D := fakeL2Block('D', 'C', c.ID(), 3)
+	engine := &stubL2Chain{blocks: []eth.L2BlockRef{A, B, C, D}}
+	logger := testlog.Logger(t, log.LvlError)
+	s := NewState(&Config{}, logger, logger, rollup.Config{}, nil, engine, outputHandlerFn(nil), nil)
+	s.l2Head, s.l2SafeHead, s.l2Finalized = D, C, A.ID()
+	s.l1Traversal.Extend(fakeID('d', 3))
+	s.finalityData = []finalityData{{l2: B.ID(), l1: b.ID()}, {l2: C.ID(), l1: c.ID()}}
+
+	// rewinding the unsafe chain keeps the derivation state
+	require.NoError(t, s.rewindChain(context.Background(), C.Hash))
+	require.Equal(t, C, s.l2Head)
+	require.Equal(t, C, s.l2SafeHead)
+	require.Equal(t, 1, s.l1Traversal.Len())
+	require.Equal(t, C.Hash, engine.fc.HeadBlockHash)
+
+	// rewinding the safe chain restarts derivation
+	require.NoError(t, s.rewindChain(context.Background(), B.Hash))
+	require.Equal(t, B, s.l2Head)
+	require.Equal(t, B, s.l2SafeHead)
+	require.Zero(t, s.l1Traversal.Len())
+	require.Len(t, s.finalityData, 1)
+	require.Equal(t, B.Hash, engine.fc.SafeBlockHash)
+	require.Equal(t, A.Hash, engine.fc.FinalizedBlockHash)
+
+	s.l2Finalized = B.ID()
+	require.ErrorIs(t, s.rewindChain(context.Background(), A.Hash), ErrResetBelowFinalized)
+	require.ErrorIs(t, s.rewindChain(context.Background(), common.Hash{0xff}), ethereum.NotFound)
+	require.Equal(t, B, s.l2Head)
+}
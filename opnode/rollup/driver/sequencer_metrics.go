@@ -0,0 +1,25 @@
+package driver
+
+import "github.com/ethereum/go-ethereum/metrics"
+
+// The sequencing of each L2 block is timed by stage, under driver/sequencer/<stage>:
+//   - origin_selection: the selection of the L1 origin of the block
+//   - payload_build: the building of the payload by the engine, including the payload build time
+//   - payload_import: the execution of the payload by the engine, and the forkchoice update that makes it the head
+//   - batch_encode: the encoding of the batch of the block
+//   - total: the whole sequencing of the block
+//
+// The blocks that are produced after their slot ended are counted as missed slots, and the attempts to produce a
+// block that did not produce one are counted by reason under driver/sequencer/skipped/<reason>.
+
+func sequencerTimer(stage string) metrics.Timer {
+	return metrics.GetOrRegisterTimer("driver/sequencer/"+stage, nil)
+}
+
+func sequencerMissedSlots() metrics.Counter {
+	return metrics.GetOrRegisterCounter("driver/sequencer/missed_slots", nil)
+}
+
+func skippedBlocks(reason string) metrics.Counter {
+	return metrics.GetOrRegisterCounter("driver/sequencer/skipped/"+reason, nil)
+}
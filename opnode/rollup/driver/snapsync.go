@@ -0,0 +1,59 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+)
+
+// needsSnapSync returns true if the engine is so far behind the checkpoint that it should sync
+// to it by itself, instead of requiring the checkpoint block to be present.
+func (s *state) needsSnapSync(cp *Checkpoint, l2Head eth.L2BlockRef) bool {
+	return s.snapSyncThreshold > 0 && cp.L2.Number > l2Head.Number+s.snapSyncThreshold
+}
+
+// startSnapSync points the forkchoice of the engine to the checkpoint, to have the engine sync up to it.
+// It returns false if the engine already has the checkpoint block and no sync is needed.
+func (s *state) startSnapSync(ctx context.Context, cp *Checkpoint) (syncing bool, err error) {
+	fc := l2.ForkchoiceState{
+		HeadBlockHash: cp.L2.Hash,
+		SafeBlockHash: cp.L2.Hash,
+	}
+	_, err = s.l2.ForkchoiceUpdate(ctx, &fc, nil)
+	if errors.Is(err, l2.ErrEngineSyncing) {
+		s.log.Info("Engine is syncing to checkpoint", "checkpoint", cp.L2)
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to start engine sync to checkpoint %s: %w", cp.L2, err)
+	}
+	return false, nil
+}
+
+// checkSnapSync checks if the engine finished syncing to the snap-sync target.
+// Once it did, the checkpoint becomes the unsafe and safe head, and derivation continues from there.
+func (s *state) checkSnapSync(ctx context.Context) (done bool, err error) {
+	cp := s.snapSyncTarget
+	if _, err := s.l2.L2BlockRefByHash(ctx, cp.L2.Hash); err != nil {
+		s.log.Debug("Engine is still syncing to checkpoint", "checkpoint", cp.L2, "err", err)
+		return false, nil
+	}
+	// The pre-sync head is behind the checkpoint, so the checkpoint is verified and made canonical.
+	ref, _, err := s.checkpointHeads(ctx, cp, s.l2Head)
+	if err != nil {
+		return false, err
+	}
+	prevUnsafe, prevSafe := s.l2Head, s.l2SafeHead
+	s.l2Head = ref
+	s.l2SafeHead = ref
+	s.l1Traversal = derive.L1Traversal{}
+	s.snapSyncTarget = nil
+	s.indexSafeHead()
+	s.emitHeadChanges(prevUnsafe, prevSafe, s.l2Finalized, 0)
+	s.log.Info("Engine finished syncing to checkpoint, resuming derivation", "l2Head", s.l2Head)
+	return true, nil
+}
@@ -0,0 +1,79 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncingL2Chain is an engine that starts syncing when the forkchoice points to a block it does not have.
+type syncingL2Chain struct {
+	stubL2Chain
+}
+
+func (m *syncingL2Chain) ForkchoiceUpdate(ctx context.Context, state *l2.ForkchoiceState, attr *l2.PayloadAttributes) (*l2.ForkchoiceUpdatedResult, error) {
+	m.fc = state
+	if _, err := m.L2BlockRefByHash(ctx, state.HeadBlockHash); err != nil {
+		return nil, l2.ErrEngineSyncing
+	}
+	return &l2.ForkchoiceUpdatedResult{Status: l2.UpdateSuccess}, nil
+}
+
+func TestSnapSync(t *testing.T) {
+	a, b := fakeL1Block('a', 0, 0), fakeL1Block('b', 'a', 1)
+	l1 := &stubL1Chain{blocks: []eth.L1BlockRef{a, b}, err: ethereum.NotFound}
+	A := fakeL2Block('A', 0, a.ID(), 0)
+	B := fakeL2Block('B', 'A', b.ID(), 1)
+	C := fakeL2Block('C', 'B', b.ID(), 2)
+	cp := &Checkpoint{L2: C.ID(), L1Origin: b.ID()}
+
+	newState := func(l2 L2Chain, threshold uint64) *state {
+		cfg := &Config{Checkpoint: cp, SnapSyncThreshold: threshold}
+		return NewState(cfg, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{}, l1, l2, nil, nil)
+	}
+
+	t.Run("threshold", func(t *testing.T) {
+		assert.False(t, newState(nil, 0).needsSnapSync(cp, A), "disabled")
+		assert.True(t, newState(nil, 1).needsSnapSync(cp, A))
+		assert.False(t, newState(nil, 2).needsSnapSync(cp, A), "gap is not larger than threshold")
+		assert.False(t, newState(nil, 1).needsSnapSync(cp, C))
+	})
+	t.Run("sync to checkpoint", func(t *testing.T) {
+		engine := &syncingL2Chain{stubL2Chain{blocks: []eth.L2BlockRef{A}}}
+		s := newState(engine, 1)
+		syncing, err := s.startSnapSync(context.Background(), cp)
+		require.NoError(t, err)
+		require.True(t, syncing)
+		assert.Equal(t, C.Hash, engine.fc.HeadBlockHash, "engine is pointed to the checkpoint")
+		s.snapSyncTarget = cp
+		s.l2Head, s.l2SafeHead = A, A
+
+		done, err := s.checkSnapSync(context.Background())
+		require.NoError(t, err)
+		assert.False(t, done, "engine is still syncing")
+		assert.Equal(t, A, s.l2Head)
+
+		// the engine synced up to the checkpoint
+		engine.extra = []eth.L2BlockRef{B, C}
+		done, err = s.checkSnapSync(context.Background())
+		require.NoError(t, err)
+		assert.True(t, done)
+		assert.Nil(t, s.snapSyncTarget, "derivation resumes")
+		assert.Equal(t, C, s.l2Head)
+		assert.Equal(t, C, s.l2SafeHead)
+	})
+	t.Run("engine has checkpoint", func(t *testing.T) {
+		engine := &syncingL2Chain{stubL2Chain{blocks: []eth.L2BlockRef{A}, extra: []eth.L2BlockRef{B, C}}}
+		syncing, err := newState(engine, 1).startSnapSync(context.Background(), cp)
+		require.NoError(t, err)
+		assert.False(t, syncing)
+	})
+}
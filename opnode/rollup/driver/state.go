@@ -2,62 +2,235 @@ package driver
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
+	gosync "sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
 
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/sync"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/tracing"
 	"github.com/ethereum/go-ethereum/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrSequencerNotEnabled     = errors.New("sequencer is not enabled")
+	ErrSequencerAlreadyStarted = errors.New("sequencer already running")
+	ErrSequencerAlreadyStopped = errors.New("sequencer not running")
+	ErrDriverClosed            = errors.New("driver is closed")
+	ErrGenesisMismatch         = errors.New("L2 genesis of the engine does not match the rollup config")
+	ErrPayloadSourceBanned     = errors.New("source of unsafe payloads is banned for sending invalid payloads")
 )
 
 type state struct {
 	// Chain State
-	l1Head      eth.L1BlockRef // Latest recorded head of the L1 Chain
-	l2Head      eth.L2BlockRef // L2 Unsafe Head
-	l2SafeHead  eth.L2BlockRef // L2 Safe Head - this is the head of the L2 chain as derived from L1 (thus it is Sequencer window blocks behind)
-	l2Finalized eth.BlockID    // L2 Block that will never be reversed
-	l1WindowBuf []eth.BlockID  // l1WindowBuf buffers the next L1 block IDs to derive new L2 blocks from, with increasing block height.
+	l1Head      eth.L1BlockRef     // Latest recorded head of the L1 Chain
+	l2Head      eth.L2BlockRef     // L2 Unsafe Head
+	l2SafeHead  eth.L2BlockRef     // L2 Safe Head - this is the head of the L2 chain as derived from L1 (thus it is Sequencer window blocks behind)
+	l2Finalized eth.BlockID        // L2 Block that will never be reversed
+	l1Traversal derive.L1Traversal // l1Traversal buffers the next L1 block IDs to derive new L2 blocks from, with increasing block height.
+	l1Finalized eth.L1BlockRef     // Latest finalized block of the L1 Chain, zero if unknown
+	// finalityData are the safe L2 heads of the derived epochs that are not finalized yet, oldest first
+	finalityData []finalityData
 
 	// Rollup config
-	Config    rollup.Config
-	sequencer bool
+	Config     rollup.Config
+	checkpoint *Checkpoint // optional trusted L2 block to start from
+	sequencer  bool
+
+	// sequencerActive is true when the sequencer is producing blocks. Only accessed by the loop.
+	sequencerActive bool
+	// requests to start/stop/query the sequencer, handled by the loop
+	startSequencer     chan hashAndErrorChannel
+	stopSequencer      chan chan hashAndError
+	sequencerActiveReq chan chan bool
+
+	// unsafePayloads receives the unsafe payloads from external sources, e.g. the sequencer, handled by the loop
+	unsafePayloads chan *UnsafePayload
+	// payloadQueue holds the unsafe payloads that do not extend the unsafe head yet. Only accessed by the loop.
+	payloadQueue *payloadQueue
+	// payloadSources tracks the sources of invalid unsafe payloads
+	payloadSources *payloadSources
+	// network fetches the unsafe payloads missing before the queued payloads from the peers. May be nil.
+	network Network
+	// lastRangeRequest is the end of the last range of payloads requested from the network, and when it was requested.
+	// Only accessed by the loop.
+	lastRangeRequest     eth.BlockID
+	lastRangeRequestTime time.Time
+
+	// engineSyncing is true while the engine is syncing by itself, and does not accept new blocks. Only accessed by the loop.
+	engineSyncing bool
+	// requests for the sync status, handled by the loop
+	syncStatusReq chan chan *SyncStatus
+	// requests to rewind the L2 chain to a block, handled by the loop
+	resetChain chan hashAndErrorChannel
+
+	// derivationPaused is true while the safe head is not advanced, see PauseDerivation. Only accessed by the loop.
+	derivationPaused bool
+	// requests to pause/resume the derivation, handled by the loop
+	pauseDerivation  chan chan error
+	resumeDerivation chan chan error
 
 	// Connections (in/out)
 	l1Heads <-chan eth.L1BlockRef
 	l1      L1Chain
 	l2      L2Chain
 	output  outputInterface
-	bss     BatchSubmitter
+	// originSelector determines the L1 origin of new L2 blocks when sequencing
+	originSelector OriginSelector
+	bss            BatchSubmitter
+	// l1Tracker tracks the recent canonical L1 blocks from the L1 heads, to classify L1 head changes. Only accessed by the loop.
+	l1Tracker *eth.HeadTracker
+
+	// Sequenced batches that are queued to be submitted together. Only accessed by the loop.
+	batchSubmitInterval    time.Duration
+	maxBatchSubmissionSize uint64
+	pendingBatches         []*derive.BatchData
+	pendingBatchesSize     uint64
+
+	// Bounds of the unsafe head ahead of the safe head, beyond which block production is paused.
+	maxUnsafeLagBlocks uint64
+	maxUnsafeLagTime   time.Duration
+	// lagThrottled is true while block production is paused because of the lag. Only accessed by the loop.
+	lagThrottled bool
+
+	// snapSyncTarget is the checkpoint that the engine is syncing to by itself, or nil if not syncing.
+	// Derivation and sequencing are paused while the engine syncs. Only accessed by the loop after Start.
+	snapSyncTarget       *Checkpoint
+	snapSyncThreshold    uint64
+	snapSyncPollInterval time.Duration
+
+	// maxReorgDepth bounds the L2 walk-back when finding the L2 heads
+	maxReorgDepth uint64
+	// index maps L1 origins to the safe L2 blocks derived from them, to speed up finding the L2 heads. May be nil.
+	index *index.DB
+	// wal logs the derivation progress, to resume derivation after a restart. May be nil.
+	wal *WAL
+
+	// clockSkew is the time after its timestamp that a new L2 block is produced
+	clockSkew time.Duration
+
+	// progress tracks the derivation throughput, to report the sync progress of the safe head
+	progress         *sync.ProgressTracker
+	progressInterval time.Duration
+	// stalled is true while the safe head is not making progress, to emit the stall only once. Only accessed by the loop.
+	stalled bool
+
+	// Deadlines of operations in the loop
+	l1HeadTimeout   time.Duration
+	newBlockTimeout time.Duration
+	l1RangeTimeout  time.Duration
+	stepTimeout     time.Duration
+
+	// headsFeed sends a HeadEvent whenever one of the L2 heads changes
+	headsFeed headFeed
+	// reorgs are the last reorgs of the L2 heads
+	reorgs *reorgHistory
+	// events receives the significant events of the driver, for alerting. May be nil.
+	events *events.Bus
 
-	log  log.Logger
-	done chan struct{}
+	log         log.Logger
+	snapshotLog log.Logger
+	done        chan struct{}
+
+	// ctx is the parent context of all operations in the loop, it is cancelled on Close
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks the loop and the batch submissions in progress, which Close waits for
+	wg gosync.WaitGroup
 
 	closed uint32 // non-zero when closed
 }
 
-func NewState(log log.Logger, config rollup.Config, l1 L1Chain, l2 L2Chain, output outputInterface, submitter BatchSubmitter, sequencer bool) *state {
+type hashAndError struct {
+	hash common.Hash
+	err  error
+}
+
+type hashAndErrorChannel struct {
+	hash common.Hash
+	err  chan error
+}
+
+// l1TrackedBlocks is the number of recent canonical L1 blocks that are tracked to classify L1 head changes
+const l1TrackedBlocks = 64
+
+func NewState(driverCfg *Config, log log.Logger, snapshotLog log.Logger, config rollup.Config, l1 L1Chain, l2Chain L2Chain, output outputInterface, submitter BatchSubmitter) *state {
+	ctx, cancel := context.WithCancel(context.Background())
+	progressInterval := durationOrDefault(driverCfg.SyncProgressInterval, defaultSyncProgressInterval)
+	originSelector := driverCfg.OriginSelector
+	if originSelector == nil {
+		originSelector = NewL1OriginSelector(log, &config, l1)
+	}
 	return &state{
-		Config:    config,
-		done:      make(chan struct{}),
-		log:       log,
-		l1:        l1,
-		l2:        l2,
-		output:    output,
-		bss:       submitter,
-		sequencer: sequencer,
+		ctx:                ctx,
+		cancel:             cancel,
+		Config:             config,
+		checkpoint:         driverCfg.Checkpoint,
+		done:               make(chan struct{}),
+		log:                log,
+		snapshotLog:        snapshotLog,
+		l1:                 l1,
+		l2:                 l2Chain,
+		output:             output,
+		originSelector:     originSelector,
+		l1Tracker:          eth.NewHeadTracker(l1, l1TrackedBlocks),
+		bss:                submitter,
+		sequencer:          driverCfg.SequencerEnabled,
+		sequencerActive:    driverCfg.SequencerEnabled && !driverCfg.SequencerStopped,
+		startSequencer:     make(chan hashAndErrorChannel, 10),
+		stopSequencer:      make(chan chan hashAndError, 10),
+		sequencerActiveReq: make(chan chan bool, 10),
+		unsafePayloads:     make(chan *UnsafePayload, 10),
+		payloadQueue:       newPayloadQueue(driverCfg.MaxQueuedPayloads),
+		payloadSources:     newPayloadSources(),
+		syncStatusReq:      make(chan chan *SyncStatus, 10),
+		resetChain:         make(chan hashAndErrorChannel, 10),
+		pauseDerivation:    make(chan chan error, 10),
+		resumeDerivation:   make(chan chan error, 10),
+
+		batchSubmitInterval:    driverCfg.BatchSubmitInterval,
+		maxBatchSubmissionSize: driverCfg.MaxBatchSubmissionSize,
+		maxUnsafeLagBlocks:     driverCfg.MaxUnsafeLagBlocks,
+		maxUnsafeLagTime:       driverCfg.MaxUnsafeLagTime,
+
+		maxReorgDepth:        driverCfg.MaxReorgDepth,
+		reorgs:               newReorgHistory(driverCfg.ReorgHistorySize),
+		snapSyncThreshold:    driverCfg.SnapSyncThreshold,
+		snapSyncPollInterval: durationOrDefault(driverCfg.SnapSyncPollInterval, defaultSnapSyncPollInterval),
+
+		progressInterval: progressInterval,
+		// estimate the throughput over the last few progress reports
+		progress: sync.NewProgressTracker(config.SeqWindowSize, 4*progressInterval),
+
+		clockSkew:       durationOrDefault(driverCfg.SequencerClockSkew, defaultSequencerClockSkew),
+		l1HeadTimeout:   durationOrDefault(driverCfg.L1HeadTimeout, defaultTimeout),
+		newBlockTimeout: durationOrDefault(driverCfg.NewBlockTimeout, defaultTimeout),
+		l1RangeTimeout:  durationOrDefault(driverCfg.L1RangeTimeout, defaultTimeout),
+		stepTimeout:     durationOrDefault(driverCfg.StepTimeout, defaultTimeout),
 	}
 }
 
 // Start starts up the state loop. The context is only for initilization.
 // The loop will have been started iff err is not nil.
 func (s *state) Start(ctx context.Context, l1Heads <-chan eth.L1BlockRef) error {
+	if err := s.verifyGenesis(ctx); err != nil {
+		return err
+	}
 	l1Head, err := s.l1.L1HeadBlockRef(ctx)
 	if err != nil {
 		return err
@@ -69,15 +242,53 @@ func (s *state) Start(ctx context.Context, l1Heads <-chan eth.L1BlockRef) error
 		if err != nil {
 			return err
 		}
-		// Ensure that we are on the correct chain. Note that we cannot rely on rely on the UnsafeHead being more than
-		// a sequence window behind the L1 Head and must walk back 1 sequence window as we do not track the end L1 block
-		// hash of the sequence window when we derive an L2 block.
-		unsafeHead, safeHead, err := sync.FindL2Heads(ctx, l2Head, s.Config.SeqWindowSize, s.l1, s.l2, &s.Config.Genesis)
-		if err != nil {
-			return err
+		var fromCheckpoint bool
+		if s.checkpoint != nil && s.needsSnapSync(s.checkpoint, l2Head) {
+			syncing, err := s.startSnapSync(ctx, s.checkpoint)
+			if err != nil {
+				return err
+			}
+			if syncing {
+				// Keep the current engine head until the engine has synced to the checkpoint
+				s.snapSyncTarget = s.checkpoint
+				s.l2Head = l2Head
+				s.l2SafeHead = l2Head
+				fromCheckpoint = true
+			}
+		}
+		if s.checkpoint != nil && s.snapSyncTarget == nil {
+			var ref eth.L2BlockRef
+			ref, fromCheckpoint, err = s.checkpointHeads(ctx, s.checkpoint, l2Head)
+			if err != nil {
+				return err
+			}
+			s.l2Head = ref
+			s.l2SafeHead = ref
+		}
+		if !fromCheckpoint {
+			// Ensure that we are on the correct chain. Note that we cannot rely on rely on the UnsafeHead being more than
+			// a sequence window behind the L1 Head and must walk back 1 sequence window as we do not track the end L1 block
+			// hash of the sequence window when we derive an L2 block.
+			unsafeHead, safeHead, err := s.findL2Heads(ctx, l2Head)
+			if err != nil {
+				return err
+			}
+			s.l2Head = unsafeHead
+			s.l2SafeHead = safeHead
+			if err := s.resumeFromWAL(ctx, unsafeHead); err != nil {
+				return err
+			}
+			if checker, ok := s.output.(unsafeChainChecker); ok {
+				head, err := checker.checkUnsafeChain(ctx, s.l2SafeHead, s.l2Head)
+				if err != nil {
+					return err
+				}
+				if head != s.l2Head {
+					s.log.Warn("Dropping invalid unsafe L2 blocks", "unsafeHead", s.l2Head, "lastValid", head)
+					s.l2Head = head
+				}
+			}
 		}
-		s.l2Head = unsafeHead
-		s.l2SafeHead = safeHead
 
 	} else {
 		// Not yet reached genesis block
@@ -94,44 +305,203 @@ func (s *state) Start(ctx context.Context, l1Heads <-chan eth.L1BlockRef) error
 	}
 
 	s.l1Head = l1Head
+	s.l1Tracker.Reset(l1Head)
 	s.l1Heads = l1Heads
+	if s.snapSyncTarget == nil {
+		s.indexSafeHead()
+	}
 
+	s.snapshot("Start")
+	s.wg.Add(1)
 	go s.loop()
 	return nil
 }
 
+// verifyGenesis checks that the engine has the L2 genesis block of the rollup config,
+// to catch an engine that is paired with the wrong rollup config or datadir.
+func (s *state) verifyGenesis(ctx context.Context) error {
+	genesis := s.Config.Genesis.L2
+	ref, err := s.l2.L2BlockRefByNumber(ctx, new(big.Int).SetUint64(genesis.Number))
+	if err != nil {
+		return fmt.Errorf("failed to fetch L2 genesis block %d from the engine: %w", genesis.Number, err)
+	}
+	if ref.Hash != genesis.Hash {
+		return fmt.Errorf("%w: engine has block %s at the genesis height, expected %s", ErrGenesisMismatch, ref.Hash, genesis.Hash)
+	}
+	return nil
+}
+
+// Close stops the loop, submits the batches that still wait for the submission interval,
+// and waits for the batch submissions in progress.
 func (s *state) Close() error {
+	// Abort any operation in progress, so the loop can exit
+	s.cancel()
 	close(s.done)
+	s.wg.Wait()
 	return nil
 }
 
+// StartSequencer activates block production, continuing from the given unsafe head.
+// The block hash must match the current unsafe head, to avoid forking the chain when handing over from another sequencer.
+func (s *state) StartSequencer(ctx context.Context, blockHash common.Hash) error {
+	if !s.sequencer {
+		return ErrSequencerNotEnabled
+	}
+	h := hashAndErrorChannel{
+		hash: blockHash,
+		err:  make(chan error, 1),
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		return ErrDriverClosed
+	case s.startSequencer <- h:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-h.err:
+		return err
+	}
+}
+
+// StopSequencer halts block production, and returns the hash of the unsafe head it stopped at.
+func (s *state) StopSequencer(ctx context.Context) (common.Hash, error) {
+	if !s.sequencer {
+		return common.Hash{}, ErrSequencerNotEnabled
+	}
+	respCh := make(chan hashAndError, 1)
+	select {
+	case <-ctx.Done():
+		return common.Hash{}, ctx.Err()
+	case <-s.done:
+		return common.Hash{}, ErrDriverClosed
+	case s.stopSequencer <- respCh:
+	}
+	select {
+	case <-ctx.Done():
+		return common.Hash{}, ctx.Err()
+	case he := <-respCh:
+		return he.hash, he.err
+	}
+}
+
+// SequencerActive returns true if the sequencer is currently producing blocks.
+func (s *state) SequencerActive(ctx context.Context) (bool, error) {
+	if !s.sequencer {
+		return false, nil
+	}
+	respCh := make(chan bool, 1)
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-s.done:
+		return false, ErrDriverClosed
+	case s.sequencerActiveReq <- respCh:
+	}
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case active := <-respCh:
+		return active, nil
+	}
+}
+
+// OnUnsafeL2Payload queues an unsafe payload, to be inserted once it extends the unsafe head.
+// The checks that do not depend on the parent are run right away: the payload is rejected if its block hash does not
+// match its contents, or if it is not signed by the sequencer. The rest of the consensus checks are run
+// when the payload is inserted. It returns once the loop received the payload, not once it is inserted.
+func (s *state) OnUnsafeL2Payload(ctx context.Context, up *UnsafePayload) error {
+	if !up.Trusted && s.payloadSources.banned(up.Source) {
+		return fmt.Errorf("%w: %s", ErrPayloadSourceBanned, up.Source)
+	}
+	if err := s.checkUnsafePayload(up); err != nil {
+		s.log.Warn("Rejected invalid unsafe payload", "payload", up.Payload.ID(), "source", up.Source, "err", err)
+		s.penalizeSource(up)
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		return ErrDriverClosed
+	case s.unsafePayloads <- up:
+		return nil
+	}
+}
+
+// checkUnsafePayload checks the block hash of the payload, and the signature of the sequencer if the rollup has
+// a p2p sequencer address. Only trusted and linked payloads may be unsigned.
+func (s *state) checkUnsafePayload(up *UnsafePayload) error {
+	if err := up.Payload.CheckBlockHash(); err != nil {
+		return err
+	}
+	if s.Config.P2PSequencerAddress == (common.Address{}) {
+		return nil
+	}
+	if up.Signature == nil {
+		if up.Trusted || up.Linked {
+			return nil
+		}
+		return fmt.Errorf("%w: payload %s is not signed by the sequencer", l2.ErrPayloadInvalid, up.Payload.ID())
+	}
+	return l2.VerifyPayloadSignature(s.Config.L2ChainID, up.Payload, up.Signature, s.Config.P2PSequencerAddress)
+}
+
+// penalizeSource records an invalid payload of the source, which is banned if it keeps sending invalid payloads.
+// Trusted sources are not penalized.
+func (s *state) penalizeSource(up *UnsafePayload) {
+	if up.Trusted {
+		return
+	}
+	if s.payloadSources.penalize(up.Source) {
+		s.log.Warn("Banned source of invalid unsafe payloads", "source", up.Source, "duration", payloadSourceBanTime)
+	}
+}
+
 // l1WindowBufEnd returns the last block that should be used as `base` to L1ChainWindow.
 // This is either the last block of the window, or the L1 base block if the window is not populated.
 func (s *state) l1WindowBufEnd() eth.BlockID {
-	if len(s.l1WindowBuf) == 0 {
-		return s.l2Head.L1Origin
+	if end, ok := s.l1Traversal.End(); ok {
+		return end
 	}
-	return s.l1WindowBuf[len(s.l1WindowBuf)-1]
+	return s.l2Head.L1Origin
 }
 
-func (s *state) handleNewL1Block(ctx context.Context, newL1Head eth.L1BlockRef) error {
+func (s *state) handleNewL1Block(ctx context.Context, newL1Head eth.L1BlockRef) (err error) {
+	ctx, span := tracer.Start(ctx, "l1_head", trace.WithAttributes(l1Attributes(newL1Head)...))
+	defer func() { tracing.End(span, err) }()
 	if s.l1Head.Hash == newL1Head.Hash {
 		log.Trace("Received L1 head signal that is the same as the current head", "l1Head", newL1Head)
 		return nil
 	}
 
+	change, err := s.l1Tracker.Track(ctx, newL1Head)
+	if err != nil {
+		s.log.Warn("Failed to track the L1 head change, handling it as a re-org", "l1Head", newL1Head, "err", err)
+		s.l1Tracker.Reset(newL1Head)
+		change = eth.HeadChange{Head: newL1Head, Kind: eth.HeadReorged}
+	}
+
 	if s.l1Head.Hash == newL1Head.ParentHash {
 		s.log.Trace("Linear extension", "l1Head", newL1Head)
-		s.l1Head = newL1Head
-		if s.l1WindowBufEnd().Hash == newL1Head.ParentHash {
-			s.l1WindowBuf = append(s.l1WindowBuf, newL1Head.ID())
+		s.extendL1Head(newL1Head)
+		return nil
+	}
+	// A long L1 extension is a sequence of linear extensions, if the skipped blocks are known.
+	if change.Kind == eth.HeadExtended && change.Ancestor.Hash == s.l1Head.Hash {
+		s.log.Debug("Long linear extension", "l1Head", newL1Head, "blocks", len(change.New))
+		for _, ref := range change.New {
+			s.extendL1Head(ref)
 		}
 		return nil
 	}
-	// New L1 Head is not the same as the current head or a single step linear extension.
-	// This could either be a long L1 extension, or a reorg. Both can be handled the same way.
-	s.log.Warn("L1 Head signal indicates an L1 re-org", "old_l1_head", s.l1Head, "new_l1_head_parent", newL1Head.ParentHash, "new_l1_head", newL1Head)
-	unsafeL2Head, safeL2Head, err := sync.FindL2Heads(ctx, s.l2Head, s.Config.SeqWindowSize, s.l1, s.l2, &s.Config.Genesis)
+	// New L1 Head is not the same as the current head or a linear extension: this is a reorg,
+	// or a long L1 extension from a head that is not tracked. Both can be handled the same way.
+	s.log.Warn("L1 Head signal indicates an L1 re-org", "old_l1_head", s.l1Head, "new_l1_head_parent", newL1Head.ParentHash, "new_l1_head",
+		newL1Head, "change", change.Kind, "depth", change.Depth, "ancestor", change.Ancestor)
+	unsafeL2Head, safeL2Head, err := s.findL2Heads(ctx, s.l2Head)
 	if err != nil {
 		s.log.Error("Could not get new unsafe L2 head when trying to handle a re-org", "err", err)
 		return err
@@ -147,77 +517,130 @@ func (s *state) handleNewL1Block(ctx context.Context, newL1Head eth.L1BlockRef)
 		s.log.Error("Could not set new forkchoice when trying to handle a re-org", "err", err)
 		return err
 	}
+	// Reset the derivation stages back to the last buffered L1 block that is still canonical.
+	// The buffered blocks follow the L1 origin of the unsafe head, so they are all dropped if the origin changed.
+	l1Base := s.l1ReorgBase(ctx, change)
+	if unsafeL2Head.L1Origin != s.l2Head.L1Origin {
+		l1Base = unsafeL2Head.L1Origin
+	}
+	s.l1Traversal.Reset(l1Base)
+	s.output.reset(l1Base)
+	// Submitted batches may have been reorged out of L1, and are rebroadcast if so.
+	if s.sequencer {
+		s.bss.L1HeadChanged(newL1Head, true)
+	}
 	// State Update
+	prevUnsafe, prevSafe := s.l2Head, s.l2SafeHead
 	s.l1Head = newL1Head
-	s.l1WindowBuf = nil
 	s.l2Head = unsafeL2Head
 	// Don't advance l2SafeHead past it's current value
 	if s.l2SafeHead.Number >= safeL2Head.Number {
 		s.l2SafeHead = safeL2Head
+		s.indexSafeHead()
+		s.dropFinalityData()
 	}
+	// The new unsafe head is an ancestor of the previous unsafe head
+	s.emitHeadChanges(prevUnsafe, prevSafe, s.l2Finalized, prevUnsafe.Number-s.l2Head.Number)
 
 	return nil
 }
 
-// findNextL1Origin determines what the next L1 Origin should be.
-// The L1 Origin is either the L2 Head's Origin, or the following L1 block
-// if the next L2 block's time is greater than or equal to the L2 Head's Origin.
-// Also return the max timestamp (incl.) that we can build a L2 block at using the returned origin.
-func (s *state) findNextL1Origin(ctx context.Context) (eth.L1BlockRef, uint64, error) {
-	// If we are at the head block, don't do a lookup.
-	// Don't do a timestamp check either as we are unable to get the next block even if we wanted to.
-	if s.l2Head.L1Origin.Hash == s.l1Head.Hash {
-		return s.l1Head, s.l1Head.Time + s.Config.MaxSequencerDrift, nil
-	}
-
-	// Grab the block ref
-	currentOrigin, err := s.l1.L1BlockRefByHash(ctx, s.l2Head.L1Origin.Hash)
-	if err != nil {
-		return eth.L1BlockRef{}, 0, err
+// extendL1Head handles the new L1 head that is a child of the current L1 head.
+func (s *state) extendL1Head(newL1Head eth.L1BlockRef) {
+	s.l1Head = newL1Head
+	if s.l1WindowBufEnd().Hash == newL1Head.ParentHash {
+		s.l1Traversal.Extend(newL1Head.ID())
 	}
-
-	nextOrigin, err := s.l1.L1BlockRefByNumber(ctx, currentOrigin.Number+1)
-	if errors.Is(err, ethereum.NotFound) {
-		// no new L1 origin found, keep the current one
-		s.log.Info("No new L1 origin, staying with current one", "l2Head", s.l2Head, "l1Origin", currentOrigin)
-		return currentOrigin, currentOrigin.Time + s.Config.MaxSequencerDrift, nil
+	if s.sequencer {
+		s.bss.L1HeadChanged(newL1Head, false)
 	}
+}
 
-	nextL2Time := s.l2Head.Time + s.Config.BlockTime
+// l1ReorgBaseTimeout bounds the time to check the buffered L1 blocks against L1, after which they are all dropped
+const l1ReorgBaseTimeout = 10 * time.Second
 
-	// If we can, start building on the next L1 origin
-	if nextL2Time >= nextOrigin.Time { // TODO: this is where we can add confirmation distance, instead of eagerly building on the very latest L1 block
-		s.log.Info("Advancing L1 Origin", "l2Head", s.l2Head, "previous_l1Origin", s.l2Head.L1Origin, "l1Origin", nextOrigin)
-		return nextOrigin, nextOrigin.Time + s.Config.MaxSequencerDrift, nil
-	}
-
-	// If there is no more slack left (including the sequencer drift), then we will have to start building on the next L1 origin
-	maxL2Time := currentOrigin.Time + s.Config.MaxSequencerDrift
-	if nextL2Time >= maxL2Time { // the maxL2Time is an excl. bound on the current epoch.
-		// If we are not matching the L1 origin (due to a large gap between L1 blocks), then we stay with the current origin.
-		// This matches the `next_l1_timestamp - l2_block_time` part of the `new_head_l2_timestamp`, the batches will still be valid.
-		if nextL2Time < nextOrigin.Time {
-			s.log.Warn("Ran out of slack with current epoch, but the next L1 block is still ahead in time, thus we continue the epoch",
-				"l2Head", s.l2Head, "previous_l1Origin", s.l2Head.L1Origin, "l1Origin", nextOrigin)
-			return currentOrigin, nextOrigin.Time, nil
+// l1ReorgBase returns the last buffered L1 block that is still canonical after the head change, or the zero block ID if there is none.
+// If the tracker found the fork point of the reorg, that is the last buffered block up to the fork point:
+// the buffered blocks are a chain of the previous L1 head, so they are canonical up to the fork point.
+// Otherwise the tracked L1 blocks are canonical, and the blocks that are not tracked are checked against L1, within l1ReorgBaseTimeout.
+func (s *state) l1ReorgBase(ctx context.Context, change eth.HeadChange) eth.BlockID {
+	blocks := s.l1Traversal.Blocks()
+	if fork := change.Ancestor; fork != (eth.L1BlockRef{}) {
+		for i := len(blocks) - 1; i >= 0; i-- {
+			if blocks[i].Number <= fork.Number {
+				return blocks[i]
+			}
 		}
-		// The L1 chain continues, and eventually the sequencer will be forced onto the chain with deposits from L1
-		s.log.Warn("Forced to advance to new L1 Origin", "l2Head", s.l2Head, "previous_l1Origin", s.l2Head.L1Origin, "l1Origin", nextOrigin)
-		return nextOrigin, nextOrigin.Time + s.Config.MaxSequencerDrift, nil
+		return eth.BlockID{}
 	}
+	ctx, cancel := context.WithTimeout(ctx, l1ReorgBaseTimeout)
+	defer cancel()
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if ref, ok := s.l1Tracker.Canonical(blocks[i].Number); ok {
+			if ref.Hash == blocks[i].Hash {
+				return blocks[i]
+			}
+			continue
+		}
+		ref, err := s.l1.L1BlockRefByNumber(ctx, blocks[i].Number)
+		if errors.Is(err, ethereum.NotFound) {
+			continue // the new L1 chain is shorter
+		} else if err != nil {
+			s.log.Warn("Failed to fetch L1 block to find the reorg base, dropping the buffered L1 window", "number", blocks[i].Number, "err", err)
+			return eth.BlockID{}
+		}
+		if ref.Hash == blocks[i].Hash {
+			return blocks[i]
+		}
+	}
+	return eth.BlockID{}
+}
 
-	// If we have a next
-	s.log.Info("Next L1 Origin is the same as the previous", "l2Head", s.l2Head, "l1Origin", currentOrigin)
-	return currentOrigin, currentOrigin.Time + s.Config.MaxSequencerDrift, nil
+// coalesceL1Heads drains the L1 heads that are already queued up behind the given head.
+// It returns the queued heads in order, without repeated heads, ending with the most recent head.
+// If the heads are not a linear chain of blocks, the L1 chain reorganized while they were queued,
+// and reorg is true: only the last head is relevant then.
+func (s *state) coalesceL1Heads(first eth.L1BlockRef) (heads []eth.L1BlockRef, reorg bool) {
+	heads = append(heads, first)
+	// Only drain what is queued right now, to not starve the other events of the loop.
+	for i := len(s.l1Heads); i > 0; i-- {
+		var next eth.L1BlockRef
+		select {
+		case next = <-s.l1Heads:
+		default:
+			return heads, reorg
+		}
+		last := heads[len(heads)-1]
+		if next.Hash == last.Hash {
+			continue
+		}
+		if next.ParentHash != last.Hash {
+			reorg = true
+		}
+		heads = append(heads, next)
+	}
+	if len(heads) > 1 {
+		s.log.Debug("Coalesced queued L1 heads", "count", len(heads), "latest", heads[len(heads)-1], "reorg", reorg)
+	}
+	return heads, reorg
 }
 
 // createNewL2Block builds a L2 block on top of the L2 Head (unsafe)
-func (s *state) createNewL2Block(ctx context.Context) (eth.L1BlockRef, error) {
-	nextOrigin, maxL2Time, err := s.findNextL1Origin(context.Background())
+func (s *state) createNewL2Block(ctx context.Context) (_ eth.L1BlockRef, err error) {
+	ctx, span := tracer.Start(ctx, "sequence_block", trace.WithAttributes(l2Attributes(s.l2Head)...))
+	defer func() { tracing.End(span, err) }()
+	start := time.Now()
+	if s.throttledByLag() {
+		skippedBlocks("lag").Inc(1)
+		return eth.L1BlockRef{}, nil
+	}
+	nextOrigin, maxL2Time, err := s.originSelector.FindL1Origin(ctx, s.l1Head, s.l2Head)
 	if err != nil {
+		skippedBlocks("failed").Inc(1)
 		s.log.Error("Error finding next L1 Origin", "err", err)
 		return eth.L1BlockRef{}, err
 	}
+	sequencerTimer("origin_selection").UpdateSince(start)
 	nextL2Time := s.l2Head.Time + s.Config.BlockTime
 	// If we are behind the L1 origin that we should be using then we broke the invariant
 	if nextL2Time < nextOrigin.Time {
@@ -232,6 +655,7 @@ func (s *state) createNewL2Block(ctx context.Context) (eth.L1BlockRef, error) {
 
 	// We create at least 1 block per epoch. After that we have to enforce the max timestamp.
 	if !isFirstEpochBlock && nextL2Time >= maxL2Time {
+		skippedBlocks("no_slack").Inc(1)
 		s.log.Warn("Skipping block production because we have no slack left to sequence more blocks on the L1 origin",
 			"l2Head", s.l2Head, "nextL2Time", nextL2Time, "l1Origin", nextOrigin, "l1OriginTime", nextOrigin.Time)
 		return eth.L1BlockRef{}, nil
@@ -242,76 +666,274 @@ func (s *state) createNewL2Block(ctx context.Context) (eth.L1BlockRef, error) {
 		return eth.L1BlockRef{}, nil
 	}
 	// Actually create the new block
-	newUnsafeL2Head, batch, err := s.output.createNewBlock(context.Background(), s.l2Head, s.l2SafeHead.ID(), s.l2Finalized, nextOrigin)
+	newUnsafeL2Head, batch, err := s.output.createNewBlock(ctx, s.l2Head, s.l2SafeHead.ID(), s.l2Finalized, nextOrigin)
 	if err != nil {
+		skippedBlocks("failed").Inc(1)
 		s.log.Error("Could not extend chain as sequencer", "err", err, "l2UnsafeHead", s.l2Head, "l1Origin", nextOrigin)
 		return eth.L1BlockRef{}, err
 	}
 	// State update
+	prevUnsafe := s.l2Head
 	s.l2Head = newUnsafeL2Head
+	s.emitHeadChanges(prevUnsafe, s.l2SafeHead, s.l2Finalized, 0)
 	s.log.Info("Sequenced new l2 block", "l2Head", s.l2Head, "l1Origin", s.l2Head.L1Origin, "txs", len(batch.Transactions), "time", s.l2Head.Time)
-	//Submit batch
+	s.queueBatch(batch)
+	s.recordBlockTiming(start, newUnsafeL2Head)
+	return nextOrigin, nil
+}
+
+// recordBlockTiming records the total time that the sequencing of the new block took, and counts the block
+// as a missed slot if it was produced after its slot ended: later than a block time after its target time.
+func (s *state) recordBlockTiming(start time.Time, block eth.L2BlockRef) {
+	now := time.Now()
+	sequencerTimer("total").Update(now.Sub(start))
+	slotEnd := time.Unix(int64(block.Time+s.Config.BlockTime), 0).Add(s.clockSkew)
+	if now.After(slotEnd) {
+		sequencerMissedSlots().Inc(1)
+	}
+}
+
+// throttledByLag returns true if the unsafe head is too far ahead of the safe head to produce more blocks:
+// the batches of the unsafe blocks did not land on L1, e.g. because the batch submission is failing,
+// and more unsafe blocks may never become safe. Block production resumes once the safe head catches up.
+func (s *state) throttledByLag() bool {
+	var lagBlocks uint64
+	var lagTime time.Duration
+	if s.l2Head.Number > s.l2SafeHead.Number {
+		lagBlocks = s.l2Head.Number - s.l2SafeHead.Number
+		lagTime = time.Duration(s.l2Head.Time-s.l2SafeHead.Time) * time.Second
+	}
+	throttled := (s.maxUnsafeLagBlocks != 0 && lagBlocks >= s.maxUnsafeLagBlocks) ||
+		(s.maxUnsafeLagTime != 0 && lagTime >= s.maxUnsafeLagTime)
+	if throttled && !s.lagThrottled {
+		s.log.Warn("Pausing block production, the safe head lags too far behind the unsafe head. Are batches being submitted?",
+			"l2Head", s.l2Head, "l2SafeHead", s.l2SafeHead, "lag_blocks", lagBlocks, "lag_time", lagTime,
+			"max_lag_blocks", s.maxUnsafeLagBlocks, "max_lag_time", s.maxUnsafeLagTime)
+	} else if !throttled && s.lagThrottled {
+		s.log.Info("Resuming block production, the safe head caught up", "l2Head", s.l2Head, "l2SafeHead", s.l2SafeHead)
+	}
+	s.lagThrottled = throttled
+	return throttled
+}
+
+// queueBatch adds the batch to the pending batches, and submits them if the size limit is reached,
+// or right away if batches are not aggregated.
+func (s *state) queueBatch(batch *derive.BatchData) {
+	start := time.Now()
+	data, err := batch.MarshalBinary()
+	if err != nil {
+		s.log.Error("Failed to encode batch", "err", err)
+		return
+	}
+	sequencerTimer("batch_encode").UpdateSince(start)
+	s.pendingBatches = append(s.pendingBatches, batch)
+	s.pendingBatchesSize += uint64(len(data))
+	if s.batchSubmitInterval == 0 || (s.maxBatchSubmissionSize != 0 && s.pendingBatchesSize >= s.maxBatchSubmissionSize) {
+		s.submitBatches()
+	}
+}
+
+// submitBatches submits all pending batches to L1 in a single submission.
+func (s *state) submitBatches() {
+	if len(s.pendingBatches) == 0 {
+		return
+	}
+	batches := s.pendingBatches
+	s.log.Debug("Submitting batches", "count", len(batches), "size", s.pendingBatchesSize)
+	s.pendingBatches = nil
+	s.pendingBatchesSize = 0
+	s.wg.Add(1)
 	go func() {
-		_, err := s.bss.Submit(&s.Config, []*derive.BatchData{batch}) // TODO: submit multiple batches
-		// Note: This can cause problems as the log can run after the batch submitter / driver is shut down.
-		// This is tracked in issue #308
+		defer s.wg.Done()
+		_, err := s.bss.Submit(&s.Config, batches)
 		if err != nil {
-			s.log.Error("Error submitting batch", "err", err)
+			s.log.Error("Error submitting batches", "count", len(batches), "err", err)
 		}
 	}()
-	return nextOrigin, nil
 }
 
 // handleEpoch attempts to insert a full L2 epoch on top of the L2 Safe Head.
 // It ensures that a full sequencing window is available and updates the state as needed.
-func (s *state) handleEpoch(ctx context.Context) (bool, error) {
+func (s *state) handleEpoch(ctx context.Context) (_ bool, err error) {
+	ctx, span := tracer.Start(ctx, "epoch", trace.WithAttributes(l2Attributes(s.l2SafeHead)...))
+	defer func() { tracing.End(span, err) }()
 	s.log.Trace("Handling epoch", "l2Head", s.l2Head, "l2SafeHead", s.l2SafeHead)
 	// Extend cached window if we do not have enough saved blocks
-	if len(s.l1WindowBuf) < int(s.Config.SeqWindowSize) {
+	if s.l1Traversal.Len() < int(s.Config.SeqWindowSize) {
 		// attempt to buffer up to 2x the size of a sequence window of L1 blocks, to speed up later handleEpoch calls
-		nexts, err := s.l1.L1Range(ctx, s.l1WindowBufEnd(), 2*s.Config.SeqWindowSize)
+		rangeCtx, rangeSpan := tracer.Start(ctx, "window_extension")
+		rangeCtx, cancel := context.WithTimeout(rangeCtx, s.l1RangeTimeout)
+		nexts, err := s.l1.L1Range(rangeCtx, s.l1WindowBufEnd(), 2*s.Config.SeqWindowSize)
+		cancel()
+		rangeSpan.SetAttributes(attribute.Int("blocks", len(nexts)))
+		tracing.End(rangeSpan, err)
 		if err != nil {
 			s.log.Error("Could not extend the cached L1 window", "err", err, "l2Head", s.l2Head, "l2SafeHead", s.l2SafeHead, "l1Head", s.l1Head, "window_end", s.l1WindowBufEnd())
 			return false, err
 		}
-		s.l1WindowBuf = append(s.l1WindowBuf, nexts...)
+		s.l1Traversal.Extend(nexts...)
 
 	}
 	// Ensure that there are enough blocks in the cached window
-	if len(s.l1WindowBuf) < int(s.Config.SeqWindowSize) {
-		s.log.Debug("Not enough cached blocks to run step", "cached_window_len", len(s.l1WindowBuf))
+	window, ok := s.l1Traversal.Window(s.Config.SeqWindowSize)
+	if !ok {
+		s.log.Debug("Not enough cached blocks to run step", "cached_window_len", s.l1Traversal.Len())
 		return false, nil
 	}
 
 	// Insert the epoch
-	window := s.l1WindowBuf[:s.Config.SeqWindowSize]
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, s.stepTimeout)
 	newL2Head, newL2SafeHead, reorg, err := s.output.insertEpoch(ctx, s.l2Head, s.l2SafeHead, s.l2Finalized, window)
 	cancel()
 	if err != nil {
 		s.log.Error("Error in running the output step.", "err", err, "l2Head", s.l2Head, "l2SafeHead", s.l2SafeHead)
 		return false, err
 	}
+	if newL2SafeHead.Number > s.l2SafeHead.Number {
+		recordEpochThroughput(newL2SafeHead.Number-s.l2SafeHead.Number, time.Since(start))
+	}
 
 	// State update
+	prevUnsafe, prevSafe := s.l2Head, s.l2SafeHead
 	s.l2Head = newL2Head
 	s.l2SafeHead = newL2SafeHead
-	s.l1WindowBuf = s.l1WindowBuf[1:]
+	s.l1Traversal.Advance()
+	s.progress.Update(time.Now(), s.l2SafeHead)
+	s.indexSafeHead()
+	s.recordFinalityData(window[len(window)-1])
+	if err := s.wal.endEpoch(s.l2SafeHead, window[len(window)-1], s.l1Traversal.Blocks()); err != nil {
+		s.log.Warn("Failed to log derivation progress", "err", err)
+	}
+	var reorgDepth uint64
+	if reorg {
+		// the blocks after the previous safe head have been replaced
+		reorgDepth = prevUnsafe.Number - prevSafe.Number
+	}
+	s.emitHeadChanges(prevUnsafe, prevSafe, s.l2Finalized, reorgDepth)
 	s.log.Info("Inserted a new epoch", "l2Head", s.l2Head, "l2SafeHead", s.l2SafeHead, "reorg", reorg)
-	// TODO: l2Finalized
 	return reorg, nil
 
 }
 
+// recordEpochThroughput records the number of L2 blocks per second that an epoch was derived and inserted at.
+func recordEpochThroughput(blocks uint64, elapsed time.Duration) {
+	if elapsed <= 0 {
+		return
+	}
+	perSecond := float64(blocks) / elapsed.Seconds()
+	metrics.GetOrRegisterHistogram("derive/blocks_per_second", nil, metrics.NewExpDecaySample(1028, 0.015)).Update(int64(perSecond))
+}
+
+// deferJSONString helps avoid a JSON-encoding performance hit if the snapshot logger does not run
+type deferJSONString struct {
+	x interface{}
+}
+
+func (v deferJSONString) String() string {
+	out, _ := json.Marshal(v.x)
+	return string(out)
+}
+
+// snapshot writes the full driver state to the snapshot logger, tagged with the event that triggered it.
+func (s *state) snapshot(event string) {
+	s.snapshotLog.Info("Rollup State Snapshot",
+		"event", event,
+		"l1Head", deferJSONString{s.l1Head},
+		"l2Head", deferJSONString{s.l2Head},
+		"l2SafeHead", deferJSONString{s.l2SafeHead},
+		"l2FinalizedHead", deferJSONString{s.l2Finalized},
+		"l1WindowBuf", deferJSONString{s.l1Traversal.Blocks()},
+		"sequencerActive", s.sequencerActive)
+}
+
+// logProgress logs how far the safe head is behind the L1 head, to tell a slow sync apart from a stuck one.
+func (s *state) logProgress() {
+	if s.snapSyncTarget != nil {
+		s.log.Info("Engine is syncing to checkpoint", "checkpoint", s.snapSyncTarget.L2, "l1Head", s.l1Head)
+		return
+	}
+	p := s.progress.Progress(time.Now(), s.l1Head, s.l2SafeHead)
+	if stalled := p.Stuck(); stalled != s.stalled {
+		s.stalled = stalled
+		if stalled {
+			s.events.Emit(events.DerivationStalled, p)
+		} else {
+			s.events.Emit(events.DerivationResumed, p)
+		}
+	}
+	if p.Synced() {
+		s.log.Debug("Safe head is synced", "l1Head", s.l1Head, "l2SafeHead", s.l2SafeHead)
+	} else if p.Stuck() {
+		s.log.Warn("Safe head is not making progress", "l1Head", s.l1Head, "l2SafeHead", s.l2SafeHead, "behind", p.BlocksBehind)
+	} else {
+		s.log.Info("Syncing safe head", "l1Head", s.l1Head, "l2SafeHead", s.l2SafeHead, "behind", p.BlocksBehind,
+			"l1_blocks_per_sec", p.Throughput, "eta", p.ETA.Round(time.Second))
+	}
+}
+
+// nextBlockDelay computes how long to wait until the next L2 block should be produced: the target time of
+// the next block is the timestamp of the L2 head plus the block time, plus the tolerated clock skew.
+// The time spent on producing blocks is compensated for, and after a stall the delay is 0 to catch up right away.
+// The delay is capped to the block time, to tolerate a wall-clock that is behind the L2 chain.
+func (s *state) nextBlockDelay(now time.Time) time.Duration {
+	blockTime := time.Duration(s.Config.BlockTime) * time.Second
+	target := time.Unix(int64(s.l2Head.Time+s.Config.BlockTime), 0).Add(s.clockSkew)
+	delay := target.Sub(now)
+	if delay < 0 {
+		return 0
+	}
+	if delay > blockTime {
+		return blockTime
+	}
+	return delay
+}
+
 // loop is the event loop that responds to L1 changes and internal timers to produce L2 blocks.
 func (s *state) loop() {
+	defer s.wg.Done()
 	s.log.Info("State loop started")
-	ctx := context.Background()
+	ctx := s.ctx
+	blockTime := time.Duration(s.Config.BlockTime) * time.Second
 	var l2BlockCreation <-chan time.Time
+	var l2BlockCreationTimer *time.Timer
 	if s.sequencer {
-		l2BlockCreationTicker := time.NewTicker(time.Duration(s.Config.BlockTime) * time.Second)
-		defer l2BlockCreationTicker.Stop()
-		l2BlockCreation = l2BlockCreationTicker.C
+		l2BlockCreationTimer = time.NewTimer(s.nextBlockDelay(time.Now()))
+		defer l2BlockCreationTimer.Stop()
+		l2BlockCreation = l2BlockCreationTimer.C
+	}
+	// scheduleBlockIn (re)sets the block creation timer to fire after the given delay
+	scheduleBlockIn := func(delay time.Duration) {
+		if l2BlockCreationTimer == nil {
+			return
+		}
+		if !l2BlockCreationTimer.Stop() {
+			select {
+			case <-l2BlockCreationTimer.C:
+			default:
+			}
+		}
+		l2BlockCreationTimer.Reset(delay)
+	}
+	progressTicker := time.NewTicker(s.progressInterval)
+	defer progressTicker.Stop()
+
+	var snapSyncPoll <-chan time.Time
+	if s.snapSyncTarget != nil {
+		snapSyncTicker := time.NewTicker(s.snapSyncPollInterval)
+		defer snapSyncTicker.Stop()
+		snapSyncPoll = snapSyncTicker.C
+	}
+
+	// the engine is polled while it is syncing by itself, to resume block insertion once it caught up
+	engineSyncTicker := time.NewTicker(s.snapSyncPollInterval)
+	defer engineSyncTicker.Stop()
+
+	var batchSubmission <-chan time.Time
+	if s.sequencer && s.batchSubmitInterval > 0 {
+		batchSubmissionTicker := time.NewTicker(s.batchSubmitInterval)
+		defer batchSubmissionTicker.Stop()
+		batchSubmission = batchSubmissionTicker.C
 	}
 
 	stepRequest := make(chan struct{}, 1)
@@ -333,50 +955,145 @@ func (s *state) loop() {
 		}
 	}
 
+	handleL1Heads := func(newL1Head eth.L1BlockRef) {
+		s.snapshot("New L1 Head")
+		if s.snapSyncTarget != nil {
+			// Nothing is derived while the engine syncs, only keep track of the L1 head
+			heads, _ := s.coalesceL1Heads(newL1Head)
+			s.l1Head = heads[len(heads)-1]
+			s.l1Tracker.Reset(s.l1Head)
+			return
+		}
+		heads, reorg := s.coalesceL1Heads(newL1Head)
+		if reorg {
+			// Intermediate heads are stale, only handle the latest L1 view.
+			heads = heads[len(heads)-1:]
+		}
+		for _, head := range heads {
+			ctx, cancel := context.WithTimeout(ctx, s.l1HeadTimeout)
+			err := s.handleNewL1Block(ctx, head)
+			cancel()
+			if err != nil {
+				s.checkEngineSyncing(err)
+				s.log.Error("Error in handling new L1 Head", "err", err)
+				break
+			}
+		}
+		finalizedCtx, cancel := context.WithTimeout(ctx, s.l1HeadTimeout)
+		s.updateFinalized(finalizedCtx)
+		cancel()
+		s.snapshot("After New L1 Head")
+		s.insertQueuedPayloads(ctx)
+		// Run step if we are able to
+		if s.l1Head.Number-s.l2SafeHead.L1Origin.Number >= s.Config.SeqWindowSize {
+			s.log.Trace("Requesting next step", "l1Head", s.l1Head, "l2Head", s.l2Head, "l1Origin", s.l2Head.L1Origin)
+			requestStep()
+		}
+	}
+
 	requestStep()
 
 	for {
 		select {
 		case <-s.done:
 			atomic.AddUint32(&s.closed, 1)
+			// Submit the batches that wait for the next submission interval, Close waits for them
+			s.submitBatches()
 			return
 		case <-l2BlockCreation:
+			if !s.sequencerActive || s.snapSyncTarget != nil || s.engineSyncing {
+				scheduleBlockIn(blockTime)
+				continue
+			}
 			s.log.Trace("L2 Creation Ticker")
 			createBlock()
+		case <-progressTicker.C:
+			s.logProgress()
+		case <-batchSubmission:
+			s.submitBatches()
+		case <-snapSyncPoll:
+			ctx, cancel := context.WithTimeout(ctx, s.l1HeadTimeout)
+			done, err := s.checkSnapSync(ctx)
+			cancel()
+			if err != nil {
+				s.log.Error("Error in checking engine sync to checkpoint", "err", err)
+			}
+			if done {
+				snapSyncPoll = nil
+				s.snapshot("Snap Sync Done")
+				requestStep()
+				if s.sequencerActive {
+					scheduleBlockIn(s.nextBlockDelay(time.Now()))
+				}
+			}
+		case <-engineSyncTicker.C:
+			if !s.engineSyncing {
+				continue
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, s.l1HeadTimeout)
+			synced, err := s.checkEngineSynced(checkCtx)
+			cancel()
+			if err != nil {
+				s.log.Error("Error in checking engine sync", "err", err)
+			}
+			if synced {
+				s.snapshot("Engine Synced")
+				// the inserts are bounded by their own timeouts
+				s.insertQueuedPayloads(ctx)
+				requestStep()
+				if s.sequencerActive {
+					scheduleBlockIn(s.nextBlockDelay(time.Now()))
+				}
+			}
 		case <-l2BlockCreationReq:
-			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if !s.sequencerActive || s.snapSyncTarget != nil || s.engineSyncing {
+				continue
+			}
+			// Chain consistency comes first: handle queued L1 heads (and possible reorgs)
+			// before building on what may be a stale L1 origin.
+			select {
+			case newL1Head := <-s.l1Heads:
+				handleL1Heads(newL1Head)
+			default:
+			}
+			s.snapshot("L2 Block Creation Request")
+			prevHead := s.l2Head
+			ctx, cancel := context.WithTimeout(ctx, s.newBlockTimeout)
 			nextOrigin, err := s.createNewL2Block(ctx)
 			cancel()
 			if err != nil {
+				s.checkEngineSyncing(err)
 				s.log.Error("Error creating new L2 block", "err", err)
 			}
+			s.snapshot("After L2 Block Creation")
+			if s.l2Head == prevHead {
+				// No block was produced, retry after a block time instead of spinning
+				scheduleBlockIn(blockTime)
+			} else {
+				scheduleBlockIn(s.nextBlockDelay(time.Now()))
+			}
 			if nextOrigin.Time > s.l2Head.Time+s.Config.BlockTime {
 				s.log.Trace("Asking for a second L2 block asap", "l2Head", s.l2Head)
 				createBlock()
 			}
 
 		case newL1Head := <-s.l1Heads:
-			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			err := s.handleNewL1Block(ctx, newL1Head)
-			cancel()
-			if err != nil {
-				s.log.Error("Error in handling new L1 Head", "err", err)
-			}
-			// Run step if we are able to
-			if s.l1Head.Number-s.l2SafeHead.L1Origin.Number >= s.Config.SeqWindowSize {
-				s.log.Trace("Requesting next step", "l1Head", s.l1Head, "l2Head", s.l2Head, "l1Origin", s.l2Head.L1Origin)
-				requestStep()
-			}
+			handleL1Heads(newL1Head)
 		case <-stepRequest:
-			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if s.snapSyncTarget != nil || s.engineSyncing || s.derivationPaused {
+				continue
+			}
+			s.snapshot("Step Request")
 			reorg, err := s.handleEpoch(ctx)
-			cancel()
 			if err != nil {
+				s.checkEngineSyncing(err)
 				s.log.Error("Error in handling epoch", "err", err)
 			}
+			s.snapshot("After Step Request")
+			s.insertQueuedPayloads(ctx)
 			if reorg {
 				s.log.Warn("Got reorg")
-				if s.sequencer {
+				if s.sequencerActive {
 					createBlock()
 				}
 			}
@@ -386,6 +1103,81 @@ func (s *state) loop() {
 				s.log.Trace("Requesting next step", "l1Head", s.l1Head, "l2Head", s.l2Head, "l1Origin", s.l2Head.L1Origin)
 				requestStep()
 			}
+		case req := <-s.startSequencer:
+			if s.sequencerActive {
+				req.err <- ErrSequencerAlreadyStarted
+			} else if req.hash != s.l2Head.Hash {
+				req.err <- fmt.Errorf("block hash does not match: head %s, received %s", s.l2Head.Hash, req.hash)
+			} else {
+				s.log.Info("Sequencer has been started", "l2Head", s.l2Head)
+				s.sequencerActive = true
+				s.events.Emit(events.SequencerStarted, SequencerEvent{L2Head: s.l2Head})
+				s.snapshot("Sequencer Started")
+				req.err <- nil
+				createBlock()
+			}
+		case respCh := <-s.stopSequencer:
+			if !s.sequencerActive {
+				respCh <- hashAndError{err: ErrSequencerAlreadyStopped}
+			} else {
+				s.log.Info("Sequencer has been stopped", "l2Head", s.l2Head)
+				s.sequencerActive = false
+				// Don't leave batches behind, another sequencer may take over
+				s.submitBatches()
+				s.events.Emit(events.SequencerStopped, SequencerEvent{L2Head: s.l2Head})
+				s.snapshot("Sequencer Stopped")
+				respCh <- hashAndError{hash: s.l2Head.Hash}
+			}
+		case respCh := <-s.sequencerActiveReq:
+			respCh <- s.sequencerActive
+		case respCh := <-s.syncStatusReq:
+			respCh <- s.syncStatus()
+		case respCh := <-s.pauseDerivation:
+			if s.derivationPaused {
+				respCh <- ErrDerivationAlreadyPaused
+			} else {
+				s.log.Warn("Derivation has been paused", "l2SafeHead", s.l2SafeHead, "l1Head", s.l1Head)
+				s.derivationPaused = true
+				s.snapshot("Derivation Paused")
+				respCh <- nil
+			}
+		case respCh := <-s.resumeDerivation:
+			if !s.derivationPaused {
+				respCh <- ErrDerivationNotPaused
+			} else {
+				s.log.Info("Derivation has been resumed", "l2SafeHead", s.l2SafeHead, "l1Head", s.l1Head)
+				s.derivationPaused = false
+				s.snapshot("Derivation Resumed")
+				respCh <- nil
+				requestStep()
+			}
+		case req := <-s.resetChain:
+			s.snapshot("Reset Chain Request")
+			ctx, cancel := context.WithTimeout(ctx, s.l1HeadTimeout)
+			err := s.rewindChain(ctx, req.hash)
+			cancel()
+			s.snapshot("After Reset Chain")
+			req.err <- err
+			if err == nil {
+				requestStep()
+				if s.sequencerActive {
+					createBlock()
+				}
+			}
+		case up := <-s.unsafePayloads:
+			payload := up.Payload
+			if s.sequencerActive {
+				s.log.Debug("Ignoring unsafe payload, the sequencer produces the unsafe blocks", "payload", payload.ID())
+				continue
+			}
+			if uint64(payload.BlockNumber) <= s.l2Head.Number {
+				s.log.Debug("Ignoring unsafe payload behind the unsafe head", "payload", payload.ID(), "l2Head", s.l2Head)
+				continue
+			}
+			if s.payloadQueue.Push(up) {
+				s.log.Debug("Queued unsafe payload", "payload", payload.ID(), "queued", s.payloadQueue.Len())
+			}
+			s.insertQueuedPayloads(ctx)
 		}
 	}
 
@@ -2,6 +2,8 @@ package driver
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 	"testing"
@@ -11,6 +13,7 @@ import (
 	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/stretchr/testify/assert"
@@ -48,6 +51,8 @@ func (fn outputHandlerFn) createNewBlock(ctx context.Context, l2Head eth.L2Block
 	panic("Unimplemented")
 }
 
+func (fn outputHandlerFn) reset(l1Base eth.BlockID) {}
+
 type outputArgs struct {
 	l2Head      eth.BlockID
 	l2Finalized eth.BlockID
@@ -141,7 +146,7 @@ func (tc *stateTestCase) Run(t *testing.T) {
 		return r.l2Head, r.l2Head, false, r.err
 	}
 	config := rollup.Config{SeqWindowSize: uint64(tc.seqWindow), Genesis: tc.genesis, BlockTime: 2}
-	state := NewState(log, config, chainSource, chainSource, outputHandlerFn(outputHandler), nil, false)
+	state := NewState(&Config{}, log, log, config, chainSource, chainSource, outputHandlerFn(outputHandler), nil)
 	defer func() {
 		assert.NoError(t, state.Close(), "Error closing state")
 	}()
@@ -225,3 +230,368 @@ func TestDriver(t *testing.T) {
 	}
 
 }
+
+func TestSequencerStartStop(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	chainSource := NewFakeChainSource([]string{"abc"}, []string{"ABC"}, log)
+	config := rollup.Config{SeqWindowSize: 2, Genesis: fakeGenesis('a', 'A', 0), BlockTime: 2}
+	outputHandler := func(ctx context.Context, l2Head eth.L2BlockRef, l2SafeHead eth.L2BlockRef, l2Finalized eth.BlockID, l1Input []eth.BlockID) (eth.L2BlockRef, eth.L2BlockRef, bool, error) {
+		return l2Head, l2SafeHead, false, nil
+	}
+	state := NewState(&Config{SequencerEnabled: true, SequencerStopped: true}, log, log, config, chainSource, chainSource, outputHandlerFn(outputHandler), nil)
+	defer func() {
+		assert.NoError(t, state.Close(), "Error closing state")
+	}()
+	assert.NoError(t, state.Start(context.Background(), make(chan eth.L1BlockRef)))
+	head := state.l2Head
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := state.StopSequencer(ctx)
+	assert.ErrorIs(t, err, ErrSequencerAlreadyStopped, "cannot stop a stopped sequencer")
+
+	err = state.StartSequencer(ctx, common.Hash{0x42})
+	assert.Error(t, err, "cannot start on a block that is not the unsafe head")
+
+	assert.NoError(t, state.StartSequencer(ctx, head.Hash))
+	assert.ErrorIs(t, state.StartSequencer(ctx, head.Hash), ErrSequencerAlreadyStarted)
+
+	stoppedAt, err := state.StopSequencer(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, head.Hash, stoppedAt, "no blocks are produced before the L1 genesis")
+}
+
+func TestSequencerNotEnabled(t *testing.T) {
+	state := NewState(&Config{}, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{}, nil, nil, nil, nil)
+	assert.ErrorIs(t, state.StartSequencer(context.Background(), common.Hash{}), ErrSequencerNotEnabled)
+	_, err := state.StopSequencer(context.Background())
+	assert.ErrorIs(t, err, ErrSequencerNotEnabled)
+}
+
+func TestHeadChangeEvents(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	chainSource := NewFakeChainSource([]string{"abcd"}, []string{"ABCD"}, log)
+	l1headsCh := make(chan eth.L1BlockRef, 10)
+	outputHandler := func(ctx context.Context, l2Head eth.L2BlockRef, l2SafeHead eth.L2BlockRef, l2Finalized eth.BlockID, l1Input []eth.BlockID) (eth.L2BlockRef, eth.L2BlockRef, bool, error) {
+		next := chainSource.setL2Head(int(l2Head.Number) + 1)
+		return next, next, false, nil
+	}
+	config := rollup.Config{SeqWindowSize: 2, Genesis: fakeGenesis('a', 'A', 0), BlockTime: 2}
+	state := NewState(&Config{}, log, log, config, chainSource, chainSource, outputHandlerFn(outputHandler), nil)
+	events := make(chan HeadEvent, 10)
+	sub := state.headsFeed.subscribe(events)
+	defer sub.Unsubscribe()
+	defer func() {
+		assert.NoError(t, state.Close(), "Error closing state")
+	}()
+	assert.NoError(t, state.Start(context.Background(), l1headsCh))
+
+	l1headsCh <- chainSource.advanceL1()
+	l1headsCh <- chainSource.advanceL1()
+
+	for _, kind := range []HeadKind{UnsafeHead, SafeHead} {
+		select {
+		case ev := <-events:
+			assert.Equal(t, kind, ev.Kind)
+			assert.Equal(t, "A:0", testIDOf(ev.Old))
+			assert.Equal(t, "B:1", testIDOf(ev.New))
+			assert.Zero(t, ev.ReorgDepth, "simple extension")
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s head event", kind)
+		}
+	}
+}
+
+func TestHeadFeedDoesNotBlock(t *testing.T) {
+	var feed headFeed
+	slow := make(chan HeadEvent, 1)
+	fast := make(chan HeadEvent, 3)
+	defer feed.subscribe(slow).Unsubscribe()
+	fastSub := feed.subscribe(fast)
+	for i := uint64(1); i <= 3; i++ {
+		feed.send(HeadEvent{Kind: UnsafeHead, New: eth.L2BlockRef{Number: i}})
+	}
+	assert.Len(t, slow, 1, "events for a full channel are dropped")
+	assert.Equal(t, uint64(1), (<-slow).New.Number)
+	assert.Len(t, fast, 3)
+
+	fastSub.Unsubscribe()
+	feed.send(HeadEvent{Kind: UnsafeHead, New: eth.L2BlockRef{Number: 4}})
+	assert.Len(t, fast, 3, "no events after unsubscribing")
+	assert.Equal(t, uint64(4), (<-slow).New.Number)
+}
+
+func testIDOf(ref eth.L2BlockRef) string {
+	return fmt.Sprintf("%s:%d", strings.TrimRight(string(ref.Hash[:]), "\x00"), ref.Number)
+}
+
+func TestCoalesceL1Heads(t *testing.T) {
+	log := testlog.Logger(t, log.LvlError)
+	a, b, c := fakeL1Block('a', 0, 0), fakeL1Block('b', 'a', 1), fakeL1Block('c', 'b', 2)
+	x, y := fakeL1Block('x', 'a', 1), fakeL1Block('y', 'x', 2)
+
+	coalesce := func(heads ...eth.L1BlockRef) ([]eth.L1BlockRef, bool) {
+		ch := make(chan eth.L1BlockRef, len(heads))
+		for _, h := range heads[1:] {
+			ch <- h
+		}
+		s := &state{l1Heads: ch, log: log}
+		return s.coalesceL1Heads(heads[0])
+	}
+
+	heads, reorg := coalesce(a)
+	assert.Equal(t, []eth.L1BlockRef{a}, heads)
+	assert.False(t, reorg)
+
+	heads, reorg = coalesce(a, a, b, b, b, c)
+	assert.Equal(t, []eth.L1BlockRef{a, b, c}, heads, "repeated heads are dropped")
+	assert.False(t, reorg, "linear extension")
+
+	heads, reorg = coalesce(a, b, x, y)
+	assert.Equal(t, y, heads[len(heads)-1], "latest head is last")
+	assert.True(t, reorg, "b is replaced by x")
+}
+
+func TestSnapshot(t *testing.T) {
+	var records []*log.Record
+	snapshotLog := log.New()
+	snapshotLog.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	s := &state{
+		l2Head:      fakeL2Block('b', 'a', fakeID('A', 0), 1),
+		snapshotLog: snapshotLog,
+	}
+	s.l1Traversal.Extend(fakeID('B', 1))
+	s.snapshot("Test Event")
+
+	assert.Len(t, records, 1)
+	ctx := make(map[string]interface{})
+	for i := 0; i+1 < len(records[0].Ctx); i += 2 {
+		ctx[records[0].Ctx[i].(string)] = records[0].Ctx[i+1]
+	}
+	assert.Equal(t, "Test Event", ctx["event"])
+	var l2Head eth.L2BlockRef
+	assert.NoError(t, json.Unmarshal([]byte(ctx["l2Head"].(fmt.Stringer).String()), &l2Head))
+	assert.Equal(t, s.l2Head, l2Head)
+	var window []eth.BlockID
+	assert.NoError(t, json.Unmarshal([]byte(ctx["l1WindowBuf"].(fmt.Stringer).String()), &window))
+	assert.Equal(t, s.l1Traversal.Blocks(), window)
+}
+
+type submitterFn func(config *rollup.Config, batches []*derive.BatchData) (common.Hash, error)
+
+func (fn submitterFn) Submit(config *rollup.Config, batches []*derive.BatchData) (common.Hash, error) {
+	return fn(config, batches)
+}
+
+func (fn submitterFn) L1HeadChanged(head eth.L1BlockRef, reorged bool) {}
+
+func (fn submitterFn) L1Finalized(finalized eth.L1BlockRef) {}
+
+func TestBatchAggregation(t *testing.T) {
+	submissions := make(chan []*derive.BatchData, 10)
+	bss := submitterFn(func(config *rollup.Config, batches []*derive.BatchData) (common.Hash, error) {
+		submissions <- batches
+		return common.Hash{}, nil
+	})
+	batch := func(timestamp uint64) *derive.BatchData {
+		return &derive.BatchData{BatchV1: derive.BatchV1{Epoch: 1, Timestamp: timestamp}}
+	}
+	data, err := batch(0).MarshalBinary()
+	assert.NoError(t, err)
+	batchSize := uint64(len(data))
+
+	t.Run("not aggregated", func(t *testing.T) {
+		s := NewState(&Config{SequencerEnabled: true}, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{}, nil, nil, nil, bss)
+		s.queueBatch(batch(0))
+		assert.Len(t, <-submissions, 1)
+		assert.Empty(t, s.pendingBatches)
+	})
+	t.Run("size limit", func(t *testing.T) {
+		cfg := &Config{SequencerEnabled: true, BatchSubmitInterval: time.Hour, MaxBatchSubmissionSize: 3 * batchSize}
+		s := NewState(cfg, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{}, nil, nil, nil, bss)
+		s.queueBatch(batch(0))
+		s.queueBatch(batch(2))
+		assert.Len(t, s.pendingBatches, 2, "below size limit")
+		assert.Len(t, submissions, 0)
+		s.queueBatch(batch(4))
+		assert.Equal(t, []*derive.BatchData{batch(0), batch(2), batch(4)}, <-submissions)
+		assert.Empty(t, s.pendingBatches)
+		assert.Zero(t, s.pendingBatchesSize)
+	})
+	t.Run("interval", func(t *testing.T) {
+		cfg := &Config{SequencerEnabled: true, BatchSubmitInterval: time.Hour}
+		s := NewState(cfg, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{}, nil, nil, nil, bss)
+		s.queueBatch(batch(0))
+		s.queueBatch(batch(2))
+		assert.Len(t, submissions, 0)
+		// the loop submits on each interval tick
+		s.submitBatches()
+		assert.Len(t, <-submissions, 2)
+		s.submitBatches()
+		assert.Len(t, submissions, 0, "nothing to submit")
+	})
+	t.Run("close", func(t *testing.T) {
+		log := testlog.Logger(t, log.LvlError)
+		chainSource := NewFakeChainSource([]string{"abc"}, []string{"ABC"}, log)
+		config := rollup.Config{SeqWindowSize: 2, Genesis: fakeGenesis('a', 'A', 0), BlockTime: 2}
+		outputHandler := func(ctx context.Context, l2Head eth.L2BlockRef, l2SafeHead eth.L2BlockRef, l2Finalized eth.BlockID, l1Input []eth.BlockID) (eth.L2BlockRef, eth.L2BlockRef, bool, error) {
+			return l2Head, l2SafeHead, false, nil
+		}
+		slow := submitterFn(func(config *rollup.Config, batches []*derive.BatchData) (common.Hash, error) {
+			time.Sleep(50 * time.Millisecond)
+			submissions <- batches
+			return common.Hash{}, nil
+		})
+		cfg := &Config{SequencerEnabled: true, SequencerStopped: true, BatchSubmitInterval: time.Hour}
+		s := NewState(cfg, log, log, config, chainSource, chainSource, outputHandlerFn(outputHandler), slow)
+		s.queueBatch(batch(0))
+		s.queueBatch(batch(2))
+		assert.NoError(t, s.Start(context.Background(), make(chan eth.L1BlockRef)))
+		// the pending batches are submitted on close, which waits for the submission
+		assert.NoError(t, s.Close())
+		assert.Len(t, submissions, 1)
+		assert.Len(t, <-submissions, 2)
+	})
+}
+
+// blockingL1Chain blocks on L1Range until the request context is done.
+type blockingL1Chain struct {
+	L1Chain
+}
+
+func (m blockingL1Chain) L1Range(ctx context.Context, base eth.BlockID, max uint64) ([]eth.BlockID, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestOperationDeadlines(t *testing.T) {
+	cfg := rollup.Config{SeqWindowSize: 2}
+
+	t.Run("timeout", func(t *testing.T) {
+		s := NewState(&Config{L1RangeTimeout: 10 * time.Millisecond}, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), cfg, blockingL1Chain{}, nil, nil, nil)
+		_, err := s.handleEpoch(s.ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+	t.Run("cancel on close", func(t *testing.T) {
+		s := NewState(&Config{L1RangeTimeout: time.Hour}, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), cfg, blockingL1Chain{}, nil, nil, nil)
+		errCh := make(chan error)
+		go func() {
+			_, err := s.handleEpoch(s.ctx)
+			errCh <- err
+		}()
+		assert.NoError(t, s.Close())
+		select {
+		case err := <-errCh:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(time.Second):
+			t.Fatal("operation was not cancelled on close")
+		}
+	})
+}
+
+func TestNextBlockDelay(t *testing.T) {
+	s := &state{Config: rollup.Config{BlockTime: 2}}
+	s.l2Head.Time = 1000
+	at := func(sec int64, msec int64) time.Time {
+		return time.Unix(sec, msec*int64(time.Millisecond))
+	}
+	assert.Equal(t, 500*time.Millisecond, s.nextBlockDelay(at(1001, 500)), "wait for the target time of the next block")
+	assert.Equal(t, time.Duration(0), s.nextBlockDelay(at(1002, 0)), "next block is due")
+	assert.Equal(t, time.Duration(0), s.nextBlockDelay(at(1010, 0)), "catch up after a stall")
+	assert.Equal(t, 2*time.Second, s.nextBlockDelay(at(900, 0)), "wall-clock behind the chain is capped to the block time")
+
+	s.clockSkew = 300 * time.Millisecond
+	assert.Equal(t, 300*time.Millisecond, s.nextBlockDelay(at(1002, 0)), "leave time for L1 blocks to propagate")
+}
+
+func TestVerifyGenesis(t *testing.T) {
+	a := fakeL1Block('a', 0, 0)
+	A := fakeL2Block('A', 0, a.ID(), 0)
+	l2 := &stubL2Chain{blocks: []eth.L2BlockRef{A}}
+	newState := func(genesis eth.BlockID) *state {
+		cfg := rollup.Config{Genesis: rollup.Genesis{L1: a.ID(), L2: genesis}}
+		return NewState(&Config{}, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), cfg, nil, l2, nil, nil)
+	}
+
+	assert.NoError(t, newState(A.ID()).verifyGenesis(context.Background()))
+	assert.ErrorIs(t, newState(fakeID('X', 0)).verifyGenesis(context.Background()), ErrGenesisMismatch)
+	assert.ErrorIs(t, newState(fakeID('B', 1)).verifyGenesis(context.Background()), ethereum.NotFound, "engine does not have the genesis block")
+	assert.ErrorIs(t, newState(fakeID('X', 0)).Start(context.Background(), nil), ErrGenesisMismatch, "refuse to start")
+}
+
+func TestL1ReorgBase(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlError)
+	chainSource := NewFakeChainSource([]string{"abcdefg", "abcxyzw"}, []string{"ABCDEFG"}, logger)
+	chainSource.l1head = 6
+	s := NewState(&Config{}, logger, logger, rollup.Config{SeqWindowSize: 2}, chainSource, chainSource, nil, nil)
+	s.l1Traversal.Extend(fakeID('b', 1), fakeID('c', 2), fakeID('d', 3), fakeID('e', 4))
+	assert.Equal(t, fakeID('e', 4), s.l1ReorgBase(context.Background(), eth.HeadChange{}), "no reorg")
+
+	// the fork point of the tracker is used without L1 lookups
+	fork := eth.HeadChange{Kind: eth.HeadReorged, Ancestor: fakeL1Block('c', 'b', 2)}
+	assert.Equal(t, fakeID('c', 2), s.l1ReorgBase(context.Background(), fork), "fork point")
+
+	chainSource.reorgL1()
+	base := s.l1ReorgBase(context.Background(), eth.HeadChange{Kind: eth.HeadReorged})
+	assert.Equal(t, fakeID('c', 2), base, "last common block")
+	s.l1Traversal.Reset(base)
+	assert.Equal(t, []eth.BlockID{fakeID('b', 1), fakeID('c', 2)}, s.l1Traversal.Blocks(), "canonical blocks are kept")
+}
+
+func TestThrottledByLag(t *testing.T) {
+	safe := eth.L2BlockRef{Number: 10, Time: 1000}
+	newState := func(cfg *Config, unsafeNumber uint64) *state {
+		cfg.SequencerEnabled = true
+		s := NewState(cfg, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{BlockTime: 2}, nil, nil, nil, nil)
+		s.l2SafeHead = safe
+		s.l2Head = eth.L2BlockRef{Number: unsafeNumber, Time: safe.Time + 2*(unsafeNumber-safe.Number)}
+		return s
+	}
+	assert.False(t, newState(&Config{}, 1000).throttledByLag(), "disabled by default")
+	assert.False(t, newState(&Config{MaxUnsafeLagBlocks: 5}, 14).throttledByLag())
+	assert.True(t, newState(&Config{MaxUnsafeLagBlocks: 5}, 15).throttledByLag())
+	assert.False(t, newState(&Config{MaxUnsafeLagTime: 10 * time.Second}, 14).throttledByLag())
+	assert.True(t, newState(&Config{MaxUnsafeLagTime: 10 * time.Second}, 15).throttledByLag())
+
+	s := newState(&Config{MaxUnsafeLagBlocks: 5}, 15)
+	origin, err := s.createNewL2Block(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, eth.L1BlockRef{}, origin, "no block is produced")
+	assert.True(t, s.lagThrottled)
+	s.l2SafeHead = eth.L2BlockRef{Number: 12, Time: 1004}
+	assert.False(t, s.throttledByLag(), "resumes once the safe head catches up")
+}
+
+func TestUpdateFinalized(t *testing.T) {
+	logger := testlog.Logger(t, log.LvlError)
+	chainSource := NewFakeChainSource([]string{"abcdefg"}, []string{"ABCDEFG"}, logger)
+	chainSource.l1head = 6
+	s := NewState(&Config{}, logger, logger, rollup.Config{SeqWindowSize: 2}, chainSource, chainSource, nil, nil)
+	l2 := chainSource.l2s[0]
+	// epochs derived up to L1 blocks c, e and g
+	for _, fd := range []struct {
+		l2 eth.L2BlockRef
+		l1 eth.BlockID
+	}{{l2[1], fakeID('c', 2)}, {l2[3], fakeID('e', 4)}, {l2[5], fakeID('g', 6)}} {
+		s.l2SafeHead = fd.l2
+		s.recordFinalityData(fd.l1)
+	}
+
+	s.updateFinalized(context.Background())
+	assert.Equal(t, eth.BlockID{}, s.l2Finalized, "no finalized L1 block")
+
+	chainSource.l1finalized = 5
+	s.updateFinalized(context.Background())
+	assert.Equal(t, l2[3].ID(), s.l2Finalized, "derived from finalized L1 blocks only")
+	assert.Equal(t, fakeID('f', 5), s.l1Finalized.ID())
+	assert.Len(t, s.finalityData, 1)
+
+	// the safe head is reorged back before the last recorded epoch
+	s.l2SafeHead = l2[4]
+	s.dropFinalityData()
+	assert.Empty(t, s.finalityData)
+}
@@ -11,11 +11,17 @@ import (
 	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/sync"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 )
 
 type outputImpl struct {
@@ -23,6 +29,56 @@ type outputImpl struct {
 	l2     Engine
 	log    log.Logger
 	Config rollup.Config
+	// sysCfgs is the system config of each epoch, shared with the verifier
+	sysCfgs *systemConfigs
+	// ds is the source of the batch data, the L1 calldata of the downloader if nil
+	ds derive.DataSource
+	// retrieval is the L1 retrieval stage of the derivation pipeline, it reads from ds. Created on first use if nil.
+	retrieval *derive.L1Retrieval
+	// channelBank is the channel bank stage of the derivation pipeline, after retrieval. Created on first use if nil.
+	channelBank *derive.ChannelBankStage
+	// index records the batch data that each safe L2 block was derived from, optional
+	index *index.DB
+	// network gossips the blocks that are sequenced, optional
+	network Network
+	// payloadBuildTime is the time that the engine gets to build a new sequenced block, before the payload is fetched
+	payloadBuildTime time.Duration
+	// progress records the inclusion latencies of the safe blocks, optional
+	progress *sync.ProgressTracker
+	// countedEpoch is the last epoch of which the batches were counted in the batch metrics, see countBatch
+	countedEpoch rollup.Epoch
+}
+
+// slowPayloadThreshold is the time past the payload build time after which the engine is reported as slow
+const slowPayloadThreshold = 200 * time.Millisecond
+
+// dataSource returns the L1 retrieval stage that reads the batch data from the source, by default the L1 calldata.
+func (d *outputImpl) dataSource() *derive.L1Retrieval {
+	if d.retrieval == nil {
+		if d.ds == nil {
+			d.ds = &derive.CalldataSource{Config: &d.Config, Fetcher: d.dl, Log: d.log}
+		}
+		d.retrieval = derive.NewL1Retrieval(d.ds)
+	}
+	return d.retrieval
+}
+
+// channelBankStage returns the channel bank stage, that decodes the batches of the batch data of the L1 retrieval stage.
+func (d *outputImpl) channelBankStage() *derive.ChannelBankStage {
+	if d.channelBank == nil {
+		d.channelBank = derive.NewChannelBankStage(&d.Config, d.log)
+	}
+	return d.channelBank
+}
+
+// reset resets the derivation stages of the output back to the given L1 base block, after a L1 reorg.
+func (d *outputImpl) reset(l1Base eth.BlockID) {
+	if d.retrieval != nil {
+		d.retrieval.Reset(l1Base)
+	}
+	if d.channelBank != nil {
+		d.channelBank.Reset(l1Base)
+	}
 }
 
 func (d *outputImpl) createNewBlock(ctx context.Context, l2Head eth.L2BlockRef, l2SafeHead eth.BlockID, l2Finalized eth.BlockID, l1Origin eth.L1BlockRef) (eth.L2BlockRef, *derive.BatchData, error) {
@@ -48,13 +104,24 @@ func (d *outputImpl) createNewBlock(ctx context.Context, l2Head eth.L2BlockRef,
 		return l2Head, nil, fmt.Errorf("failed to fetch L1 block info of %s: %v", l1Origin, err)
 	}
 
-	l1InfoTx, err := derive.L1InfoDepositBytes(l2Head.Number+1, l1Info)
+	// The sequence number is the index of the block within the epoch, it is reset for each new L1 origin
+	seqNumber := l2Head.SequenceNumber + 1
+	if firstEpochBlock {
+		seqNumber = 0
+	}
+
+	sysCfg, err := d.systemConfig(fetchCtx, l1Origin.ID())
+	if err != nil {
+		return l2Head, nil, err
+	}
+
+	l1InfoTx, err := derive.L1InfoDepositBytes(l2Head.Number+1, seqNumber, l1Info, sysCfg)
 	if err != nil {
 		return l2Head, nil, err
 	}
 	var txns []l2.Data
 	txns = append(txns, l1InfoTx)
-	deposits, err := derive.DeriveDeposits(l2Head.Number+1, receipts)
+	deposits, err := derive.DeriveDeposits(&d.Config, l2Head.Number+1, receipts)
 	d.log.Info("Derived deposits", "deposits", deposits, "l2Parent", l2Head, "l1Origin", l1Origin)
 	if err != nil {
 		return l2Head, nil, fmt.Errorf("failed to derive deposits: %v", err)
@@ -69,6 +136,7 @@ func (d *outputImpl) createNewBlock(ctx context.Context, l2Head eth.L2BlockRef,
 		SuggestedFeeRecipient: d.Config.FeeRecipientAddress,
 		Transactions:          txns,
 		NoTxPool:              false,
+		GasLimit:              gasLimit(sysCfg),
 	}
 	fc := l2.ForkchoiceState{
 		HeadBlockHash:      l2Head.Hash,
@@ -76,9 +144,28 @@ func (d *outputImpl) createNewBlock(ctx context.Context, l2Head eth.L2BlockRef,
 		FinalizedBlockHash: l2Finalized.Hash,
 	}
 
-	payload, err := d.insertHeadBlock(ctx, fc, attrs, false)
+	// the payload is built and imported in separate steps, to time them separately
+	buildStart := time.Now()
+	buildCtx, span := tracer.Start(ctx, "payload_build", trace.WithAttributes(attribute.Int("txs", len(attrs.Transactions))))
+	payload, err := d.buildPayload(buildCtx, fc, attrs, d.payloadBuildTime)
+	tracing.End(span, err)
+	if err != nil {
+		return l2Head, nil, fmt.Errorf("failed to extend L2 chain: %w", err)
+	}
+	sequencerTimer("payload_build").UpdateSince(buildStart)
+	importStart := time.Now()
+	importCtx, span := tracer.Start(ctx, "payload_import", trace.WithAttributes(attribute.Int64("l2.number", int64(payload.BlockNumber))))
+	err = d.importPayload(importCtx, fc, payload, false)
+	tracing.End(span, err)
 	if err != nil {
-		return l2Head, nil, fmt.Errorf("failed to extend L2 chain: %v", err)
+		return l2Head, nil, fmt.Errorf("failed to extend L2 chain: %w", err)
+	}
+	sequencerTimer("payload_import").UpdateSince(importStart)
+	// the block is already part of the chain, the other nodes catch up from L1 if it is not gossiped
+	if d.network != nil {
+		if err := d.network.PublishL2Payload(ctx, payload); err != nil {
+			d.log.Warn("Failed to gossip the new block", "block", payload.ID(), "err", err)
+		}
 	}
 	batch := &derive.BatchData{
 		BatchV1: derive.BatchV1{
@@ -105,106 +192,233 @@ func (d *outputImpl) insertEpoch(ctx context.Context, l2Head eth.L2BlockRef, l2S
 	logger := d.log.New("input_l1_first", l1Input[0], "input_l1_last", l1Input[len(l1Input)-1], "input_l2_parent", l2SafeHead, "finalized_l2", l2Finalized)
 	logger.Trace("Running update step on the L2 node")
 
+	epoch := rollup.Epoch(l1Input[0].Number)
+	epochAttrs, inclusions, err := d.epochAttributes(ctx, l2SafeHead, l1Input, logger)
+	if err != nil {
+		return l2Head, l2SafeHead, false, err
+	}
+
+	fc := l2.ForkchoiceState{
+		HeadBlockHash:      l2Head.Hash,
+		SafeBlockHash:      l2SafeHead.Hash,
+		FinalizedBlockHash: l2Finalized.Hash,
+	}
+	// Execute each L2 block in the epoch
+	lastHead := l2Head
+	lastSafeHead := l2SafeHead
+	didReorg := false
+	var payload derive.Block
+	var reorg bool
+	l1Times := make(map[common.Hash]uint64)
+	for i, attrs := range epochAttrs {
+		// We are either verifying blocks (with a potential for a reorg) or inserting a safe head to the chain
+		if lastHead.Hash != lastSafeHead.Hash {
+			payload, reorg, err = d.verifySafeBlock(ctx, fc, attrs, lastSafeHead.ID())
+
+		} else {
+			payload, err = d.insertHeadBlock(ctx, fc, attrs, true, 0)
+		}
+		if err != nil {
+			return lastHead, lastSafeHead, didReorg, fmt.Errorf("failed to extend L2 chain at block %d/%d of epoch %d: %w", i, len(epochAttrs), epoch, err)
+		}
+
+		newLast, err := derive.BlockReferences(payload, &d.Config.Genesis)
+		if err != nil {
+			return lastHead, lastSafeHead, didReorg, fmt.Errorf("failed to derive block references: %w", err)
+		}
+		if err := derive.CheckNextBlock(&d.Config, lastSafeHead, newLast); err != nil {
+			return lastHead, lastSafeHead, didReorg, fmt.Errorf("inconsistent L2 block %d/%d of epoch %d: %w", i, len(epochAttrs), epoch, err)
+		}
+		if newLast.L1Origin != l1Input[0] {
+			return lastHead, lastSafeHead, didReorg, fmt.Errorf("L2 block %s has L1 origin %s, expected the first block %s of the sequencing window", newLast, newLast.L1Origin, l1Input[0])
+		}
+		if reorg {
+			didReorg = true
+		}
+		// If reorg or the L2 Head is not ahead of the safe head, bump the head block.
+		if reorg || lastHead.Hash == lastSafeHead.Hash {
+			lastHead = newLast
+		}
+		lastSafeHead = newLast
+		d.indexBatchInclusion(newLast, inclusions[i])
+		d.recordInclusionLatency(ctx, l1Input, inclusions[i], l1Times)
+
+		fc.HeadBlockHash = lastHead.Hash
+		fc.SafeBlockHash = lastSafeHead.Hash
+	}
+
+	return lastHead, lastSafeHead, didReorg, nil
+}
+
+// recordInclusionLatency records the time from the L1 inclusion of the batch data of a new safe block until now.
+// The block is derivable once all of its batch data is included, or, for a block without batch data, once the sequencing
+// window is complete. The timestamps of the L1 blocks are cached in l1Times, for the other blocks of the epoch.
+// While the safe head is catching up, the latency includes the time that the block waited for its turn to be derived.
+func (d *outputImpl) recordInclusionLatency(ctx context.Context, window []eth.BlockID, inclusions []index.BatchInclusion, l1Times map[common.Hash]uint64) {
+	included := window[len(window)-1]
+	if len(inclusions) > 0 {
+		included = inclusions[0].L1
+		for _, incl := range inclusions[1:] {
+			if incl.L1.Number > included.Number {
+				included = incl.L1
+			}
+		}
+	}
+	l1Time, ok := l1Times[included.Hash]
+	if !ok {
+		info, err := d.dl.InfoByHash(ctx, included.Hash)
+		if err != nil {
+			d.log.Debug("Failed to fetch the L1 inclusion time of a safe block", "l1", included, "err", err)
+			return
+		}
+		l1Time = info.Time()
+		l1Times[included.Hash] = l1Time
+	}
+	latency := time.Since(time.Unix(int64(l1Time), 0))
+	metrics.GetOrRegisterHistogram("derive/inclusion_latency", nil, metrics.NewExpDecaySample(1028, 0.015)).Update(latency.Milliseconds())
+	if d.progress != nil {
+		d.progress.RecordLatency(latency)
+	}
+}
+
+// epochAttributes derives the payload attributes of the L2 blocks of the epoch on top of the L2 safe head,
+// from the L1 sequencing window of the epoch. It also returns for each block the items of batch data on L1 that it was
+// derived from, none for deposit-only blocks.
+func (d *outputImpl) epochAttributes(ctx context.Context, l2SafeHead eth.L2BlockRef, l1Input []eth.BlockID, logger log.Logger) (_ []*l2.PayloadAttributes, _ [][]index.BatchInclusion, err error) {
 	// Get inputs from L1 and L2
 	epoch := rollup.Epoch(l1Input[0].Number)
+	ctx, span := tracer.Start(ctx, "epoch_attributes", trace.WithAttributes(attribute.Int64("epoch", int64(epoch))))
+	defer func() { tracing.End(span, err) }()
 	fetchCtx, cancel := context.WithTimeout(ctx, time.Second*20)
 	defer cancel()
 	l2Info, err := d.l2.BlockByHash(fetchCtx, l2SafeHead.Hash)
 	if err != nil {
-		return l2Head, l2SafeHead, false, fmt.Errorf("failed to fetch L2 block info of %s: %w", l2SafeHead, err)
+		return nil, nil, fmt.Errorf("failed to fetch L2 block info of %s: %w", l2SafeHead, err)
 	}
 	l1Info, _, receipts, err := d.dl.Fetch(fetchCtx, l1Input[0].Hash)
 	if err != nil {
-		return l2Head, l2SafeHead, false, fmt.Errorf("failed to fetch L1 block info of %s: %w", l1Input[0], err)
+		return nil, nil, fmt.Errorf("failed to fetch L1 block info of %s: %w", l1Input[0], err)
 	}
 	if l2SafeHead.L1Origin.Hash != l1Info.ParentHash() {
-		return l2Head, l2SafeHead, false, fmt.Errorf("l1Info %v does not extend L1 Origin (%v) of L2 Safe Head (%v)", l1Info.Hash(), l2SafeHead.L1Origin, l2SafeHead)
+		return nil, nil, fmt.Errorf("l1Info %v does not extend L1 Origin (%v) of L2 Safe Head (%v)", l1Info.Hash(), l2SafeHead.L1Origin, l2SafeHead)
 	}
 	nextL1Block, err := d.dl.InfoByHash(ctx, l1Input[1].Hash)
 	if err != nil {
-		return l2Head, l2SafeHead, false, fmt.Errorf("failed to get L1 timestamp of next L1 block: %v", err)
+		return nil, nil, fmt.Errorf("failed to get L1 timestamp of next L1 block: %v", err)
 	}
-	deposits, err := derive.DeriveDeposits(l2SafeHead.Number+1, receipts)
+	deposits, err := derive.DeriveDeposits(&d.Config, l2SafeHead.Number+1, receipts)
 	if err != nil {
-		return l2Head, l2SafeHead, false, fmt.Errorf("failed to derive deposits: %w", err)
+		return nil, nil, fmt.Errorf("failed to derive deposits: %w", err)
 	}
-	// TODO: with sharding the blobs may be identified in more detail than L1 block hashes
-	transactions, err := d.dl.FetchAllTransactions(fetchCtx, l1Input)
+	sysCfg, err := d.systemConfig(fetchCtx, l1Input[0])
 	if err != nil {
-		return l2Head, l2SafeHead, false, fmt.Errorf("failed to fetch transactions from %s: %v", l1Input, err)
+		return nil, nil, err
 	}
-	batches, err := derive.BatchesFromEVMTransactions(&d.Config, transactions)
+	// TODO: with sharding the blobs may be identified in more detail than L1 block hashes
+	decodeCtx, decodeSpan := tracer.Start(fetchCtx, "batch_decode")
+	data, txs, err := d.dataSource().BatchDataWithTxs(decodeCtx, l1Input, sysCfg.BatcherAddr)
 	if err != nil {
-		return l2Head, l2SafeHead, false, fmt.Errorf("failed to fetch create batches from transactions: %w", err)
+		tracing.End(decodeSpan, err)
+		return nil, nil, fmt.Errorf("failed to fetch batch data from %s: %v", l1Input, err)
 	}
+	batches, positions := d.channelBankStage().Batches(l1Input, data, txs)
+	decodeSpan.SetAttributes(attribute.Int("batches", len(batches)))
+	tracing.End(decodeSpan, nil)
 	// Make batches contiguous
 	minL2Time := l2Info.Time() + d.Config.BlockTime
 	maxL2Time := l1Info.Time() + d.Config.MaxSequencerDrift
 	if minL2Time+d.Config.BlockTime > maxL2Time {
 		maxL2Time = minL2Time + d.Config.BlockTime
 	}
-	batches = derive.FilterBatches(&d.Config, epoch, minL2Time, maxL2Time, batches)
+	batches = derive.FilterBatches(&d.Config, epoch, minL2Time, maxL2Time, batches, d.countBatch(epoch, l1Input, positions), logger)
+	if epoch > d.countedEpoch {
+		d.countedEpoch = epoch
+	}
+	if len(batches) == 0 {
+		// The sequencing window is closed and no valid batches were submitted for this epoch.
+		// The epoch is forced onto the safe chain with deposit-only blocks, so that a withholding sequencer cannot stall the safe head.
+		logger.Debug("No batches found in sequencing window, producing deposit-only blocks", "epoch", epoch)
+	}
 	batches = derive.FillMissingBatches(batches, uint64(epoch), d.Config.BlockTime, minL2Time, nextL1Block.Time())
 
-	fc := l2.ForkchoiceState{
-		HeadBlockHash:      l2Head.Hash,
-		SafeBlockHash:      l2SafeHead.Hash,
-		FinalizedBlockHash: l2Finalized.Hash,
-	}
-	// Execute each L2 block in the epoch
-	lastHead := l2Head
-	lastSafeHead := l2SafeHead
-	didReorg := false
-	var payload derive.Block
-	var reorg bool
+	var out []*l2.PayloadAttributes
+	var inclusions [][]index.BatchInclusion
+	parent := l2SafeHead
 	for i, batch := range batches {
+		// Fail the step, rather than inserting an inconsistent chain into the engine
+		next := eth.L2BlockRef{
+			Number:         parent.Number + 1,
+			ParentHash:     parent.Hash,
+			Time:           batch.Timestamp,
+			L1Origin:       l1Info.ID(),
+			SequenceNumber: uint64(i),
+		}
+		if err := derive.CheckNextBlock(&d.Config, parent, next); err != nil {
+			return nil, nil, fmt.Errorf("inconsistent L2 block %d/%d of epoch %d: %w", i, len(batches), epoch, err)
+		}
+		parent = next
 		var txns []l2.Data
-		l1InfoTx, err := derive.L1InfoDepositBytes(lastSafeHead.Number+1, l1Info)
+		l1InfoTx, err := derive.L1InfoDepositBytes(l2SafeHead.Number+1+uint64(i), uint64(i), l1Info, sysCfg)
 		if err != nil {
-			return l2Head, l2SafeHead, false, fmt.Errorf("failed to create l1InfoTx: %w", err)
+			return nil, nil, fmt.Errorf("failed to create l1InfoTx: %w", err)
 		}
 		txns = append(txns, l1InfoTx)
 		if i == 0 {
 			txns = append(txns, deposits...)
 		}
 		txns = append(txns, batch.Transactions...)
-		attrs := &l2.PayloadAttributes{
+		out = append(out, &l2.PayloadAttributes{
 			Timestamp:             hexutil.Uint64(batch.Timestamp),
 			Random:                l2.Bytes32(l1Info.MixDigest()),
 			SuggestedFeeRecipient: d.Config.FeeRecipientAddress,
 			Transactions:          txns,
 			NoTxPool:              false,
-		}
-
-		// We are either verifying blocks (with a potential for a reorg) or inserting a safe head to the chain
-		if lastHead.Hash != lastSafeHead.Hash {
-			payload, reorg, err = d.verifySafeBlock(ctx, fc, attrs, lastSafeHead.ID())
+			GasLimit:              gasLimit(sysCfg),
+		})
+		inclusions = append(inclusions, batchInclusions(positions[batch]))
+	}
+	return out, inclusions, nil
+}
 
-		} else {
-			payload, err = d.insertHeadBlock(ctx, fc, attrs, true)
+// countBatch returns if the validity of a batch of the window of the epoch is counted in the batch metrics.
+// Each epoch is counted once, also if it is derived again, and each batch is counted with the first window that
+// completes it, the window with its last data in the last L1 block. The first epoch that is derived counts all its batches.
+func (d *outputImpl) countBatch(epoch rollup.Epoch, l1Input []eth.BlockID, positions map[*derive.BatchData][]derive.L1DataPosition) func(batch *derive.BatchData) bool {
+	first := d.countedEpoch == 0
+	counted := epoch <= d.countedEpoch
+	last := l1Input[len(l1Input)-1]
+	return func(batch *derive.BatchData) bool {
+		if first {
+			return true
 		}
-		if err != nil {
-			return lastHead, lastSafeHead, didReorg, fmt.Errorf("failed to extend L2 chain at block %d/%d of epoch %d: %w", i, len(batches), epoch, err)
+		if counted {
+			return false
 		}
-
-		newLast, err := derive.BlockReferences(payload, &d.Config.Genesis)
-		if err != nil {
-			return lastHead, lastSafeHead, didReorg, fmt.Errorf("failed to derive block references: %w", err)
+		for _, pos := range positions[batch] {
+			if pos.L1 == last {
+				return true
+			}
 		}
-		if reorg {
-			didReorg = true
-		}
-		// If reorg or the L2 Head is not ahead of the safe head, bump the head block.
-		if reorg || lastHead.Hash == lastSafeHead.Hash {
-			lastHead = newLast
-		}
-		lastSafeHead = newLast
+		return false
+	}
+}
 
-		fc.HeadBlockHash = lastHead.Hash
-		fc.SafeBlockHash = lastSafeHead.Hash
+// batchInclusions returns the L1 positions of the items of batch data of a batch, identified by their transactions if known.
+func batchInclusions(positions []derive.L1DataPosition) []index.BatchInclusion {
+	out := make([]index.BatchInclusion, 0, len(positions))
+	for _, p := range positions {
+		out = append(out, index.BatchInclusion{L1: p.L1, Item: p.Item, Tx: p.Tx})
 	}
+	return out
+}
 
-	return lastHead, lastSafeHead, didReorg, nil
+// gasLimit returns the gas limit of the payload attributes of the system config, nil to leave it to the engine.
+func gasLimit(sysCfg rollup.SystemConfig) *l2.Uint64Quantity {
+	if sysCfg.GasLimit == 0 {
+		return nil
+	}
+	gasLimit := l2.Uint64Quantity(sysCfg.GasLimit)
+	return &gasLimit
 }
 
 // attributesMatchBlock checks if the L2 attributes pre-inputs match the output
@@ -219,6 +433,9 @@ func attributesMatchBlock(attrs *l2.PayloadAttributes, parentHash common.Hash, b
 	if attrs.Random != l2.Bytes32(block.MixDigest()) {
 		return fmt.Errorf("random field does not match. expected: %v. got: %v", attrs.Random, l2.Bytes32(block.MixDigest()))
 	}
+	if attrs.GasLimit != nil && uint64(*attrs.GasLimit) != block.GasLimit() {
+		return fmt.Errorf("gas limit does not match. expected: %v. got: %v", uint64(*attrs.GasLimit), block.GasLimit())
+	}
 	if len(attrs.Transactions) != len(block.Transactions()) {
 		return fmt.Errorf("transaction count does not match. expected: %v. got: %v", len(attrs.Transactions), len(block.Transactions()))
 	}
@@ -239,7 +456,9 @@ func attributesMatchBlock(attrs *l2.PayloadAttributes, parentHash common.Hash, b
 
 // verifySafeBlock reconciles the supplied payload attributes against the actual L2 block.
 // If they do not match, it inserts the new block and sets the head and safe head to the new block in the FC.
-func (d *outputImpl) verifySafeBlock(ctx context.Context, fc l2.ForkchoiceState, attrs *l2.PayloadAttributes, parent eth.BlockID) (derive.Block, bool, error) {
+func (d *outputImpl) verifySafeBlock(ctx context.Context, fc l2.ForkchoiceState, attrs *l2.PayloadAttributes, parent eth.BlockID) (_ derive.Block, _ bool, err error) {
+	ctx, span := tracer.Start(ctx, "engine_verify", trace.WithAttributes(attribute.Int64("l2.number", int64(parent.Number+1))))
+	defer func() { tracing.End(span, err) }()
 	block, err := d.l2.BlockByNumber(ctx, new(big.Int).SetUint64(parent.Number+1))
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to get L2 block: %w", err)
@@ -250,7 +469,7 @@ func (d *outputImpl) verifySafeBlock(ctx context.Context, fc l2.ForkchoiceState,
 		d.log.Warn("Detected L2 reorg when verifying L2 safe head", "parent", parent, "prev_block", block.Hash(), "mismatch", err)
 		fc.HeadBlockHash = parent.Hash
 		fc.SafeBlockHash = parent.Hash
-		payload, err := d.insertHeadBlock(ctx, fc, attrs, true)
+		payload, err := d.insertHeadBlock(ctx, fc, attrs, true, 0)
 		return payload, true, err
 	}
 	// If match, just bump the safe head
@@ -268,7 +487,27 @@ func (d *outputImpl) verifySafeBlock(ctx context.Context, fc l2.ForkchoiceState,
 // It first uses the given FC to start the block creation process and then after the payload is executed,
 // sets the FC to the same safe and finalized hashes, but updates the head hash to the new block.
 // If updateSafe is true, the head block is considered to be the safe head as well as the head.
-func (d *outputImpl) insertHeadBlock(ctx context.Context, fc l2.ForkchoiceState, attrs *l2.PayloadAttributes, updateSafe bool) (*l2.ExecutionPayload, error) {
+func (d *outputImpl) insertHeadBlock(ctx context.Context, fc l2.ForkchoiceState, attrs *l2.PayloadAttributes, updateSafe bool, buildTime time.Duration) (_ *l2.ExecutionPayload, err error) {
+	ctx, span := tracer.Start(ctx, "engine_insert", trace.WithAttributes(
+		attribute.Int("txs", len(attrs.Transactions)),
+		attribute.Bool("update_safe", updateSafe),
+	))
+	defer func() { tracing.End(span, err) }()
+	payload, err := d.buildPayload(ctx, fc, attrs, buildTime)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("l2.number", int64(payload.BlockNumber)), attribute.String("l2.hash", payload.BlockHash.String()))
+	if err := d.importPayload(ctx, fc, payload, updateSafe); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// buildPayload starts the creation of a block with the given FC and attributes, and fetches the payload from the engine
+// once the engine had the build time to include the transactions of its tx pool.
+func (d *outputImpl) buildPayload(ctx context.Context, fc l2.ForkchoiceState, attrs *l2.PayloadAttributes, buildTime time.Duration) (*l2.ExecutionPayload, error) {
+	start := time.Now()
 	fcRes, err := d.l2.ForkchoiceUpdate(ctx, &fc, attrs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new block via forkchoice: %w", err)
@@ -277,22 +516,49 @@ func (d *outputImpl) insertHeadBlock(ctx context.Context, fc l2.ForkchoiceState,
 	if id == nil {
 		return nil, errors.New("nil id in forkchoice result when expecting a valid ID")
 	}
+	// give the engine the time to include transactions of its tx pool, before fetching the payload
+	deadline := start.Add(buildTime)
+	if wait := time.Until(deadline); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to wait for the engine to build the payload: %w", ctx.Err())
+		}
+	}
 	payload, err := d.l2.GetPayload(ctx, *id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get execution payload: %w", err)
 	}
-	err = d.l2.ExecutePayload(ctx, payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert execution payload: %w", err)
+	if buildTime > 0 {
+		d.recordPayloadBuild(start, deadline, payload)
+	}
+	return payload, nil
+}
+
+// importPayload executes the payload, and makes it the head block by updating the FC.
+// If updateSafe is true, the block is made the safe head as well.
+func (d *outputImpl) importPayload(ctx context.Context, fc l2.ForkchoiceState, payload *l2.ExecutionPayload, updateSafe bool) error {
+	if err := d.l2.ExecutePayload(ctx, payload); err != nil {
+		return fmt.Errorf("failed to insert execution payload: %w", err)
 	}
 	fc.HeadBlockHash = payload.BlockHash
 	if updateSafe {
 		fc.SafeBlockHash = payload.BlockHash
 	}
 	d.log.Debug("Inserted L2 head block", "number", uint64(payload.BlockNumber), "hash", payload.BlockHash, "update_safe", updateSafe)
-	_, err = d.l2.ForkchoiceUpdate(ctx, &fc, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make the new L2 block canonical via forkchoice: %w", err)
+	if _, err := d.l2.ForkchoiceUpdate(ctx, &fc, nil); err != nil {
+		return fmt.Errorf("failed to make the new L2 block canonical via forkchoice: %w", err)
+	}
+	return nil
+}
+
+// recordPayloadBuild records the time that the engine took to build a sequenced payload, and reports the engine
+// if it was the bottleneck: if the payload was delivered well past the deadline of the payload build time.
+func (d *outputImpl) recordPayloadBuild(start time.Time, deadline time.Time, payload *l2.ExecutionPayload) {
+	metrics.GetOrRegisterTimer("driver/payload_build", nil).UpdateSince(start)
+	if overrun := time.Since(deadline); overrun > slowPayloadThreshold {
+		metrics.GetOrRegisterCounter("driver/payload_build/overrun", nil).Inc(1)
+		d.log.Warn("Engine was slow to build the payload", "number", uint64(payload.BlockNumber), "overrun", overrun,
+			"build_time", time.Since(start), "budget", deadline.Sub(start))
 	}
-	return payload, nil
 }
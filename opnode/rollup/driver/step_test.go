@@ -0,0 +1,114 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/sync"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// buildingEngine records when the block building starts, and when the payload is fetched
+type buildingEngine struct {
+	Engine
+	started time.Time
+	fetched time.Time
+}
+
+func (m *buildingEngine) ForkchoiceUpdate(ctx context.Context, state *l2.ForkchoiceState, attr *l2.PayloadAttributes) (*l2.ForkchoiceUpdatedResult, error) {
+	if attr != nil {
+		m.started = time.Now()
+		return &l2.ForkchoiceUpdatedResult{PayloadID: &l2.PayloadID{1}}, nil
+	}
+	return &l2.ForkchoiceUpdatedResult{}, nil
+}
+
+func (m *buildingEngine) GetPayload(ctx context.Context, payloadId l2.PayloadID) (*l2.ExecutionPayload, error) {
+	m.fetched = time.Now()
+	return &l2.ExecutionPayload{}, nil
+}
+
+func (m *buildingEngine) ExecutePayload(ctx context.Context, payload *l2.ExecutionPayload) error {
+	return nil
+}
+
+func TestInsertHeadBlockBuildTime(t *testing.T) {
+	engine := &buildingEngine{}
+	d := &outputImpl{l2: engine, log: testlog.Logger(t, log.LvlError)}
+
+	_, err := d.insertHeadBlock(context.Background(), l2.ForkchoiceState{}, &l2.PayloadAttributes{}, false, 50*time.Millisecond)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, engine.fetched.Sub(engine.started), 50*time.Millisecond, "the engine gets the build time")
+
+	_, err = d.insertHeadBlock(context.Background(), l2.ForkchoiceState{}, &l2.PayloadAttributes{}, true, 0)
+	require.NoError(t, err)
+	require.Less(t, engine.fetched.Sub(engine.started), 50*time.Millisecond, "the payload is fetched right away")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = d.insertHeadBlock(ctx, l2.ForkchoiceState{}, &l2.PayloadAttributes{}, false, time.Second)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRecordInclusionLatency(t *testing.T) {
+	now := uint64(time.Now().Unix())
+	window := []eth.L1BlockRef{
+		{Hash: common.Hash{1}, Number: 1, Time: now - 60},
+		{Hash: common.Hash{2}, Number: 2, Time: now - 48},
+		{Hash: common.Hash{3}, Number: 3, Time: now - 36},
+	}
+	var ids []eth.BlockID
+	for _, b := range window {
+		ids = append(ids, b.ID())
+	}
+	dl := &receiptsDownloader{blocks: window}
+	progress := sync.NewProgressTracker(3, time.Minute)
+	d := &outputImpl{dl: dl, log: testlog.Logger(t, log.LvlError), progress: progress}
+	latency := func() time.Duration {
+		return progress.Progress(time.Now(), eth.L1BlockRef{}, eth.L2BlockRef{}).InclusionLatency.Last
+	}
+	l1Times := make(map[common.Hash]uint64)
+
+	// the block is derivable once the last of its batch data is included
+	d.recordInclusionLatency(context.Background(), ids, []index.BatchInclusion{{L1: ids[1]}, {L1: ids[0]}}, l1Times)
+	require.InDelta(t, 48*time.Second, latency(), float64(2*time.Second))
+	// a block without batch data is derivable once the sequencing window is complete
+	d.recordInclusionLatency(context.Background(), ids, nil, l1Times)
+	require.InDelta(t, 36*time.Second, latency(), float64(2*time.Second))
+	require.Len(t, l1Times, 2)
+
+	// the L1 times of the epoch are only fetched once
+	dl.blocks = nil
+	d.recordInclusionLatency(context.Background(), ids, []index.BatchInclusion{{L1: ids[1]}}, l1Times)
+	require.InDelta(t, 48*time.Second, latency(), float64(2*time.Second))
+	require.Equal(t, 3, progress.Progress(time.Now(), eth.L1BlockRef{}, eth.L2BlockRef{}).InclusionLatency.Count)
+}
+
+func TestCountBatch(t *testing.T) {
+	window := []eth.BlockID{fakeID('a', 1), fakeID('b', 2), fakeID('c', 3)}
+	old, fresh := &derive.BatchData{}, &derive.BatchData{}
+	positions := map[*derive.BatchData][]derive.L1DataPosition{
+		old:   {{L1: window[0]}},
+		fresh: {{L1: window[1]}, {L1: window[2]}},
+	}
+	d := &outputImpl{}
+	count := d.countBatch(1, window, positions)
+	require.True(t, count(old), "the first epoch counts all its batches")
+	d.countedEpoch = 1
+
+	count = d.countBatch(2, window, positions)
+	require.False(t, count(old), "counted with a previous window")
+	require.True(t, count(fresh), "completed by the last L1 block of the window")
+	d.countedEpoch = 2
+
+	count = d.countBatch(2, window, positions)
+	require.False(t, count(fresh), "an epoch that is derived again is not counted again")
+}
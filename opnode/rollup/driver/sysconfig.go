@@ -0,0 +1,129 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// systemConfigCacheSize is the number of L1 blocks to cache the system config of.
+const systemConfigCacheSize = 1000
+
+// systemConfigs tracks the system config after each L1 block: the system config of the parent L1 block,
+// with the updates of the system config contract in the L1 block applied.
+// The system config of an epoch is the system config after its L1 origin, so that an update applies
+// at the start of the epoch of the L1 block it is included in, on every node alike.
+type systemConfigs struct {
+	cfg   *rollup.Config
+	dl    Downloader
+	log   log.Logger
+	cache *lru.Cache // common.Hash -> rollup.SystemConfig
+	// idx persists the system configs across restarts, so that the lookups after a restart only walk back to
+	// the last L1 block with a system config in the index. Optional: without it, or with an in-memory index,
+	// the first lookup after a restart walks back to the L1 genesis.
+	idx *index.DB
+}
+
+// newSystemConfigs creates the system configs, with the cache seeded with the genesis system config.
+// The system configs are safe for concurrent use.
+func newSystemConfigs(cfg *rollup.Config, dl Downloader, log log.Logger, idx *index.DB) *systemConfigs {
+	cache, _ := lru.New(systemConfigCacheSize)
+	cache.Add(cfg.Genesis.L1.Hash, cfg.GenesisSystemConfig())
+	return &systemConfigs{cfg: cfg, dl: dl, log: log, cache: cache, idx: idx}
+}
+
+func (sc *systemConfigs) get(hash common.Hash) (rollup.SystemConfig, bool) {
+	if v, ok := sc.cache.Get(hash); ok {
+		return v.(rollup.SystemConfig), true
+	}
+	if sc.idx == nil {
+		return rollup.SystemConfig{}, false
+	}
+	sysCfg, err := sc.idx.SystemConfig(hash)
+	if err != nil {
+		if !errors.Is(err, ethereum.NotFound) {
+			sc.log.Warn("Failed to read system config from the index", "l1", hash, "err", err)
+		}
+		return rollup.SystemConfig{}, false
+	}
+	sc.cache.Add(hash, sysCfg)
+	return sysCfg, true
+}
+
+func (sc *systemConfigs) put(hash common.Hash, sysCfg rollup.SystemConfig) {
+	sc.cache.Add(hash, sysCfg)
+	if sc.idx != nil {
+		if err := sc.idx.PutSystemConfig(hash, sysCfg); err != nil {
+			sc.log.Warn("Failed to persist system config", "l1", hash, "err", err)
+		}
+	}
+}
+
+// at returns the system config after the given L1 block. The L1 chain is walked back to the first ancestor
+// with a known system config, in the cache or the index, up to the L1 genesis, and the system config updates since
+// are applied.
+func (sc *systemConfigs) at(ctx context.Context, l1 eth.BlockID) (rollup.SystemConfig, error) {
+	if sc.cfg.SystemConfigAddress == (common.Address{}) || l1.Number <= sc.cfg.Genesis.L1.Number {
+		return sc.cfg.GenesisSystemConfig(), nil
+	}
+	// Walk back to the first L1 block with a known system config
+	var path []derive.L1Info
+	sysCfg := sc.cfg.GenesisSystemConfig()
+	for hash := l1.Hash; ; {
+		if known, ok := sc.get(hash); ok {
+			sysCfg = known
+			break
+		}
+		info, err := sc.dl.InfoByHash(ctx, hash)
+		if err != nil {
+			return rollup.SystemConfig{}, fmt.Errorf("failed to fetch L1 block %s for its system config: %w", hash, err)
+		}
+		if info.NumberU64() <= sc.cfg.Genesis.L1.Number {
+			break
+		}
+		path = append(path, info)
+		hash = info.ParentHash()
+	}
+	if len(path) > systemConfigCacheSize {
+		sc.log.Info("Applying system config updates of L1 blocks without a known system config", "blocks", len(path), "l1", l1)
+	}
+	// Apply the updates of each L1 block on the path
+	for i := len(path) - 1; i >= 0; i-- {
+		info := path[i]
+		if sc.mayHaveUpdates(info) {
+			_, _, receipts, err := sc.dl.Fetch(ctx, info.Hash())
+			if err != nil {
+				return rollup.SystemConfig{}, fmt.Errorf("failed to fetch receipts of L1 block %s for its system config: %w", info.ID(), err)
+			}
+			if err := derive.UpdateSystemConfigWithL1Receipts(&sysCfg, receipts, sc.cfg); err != nil {
+				sc.log.Warn("Ignoring malformed system config update", "l1", info.ID(), "err", err)
+			}
+		}
+		sc.put(info.Hash(), sysCfg)
+	}
+	return sysCfg, nil
+}
+
+// mayHaveUpdates checks the bloom filter of the L1 block, if available, for logs of the system config contract.
+func (sc *systemConfigs) mayHaveUpdates(info derive.L1Info) bool {
+	if b, ok := info.(interface{ Bloom() types.Bloom }); ok {
+		bloom := b.Bloom()
+		return bloom.Test(sc.cfg.SystemConfigAddress[:]) && bloom.Test(derive.ConfigUpdateEventABIHash[:])
+	}
+	return true
+}
+
+// systemConfig returns the system config of the epoch of the given L1 origin.
+func (d *outputImpl) systemConfig(ctx context.Context, l1Origin eth.BlockID) (rollup.SystemConfig, error) {
+	return d.sysCfgs.at(ctx, l1Origin)
+}
@@ -0,0 +1,92 @@
+package driver
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/index"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+// receiptsDownloader serves L1 blocks with the given receipts.
+type receiptsDownloader struct {
+	Downloader
+	blocks   []eth.L1BlockRef
+	receipts map[common.Hash]types.Receipts
+	fetches  int
+}
+
+func (m *receiptsDownloader) InfoByHash(ctx context.Context, hash common.Hash) (derive.L1Info, error) {
+	for _, b := range m.blocks {
+		if b.Hash == hash {
+			return fakeL1Info{b}, nil
+		}
+	}
+	return nil, ethereum.NotFound
+}
+
+func (m *receiptsDownloader) Fetch(ctx context.Context, hash common.Hash) (derive.L1Info, types.Transactions, types.Receipts, error) {
+	m.fetches++
+	info, err := m.InfoByHash(ctx, hash)
+	return info, nil, m.receipts[hash], err
+}
+
+func TestSystemConfigs(t *testing.T) {
+	l1 := chainL1(0, "abcde")
+	cfg := &rollup.Config{
+		Genesis:             rollup.Genesis{L1: l1[0].ID()},
+		BatchSenderAddress:  common.Address{0xba},
+		SystemConfigAddress: common.Address{0x5c},
+	}
+	batcher := common.Address{0xbb}
+	data := make([]byte, 96)
+	data[31] = 32
+	data[63] = 32
+	copy(data[64+12:], batcher[:])
+	update := &types.Log{
+		Address: cfg.SystemConfigAddress,
+		Topics:  []common.Hash{derive.ConfigUpdateEventABIHash, derive.ConfigUpdateEventVersion, common.BigToHash(big.NewInt(derive.SystemConfigUpdateBatcher))},
+		Data:    data,
+	}
+	dl := &receiptsDownloader{blocks: l1, receipts: map[common.Hash]types.Receipts{
+		l1[2].Hash: {{Status: types.ReceiptStatusSuccessful, Logs: []*types.Log{update}}},
+	}}
+	idx, err := index.Open("")
+	require.NoError(t, err)
+	defer idx.Close()
+	logger := testlog.Logger(t, log.LvlError)
+	sc := newSystemConfigs(cfg, dl, logger, idx)
+
+	ctx := context.Background()
+	sysCfg, err := sc.at(ctx, l1[1].ID())
+	require.NoError(t, err)
+	require.Equal(t, cfg.GenesisSystemConfig(), sysCfg, "no updates yet")
+	sysCfg, err = sc.at(ctx, l1[2].ID())
+	require.NoError(t, err)
+	require.Equal(t, batcher, sysCfg.BatcherAddr, "update applies to the epoch of its L1 block")
+	sysCfg, err = sc.at(ctx, l1[4].ID())
+	require.NoError(t, err)
+	require.Equal(t, batcher, sysCfg.BatcherAddr)
+	require.Equal(t, 4, dl.fetches, "receipts of each L1 block are fetched once")
+
+	// The system configs are persisted in the index
+	sc = newSystemConfigs(cfg, &receiptsDownloader{}, logger, idx)
+	sysCfg, err = sc.at(ctx, l1[3].ID())
+	require.NoError(t, err)
+	require.Equal(t, batcher, sysCfg.BatcherAddr)
+
+	// Without a system config contract, the system config stays the genesis system config
+	sc = newSystemConfigs(&rollup.Config{BatchSenderAddress: common.Address{0xba}}, &receiptsDownloader{}, logger, nil)
+	sysCfg, err = sc.at(ctx, l1[4].ID())
+	require.NoError(t, err)
+	require.Equal(t, common.Address{0xba}, sysCfg.BatcherAddr)
+}
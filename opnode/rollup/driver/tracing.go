@@ -0,0 +1,24 @@
+package driver
+
+import (
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracer traces the stages of the derivation and the sequencing of the L2 blocks, see the tracing package.
+var tracer = otel.Tracer("github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver")
+
+func l1Attributes(ref eth.L1BlockRef) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int64("l1.number", int64(ref.Number)),
+		attribute.String("l1.hash", ref.Hash.String()),
+	}
+}
+
+func l2Attributes(ref eth.L2BlockRef) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int64("l2.number", int64(ref.Number)),
+		attribute.String("l2.hash", ref.Hash.String()),
+	}
+}
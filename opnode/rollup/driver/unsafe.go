@@ -0,0 +1,125 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// unsafeChainChecker is implemented by outputs that can validate the unsafe L2 blocks after the safe head.
+type unsafeChainChecker interface {
+	// checkUnsafeChain returns the last valid block of the unsafe chain from the safe head up to the unsafe head.
+	checkUnsafeChain(ctx context.Context, safeHead eth.L2BlockRef, unsafeHead eth.L2BlockRef) (eth.L2BlockRef, error)
+}
+
+// checkUnsafeChain checks the L1 info deposit of each unsafe block against its L1 origin,
+// and returns the parent of the first block with an invalid L1 info deposit, or the unsafe head if all blocks are valid.
+func (d *outputImpl) checkUnsafeChain(ctx context.Context, safeHead eth.L2BlockRef, unsafeHead eth.L2BlockRef) (eth.L2BlockRef, error) {
+	var blocks []*types.Block
+	for hash := unsafeHead.Hash; hash != safeHead.Hash; {
+		block, err := d.l2.BlockByHash(ctx, hash)
+		if err != nil {
+			return safeHead, fmt.Errorf("failed to fetch unsafe L2 block %s: %w", hash, err)
+		}
+		if block.NumberU64() <= safeHead.Number {
+			return safeHead, fmt.Errorf("unsafe head %s does not extend safe head %s", unsafeHead, safeHead)
+		}
+		blocks = append(blocks, block)
+		hash = block.ParentHash()
+	}
+	parent := safeHead
+	for i := len(blocks) - 1; i >= 0; i-- {
+		ref, err := d.checkUnsafeBlock(ctx, parent, blocks[i])
+		var invalid *invalidUnsafeBlockError
+		if errors.As(err, &invalid) {
+			d.log.Warn("Invalid unsafe L2 block", "block", blocks[i].Hash(), "number", blocks[i].NumberU64(), "err", err)
+			return parent, nil
+		} else if err != nil {
+			return safeHead, err
+		}
+		parent = ref
+	}
+	return parent, nil
+}
+
+type invalidUnsafeBlockError struct {
+	err error
+}
+
+func (e *invalidUnsafeBlockError) Error() string { return e.err.Error() }
+func (e *invalidUnsafeBlockError) Unwrap() error { return e.err }
+
+// checkUnsafeBlock checks that the block follows its parent by the consensus rules: the parent linkage,
+// the timestamp schedule and the L1 origin, which must be a known L1 block that is matched by the L1 info deposit.
+// It returns an invalidUnsafeBlockError if the block is invalid, and other errors if the block could not be checked.
+func (d *outputImpl) checkUnsafeBlock(ctx context.Context, parent eth.L2BlockRef, block derive.Block) (eth.L2BlockRef, error) {
+	ref, err := derive.BlockReferences(block, &d.Config.Genesis)
+	if err != nil {
+		return ref, &invalidUnsafeBlockError{err}
+	}
+	if err := derive.CheckNextBlock(&d.Config, parent, ref); err != nil {
+		return ref, &invalidUnsafeBlockError{err}
+	}
+	l1Info, err := d.dl.InfoByHash(ctx, ref.L1Origin.Hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return ref, &invalidUnsafeBlockError{fmt.Errorf("unknown L1 origin %s", ref.L1Origin)}
+	} else if err != nil {
+		return ref, fmt.Errorf("failed to fetch L1 origin %s: %w", ref.L1Origin, err)
+	}
+	if ref.L1Origin != parent.L1Origin && l1Info.ParentHash() != parent.L1Origin.Hash {
+		return ref, &invalidUnsafeBlockError{fmt.Errorf("L1 origin %s is not a child of the L1 origin %s of the parent", ref.L1Origin, parent.L1Origin)}
+	}
+	// The first block of an epoch is allowed past the drift, like the deposit-only blocks of derivation.
+	if ref.SequenceNumber > 0 && ref.Time > l1Info.Time()+d.Config.MaxSequencerDrift {
+		return ref, &invalidUnsafeBlockError{fmt.Errorf("block time %d is more than the max sequencer drift past the time %d of L1 origin %s",
+			ref.Time, l1Info.Time(), ref.L1Origin)}
+	}
+	sysCfg, err := d.systemConfig(ctx, ref.L1Origin)
+	if err != nil {
+		return ref, fmt.Errorf("failed to get system config of L1 origin %s: %w", ref.L1Origin, err)
+	}
+	if err := derive.CheckL1InfoDeposit(block.Transactions()[0], ref.Number, ref.SequenceNumber, l1Info, sysCfg); err != nil {
+		return ref, &invalidUnsafeBlockError{err}
+	}
+	return ref, nil
+}
+
+// unsafePayloadInserter is implemented by outputs that can insert unsafe L2 payloads, e.g. received from the sequencer.
+type unsafePayloadInserter interface {
+	// insertUnsafePayload validates and executes the payload, which extends the parent, and makes it the unsafe head of the engine.
+	// It returns an invalidUnsafeBlockError if the payload is invalid.
+	insertUnsafePayload(ctx context.Context, parent eth.L2BlockRef, payload *l2.ExecutionPayload, l2SafeHead eth.BlockID, l2Finalized eth.BlockID) (eth.L2BlockRef, error)
+}
+
+// insertUnsafePayload checks that the payload follows the parent by the consensus rules, executes the payload
+// on the engine, and makes it the new unsafe head with a forkchoice update.
+// It returns an invalidUnsafeBlockError if the payload is invalid.
+func (d *outputImpl) insertUnsafePayload(ctx context.Context, parent eth.L2BlockRef, payload *l2.ExecutionPayload, l2SafeHead eth.BlockID, l2Finalized eth.BlockID) (eth.L2BlockRef, error) {
+	if err := payload.CheckBlockHash(); err != nil {
+		return eth.L2BlockRef{}, &invalidUnsafeBlockError{err}
+	}
+	ref, err := d.checkUnsafeBlock(ctx, parent, payload)
+	if err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("unsafe payload %s: %w", payload.ID(), err)
+	}
+	if err := d.l2.ExecutePayload(ctx, payload); errors.Is(err, l2.ErrPayloadInvalid) {
+		return eth.L2BlockRef{}, &invalidUnsafeBlockError{err}
+	} else if err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("failed to insert unsafe payload %s: %w", payload.ID(), err)
+	}
+	fc := l2.ForkchoiceState{
+		HeadBlockHash:      payload.BlockHash,
+		SafeBlockHash:      l2SafeHead.Hash,
+		FinalizedBlockHash: l2Finalized.Hash,
+	}
+	if _, err := d.l2.ForkchoiceUpdate(ctx, &fc, nil); err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("failed to make unsafe payload %s the L2 head via forkchoice: %w", payload.ID(), err)
+	}
+	return ref, nil
+}
@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckUnsafeChain(t *testing.T) {
+	chain, output, head := newVerifyTestChain(t)
+	genesis, err := derive.BlockReferences(chain.l2[0], &output.Config.Genesis)
+	require.NoError(t, err)
+
+	valid, err := output.checkUnsafeChain(context.Background(), genesis, head)
+	require.NoError(t, err)
+	require.Equal(t, head, valid, "all blocks are valid")
+
+	// A block with the L1 info of the wrong sequence number
+	orig := chain.l2[5]
+	parent, err := derive.BlockReferences(chain.l2[4], &output.Config.Genesis)
+	require.NoError(t, err)
+	l1Info, err := chain.l1Info(parent.L1Origin.Hash)
+	require.NoError(t, err)
+	txs := append(types.Transactions{types.NewTx(derive.L1InfoDeposit(orig.NumberU64(), parent.SequenceNumber+5, l1Info, rollup.SystemConfig{}))}, orig.Transactions()[1:]...)
+	header := orig.Header()
+	header.Extra = []byte("invalid") // a different block hash
+	invalid := types.NewBlockWithHeader(header).WithBody(txs, nil)
+	chain.l2 = append(chain.l2, invalid)
+	invalidRef, err := derive.BlockReferences(invalid, &output.Config.Genesis)
+	require.NoError(t, err)
+
+	valid, err = output.checkUnsafeChain(context.Background(), genesis, invalidRef)
+	require.NoError(t, err)
+	require.Equal(t, parent, valid, "unsafe chain ends before the invalid block")
+}
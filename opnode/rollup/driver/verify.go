@@ -0,0 +1,254 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l1"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// DivergenceError describes the first canonical L2 block of the engine that does not match the L2 chain derived from L1.
+type DivergenceError struct {
+	Parent eth.L2BlockRef // last L2 block that matches
+	Block  eth.BlockID    // canonical L2 block of the engine on top of Parent
+	Epoch  rollup.Epoch   // epoch that the block was derived from
+	Reason error
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("L2 block %s does not match the block derived from epoch %d on top of %s: %v", e.Block, e.Epoch, e.Parent, e.Reason)
+}
+
+func (e *DivergenceError) Unwrap() error {
+	return e.Reason
+}
+
+// Verifier re-derives the L2 chain from L1, and compares it against the canonical L2 chain of the engine.
+type Verifier struct {
+	log    log.Logger
+	l1     L1Chain
+	output *outputImpl
+}
+
+func NewVerifier(cfg rollup.Config, l2 *l2.Source, l1 *l1.Source, log log.Logger) *Verifier {
+	output := &outputImpl{
+		Config: cfg,
+		dl:     l1,
+		l2:     l2,
+		log:    log,
+	}
+	output.sysCfgs = newSystemConfigs(&output.Config, l1, log, nil)
+	return &Verifier{log: log, l1: l1, output: output}
+}
+
+// Verify re-derives the L2 chain from the epoch of the given L1 block number, and compares every derived block
+// against the canonical chain of the engine. The derived blocks are not inserted into the engine:
+// a block matches if the engine block has the same parent and the same inputs (timestamp, random and transactions),
+// the engine executed it to the same block hash.
+// Verification stops at the head of the engine, or at the last epoch with a complete sequencing window on L1.
+// It returns the last verified L2 block, or a DivergenceError for the first block that does not match.
+func (v *Verifier) Verify(ctx context.Context, fromL1 uint64) (eth.L2BlockRef, error) {
+	parent, err := v.startBlock(ctx, fromL1)
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	v.log.Info("Verifying L2 chain", "from_l1", fromL1, "parent", parent)
+	for {
+		epoch, attrs, err := v.deriveEpoch(ctx, parent)
+		if errors.Is(err, errIncompleteWindow) {
+			v.log.Info("Reached the end of the L1 chain", "verified", parent)
+			return parent, nil
+		} else if err != nil {
+			return parent, err
+		}
+		for _, a := range attrs {
+			block, err := v.output.l2.BlockByNumber(ctx, new(big.Int).SetUint64(parent.Number+1))
+			if errors.Is(err, ethereum.NotFound) {
+				v.log.Info("Reached the head of the engine", "verified", parent)
+				return parent, nil
+			} else if err != nil {
+				return parent, fmt.Errorf("failed to fetch L2 block %d: %w", parent.Number+1, err)
+			}
+			if err := attributesMatchBlock(a, parent.Hash, block); err != nil {
+				return parent, &DivergenceError{
+					Parent: parent,
+					Block:  eth.BlockID{Hash: block.Hash(), Number: block.NumberU64()},
+					Epoch:  epoch,
+					Reason: err,
+				}
+			}
+			parent, err = derive.BlockReferences(block, &v.output.Config.Genesis)
+			if err != nil {
+				return parent, fmt.Errorf("failed to derive block references: %w", err)
+			}
+		}
+		v.log.Debug("Verified epoch", "epoch", epoch, "l2", parent)
+	}
+}
+
+// errIncompleteWindow is returned when the sequencing window of the next epoch is not complete on L1 yet.
+var errIncompleteWindow = errors.New("sequencing window is not complete on L1")
+
+// deriveEpoch derives the attributes of the L2 blocks of the epoch after the L1 origin of the parent block.
+func (v *Verifier) deriveEpoch(ctx context.Context, parent eth.L2BlockRef) (rollup.Epoch, []*l2.PayloadAttributes, error) {
+	seqWindowSize := v.output.Config.SeqWindowSize
+	window, err := v.l1.L1Range(ctx, parent.L1Origin, seqWindowSize)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to fetch sequencing window after %s: %w", parent.L1Origin, err)
+	}
+	if uint64(len(window)) < seqWindowSize {
+		return 0, nil, errIncompleteWindow
+	}
+	epoch := rollup.Epoch(window[0].Number)
+	attrs, _, err := v.output.epochAttributes(ctx, parent, window, v.log)
+	if err != nil {
+		return epoch, nil, fmt.Errorf("failed to derive epoch %d: %w", epoch, err)
+	}
+	return epoch, attrs, nil
+}
+
+// DerivedBlock is an L2 block derived again from L1, next to the canonical L2 block of the engine with the same number.
+type DerivedBlock struct {
+	// Epoch is the L1 block that the block is derived from
+	Epoch rollup.Epoch `json:"epoch"`
+	// Parent is the canonical L2 block that the block is derived on top of
+	Parent eth.L2BlockRef `json:"parent"`
+	// Attributes are the derived inputs of the block
+	Attributes *l2.PayloadAttributes `json:"attributes"`
+	// Canonical is the canonical L2 block of the engine
+	Canonical eth.L2BlockRef `json:"canonical"`
+	// Differences lists the fields of the canonical block that do not match the derived attributes, empty if it matches
+	Differences []string `json:"differences"`
+}
+
+// DeriveBlock derives the L2 block with the given number again, from the L1 data of its epoch and on top of
+// the canonical L2 chain before the epoch, and compares it with the canonical block of the engine.
+// The derived block is not inserted into the engine.
+func (v *Verifier) DeriveBlock(ctx context.Context, num uint64) (*DerivedBlock, error) {
+	genesis := &v.output.Config.Genesis
+	if num <= genesis.L2.Number {
+		return nil, fmt.Errorf("L2 block %d is not derived from L1, the L2 chain starts at block %d", num, genesis.L2.Number)
+	}
+	target, err := v.l2BlockRef(ctx, new(big.Int).SetUint64(num))
+	if err != nil {
+		return nil, err
+	}
+	parent, err := v.startBlock(ctx, target.L1Origin.Number)
+	if err != nil {
+		return nil, err
+	}
+	for parent.L1Origin.Number < target.L1Origin.Number {
+		epoch, attrs, err := v.deriveEpoch(ctx, parent)
+		if errors.Is(err, errIncompleteWindow) {
+			return nil, fmt.Errorf("cannot derive L2 block %d yet: %w", num, err)
+		} else if err != nil {
+			return nil, err
+		}
+		// the blocks before the target are the canonical blocks, even if they do not match the derived attributes
+		for _, a := range attrs {
+			if parent.Number+1 == num {
+				block, err := v.output.l2.BlockByNumber(ctx, new(big.Int).SetUint64(num))
+				if err != nil {
+					return nil, fmt.Errorf("failed to fetch L2 block %d: %w", num, err)
+				}
+				return &DerivedBlock{
+					Epoch:       epoch,
+					Parent:      parent,
+					Attributes:  a,
+					Canonical:   target,
+					Differences: attributesDiff(a, parent.Hash, block),
+				}, nil
+			}
+			if parent, err = v.l2BlockRef(ctx, new(big.Int).SetUint64(parent.Number+1)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("L2 block %d is not derived from its L1 origin %s: the epoch has fewer blocks", num, target.L1Origin)
+}
+
+// attributesDiff lists all the fields of the block that do not match the attributes, see attributesMatchBlock.
+func attributesDiff(attrs *l2.PayloadAttributes, parentHash common.Hash, block *types.Block) []string {
+	diff := []string{}
+	add := func(field string, expected, got interface{}) {
+		diff = append(diff, fmt.Sprintf("%s: derived %v, canonical %v", field, expected, got))
+	}
+	if parentHash != block.ParentHash() {
+		add("parent hash", parentHash, block.ParentHash())
+	}
+	if uint64(attrs.Timestamp) != block.Time() {
+		add("timestamp", uint64(attrs.Timestamp), block.Time())
+	}
+	if attrs.Random != l2.Bytes32(block.MixDigest()) {
+		add("random", attrs.Random, l2.Bytes32(block.MixDigest()))
+	}
+	if attrs.GasLimit != nil && uint64(*attrs.GasLimit) != block.GasLimit() {
+		add("gas limit", uint64(*attrs.GasLimit), block.GasLimit())
+	}
+	btxs := block.Transactions()
+	if len(attrs.Transactions) != len(btxs) {
+		add("transaction count", len(attrs.Transactions), len(btxs))
+	}
+	for i := 0; i < len(attrs.Transactions) && i < len(btxs); i++ {
+		var tx types.Transaction
+		if err := tx.UnmarshalBinary(attrs.Transactions[i]); err != nil {
+			diff = append(diff, fmt.Sprintf("transaction %d: cannot decode derived transaction: %v", i, err))
+		} else if tx.Hash() != btxs[i].Hash() {
+			add(fmt.Sprintf("transaction %d", i), tx.Hash(), btxs[i].Hash())
+		}
+	}
+	return diff
+}
+
+// startBlock returns the last canonical L2 block before the epoch of the given L1 block number:
+// the L1 origins of the L2 chain are increasing, the block is found with a binary search by number.
+func (v *Verifier) startBlock(ctx context.Context, fromL1 uint64) (eth.L2BlockRef, error) {
+	genesis := &v.output.Config.Genesis
+	lo, err := v.l2BlockRef(ctx, new(big.Int).SetUint64(genesis.L2.Number))
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	if fromL1 <= genesis.L1.Number+1 {
+		return lo, nil
+	}
+	head, err := v.l2BlockRef(ctx, nil)
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	if head.L1Origin.Number < fromL1 {
+		return eth.L2BlockRef{}, fmt.Errorf("L2 chain of the engine ends at L1 origin %d, before L1 block %d", head.L1Origin.Number, fromL1)
+	}
+	// Invariant: the L1 origin of lo is before fromL1, the L1 origin of hi is not.
+	hi := head
+	for hi.Number-lo.Number > 1 {
+		mid, err := v.l2BlockRef(ctx, new(big.Int).SetUint64(lo.Number+(hi.Number-lo.Number)/2))
+		if err != nil {
+			return eth.L2BlockRef{}, err
+		}
+		if mid.L1Origin.Number < fromL1 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// l2BlockRef fetches the canonical L2 block with the given number, or the head if nil.
+func (v *Verifier) l2BlockRef(ctx context.Context, num *big.Int) (eth.L2BlockRef, error) {
+	block, err := v.output.l2.BlockByNumber(ctx, num)
+	if err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("failed to fetch L2 block %v: %w", num, err)
+	}
+	return derive.BlockReferences(block, &v.output.Config.Genesis)
+}
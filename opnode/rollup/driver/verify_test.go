@@ -0,0 +1,182 @@
+package driver
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeL1Info struct {
+	ref eth.L1BlockRef
+}
+
+func (l fakeL1Info) Hash() common.Hash        { return l.ref.Hash }
+func (l fakeL1Info) ParentHash() common.Hash  { return l.ref.ParentHash }
+func (l fakeL1Info) Root() common.Hash        { return common.Hash{} }
+func (l fakeL1Info) NumberU64() uint64        { return l.ref.Number }
+func (l fakeL1Info) Time() uint64             { return l.ref.Time }
+func (l fakeL1Info) MixDigest() common.Hash   { return common.Hash{0xaa, byte(l.ref.Number)} }
+func (l fakeL1Info) BaseFee() *big.Int        { return big.NewInt(7) }
+func (l fakeL1Info) ID() eth.BlockID          { return l.ref.ID() }
+func (l fakeL1Info) BlockRef() eth.L1BlockRef { return l.ref }
+func (l fakeL1Info) ReceiptHash() common.Hash { return types.EmptyRootHash }
+
+// verifyTestChain serves a L1 chain without batches, and the canonical L2 chain of the engine.
+type verifyTestChain struct {
+	L1Chain
+	Downloader
+	Engine
+	l1 []eth.L1BlockRef
+	l2 []*types.Block
+}
+
+func (m *verifyTestChain) L1Range(ctx context.Context, base eth.BlockID, max uint64) (out []eth.BlockID, err error) {
+	for i := base.Number + 1; i < uint64(len(m.l1)) && uint64(len(out)) < max; i++ {
+		out = append(out, m.l1[i].ID())
+	}
+	return out, nil
+}
+
+func (m *verifyTestChain) l1Info(hash common.Hash) (derive.L1Info, error) {
+	for _, b := range m.l1 {
+		if b.Hash == hash {
+			return fakeL1Info{b}, nil
+		}
+	}
+	return nil, ethereum.NotFound
+}
+
+func (m *verifyTestChain) InfoByHash(ctx context.Context, hash common.Hash) (derive.L1Info, error) {
+	return m.l1Info(hash)
+}
+
+func (m *verifyTestChain) Fetch(ctx context.Context, hash common.Hash) (derive.L1Info, types.Transactions, types.Receipts, error) {
+	info, err := m.l1Info(hash)
+	return info, nil, nil, err
+}
+
+func (m *verifyTestChain) FetchAllTransactions(ctx context.Context, window []eth.BlockID) ([]types.Transactions, error) {
+	return make([]types.Transactions, len(window)), nil
+}
+
+func (m *verifyTestChain) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	for _, b := range m.l2 {
+		if b.Hash() == hash {
+			return b, nil
+		}
+	}
+	return nil, ethereum.NotFound
+}
+
+func (m *verifyTestChain) BlockByNumber(ctx context.Context, num *big.Int) (*types.Block, error) {
+	if num == nil {
+		return m.l2[len(m.l2)-1], nil
+	}
+	if num.Uint64() >= uint64(len(m.l2)) {
+		return nil, ethereum.NotFound
+	}
+	return m.l2[num.Uint64()], nil
+}
+
+// newVerifyTestChain builds a L1 chain without batches, and the engine chain from the attributes derived from it,
+// up to the last complete sequencing window.
+func newVerifyTestChain(t *testing.T) (*verifyTestChain, *outputImpl, eth.L2BlockRef) {
+	chain := &verifyTestChain{}
+	for i, id := range "abcdefgh" {
+		ref := fakeL1Block(id, id-1, uint64(i))
+		ref.Time = 100 + 4*uint64(i)
+		chain.l1 = append(chain.l1, ref)
+	}
+	genesisL2 := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Time: 100})
+	chain.l2 = []*types.Block{genesisL2}
+	cfg := rollup.Config{
+		Genesis:           rollup.Genesis{L1: chain.l1[0].ID(), L2: eth.BlockID{Hash: genesisL2.Hash()}, L2Time: 100},
+		BlockTime:         2,
+		MaxSequencerDrift: 10,
+		SeqWindowSize:     2,
+	}
+	logger := testlog.Logger(t, log.LvlError)
+	output := &outputImpl{Config: cfg, dl: chain, l2: chain, log: logger}
+	output.sysCfgs = newSystemConfigs(&output.Config, chain, logger, nil)
+
+	parent, err := derive.BlockReferences(genesisL2, &cfg.Genesis)
+	require.NoError(t, err)
+	for e := 1; e+int(cfg.SeqWindowSize) <= len(chain.l1); e++ {
+		attrs, _, err := output.epochAttributes(context.Background(), parent, []eth.BlockID{chain.l1[e].ID(), chain.l1[e+1].ID()}, logger)
+		require.NoError(t, err)
+		for _, a := range attrs {
+			var txs types.Transactions
+			for _, data := range a.Transactions {
+				var tx types.Transaction
+				require.NoError(t, tx.UnmarshalBinary(data))
+				txs = append(txs, &tx)
+			}
+			header := &types.Header{ParentHash: parent.Hash, Number: new(big.Int).SetUint64(parent.Number + 1), Time: uint64(a.Timestamp), MixDigest: common.Hash(a.Random)}
+			block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+			chain.l2 = append(chain.l2, block)
+			parent, err = derive.BlockReferences(block, &cfg.Genesis)
+			require.NoError(t, err)
+		}
+	}
+	return chain, output, parent
+}
+
+func TestVerifier(t *testing.T) {
+	chain, output, head := newVerifyTestChain(t)
+	v := &Verifier{log: output.log, l1: chain, output: output}
+
+	verified, err := v.Verify(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, head, verified, "full chain is verified")
+
+	start, err := v.startBlock(context.Background(), 4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), start.L1Origin.Number, "verification starts at the end of the previous epoch")
+	verified, err = v.Verify(context.Background(), 4)
+	require.NoError(t, err)
+	require.Equal(t, head, verified)
+
+	// The engine has a different block in the middle of the chain
+	tampered := chain.l2[5]
+	chain.l2[5] = types.NewBlockWithHeader(&types.Header{ParentHash: tampered.ParentHash(), Number: tampered.Number(), Time: tampered.Time() + 1}).WithBody(tampered.Transactions(), nil)
+	_, err = v.Verify(context.Background(), 0)
+	var divergence *DivergenceError
+	require.ErrorAs(t, err, &divergence)
+	require.Equal(t, chain.l2[4].Hash(), divergence.Parent.Hash, "reports the last matching block")
+	require.Equal(t, uint64(5), divergence.Block.Number)
+}
+
+func TestDeriveBlock(t *testing.T) {
+	chain, output, _ := newVerifyTestChain(t)
+	v := &Verifier{log: output.log, l1: chain, output: output}
+
+	derived, err := v.DeriveBlock(context.Background(), 5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), derived.Parent.Number)
+	require.Equal(t, chain.l2[5].Hash(), derived.Canonical.Hash)
+	require.Equal(t, rollup.Epoch(derived.Canonical.L1Origin.Number), derived.Epoch)
+	require.Equal(t, chain.l2[5].Time(), uint64(derived.Attributes.Timestamp))
+	require.Empty(t, derived.Differences)
+
+	// The engine has a different block
+	tampered := chain.l2[5]
+	chain.l2[5] = types.NewBlockWithHeader(&types.Header{ParentHash: tampered.ParentHash(), Number: tampered.Number(), Time: tampered.Time() + 1}).WithBody(tampered.Transactions(), nil)
+	derived, err = v.DeriveBlock(context.Background(), 5)
+	require.NoError(t, err)
+	require.Len(t, derived.Differences, 2, "timestamp and random")
+
+	_, err = v.DeriveBlock(context.Background(), 0)
+	require.Error(t, err, "genesis is not derived")
+	_, err = v.DeriveBlock(context.Background(), uint64(len(chain.l2)))
+	require.ErrorIs(t, err, ethereum.NotFound)
+}
@@ -0,0 +1,180 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/derive"
+)
+
+// walCompactRecords is the number of records after which the log is compacted to just the last record.
+const walCompactRecords = 1000
+
+// walRecord is the derivation progress at the time it was logged.
+type walRecord struct {
+	// SafeHead is the safe head after the last completed epoch.
+	SafeHead eth.L2BlockRef `json:"safeHead"`
+	// WindowEnd is the last L1 block of the sequencing window that the epoch of the safe head was derived from.
+	// It is zero if the safe head was not derived, e.g. after a reset of the chain.
+	WindowEnd eth.BlockID `json:"windowEnd"`
+	// L1Window is the buffered L1 blocks to derive the next epochs from, starting with the epoch after the safe head.
+	L1Window []eth.BlockID `json:"l1Window"`
+}
+
+// WAL is a log of the derivation progress, to resume derivation after a restart from the last completed epoch,
+// instead of re-deriving the last sequencing window of L2 blocks. It is a hint: the logged safe head is only
+// used if its sequencing window is still canonical. A nil WAL does not log anything.
+type WAL struct {
+	path    string
+	f       *os.File
+	records int
+	last    *walRecord
+}
+
+// OpenWAL opens the write-ahead log at the given path, and reads the last record of it, if any.
+func OpenWAL(path string) (*WAL, error) {
+	w := &WAL{path: path}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var rec walRecord
+			// A torn write of the last record is ignored, the record before it is still valid
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			w.last = &rec
+			w.records++
+		}
+		err := scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read derivation log %q: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open derivation log %q: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open derivation log %q: %w", path, err)
+	}
+	w.f = f
+	return w, nil
+}
+
+// Last returns the last logged derivation progress, or nil if there is none.
+func (w *WAL) Last() *walRecord {
+	if w == nil {
+		return nil
+	}
+	return w.last
+}
+
+func (w *WAL) append(rec walRecord) error {
+	if w == nil {
+		return nil
+	}
+	w.last = &rec
+	if w.records >= walCompactRecords {
+		return w.compact()
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := w.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	w.records++
+	return w.f.Sync()
+}
+
+// compact replaces the log with a log of just the last record.
+func (w *WAL) compact() error {
+	data, err := json.Marshal(w.last)
+	if err != nil {
+		return err
+	}
+	tmp := w.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		return err
+	}
+	w.f.Close()
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.records = 1
+	return nil
+}
+
+// endEpoch logs that the epoch completed, with the new safe head, the end of the sequencing window it was derived from,
+// and the remaining L1 window.
+func (w *WAL) endEpoch(safeHead eth.L2BlockRef, windowEnd eth.BlockID, window []eth.BlockID) error {
+	return w.append(walRecord{SafeHead: safeHead, WindowEnd: windowEnd, L1Window: window})
+}
+
+func (w *WAL) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.f.Close()
+}
+
+// resumeFromWAL moves the safe head found by findL2Heads forward to the safe head of the derivation log,
+// if it is still valid: the safe head must be part of the given L2 chain, and the sequencing window
+// that it was derived from must be canonical, like the window of the safe head of findL2Heads.
+// The last block of the window being canonical implies that the whole window is.
+// The buffered L1 window is restored as well, if it still extends the safe head.
+func (s *state) resumeFromWAL(ctx context.Context, unsafeHead eth.L2BlockRef) error {
+	rec := s.wal.Last()
+	if rec == nil || rec.SafeHead.Number <= s.l2SafeHead.Number || rec.SafeHead.Number > unsafeHead.Number {
+		return nil
+	}
+	if rec.WindowEnd == (eth.BlockID{}) || rec.WindowEnd.Number != rec.SafeHead.L1Origin.Number+s.Config.SeqWindowSize-1 {
+		s.log.Info("Ignoring derivation log, the sequencing window of the safe head is unknown", "logged", rec.SafeHead)
+		return nil
+	}
+	ref, err := s.l2.L2BlockRefByNumber(ctx, new(big.Int).SetUint64(rec.SafeHead.Number))
+	if err != nil {
+		return fmt.Errorf("failed to fetch L2 block %d of the derivation log: %w", rec.SafeHead.Number, err)
+	}
+	if ref.Hash != rec.SafeHead.Hash {
+		s.log.Info("Ignoring derivation log, safe head is no longer canonical", "logged", rec.SafeHead, "canonical", ref)
+		return nil
+	}
+	if ok, err := s.isCanonicalL1(ctx, rec.WindowEnd); err != nil || !ok {
+		s.log.Info("Ignoring derivation log, sequencing window of the safe head is no longer canonical", "logged", rec.SafeHead,
+			"windowEnd", rec.WindowEnd)
+		return err
+	}
+	s.l2SafeHead = ref
+	s.l1Traversal = derive.L1Traversal{}
+	if n := len(rec.L1Window); n > 0 && rec.L1Window[0].Number == ref.L1Origin.Number+1 {
+		if ok, err := s.isCanonicalL1(ctx, rec.L1Window[n-1]); err != nil {
+			return err
+		} else if ok {
+			s.l1Traversal.Extend(rec.L1Window...)
+		}
+	}
+	s.log.Info("Resuming derivation from the derivation log", "l2SafeHead", s.l2SafeHead, "l1Window", s.l1Traversal.Len())
+	return nil
+}
+
+// isCanonicalL1 returns true if the given L1 block is part of the canonical L1 chain.
+func (s *state) isCanonicalL1(ctx context.Context, id eth.BlockID) (bool, error) {
+	ref, err := s.l1.L1BlockRefByNumber(ctx, id.Number)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch L1 block %d: %w", id.Number, err)
+	}
+	return ref.Hash == id.Hash, nil
+}
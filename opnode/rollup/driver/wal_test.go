@@ -0,0 +1,114 @@
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "derivation.wal")
+	a, b, c := fakeL1Block('a', 0, 0), fakeL1Block('b', 'a', 1), fakeL1Block('c', 'b', 2)
+	A := fakeL2Block('A', 0, a.ID(), 0)
+	B := fakeL2Block('B', 'A', b.ID(), 1)
+
+	w, err := OpenWAL(path)
+	require.NoError(t, err)
+	require.Nil(t, w.Last(), "empty log")
+	require.NoError(t, w.endEpoch(A, a.ID(), []eth.BlockID{b.ID(), c.ID()}))
+	require.NoError(t, w.Close())
+
+	w, err = OpenWAL(path)
+	require.NoError(t, err)
+	require.Equal(t, &walRecord{SafeHead: A, WindowEnd: a.ID(), L1Window: []eth.BlockID{b.ID(), c.ID()}}, w.Last())
+	require.NoError(t, w.endEpoch(B, b.ID(), []eth.BlockID{c.ID()}))
+	require.NoError(t, w.Close())
+
+	// A torn write of the last record is ignored
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"safeHead":{"ha`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	w, err = OpenWAL(path)
+	require.NoError(t, err)
+	require.Equal(t, &walRecord{SafeHead: B, WindowEnd: b.ID(), L1Window: []eth.BlockID{c.ID()}}, w.Last())
+
+	// The log is compacted to the last record
+	w.records = walCompactRecords
+	require.NoError(t, w.endEpoch(A, eth.BlockID{}, nil))
+	require.Equal(t, 1, w.records)
+	require.NoError(t, w.Close())
+	w, err = OpenWAL(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, w.records)
+	require.Equal(t, A, w.Last().SafeHead)
+	require.NoError(t, w.Close())
+
+	var nilWAL *WAL
+	require.NoError(t, nilWAL.endEpoch(A, a.ID(), []eth.BlockID{b.ID()}), "nil log does not log")
+	require.Nil(t, nilWAL.Last())
+}
+
+func TestResumeFromWAL(t *testing.T) {
+	l1 := chainL1(0, "abcde")
+	A := fakeL2Block('A', 0, l1[0].ID(), 0)
+	B := fakeL2Block('B', 'A', l1[1].ID(), 1)
+	C := fakeL2Block('C', 'B', l1[2].ID(), 2)
+	l2 := &stubL2Chain{blocks: []eth.L2BlockRef{A, B, C}}
+	l1Chain := &stubL1Chain{blocks: l1, err: ethereum.NotFound}
+
+	newState := func(rec walRecord) *state {
+		w, err := OpenWAL(filepath.Join(t.TempDir(), "derivation.wal"))
+		require.NoError(t, err)
+		t.Cleanup(func() { w.Close() })
+		require.NoError(t, w.append(rec))
+		s := NewState(&Config{}, testlog.Logger(t, log.LvlError), testlog.Logger(t, log.LvlError), rollup.Config{SeqWindowSize: 2}, l1Chain, l2, nil, nil)
+		s.wal = w
+		s.l2Head, s.l2SafeHead = C, A
+		return s
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		s := newState(walRecord{SafeHead: B, WindowEnd: l1[2].ID(), L1Window: []eth.BlockID{l1[2].ID(), l1[3].ID()}})
+		require.NoError(t, s.resumeFromWAL(context.Background(), C))
+		require.Equal(t, B, s.l2SafeHead)
+		require.Equal(t, []eth.BlockID{l1[2].ID(), l1[3].ID()}, s.l1Traversal.Blocks())
+	})
+	t.Run("reorged L2 safe head", func(t *testing.T) {
+		s := newState(walRecord{SafeHead: fakeL2Block('X', 'A', l1[1].ID(), 1), WindowEnd: l1[2].ID()})
+		require.NoError(t, s.resumeFromWAL(context.Background(), C))
+		require.Equal(t, A, s.l2SafeHead)
+	})
+	t.Run("reorged L1 window", func(t *testing.T) {
+		s := newState(walRecord{SafeHead: B, WindowEnd: l1[2].ID(), L1Window: []eth.BlockID{l1[2].ID(), fakeID('x', 3)}})
+		require.NoError(t, s.resumeFromWAL(context.Background(), C))
+		require.Equal(t, B, s.l2SafeHead)
+		require.Empty(t, s.l1Traversal.Blocks(), "window is fetched again")
+	})
+	t.Run("reorged sequencing window", func(t *testing.T) {
+		// the L1 origin of the safe head is canonical, but the rest of its window was reorged
+		s := newState(walRecord{SafeHead: B, WindowEnd: fakeID('x', 2)})
+		require.NoError(t, s.resumeFromWAL(context.Background(), C))
+		require.Equal(t, A, s.l2SafeHead)
+	})
+	t.Run("unknown sequencing window", func(t *testing.T) {
+		s := newState(walRecord{SafeHead: B})
+		require.NoError(t, s.resumeFromWAL(context.Background(), C))
+		require.Equal(t, A, s.l2SafeHead)
+	})
+	t.Run("behind", func(t *testing.T) {
+		s := newState(walRecord{SafeHead: A, WindowEnd: l1[1].ID()})
+		s.l2SafeHead = B
+		require.NoError(t, s.resumeFromWAL(context.Background(), C))
+		require.Equal(t, B, s.l2SafeHead, "safe head does not move back")
+	})
+}
@@ -0,0 +1,281 @@
+// Package index persists the last safe L2 block derived from each L1 block, indexed by L1 origin,
+// the system config after each L1 block, and the L1 batch data that each safe L2 block was derived from.
+// The index lets reorg recovery and sync-start jump to the L2 blocks of a L1 range,
+// instead of walking back the L2 chain block by block.
+package index
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+var (
+	// headKey stores the highest indexed L1 origin number. Entries above it are stale.
+	headKey = []byte("head")
+	// entryPrefix is followed by the inverted L1 origin number, to iterate the entries from high to low numbers.
+	entryPrefix = []byte("o")
+	// systemConfigPrefix is followed by a L1 block hash, to store the system config after the L1 block.
+	systemConfigPrefix = []byte("s")
+	// batchInclusionPrefix is followed by a L2 block hash, to store where the batch data of the L2 block is on L1.
+	batchInclusionPrefix = []byte("b")
+	// batchTxPrefix is followed by a L1 transaction hash and a L2 block hash, to find the L2 blocks of a batch transaction.
+	batchTxPrefix = []byte("t")
+	// batchNumberPrefix is followed by a L2 block number and hash, to prune the batch inclusions of the old L2 blocks.
+	batchNumberPrefix = []byte("n")
+)
+
+const (
+	cacheSize = 16 // MiB
+	handles   = 16
+)
+
+type DB struct {
+	db ethdb.KeyValueStore
+}
+
+// Open opens the index database at the given path, or an in-memory index if the path is empty.
+func Open(path string) (*DB, error) {
+	if path == "" {
+		return &DB{db: memorydb.New()}, nil
+	}
+	db, err := leveldb.New(path, cacheSize, handles, "", false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open L1 origin index at %q: %w", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+func entryKey(l1Num uint64) []byte {
+	key := make([]byte, len(entryPrefix)+8)
+	copy(key, entryPrefix)
+	binary.BigEndian.PutUint64(key[len(entryPrefix):], ^l1Num)
+	return key
+}
+
+// Put records the given safe L2 block as the last L2 block derived from its L1 origin.
+// The L1 origin becomes the head of the index: the safe head must be indexed whenever it changes,
+// also when it moves back, to invalidate the entries after it.
+func (d *DB) Put(ref eth.L2BlockRef) error {
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+	var head [8]byte
+	binary.BigEndian.PutUint64(head[:], ref.L1Origin.Number)
+	batch := d.db.NewBatch()
+	if err := batch.Put(entryKey(ref.L1Origin.Number), data); err != nil {
+		return err
+	}
+	if err := batch.Put(headKey, head[:]); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// L2BlockRefByL1Origin returns the last safe L2 block of the highest indexed L1 origin at or below the given L1 block number.
+// It returns ethereum.NotFound if there is no such block.
+func (d *DB) L2BlockRefByL1Origin(ctx context.Context, l1Num uint64) (eth.L2BlockRef, error) {
+	if ok, err := d.db.Has(headKey); err != nil {
+		return eth.L2BlockRef{}, err
+	} else if !ok {
+		return eth.L2BlockRef{}, ethereum.NotFound
+	}
+	head, err := d.db.Get(headKey)
+	if err != nil {
+		return eth.L2BlockRef{}, err
+	}
+	if headNum := binary.BigEndian.Uint64(head); l1Num > headNum {
+		l1Num = headNum
+	}
+	it := d.db.NewIterator(entryPrefix, entryKey(l1Num)[len(entryPrefix):])
+	defer it.Release()
+	if !it.Next() {
+		if err := it.Error(); err != nil {
+			return eth.L2BlockRef{}, err
+		}
+		return eth.L2BlockRef{}, ethereum.NotFound
+	}
+	var ref eth.L2BlockRef
+	if err := json.Unmarshal(it.Value(), &ref); err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("bad L1 origin index entry: %w", err)
+	}
+	return ref, nil
+}
+
+func systemConfigKey(l1Hash common.Hash) []byte {
+	return append(append([]byte(nil), systemConfigPrefix...), l1Hash[:]...)
+}
+
+// PutSystemConfig records the system config after applying the updates of the given L1 block.
+func (d *DB) PutSystemConfig(l1Hash common.Hash, sysCfg rollup.SystemConfig) error {
+	data, err := json.Marshal(sysCfg)
+	if err != nil {
+		return err
+	}
+	return d.db.Put(systemConfigKey(l1Hash), data)
+}
+
+// SystemConfig returns the system config after the given L1 block, or ethereum.NotFound if it was not recorded.
+func (d *DB) SystemConfig(l1Hash common.Hash) (rollup.SystemConfig, error) {
+	key := systemConfigKey(l1Hash)
+	if ok, err := d.db.Has(key); err != nil {
+		return rollup.SystemConfig{}, err
+	} else if !ok {
+		return rollup.SystemConfig{}, ethereum.NotFound
+	}
+	data, err := d.db.Get(key)
+	if err != nil {
+		return rollup.SystemConfig{}, err
+	}
+	var sysCfg rollup.SystemConfig
+	if err := json.Unmarshal(data, &sysCfg); err != nil {
+		return rollup.SystemConfig{}, fmt.Errorf("bad system config entry: %w", err)
+	}
+	return sysCfg, nil
+}
+
+// BatchInclusion is the position on L1 of an item of batch data that an L2 block was derived from.
+type BatchInclusion struct {
+	L1 eth.BlockID `json:"l1"`
+	// Item is the index of the item in the batch data of the L1 block
+	Item int `json:"item"`
+	// Tx is the hash of the L1 transaction of the item, zero if the data source does not identify it
+	Tx common.Hash `json:"tx"`
+}
+
+func batchInclusionKey(l2Hash common.Hash) []byte {
+	return append(append([]byte(nil), batchInclusionPrefix...), l2Hash[:]...)
+}
+
+func batchTxKey(txHash common.Hash, l2Hash common.Hash) []byte {
+	return append(append(append([]byte(nil), batchTxPrefix...), txHash[:]...), l2Hash[:]...)
+}
+
+func batchNumberKey(l2 eth.BlockID) []byte {
+	key := make([]byte, len(batchNumberPrefix)+8, len(batchNumberPrefix)+8+len(l2.Hash))
+	copy(key, batchNumberPrefix)
+	binary.BigEndian.PutUint64(key[len(batchNumberPrefix):], l2.Number)
+	return append(key, l2.Hash[:]...)
+}
+
+// PutBatchInclusion records the items of batch data that the given L2 block was derived from.
+// Entries are keyed by block hash: the entries of reorged L2 blocks are only removed by PruneBatchInclusions.
+func (d *DB) PutBatchInclusion(l2 eth.BlockID, inclusions []BatchInclusion) error {
+	data, err := json.Marshal(inclusions)
+	if err != nil {
+		return err
+	}
+	ref, err := json.Marshal(l2)
+	if err != nil {
+		return err
+	}
+	batch := d.db.NewBatch()
+	if err := batch.Put(batchInclusionKey(l2.Hash), data); err != nil {
+		return err
+	}
+	if err := batch.Put(batchNumberKey(l2), nil); err != nil {
+		return err
+	}
+	for _, incl := range inclusions {
+		if incl.Tx == (common.Hash{}) {
+			continue
+		}
+		if err := batch.Put(batchTxKey(incl.Tx, l2.Hash), ref); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// BatchInclusion returns the items of batch data that the given L2 block was derived from,
+// or ethereum.NotFound if the block was not recorded. Blocks without batch data have no items.
+func (d *DB) BatchInclusion(l2Hash common.Hash) ([]BatchInclusion, error) {
+	key := batchInclusionKey(l2Hash)
+	if ok, err := d.db.Has(key); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ethereum.NotFound
+	}
+	data, err := d.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var inclusions []BatchInclusion
+	if err := json.Unmarshal(data, &inclusions); err != nil {
+		return nil, fmt.Errorf("bad batch inclusion entry: %w", err)
+	}
+	return inclusions, nil
+}
+
+// L2BlocksByBatchTx returns the recorded L2 blocks that were derived from the batch data of the given L1 transaction,
+// including blocks that may have been reorged out since.
+func (d *DB) L2BlocksByBatchTx(txHash common.Hash) ([]eth.BlockID, error) {
+	prefix := append(append([]byte(nil), batchTxPrefix...), txHash[:]...)
+	it := d.db.NewIterator(prefix, nil)
+	defer it.Release()
+	var out []eth.BlockID
+	for it.Next() {
+		var id eth.BlockID
+		if err := json.Unmarshal(it.Value(), &id); err != nil {
+			return nil, fmt.Errorf("bad batch transaction entry: %w", err)
+		}
+		out = append(out, id)
+	}
+	return out, it.Error()
+}
+
+// PruneBatchInclusions removes the batch inclusions of the L2 blocks below the given number, of reorged blocks too.
+// It returns the number of L2 blocks that were pruned.
+func (d *DB) PruneBatchInclusions(below uint64) (int, error) {
+	it := d.db.NewIterator(batchNumberPrefix, nil)
+	defer it.Release()
+	batch := d.db.NewBatch()
+	pruned := 0
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(batchNumberPrefix)+8+common.HashLength {
+			return pruned, fmt.Errorf("bad batch number entry key %x", key)
+		}
+		if binary.BigEndian.Uint64(key[len(batchNumberPrefix):]) >= below {
+			break
+		}
+		l2Hash := common.BytesToHash(key[len(batchNumberPrefix)+8:])
+		inclusions, err := d.BatchInclusion(l2Hash)
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return pruned, err
+		}
+		for _, incl := range inclusions {
+			if incl.Tx != (common.Hash{}) {
+				if err := batch.Delete(batchTxKey(incl.Tx, l2Hash)); err != nil {
+					return pruned, err
+				}
+			}
+		}
+		if err := batch.Delete(batchInclusionKey(l2Hash)); err != nil {
+			return pruned, err
+		}
+		if err := batch.Delete(append([]byte(nil), key...)); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	if err := it.Error(); err != nil {
+		return pruned, err
+	}
+	return pruned, batch.Write()
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
@@ -0,0 +1,132 @@
+package index
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeL2(l2Num uint64, l1Num uint64) eth.L2BlockRef {
+	return eth.L2BlockRef{
+		Hash:     common.Hash{byte(l2Num)},
+		Number:   l2Num,
+		L1Origin: eth.BlockID{Hash: common.Hash{0xff, byte(l1Num)}, Number: l1Num},
+	}
+}
+
+func testIndex(t *testing.T, db *DB) {
+	ctx := context.Background()
+	_, err := db.L2BlockRefByL1Origin(ctx, 10)
+	require.ErrorIs(t, err, ethereum.NotFound, "empty index")
+
+	// L1 origin 3 is skipped
+	for _, ref := range []eth.L2BlockRef{fakeL2(2, 1), fakeL2(4, 2), fakeL2(6, 4), fakeL2(8, 5)} {
+		require.NoError(t, db.Put(ref))
+	}
+	ref, err := db.L2BlockRefByL1Origin(ctx, 4)
+	require.NoError(t, err)
+	require.Equal(t, fakeL2(6, 4), ref)
+	ref, err = db.L2BlockRefByL1Origin(ctx, 3)
+	require.NoError(t, err)
+	require.Equal(t, fakeL2(4, 2), ref, "highest indexed origin at or below")
+	ref, err = db.L2BlockRefByL1Origin(ctx, 100)
+	require.NoError(t, err)
+	require.Equal(t, fakeL2(8, 5), ref, "capped at the head")
+	_, err = db.L2BlockRefByL1Origin(ctx, 0)
+	require.ErrorIs(t, err, ethereum.NotFound)
+
+	// The safe head moves back: the entries after it are no longer valid
+	require.NoError(t, db.Put(fakeL2(3, 2)))
+	ref, err = db.L2BlockRefByL1Origin(ctx, 100)
+	require.NoError(t, err)
+	require.Equal(t, fakeL2(3, 2), ref)
+}
+
+func TestMemoryIndex(t *testing.T) {
+	db, err := Open("")
+	require.NoError(t, err)
+	defer db.Close()
+	testIndex(t, db)
+}
+
+func TestPersistentIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	db, err := Open(path)
+	require.NoError(t, err)
+	testIndex(t, db)
+	require.NoError(t, db.Close())
+
+	db, err = Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+	ref, err := db.L2BlockRefByL1Origin(context.Background(), 100)
+	require.NoError(t, err)
+	require.Equal(t, fakeL2(3, 2), ref, "index is persisted")
+}
+
+func TestSystemConfig(t *testing.T) {
+	db, err := Open("")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.SystemConfig(common.Hash{1})
+	require.ErrorIs(t, err, ethereum.NotFound)
+	sysCfg := rollup.SystemConfig{BatcherAddr: common.Address{0xba}, Scalar: common.Hash{1}, GasLimit: 30_000_000}
+	require.NoError(t, db.PutSystemConfig(common.Hash{1}, sysCfg))
+	got, err := db.SystemConfig(common.Hash{1})
+	require.NoError(t, err)
+	require.Equal(t, sysCfg, got)
+}
+
+func TestBatchInclusion(t *testing.T) {
+	db, err := Open("")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.BatchInclusion(common.Hash{1})
+	require.ErrorIs(t, err, ethereum.NotFound)
+
+	tx := common.Hash{0xaa}
+	a := []BatchInclusion{{L1: eth.BlockID{Hash: common.Hash{0xff, 1}, Number: 1}, Item: 0, Tx: tx}}
+	b := []BatchInclusion{
+		{L1: eth.BlockID{Hash: common.Hash{0xff, 1}, Number: 1}, Item: 0, Tx: tx},
+		{L1: eth.BlockID{Hash: common.Hash{0xff, 2}, Number: 2}, Item: 3},
+	}
+	require.NoError(t, db.PutBatchInclusion(eth.BlockID{Hash: common.Hash{1}, Number: 1}, a))
+	require.NoError(t, db.PutBatchInclusion(eth.BlockID{Hash: common.Hash{2}, Number: 2}, b))
+	require.NoError(t, db.PutBatchInclusion(eth.BlockID{Hash: common.Hash{3}, Number: 3}, []BatchInclusion{}))
+
+	got, err := db.BatchInclusion(common.Hash{2})
+	require.NoError(t, err)
+	require.Equal(t, b, got)
+	got, err = db.BatchInclusion(common.Hash{3})
+	require.NoError(t, err)
+	require.Empty(t, got, "deposit-only block")
+
+	blocks, err := db.L2BlocksByBatchTx(tx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []eth.BlockID{{Hash: common.Hash{1}, Number: 1}, {Hash: common.Hash{2}, Number: 2}}, blocks)
+	blocks, err = db.L2BlocksByBatchTx(common.Hash{0xbb})
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+
+	// a reorged block 2 is pruned with the canonical one
+	require.NoError(t, db.PutBatchInclusion(eth.BlockID{Hash: common.Hash{0x22}, Number: 2}, a))
+	pruned, err := db.PruneBatchInclusions(3)
+	require.NoError(t, err)
+	require.Equal(t, 3, pruned)
+	for _, h := range []common.Hash{{1}, {2}, {0x22}} {
+		_, err = db.BatchInclusion(h)
+		require.ErrorIs(t, err, ethereum.NotFound)
+	}
+	blocks, err = db.L2BlocksByBatchTx(tx)
+	require.NoError(t, err)
+	require.Empty(t, blocks)
+	_, err = db.BatchInclusion(common.Hash{3})
+	require.NoError(t, err, "blocks at and above the number are kept")
+}
@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+)
+
+// Progress describes how far the L2 safe head is behind the L1 head.
+type Progress struct {
+	L1Head       eth.L1BlockRef `json:"l1Head"`
+	SafeL2Head   eth.L2BlockRef `json:"safeL2Head"`
+	BlocksBehind uint64         `json:"blocksBehind"` // number of L1 blocks that are ready to be derived from, but are not yet
+	Throughput   float64        `json:"throughput"`   // recent derivation throughput, in L1 blocks per second
+	ETA          time.Duration  `json:"eta"`          // estimated time until the safe head is synced, 0 if synced or unknown
+	L2Throughput float64        `json:"l2Throughput"` // recent derivation throughput, in L2 blocks per second
+	// InclusionLatency is the recent time from the L1 inclusion of the batch data of the safe blocks to their derivation
+	InclusionLatency LatencyStats `json:"inclusionLatency"`
+}
+
+// LatencyStats summarizes the recent latencies of the derivation of the safe blocks.
+type LatencyStats struct {
+	Count int           `json:"count"` // number of recent safe blocks, 0 if there are none and the latencies are unknown
+	Last  time.Duration `json:"last"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	Max   time.Duration `json:"max"`
+}
+
+// Synced returns true if there are no L1 blocks left to derive the safe head from.
+func (p Progress) Synced() bool {
+	return p.BlocksBehind == 0
+}
+
+// Stuck returns true if the safe head is behind, but did not make any recent progress.
+func (p Progress) Stuck() bool {
+	return p.BlocksBehind > 0 && p.Throughput == 0
+}
+
+type progressSample struct {
+	time     time.Time
+	l1Origin uint64
+	l2Number uint64
+}
+
+// maxLatencySamples is the number of recent safe blocks that the latency stats are computed over
+const maxLatencySamples = 256
+
+// ProgressTracker estimates the derivation throughput from recent changes of the safe head,
+// to compute the sync progress.
+type ProgressTracker struct {
+	seqWindowSize uint64
+	period        time.Duration    // samples older than this period are not used for the throughput estimate
+	samples       []progressSample // samples in increasing time
+	latencies     []time.Duration  // latencies of the recent safe blocks, the latest last
+}
+
+func NewProgressTracker(seqWindowSize uint64, period time.Duration) *ProgressTracker {
+	return &ProgressTracker{seqWindowSize: seqWindowSize, period: period}
+}
+
+// Update records the L1 origin of the safe head at the given time.
+func (p *ProgressTracker) Update(now time.Time, safeHead eth.L2BlockRef) {
+	p.samples = append(p.samples, progressSample{time: now, l1Origin: safeHead.L1Origin.Number, l2Number: safeHead.Number})
+	p.prune(now)
+}
+
+// RecordLatency records the time from the L1 inclusion of the batch data of a new safe block to its derivation.
+func (p *ProgressTracker) RecordLatency(latency time.Duration) {
+	if len(p.latencies) == maxLatencySamples {
+		p.latencies = append(p.latencies[:0], p.latencies[1:]...)
+	}
+	p.latencies = append(p.latencies, latency)
+}
+
+func (p *ProgressTracker) latencyStats() LatencyStats {
+	if len(p.latencies) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]time.Duration(nil), p.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(pct int) time.Duration {
+		return sorted[(len(sorted)-1)*pct/100]
+	}
+	return LatencyStats{
+		Count: len(sorted),
+		Last:  p.latencies[len(p.latencies)-1],
+		P50:   percentile(50),
+		P90:   percentile(90),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// prune drops the samples outside of the period, but always keeps the latest sample.
+func (p *ProgressTracker) prune(now time.Time) {
+	i := 0
+	for i < len(p.samples)-1 && now.Sub(p.samples[i].time) > p.period {
+		i++
+	}
+	p.samples = p.samples[i:]
+}
+
+// Progress computes the sync progress of the safe head relative to the L1 head.
+func (p *ProgressTracker) Progress(now time.Time, l1Head eth.L1BlockRef, safeHead eth.L2BlockRef) Progress {
+	out := Progress{L1Head: l1Head, SafeL2Head: safeHead, InclusionLatency: p.latencyStats()}
+	// The next epoch can be derived once a full sequencing window of L1 blocks after the L1 origin is available.
+	if ready := safeHead.L1Origin.Number + p.seqWindowSize; l1Head.Number >= ready {
+		out.BlocksBehind = l1Head.Number - ready + 1
+	}
+
+	p.prune(now)
+	if len(p.samples) < 2 {
+		return out
+	}
+	first, last := p.samples[0], p.samples[len(p.samples)-1]
+	// The period ends now: if no progress was made since the last sample, the throughput decreases.
+	elapsed := now.Sub(first.time).Seconds()
+	if elapsed > 0 && last.l2Number > first.l2Number {
+		out.L2Throughput = float64(last.l2Number-first.l2Number) / elapsed
+	}
+	if elapsed <= 0 || last.l1Origin <= first.l1Origin {
+		return out
+	}
+	out.Throughput = float64(last.l1Origin-first.l1Origin) / elapsed
+	if out.BlocksBehind > 0 {
+		out.ETA = time.Duration(float64(out.BlocksBehind) / out.Throughput * float64(time.Second))
+	}
+	return out
+}
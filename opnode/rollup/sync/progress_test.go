@@ -0,0 +1,64 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTracker(t *testing.T) {
+	start := time.Unix(1000, 0)
+	safeAt := func(l1Origin uint64) eth.L2BlockRef {
+		// 6 L2 blocks per L1 block
+		return eth.L2BlockRef{Number: 6 * l1Origin, L1Origin: eth.BlockID{Number: l1Origin}}
+	}
+	l1Head := eth.L1BlockRef{Number: 200}
+
+	tracker := NewProgressTracker(4, time.Minute)
+	p := tracker.Progress(start, l1Head, safeAt(100))
+	require.Equal(t, uint64(97), p.BlocksBehind, "blocks 104 to 200 are ready to be derived from")
+	require.Zero(t, p.Throughput, "no samples yet")
+	require.Zero(t, p.ETA, "unknown")
+	require.True(t, p.Stuck())
+
+	tracker.Update(start, safeAt(100))
+	tracker.Update(start.Add(10*time.Second), safeAt(110))
+	tracker.Update(start.Add(20*time.Second), safeAt(120))
+	p = tracker.Progress(start.Add(20*time.Second), l1Head, safeAt(120))
+	require.Equal(t, uint64(77), p.BlocksBehind)
+	require.Equal(t, 1.0, p.Throughput)
+	require.Equal(t, 6.0, p.L2Throughput)
+	require.Equal(t, 77*time.Second, p.ETA)
+	require.False(t, p.Stuck())
+
+	// Without progress, samples expire and the throughput drops
+	p = tracker.Progress(start.Add(5*time.Minute), l1Head, safeAt(120))
+	require.Zero(t, p.Throughput)
+	require.Zero(t, p.L2Throughput)
+	require.True(t, p.Stuck())
+
+	p = tracker.Progress(start, eth.L1BlockRef{Number: 123}, safeAt(120))
+	require.True(t, p.Synced(), "a full sequencing window is not yet available")
+	require.False(t, p.Stuck())
+}
+
+func TestProgressTrackerLatency(t *testing.T) {
+	tracker := NewProgressTracker(4, time.Minute)
+	p := tracker.Progress(time.Unix(1000, 0), eth.L1BlockRef{}, eth.L2BlockRef{})
+	require.Zero(t, p.InclusionLatency.Count, "no safe blocks yet")
+
+	for i := 1; i <= 10; i++ {
+		tracker.RecordLatency(time.Duration(11-i) * time.Second)
+	}
+	p = tracker.Progress(time.Unix(1000, 0), eth.L1BlockRef{}, eth.L2BlockRef{})
+	require.Equal(t, LatencyStats{Count: 10, Last: time.Second, P50: 5 * time.Second, P90: 9 * time.Second, Max: 10 * time.Second}, p.InclusionLatency)
+
+	// only the recent safe blocks are summarized
+	for i := 0; i < maxLatencySamples; i++ {
+		tracker.RecordLatency(2 * time.Second)
+	}
+	p = tracker.Progress(time.Unix(1000, 0), eth.L1BlockRef{}, eth.L2BlockRef{})
+	require.Equal(t, LatencyStats{Count: maxLatencySamples, Last: 2 * time.Second, P50: 2 * time.Second, P90: 2 * time.Second, Max: 2 * time.Second}, p.InclusionLatency)
+}
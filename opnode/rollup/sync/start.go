@@ -1,6 +1,5 @@
 // The sync package is responsible for reconciling L1 and L2.
 //
-//
 // The ethereum chain is a DAG of blocks with the root block being the genesis block.
 // At any given time, the head (or tip) of the chain can change if an offshoot of the chain
 // has a higher number. This is known as a re-organization of the canonical chain.
@@ -10,18 +9,17 @@
 // The optimism chain has similar properties, but also retains references to the ethereum chain.
 // Each optimism block retains a reference to an L1 block and to its parent L2 block.
 // The L2 chain node must satisfy the following validity rules
-//     1. l2block.height == l2parent.block.height + 1
-//     2. l2block.l1Origin.height >= l2block.l2parent.l1Origin.height
-//     3. l2block.l1Origin is in the canonical chain on L1
-//     4. l1_rollup_genesis is an ancestor of l2block.l1Origin
-//
+//  1. l2block.height == l2parent.block.height + 1
+//  2. l2block.l1Origin.height >= l2block.l2parent.l1Origin.height
+//  3. l2block.l1Origin is in the canonical chain on L1
+//  4. l1_rollup_genesis is an ancestor of l2block.l1Origin
 //
 // During normal operation, both the L1 and L2 canonical chains can change, due to a reorg
 // or an extension (new block).
-//     - L1 reorg
-//     - L1 extension
-//     - L2 reorg
-//     - L2 extension
+//   - L1 reorg
+//   - L1 extension
+//   - L2 reorg
+//   - L2 extension
 //
 // When one of these changes occurs, the rollup node needs to determine what the new L2 Heads should be.
 // In a simple extension case, the L2 head remains the same, but in the case of a re-org on L1, it needs
@@ -40,6 +38,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
@@ -57,11 +56,31 @@ type L2Chain interface {
 	L2BlockRefByHash(ctx context.Context, l2Hash common.Hash) (eth.L2BlockRef, error)
 }
 
+// L2ChainByNumber is optionally implemented by the L2Chain,
+// to search the canonical L2 chain by block number instead of walking back block by block.
+type L2ChainByNumber interface {
+	L2BlockRefByNumber(ctx context.Context, l2Num *big.Int) (eth.L2BlockRef, error)
+}
+
+// L2ChainIndex is optionally implemented by the L2Chain, to look up the L2 blocks derived from a L1 block,
+// instead of walking back the L2 chain to find the L2 blocks of a reorged L1 range.
+// The index must cover every L1 origin up to the safe head.
+type L2ChainIndex interface {
+	// L2BlockRefByL1Origin returns the last safe L2 block of the highest indexed L1 origin at or below the given L1 block number.
+	// It returns ethereum.NotFound if there is no such block.
+	L2BlockRefByL1Origin(ctx context.Context, l1Num uint64) (eth.L2BlockRef, error)
+}
+
 var WrongChainErr = errors.New("wrong chain")
 var TooDeepReorgErr = errors.New("reorg is too deep")
 
+// MaxReorgDepth is the default maximum number of L2 blocks to walk back to find the latest L2 block.
 const MaxReorgDepth = 500
 
+// linearSearchThreshold is the size of the range of L2 blocks below which the
+// binary search for the latest L2 block falls back to walking back block by block.
+const linearSearchThreshold = 8
+
 // isCanonical returns true if the supplied block ID is canonical in the L1 chain.
 // It will suppress ethereum.NotFound errors
 func isCanonical(ctx context.Context, l1 L1Chain, block eth.BlockID) (bool, error) {
@@ -78,9 +97,13 @@ func isCanonical(ctx context.Context, l1 L1Chain, block eth.BlockID) (bool, erro
 // Unsafe Block: The highest L2 block. If the L1 Attributes is ahead of the L1 head, it is assumed to be valid,
 // if not, it walks back until it finds the first L2 block whose L1 Origin is canonical in the L1 chain.
 // Safe Block: The highest L2 block whose sequence window has not changed during a reorg.
-func FindL2Heads(ctx context.Context, start eth.L2BlockRef, seqWindowSize uint64,
+// A TooDeepReorgErr is returned if the latest block is maxReorgDepth or more blocks behind the start block,
+// MaxReorgDepth is used if maxReorgDepth is zero.
+func FindL2Heads(ctx context.Context, start eth.L2BlockRef, seqWindowSize uint64, maxReorgDepth uint64,
 	l1 L1Chain, l2 L2Chain, genesis *rollup.Genesis) (unsafe eth.L2BlockRef, safe eth.L2BlockRef, err error) {
-	reorgDepth := 0
+	if maxReorgDepth == 0 {
+		maxReorgDepth = MaxReorgDepth
+	}
 	var prevL1OriginHash common.Hash
 	// First check if the L1 Origin of the start block is ahead of the current L1 head
 	// If so, we assume that this should be the next unsafe head for the sequencing window
@@ -92,8 +115,23 @@ func FindL2Heads(ctx context.Context, start eth.L2BlockRef, seqWindowSize uint64
 	l2Ahead := start.L1Origin.Number > l1Head.Number
 	var latest eth.L2BlockRef
 
+	// Skip ahead to the divergence point with the L1 origin index, or else with a binary search,
+	// if the L2 chain supports it.
+	n, err := searchIndex(ctx, start, seqWindowSize, l1, l2, genesis)
+	if err != nil {
+		return eth.L2BlockRef{}, eth.L2BlockRef{}, err
+	}
+	n, err = searchDivergence(ctx, n, l1, l2, genesis)
+	if err != nil {
+		return eth.L2BlockRef{}, eth.L2BlockRef{}, err
+	}
+
+	if err := checkReorgDepth(start, n, maxReorgDepth); err != nil {
+		return eth.L2BlockRef{}, eth.L2BlockRef{}, err
+	}
+
 	// Walk L2 chain until we find the "latest" L2 block. This the first L2 block whose L1 Origin is canonical.
-	for n := start; ; {
+	for {
 		// Check if l1Origin is canonical when we get to a new epoch
 		if prevL1OriginHash != n.L1Origin.Hash {
 			if ok, err := isCanonical(ctx, l1, n.L1Origin); err != nil {
@@ -110,13 +148,13 @@ func FindL2Heads(ctx context.Context, start eth.L2BlockRef, seqWindowSize uint64
 			return eth.L2BlockRef{}, eth.L2BlockRef{}, WrongChainErr
 		}
 		// Pull L2 parent for next iteration
-		n, err = l2.L2BlockRefByHash(ctx, n.ParentHash)
+		parentHash := n.ParentHash
+		n, err = l2.L2BlockRefByHash(ctx, parentHash)
 		if err != nil {
-			return eth.L2BlockRef{}, eth.L2BlockRef{}, fmt.Errorf("failed to fetch L2 block by hash %v: %w", n.ParentHash, err)
+			return eth.L2BlockRef{}, eth.L2BlockRef{}, fmt.Errorf("failed to fetch L2 block by hash %v: %w", parentHash, err)
 		}
-		reorgDepth++
-		if reorgDepth >= MaxReorgDepth {
-			return eth.L2BlockRef{}, eth.L2BlockRef{}, TooDeepReorgErr
+		if err := checkReorgDepth(start, n, maxReorgDepth); err != nil {
+			return eth.L2BlockRef{}, eth.L2BlockRef{}, err
 		}
 	}
 	depth := uint64(1) // SeqWindowSize is a length, but we are counting elements in the window.
@@ -155,3 +193,127 @@ func FindL2Heads(ctx context.Context, start eth.L2BlockRef, seqWindowSize uint64
 	}
 
 }
+
+// checkReorgDepth returns a TooDeepReorgErr if the L2 chain is walked back maxReorgDepth or more blocks from start to n.
+// Such a deep reorg is more likely an engine that diverged from the rollup, than a L1 reorg:
+// recovering by walking back the L2 chain block by block could take hours.
+func checkReorgDepth(start eth.L2BlockRef, n eth.L2BlockRef, maxReorgDepth uint64) error {
+	if n.Number > start.Number || start.Number-n.Number < maxReorgDepth {
+		return nil
+	}
+	return fmt.Errorf("%w: no L2 block with a canonical L1 origin within %d blocks of %s, "+
+		"sync from a trusted checkpoint (--checkpoint.l2), resync the engine, or raise the maximum reorg depth",
+		TooDeepReorgErr, maxReorgDepth, start)
+}
+
+// searchIndex returns the L2 block to start walking back from, to find the first L2 block whose L1 Origin is canonical.
+// It walks back the indexed L1 origins, one L1 block at a time, instead of the L2 chain, which has multiple blocks per L1 origin.
+// If the L1 origin of the highest indexed block is canonical, the L2 chain diverged after the safe blocks,
+// and the start block is returned. The start block is also returned if the L2 chain is not indexed,
+// if the indexed block is not in the canonical L2 chain of the start block, or if no canonical L1 origin is found
+// within a sequencing window: the other searches take over from the start block then.
+func searchIndex(ctx context.Context, start eth.L2BlockRef, seqWindowSize uint64, l1 L1Chain, l2 L2Chain, genesis *rollup.Genesis) (eth.L2BlockRef, error) {
+	idx, ok := l2.(L2ChainIndex)
+	if !ok {
+		return start, nil
+	}
+	if ok, err := isCanonical(ctx, l1, start.L1Origin); err != nil || ok {
+		return start, err
+	}
+	num := start.L1Origin.Number
+	for i := uint64(0); i < seqWindowSize && num >= genesis.L1.Number; i++ {
+		ref, err := idx.L2BlockRefByL1Origin(ctx, num)
+		if errors.Is(err, ethereum.NotFound) {
+			return start, nil
+		} else if err != nil {
+			return eth.L2BlockRef{}, fmt.Errorf("failed to look up L2 block by L1 origin %d: %w", num, err)
+		}
+		// The index must not be ahead of the chain that is searched
+		if ref.Number >= start.Number {
+			return start, nil
+		}
+		ok, err := isCanonical(ctx, l1, ref.L1Origin)
+		if err != nil {
+			return eth.L2BlockRef{}, err
+		}
+		if ok {
+			if i == 0 {
+				return start, nil
+			}
+			// The index may have entries of another L2 chain than the one that is searched
+			if ok, err := isCanonicalL2(ctx, l2, start, ref); err != nil || !ok {
+				return start, err
+			}
+			return ref, nil
+		}
+		if ref.L1Origin.Number == 0 {
+			break
+		}
+		num = ref.L1Origin.Number - 1
+	}
+	return start, nil
+}
+
+// isCanonicalL2 returns true if the start block and the indexed block are both in the canonical L2 chain,
+// so that the indexed block is an ancestor of the start block. It returns false if the L2 chain does not support
+// lookups by number.
+func isCanonicalL2(ctx context.Context, l2 L2Chain, start eth.L2BlockRef, ref eth.L2BlockRef) (bool, error) {
+	byNum, ok := l2.(L2ChainByNumber)
+	if !ok {
+		return false, nil
+	}
+	for _, b := range []eth.L2BlockRef{start, ref} {
+		canonical, err := byNum.L2BlockRefByNumber(ctx, new(big.Int).SetUint64(b.Number))
+		if errors.Is(err, ethereum.NotFound) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("failed to fetch L2 block by number %d: %w", b.Number, err)
+		}
+		if canonical.Hash != b.Hash {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// searchDivergence returns the L2 block to start walking back from, to find the first L2 block whose L1 Origin is canonical.
+// The L1 origins of the L2 chain are canonical up to some block, and not canonical after:
+// this block is found with a binary search over the canonical L2 chain by number, in O(log n) calls.
+// The search stops close to the divergence point, and returns the first block after it that is known
+// to not have a canonical L1 origin. If the L2 chain does not support lookups by number,
+// or if the start block is canonical, the start block itself is returned.
+func searchDivergence(ctx context.Context, start eth.L2BlockRef, l1 L1Chain, l2 L2Chain, genesis *rollup.Genesis) (eth.L2BlockRef, error) {
+	byNum, ok := l2.(L2ChainByNumber)
+	if !ok || start.Number < genesis.L2.Number || start.Number-genesis.L2.Number <= linearSearchThreshold {
+		return start, nil
+	}
+	if ok, err := isCanonical(ctx, l1, start.L1Origin); err != nil || ok {
+		return start, err
+	}
+	// The search is only valid if the start block is part of the canonical L2 chain
+	if ref, err := byNum.L2BlockRefByNumber(ctx, new(big.Int).SetUint64(start.Number)); err != nil {
+		return eth.L2BlockRef{}, fmt.Errorf("failed to fetch L2 block by number %d: %w", start.Number, err)
+	} else if ref.Hash != start.Hash {
+		return start, nil
+	}
+
+	// Invariant: the origin at lo is canonical (genesis always is), the origin at hi is not.
+	lo, hi := genesis.L2.Number, start
+	for hi.Number-lo > linearSearchThreshold {
+		mid := lo + (hi.Number-lo)/2
+		ref, err := byNum.L2BlockRefByNumber(ctx, new(big.Int).SetUint64(mid))
+		if err != nil {
+			return eth.L2BlockRef{}, fmt.Errorf("failed to fetch L2 block by number %d: %w", mid, err)
+		}
+		ok, err := isCanonical(ctx, l1, ref.L1Origin)
+		if err != nil {
+			return eth.L2BlockRef{}, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = ref
+		}
+	}
+	return hi, nil
+}
@@ -2,6 +2,7 @@ package sync
 
 import (
 	"context"
+	"math/big"
 	"testing"
 
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
@@ -123,7 +124,7 @@ func refToRune(r eth.BlockID) rune {
 func (c *syncStartTestCase) Run(t *testing.T) {
 	msr, l2Head, genesis := c.generateFakeL2()
 
-	unsafeL2Head, safeHead, err := FindL2Heads(context.TODO(), l2Head, c.SeqWindowSize, msr, msr, &genesis)
+	unsafeL2Head, safeHead, err := FindL2Heads(context.TODO(), l2Head, c.SeqWindowSize, 0, msr, msr, &genesis)
 
 	if c.ExpectedErr != nil {
 		require.Error(t, err, "Expecting an error in this test case")
@@ -310,3 +311,140 @@ func TestFindSyncStart(t *testing.T) {
 		t.Run(testCase.Name, testCase.Run)
 	}
 }
+
+// fakeChainSourceByNumber additionally serves the canonical L2 chain by number, and counts the L2 lookups.
+type fakeChainSourceByNumber struct {
+	fakeChainSource
+	L2Canonical []eth.L2BlockRef
+	lookups     int
+}
+
+func (m *fakeChainSourceByNumber) L2BlockRefByHash(ctx context.Context, l2Hash common.Hash) (eth.L2BlockRef, error) {
+	m.lookups++
+	return m.fakeChainSource.L2BlockRefByHash(ctx, l2Hash)
+}
+
+func (m *fakeChainSourceByNumber) L2BlockRefByNumber(ctx context.Context, l2Num *big.Int) (eth.L2BlockRef, error) {
+	m.lookups++
+	n := l2Num.Uint64()
+	if n >= uint64(len(m.L2Canonical)) {
+		return eth.L2BlockRef{}, ethereum.NotFound
+	}
+	return m.L2Canonical[n], nil
+}
+
+var _ L2ChainByNumber = (*fakeChainSourceByNumber)(nil)
+
+// reorgedChainSource creates a L2 chain of the given length, of which the L1 origins after reorgBase are no longer canonical.
+func reorgedChainSource(length uint64, reorgBase uint64) (src *fakeChainSourceByNumber, genesis *rollup.Genesis) {
+	numID := func(prefix byte, num uint64) common.Hash {
+		var h common.Hash
+		h[0] = prefix
+		new(big.Int).SetUint64(num).FillBytes(h[24:])
+		return h
+	}
+	var oldL1, newL1 []eth.L1BlockRef
+	for i := uint64(0); i < length; i++ {
+		oldL1 = append(oldL1, eth.L1BlockRef{Hash: numID('a', i), Number: i, ParentHash: numID('a', i-1)})
+		if i <= reorgBase {
+			newL1 = append(newL1, oldL1[i])
+		} else {
+			newL1 = append(newL1, eth.L1BlockRef{Hash: numID('x', i), Number: i})
+		}
+	}
+	src = &fakeChainSourceByNumber{fakeChainSource: fakeChainSource{L1: newL1, L2: make(map[common.Hash]eth.L2BlockRef)}}
+	for i := uint64(0); i < length; i++ {
+		ref := eth.L2BlockRef{Hash: numID('A', i), Number: i, ParentHash: numID('A', i-1), L1Origin: oldL1[i].ID()}
+		src.L2[ref.Hash] = ref
+		src.L2Canonical = append(src.L2Canonical, ref)
+	}
+	return src, &rollup.Genesis{L1: oldL1[0].ID(), L2: src.L2Canonical[0].ID()}
+}
+
+func TestFindL2HeadsBinarySearch(t *testing.T) {
+	const length = 400
+	const reorgBase = 123 // last L1 block that remains canonical
+	src, genesis := reorgedChainSource(length, reorgBase)
+	start := src.L2Canonical[length-1]
+
+	unsafe, safe, err := FindL2Heads(context.Background(), start, 2, 0, src, src, genesis)
+	require.NoError(t, err)
+	require.Equal(t, src.L2Canonical[reorgBase], unsafe)
+	require.Equal(t, src.L2Canonical[reorgBase-1], safe)
+	require.Less(t, src.lookups, 30, "binary search should not walk back the full reorg")
+
+	// Without lookups by number, the chain is walked back block by block, with the same result
+	linearUnsafe, linearSafe, err := FindL2Heads(context.Background(), start, 2, 0, &src.fakeChainSource, &src.fakeChainSource, genesis)
+	require.NoError(t, err)
+	require.Equal(t, unsafe, linearUnsafe)
+	require.Equal(t, safe, linearSafe)
+}
+
+func TestFindL2HeadsMaxReorgDepth(t *testing.T) {
+	src, genesis := reorgedChainSource(400, 123)
+	start := src.L2Canonical[399]
+
+	_, _, err := FindL2Heads(context.Background(), start, 2, 200, &src.fakeChainSource, &src.fakeChainSource, genesis)
+	require.ErrorIs(t, err, TooDeepReorgErr)
+	_, _, err = FindL2Heads(context.Background(), start, 2, 200, src, src, genesis)
+	require.ErrorIs(t, err, TooDeepReorgErr, "binary search is bounded too")
+
+	unsafe, _, err := FindL2Heads(context.Background(), start, 2, 300, src, src, genesis)
+	require.NoError(t, err)
+	require.Equal(t, src.L2Canonical[123], unsafe)
+}
+
+// indexedChainSource additionally serves the safe L2 blocks by L1 origin.
+type indexedChainSource struct {
+	fakeChainSourceByNumber
+	safe []eth.L2BlockRef // last L2 block of each L1 origin, by L1 origin number
+}
+
+func (m *indexedChainSource) L2BlockRefByL1Origin(ctx context.Context, l1Num uint64) (eth.L2BlockRef, error) {
+	m.lookups++
+	if l1Num >= uint64(len(m.safe)) {
+		l1Num = uint64(len(m.safe)) - 1
+	}
+	return m.safe[l1Num], nil
+}
+
+var _ L2ChainIndex = (*indexedChainSource)(nil)
+
+func TestFindL2HeadsIndex(t *testing.T) {
+	const length = 400
+	const reorgBase = 390
+	src, genesis := reorgedChainSource(length, reorgBase)
+	// Only the safe blocks are indexed
+	indexed := &indexedChainSource{fakeChainSourceByNumber: *src}
+	indexed.safe = src.L2Canonical[:395]
+	start := src.L2Canonical[length-1]
+
+	unsafe, safe, err := FindL2Heads(context.Background(), start, 10, 0, indexed, indexed, genesis)
+	require.NoError(t, err)
+	require.Equal(t, src.L2Canonical[reorgBase], unsafe)
+	require.Equal(t, src.L2Canonical[reorgBase-9], safe)
+	require.Less(t, indexed.lookups, 25, "index should be used to skip the reorged L2 blocks")
+
+	// Divergence after the indexed blocks
+	indexed.safe = src.L2Canonical[:200]
+	unsafe, _, err = FindL2Heads(context.Background(), start, 10, 0, indexed, indexed, genesis)
+	require.NoError(t, err)
+	require.Equal(t, src.L2Canonical[reorgBase], unsafe)
+
+	// A reorg deeper than the sequencing window falls back to the other searches
+	indexed.safe = src.L2Canonical[:395]
+	unsafe, _, err = FindL2Heads(context.Background(), start, 2, 0, indexed, indexed, genesis)
+	require.NoError(t, err)
+	require.Equal(t, src.L2Canonical[reorgBase], unsafe)
+
+	// Indexed blocks of another L2 chain are not used
+	other := make([]eth.L2BlockRef, 395)
+	for i := range other {
+		other[i] = src.L2Canonical[i]
+		other[i].Hash = common.Hash{0xee, byte(i)}
+	}
+	indexed.safe = other
+	unsafe, _, err = FindL2Heads(context.Background(), start, 10, 0, indexed, indexed, genesis)
+	require.NoError(t, err)
+	require.Equal(t, src.L2Canonical[reorgBase], unsafe)
+}
@@ -1,9 +1,12 @@
 package rollup
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"os"
 
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
 	"github.com/ethereum/go-ethereum/common"
@@ -32,6 +35,16 @@ type Config struct {
 	MaxSequencerDrift uint64 `json:"max_sequencer_drift"`
 	// Number of epochs (L1 blocks) per sequencing window
 	SeqWindowSize uint64 `json:"seq_window_size"`
+	// Number of L1 blocks after the L1 block of the first frame of a channel, within which the channel must complete.
+	// Channels that are not complete by then are dropped. Defaults to the sequencing window size if zero,
+	// see derive.ChannelTimeoutOf.
+	ChannelTimeout uint64 `json:"channel_timeout,omitempty"`
+	// Limits of the channels that are buffered for derivation: the max size of the data of a channel,
+	// and the max number of incomplete channels and the max size of their frame data, after which the oldest
+	// channels are evicted. The defaults of the derivation apply if zero, see derive.ChannelLimitsOf.
+	MaxChannelSize     uint64 `json:"max_channel_size,omitempty"`
+	MaxOpenChannels    uint64 `json:"max_open_channels,omitempty"`
+	MaxChannelBankSize uint64 `json:"max_channel_bank_size,omitempty"`
 	// Required to verify L1 signatures
 	L1ChainID *big.Int `json:"l1_chain_id"`
 
@@ -44,6 +57,76 @@ type Config struct {
 	BatchInboxAddress common.Address `json:"batch_inbox_address"`
 	// Acceptable batch-sender address
 	BatchSenderAddress common.Address `json:"batch_sender_address"`
+	// L1 contract that emits the deposit events, the default deposit contract if zero
+	DepositContractAddress common.Address `json:"deposit_contract_address,omitempty"`
+	// L1 contract that emits the system config updates. The system config stays the genesis system config if zero.
+	SystemConfigAddress common.Address `json:"system_config_address,omitempty"`
+	// L2 block gas limit of the genesis system config, zero to leave the gas limit to the engine
+	GenesisGasLimit uint64 `json:"genesis_gas_limit,omitempty"`
+
+	// Note: below are not part of the block-derivation process, and only used for unsafe blocks.
+
+	// L2 chain ID, included in the signatures of unsafe payloads by the sequencer
+	L2ChainID *big.Int `json:"l2_chain_id,omitempty"`
+	// Address of the key that the sequencer signs unsafe payloads with. Signatures are not checked if zero.
+	P2PSequencerAddress common.Address `json:"p2p_sequencer_address,omitempty"`
+	// L2 timestamps of the planned p2p upgrades, in increasing order. The unsafe blocks of each upgrade are gossiped
+	// separately from the blocks before it, see p2p.ComputeForkDigest.
+	P2PUpgradeTimes []uint64 `json:"p2p_upgrade_times,omitempty"`
+}
+
+// SystemConfig is the runtime configuration of the rollup. It starts as the genesis system config,
+// and is updated by events of the L1 system config contract, see derive.UpdateSystemConfigWithL1Receipts.
+type SystemConfig struct {
+	// BatcherAddr is the address that batches must be sent from
+	BatcherAddr common.Address `json:"batcher_addr"`
+	// Overhead and Scalar are the L1 fee parameters
+	Overhead common.Hash `json:"overhead"`
+	Scalar   common.Hash `json:"scalar"`
+	// GasLimit is the L2 block gas limit, zero to leave the gas limit to the engine
+	GasLimit uint64 `json:"gas_limit"`
+}
+
+// GenesisSystemConfig returns the system config at the genesis of the rollup.
+func (c *Config) GenesisSystemConfig() SystemConfig {
+	return SystemConfig{BatcherAddr: c.BatchSenderAddress, GasLimit: c.GenesisGasLimit}
+}
+
+// MaxSeqWindowSize is the largest sequencing window, in L1 blocks. The L1 blocks of a window are buffered for derivation,
+// and a larger window is more likely a mistake than a deliberate choice.
+const MaxSeqWindowSize = 1 << 16
+
+// LoadConfig reads the rollup config from the JSON file at the given path, and checks it.
+// Unknown fields are rejected, to catch misspelled and outdated fields instead of leaving them at their zero value.
+func LoadConfig(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollup config: %w", err)
+	}
+	defer file.Close()
+	cfg, err := DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("rollup config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// DecodeConfig decodes a single JSON rollup config, rejecting unknown fields, and checks it.
+func DecodeConfig(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode: %w", err)
+	}
+	var extra json.RawMessage
+	if err := dec.Decode(&extra); !errors.Is(err, io.EOF) {
+		return nil, errors.New("failed to decode: unexpected data after the config")
+	}
+	if err := cfg.Check(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &cfg, nil
 }
 
 // Check verifies that the given configuration makes sense
@@ -54,6 +137,26 @@ func (cfg *Config) Check() error {
 	if cfg.SeqWindowSize < 2 {
 		return fmt.Errorf("sequencing window size must at least be 2, got %d", cfg.SeqWindowSize)
 	}
+	if cfg.SeqWindowSize > MaxSeqWindowSize {
+		return fmt.Errorf("sequencing window size must at most be %d, got %d", MaxSeqWindowSize, cfg.SeqWindowSize)
+	}
+	if cfg.MaxChannelSize != 0 && cfg.MaxChannelBankSize != 0 && cfg.MaxChannelBankSize < cfg.MaxChannelSize {
+		return fmt.Errorf("max channel bank size %d cannot be less than the max channel size %d", cfg.MaxChannelBankSize, cfg.MaxChannelSize)
+	}
+	if cfg.L1ChainID == nil || cfg.L1ChainID.Sign() <= 0 {
+		return fmt.Errorf("l1 chain id must be positive, got %v", cfg.L1ChainID)
+	}
+	if cfg.L2ChainID != nil {
+		if cfg.L2ChainID.Sign() <= 0 {
+			return fmt.Errorf("l2 chain id must be positive, got %v", cfg.L2ChainID)
+		}
+		if cfg.L2ChainID.Cmp(cfg.L1ChainID) == 0 {
+			return fmt.Errorf("l1 and l2 chain id cannot be the same, got %v", cfg.L1ChainID)
+		}
+	}
+	if cfg.Genesis.L2Time == 0 {
+		return errors.New("genesis l2 time cannot be 0")
+	}
 	if cfg.Genesis.L1.Hash == (common.Hash{}) {
 		return errors.New("genesis l1 hash cannot be empty")
 	}
@@ -63,6 +166,17 @@ func (cfg *Config) Check() error {
 	if cfg.Genesis.L2.Hash == cfg.Genesis.L1.Hash {
 		return errors.New("achievement get! rollup inception: L1 and L2 genesis cannot be the same")
 	}
+	if cfg.BatchInboxAddress == (common.Address{}) {
+		return errors.New("batch inbox address cannot be empty")
+	}
+	if cfg.BatchSenderAddress == (common.Address{}) {
+		return errors.New("batch sender address cannot be empty")
+	}
+	for i, t := range cfg.P2PUpgradeTimes {
+		if t <= cfg.Genesis.L2Time || (i > 0 && t <= cfg.P2PUpgradeTimes[i-1]) {
+			return fmt.Errorf("p2p upgrade times must be after the L2 genesis time and increasing, got %d at %d", t, i)
+		}
+	}
 	return nil
 }
 
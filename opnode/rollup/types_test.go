@@ -1,15 +1,20 @@
 package rollup
 
 import (
+	"bytes"
 	"encoding/json"
 	"math/big"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func randConfig() *Config {
@@ -45,3 +50,91 @@ func TestConfigJSON(t *testing.T) {
 	assert.NoError(t, json.Unmarshal(data, &roundTripped))
 	assert.Equal(t, &roundTripped, config)
 }
+
+func TestConfigCheckBatcher(t *testing.T) {
+	config := randConfig()
+	assert.NoError(t, config.Check())
+
+	config.BatchInboxAddress = common.Address{}
+	assert.Error(t, config.Check(), "batches must be sent to a batch inbox")
+
+	config = randConfig()
+	config.BatchSenderAddress = common.Address{}
+	assert.Error(t, config.Check(), "batches must be authorized by a batcher")
+}
+
+func TestConfigCheckP2PUpgrades(t *testing.T) {
+	config := randConfig()
+	config.P2PUpgradeTimes = []uint64{config.Genesis.L2Time + 10, config.Genesis.L2Time + 20}
+	assert.NoError(t, config.Check())
+
+	config.P2PUpgradeTimes = []uint64{config.Genesis.L2Time + 20, config.Genesis.L2Time + 10}
+	assert.Error(t, config.Check(), "upgrades must be in order")
+
+	config.P2PUpgradeTimes = []uint64{config.Genesis.L2Time}
+	assert.Error(t, config.Check(), "upgrades must be after genesis")
+}
+
+func TestConfigCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		err    string
+	}{
+		{"zero block time", func(cfg *Config) { cfg.BlockTime = 0 }, "block time cannot be 0"},
+		{"small window", func(cfg *Config) { cfg.SeqWindowSize = 1 }, "sequencing window size must at least be 2"},
+		{"large window", func(cfg *Config) { cfg.SeqWindowSize = MaxSeqWindowSize + 1 }, "sequencing window size must at most be"},
+		{"small channel bank", func(cfg *Config) { cfg.MaxChannelSize, cfg.MaxChannelBankSize = 100, 10 }, "max channel bank size 10 cannot be less than"},
+		{"no l1 chain id", func(cfg *Config) { cfg.L1ChainID = nil }, "l1 chain id must be positive"},
+		{"negative l2 chain id", func(cfg *Config) { cfg.L2ChainID = big.NewInt(-1) }, "l2 chain id must be positive"},
+		{"same chain ids", func(cfg *Config) { cfg.L2ChainID = new(big.Int).Set(cfg.L1ChainID) }, "l1 and l2 chain id cannot be the same"},
+		{"no genesis time", func(cfg *Config) { cfg.Genesis.L2Time = 0 }, "genesis l2 time cannot be 0"},
+		{"no l1 genesis", func(cfg *Config) { cfg.Genesis.L1.Hash = common.Hash{} }, "genesis l1 hash cannot be empty"},
+		{"same genesis", func(cfg *Config) { cfg.Genesis.L2.Hash = cfg.Genesis.L1.Hash }, "L1 and L2 genesis cannot be the same"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := randConfig()
+			tt.modify(cfg)
+			err := cfg.Check()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	config := randConfig()
+	data, err := json.Marshal(config)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "rollup.json")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	loaded, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, config, loaded)
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
+
+func TestDecodeConfig(t *testing.T) {
+	data, err := json.Marshal(randConfig())
+	require.NoError(t, err)
+
+	_, err = DecodeConfig(bytes.NewReader(append(data, '\n')))
+	require.NoError(t, err, "trailing whitespace is fine")
+
+	unknown := strings.TrimSuffix(string(data), "}") + `,"max_sequencer_time_diff":10}`
+	_, err = DecodeConfig(strings.NewReader(unknown))
+	require.ErrorContains(t, err, "max_sequencer_time_diff", "unknown fields are rejected")
+
+	_, err = DecodeConfig(bytes.NewReader(append(data, data...)))
+	require.ErrorContains(t, err, "unexpected data after the config")
+
+	invalid := randConfig()
+	invalid.BlockTime = 0
+	data, err = json.Marshal(invalid)
+	require.NoError(t, err)
+	_, err = DecodeConfig(bytes.NewReader(data))
+	require.ErrorContains(t, err, "invalid config: block time cannot be 0")
+}
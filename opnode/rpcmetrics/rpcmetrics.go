@@ -0,0 +1,115 @@
+// Package rpcmetrics records the outbound RPC calls of the rollup node per method:
+// the number of calls and their latency, the number of failed calls, and the size of the responses.
+package rpcmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Metrics records the calls to one RPC endpoint, under "<name>/<method>/" in the metrics registry.
+// A nil *Metrics records nothing.
+type Metrics struct {
+	name string
+}
+
+func New(name string) *Metrics {
+	return &Metrics{name: name}
+}
+
+// Record records a call of the method that started at start, with a response of size bytes.
+// The size is ignored if negative, e.g. when the response is not available in encoded form.
+func (m *Metrics) Record(method string, start time.Time, size int, err error) {
+	if m == nil {
+		return
+	}
+	prefix := m.name + "/" + method
+	metrics.GetOrRegisterTimer(prefix+"/latency", nil).UpdateSince(start)
+	if err != nil {
+		metrics.GetOrRegisterCounter(prefix+"/errors", nil).Inc(1)
+	}
+	if size >= 0 {
+		metrics.GetOrRegisterHistogram(prefix+"/response_bytes", nil, metrics.NewExpDecaySample(1028, 0.015)).Update(int64(size))
+	}
+}
+
+// Caller is an RPC client that can make single calls.
+type Caller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// Call makes the call with the client, and records it. The response is decoded into result after it is measured.
+func Call(ctx context.Context, c Caller, m *Metrics, result interface{}, method string, args ...interface{}) error {
+	if m == nil {
+		return c.CallContext(ctx, result, method, args...)
+	}
+	start := time.Now()
+	var raw json.RawMessage
+	err := c.CallContext(ctx, &raw, method, args...)
+	if err == nil && result != nil && len(raw) > 0 {
+		err = json.Unmarshal(raw, result)
+	}
+	m.Record(method, start, len(raw), err)
+	return err
+}
+
+// Client is the RPC client of an endpoint, as used by the L1 source.
+type Client interface {
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+	EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error)
+	Close()
+}
+
+type instrumentedClient struct {
+	c Client
+	m *Metrics
+}
+
+// Instrument records the calls of the client with the metrics.
+// Batch calls are recorded per element, with the latency of the whole batch.
+func Instrument(c Client, m *Metrics) Client {
+	return &instrumentedClient{c: c, m: m}
+}
+
+func (ic *instrumentedClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return Call(ctx, ic.c, ic.m, result, method, args...)
+}
+
+func (ic *instrumentedClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	start := time.Now()
+	raws := make([]json.RawMessage, len(b))
+	measured := make([]rpc.BatchElem, len(b))
+	for i, elem := range b {
+		measured[i] = elem
+		measured[i].Result = &raws[i]
+	}
+	err := ic.c.BatchCallContext(ctx, measured)
+	for i := range b {
+		b[i].Error = measured[i].Error
+		if err == nil && b[i].Error == nil && b[i].Result != nil && len(raws[i]) > 0 {
+			b[i].Error = json.Unmarshal(raws[i], b[i].Result)
+		}
+		elemErr := err
+		if elemErr == nil {
+			elemErr = b[i].Error
+		}
+		ic.m.Record(b[i].Method, start, len(raws[i]), elemErr)
+	}
+	return err
+}
+
+func (ic *instrumentedClient) EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	start := time.Now()
+	sub, err := ic.c.EthSubscribe(ctx, channel, args...)
+	ic.m.Record("eth_subscribe", start, -1, err)
+	return sub, err
+}
+
+func (ic *instrumentedClient) Close() {
+	ic.c.Close()
+}
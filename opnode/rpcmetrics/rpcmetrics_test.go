@@ -0,0 +1,57 @@
+package rpcmetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+type testAPI struct{}
+
+func (testAPI) Echo(s string) string { return s }
+
+func (testAPI) Fail() error { return errors.New("fail") }
+
+func TestInstrument(t *testing.T) {
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = false }()
+	srv := rpc.NewServer()
+	require.NoError(t, srv.RegisterName("test", testAPI{}))
+	t.Cleanup(srv.Stop)
+	c := Instrument(rpc.DialInProc(srv), New("rpc/test_instrument"))
+	ctx := context.Background()
+
+	var res string
+	require.NoError(t, c.CallContext(ctx, &res, "test_echo", "hello"))
+	require.Equal(t, "hello", res)
+	require.Error(t, c.CallContext(ctx, nil, "test_fail"))
+
+	batch := []rpc.BatchElem{
+		{Method: "test_echo", Args: []interface{}{"a"}, Result: new(string)},
+		{Method: "test_fail", Result: new(string)},
+	}
+	require.NoError(t, c.BatchCallContext(ctx, batch))
+	require.Equal(t, "a", *batch[0].Result.(*string))
+	require.NoError(t, batch[0].Error)
+	require.Error(t, batch[1].Error)
+
+	require.Equal(t, int64(2), metrics.GetOrRegisterTimer("rpc/test_instrument/test_echo/latency", nil).Count())
+	require.Zero(t, metrics.GetOrRegisterCounter("rpc/test_instrument/test_echo/errors", nil).Count())
+	require.Equal(t, int64(2), metrics.GetOrRegisterCounter("rpc/test_instrument/test_fail/errors", nil).Count())
+	sizes := metrics.GetOrRegisterHistogram("rpc/test_instrument/test_echo/response_bytes", nil, metrics.NewExpDecaySample(1028, 0.015))
+	require.Equal(t, int64(len(`"hello"`)), sizes.Max())
+	require.Equal(t, int64(len(`"a"`)), sizes.Min())
+}
+
+func TestNilMetrics(t *testing.T) {
+	srv := rpc.NewServer()
+	require.NoError(t, srv.RegisterName("test", testAPI{}))
+	t.Cleanup(srv.Stop)
+	var res string
+	require.NoError(t, Call(context.Background(), rpc.DialInProc(srv), nil, &res, "test_echo", "hi"))
+	require.Equal(t, "hi", res)
+}
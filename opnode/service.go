@@ -2,16 +2,34 @@ package opnode
 
 import (
 	"crypto/ecdsa"
-	"encoding/json"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/big"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/ethereum-optimism/optimistic-specs/opnode/bss"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/eth"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/events"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/flags"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/heartbeat"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l1"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/l2"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/networks"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/node"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/p2p"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/tracing"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	p2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/urfave/cli"
 )
 
@@ -25,10 +43,25 @@ func NewConfig(ctx *cli.Context) (*node.Config, error) {
 	enableSequencing := ctx.GlobalBool(flags.SequencingEnabledFlag.Name)
 
 	var batchSubmitterKey *ecdsa.PrivateKey
-	if enableSequencing {
+	submitterSigner := bss.RemoteSignerConfig{
+		Addr:      ctx.GlobalString(flags.BatchSubmitterSignerAddrFlag.Name),
+		Namespace: ctx.GlobalString(flags.BatchSubmitterSignerNamespaceFlag.Name),
+	}
+	submitterKMS := bss.AWSKMSConfig{
+		KeyID:    ctx.GlobalString(flags.BatchSubmitterKMSKeyIDFlag.Name),
+		Region:   ctx.GlobalString(flags.BatchSubmitterKMSRegionFlag.Name),
+		Endpoint: ctx.GlobalString(flags.BatchSubmitterKMSEndpointFlag.Name),
+	}
+	if enableSequencing && submitterSigner.Addr != "" {
+		account := ctx.GlobalString(flags.BatchSubmitterSignerAccountFlag.Name)
+		if !common.IsHexAddress(account) {
+			return nil, fmt.Errorf("remote signer of the batch submitter needs a valid account, got %q", account)
+		}
+		submitterSigner.Account = common.HexToAddress(account)
+	} else if enableSequencing && submitterKMS.KeyID == "" {
 		keyFile := ctx.GlobalString(flags.BatchSubmitterKeyFlag.Name)
 		if keyFile == "" {
-			return nil, errors.New("sequencer mode needs batch-submitter key")
+			return nil, errors.New("sequencer mode needs batch-submitter key, remote signer or KMS key")
 		}
 		// TODO we should be using encrypted keystores.
 		// Mnemonics are bad because they leak *all* keys when they leak
@@ -39,22 +72,124 @@ func NewConfig(ctx *cli.Context) (*node.Config, error) {
 		}
 	}
 
+	submitterTxManager := bss.TxManagerConfig{
+		ResubmissionTimeout: ctx.GlobalDuration(flags.BatchSubmitterResubmissionTimeoutFlag.Name),
+		FeeEstimator: bss.FeeEstimatorConfig{
+			HistoryBlocks:     ctx.GlobalUint64(flags.BatchSubmitterFeeHistoryBlocksFlag.Name),
+			BaseFeeMultiplier: ctx.GlobalFloat64(flags.BatchSubmitterBaseFeeMultiplierFlag.Name),
+			TipMultiplier:     ctx.GlobalFloat64(flags.BatchSubmitterTipMultiplierFlag.Name),
+		},
+	}
+	if gwei := ctx.GlobalUint64(flags.BatchSubmitterMaxGasPriceFlag.Name); gwei != 0 {
+		submitterTxManager.MaxGasPrice = new(big.Int).Mul(new(big.Int).SetUint64(gwei), big.NewInt(params.GWei))
+	}
+	if gwei := ctx.GlobalUint64(flags.BatchSubmitterMaxTipFlag.Name); gwei != 0 {
+		submitterTxManager.FeeEstimator.MaxTip = new(big.Int).Mul(new(big.Int).SetUint64(gwei), big.NewInt(params.GWei))
+	}
+
+	l1RateLimit, err := NewL1RateLimitConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	engineAuth, err := NewL2EngineAuthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	withdrawalContractAddress := WithdrawalContractAddress
 	if value := ctx.GlobalString(flags.WithdrawalContractAddr.Name); value != "" {
 		withdrawalContractAddress = common.HexToAddress(value)
 	}
 
+	checkpoint, err := NewCheckpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p2pConfig, err := NewP2PConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	cfg := &node.Config{
-		L1NodeAddr:             ctx.GlobalString(flags.L1NodeAddr.Name),
-		L2EngineAddrs:          ctx.GlobalStringSlice(flags.L2EngineAddrs.Name),
-		L2NodeAddr:             ctx.GlobalString(flags.L2EthNodeAddr.Name),
-		L1TrustRPC:             ctx.GlobalBool(flags.L1TrustRPC.Name),
+		L1NodeAddr:            ctx.GlobalString(flags.L1NodeAddr.Name),
+		L2EngineAddrs:         ctx.GlobalStringSlice(flags.L2EngineAddrs.Name),
+		L2NodeAddr:            ctx.GlobalString(flags.L2EthNodeAddr.Name),
+		L2EngineAuth:          engineAuth,
+		L1TrustRPC:            ctx.GlobalBool(flags.L1TrustRPC.Name),
+		L1FallbackAddrs:       ctx.GlobalStringSlice(flags.L1FallbackAddrs.Name),
+		L2SecondaryEngineAddr: ctx.GlobalString(flags.L2SecondaryEngineAddr.Name),
+		L1Failover: l1.FailoverConfig{
+			RequestTimeout:      ctx.GlobalDuration(flags.L1RequestTimeout.Name),
+			HealthCheckInterval: ctx.GlobalDuration(flags.L1HealthCheckInterval.Name),
+			CrossCheck:          ctx.GlobalBool(flags.L1CrossCheck.Name),
+			CrossCheckDepth:     ctx.GlobalUint64(flags.L1CrossCheckDepth.Name),
+		},
+		L1RateLimit:            l1RateLimit,
+		L1PollInterval:         ctx.GlobalDuration(flags.L1PollInterval.Name),
+		L1BeaconHeaders:        ctx.GlobalBool(flags.L1BeaconHeaders.Name),
+		DataDir:                ctx.GlobalString(flags.DataDirFlag.Name),
 		Rollup:                 *rollupConfig,
-		Sequencer:              enableSequencing,
 		SubmitterPrivKey:       batchSubmitterKey,
+		SubmitterSigner:        submitterSigner,
+		SubmitterKMS:           submitterKMS,
+		SubmitterTxManager:     submitterTxManager,
+		SubmitterMaxTxDataSize: ctx.GlobalInt(flags.BatchSubmitterMaxTxDataSizeFlag.Name),
+		SubmitterMaxTxGas:      ctx.GlobalUint64(flags.BatchSubmitterMaxTxGasFlag.Name),
+		SubmitterDryRun:        ctx.GlobalBool(flags.BatchSubmitterDryRunFlag.Name),
+		SubmitterBlobs:         ctx.GlobalBool(flags.BatchSubmitterBlobsFlag.Name),
+		BatchCompression:       ctx.GlobalString(flags.BatchCompressionFlag.Name),
+		SpanBatches:            ctx.GlobalBool(flags.SpanBatchesFlag.Name),
+		P2P:                    p2pConfig,
 		RPCListenAddr:          ctx.GlobalString(flags.RPCListenAddr.Name),
 		RPCListenPort:          ctx.GlobalInt(flags.RPCListenPort.Name),
+		RPCEnableAdmin:         ctx.GlobalBool(flags.RPCEnableAdmin.Name),
+		RPCReadyMaxStaleness:   ctx.GlobalDuration(flags.RPCReadyMaxStaleness.Name),
 		WithdrawalContractAddr: withdrawalContractAddress,
+		Metrics: node.MetricsConfig{
+			Enabled:    ctx.GlobalBool(flags.MetricsEnabledFlag.Name),
+			ListenAddr: ctx.GlobalString(flags.MetricsAddrFlag.Name),
+			ListenPort: ctx.GlobalInt(flags.MetricsPortFlag.Name),
+		},
+		Pprof: node.PprofConfig{
+			Enabled:    ctx.GlobalBool(flags.PprofEnabledFlag.Name),
+			ListenAddr: ctx.GlobalString(flags.PprofAddrFlag.Name),
+			ListenPort: ctx.GlobalInt(flags.PprofPortFlag.Name),
+		},
+		Tracing: tracing.Config{
+			Endpoint:    ctx.GlobalString(flags.TracingEndpointFlag.Name),
+			Insecure:    ctx.GlobalBool(flags.TracingInsecureFlag.Name),
+			SampleRatio: ctx.GlobalFloat64(flags.TracingSampleRatioFlag.Name),
+		},
+		Heartbeat: heartbeat.Config{
+			URL:      ctx.GlobalString(flags.HeartbeatURLFlag.Name),
+			Interval: ctx.GlobalDuration(flags.HeartbeatIntervalFlag.Name),
+			Moniker:  ctx.GlobalString(flags.HeartbeatMonikerFlag.Name),
+		},
+		Events: events.Config{
+			Sinks: ctx.GlobalStringSlice(flags.EventSinksFlag.Name),
+		},
+		Driver: driver.Config{
+			SequencerEnabled:       enableSequencing,
+			SequencerStopped:       ctx.GlobalBool(flags.SequencerStoppedFlag.Name),
+			BatchSubmitInterval:    ctx.GlobalDuration(flags.BatchSubmitIntervalFlag.Name),
+			MaxBatchSubmissionSize: ctx.GlobalUint64(flags.MaxBatchSubmissionSizeFlag.Name),
+			MaxUnsafeLagBlocks:     ctx.GlobalUint64(flags.SequencerMaxUnsafeLagBlocksFlag.Name),
+			MaxUnsafeLagTime:       ctx.GlobalDuration(flags.SequencerMaxUnsafeLagTimeFlag.Name),
+			PayloadBuildTime:       ctx.GlobalDuration(flags.SequencerPayloadBuildTimeFlag.Name),
+			Checkpoint:             checkpoint,
+			SnapSyncThreshold:      ctx.GlobalUint64(flags.SnapSyncThresholdFlag.Name),
+			MaxReorgDepth:          ctx.GlobalUint64(flags.MaxReorgDepthFlag.Name),
+			ReorgHistorySize:       ctx.GlobalInt(flags.ReorgHistorySizeFlag.Name),
+			MaxQueuedPayloads:      ctx.GlobalInt(flags.MaxQueuedPayloadsFlag.Name),
+			L1HeadTimeout:          ctx.GlobalDuration(flags.L1HeadTimeoutFlag.Name),
+			NewBlockTimeout:        ctx.GlobalDuration(flags.NewBlockTimeoutFlag.Name),
+			L1RangeTimeout:         ctx.GlobalDuration(flags.L1RangeTimeoutFlag.Name),
+			StepTimeout:            ctx.GlobalDuration(flags.StepTimeoutFlag.Name),
+			L1BeaconAddr:           ctx.GlobalString(flags.L1BeaconAddr.Name),
+			BatchDataDir:           ctx.GlobalString(flags.BatchDataDirFlag.Name),
+		},
 	}
 	if err := cfg.Check(); err != nil {
 		return nil, err
@@ -62,19 +197,209 @@ func NewConfig(ctx *cli.Context) (*node.Config, error) {
 	return cfg, nil
 }
 
+// NewL1RateLimitConfig creates the rate limits of the L1 RPC from the flags.
+func NewL1RateLimitConfig(ctx *cli.Context) (l1.RateLimitConfig, error) {
+	cfg := l1.RateLimitConfig{
+		RequestsPerSecond: ctx.GlobalFloat64(flags.L1RateLimit.Name),
+		Burst:             ctx.GlobalInt(flags.L1RateLimitBurst.Name),
+	}
+	for _, limit := range ctx.GlobalStringSlice(flags.L1MethodRateLimits.Name) {
+		method, value, ok := strings.Cut(limit, "=")
+		if !ok {
+			return cfg, fmt.Errorf("invalid L1 method rate limit %q, expected method=rate", limit)
+		}
+		rps, err := strconv.ParseFloat(value, 64)
+		if err != nil || rps <= 0 {
+			return cfg, fmt.Errorf("invalid L1 method rate limit %q, expected a positive rate", limit)
+		}
+		if cfg.MethodRequestsPerSecond == nil {
+			cfg.MethodRequestsPerSecond = make(map[string]float64)
+		}
+		cfg.MethodRequestsPerSecond[method] = rps
+	}
+	return cfg, nil
+}
+
+// NewP2PConfig creates the config of the p2p stack from the flags, nil if the p2p stack is not enabled.
+func NewP2PConfig(ctx *cli.Context) (*p2p.Config, error) {
+	if !ctx.GlobalBool(flags.P2PEnabledFlag.Name) {
+		return nil, nil
+	}
+	listenAddrs, err := p2p.ParseMultiaddrs(ctx.GlobalStringSlice(flags.P2PListenAddrsFlag.Name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p2p listen address: %w", err)
+	}
+	bootnodes, err := p2p.ParsePeers(ctx.GlobalStringSlice(flags.P2PBootnodesFlag.Name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p2p bootnode: %w", err)
+	}
+	staticPeers, err := p2p.ParsePeers(ctx.GlobalStringSlice(flags.P2PStaticPeersFlag.Name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p2p static peer: %w", err)
+	}
+	allowlist, err := p2p.ParsePeerIDs(ctx.GlobalStringSlice(flags.P2PPeerAllowlistFlag.Name))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p2p allowlist: %w", err)
+	}
+	cfg := &p2p.Config{
+		ListenAddrs:      listenAddrs,
+		Bootnodes:        bootnodes,
+		StaticPeers:      staticPeers,
+		PeerAllowlist:    allowlist,
+		MaxPeers:         ctx.GlobalInt(flags.P2PMaxPeersFlag.Name),
+		MaxBandwidth:     ctx.GlobalUint64(flags.P2PMaxBandwidthFlag.Name),
+		MaxPeerBandwidth: ctx.GlobalUint64(flags.P2PMaxPeerBandwidthFlag.Name),
+	}
+	if !ctx.GlobalBool(flags.P2PNoDiscoveryFlag.Name) {
+		cfg.Discovery, err = NewDiscoveryConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if keyFile := ctx.GlobalString(flags.P2PPrivKeyFlag.Name); keyFile != "" {
+		key, err := crypto.LoadECDSA(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read p2p private key: %w", err)
+		}
+		cfg.PrivKey, err = p2pcrypto.UnmarshalSecp256k1PrivateKey(crypto.FromECDSA(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid p2p private key: %w", err)
+		}
+	}
+	if keyFile := ctx.GlobalString(flags.P2PPrivateNetworkKeyFlag.Name); keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read p2p private network key: %w", err)
+		}
+		cfg.PrivateNetworkKey, err = hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid p2p private network key: %w", err)
+		}
+	}
+	if keyFile := ctx.GlobalString(flags.P2PSequencerKeyFlag.Name); keyFile != "" {
+		cfg.SequencerKey, err = crypto.LoadECDSA(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read p2p sequencer key: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// NewDiscoveryConfig creates the config of the discovery of the peers from the flags.
+// The discovered nodes are persisted in the data directory, if any.
+func NewDiscoveryConfig(ctx *cli.Context) (*p2p.DiscoveryConfig, error) {
+	bootnodes, err := p2p.ParseBootnodes(ctx.GlobalStringSlice(flags.P2PDiscoveryBootnodesFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	cfg := &p2p.DiscoveryConfig{
+		Port:      ctx.GlobalInt(flags.P2PDiscoveryPortFlag.Name),
+		Bootnodes: bootnodes,
+	}
+	if ip := ctx.GlobalString(flags.P2PAdvertiseIPFlag.Name); ip != "" {
+		cfg.AdvertiseIP = net.ParseIP(ip)
+		if cfg.AdvertiseIP == nil {
+			return nil, fmt.Errorf("invalid p2p advertise IP %q", ip)
+		}
+	}
+	if dir := ctx.GlobalString(flags.DataDirFlag.Name); dir != "" {
+		cfg.DBPath = filepath.Join(dir, "discovery")
+	}
+	return cfg, nil
+}
+
+func NewL2EngineAuthConfig(ctx *cli.Context) (l2.JWTConfig, error) {
+	cfg := l2.JWTConfig{
+		RefreshInterval: ctx.GlobalDuration(flags.L2EngineJWTRefreshInterval.Name),
+		ClockSkew:       ctx.GlobalDuration(flags.L2EngineJWTClockSkew.Name),
+	}
+	if path := ctx.GlobalString(flags.L2EngineJWTSecret.Name); path != "" {
+		secret, err := l2.ReadJWTSecret(path)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Secret = secret
+	}
+	return cfg, nil
+}
+
+// NewRollupConfig returns the rollup config of the known network, or loads a custom rollup config file,
+// with the channel limits of the flags, if set.
 func NewRollupConfig(ctx *cli.Context) (*rollup.Config, error) {
-	rollupConfigPath := ctx.GlobalString(flags.RollupConfig.Name)
-	file, err := os.Open(rollupConfigPath)
+	network := ctx.GlobalString(flags.Network.Name)
+	path := ctx.GlobalString(flags.RollupConfig.Name)
+	var cfg *rollup.Config
+	var err error
+	switch {
+	case network != "" && path != "":
+		return nil, fmt.Errorf("only one of --%s and --%s can be set", flags.Network.Name, flags.RollupConfig.Name)
+	case network != "":
+		cfg, err = networks.Config(network)
+	case path != "":
+		cfg, err = LoadRollupConfig(path)
+	default:
+		return nil, fmt.Errorf("either --%s or --%s is required", flags.Network.Name, flags.RollupConfig.Name)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to read rollup config: %v", err)
+		return nil, err
+	}
+	if ctx.GlobalIsSet(flags.MaxChannelSize.Name) {
+		cfg.MaxChannelSize = ctx.GlobalUint64(flags.MaxChannelSize.Name)
+	}
+	if ctx.GlobalIsSet(flags.MaxOpenChannels.Name) {
+		cfg.MaxOpenChannels = ctx.GlobalUint64(flags.MaxOpenChannels.Name)
+	}
+	if ctx.GlobalIsSet(flags.MaxChannelBankSize.Name) {
+		cfg.MaxChannelBankSize = ctx.GlobalUint64(flags.MaxChannelBankSize.Name)
+	}
+	if err := cfg.Check(); err != nil {
+		return nil, fmt.Errorf("invalid rollup config: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadRollupConfig reads the rollup config from the JSON file at the given path,
+// and fails on unknown fields and invalid configs, see rollup.LoadConfig.
+func LoadRollupConfig(rollupConfigPath string) (*rollup.Config, error) {
+	return rollup.LoadConfig(rollupConfigPath)
+}
+
+// NewCheckpoint creates the trusted L2 checkpoint to sync from, if any is configured.
+func NewCheckpoint(ctx *cli.Context) (*driver.Checkpoint, error) {
+	l2Value := ctx.GlobalString(flags.CheckpointL2Flag.Name)
+	l1Value := ctx.GlobalString(flags.CheckpointL1OriginFlag.Name)
+	if l2Value == "" && l1Value == "" {
+		return nil, nil
+	}
+	if l2Value == "" || l1Value == "" {
+		return nil, errors.New("checkpoint needs both the L2 block and its L1 origin")
 	}
-	defer file.Close()
+	l2, err := parseBlockID(l2Value)
+	if err != nil {
+		return nil, fmt.Errorf("bad L2 checkpoint: %v", err)
+	}
+	l1Origin, err := parseBlockID(l1Value)
+	if err != nil {
+		return nil, fmt.Errorf("bad L1 origin of checkpoint: %v", err)
+	}
+	return &driver.Checkpoint{L2: l2, L1Origin: l1Origin}, nil
+}
 
-	var rollupConfig rollup.Config
-	if err := json.NewDecoder(file).Decode(&rollupConfig); err != nil {
-		return nil, fmt.Errorf("failed to decode rollup config: %v", err)
+// parseBlockID parses a block ID formatted as <hash>:<number>
+func parseBlockID(value string) (eth.BlockID, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return eth.BlockID{}, fmt.Errorf("expected <hash>:<number>, got %q", value)
+	}
+	var hash common.Hash
+	if err := hash.UnmarshalText([]byte(parts[0])); err != nil {
+		return eth.BlockID{}, fmt.Errorf("bad block hash: %v", err)
 	}
-	return &rollupConfig, nil
+	num, err := strconv.ParseUint(parts[1], 0, 64)
+	if err != nil {
+		return eth.BlockID{}, fmt.Errorf("bad block number: %v", err)
+	}
+	return eth.BlockID{Hash: hash, Number: num}, nil
 }
 
 // NewLogConfig creates a log config from the provided flags or environment variables.
@@ -91,3 +416,21 @@ func NewLogConfig(ctx *cli.Context) (node.LogConfig, error) {
 	}
 	return cfg, nil
 }
+
+// NewSnapshotLogger creates the logger for driver state snapshots.
+// Snapshots are discarded unless a snapshot log file is configured.
+func NewSnapshotLogger(ctx *cli.Context) (log.Logger, error) {
+	snapshotFile := ctx.GlobalString(flags.SnapshotLog.Name)
+	handler := log.DiscardHandler()
+	if snapshotFile != "" {
+		var err error
+		handler, err = log.FileHandler(snapshotFile, log.JSONFormat())
+		if err != nil {
+			return nil, err
+		}
+		handler = log.SyncHandler(handler)
+	}
+	logger := log.New()
+	logger.SetHandler(handler)
+	return logger, nil
+}
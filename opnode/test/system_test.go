@@ -18,6 +18,7 @@ import (
 	"github.com/ethereum-optimism/optimistic-specs/opnode/internal/testlog"
 	rollupNode "github.com/ethereum-optimism/optimistic-specs/opnode/node"
 	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup"
+	"github.com/ethereum-optimism/optimistic-specs/opnode/rollup/driver"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts"
@@ -180,7 +181,7 @@ func TestSystemE2E(t *testing.T) {
 			BatchSenderAddress:  submitterAddress,
 		},
 	}
-	node, err := rollupNode.New(context.Background(), nodeCfg, testlog.Logger(t, log.LvlError), "")
+	node, err := rollupNode.New(context.Background(), nodeCfg, testlog.Logger(t, log.LvlError), log.New(), rollupNode.VersionInfo{})
 	require.Nil(t, err)
 
 	err = node.Start(context.Background())
@@ -208,12 +209,14 @@ func TestSystemE2E(t *testing.T) {
 			BatchInboxAddress:   common.Address{0xff, 0x02},
 			BatchSenderAddress:  submitterAddress,
 		},
-		Sequencer:        true,
+		Driver: driver.Config{
+			SequencerEnabled: true,
+		},
 		SubmitterPrivKey: bssPrivKey,
 		RPCListenAddr:    "127.0.0.1",
 		RPCListenPort:    9093,
 	}
-	sequencer, err := rollupNode.New(context.Background(), sequenceCfg, testlog.Logger(t, log.LvlError), "")
+	sequencer, err := rollupNode.New(context.Background(), sequenceCfg, testlog.Logger(t, log.LvlError), log.New(), rollupNode.VersionInfo{})
 	require.Nil(t, err)
 
 	err = sequencer.Start(context.Background())
@@ -0,0 +1,85 @@
+// Package tracing exports the trace spans of the rollup node over OTLP, so that the latency of the derivation
+// and of the sequencing of each L2 block can be broken down by stage: the handling of the L1 heads, the extension
+// of the L1 sequencing window, the decoding of the batches, the building of the payload attributes, the insertion
+// of the payloads into the engine, and the batch submission.
+//
+// The packages of the node create their spans with the global tracer provider of OpenTelemetry, the spans are
+// dropped unless the provider of NewProvider is set as the global provider.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName = "opnode"
+	// DefaultSampleRatio traces every L2 block
+	DefaultSampleRatio = 1.0
+)
+
+type Config struct {
+	// Endpoint is the host:port of the OTLP/HTTP collector to export the spans to, tracing is disabled if empty
+	Endpoint string
+	// Insecure exports the spans over HTTP instead of HTTPS
+	Insecure bool
+	// SampleRatio is the fraction of the traces that are sampled, between 0 and 1
+	SampleRatio float64
+}
+
+func (cfg *Config) Enabled() bool {
+	return cfg.Endpoint != ""
+}
+
+// Check verifies that the given configuration makes sense
+func (cfg *Config) Check() error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return fmt.Errorf("trace sample ratio %v is not between 0 and 1", cfg.SampleRatio)
+	}
+	return nil
+}
+
+// NewProvider creates the tracer provider that exports the spans of the node to the OTLP collector.
+// The spans are exported in batches in the background, the provider must be shut down to flush them.
+func NewProvider(ctx context.Context, cfg *Config, version string) (*sdktrace.TracerProvider, error) {
+	if !cfg.Enabled() {
+		return nil, errors.New("no OTLP endpoint to export the spans to")
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP exporter: %w", err)
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(ServiceName),
+		semconv.ServiceVersionKey.String(version),
+	)
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	), nil
+}
+
+// End records the error of the stage of the span, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestConfigCheck(t *testing.T) {
+	require.NoError(t, (&Config{}).Check())
+	require.NoError(t, (&Config{Endpoint: "localhost:4318", SampleRatio: DefaultSampleRatio}).Check())
+	require.Error(t, (&Config{Endpoint: "localhost:4318", SampleRatio: 1.5}).Check())
+	require.Error(t, (&Config{Endpoint: "localhost:4318", SampleRatio: -1}).Check())
+}
+
+func TestNewProvider(t *testing.T) {
+	_, err := NewProvider(context.Background(), &Config{}, "v0.0.0")
+	require.Error(t, err)
+	provider, err := NewProvider(context.Background(), &Config{Endpoint: "localhost:4318", Insecure: true, SampleRatio: DefaultSampleRatio}, "v0.0.0")
+	require.NoError(t, err)
+	require.NoError(t, provider.Shutdown(context.Background()))
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "ok")
+	End(span, nil)
+	_, span = tracer.Start(context.Background(), "failed")
+	End(span, errors.New("engine unavailable"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+	require.Equal(t, "engine unavailable", spans[1].Status().Description)
+	require.Len(t, spans[1].Events(), 1, "the error is recorded as an event of the span")
+}
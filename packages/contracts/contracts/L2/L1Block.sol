@@ -12,16 +12,22 @@ contract L1Block {
 
     address public constant DEPOSITOR_ACCOUNT = 0xDeaDDEaDDeAdDeAdDEAdDEaddeAddEAdDEAd0001;
 
-    uint256 public number;
-    uint256 public timestamp;
+    uint64 public number;
+    uint64 public timestamp;
     uint256 public basefee;
     bytes32 public hash;
+    uint64 public sequenceNumber;
+    uint256 public l1FeeOverhead;
+    uint256 public l1FeeScalar;
 
     function setL1BlockValues(
-        uint256 _number,
-        uint256 _timestamp,
+        uint64 _number,
+        uint64 _timestamp,
         uint256 _basefee,
-        bytes32 _hash
+        bytes32 _hash,
+        uint64 _sequenceNumber,
+        uint256 _l1FeeOverhead,
+        uint256 _l1FeeScalar
     ) external {
         if (msg.sender != DEPOSITOR_ACCOUNT) {
             revert OnlyDepositor();
@@ -31,5 +37,8 @@ contract L1Block {
         timestamp = _timestamp;
         basefee = _basefee;
         hash = _hash;
+        sequenceNumber = _sequenceNumber;
+        l1FeeOverhead = _l1FeeOverhead;
+        l1FeeScalar = _l1FeeScalar;
     }
 }
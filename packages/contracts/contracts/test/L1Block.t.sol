@@ -15,7 +15,7 @@ contract L1BLockTest is DSTest {
         lb = new L1Block();
         depositor = lb.DEPOSITOR_ACCOUNT();
         vm.prank(depositor);
-        lb.setL1BlockValues(1, 2, 3, NON_ZERO_HASH);
+        lb.setL1BlockValues(1, 2, 3, NON_ZERO_HASH, 4, 5, 6);
     }
 
     function test_number() external {
@@ -33,4 +33,16 @@ contract L1BLockTest is DSTest {
     function test_hash() external {
         assertEq(lb.hash(), NON_ZERO_HASH);
     }
+
+    function test_sequenceNumber() external {
+        assertEq(lb.sequenceNumber(), 4);
+    }
+
+    function test_l1FeeOverhead() external {
+        assertEq(lb.l1FeeOverhead(), 5);
+    }
+
+    function test_l1FeeScalar() external {
+        assertEq(lb.l1FeeScalar(), 6);
+    }
 }